@@ -0,0 +1,189 @@
+package cli
+
+// This file contains CPU pinning of the executed tests with --gomaxprocs and
+// --cpu-affinity, which makes benchmark results reproducible.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/urfave/cli/v2"
+)
+
+// cpuListRe matches a CPU list as accepted by taskset -c (e.g., 0-3,8,10-11).
+var cpuListRe = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// cpuAffinityFlag returns the flag pinning processes to CPUs.
+func cpuAffinityFlag(usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "cpu-affinity",
+		Usage: usage,
+	}
+}
+
+// validateCPUList returns an error if list is not a valid taskset CPU list.
+func validateCPUList(list string) error {
+	if !cpuListRe.MatchString(list) {
+		return fmt.Errorf("invalid --cpu-affinity %q: must be a CPU list like 0-3,8", list)
+	}
+	return nil
+}
+
+// resolveCPUAffinity returns the CPU list to pin to on the target OS. CPU
+// affinity is only supported on Linux, other systems run unpinned.
+func (a *App) resolveCPUAffinity(goos, list string) string {
+	if list == "" || goos == "linux" {
+		return list
+	}
+	a.logger.Warn().
+		Str("os", goos).
+		Str("cpu_affinity", list).
+		Msg("CPU affinity is only supported on Linux, running without it")
+	return ""
+}
+
+// gomaxprocsEnv adds the GOMAXPROCS assignment for --gomaxprocs to env. It
+// returns an error if env sets GOMAXPROCS as well.
+func gomaxprocsEnv(env []string, gomaxprocs int) ([]string, error) {
+	if gomaxprocs == 0 {
+		return env, nil
+	}
+	if gomaxprocs < 0 {
+		return nil, fmt.Errorf("invalid --gomaxprocs %d: must be positive", gomaxprocs)
+	}
+	for _, assignment := range env {
+		if strings.HasPrefix(assignment, "GOMAXPROCS=") {
+			return nil, fmt.Errorf("--gomaxprocs conflicts with --env %s", assignment)
+		}
+	}
+	return append(env, fmt.Sprintf("GOMAXPROCS=%d", gomaxprocs)), nil
+}
+
+// tasksetArgs prefixes the command given by args with taskset when a CPU list
+// is set.
+func tasksetArgs(cpuList string, args []string) []string {
+	if cpuList == "" {
+		return args
+	}
+	return append([]string{"taskset", "-c", cpuList}, args...)
+}
+
+// localTestCommand returns the command running name with args locally, pinned
+// to the --cpu-affinity CPUs and with the --env assignments set.
+func (a *App) localTestCommand(name string, args ...string) runner.Cmd {
+	cmdArgs := tasksetArgs(a.testCPUAffinity, append([]string{name}, args...))
+	return runner.Cmd{
+		Name: cmdArgs[0],
+		Args: cmdArgs[1:],
+		Env:  a.localTestEnv(),
+	}
+}
+
+// tasksetPIDCommand returns the command pinning all threads of a running
+// process to the CPUs in cpuList.
+func tasksetPIDCommand(cpuList, pid string) string {
+	return fmt.Sprintf("taskset -a -c -p %s %s", shellescape.Quote(cpuList), shellescape.Quote(pid))
+}
+
+// tidRe matches a thread ID.
+var tidRe = regexp.MustCompile(`^\d+$`)
+
+// affinityMaskRe matches a CPU affinity mask as printed by taskset -p.
+var affinityMaskRe = regexp.MustCompile(`^[0-9a-f,]+$`)
+
+// threadAffinity is the CPU affinity mask of a thread before it was pinned.
+type threadAffinity struct {
+	tid  string
+	mask string
+}
+
+// tasksetSaveCommand returns the command printing the TID and CPU affinity
+// mask of each thread of a running process, one thread per line.
+func tasksetSaveCommand(pid string) string {
+	return fmt.Sprintf(`for t in /proc/%s/task/*; do tid=${t##*/}; echo "$tid $(taskset -p "$tid" | awk '{print $NF}')"; done`, shellescape.Quote(pid))
+}
+
+// parseThreadAffinities parses the output of tasksetSaveCommand for pid.
+func parseThreadAffinities(pid, out string) ([]threadAffinity, error) {
+	var threads []threadAffinity
+	foundMain := false
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !tidRe.MatchString(fields[0]) || !affinityMaskRe.MatchString(fields[1]) {
+			return nil, fmt.Errorf("unexpected taskset output %q", line)
+		}
+		threads = append(threads, threadAffinity{tid: fields[0], mask: fields[1]})
+		foundMain = foundMain || fields[0] == pid
+	}
+	if !foundMain {
+		return nil, fmt.Errorf("no affinity of the main thread in taskset output %q", out)
+	}
+	return threads, nil
+}
+
+// tasksetRestoreCommand returns the command restoring the saved CPU affinity
+// of the threads of a process. Threads started while it was pinned get the
+// mask of the main thread, threads that exited meanwhile are skipped.
+func tasksetRestoreCommand(pid string, threads []threadAffinity) string {
+	var main string
+	var restores []string
+	for _, thread := range threads {
+		if thread.tid == pid {
+			main = thread.mask
+			continue
+		}
+		restores = append(restores, fmt.Sprintf("taskset -p %s %s >/dev/null 2>&1", thread.mask, thread.tid))
+	}
+	cmd := fmt.Sprintf("taskset -a -p %s %s >/dev/null", main, shellescape.Quote(pid))
+	if len(restores) == 0 {
+		return cmd
+	}
+	return fmt.Sprintf("%s && { %s; true; }", cmd, strings.Join(restores, "; "))
+}
+
+// pinPIDs pins all threads of the given processes to the CPUs in cpuList,
+// after saving their CPU affinity. The returned function restores it, it must
+// be called once the run ends, also if it failed or was interrupted.
+func (a *App) pinPIDs(exec shellExec, cpuList string, pids []string) (func(), error) {
+	saved := make(map[string][]threadAffinity, len(pids))
+	restore := func() {
+		for _, pid := range pids {
+			threads, ok := saved[pid]
+			if !ok {
+				continue
+			}
+			if _, stderr, err := exec(tasksetRestoreCommand(pid, threads)); err != nil {
+				a.logger.Warn().Err(err).Str("pid", pid).Str("stderr", strings.TrimSpace(stderr)).Msg("Failed to restore CPU affinity")
+			}
+		}
+		a.logger.Debug().Strs("pids", pids).Msg("Restored CPU affinity of processes")
+	}
+
+	for _, pid := range pids {
+		stdout, stderr, err := exec(tasksetSaveCommand(pid))
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to read CPU affinity of PID %s: %w (stderr: %s)", pid, err, strings.TrimSpace(stderr))
+		}
+		threads, err := parseThreadAffinities(pid, stdout)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to read CPU affinity of PID %s: %w", pid, err)
+		}
+
+		saved[pid] = threads
+		if _, stderr, err := exec(tasksetPIDCommand(cpuList, pid)); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set CPU affinity of PID %s: %w (stderr: %s)", pid, err, strings.TrimSpace(stderr))
+		}
+	}
+
+	a.logger.Info().
+		Strs("pids", pids).
+		Str("cpu_affinity", cpuList).
+		Msg("Pinned processes to CPUs, restoring their affinity when the run ends")
+	return restore, nil
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCPUList(t *testing.T) {
+	for _, list := range []string{"0", "0-3", "0-3,8", "1,3,5-7"} {
+		assert.NoError(t, validateCPUList(list), list)
+	}
+	for _, list := range []string{"", "a", "0-", "0,,1", "0-3;rm -rf /"} {
+		assert.Error(t, validateCPUList(list), list)
+	}
+}
+
+func TestResolveCPUAffinity(t *testing.T) {
+	a := &App{logger: zerolog.Nop()}
+	assert.Equal(t, "0-3", a.resolveCPUAffinity("linux", "0-3"))
+	assert.Equal(t, "", a.resolveCPUAffinity("darwin", "0-3"))
+	assert.Equal(t, "", a.resolveCPUAffinity("linux", ""))
+}
+
+func TestGOMAXPROCSEnv(t *testing.T) {
+	env, err := gomaxprocsEnv([]string{"FOO=bar"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FOO=bar"}, env)
+
+	env, err = gomaxprocsEnv([]string{"FOO=bar"}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FOO=bar", "GOMAXPROCS=4"}, env)
+
+	_, err = gomaxprocsEnv([]string{"GOMAXPROCS=2"}, 4)
+	assert.Error(t, err)
+
+	_, err = gomaxprocsEnv(nil, -1)
+	assert.Error(t, err)
+}
+
+func TestLocalTestCommand(t *testing.T) {
+	a := &App{runState: runState{testEnv: []string{"GOMAXPROCS=2"}}}
+	cmd := a.localTestCommand("perf", "stat", "--", "./perfgo.test")
+	assert.Equal(t, "perf stat -- ./perfgo.test", cmd.String())
+	assert.Contains(t, cmd.Env, "GOMAXPROCS=2")
+
+	a.testCPUAffinity = "0-3"
+	cmd = a.localTestCommand("perf", "stat", "--", "./perfgo.test")
+	assert.Equal(t, "taskset -c 0-3 perf stat -- ./perfgo.test", cmd.String())
+}
+
+func TestRemoteTestCommand_Affinity(t *testing.T) {
+	a := &App{runState: runState{testEnv: []string{"GOMAXPROCS=4"}, testCPUAffinity: "0,2"}}
+	assert.Equal(t,
+		"cd /work && GOMAXPROCS=4 taskset -c 0,2 perf stat -- ./perfgo.test",
+		a.remoteTestCommand("/work", "perf stat -- ./perfgo.test"),
+	)
+}
+
+func TestTasksetPIDCommand(t *testing.T) {
+	assert.Equal(t, "taskset -a -c -p 0-3 1234", tasksetPIDCommand("0-3", "1234"))
+}
+
+func TestPinPIDs_RestoresAffinity(t *testing.T) {
+	var commands []string
+	exec := func(cmd string) (string, string, error) {
+		commands = append(commands, cmd)
+		if strings.HasPrefix(cmd, "for t in /proc/1234/task/*") {
+			return "1234 ff\n1240 3\n", "", nil
+		}
+		return "", "", nil
+	}
+	a := &App{logger: zerolog.Nop()}
+
+	restore, err := a.pinPIDs(exec, "0-3", []string{"1234"})
+	require.NoError(t, err)
+	assert.Equal(t, "taskset -a -c -p 0-3 1234", commands[len(commands)-1])
+
+	commands = nil
+	restore()
+	assert.Equal(t, []string{
+		"taskset -a -p ff 1234 >/dev/null && { taskset -p 3 1240 >/dev/null 2>&1; true; }",
+	}, commands)
+}
+
+func TestPinPIDs_RestoresOnFailure(t *testing.T) {
+	var commands []string
+	exec := func(cmd string) (string, string, error) {
+		commands = append(commands, cmd)
+		switch {
+		case strings.HasPrefix(cmd, "for t in /proc/1234/task/*"):
+			return "1234 f\n", "", nil
+		case strings.HasPrefix(cmd, "for t in /proc/1300/task/*"):
+			return "1300 f\n", "", nil
+		case cmd == "taskset -a -c -p 2 1300":
+			return "", "operation not permitted", errors.New("exit status 1")
+		}
+		return "", "", nil
+	}
+	a := &App{logger: zerolog.Nop()}
+
+	_, err := a.pinPIDs(exec, "2", []string{"1234", "1300"})
+	require.ErrorContains(t, err, "failed to set CPU affinity of PID 1300")
+
+	// Both processes may have been pinned partially
+	assert.Equal(t, []string{
+		"taskset -a -p f 1234 >/dev/null",
+		"taskset -a -p f 1300 >/dev/null",
+	}, commands[len(commands)-2:])
+}
+
+func TestParseThreadAffinities(t *testing.T) {
+	threads, err := parseThreadAffinities("10", "10 ff\n11 0f,ffffffff\n")
+	require.NoError(t, err)
+	assert.Equal(t, []threadAffinity{{tid: "10", mask: "ff"}, {tid: "11", mask: "0f,ffffffff"}}, threads)
+
+	_, err = parseThreadAffinities("10", "10 ff; rm -rf /\n")
+	assert.ErrorContains(t, err, "unexpected taskset output")
+
+	_, err = parseThreadAffinities("10", "11 ff\n")
+	assert.ErrorContains(t, err, "no affinity of the main thread")
+}
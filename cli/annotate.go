@@ -0,0 +1,94 @@
+package cli
+
+// This file contains the annotate command for printing the annotated source
+// of functions in a profile from history.
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// parseAnnotateArgs splits the annotate arguments into the history entry
+// reference and the function regexp. The entry defaults to the last run.
+func parseAnnotateArgs(in []string) (idArg, funcRegexp string, err error) {
+	switch len(in) {
+	case 1:
+		idArg, funcRegexp = "0", in[0]
+	case 2:
+		idArg, funcRegexp = in[0], in[1]
+	default:
+		return "", "", fmt.Errorf("expected [ID|INDEX] <func-regexp>, got %d arguments", len(in))
+	}
+
+	if _, err := regexp.Compile(funcRegexp); err != nil {
+		return "", "", fmt.Errorf("invalid function regexp %q: %w", funcRegexp, err)
+	}
+
+	return idArg, funcRegexp, nil
+}
+
+// annotationInputs returns the entry's profile artifact, after verifying
+// that the binaries needed to resolve its symbols were archived.
+func annotationInputs(entry *history.Entry) (*model.Artifact, error) {
+	var profileArtifact *model.Artifact
+	var binaries int
+	for i, artifact := range entry.History.Artifacts {
+		switch artifact.Type {
+		case model.ArtifactTypePprofProfile:
+			profileArtifact = &entry.History.Artifacts[i]
+		case model.ArtifactTypeTestBinary, model.ArtifactTypeAttachBinary, model.ArtifactTypeSymbols:
+			if _, err := os.Stat(resolveArtifactPath(entry.FullPath, artifact)); err == nil {
+				binaries++
+			}
+		}
+	}
+
+	shortID := entry.History.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+
+	if profileArtifact == nil {
+		return nil, fmt.Errorf("history entry %s has no profile, annotate requires a run of 'perfgo test profile' or 'perfgo attach profile'", shortID)
+	}
+	if binaries == 0 {
+		return nil, fmt.Errorf("history entry %s has no archived binary in %s, symbols and source lines can't be resolved without it", shortID, entry.FullPath)
+	}
+
+	return profileArtifact, nil
+}
+
+func (a *App) annotate(ctx *cli.Context) error {
+	idArg, funcRegexp, err := parseAnnotateArgs(ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	entry, err := a.resolveEntry(idArg)
+	if err != nil {
+		return err
+	}
+
+	profileArtifact, err := annotationInputs(entry)
+	if err != nil {
+		return err
+	}
+
+	profilePath, cleanup, err := a.pprofProfile(entry, profileArtifact)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	a.logger.Debug().
+		Str("profile", profilePath).
+		Str("regexp", funcRegexp).
+		Msg("Annotating source")
+
+	return pprofCommand(entry.FullPath, "-list", funcRegexp, profilePath).Run()
+}
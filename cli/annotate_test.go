@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnnotateArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         []string
+		wantID     string
+		wantRegexp string
+		wantErr    string
+	}{
+		{
+			name:       "regexp only - default to last run",
+			in:         []string{`main\.work`},
+			wantID:     "0",
+			wantRegexp: `main\.work`,
+		},
+		{
+			name:       "negative index and regexp",
+			in:         []string{"-1", "Benchmark.*"},
+			wantID:     "-1",
+			wantRegexp: "Benchmark.*",
+		},
+		{
+			name:       "hex ID and regexp",
+			in:         []string{"abc123", "pkg.Func"},
+			wantID:     "abc123",
+			wantRegexp: "pkg.Func",
+		},
+		{
+			name:    "no arguments",
+			in:      []string{},
+			wantErr: "expected [ID|INDEX] <func-regexp>, got 0 arguments",
+		},
+		{
+			name:    "too many arguments",
+			in:      []string{"0", "a", "b"},
+			wantErr: "expected [ID|INDEX] <func-regexp>, got 3 arguments",
+		},
+		{
+			name:    "invalid regexp",
+			in:      []string{"0", "main.(work"},
+			wantErr: `invalid function regexp "main.(work"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, re, err := parseAnnotateArgs(tt.in)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, id)
+			assert.Equal(t, tt.wantRegexp, re)
+		})
+	}
+}
+
+func TestAnnotationInputs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "perf.pb.gz"), []byte("profile"), 0o644))
+
+	entry := &history.Entry{
+		FullPath: dir,
+		History: model.History{
+			ID: "0123456789abcdef",
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypePprofProfile, File: "perf.pb.gz"},
+				{Type: model.ArtifactTypeTestBinary, File: "abc.perfgo.test.binary"},
+			},
+		},
+	}
+
+	// The binary artifact is recorded, but missing on disk
+	_, err := annotationInputs(entry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "history entry 01234567 has no archived binary")
+	assert.Contains(t, err.Error(), "symbols and source lines can't be resolved")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc.perfgo.test.binary"), []byte("binary"), 0o755))
+	profileArtifact, err := annotationInputs(entry)
+	require.NoError(t, err)
+	assert.Equal(t, "perf.pb.gz", profileArtifact.File)
+
+	// Runs without a profile can't be annotated
+	entry.History.Artifacts = entry.History.Artifacts[1:]
+	_, err = annotationInputs(entry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no profile")
+}
@@ -4,6 +4,7 @@ package cli
 // test binaries and performance profiles to the history directory.
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
@@ -12,10 +13,78 @@ import (
 	"strings"
 
 	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/perf"
 	"github.com/perfgo/perfgo/model"
 )
 
-func (a *App) rewriteProfilePaths(profileFile, runDir, destBinary, originalBasename string) error {
+// archivedBinaries maps the original basename of every archived binary to
+// its path in runDir.
+func archivedBinaries(runDir string, artifacts []model.Artifact) map[string]string {
+	binaries := make(map[string]string)
+	for _, artifact := range artifacts {
+		if artifact.Type != model.ArtifactTypeTestBinary && artifact.Type != model.ArtifactTypeAttachBinary {
+			continue
+		}
+
+		basename, ok := originalBasename(artifact.File)
+		if !ok {
+			continue
+		}
+		if _, exists := binaries[basename]; exists {
+			continue
+		}
+		binaries[basename] = resolveArtifactPath(runDir, artifact)
+	}
+	return binaries
+}
+
+// archivedBuildIDs maps the GNU build-id of every archived binary that has
+// one to its path in runDir.
+func archivedBuildIDs(runDir string, artifacts []model.Artifact) map[string]string {
+	buildIDs := make(map[string]string)
+	for _, artifact := range artifacts {
+		if artifact.Type != model.ArtifactTypeTestBinary && artifact.Type != model.ArtifactTypeAttachBinary {
+			continue
+		}
+		if artifact.BuildID == "" {
+			continue
+		}
+		if _, exists := buildIDs[artifact.BuildID]; exists {
+			continue
+		}
+		buildIDs[artifact.BuildID] = resolveArtifactPath(runDir, artifact)
+	}
+	return buildIDs
+}
+
+// originalBasename extracts the original basename from an archived binary
+// filename: <hash>.<basename>.binary[.gz] -> <basename>.
+func originalBasename(file string) (string, bool) {
+	trimmed, ok := strings.CutSuffix(strings.TrimSuffix(file, ".gz"), ".binary")
+	if !ok {
+		return "", false
+	}
+	_, basename, ok := strings.Cut(trimmed, ".")
+	if !ok || basename == "" {
+		return "", false
+	}
+	return basename, true
+}
+
+// mappingBinaryName returns the original basename of the binary a mapping
+// refers to, which is either the binary itself or its archived copy.
+func mappingBinaryName(file string) string {
+	basename := filepath.Base(file)
+	if name, ok := originalBasename(basename); ok {
+		return name
+	}
+	return basename
+}
+
+// rewriteProfilePaths points the profile's mappings to the binaries, given by
+// their GNU build-id or else by their original basename, and writes the
+// result to destProfile.
+func (a *App) rewriteProfilePaths(profileFile, destProfile string, binaries, byBuildID map[string]string) error {
 	// Read the profile
 	f, err := os.Open(profileFile)
 	if err != nil {
@@ -28,7 +97,7 @@ func (a *App) rewriteProfilePaths(profileFile, runDir, destBinary, originalBasen
 		return fmt.Errorf("failed to parse profile: %w", err)
 	}
 
-	// Update all mappings to point to archived binary
+	// Update all mappings to point to archived binaries
 	// Match based on the original basename (without hash prefix and .binary suffix)
 	for _, mapping := range prof.Mapping {
 		// Skip kernel mappings
@@ -36,21 +105,24 @@ func (a *App) rewriteProfilePaths(profileFile, runDir, destBinary, originalBasen
 			continue
 		}
 
-		// Check if this mapping is for the test binary by comparing original basename
-		mappingBasename := filepath.Base(mapping.File)
-		if mappingBasename == originalBasename {
-			oldPath := mapping.File
-			// Update to use archived path
-			mapping.File = destBinary
-			a.logger.Debug().
-				Str("old", oldPath).
-				Str("new", destBinary).
-				Msg("Updated mapping path")
+		destBinary, ok := byBuildID[mapping.BuildID]
+		if !ok || mapping.BuildID == "" {
+			destBinary, ok = binaries[mappingBinaryName(mapping.File)]
 		}
+		if !ok || mapping.File == destBinary {
+			continue
+		}
+
+		oldPath := mapping.File
+		// Update to use archived path
+		mapping.File = destBinary
+		a.logger.Debug().
+			Str("old", oldPath).
+			Str("new", destBinary).
+			Msg("Updated mapping path")
 	}
 
 	// Write updated profile
-	destProfile := filepath.Join(runDir, "perf.pb.gz")
 	outFile, err := os.Create(destProfile)
 	if err != nil {
 		return fmt.Errorf("failed to create output profile: %w", err)
@@ -65,8 +137,13 @@ func (a *App) rewriteProfilePaths(profileFile, runDir, destBinary, originalBasen
 }
 
 func (a *App) saveArtifacts(runDir string, history *model.History, testBinaryPath string) error {
+	if err := a.saveSymbolFiles(runDir, history); err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to save symbol files")
+	}
+
 	// Save the test binary if provided
 	if testBinaryPath != "" {
+		testBinaryPath = cleanBinaryPath(testBinaryPath)
 		if _, err := os.Stat(testBinaryPath); err == nil {
 			// Read and hash the test binary
 			data, err := os.ReadFile(testBinaryPath)
@@ -87,9 +164,10 @@ func (a *App) saveArtifacts(runDir string, history *model.History, testBinaryPat
 					a.logger.Warn().Err(err).Str("file", testBinaryPath).Msg("Failed to write test binary")
 				} else {
 					history.Artifacts = append(history.Artifacts, model.Artifact{
-						Type: model.ArtifactTypeTestBinary,
-						Size: uint64(len(data)),
-						File: binaryFilename,
+						Type:    model.ArtifactTypeTestBinary,
+						Size:    uint64(len(data)),
+						File:    binaryFilename,
+						BuildID: elfBuildID(testBinaryPath),
 					})
 					a.logger.Debug().
 						Str("hash", hash).
@@ -100,28 +178,15 @@ func (a *App) saveArtifacts(runDir string, history *model.History, testBinaryPat
 		}
 	}
 
+	// Keep a single copy of identical binaries across history entries
+	a.internBinaries(runDir, history)
+
 	// Register perf.pb.gz profile if it exists (written directly to runDir)
 	profileFile := filepath.Join(runDir, "perf.pb.gz")
 	if info, err := os.Stat(profileFile); err == nil {
-		// Find the test binary to rewrite paths
-		var destBinary string
-		var originalBasename string
-		for _, artifact := range history.Artifacts {
-			if artifact.Type == model.ArtifactTypeTestBinary {
-				destBinary = filepath.Join(runDir, artifact.File)
-				// Extract original basename from hash-based name: hash.basename.binary -> basename
-				parts := strings.SplitN(artifact.File, ".", 3)
-				if len(parts) >= 3 && strings.HasSuffix(artifact.File, ".binary") {
-					// Remove the .binary suffix to get the original basename
-					originalBasename = strings.TrimSuffix(parts[1]+"."+parts[2], ".binary")
-				}
-				break
-			}
-		}
-
-		if destBinary != "" && originalBasename != "" {
-			// Rewrite profile paths to point to saved binary
-			if err := a.rewriteProfilePaths(profileFile, runDir, destBinary, originalBasename); err != nil {
+		// Rewrite profile paths to point to all saved binaries
+		if binaries := archivedBinaries(runDir, history.Artifacts); len(binaries) > 0 {
+			if err := a.rewriteProfilePaths(profileFile, profileFile, binaries, archivedBuildIDs(runDir, history.Artifacts)); err != nil {
 				a.logger.Warn().Err(err).Msg("Failed to rewrite profile paths, using original")
 			}
 		}
@@ -132,7 +197,81 @@ func (a *App) saveArtifacts(runDir string, history *model.History, testBinaryPat
 			File: "perf.pb.gz",
 		})
 		a.logger.Debug().Str("profile", profileFile).Msg("Registered pprof profile artifact")
+
+		for _, format := range a.profileOutputs() {
+			if err := a.saveProfileOutput(runDir, profileFile, format, history); err != nil {
+				a.logger.Warn().Err(err).Str("format", string(format)).Msg("Failed to write profile output")
+			}
+		}
+	}
+
+	// The profiles of the --repeat runs point to the saved binaries as well
+	binaries := archivedBinaries(runDir, history.Artifacts)
+	for i := range history.Artifacts {
+		artifact := &history.Artifacts[i]
+		if artifact.Type != model.ArtifactTypePprofProfileRun || len(binaries) == 0 {
+			continue
+		}
+		runProfile := filepath.Join(runDir, artifact.File)
+		if err := a.rewriteProfilePaths(runProfile, runProfile, binaries, archivedBuildIDs(runDir, history.Artifacts)); err != nil {
+			a.logger.Warn().Err(err).Str("profile", artifact.File).Msg("Failed to rewrite profile paths, using original")
+			continue
+		}
+		if info, err := os.Stat(runProfile); err == nil {
+			artifact.Size = uint64(info.Size())
+		}
+	}
+
+	return nil
+}
+
+// profileOutputs returns the formats the profile is written in besides
+// pprof, selected by --folded and --output.
+func (a *App) profileOutputs() []perf.OutputFormat {
+	var formats []perf.OutputFormat
+	if a.foldedStacks || a.profileOutput == perf.OutputFolded {
+		formats = append(formats, perf.OutputFolded)
+	}
+	if a.profileOutput == perf.OutputText || a.profileOutput == perf.OutputJSON {
+		formats = append(formats, a.profileOutput)
+	}
+	return formats
+}
+
+// profileOutputArtifacts are the artifact types of the profile outputs.
+var profileOutputArtifacts = map[perf.OutputFormat]model.ArtifactType{
+	perf.OutputText:   model.ArtifactTypeProfileText,
+	perf.OutputFolded: model.ArtifactTypeFoldedStacks,
+	perf.OutputJSON:   model.ArtifactTypeProfileJSON,
+}
+
+// saveProfileOutput writes the profile at profileFile in format into runDir
+// and registers it as artifact.
+func (a *App) saveProfileOutput(runDir, profileFile string, format perf.OutputFormat, history *model.History) error {
+	f, err := os.Open(profileFile)
+	if err != nil {
+		return fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer f.Close()
+
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := perf.WriteOutput(&out, prof, format); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(runDir, format.File()), out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s profile: %w", format, err)
 	}
 
+	history.Artifacts = append(history.Artifacts, model.Artifact{
+		Type: profileOutputArtifacts[format],
+		Size: uint64(out.Len()),
+		File: format.File(),
+	})
+	a.logger.Debug().Str("file", format.File()).Msg("Registered profile output artifact")
 	return nil
 }
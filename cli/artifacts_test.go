@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginalBasename(t *testing.T) {
+	tests := []struct {
+		file   string
+		want   string
+		wantOK bool
+	}{
+		{file: "abc123.perfgo.test.binary", want: "perfgo.test", wantOK: true},
+		{file: "abc123.libfoo.so.1.binary", want: "libfoo.so.1", wantOK: true},
+		{file: "abc123.app.binary", want: "app", wantOK: true},
+		{file: "perf.pb.gz", wantOK: false},
+		{file: "abc123.binary", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, ok := originalBasename(tt.file)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSaveArtifacts_RewritesAllBinaryMappings(t *testing.T) {
+	runDir := t.TempDir()
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping: []*profile.Mapping{
+			{ID: 1, File: "/tmp/go-build123/perfgo.test"},
+			{ID: 2, File: "/usr/lib/x86_64-linux-gnu/libplugin.so"},
+			{ID: 3, File: "[kernel.kallsyms]"},
+			{ID: 4, File: "/usr/lib/libc.so.6"},
+		},
+	}
+	f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	h := &model.History{
+		Artifacts: []model.Artifact{
+			{Type: model.ArtifactTypeTestBinary, File: "aaaa.perfgo.test.binary"},
+			{Type: model.ArtifactTypeAttachBinary, File: "bbbb.libplugin.so.binary"},
+		},
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	require.NoError(t, a.saveArtifacts(runDir, h, ""))
+
+	f, err = os.Open(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	rewritten, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	files := make([]string, 0, len(rewritten.Mapping))
+	for _, m := range rewritten.Mapping {
+		files = append(files, m.File)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(runDir, "aaaa.perfgo.test.binary"),
+		filepath.Join(runDir, "bbbb.libplugin.so.binary"),
+		"[kernel.kallsyms]",
+		"/usr/lib/libc.so.6",
+	}, files)
+
+	require.Len(t, h.Artifacts, 3)
+	assert.Equal(t, model.ArtifactTypePprofProfile, h.Artifacts[2].Type)
+}
+
+func TestSaveArtifacts_MatchesBuildIDFirst(t *testing.T) {
+	runDir := t.TempDir()
+
+	// Two binaries named app, told apart by their build-id
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping: []*profile.Mapping{
+			{ID: 1, File: "/srv/a/app", BuildID: "a1a1"},
+			{ID: 2, File: "/srv/b/app", BuildID: "b2b2"},
+			{ID: 3, File: "/srv/c/app", BuildID: "c3c3"},
+		},
+	}
+	f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	h := &model.History{
+		Artifacts: []model.Artifact{
+			{Type: model.ArtifactTypeAttachBinary, File: "aaaa.app.binary", BuildID: "a1a1"},
+			{Type: model.ArtifactTypeAttachBinary, File: "bbbb.app.binary", BuildID: "b2b2"},
+		},
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	require.NoError(t, a.saveArtifacts(runDir, h, ""))
+
+	f, err = os.Open(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	rewritten, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	files := make([]string, 0, len(rewritten.Mapping))
+	for _, m := range rewritten.Mapping {
+		files = append(files, m.File)
+	}
+	// Unknown build-ids fall back to the first binary of the same name
+	assert.Equal(t, []string{
+		filepath.Join(runDir, "aaaa.app.binary"),
+		filepath.Join(runDir, "bbbb.app.binary"),
+		filepath.Join(runDir, "aaaa.app.binary"),
+	}, files)
+}
+
+func TestSaveArtifacts_FoldedStacks(t *testing.T) {
+	runDir := t.TempDir()
+
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{4}}},
+	}
+	f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	h := &model.History{}
+	a := &App{logger: zerolog.Nop(), runState: runState{foldedStacks: true}}
+	require.NoError(t, a.saveArtifacts(runDir, h, ""))
+
+	folded, err := os.ReadFile(filepath.Join(runDir, "perf.folded"))
+	require.NoError(t, err)
+	assert.Equal(t, "main.work 4\n", string(folded))
+
+	require.Len(t, h.Artifacts, 2)
+	assert.Equal(t, model.Artifact{Type: model.ArtifactTypeFoldedStacks, Size: uint64(len(folded)), File: "perf.folded"}, h.Artifacts[1])
+}
+
+func TestSaveArtifacts_ProfileOutput(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{4}}},
+	}
+
+	tests := []struct {
+		name          string
+		app           App
+		wantArtifacts []model.Artifact
+	}{
+		{name: "pprof only", app: App{runState: runState{profileOutput: perf.OutputPprof}}},
+		{
+			name:          "text",
+			app:           App{runState: runState{profileOutput: perf.OutputText}},
+			wantArtifacts: []model.Artifact{{Type: model.ArtifactTypeProfileText, File: "perf.txt"}},
+		},
+		{
+			name:          "json",
+			app:           App{runState: runState{profileOutput: perf.OutputJSON}},
+			wantArtifacts: []model.Artifact{{Type: model.ArtifactTypeProfileJSON, File: "perf.json"}},
+		},
+		{
+			name:          "folded by --output and --folded",
+			app:           App{runState: runState{profileOutput: perf.OutputFolded, foldedStacks: true}},
+			wantArtifacts: []model.Artifact{{Type: model.ArtifactTypeFoldedStacks, File: "perf.folded"}},
+		},
+		{
+			name: "json and --folded",
+			app:  App{runState: runState{profileOutput: perf.OutputJSON, foldedStacks: true}},
+			wantArtifacts: []model.Artifact{
+				{Type: model.ArtifactTypeFoldedStacks, File: "perf.folded"},
+				{Type: model.ArtifactTypeProfileJSON, File: "perf.json"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runDir := t.TempDir()
+			f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+			require.NoError(t, err)
+			require.NoError(t, prof.Write(f))
+			require.NoError(t, f.Close())
+
+			h := &model.History{}
+			a := tt.app
+			a.logger = zerolog.Nop()
+			require.NoError(t, a.saveArtifacts(runDir, h, ""))
+
+			require.Len(t, h.Artifacts, 1+len(tt.wantArtifacts))
+			assert.Equal(t, model.ArtifactTypePprofProfile, h.Artifacts[0].Type)
+			for i, want := range tt.wantArtifacts {
+				got := h.Artifacts[1+i]
+				assert.Equal(t, want.Type, got.Type)
+				assert.Equal(t, want.File, got.File)
+				info, err := os.Stat(filepath.Join(runDir, got.File))
+				require.NoError(t, err)
+				assert.Equal(t, uint64(info.Size()), got.Size)
+			}
+		})
+	}
+}
+
+func TestSaveArtifacts_BinaryPathSpelling(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("perfgo.test", []byte("test binary"), 0o755))
+
+	var files []string
+	for _, path := range []string{"./perfgo.test", "perfgo.test", filepath.Join(dir, "perfgo.test"), "sub/../perfgo.test"} {
+		h := &model.History{}
+		a := &App{logger: zerolog.Nop()}
+		require.NoError(t, a.saveArtifacts(t.TempDir(), h, path))
+		require.Len(t, h.Artifacts, 1, path)
+		files = append(files, h.Artifacts[0].File)
+	}
+
+	for _, file := range files {
+		assert.Equal(t, files[0], file)
+		basename, ok := originalBasename(file)
+		assert.True(t, ok)
+		assert.Equal(t, "perfgo.test", basename)
+	}
+}
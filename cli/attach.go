@@ -1,20 +1,23 @@
 package cli
 
 // This file contains the attach command for running performance profiling
-// on Kubernetes pods or nodes.
+// on Kubernetes pods or nodes, or processes on an SSH host (attachhost.go).
 
 import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
-	"al.essio.dev/pkg/shellescape"
 	"github.com/perfgo/perfgo/cli/k8s"
 	"github.com/perfgo/perfgo/cli/perf"
 	"github.com/perfgo/perfgo/cli/ssh"
@@ -22,6 +25,10 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// perfPodReadyTimeout bounds how long the perf pod may take to become ready,
+// e.g. while its image is pulled, within the overall attach timeout.
+const perfPodReadyTimeout = 3 * time.Minute
+
 func (a *App) attachStat(ctx *cli.Context) error {
 	return a.runAttach(ctx, "stat")
 }
@@ -34,13 +41,21 @@ func (a *App) attachC2C(ctx *cli.Context) error {
 	return a.runAttach(ctx, "c2c")
 }
 
+func (a *App) attachMem(ctx *cli.Context) error {
+	return a.runAttach(ctx, "mem")
+}
+
 func (a *App) attachShell(ctx *cli.Context) error {
 	return a.runAttach(ctx, "shell")
 }
 
-func (a *App) runAttach(ctx *cli.Context, mode string) error {
+func (a *App) runAttach(ctx *cli.Context, mode string) (retErr error) {
 	startTime := time.Now()
 
+	if err := validateFlags(ctx); err != nil {
+		return err
+	}
+
 	// Generate unique run ID
 	idBytes := make([]byte, 16)
 	if _, err := rand.Read(idBytes); err != nil {
@@ -50,56 +65,60 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 
 	// Get flags
 	kubeContext := ctx.String("context")
+	kubeconfig := ctx.String("kubeconfig")
 	podName := ctx.String("pod")
 	nodeName := ctx.String("node")
+	selector := ctx.String("selector")
+	remoteHost := ctx.String("remote-host")
 	namespace := ctx.String("namespace")
 	perfImage := ctx.String("perf-image")
-	duration := ctx.Int("duration")
+	sshdPath := ctx.String("sshd-path")
+	cpuAffinity := ctx.String("cpu-affinity")
 
-	var perfEvent string
-	var perfCount int
-	var perfEvents []string
-	var perfDetail bool
-	var c2cEvent string
-	var c2cCount int
-	var c2cReportMode string
-	var c2cShowAll bool
-	if mode == "profile" {
-		perfEvent = ctx.String("event")
-		perfCount = ctx.Int("count")
-	} else if mode == "stat" {
-		perfEvents = ctx.StringSlice("event")
-		perfEvent = strings.Join(perfEvents, ",")
-		perfDetail = ctx.Bool("detail")
-	} else if mode == "c2c" {
-		// Use default values for c2c
-		c2cReportMode = "stdio"
-		c2cShowAll = false
+	perfOpts, err := a.parseAttachOptions(ctx, mode)
+	if err != nil {
+		return err
 	}
 
-	// Prepare history recording
-	history := &model.History{
-		ID:        runID,
-		Type:      model.HistoryTypeAttach,
-		Timestamp: startTime,
-		Args:      os.Args,
-		Attach: &model.AttachRun{
-			KubeContext: kubeContext,
-			Namespace:   namespace,
-		},
+	// One of --pod, --node, --selector or --remote-host is required,
+	// validateFlags rejects combining them. A remote-host from .perfgo.yaml
+	// doesn't apply when attaching to Kubernetes.
+	if podName != "" || nodeName != "" || selector != "" {
+		remoteHost = ""
+	} else if remoteHost == "" {
+		return fmt.Errorf("either --pod, --node, --selector or --remote-host must be specified")
+	} else if mode != "shell" && !ctx.IsSet("pid") && ctx.String("process") == "" {
+		return fmt.Errorf("--remote-host requires --pid or --process to select the processes to attach to")
 	}
 
+	if cpuAffinity != "" {
+		if err := validateCPUList(cpuAffinity); err != nil {
+			return err
+		}
+	}
+
+	// Set default namespace if targeting a pod, running in a pod without a
+	// kubeconfig it's the namespace of that pod like kubectl's default
+	if (podName != "" || selector != "") && namespace == "" {
+		namespace = "default"
+		if kubeconfig == "" {
+			if ns := k8s.InClusterNamespace(); ns != "" {
+				namespace = ns
+			}
+		}
+	}
+
+	// Prepare history recording
+	history := newAttachHistory(runID, startTime, kubeContext, namespace)
+
 	// Capture working directory
 	if cwd, err := os.Getwd(); err == nil {
 		history.WorkDir = cwd
 	}
 
 	// Capture git info (non-fatal if it fails)
-	if commit, branch, err := a.getGitInfo(); err == nil {
-		history.Git = &model.Git{
-			Commit: commit,
-			Branch: branch,
-		}
+	if info, err := a.getGitInfo(); err == nil {
+		history.Git = info
 	}
 
 	// Create history directory early so artifacts can be written directly to it
@@ -114,6 +133,11 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 	// Track final exit code
 	var finalErr error
 	defer func() {
+		// Errors returned directly also fail the run
+		if finalErr == nil {
+			finalErr = retErr
+		}
+
 		history.Duration = time.Since(startTime)
 		if finalErr != nil {
 			if exitErr, ok := finalErr.(*exec.ExitError); ok {
@@ -131,21 +155,15 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		}
 	}()
 
-	// Validate that exactly one of --pod or --node is specified
-	if podName == "" && nodeName == "" {
-		return fmt.Errorf("either --pod or --node must be specified")
-	}
-	if podName != "" && nodeName != "" {
-		return fmt.Errorf("--pod and --node are mutually exclusive, specify only one")
-	}
-
-	// Set default namespace if targeting a pod
-	if podName != "" && namespace == "" {
-		namespace = "default"
+	if remoteHost != "" {
+		return a.attachHost(ctx, mode, remoteHost, perfOpts, runDir, history, &stdoutContent, &stderrContent)
 	}
 
 	// Create Kubernetes client
-	k8sClient := k8s.New(kubeContext, namespace)
+	k8sClient := k8s.New(kubeContext, namespace, k8s.WithKubeconfig(kubeconfig))
+	if kubeconfig == "" && k8s.InCluster() {
+		a.logger.Debug().Msg("Running in a cluster, kubectl uses the service account credentials unless a kubeconfig is found")
+	}
 
 	// Create context with timeout
 	execCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
@@ -164,6 +182,25 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		}
 	}()
 
+	// Resolve the pod to attach to from the label selector
+	if selector != "" {
+		a.logger.Info().
+			Str("selector", selector).
+			Str("namespace", namespace).
+			Msg("Finding pod by label selector")
+
+		pods, err := k8sClient.GetPodsBySelector(execCtx, selector)
+		if err != nil {
+			return err
+		}
+		pod, err := selectPod(pods, selector, ctx.Bool("first"))
+		if err != nil {
+			return err
+		}
+		podName = pod.Metadata.Name
+		history.Attach.Selector = selector
+	}
+
 	// Generate random suffix for pod name
 	suffixBytes := make([]byte, 4)
 	if _, err := rand.Read(suffixBytes); err != nil {
@@ -199,8 +236,8 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 			Str("phase", pod.Status.Phase).
 			Msg("Found pod")
 
-		// Extract container IDs
-		containerIDs = k8s.GetContainerIDs(pod)
+		// Extract the IDs of the running containers
+		containerIDs = a.podContainerIDs(pod, ctx.Bool("include-init"))
 		if len(containerIDs) > 0 {
 			a.logger.Info().
 				Interface("container_ids", containerIDs).
@@ -284,7 +321,7 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		Str("perf_pod", perfPodName).
 		Msg("Waiting for perf pod to be ready")
 
-	if err := k8sClient.WaitForPodReady(execCtx, perfPodName); err != nil {
+	if err := k8sClient.WaitForPodReady(execCtx, perfPodName, perfPodReadyTimeout); err != nil {
 		return fmt.Errorf("failed to wait for perf pod to be ready: %w", err)
 	}
 
@@ -292,6 +329,11 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		Str("perf_pod", perfPodName).
 		Msg("Perf pod is ready")
 
+	// Verify the image provides perf and sshd before relying on them
+	if err := a.verifyPerfImage(execCtx, k8sClient, perfPodName, perfImage, sshdPath); err != nil {
+		return err
+	}
+
 	// Set up SSH keys in the pod
 	privateKeyPath, hostKeyPath, err := a.setupSSHKeys(execCtx, k8sClient, perfPodName, namespace, tempDir)
 	if err != nil {
@@ -302,11 +344,7 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 	a.logger.Info().Msg("Creating SSH client to perf pod")
 
 	// Build kubectl proxy command with optional context
-	contextArg := ""
-	if kubeContext != "" {
-		contextArg = fmt.Sprintf("--context %s ", kubeContext)
-	}
-	proxyCmd := fmt.Sprintf("kubectl %sexec -i -n %s %s -- bash -c '/usr/sbin/sshd -i 2> /dev/null'", contextArg, namespace, perfPodName)
+	proxyCmd := sshdProxyCommand(k8sClient.GlobalArgs(), namespace, perfPodName, sshdPath)
 	sshHost := fmt.Sprintf("root@%s", perfPodName)
 
 	sshClient, err := ssh.New(a.logger, sshHost,
@@ -314,12 +352,39 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		ssh.WithKnownHostsFile(hostKeyPath),
 		ssh.WithProxyCommand(proxyCmd),
 		ssh.WithExtraOptions("IdentitiesOnly=yes"),
+		// The perf pod is deleted afterwards, so its connection isn't kept
+		ssh.WithControlPersist(0),
+		ssh.WithCommandTimeout(ctx.Duration("command-timeout")),
+		ssh.WithProgress(os.Stderr),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create SSH client: %w", err)
 	}
 	defer sshClient.Close()
 
+	// Check explicitly requested events before attaching perf
+	if err := a.checkPerfEvents(sshHost, remoteEventLister(sshClient), requestedEvents(perfOpts.event)); err != nil {
+		return err
+	}
+
+	// Detect the system of the node (non-fatal, only used to pick defaults)
+	if nodeOS, nodeArch, err := sshClient.DetectSystem(); err == nil {
+		history.Target = &model.Target{
+			RemoteHost: nodeName,
+			OS:         nodeOS,
+			Arch:       nodeArch,
+			Vendor:     sshClient.DetectCPUVendor(nodeOS, nodeArch),
+		}
+		history.Target.KernelRelease, history.Target.PerfVersion = detectVersions(remoteShellExec(sshClient))
+	} else {
+		a.logger.Warn().Err(err).Msg("Failed to detect node system")
+	}
+
+	// The perf run is cancelled on interrupt, so the perf pod and control master
+	// are still cleaned up, and bounded by its duration plus the command timeout.
+	perfCtx, perfCancel := perfRunContext(perfOpts.duration, ctx.Duration("command-timeout"))
+	defer perfCancel()
+
 	// Find PIDs for the container IDs
 	var allPIDs []string
 	if len(containerIDs) > 0 {
@@ -343,81 +408,313 @@ func (a *App) runAttach(ctx *cli.Context, mode string) error {
 		}
 	}
 
+	// Pin the attached processes, there are none when attaching to a node
+	if cpuAffinity != "" {
+		if len(allPIDs) == 0 {
+			a.logger.Warn().Msg("CPU affinity requires attaching to a pod, ignoring --cpu-affinity")
+		} else {
+			restore, err := a.pinPIDs(remoteShellExec(sshClient), cpuAffinity, allPIDs)
+			if err != nil {
+				return err
+			}
+			defer restore()
+			if history.Target == nil {
+				history.Target = &model.Target{RemoteHost: nodeName}
+			}
+			history.Target.CPUAffinity = cpuAffinity
+		}
+	}
+
+	// Capture the resource usage of the pod around the perf run, the deferred
+	// capture runs before the history is recorded
+	if podName != "" && mode != "shell" {
+		history.Attach.UsageBefore = a.podResourceUsage(k8sClient, podName)
+		defer func() {
+			history.Attach.UsageAfter = a.podResourceUsage(k8sClient, podName)
+		}()
+	}
+
+	return a.attachPerf(perfCtx, ctx, mode, sshClient, allPIDs, containerIDs, perfOpts, runDir, history, &stdoutContent, &stderrContent)
+}
+
+// attachOptions holds the perf options of an attach run, parsed from the
+// flags of its mode.
+type attachOptions struct {
+	duration        int
+	event           string
+	count           int
+	events          []string
+	detail          bool
+	statAggregation perf.StatAggregation
+	c2cEvent        string
+	c2cCount        int
+	c2cReportMode   string
+	c2cShowAll      bool
+	memOpts         perf.MemOptions
+	memReportOpts   perf.MemReportOptions
+	// Run perf on all CPUs instead of the attached processes (perfgo system)
+	systemWide bool
+	// Directory on the target holding perf.data, /tmp of the perf pod if empty
+	remoteDir string
+}
+
+// parseAttachOptions returns the perf options of an attach run in mode from
+// the flags, and applies the output options of the run to the app.
+func (a *App) parseAttachOptions(ctx *cli.Context, mode string) (attachOptions, error) {
+	duration := ctx.Int("duration")
+	a.keepPerfData = ctx.Bool("keep-perf-data")
+
+	var perfEvent string
+	var perfCount int
+	var perfEvents []string
+	var perfDetail bool
+	var statAggregation perf.StatAggregation
+	var c2cEvent string
+	var c2cCount int
+	var c2cReportMode string
+	var c2cShowAll bool
+	var memOpts perf.MemOptions
+	var memReportOpts perf.MemReportOptions
+	if mode == "profile" {
+		perfEvent = ctx.String("event")
+		perfCount = ctx.Int("count")
+		a.foldedStacks = ctx.Bool("folded")
+		profileOutput, err := perf.ParseOutputFormat(ctx.String("output"))
+		if err != nil {
+			return attachOptions{}, err
+		}
+		a.profileOutput = profileOutput
+		symbolFiles, err := parseSymbolFiles(ctx.StringSlice("symbols"))
+		if err != nil {
+			return attachOptions{}, err
+		}
+		a.symbolFiles = symbolFiles
+	} else if mode == "stat" {
+		perfEvents = ctx.StringSlice("event")
+		perfEvent = strings.Join(perfEvents, ",")
+		perfDetail = ctx.Bool("detail")
+		statAggregation = perf.StatAggregation{
+			PerCore:   ctx.Bool("per-core"),
+			PerSocket: ctx.Bool("per-socket"),
+			PerThread: ctx.Bool("per-thread"),
+		}
+		if err := statAggregation.Validate(); err != nil {
+			return attachOptions{}, err
+		}
+	} else if mode == "c2c" {
+		c2cEvent = ctx.String("c2c-event")
+		c2cCount = ctx.Int("c2c-count")
+		// Use default values for c2c
+		c2cReportMode = "stdio"
+		c2cShowAll = false
+	} else if mode == "mem" {
+		memOpts = perf.MemOptions{
+			Type:        ctx.String("mem-type"),
+			Event:       ctx.String("mem-event"),
+			LoadLatency: ctx.Int("ldlat"),
+			Duration:    duration,
+		}
+		memReportOpts = perf.MemReportOptions{
+			Mode: "stdio",
+			Sort: ctx.String("mem-sort"),
+		}
+		if err := perf.ValidateMemType(memOpts.Type); err != nil {
+			return attachOptions{}, err
+		}
+	}
+
+	return attachOptions{
+		duration:        duration,
+		event:           perfEvent,
+		count:           perfCount,
+		events:          perfEvents,
+		detail:          perfDetail,
+		statAggregation: statAggregation,
+		c2cEvent:        c2cEvent,
+		c2cCount:        c2cCount,
+		c2cReportMode:   c2cReportMode,
+		c2cShowAll:      c2cShowAll,
+		memOpts:         memOpts,
+		memReportOpts:   memReportOpts,
+	}, nil
+}
+
+// attachPerf runs perf in mode on the pids through client, or opens a shell,
+// and archives the results in runDir. containerIDs are the containers of the
+// attached pod, if any.
+func (a *App) attachPerf(perfCtx context.Context, ctx *cli.Context, mode string, client *ssh.Client, pids []string, containerIDs map[string]string, opts attachOptions, runDir string, history *model.History, stdout, stderr *string) error {
+	// The perf pod is created for the run, so its /tmp isn't shared
+	remoteDir := opts.remoteDir
+	if remoteDir == "" {
+		remoteDir = "/tmp"
+	}
+
 	// Run perf stat or perf record
 	if mode == "stat" {
 		// Store perf options in history
 		history.Perf = &model.Perf{
 			Stat: &model.PerfStat{
-				Events:   perfEvents,
-				PIDs:     allPIDs,
-				Duration: duration,
-				Detail:   perfDetail,
+				Events:      opts.events,
+				PIDs:        pids,
+				Duration:    opts.duration,
+				Detail:      opts.detail,
+				Aggregation: opts.statAggregation.Mode(),
 			},
 		}
 
-		if err := a.executePerfStat(sshClient, allPIDs, perfEvents, perfDetail, duration, &stdoutContent, &stderrContent); err != nil {
-			finalErr = fmt.Errorf("failed to execute perf stat: %w", err)
-			return finalErr
+		statOpts := perf.StatOptions{
+			Events:          opts.events,
+			PIDs:            pids,
+			Duration:        opts.duration,
+			SystemWide:      opts.systemWide,
+			Detail:          opts.detail,
+			StatAggregation: opts.statAggregation,
+		}
+
+		if err := a.executePerfStat(perfCtx, client, statOpts, runDir, history, stdout, stderr); err != nil {
+			return fmt.Errorf("failed to execute perf stat: %w", err)
 		}
 	} else if mode == "profile" {
 		recordOpts := &perf.RecordOptions{
-			Event:    perfEvent,
-			Count:    perfCount,
-			Duration: duration,
+			Event:        opts.event,
+			Count:        opts.count,
+			Duration:     opts.duration,
+			SystemWide:   opts.systemWide,
+			BranchStack:  ctx.Bool("branch-stack"),
+			BranchFilter: ctx.String("branch-filter"),
+		}
+
+		// Profile the cgroup to include processes started while profiling,
+		// the PIDs found above are profiled if it can't be resolved
+		if ctx.Bool("cgroup") {
+			cgroupPath, err := a.findContainerCgroup(client, containerIDs)
+			if err != nil {
+				a.logger.Warn().Err(err).Msg("Failed to resolve the cgroup of the pod, profiling its PIDs")
+				history.Warnings = append(history.Warnings, fmt.Sprintf("profiled PIDs instead of the cgroup: %v", err))
+			} else {
+				recordOpts.CgroupPath = cgroupPath
+			}
 		}
 
 		// Store perf options in history
 		history.Perf = &model.Perf{
 			Record: &model.PerfRecord{
-				Event:    perfEvent,
-				Count:    perfCount,
-				PIDs:     allPIDs,
-				Duration: duration,
+				Event:        opts.event,
+				Count:        opts.count,
+				PIDs:         pids,
+				Cgroup:       recordOpts.CgroupPath,
+				Duration:     opts.duration,
+				BranchStack:  recordOpts.BranchStack,
+				BranchFilter: recordOpts.BranchFilter,
+				DefaultEvent: ctx.String("default-event"),
 			},
 		}
 
-		if err := a.executePerfRecord(sshClient, allPIDs, recordOpts, runDir, history); err != nil {
-			finalErr = fmt.Errorf("failed to execute perf record: %w", err)
-			return finalErr
+		if err := a.executePerfRecord(perfCtx, client, pids, recordOpts, copyOptions(ctx), remoteDir, runDir, history); err != nil {
+			return fmt.Errorf("failed to execute perf record: %w", err)
 		}
 	} else if mode == "c2c" {
+		if opts.c2cEvent == "" && history.Target != nil {
+			opts.c2cEvent = perf.DefaultC2CEvent(history.Target.Arch, history.Target.Vendor)
+		}
+
 		c2cOpts := perf.C2COptions{
-			Event:    c2cEvent,
-			Count:    c2cCount,
-			Duration: duration,
+			Event:      opts.c2cEvent,
+			Count:      opts.c2cCount,
+			PIDs:       pids,
+			Duration:   opts.duration,
+			OutputPath: remoteDir + "/perf.data",
 		}
 
 		reportOpts := perf.C2CReportOptions{
-			Mode:    c2cReportMode,
-			ShowAll: c2cShowAll,
+			Mode:    opts.c2cReportMode,
+			ShowAll: opts.c2cShowAll,
 		}
 
 		// Store perf options in history
 		history.Perf = &model.Perf{
 			C2C: &model.PerfC2C{
-				Event:      c2cEvent,
-				Count:      c2cCount,
-				PIDs:       allPIDs,
-				Duration:   duration,
-				ReportMode: c2cReportMode,
-				ShowAll:    c2cShowAll,
+				Event:      opts.c2cEvent,
+				Count:      opts.c2cCount,
+				PIDs:       pids,
+				Duration:   opts.duration,
+				ReportMode: opts.c2cReportMode,
+				ShowAll:    opts.c2cShowAll,
 			},
 		}
 
-		if err := a.executePerfC2C(sshClient, allPIDs, c2cOpts, reportOpts, runDir, history); err != nil {
-			finalErr = fmt.Errorf("failed to execute perf c2c: %w", err)
-			return finalErr
+		if err := a.recordAttachReport(perfCtx, client, c2cRecording(c2cOpts, reportOpts), remoteDir, runDir, history); err != nil {
+			return fmt.Errorf("failed to execute perf c2c: %w", err)
+		}
+	} else if mode == "mem" {
+		// Store perf options in history
+		history.Perf = &model.Perf{
+			Mem: memHistory(opts.memOpts, opts.memReportOpts),
+		}
+		history.Perf.Mem.PIDs = pids
+
+		memOpts := opts.memOpts
+		memOpts.PIDs = pids
+		memOpts.OutputPath = remoteDir + "/perf.data"
+		if err := a.recordAttachReport(perfCtx, client, memRecording(memOpts, opts.memReportOpts), remoteDir, runDir, history); err != nil {
+			return fmt.Errorf("failed to execute perf mem: %w", err)
 		}
 	} else if mode == "shell" {
-		if err := a.executeShell(sshClient, allPIDs); err != nil {
-			finalErr = fmt.Errorf("failed to execute shell: %w", err)
-			return finalErr
+		if err := a.executeShell(client, pids); err != nil {
+			return fmt.Errorf("failed to execute shell: %w", err)
 		}
 	}
 
 	return nil
 }
 
+// selectPod returns the pod to attach to out of the pods matching selector.
+// Only running pods are considered; if several match, first picks the first
+// by name, otherwise the choice is ambiguous and an error is returned.
+func selectPod(pods []k8s.Pod, selector string, first bool) (*k8s.Pod, error) {
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pod matches selector %s", selector)
+	}
+
+	var running []k8s.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == "Running" {
+			running = append(running, pod)
+		}
+	}
+	if len(running) == 0 {
+		return nil, fmt.Errorf("none of the %d pods matching selector %s is running", len(pods), selector)
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Metadata.Name < running[j].Metadata.Name
+	})
+	if len(running) > 1 && !first {
+		names := make([]string, 0, len(running))
+		for _, pod := range running {
+			names = append(names, pod.Metadata.Name)
+		}
+		return nil, fmt.Errorf("selector %s matches %d running pods (%s), narrow it down or pass --first to attach to %s",
+			selector, len(running), strings.Join(names, ", "), names[0])
+	}
+	return &running[0], nil
+}
+
+// newAttachHistory returns the history of an attach run, the targeted pod or
+// node, perf options and artifacts are added while the run progresses.
+func newAttachHistory(runID string, startTime time.Time, kubeContext, namespace string) *model.History {
+	return &model.History{
+		ID:        runID,
+		Type:      model.HistoryTypeAttach,
+		Timestamp: startTime,
+		Args:      os.Args,
+		Attach: &model.AttachRun{
+			KubeContext: kubeContext,
+			Namespace:   namespace,
+		},
+	}
+}
+
 // setupSSHKeys sets up SSH keys in the perf pod for SSH access.
 // Returns the paths to the private key and host public key files.
 func (a *App) setupSSHKeys(ctx context.Context, client *k8s.Client, podName, namespace, tempDir string) (string, string, error) {
@@ -506,6 +803,22 @@ func (a *App) setupSSHKeys(ctx context.Context, client *k8s.Client, podName, nam
 	return privateKeyPath, hostKeyPath, nil
 }
 
+// podContainerIDs returns the IDs of the running containers of the pod by
+// name, logging the containers that are skipped because they have no
+// processes to attach to.
+func (a *App) podContainerIDs(pod *k8s.Pod, includeInit bool) map[string]string {
+	containerIDs, skipped := k8s.RunningContainerIDs(pod, includeInit)
+	for _, container := range skipped {
+		a.logger.Info().
+			Str("container", container.Name).
+			Bool("init", container.Init).
+			Str("state", container.State).
+			Str("reason", container.Reason).
+			Msg("Skipping container that is not running")
+	}
+	return containerIDs
+}
+
 // findPIDsForContainers finds all PIDs associated with the given container IDs.
 // Returns a map of container name to list of PIDs.
 func (a *App) findPIDsForContainers(client *ssh.Client, containerIDs map[string]string) (map[string][]string, error) {
@@ -517,10 +830,10 @@ func (a *App) findPIDsForContainers(client *ssh.Client, containerIDs map[string]
 			Str("container_id", containerID).
 			Msg("Searching for PIDs")
 
-		// Search for processes with this container ID in their cgroup
-		// The cgroup file contains the container ID in various formats depending on the runtime
-		findCmd := fmt.Sprintf("grep -l %s /proc/*/cgroup 2>/dev/null | cut -d/ -f3 | sort -u", shellescape.Quote(containerID))
-		output, _, err := client.RunCommand(findCmd)
+		// Search for processes with this container ID in their cgroup, the
+		// cgroup path names the container differently depending on the runtime
+		// and cgroup version, so the candidates are matched locally
+		output, _, err := client.RunCommand(findPIDsCommand(containerID))
 		if err != nil {
 			a.logger.Warn().
 				Err(err).
@@ -529,14 +842,7 @@ func (a *App) findPIDsForContainers(client *ssh.Client, containerIDs map[string]
 			continue
 		}
 
-		// Parse PIDs from output
-		pidList := []string{}
-		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-			if line != "" && line != "self" && line != "thread-self" {
-				pidList = append(pidList, line)
-			}
-		}
-
+		pidList := parseCgroupPIDs(output, containerID)
 		if len(pidList) > 0 {
 			pids[containerName] = pidList
 			a.logger.Debug().
@@ -553,27 +859,71 @@ func (a *App) findPIDsForContainers(client *ssh.Client, containerIDs map[string]
 	return pids, nil
 }
 
-// executePerfStat runs perf stat on the specified PIDs via SSH.
-func (a *App) executePerfStat(client *ssh.Client, pids []string, events []string, detail bool, duration int, stdout, stderr *string) error {
+// findContainerCgroup returns the cgroup for perf record -G covering all
+// containers of containerIDs: the cgroup of a single container, or the pod
+// cgroup containing the cgroups of several.
+func (a *App) findContainerCgroup(client *ssh.Client, containerIDs map[string]string) (string, error) {
+	if len(containerIDs) == 0 {
+		return "", fmt.Errorf("no container IDs found in pod status")
+	}
+
+	var paths []string
+	for containerName, containerID := range containerIDs {
+		output, _, err := client.RunCommand(findPIDsCommand(containerID))
+		if err != nil {
+			return "", fmt.Errorf("failed to read cgroups of container %s: %w", containerName, err)
+		}
+		path, ok := parseContainerCgroup(output, containerID)
+		if !ok {
+			return "", fmt.Errorf("no cgroup found for container %s", containerName)
+		}
+		a.logger.Debug().
+			Str("container", containerName).
+			Str("cgroup", path).
+			Msg("Found cgroup for container")
+		paths = append(paths, path)
+	}
+
+	cgroupPath := commonCgroupParent(paths)
+	if cgroupPath == "" {
+		return "", fmt.Errorf("containers share no cgroup below the root")
+	}
+	return cgroupPath, nil
+}
+
+// perfRunContext returns a context for a perf run of the given duration in
+// seconds. It is cancelled on SIGINT/SIGTERM and, when timeout is positive,
+// once the run exceeds its duration by more than timeout.
+func perfRunContext(duration int, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(duration)*time.Second+timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// executePerfStat runs perf stat on the PIDs of statOpts via SSH and archives
+// its output.
+func (a *App) executePerfStat(ctx context.Context, client *ssh.Client, statOpts perf.StatOptions, runDir string, history *model.History, stdout, stderr *string) error {
 	a.logger.Info().
-		Strs("pids", pids).
-		Strs("events", events).
-		Bool("detail", detail).
-		Int("duration", duration).
+		Strs("pids", statOpts.PIDs).
+		Strs("events", statOpts.Events).
+		Bool("detail", statOpts.Detail).
+		Bool("system_wide", statOpts.SystemWide).
+		Int("duration", statOpts.Duration).
 		Msg("Running perf stat on PIDs")
 
 	// Build perf stat command
-	statOpts := perf.StatOptions{
-		Events:   events,
-		PIDs:     pids,
-		Duration: duration,
-		Detail:   detail,
-	}
 	perfCmd := perf.BuildStatCommand(statOpts)
 
 	a.logger.Debug().Str("command", perfCmd).Msg("Executing perf stat command")
 
-	stdoutStr, stderrStr, err := client.RunCommand(perfCmd)
+	stdoutStr, stderrStr, err := client.RunCommandContext(ctx, perfCmd)
 	if err != nil {
 		return fmt.Errorf("perf stat failed: %w", err)
 	}
@@ -587,19 +937,56 @@ func (a *App) executePerfStat(client *ssh.Client, pids []string, events []string
 	fmt.Println("\nPerf stat output:")
 	fmt.Println(stderrStr)
 
+	if err := a.saveStatArtifact(runDir, history, stderrStr, statOpts.Detail); err != nil {
+		return err
+	}
+
 	a.logger.Info().Msg("Perf stat completed successfully")
 	return nil
 }
 
+// saveStatArtifact writes the perf stat output to perf-stat.txt in runDir and
+// registers it as artifact, so view can show it later.
+func (a *App) saveStatArtifact(runDir string, history *model.History, output string, detail bool) error {
+	statFilename := "perf-stat.txt"
+	statPath := filepath.Join(runDir, statFilename)
+	if err := os.WriteFile(statPath, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write perf stat output: %w", err)
+	}
+
+	artifactType := model.ArtifactTypePerfStat
+	if detail {
+		artifactType = model.ArtifactTypePerfStatDetailed
+	}
+	history.Artifacts = append(history.Artifacts, model.Artifact{
+		Type: artifactType,
+		Size: uint64(len(output)),
+		File: statFilename,
+	})
+
+	a.logger.Debug().
+		Str("file", statFilename).
+		Int("size", len(output)).
+		Msg("Registered perf stat artifact")
+
+	return nil
+}
+
 // executePerfRecord runs perf record on the specified PIDs via SSH.
-func (a *App) executePerfRecord(client *ssh.Client, pids []string, recordOpts *perf.RecordOptions, runDir string, history *model.History) error {
+func (a *App) executePerfRecord(ctx context.Context, client *ssh.Client, pids []string, recordOpts *perf.RecordOptions, copyOpts perf.CopyOptions, remoteDir, runDir string, history *model.History) error {
 	// Set PIDs and output path
 	recordOpts.PIDs = pids
-	recordOpts.OutputPath = "/tmp/perf.data"
+	recordOpts.OutputPath = remoteDir + "/perf.data"
 
 	logEvent := a.logger.Info().
 		Strs("pids", pids).
 		Int("duration", recordOpts.Duration)
+	if recordOpts.CgroupPath != "" {
+		logEvent.Str("cgroup", recordOpts.CgroupPath)
+	}
+	if recordOpts.SystemWide {
+		logEvent.Bool("system_wide", true)
+	}
 	if recordOpts.Event != "" {
 		logEvent.Str("event", recordOpts.Event)
 		if recordOpts.Count > 0 {
@@ -613,7 +1000,7 @@ func (a *App) executePerfRecord(client *ssh.Client, pids []string, recordOpts *p
 
 	a.logger.Debug().Str("command", perfCmd).Msg("Executing perf record command")
 
-	output, _, err := client.RunCommand(perfCmd)
+	output, _, err := client.RunCommandContext(ctx, perfCmd)
 	if err != nil {
 		return fmt.Errorf("perf record failed: %w", err)
 	}
@@ -628,19 +1015,22 @@ func (a *App) executePerfRecord(client *ssh.Client, pids []string, recordOpts *p
 		Msg("Performance data collected on remote host")
 
 	// Process perf.data and convert to pprof
-	remoteBaseDir := "/tmp"
 	profilePath := filepath.Join(runDir, "perf.pb.gz")
-	binaryArtifacts, err := perf.ProcessPerfData(a.logger, client, remoteBaseDir, profilePath, runDir, pids, history.ID)
-	if err != nil {
+	binaryArtifacts, err := perf.ProcessPerfData(a.logger, client, remoteDir, profilePath, runDir, pids, copyOpts, history.ID, recordOpts.HasBranchStack())
+	if errors.Is(err, perf.ErrNoSamples) {
+		history.Warnings = append(history.Warnings, err.Error())
+	} else if err != nil {
 		return fmt.Errorf("failed to process performance data: %w", err)
 	}
+	a.savePerfData(client, recordOpts.OutputPath, runDir, history)
 
 	// Register binary artifacts
 	for _, binArtifact := range binaryArtifacts {
 		history.Artifacts = append(history.Artifacts, model.Artifact{
-			Type: model.ArtifactTypeAttachBinary,
-			Size: binArtifact.Size,
-			File: binArtifact.LocalPath,
+			Type:    model.ArtifactTypeAttachBinary,
+			Size:    binArtifact.Size,
+			File:    binArtifact.LocalPath,
+			BuildID: binArtifact.BuildID,
 		})
 		a.logger.Debug().
 			Str("remote", binArtifact.RemotePath).
@@ -651,66 +1041,6 @@ func (a *App) executePerfRecord(client *ssh.Client, pids []string, recordOpts *p
 	return nil
 }
 
-// executePerfC2C runs perf c2c record on the specified PIDs via SSH and generates a report.
-func (a *App) executePerfC2C(client *ssh.Client, pids []string, c2cOpts perf.C2COptions, reportOpts perf.C2CReportOptions, runDir string, history *model.History) error {
-	// Set PIDs and output path
-	c2cOpts.PIDs = pids
-	c2cOpts.OutputPath = "/tmp/perf.data"
-
-	logEvent := a.logger.Info().
-		Strs("pids", pids).
-		Int("duration", c2cOpts.Duration)
-	if c2cOpts.Event != "" {
-		logEvent.Str("event", c2cOpts.Event)
-		if c2cOpts.Count > 0 {
-			logEvent.Int("count", c2cOpts.Count)
-		}
-	}
-	logEvent.Msg("Running perf c2c record on PIDs")
-
-	// Build perf c2c record command
-	perfCmd := perf.BuildC2CRecordCommand(c2cOpts)
-
-	a.logger.Debug().Str("command", perfCmd).Msg("Executing perf c2c record command")
-
-	output, _, err := client.RunCommand(perfCmd)
-	if err != nil {
-		return fmt.Errorf("perf c2c record failed: %w", err)
-	}
-
-	// Display the output
-	if output != "" {
-		fmt.Println(output)
-	}
-
-	a.logger.Info().
-		Str("remote_path", c2cOpts.OutputPath).
-		Msg("C2C performance data collected on remote host")
-
-	// Process perf.data and generate c2c report
-	remoteBaseDir := "/tmp"
-	reportFilename, err := perf.ProcessC2CData(a.logger, client, remoteBaseDir, runDir, reportOpts, history.ID)
-	if err != nil {
-		return fmt.Errorf("failed to process c2c data: %w", err)
-	}
-
-	// Get report file size and register artifact
-	reportPath := filepath.Join(runDir, reportFilename)
-	if reportInfo, err := os.Stat(reportPath); err == nil {
-		history.Artifacts = append(history.Artifacts, model.Artifact{
-			Type: model.ArtifactTypePerfC2CReport,
-			Size: uint64(reportInfo.Size()),
-			File: reportFilename,
-		})
-		a.logger.Debug().
-			Str("report", reportFilename).
-			Uint64("size", uint64(reportInfo.Size())).
-			Msg("Registered c2c report artifact")
-	}
-
-	return nil
-}
-
 // executeShell opens an interactive SSH shell to the perf pod.
 func (a *App) executeShell(client *ssh.Client, pids []string) error {
 	a.logger.Info().
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/k8s"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveStatArtifact(t *testing.T) {
+	output := " Performance counter stats for process id '10':\n\n     1,234      cycles\n"
+
+	tests := []struct {
+		name   string
+		detail bool
+		want   model.ArtifactType
+	}{
+		{name: "plain", detail: false, want: model.ArtifactTypePerfStat},
+		{name: "detailed", detail: true, want: model.ArtifactTypePerfStatDetailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runDir := t.TempDir()
+			h := &model.History{}
+
+			a := &App{logger: zerolog.Nop()}
+			require.NoError(t, a.saveStatArtifact(runDir, h, output, tt.detail))
+
+			require.Len(t, h.Artifacts, 1)
+			assert.Equal(t, model.Artifact{
+				Type: tt.want,
+				Size: uint64(len(output)),
+				File: "perf-stat.txt",
+			}, h.Artifacts[0])
+
+			data, err := os.ReadFile(filepath.Join(runDir, "perf-stat.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, output, string(data))
+		})
+	}
+}
+
+func TestRecordHistory_AttachRun(t *testing.T) {
+	perfgoRoot := filepath.Join(t.TempDir(), ".perfgo")
+	runDir := filepath.Join(perfgoRoot, "history", "20260101-120000-abcdef12-0123abcd")
+	require.NoError(t, os.MkdirAll(runDir, 0755))
+
+	h := newAttachHistory("0123abcd0123abcd", time.Now(), "prod", "shop")
+	h.Attach.PodName = "checkout-7d9f"
+	h.Attach.NodeName = "worker-01"
+	h.Perf = &model.Perf{
+		Stat: &model.PerfStat{Events: []string{"cycles"}, PIDs: []string{"10", "11"}, Duration: 5},
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	require.NoError(t, a.saveStatArtifact(runDir, h, "1,234 cycles\n", false))
+	require.NoError(t, a.recordHistory(h, runDir, "", "", ""))
+
+	entries, err := history.LoadEntries(zerolog.Nop(), perfgoRoot)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	got := entries[0].History
+	assert.Equal(t, model.HistoryTypeAttach, got.Type)
+	assert.Nil(t, got.Test)
+	assert.Equal(t, &model.AttachRun{
+		KubeContext: "prod",
+		Namespace:   "shop",
+		PodName:     "checkout-7d9f",
+		NodeName:    "worker-01",
+	}, got.Attach)
+	assert.Equal(t, []string{"10", "11"}, got.Perf.Stat.PIDs)
+	require.Len(t, got.Artifacts, 1)
+	assert.Equal(t, model.ArtifactTypePerfStat, got.Artifacts[0].Type)
+}
+
+func TestSelectPod(t *testing.T) {
+	pod := func(name, phase string) k8s.Pod {
+		return k8s.Pod{Metadata: k8s.PodMetadata{Name: name}, Status: k8s.PodStatus{Phase: phase}}
+	}
+
+	tests := []struct {
+		name    string
+		pods    []k8s.Pod
+		first   bool
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "no match",
+			wantErr: "no pod matches selector app=api",
+		},
+		{
+			name:    "none running",
+			pods:    []k8s.Pod{pod("api-0", "Pending"), pod("api-1", "Failed")},
+			wantErr: "none of the 2 pods matching selector app=api is running",
+		},
+		{
+			name: "single running",
+			pods: []k8s.Pod{pod("api-0", "Pending"), pod("api-1", "Running")},
+			want: "api-1",
+		},
+		{
+			name:    "ambiguous",
+			pods:    []k8s.Pod{pod("api-2", "Running"), pod("api-1", "Running")},
+			wantErr: "selector app=api matches 2 running pods (api-1, api-2), narrow it down or pass --first to attach to api-1",
+		},
+		{
+			name:  "first by name",
+			pods:  []k8s.Pod{pod("api-2", "Running"), pod("api-1", "Running")},
+			first: true,
+			want:  "api-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectPod(tt.pods, "app=api", tt.first)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Metadata.Name)
+		})
+	}
+}
+
+func TestFindPIDsForContainers_SkipsTerminatedInit(t *testing.T) {
+	pod := &k8s.Pod{Status: k8s.PodStatus{
+		Phase: "Running",
+		InitContainerStatuses: []k8s.ContainerStatus{{
+			Name:        "migrate",
+			ContainerID: "containerd://" + otherContainerID,
+			State:       k8s.ContainerState{Terminated: &k8s.ContainerStateTerminated{Reason: "Completed"}},
+		}},
+		ContainerStatuses: []k8s.ContainerStatus{{
+			Name:        "api",
+			Ready:       true,
+			ContainerID: "containerd://" + testContainerID,
+			State:       k8s.ContainerState{Running: &k8s.ContainerStateRunning{}},
+		}},
+	}}
+
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: "/proc/812/cgroup:0::/kubepods.slice/cri-containerd-" + testContainerID + ".scope\n"}
+	}}
+	client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(fake))
+	require.NoError(t, err)
+	a := &App{logger: zerolog.Nop()}
+
+	for _, includeInit := range []bool{false, true} {
+		containerIDs := a.podContainerIDs(pod, includeInit)
+		assert.Equal(t, map[string]string{"api": testContainerID}, containerIDs)
+
+		pids, err := a.findPIDsForContainers(client, containerIDs)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"api": {"812"}}, pids)
+	}
+
+	// Only the running container was probed
+	for _, cmd := range fake.Commands() {
+		assert.NotContains(t, strings.Join(cmd.Args, " "), otherContainerID[:shortContainerIDLen])
+	}
+}
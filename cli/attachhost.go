@@ -0,0 +1,157 @@
+package cli
+
+// This file contains attach --remote-host, which attaches perf to processes
+// on a plain SSH host instead of a Kubernetes pod or node.
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// parsePIDs returns the PIDs given by --pid, which may be comma separated.
+func parsePIDs(values []string) ([]string, error) {
+	var pids []string
+	for _, value := range values {
+		for _, pid := range strings.Split(value, ",") {
+			pid = strings.TrimSpace(pid)
+			if pid == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(pid); err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid --pid %q: must be a positive number", pid)
+			}
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// findPIDsByName returns the PIDs of the processes named name on the host of
+// exec. The name is matched exactly against the process name, like pgrep -x.
+func findPIDsByName(exec shellExec, name string) ([]string, error) {
+	// pgrep exits with 1 if no process matched, which isn't a failure here
+	stdout, _, err := exec(fmt.Sprintf("pgrep -x -- %s; rc=$?; [ $rc -le 1 ] || exit $rc", shellescape.Quote(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find processes named %s: %w", name, err)
+	}
+
+	pids, err := parsePIDs(strings.Fields(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected pgrep output %q: %w", stdout, err)
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no process named %s is running", name)
+	}
+	return pids, nil
+}
+
+// resolveAttachPIDs returns the PIDs to attach to, given by --pid or found
+// by the --process name on the host of exec.
+func resolveAttachPIDs(exec shellExec, pidValues []string, process string) ([]string, error) {
+	if process != "" {
+		return findPIDsByName(exec, process)
+	}
+	return parsePIDs(pidValues)
+}
+
+// modeWritesPerfData returns whether perf writes a perf.data file in mode.
+func modeWritesPerfData(mode string) bool {
+	return mode == "profile" || mode == "c2c" || mode == "mem"
+}
+
+// makeRemoteRunDir creates a directory private to the run on the host of
+// exec with mktemp -d, and returns its path.
+func makeRemoteRunDir(exec shellExec) (string, error) {
+	stdout, _, err := exec(`mktemp -d "${TMPDIR:-/tmp}/perfgo.XXXXXXXXXX"`)
+	if err != nil {
+		return "", fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	dir := strings.TrimSpace(stdout)
+	if !path.IsAbs(dir) || strings.ContainsAny(dir, " \t\n'\"$`\\") {
+		return "", fmt.Errorf("unexpected mktemp output %q", stdout)
+	}
+	return dir, nil
+}
+
+// attachHost runs perf in mode on processes of the SSH host, selected by
+// --pid or --process, or on all its CPUs if opts.systemWide is set, and
+// archives the results in runDir.
+func (a *App) attachHost(ctx *cli.Context, mode, host string, opts attachOptions, runDir string, history *model.History, stdout, stderr *string) error {
+	history.Attach.Host = host
+	history.Attach.Process = ctx.String("process")
+
+	sshClient, err := ssh.New(a.logger, host, a.sshOptions(ctx)...)
+	if err != nil {
+		return fmt.Errorf("failed to create SSH client: %w", err)
+	}
+	defer sshClient.Close()
+
+	history.Target = &model.Target{RemoteHost: host}
+	if hostOS, hostArch, err := sshClient.DetectSystem(); err == nil {
+		history.Target.OS = hostOS
+		history.Target.Arch = hostArch
+		history.Target.Vendor = sshClient.DetectCPUVendor(hostOS, hostArch)
+		history.Target.KernelRelease, history.Target.PerfVersion = detectVersions(remoteShellExec(sshClient))
+	} else {
+		a.logger.Warn().Err(err).Msg("Failed to detect remote system")
+	}
+
+	if mode != "shell" {
+		if _, _, err := sshClient.RunCommand("command -v perf"); err != nil {
+			return fmt.Errorf("perf not found on %s, install it (see perfgo doctor): %w", host, err)
+		}
+		if err := a.checkPerfEvents(host, remoteEventLister(sshClient), requestedEvents(opts.event)); err != nil {
+			return err
+		}
+	}
+
+	// System-wide runs aren't restricted to processes
+	var pids []string
+	if !opts.systemWide {
+		pids, err = resolveAttachPIDs(remoteShellExec(sshClient), ctx.StringSlice("pid"), history.Attach.Process)
+		if err != nil {
+			return err
+		}
+		a.logger.Info().
+			Str("host", host).
+			Strs("pids", pids).
+			Msg("Attaching to processes")
+	}
+
+	// perf.data goes to a directory of its own, the host's /tmp may be
+	// shared with other runs and users
+	if modeWritesPerfData(mode) {
+		remoteDir, err := makeRemoteRunDir(remoteShellExec(sshClient))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := sshClient.RemoveAll(remoteDir); err != nil {
+				a.logger.Warn().Err(err).Str("dir", remoteDir).Msg("Failed to remove remote directory")
+			}
+		}()
+		opts.remoteDir = remoteDir
+	}
+
+	perfCtx, perfCancel := perfRunContext(opts.duration, ctx.Duration("command-timeout"))
+	defer perfCancel()
+
+	// Pinned once interrupts cancel the perf run, so the affinity is restored
+	if cpuAffinity := ctx.String("cpu-affinity"); cpuAffinity != "" && len(pids) > 0 {
+		restore, err := a.pinPIDs(remoteShellExec(sshClient), cpuAffinity, pids)
+		if err != nil {
+			return err
+		}
+		defer restore()
+		history.Target.CPUAffinity = cpuAffinity
+	}
+
+	return a.attachPerf(perfCtx, ctx, mode, sshClient, pids, nil, opts, runDir, history, stdout, stderr)
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "repeated flag", values: []string{"812", "913"}, want: []string{"812", "913"}},
+		{name: "comma separated", values: []string{"812, 913,"}, want: []string{"812", "913"}},
+		{name: "not a number", values: []string{"812,api"}, wantErr: `invalid --pid "api": must be a positive number`},
+		{name: "zero", values: []string{"0"}, wantErr: `invalid --pid "0": must be a positive number`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pids, err := parsePIDs(tt.values)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pids)
+		})
+	}
+}
+
+func TestFindPIDsByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  runner.Result
+		want    []string
+		wantErr string
+	}{
+		{name: "running", result: runner.Result{Stdout: "812\n913\n"}, want: []string{"812", "913"}},
+		{name: "not running", wantErr: "no process named my server is running"},
+		{
+			name:    "pgrep failed",
+			result:  runner.Result{Stderr: "sh: pgrep: not found\n", Err: errors.New("exit status 127")},
+			wantErr: "failed to find processes named my server: command failed: exit status 127 (stderr: sh: pgrep: not found\n)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				if strings.Contains(cmd.Args[len(cmd.Args)-1], "pgrep") {
+					return tt.result
+				}
+				return runner.Result{}
+			}}
+			client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(fake))
+			require.NoError(t, err)
+
+			pids, err := findPIDsByName(remoteShellExec(client), "my server")
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, pids)
+			}
+
+			commands := fake.Commands()
+			remote := commands[len(commands)-1].Args
+			assert.Contains(t, remote[len(remote)-1], `pgrep -x -- '"'"'my server'"'"';`)
+		})
+	}
+}
+
+func TestResolveAttachPIDs(t *testing.T) {
+	exec := func(command string) (string, string, error) {
+		return "812\n", "", nil
+	}
+
+	pids, err := resolveAttachPIDs(exec, []string{"913"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"913"}, pids)
+
+	pids, err = resolveAttachPIDs(exec, nil, "myserver")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"812"}, pids)
+}
+
+func TestAttachHost_RecordCommand(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		remote := cmd.Args[len(cmd.Args)-1]
+		switch {
+		case strings.Contains(remote, "pgrep"):
+			return runner.Result{Stdout: "812\n913\n"}
+		case strings.Contains(remote, "perf record"):
+			return runner.Result{Err: errors.New("exit status 1")}
+		}
+		return runner.Result{}
+	}}
+	client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(fake))
+	require.NoError(t, err)
+	a := &App{logger: zerolog.Nop()}
+
+	pids, err := resolveAttachPIDs(remoteShellExec(client), nil, "myserver")
+	require.NoError(t, err)
+
+	history := &model.History{Attach: &model.AttachRun{}}
+	err = a.executePerfRecord(context.Background(), client, pids, &perf.RecordOptions{Duration: 5}, perf.CopyOptions{}, "/tmp/perfgo.x1Y2z3", t.TempDir(), history)
+	require.ErrorContains(t, err, "perf record failed")
+
+	var record string
+	for _, cmd := range fake.Commands() {
+		if remote := cmd.Args[len(cmd.Args)-1]; strings.HasPrefix(remote, "perf record") {
+			record = remote
+		}
+	}
+	assert.Equal(t, "perf record -g --call-graph fp -o /tmp/perfgo.x1Y2z3/perf.data -p 812,913 sleep 5", record)
+}
+
+func TestMakeRemoteRunDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		stdout  string
+		err     error
+		want    string
+		wantErr string
+	}{
+		{name: "mktemp directory", stdout: "/tmp/perfgo.x1Y2z3\n", want: "/tmp/perfgo.x1Y2z3"},
+		{name: "mktemp fails", err: errors.New("exit status 1"), wantErr: "failed to create remote directory"},
+		{name: "relative path", stdout: "perfgo.x1Y2z3\n", wantErr: "unexpected mktemp output"},
+		{name: "shell characters", stdout: "/tmp/perfgo.$(id)\n", wantErr: "unexpected mktemp output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var command string
+			exec := func(cmd string) (string, string, error) {
+				command = cmd
+				return tt.stdout, "", tt.err
+			}
+
+			dir, err := makeRemoteRunDir(exec)
+			assert.Contains(t, command, "mktemp -d")
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dir)
+		})
+	}
+}
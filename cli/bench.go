@@ -0,0 +1,91 @@
+package cli
+
+// This file contains the parsing of the benchmark results printed by go test
+// -bench, which are kept with the run next to its perf data.
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perfgo/perfgo/model"
+)
+
+// parseBenchmarkResults returns the benchmark results in the output of a
+// test binary, in the order they were printed:
+//
+//	pkg: github.com/perfgo/perfgo/examples/false-sharing
+//	BenchmarkPadding-8   	 1000000	      1234 ns/op	      64 B/op	       2 allocs/op
+//
+// Other lines, and metrics besides ns/op, B/op and allocs/op, are skipped.
+func parseBenchmarkResults(output string) []model.BenchmarkResult {
+	var results []model.BenchmarkResult
+	var pkg string
+	for _, line := range strings.Split(output, "\n") {
+		// Remote runs with a TTY end lines with \r\n
+		line = strings.TrimRight(line, "\r")
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(p)
+			continue
+		}
+		if result, ok := parseBenchmarkLine(line); ok {
+			result.Package = pkg
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// parseBenchmarkLine parses a benchmark result line: the name, the number of
+// iterations and value-unit pairs of metrics.
+func parseBenchmarkLine(line string) (model.BenchmarkResult, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return model.BenchmarkResult{}, false
+	}
+	iterations, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return model.BenchmarkResult{}, false
+	}
+
+	result := model.BenchmarkResult{Name: fields[0], Iterations: iterations}
+	measured := false
+	for i := 2; i < len(fields); i += 2 {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return model.BenchmarkResult{}, false
+		}
+		switch fields[i+1] {
+		case "ns/op":
+			result.NsPerOp = value
+			measured = true
+		case "B/op":
+			result.BytesPerOp = int64(value)
+			result.Benchmem = true
+		case "allocs/op":
+			result.AllocsPerOp = int64(value)
+			result.Benchmem = true
+		}
+	}
+	return result, measured
+}
+
+// writeBenchmarkResults writes the results in aligned columns, grouped by package.
+func writeBenchmarkResults(w io.Writer, results []model.BenchmarkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	pkg := ""
+	for _, r := range results {
+		if r.Package != pkg {
+			pkg = r.Package
+			fmt.Fprintf(tw, "  pkg: %s\n", pkg)
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%s ns/op", r.Name, r.Iterations, strconv.FormatFloat(r.NsPerOp, 'f', -1, 64))
+		if r.Benchmem {
+			fmt.Fprintf(tw, "\t%d B/op\t%d allocs/op", r.BytesPerOp, r.AllocsPerOp)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBenchmarkResults(t *testing.T) {
+	output := "goos: linux\r\n" +
+		"goarch: amd64\r\n" +
+		"pkg: github.com/perfgo/perfgo/examples/false-sharing\r\n" +
+		"cpu: AMD Ryzen 9 7950X 16-Core Processor\r\n" +
+		"BenchmarkPadding-32    \t 1000000\t      1234 ns/op\t      64 B/op\t       2 allocs/op\r\n" +
+		"BenchmarkNoPadding-32  \t  500000\t      2468.5 ns/op\t   12.50 MB/s\t       0 B/op\t       0 allocs/op\r\n" +
+		"BenchmarkSkipped-32    \t--- SKIP: not supported\r\n" +
+		"PASS\r\n" +
+		"ok  \tgithub.com/perfgo/perfgo/examples/false-sharing\t3.456s\r\n"
+
+	results := parseBenchmarkResults(output)
+	require.Len(t, results, 2)
+	assert.Equal(t, model.BenchmarkResult{
+		Package:     "github.com/perfgo/perfgo/examples/false-sharing",
+		Name:        "BenchmarkPadding-32",
+		Iterations:  1000000,
+		NsPerOp:     1234,
+		Benchmem:    true,
+		BytesPerOp:  64,
+		AllocsPerOp: 2,
+	}, results[0])
+	assert.Equal(t, "BenchmarkNoPadding-32", results[1].Name)
+	assert.Equal(t, 2468.5, results[1].NsPerOp)
+	assert.True(t, results[1].Benchmem)
+	assert.Zero(t, results[1].AllocsPerOp)
+
+	// Without -benchmem only ns/op is reported
+	results = parseBenchmarkResults("BenchmarkFoo \t 100\t 10.5 ns/op\nPASS\n")
+	require.Len(t, results, 1)
+	assert.Equal(t, model.BenchmarkResult{Name: "BenchmarkFoo", Iterations: 100, NsPerOp: 10.5}, results[0])
+
+	// Plain test output has no benchmarks
+	assert.Empty(t, parseBenchmarkResults("=== RUN   TestFoo\n--- PASS: TestFoo (0.00s)\nPASS\n"))
+	assert.Empty(t, parseBenchmarkResults("BenchmarkFoo is fast\n"))
+}
+
+func TestWriteBenchmarkResults(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeBenchmarkResults(&buf, []model.BenchmarkResult{
+		{Package: "example.com/pkg", Name: "BenchmarkA-8", Iterations: 1000, NsPerOp: 1234.5, Benchmem: true, BytesPerOp: 64, AllocsPerOp: 2},
+		{Package: "example.com/pkg", Name: "BenchmarkLonger-8", Iterations: 20, NsPerOp: 5},
+	}))
+	assert.Equal(t, ""+
+		"  pkg: example.com/pkg\n"+
+		"  BenchmarkA-8       1000  1234.5 ns/op  64 B/op  2 allocs/op\n"+
+		"  BenchmarkLonger-8  20    5 ns/op\n", buf.String())
+}
@@ -0,0 +1,198 @@
+package cli
+
+// This file contains the bench-compare command, which compares the Go
+// benchmark results of two runs.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// benchRegressionThreshold is the relative increase of a metric above which
+// bench-compare flags a regression.
+const benchRegressionThreshold = 0.05
+
+// benchComparison pairs the results of a benchmark in the old and the new run.
+// Old or New is nil if the benchmark only ran in the other run.
+type benchComparison struct {
+	Package string
+	Name    string
+	Old     *model.BenchmarkResult
+	New     *model.BenchmarkResult
+}
+
+// compareBenchmarks aligns the old and new results by package and benchmark
+// name. Benchmarks of the old run come first in their order, followed by the
+// ones only in the new run.
+func compareBenchmarks(oldResults, newResults []model.BenchmarkResult) []benchComparison {
+	key := func(r model.BenchmarkResult) string {
+		return r.Package + " " + r.Name
+	}
+
+	var comparisons []benchComparison
+	index := map[string]int{}
+	for i := range oldResults {
+		r := &oldResults[i]
+		if _, ok := index[key(*r)]; ok {
+			continue
+		}
+		index[key(*r)] = len(comparisons)
+		comparisons = append(comparisons, benchComparison{Package: r.Package, Name: r.Name, Old: r})
+	}
+	for i := range newResults {
+		r := &newResults[i]
+		if j, ok := index[key(*r)]; ok {
+			if comparisons[j].New == nil {
+				comparisons[j].New = r
+			}
+			continue
+		}
+		index[key(*r)] = len(comparisons)
+		comparisons = append(comparisons, benchComparison{Package: r.Package, Name: r.Name, New: r})
+	}
+	return comparisons
+}
+
+// benchMetric is a metric of a benchmark compared by bench-compare, where
+// lower values are better.
+type benchMetric struct {
+	unit     string
+	old, new float64
+}
+
+// metrics returns the metrics reported in both runs; B/op and allocs/op are
+// only compared if both runs used -benchmem.
+func (c benchComparison) metrics() []benchMetric {
+	metrics := []benchMetric{{unit: "ns/op", old: c.Old.NsPerOp, new: c.New.NsPerOp}}
+	if c.Old.Benchmem && c.New.Benchmem {
+		metrics = append(metrics,
+			benchMetric{unit: "B/op", old: float64(c.Old.BytesPerOp), new: float64(c.New.BytesPerOp)},
+			benchMetric{unit: "allocs/op", old: float64(c.Old.AllocsPerOp), new: float64(c.New.AllocsPerOp)},
+		)
+	}
+	return metrics
+}
+
+// percent returns the relative change of m in percent, which is undefined if
+// the old value is zero.
+func (m benchMetric) percent() (float64, bool) {
+	if m.old == 0 {
+		return 0, false
+	}
+	return (m.new - m.old) / m.old * 100, true
+}
+
+// regression reports whether m increased by more than benchRegressionThreshold.
+func (m benchMetric) regression() bool {
+	if m.old == 0 {
+		return m.new > 0
+	}
+	return m.new > m.old*(1+benchRegressionThreshold)
+}
+
+// writeBenchComparisons writes a line per metric and benchmark, with the old
+// and the new value, the delta and whether it is a regression.
+func writeBenchComparisons(w io.Writer, comparisons []benchComparison) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for i, c := range comparisons {
+		// Each package gets its own header, as lines without cells end a
+		// block of aligned columns
+		if i == 0 || c.Package != comparisons[i-1].Package {
+			if i > 0 {
+				fmt.Fprintln(tw)
+			}
+			if c.Package != "" {
+				fmt.Fprintf(tw, "pkg: %s\n", c.Package)
+			}
+			fmt.Fprintf(tw, "\t\told\tnew\tdelta\t\t\n")
+		}
+		switch {
+		case c.New == nil:
+			fmt.Fprintf(tw, "%s\tns/op\t%s\t-\t\tonly in old\t\n", c.Name, formatBenchValue(c.Old.NsPerOp))
+			continue
+		case c.Old == nil:
+			fmt.Fprintf(tw, "%s\tns/op\t-\t%s\t\tonly in new\t\n", c.Name, formatBenchValue(c.New.NsPerOp))
+			continue
+		}
+		for _, m := range c.metrics() {
+			delta := "n/a"
+			if percent, ok := m.percent(); ok {
+				delta = fmt.Sprintf("%+.2f%%", percent)
+			}
+			note := ""
+			if m.regression() {
+				note = "regression"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", c.Name, m.unit, formatBenchValue(m.old), formatBenchValue(m.new), delta, note)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatBenchValue formats a metric like go test does, without trailing zeros.
+func formatBenchValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// benchmarkResults returns the benchmark results recorded for entry.
+func benchmarkResults(entry *history.Entry) ([]model.BenchmarkResult, error) {
+	h := entry.History
+	if h.Test == nil || len(h.Test.Benchmarks) == 0 {
+		shortID := h.ID
+		if len(shortID) > 8 {
+			shortID = shortID[:8]
+		}
+		return nil, fmt.Errorf("history entry %s has no benchmark results, bench-compare requires test runs with -bench", shortID)
+	}
+	return h.Test.Benchmarks, nil
+}
+
+func (a *App) benchCompare(ctx *cli.Context) error {
+	oldArg, newArg, err := parseStatCompareArgs(ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	perfgoRoot, err := history.GetPerfgoRoot(a.outputDir)
+	if err != nil {
+		return err
+	}
+	historyEntries, err := history.LoadEntries(a.logger, perfgoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	oldEntry, err := findEntry(historyEntries, oldArg)
+	if err != nil {
+		return err
+	}
+	newEntry, err := findEntry(historyEntries, newArg)
+	if err != nil {
+		return err
+	}
+
+	oldResults, err := benchmarkResults(oldEntry)
+	if err != nil {
+		return err
+	}
+	newResults, err := benchmarkResults(newEntry)
+	if err != nil {
+		return err
+	}
+
+	writeStatCompareEntry(os.Stdout, "old", oldEntry.History)
+	writeStatCompareEntry(os.Stdout, "new", newEntry.History)
+	fmt.Println()
+	if err := writeBenchComparisons(os.Stdout, compareBenchmarks(oldResults, newResults)); err != nil {
+		return err
+	}
+	fmt.Printf("\nregression marks increases of more than %.0f%%\n", benchRegressionThreshold*100)
+	return nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareBenchmarks(t *testing.T) {
+	oldResults := []model.BenchmarkResult{
+		{Package: "example.com/a", Name: "BenchmarkFoo-8", Iterations: 1000, NsPerOp: 100, Benchmem: true, BytesPerOp: 64, AllocsPerOp: 2},
+		{Package: "example.com/a", Name: "BenchmarkRemoved-8", Iterations: 1000, NsPerOp: 50},
+		{Package: "example.com/b", Name: "BenchmarkFoo-8", Iterations: 1000, NsPerOp: 10},
+	}
+	newResults := []model.BenchmarkResult{
+		{Package: "example.com/b", Name: "BenchmarkFoo-8", Iterations: 1000, NsPerOp: 9},
+		{Package: "example.com/a", Name: "BenchmarkAdded-8", Iterations: 1000, NsPerOp: 70},
+		{Package: "example.com/a", Name: "BenchmarkFoo-8", Iterations: 1000, NsPerOp: 120, Benchmem: true, BytesPerOp: 64, AllocsPerOp: 3},
+	}
+
+	comparisons := compareBenchmarks(oldResults, newResults)
+	require.Len(t, comparisons, 4)
+
+	// Benchmarks are matched by package and name
+	assert.Equal(t, "example.com/a", comparisons[0].Package)
+	assert.Equal(t, &oldResults[0], comparisons[0].Old)
+	assert.Equal(t, &newResults[2], comparisons[0].New)
+	assert.Equal(t, "example.com/b", comparisons[2].Package)
+	assert.Equal(t, &newResults[0], comparisons[2].New)
+
+	// Benchmarks of only one run are kept
+	assert.Equal(t, "BenchmarkRemoved-8", comparisons[1].Name)
+	assert.Nil(t, comparisons[1].New)
+	assert.Equal(t, "BenchmarkAdded-8", comparisons[3].Name)
+	assert.Nil(t, comparisons[3].Old)
+
+	metrics := comparisons[0].metrics()
+	require.Len(t, metrics, 3)
+	assert.True(t, metrics[0].regression())
+	assert.False(t, metrics[1].regression())
+	assert.True(t, metrics[2].regression())
+	percent, ok := metrics[0].percent()
+	require.True(t, ok)
+	assert.InDelta(t, 20.0, percent, 1e-9)
+
+	// Without -benchmem in both runs only ns/op is compared
+	assert.Len(t, comparisons[2].metrics(), 1)
+	assert.False(t, comparisons[2].metrics()[0].regression())
+}
+
+func TestBenchMetric(t *testing.T) {
+	// Increases within the threshold are noise
+	assert.False(t, benchMetric{unit: "ns/op", old: 100, new: 104}.regression())
+	assert.True(t, benchMetric{unit: "ns/op", old: 100, new: 106}.regression())
+
+	// A new allocation is a regression without a relative change
+	m := benchMetric{unit: "allocs/op", old: 0, new: 1}
+	assert.True(t, m.regression())
+	_, ok := m.percent()
+	assert.False(t, ok)
+	assert.False(t, benchMetric{unit: "allocs/op"}.regression())
+}
+
+func TestWriteBenchComparisons(t *testing.T) {
+	comparisons := compareBenchmarks(
+		[]model.BenchmarkResult{
+			{Package: "example.com/a", Name: "BenchmarkFoo-8", NsPerOp: 100, Benchmem: true, BytesPerOp: 0, AllocsPerOp: 2},
+			{Package: "example.com/a", Name: "BenchmarkRemoved-8", NsPerOp: 50.5},
+		},
+		[]model.BenchmarkResult{
+			{Package: "example.com/a", Name: "BenchmarkFoo-8", NsPerOp: 90, Benchmem: true, BytesPerOp: 16, AllocsPerOp: 2},
+			{Package: "example.com/a", Name: "BenchmarkAdded-8", NsPerOp: 70},
+		},
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeBenchComparisons(&buf, comparisons))
+	assert.Equal(t, ""+
+		"pkg: example.com/a\n"+
+		"                                  old  new    delta             \n"+
+		"      BenchmarkFoo-8      ns/op   100   90  -10.00%             \n"+
+		"      BenchmarkFoo-8       B/op     0   16      n/a   regression\n"+
+		"      BenchmarkFoo-8  allocs/op     2    2   +0.00%             \n"+
+		"  BenchmarkRemoved-8      ns/op  50.5    -           only in old\n"+
+		"    BenchmarkAdded-8      ns/op     -   70           only in new\n",
+		buf.String())
+}
+
+func TestBenchmarkResults(t *testing.T) {
+	results := []model.BenchmarkResult{{Name: "BenchmarkFoo-8", Iterations: 100, NsPerOp: 10}}
+	entry := &history.Entry{History: model.History{
+		ID:   "0123456789abcdef",
+		Test: &model.TestRun{Benchmarks: results},
+	}}
+	got, err := benchmarkResults(entry)
+	require.NoError(t, err)
+	assert.Equal(t, results, got)
+
+	// Runs without -bench can't be compared
+	entry.History.Test.Benchmarks = nil
+	_, err = benchmarkResults(entry)
+	require.ErrorContains(t, err, "history entry 01234567 has no benchmark results")
+	entry.History.Test = nil
+	_, err = benchmarkResults(entry)
+	require.Error(t, err)
+}
@@ -5,31 +5,106 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
-	gocmd "github.com/perfgo/perfgo/cli/go"
+	"github.com/perfgo/perfgo/cli/runner"
 )
 
-func (a *App) buildTestBinary(goos, goarch string, extraArgs []string) (string, error) {
+// buildDirPattern is the pattern of the staging directories test binaries are
+// built in.
+const buildDirPattern = "perfgo-build-*"
+
+// buildTestBinary builds the test binary for the package given in extraArgs.
+// The binary is named <name>.test, or perfgo.test if name is empty, with the
+// target OS and architecture appended when cross-compiling. It is written to
+// a fresh staging directory, so concurrent runs never overwrite each other's
+// binary; callers remove it with removeTestBinary.
+func (a *App) buildTestBinary(goos, goarch, name string, extraArgs []string) (string, error) {
+	if name == "" {
+		name = "perfgo"
+	}
+
 	// Determine output binary name
-	binaryName := "./perfgo.test"
+	binaryName := fmt.Sprintf("%s.test", name)
 	if goos == "windows" {
-		binaryName = "./perfgo.test.exe"
+		binaryName += ".exe"
 	}
 	if goos != "" && goarch != "" {
-		binaryName = fmt.Sprintf("./perfgo.test.%s.%s", goos, goarch)
+		binaryName = fmt.Sprintf("%s.test.%s.%s", name, goos, goarch)
 		if goos == "windows" {
 			binaryName += ".exe"
 		}
 	}
 
+	dir, err := os.MkdirTemp("", buildDirPattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+
+	binaryPath := cleanBinaryPath(filepath.Join(dir, binaryName))
+	if err := a.buildTestBinaryTo(binaryPath, goos, goarch, extraArgs); err != nil {
+		if err := os.RemoveAll(dir); err != nil {
+			a.logger.Debug().Err(err).Str("dir", dir).Msg("Failed to clean up build directory")
+		}
+		return "", err
+	}
+	return binaryPath, nil
+}
+
+// cleanBinaryPath returns the absolute, cleaned form of path, so a binary is
+// referred to by the same path however it was spelled.
+func cleanBinaryPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// removeTestBinary removes a test binary built by buildTestBinary together
+// with its staging directory. A binary outside a staging directory is removed
+// on its own.
+func removeTestBinary(binary string) error {
+	binary = cleanBinaryPath(binary)
+	dir := filepath.Dir(binary)
+	if matched, _ := filepath.Match(buildDirPattern, filepath.Base(dir)); !matched {
+		return os.Remove(binary)
+	}
+	return os.RemoveAll(dir)
+}
+
+// buildTestBinaryTo builds the test binary at binaryName, reusing a cached
+// binary built from the same inputs when possible.
+func (a *App) buildTestBinaryTo(binaryName, goos, goarch string, extraArgs []string) error {
+
 	a.logger.Info().
 		Str("goos", goos).
 		Str("goarch", goarch).
 		Str("output", binaryName).
 		Msg("Building test binary")
 
+	// Reuse a binary built from the same inputs by an earlier run
+	var cachePath string
+	if !a.noBuildCache {
+		cachePath = a.cachedBinaryPath(goos, goarch, binaryName, extraArgs)
+	}
+	if cachePath != "" {
+		if _, err := os.Stat(cachePath); err == nil {
+			err := copyFile(cachePath, binaryName, 0o755)
+			if err == nil {
+				a.logger.Info().Str("cached", cachePath).Msg("Reusing cached test binary")
+				if err := touchCachedBinary(cachePath); err != nil {
+					a.logger.Debug().Err(err).Msg("Failed to mark cached test binary as used")
+				}
+				return nil
+			}
+			a.logger.Warn().Err(err).Msg("Failed to reuse cached test binary, rebuilding")
+		}
+	}
+
 	// Prepare the command arguments
 	args := []string{"test", "-c", "-o", binaryName}
 
@@ -39,15 +114,12 @@ func (a *App) buildTestBinary(goos, goarch string, extraArgs []string) (string,
 		a.logger.Debug().Strs("extra_args", extraArgs).Msg("Adding extra arguments to go test")
 	}
 
-	cmd := gocmd.Command(args...)
+	cmd := runner.Cmd{Name: "go", Args: args}
 
-	// Set environment for cross-compilation if needed
-	if goos != "" && goarch != "" {
-		cmd.Env = append(os.Environ(),
-			fmt.Sprintf("GOOS=%s", goos),
-			fmt.Sprintf("GOARCH=%s", goarch),
-			"CGO_ENABLED=0", // Disable CGO for easier cross-compilation
-		)
+	// Set environment for cross-compilation and --build-env if needed
+	if env := a.goBuildEnv(goos, goarch); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+		a.logger.Debug().Strs("env", env).Msg("Setting build environment")
 	}
 
 	var stdout, stderr bytes.Buffer
@@ -58,14 +130,22 @@ func (a *App) buildTestBinary(goos, goarch string, extraArgs []string) (string,
 		Str("command", cmd.String()).
 		Msg("Executing go test -c")
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to build test binary: %w (stderr: %s)", err, stderr.String())
+	if err := a.cmdRunner().Stream(context.Background(), cmd); err != nil {
+		return fmt.Errorf("failed to build test binary: %w (stderr: %s)", err, stderr.String())
 	}
 
 	// Verify the binary was created
 	if _, err := os.Stat(binaryName); err != nil {
-		return "", fmt.Errorf("test binary not found after build: %w", err)
+		return fmt.Errorf("test binary not found after build: %w", err)
+	}
+
+	if cachePath != "" {
+		if err := storeCachedBinary(binaryName, cachePath); err != nil {
+			a.logger.Warn().Err(err).Msg("Failed to cache test binary")
+		} else if err := pruneBuildCache(filepath.Dir(filepath.Dir(cachePath)), buildCacheKeep); err != nil {
+			a.logger.Warn().Err(err).Msg("Failed to prune build cache")
+		}
 	}
 
-	return binaryName, nil
+	return nil
 }
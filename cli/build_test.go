@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBuildRunner writes an empty binary for every go test -c command.
+func fakeBuildRunner(t *testing.T) *runner.Fake {
+	return &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		// go test -c -o <binary>
+		require.NoError(t, os.WriteFile(cmd.Args[3], nil, 0o755))
+		return runner.Result{}
+	}}
+}
+
+func TestBuildTestBinary_Concurrent(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+	a := &App{logger: zerolog.Nop(), runner: fakeBuildRunner(t), runState: runState{noBuildCache: true}}
+
+	const builds = 8
+	binaries := make([]string, builds)
+	var wg sync.WaitGroup
+	for i := range builds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			binary, err := a.buildTestBinary("", "", "", []string{"."})
+			assert.NoError(t, err)
+			binaries[i] = binary
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, binary := range binaries {
+		assert.Equal(t, "perfgo.test", filepath.Base(binary))
+		assert.False(t, seen[binary], "binary path %s reused", binary)
+		seen[binary] = true
+		assert.FileExists(t, binary)
+	}
+
+	// Nothing is written to the working directory
+	entries, err := os.ReadDir(".")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRemoveTestBinary(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+	a := &App{logger: zerolog.Nop(), runner: fakeBuildRunner(t), runState: runState{noBuildCache: true}}
+
+	binary, err := a.buildTestBinary("linux", "arm64", "pkg", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, "pkg.test.linux.arm64", filepath.Base(binary))
+
+	require.NoError(t, removeTestBinary(binary))
+	assert.NoDirExists(t, filepath.Dir(binary))
+}
+
+func TestBuildTestBinary_FailureRemovesBuildDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Err: errors.New("exit status 1")}
+	}}
+	a := &App{logger: zerolog.Nop(), runner: fake, runState: runState{noBuildCache: true}}
+
+	_, err := a.buildTestBinary("", "", "", []string{"."})
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCleanBinaryPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	want := filepath.Join(dir, "perfgo.test")
+
+	for _, path := range []string{"./perfgo.test", "perfgo.test", want, "sub/../perfgo.test"} {
+		assert.Equal(t, want, cleanBinaryPath(path), path)
+	}
+}
+
+func TestRemoveTestBinary_OutsideBuildDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, path := range []string{"./perfgo.test", "perfgo.test"} {
+		require.NoError(t, os.WriteFile("perfgo.test", nil, 0o755))
+		require.NoError(t, os.WriteFile("other", nil, 0o644))
+
+		// Only the binary is removed, never the directory it is in
+		require.NoError(t, removeTestBinary(path))
+		assert.NoFileExists(t, "perfgo.test")
+		assert.FileExists(t, "other")
+	}
+}
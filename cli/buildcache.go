@@ -0,0 +1,289 @@
+package cli
+
+// This file contains the cache of built test binaries in
+// .perfgo/build-cache, which skips go test -c when none of its inputs
+// changed since an earlier run.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/history"
+	"github.com/urfave/cli/v2"
+)
+
+// buildCacheDir is the directory in the perfgo root holding cached binaries.
+const buildCacheDir = "build-cache"
+
+// buildCacheKeep is the number of most recently used cache keys whose
+// binaries are kept, older ones are evicted when a binary is stored.
+const buildCacheKeep = 16
+
+// goListFields are the fields of 'go list -json' naming the files a package
+// is built from.
+const goListFields = "Dir,Standard,Module,GoFiles,CgoFiles,TestGoFiles,XTestGoFiles,CFiles,CXXFiles,HFiles,SFiles,SysoFiles,EmbedFiles"
+
+// goEnvVars are the go env variables changing the built binary beyond the
+// package files, the build flags and the build env.
+var goEnvVars = []string{
+	"GOVERSION", "GOOS", "GOARCH", "GOFLAGS", "GOEXPERIMENT", "GOAMD64", "GOARM", "GOARM64",
+	"CGO_ENABLED", "CC", "CXX", "CGO_CFLAGS", "CGO_CPPFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS", "PKG_CONFIG",
+}
+
+// noBuildCacheFlag returns the flag bypassing the build cache.
+func noBuildCacheFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "no-build-cache",
+		Usage: "Always rebuild the test binary instead of reusing one cached in .perfgo/build-cache",
+	}
+}
+
+// goListPackage is a package as printed by 'go list -json'.
+type goListPackage struct {
+	Dir      string
+	Standard bool
+	Module   *struct {
+		GoMod string
+	}
+	GoFiles, CgoFiles, TestGoFiles, XTestGoFiles []string
+	CFiles, CXXFiles, HFiles, SFiles, SysoFiles  []string
+	EmbedFiles                                   []string
+}
+
+// parseGoListFiles returns the files the packages printed by
+// 'go list -deps -json' are built from, including the go.mod of their
+// module. Standard library packages are covered by the Go version instead.
+func parseGoListFiles(output []byte) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var pkg goListPackage
+		if err := decoder.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		if pkg.Standard {
+			continue
+		}
+		if pkg.Module != nil {
+			add(pkg.Module.GoMod)
+		}
+		for _, list := range [][]string{
+			pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles, pkg.XTestGoFiles,
+			pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles, pkg.SysoFiles, pkg.EmbedFiles,
+		} {
+			for _, name := range list {
+				// Files generated by go, like the test main, are absolute
+				// paths into the go build cache
+				if !filepath.IsAbs(name) {
+					add(filepath.Join(pkg.Dir, name))
+				}
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// buildInputs are the inputs of go test -c determining the built binary.
+type buildInputs struct {
+	GoEnv string   // Output of go env for goEnvVars
+	Env   []string // Assignments added to the environment of the go command
+	Args  []string // Build flags and package
+	Files []string // Source files, sorted
+}
+
+// key returns the hash of the inputs and the contents of their files.
+func (in buildInputs) key() (string, error) {
+	h := sha256.New()
+	header, err := json.Marshal(struct {
+		GoEnv string
+		Env   []string
+		Args  []string
+	}{in.GoEnv, in.Env, in.Args})
+	if err != nil {
+		return "", err
+	}
+	h.Write(header)
+
+	for _, path := range in.Files {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash build input: %w", err)
+		}
+		fmt.Fprintf(h, "\x00%s\x00", path)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to hash build input %s: %w", path, err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goOutput runs the go command with env added to its environment and returns
+// its stdout.
+func (a *App) goOutput(env []string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := runner.Cmd{Name: "go", Args: args, Stdout: &stdout, Stderr: &stderr}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := a.cmdRunner().Stream(context.Background(), cmd); err != nil {
+		return nil, fmt.Errorf("%s failed: %w (stderr: %s)", cmd, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// buildCacheKey returns the build cache key of the test binary built for goos
+// and goarch from the build flags and package in extraArgs.
+func (a *App) buildCacheKey(goos, goarch string, extraArgs []string) (string, error) {
+	env := a.goBuildEnv(goos, goarch)
+
+	goEnv, err := a.goOutput(env, append([]string{"env"}, goEnvVars...)...)
+	if err != nil {
+		return "", err
+	}
+
+	// go list accepts the build flags of go test -c and selects files with them
+	listArgs := append([]string{"list", "-deps", "-test", "-json=" + goListFields}, extraArgs...)
+	output, err := a.goOutput(env, listArgs...)
+	if err != nil {
+		return "", err
+	}
+	files, err := parseGoListFiles(output)
+	if err != nil {
+		return "", err
+	}
+
+	return buildInputs{GoEnv: string(goEnv), Env: env, Args: extraArgs, Files: files}.key()
+}
+
+// cachedBinaryPath returns the path the test binary named name is cached at
+// in the build cache, or "" if its cache key cannot be determined.
+func (a *App) cachedBinaryPath(goos, goarch, name string, extraArgs []string) string {
+	perfgoRoot, err := history.Root(a.outputDir)
+	if err != nil {
+		a.logger.Debug().Err(err).Msg("Build cache unavailable")
+		return ""
+	}
+	key, err := a.buildCacheKey(goos, goarch, extraArgs)
+	if err != nil {
+		a.logger.Debug().Err(err).Msg("Failed to compute build cache key, building without cache")
+		return ""
+	}
+	return filepath.Join(perfgoRoot, buildCacheDir, key, filepath.Base(name))
+}
+
+// storeCachedBinary copies the built binary to cachePath. The binary is
+// renamed into place, so a concurrent run never reads a partial binary.
+func storeCachedBinary(binary, cachePath string) error {
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create build cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(cachePath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cached binary: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := copyFile(binary, tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	// CreateTemp creates the file without execute permission
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return fmt.Errorf("failed to store cached binary: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return fmt.Errorf("failed to store cached binary: %w", err)
+	}
+	return nil
+}
+
+// touchCachedBinary marks the cache entry of cachePath as recently used, so
+// it's evicted last.
+func touchCachedBinary(cachePath string) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Dir(cachePath), now, now)
+}
+
+// pruneBuildCache removes all but the keep most recently used entries of the
+// build cache in dir. An entry is used when its binary is stored or reused.
+func pruneBuildCache(dir string, keep int) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read build cache: %w", err)
+	}
+
+	type cacheEntry struct {
+		path    string
+		modTime time.Time
+	}
+	var entries []cacheEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cacheEntry{filepath.Join(dir, dirEntry.Name()), info.ModTime()})
+	}
+	if len(entries) <= keep {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.After(entries[j].modTime)
+	})
+	for _, entry := range entries[keep:] {
+		if err := os.RemoveAll(entry.path); err != nil {
+			return fmt.Errorf("failed to evict build cache entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, creating dst with perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
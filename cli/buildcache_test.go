@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGoListFiles(t *testing.T) {
+	output := []byte(`{"Dir": "/go/src/fmt", "Standard": true, "GoFiles": ["print.go"]}
+{"Dir": "/repo/pkg", "Module": {"GoMod": "/repo/go.mod"}, "GoFiles": ["b.go", "a.go"], "TestGoFiles": ["a_test.go"], "EmbedFiles": ["testdata/in.txt"]}
+{"Dir": "/repo/pkg", "Module": {"GoMod": "/repo/go.mod"}, "GoFiles": ["b.go", "a.go"], "XTestGoFiles": ["x_test.go"]}
+{"Dir": "/cache/go-build/ab", "GoFiles": ["/cache/go-build/ab/abcd-d"]}
+`)
+
+	files, err := parseGoListFiles(output)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/repo/go.mod",
+		"/repo/pkg/a.go",
+		"/repo/pkg/a_test.go",
+		"/repo/pkg/b.go",
+		"/repo/pkg/testdata/in.txt",
+		"/repo/pkg/x_test.go",
+	}, files)
+
+	_, err = parseGoListFiles([]byte("{"))
+	assert.Error(t, err)
+}
+
+// writeTestModule creates a module with a package and its test in a new
+// directory and changes into it.
+func writeTestModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/cached\n\ngo 1.24\n",
+		"a.go":      "package cached\n\nfunc A() int { return 1 }\n",
+		"a_test.go": "package cached\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func TestBuildCacheKey(t *testing.T) {
+	dir := writeTestModule(t)
+	a := &App{logger: zerolog.Nop()}
+
+	key, err := a.buildCacheKey("", "", []string{"."})
+	require.NoError(t, err)
+	require.Len(t, key, 64)
+
+	// Stable while the inputs are unchanged
+	again, err := a.buildCacheKey("", "", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	// Build flags, target and build env are part of the key
+	withTags, err := a.buildCacheKey("", "", []string{"-tags", "integration", "."})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, withTags)
+
+	cross, err := a.buildCacheKey("linux", "arm64", []string{"."})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, cross)
+
+	a.buildEnv = []string{"CGO_ENABLED=1"}
+	withEnv, err := a.buildCacheKey("", "", []string{"."})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, withEnv)
+	a.buildEnv = nil
+
+	// Changing a source file or the test invalidates the key
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package cached\n\nfunc A() int { return 2 }\n"), 0o644))
+	changed, err := a.buildCacheKey("", "", []string{"."})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b_test.go"), []byte("package cached\n"), 0o644))
+	added, err := a.buildCacheKey("", "", []string{"."})
+	require.NoError(t, err)
+	assert.NotEqual(t, changed, added)
+}
+
+func TestBuildTestBinary_Cache(t *testing.T) {
+	dir := writeTestModule(t)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// go env and go list run for real, go test -c is faked
+	builds := 0
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		if cmd.Args[0] != "test" {
+			return runner.Result{Err: runner.Default.Stream(context.Background(), cmd)}
+		}
+		builds++
+		require.NoError(t, os.WriteFile(cmd.Args[3], []byte("binary"), 0o755))
+		return runner.Result{}
+	}}
+	a := &App{logger: zerolog.Nop(), runner: fake, outputDir: filepath.Join(dir, ".perfgo")}
+
+	binary, err := a.buildTestBinary("", "", "", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, 1, builds)
+	require.NoError(t, removeTestBinary(binary))
+
+	cached, err := filepath.Glob(filepath.Join(dir, ".perfgo", buildCacheDir, "*", "perfgo.test"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+
+	// Unchanged inputs reuse the cached binary
+	binary, err = a.buildTestBinary("", "", "", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, 1, builds)
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(data))
+	info, err := os.Stat(binary)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+
+	// --no-build-cache always builds
+	a.noBuildCache = true
+	_, err = a.buildTestBinary("", "", "", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, 2, builds)
+	a.noBuildCache = false
+
+	// A changed source file builds again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package cached\n\nfunc A() int { return 2 }\n"), 0o644))
+	_, err = a.buildTestBinary("", "", "", []string{"."})
+	require.NoError(t, err)
+	assert.Equal(t, 3, builds)
+}
+
+func TestPruneBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, key := range []string{"oldest", "old", "recent", "newest"} {
+		entry := filepath.Join(dir, key)
+		require.NoError(t, os.Mkdir(entry, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(entry, "perfgo.test"), []byte("binary"), 0o755))
+		used := now.Add(time.Duration(i-4) * time.Hour)
+		require.NoError(t, os.Chtimes(entry, used, used))
+	}
+
+	// Reusing a binary keeps it in the cache
+	require.NoError(t, touchCachedBinary(filepath.Join(dir, "oldest", "perfgo.test")))
+
+	require.NoError(t, pruneBuildCache(dir, 2))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Name())
+	}
+	assert.Equal(t, []string{"newest", "oldest"}, keys)
+
+	// Caches within the limit are left alone
+	require.NoError(t, pruneBuildCache(dir, 2))
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
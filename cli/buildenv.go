@@ -0,0 +1,66 @@
+package cli
+
+// This file contains the environment of the go command building the test
+// binary, set with --cgo and --build-env.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// buildEnvFlags returns the flags setting the environment of the go command
+// building the test binary.
+func buildEnvFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "cgo",
+			Usage: "Build the test binary with cgo, also when cross-compiling (set CC with --build-env)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "build-env",
+			Usage: "Set an environment variable for building the test binary (KEY=VALUE, e.g. CC=aarch64-linux-gnu-gcc, can be repeated)",
+		},
+	}
+}
+
+// parseBuildEnv returns the --build-env assignments, with CGO_ENABLED=1
+// added for --cgo. It returns an error if both set CGO_ENABLED.
+func parseBuildEnv(values []string, cgo bool) ([]string, error) {
+	env, err := parseEnvVars("build-env", values)
+	if err != nil {
+		return nil, err
+	}
+	if !cgo {
+		return env, nil
+	}
+	if setsEnv(env, "CGO_ENABLED") {
+		return nil, fmt.Errorf("--cgo conflicts with CGO_ENABLED in --build-env, use one of them")
+	}
+	return append(env, "CGO_ENABLED=1"), nil
+}
+
+// setsEnv reports whether env assigns the variable name.
+func setsEnv(env []string, name string) bool {
+	for _, assignment := range env {
+		if strings.HasPrefix(assignment, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// goBuildEnv returns the assignments added to the environment of the go
+// command building a test binary for goos and goarch. Cross builds disable
+// cgo unless the build env sets CGO_ENABLED, as cgo needs a cross toolchain.
+func (a *App) goBuildEnv(goos, goarch string) []string {
+	var env []string
+	if goos != "" && goarch != "" {
+		env = append(env, "GOOS="+goos, "GOARCH="+goarch)
+		if !setsEnv(a.buildEnv, "CGO_ENABLED") {
+			env = append(env, "CGO_ENABLED=0")
+		}
+	}
+	return append(env, a.buildEnv...)
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuildEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		cgo     bool
+		want    []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "build env", values: []string{"CC=aarch64-linux-gnu-gcc"}, want: []string{"CC=aarch64-linux-gnu-gcc"}},
+		{name: "cgo", values: []string{"CC=clang"}, cgo: true, want: []string{"CC=clang", "CGO_ENABLED=1"}},
+		{name: "cgo conflict", values: []string{"CGO_ENABLED=0"}, cgo: true, wantErr: "--cgo conflicts"},
+		{name: "invalid", values: []string{"CC"}, wantErr: `invalid --build-env "CC"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := parseBuildEnv(tt.values, tt.cgo)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, env)
+		})
+	}
+}
+
+func TestBuildTestBinary_Env(t *testing.T) {
+	tests := []struct {
+		name     string
+		goos     string
+		goarch   string
+		buildEnv []string
+		want     []string
+	}{
+		{name: "native"},
+		{name: "native build env", buildEnv: []string{"CGO_ENABLED=1"}, want: []string{"CGO_ENABLED=1"}},
+		{name: "cross", goos: "linux", goarch: "arm64", want: []string{"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0"}},
+		{
+			name:     "cross cgo",
+			goos:     "linux",
+			goarch:   "arm64",
+			buildEnv: []string{"CC=aarch64-linux-gnu-gcc", "CGO_ENABLED=1"},
+			want:     []string{"GOOS=linux", "GOARCH=arm64", "CC=aarch64-linux-gnu-gcc", "CGO_ENABLED=1"},
+		},
+		{
+			name:     "cross toolchain without cgo",
+			goos:     "linux",
+			goarch:   "riscv64",
+			buildEnv: []string{"PKG_CONFIG=riscv64-linux-gnu-pkg-config"},
+			want:     []string{"GOOS=linux", "GOARCH=riscv64", "CGO_ENABLED=0", "PKG_CONFIG=riscv64-linux-gnu-pkg-config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("TMPDIR", t.TempDir())
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				// go test -c -o <binary>
+				require.NoError(t, os.WriteFile(cmd.Args[3], nil, 0o755))
+				return runner.Result{}
+			}}
+			a := &App{logger: zerolog.Nop(), runner: fake, runState: runState{buildEnv: tt.buildEnv, noBuildCache: true}}
+
+			_, err := a.buildTestBinary(tt.goos, tt.goarch, "", []string{"."})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, a.goBuildEnv(tt.goos, tt.goarch))
+
+			cmds := fake.Commands()
+			require.Len(t, cmds, 1)
+			if tt.want == nil {
+				// The environment is inherited unchanged
+				assert.Nil(t, cmds[0].Env)
+				return
+			}
+			environ := os.Environ()
+			assert.Equal(t, environ, cmds[0].Env[:len(environ)])
+			assert.Equal(t, tt.want, cmds[0].Env[len(environ):])
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package cli
+
+// This file contains the call graph probe of --call-graph-auto, which
+// records the test binary briefly before the actual profile to decide how
+// stacks are unwound.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/ssh"
+)
+
+// probeLocalCallGraph records a probe of binary with args in workDir and
+// returns the call graph mode to profile it with. Frame pointers are kept if
+// the probe fails.
+func (a *App) probeLocalCallGraph(recordOpts perf.RecordOptions, binary string, args []string, workDir, vendor string) string {
+	recordOpts.Binary = binary
+	recordOpts.Args = args
+
+	probeFile, err := os.CreateTemp("", "perfgo-probe-*.data")
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to create call graph probe file, using frame pointers")
+		return perf.CallGraphFP
+	}
+	probeFile.Close()
+	defer os.Remove(probeFile.Name())
+
+	a.logger.Info().Dur("duration", perf.CallGraphProbeDuration).Msg("Probing call graph depth")
+
+	// The probe interrupts the workload, so its exit status is meaningless
+	cmd := a.localTestCommand("perf", perf.BuildRecordArgs(perf.ProbeRecordOptions(recordOpts, probeFile.Name()))...)
+	cmd.Dir = workDir
+	if err := a.cmdRunner().Stream(context.Background(), cmd); err != nil {
+		a.logger.Debug().Err(err).Msg("Call graph probe exited with an error")
+	}
+
+	script, _, err := a.cmdRunner().Run(context.Background(), "perf", perf.BuildScriptArgs(probeFile.Name(), false)...)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to read call graph probe, using frame pointers")
+		return perf.CallGraphFP
+	}
+	return a.chooseCallGraph(script, vendor, recordOpts.HasBranchStack())
+}
+
+// probeRemoteCallGraph records a probe of binary with args in workDir on the
+// remote host and returns the call graph mode to profile it with. Frame
+// pointers are kept if the probe fails.
+func (a *App) probeRemoteCallGraph(client *ssh.Client, recordOpts perf.RecordOptions, binary string, args []string, workDir, remoteBaseDir, vendor string) string {
+	recordOpts.Binary = binary
+	recordOpts.Args = args
+
+	probePath := remoteBaseDir + "/perf-probe.data"
+
+	a.logger.Info().Dur("duration", perf.CallGraphProbeDuration).Msg("Probing call graph depth on remote host")
+
+	// The probe interrupts the workload, so its exit status is meaningless
+	probeCmd := a.remoteTestCommand(workDir, perf.BuildRecordCommand(perf.ProbeRecordOptions(recordOpts, probePath)))
+	if _, _, err := client.RunCommand(probeCmd); err != nil {
+		a.logger.Debug().Err(err).Msg("Call graph probe exited with an error")
+	}
+
+	scriptArgs := perf.BuildScriptArgs(probePath, false)
+	quoted := make([]string, len(scriptArgs))
+	for i, arg := range scriptArgs {
+		quoted[i] = shellescape.Quote(arg)
+	}
+	scriptCmd := fmt.Sprintf("perf %s; rc=$?; rm -f %s; exit $rc", strings.Join(quoted, " "), shellescape.Quote(probePath))
+
+	script, _, err := client.RunCommand(scriptCmd)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to read call graph probe, using frame pointers")
+		return perf.CallGraphFP
+	}
+	return a.chooseCallGraph(script, vendor, recordOpts.HasBranchStack())
+}
+
+// chooseCallGraph decides the call graph mode from the perf script output of
+// a probe.
+func (a *App) chooseCallGraph(script, vendor string, branchStack bool) string {
+	prof, err := perf.ParseScript(script)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to parse call graph probe, using frame pointers")
+		return perf.CallGraphFP
+	}
+
+	mode := perf.ChooseCallGraph(prof, vendor, branchStack)
+	logEvent := a.logger.Info()
+	if mode != perf.CallGraphFP {
+		logEvent = a.logger.Warn()
+	}
+	logEvent.
+		Int("samples", len(prof.Sample)).
+		Int("median_depth", perf.MedianStackDepth(prof)).
+		Str("call_graph", mode).
+		Msg("Selected call graph mode")
+	return mode
+}
@@ -0,0 +1,182 @@
+package cli
+
+// This file contains the discovery of the PIDs and the cgroup of a container
+// from the cgroup membership of the processes on a node, across cgroup v1 and
+// v2 and the containerd, CRI-O and docker runtimes.
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// shortContainerIDLen is the length of truncated container IDs, as printed
+// by docker and crictl. Shorter IDs are not matched to avoid false positives.
+const shortContainerIDLen = 12
+
+// cgroupScopePrefixes are the prefixes runtimes put in front of the container
+// ID in the name of its cgroup when the systemd cgroup driver is used, e.g.
+// cri-containerd-<id>.scope, crio-<id>.scope or docker-<id>.scope.
+var cgroupScopePrefixes = []string{"cri-containerd-", "crio-", "docker-", "containerd-", "libpod-"}
+
+// cgroupMonitorPrefixes are the prefixes of cgroups of container monitors,
+// whose processes are not part of the container (e.g., CRI-O's conmon).
+var cgroupMonitorPrefixes = []string{"crio-conmon-", "libpod-conmon-"}
+
+// findPIDsCommand returns the command printing the cgroup lines of all
+// processes that mention the (short) container ID, prefixed with the path of
+// their cgroup file. grep fails if nothing matches, which is not an error.
+func findPIDsCommand(containerID string) string {
+	prefix := containerID
+	if len(prefix) > shortContainerIDLen {
+		prefix = prefix[:shortContainerIDLen]
+	}
+	return fmt.Sprintf("grep -H -F -e %s /proc/[0-9]*/cgroup 2>/dev/null || true", shellescape.Quote(prefix))
+}
+
+// cgroupLine is a line of /proc/<pid>/cgroup as printed by findPIDsCommand.
+type cgroupLine struct {
+	PID         string
+	Hierarchy   string // Hierarchy ID, 0 for cgroup v2
+	Controllers string // Comma-separated controllers, empty for cgroup v2
+	Path        string // Path relative to the root of the hierarchy
+}
+
+// parseCgroupLine parses a line of
+// /proc/<pid>/cgroup:<hierarchy>:<controllers>:<path>.
+func parseCgroupLine(line string) (cgroupLine, bool) {
+	file, entry, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return cgroupLine{}, false
+	}
+	pid, ok := strings.CutPrefix(file, "/proc/")
+	if !ok {
+		return cgroupLine{}, false
+	}
+	pid, ok = strings.CutSuffix(pid, "/cgroup")
+	if !ok {
+		return cgroupLine{}, false
+	}
+	if _, err := strconv.Atoi(pid); err != nil {
+		return cgroupLine{}, false
+	}
+
+	// The path is the last field, controllers may be empty (cgroup v2)
+	fields := strings.SplitN(entry, ":", 3)
+	if len(fields) != 3 {
+		return cgroupLine{}, false
+	}
+	return cgroupLine{PID: pid, Hierarchy: fields[0], Controllers: fields[1], Path: fields[2]}, true
+}
+
+// parseCgroupPIDs returns the PIDs in numeric order whose cgroup matches
+// containerID, given the output of findPIDsCommand.
+func parseCgroupPIDs(output, containerID string) []string {
+	seen := make(map[string]bool)
+	var pids []string
+	for _, text := range strings.Split(output, "\n") {
+		line, ok := parseCgroupLine(text)
+		if !ok || seen[line.PID] || containerCgroupDepth(line.Path, containerID) < 0 {
+			continue
+		}
+		seen[line.PID] = true
+		pids = append(pids, line.PID)
+	}
+
+	sort.Slice(pids, func(i, j int) bool {
+		a, _ := strconv.Atoi(pids[i])
+		b, _ := strconv.Atoi(pids[j])
+		return a < b
+	})
+	return pids
+}
+
+// parseContainerCgroup returns the path of the cgroup of containerID for
+// perf record -G, given the output of findPIDsCommand. The path is relative
+// to the perf_event hierarchy on cgroup v1 and to the unified hierarchy on
+// cgroup v2, and ends at the cgroup named after the container, so cgroups
+// nested by the runtime below it are included.
+func parseContainerCgroup(output, containerID string) (string, bool) {
+	var unified string
+	for _, text := range strings.Split(output, "\n") {
+		line, ok := parseCgroupLine(text)
+		if !ok {
+			continue
+		}
+		depth := containerCgroupDepth(line.Path, containerID)
+		if depth < 0 {
+			continue
+		}
+		components := strings.Split(strings.Trim(line.Path, "/"), "/")
+		path := strings.Join(components[:depth+1], "/")
+
+		if slices.Contains(strings.Split(line.Controllers, ","), "perf_event") {
+			return path, true
+		}
+		if line.Hierarchy == "0" && line.Controllers == "" && unified == "" {
+			unified = path
+		}
+	}
+	return unified, unified != ""
+}
+
+// commonCgroupParent returns the deepest cgroup containing all paths, e.g.
+// the pod cgroup of the cgroups of its containers.
+func commonCgroupParent(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	common := strings.Split(paths[0], "/")
+	for _, path := range paths[1:] {
+		components := strings.Split(path, "/")
+		n := 0
+		for n < len(common) && n < len(components) && common[n] == components[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// containerCgroupDepth returns the index of the component of the cgroup path
+// (without leading slash) that names the container, either as a plain ID
+// (cgroupfs driver) or as a runtime scope (systemd driver), or -1 if none
+// does. IDs match by prefix, as either may be truncated.
+func containerCgroupDepth(path, containerID string) int {
+	containerID = strings.ToLower(containerID)
+	for i, component := range strings.Split(strings.Trim(path, "/"), "/") {
+		component = strings.TrimSuffix(component, ".scope")
+		if hasAnyPrefix(component, cgroupMonitorPrefixes) {
+			continue
+		}
+		for _, prefix := range cgroupScopePrefixes {
+			if id, ok := strings.CutPrefix(component, prefix); ok {
+				component = id
+				break
+			}
+		}
+
+		if len(component) < shortContainerIDLen || !isValidHexString(component) {
+			continue
+		}
+		component = strings.ToLower(component)
+		if strings.HasPrefix(component, containerID) || strings.HasPrefix(containerID, component) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testContainerID  = "3f4e5d6c7b8a99001122334455667788aabbccddeeff00112233445566778899"
+	otherContainerID = "9a8b7c6d5e4f00112233445566778899aabbccddeeff0011223344556677aabb"
+)
+
+func TestParseCgroupPIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name: "containerd cgroup v1 cgroupfs driver",
+			output: `/proc/4211/cgroup:12:memory:/kubepods/burstable/pod0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b/` + testContainerID + `
+/proc/4211/cgroup:11:cpu,cpuacct:/kubepods/burstable/pod0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b/` + testContainerID + `
+/proc/4230/cgroup:12:memory:/kubepods/burstable/pod0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b/` + testContainerID + `
+/proc/5120/cgroup:12:memory:/kubepods/burstable/pod0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b/` + otherContainerID,
+			want: []string{"4211", "4230"},
+		},
+		{
+			name:   "containerd cgroup v2 systemd driver",
+			output: `/proc/812/cgroup:0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0f1e2d3c_4b5a_6978_8a9b_0c1d2e3f4a5b.slice/cri-containerd-` + testContainerID + `.scope`,
+			want:   []string{"812"},
+		},
+		{
+			name: "cri-o cgroup v2 without conmon",
+			output: `/proc/9001/cgroup:0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0f1e2d3c_4b5a_6978_8a9b_0c1d2e3f4a5b.slice/crio-conmon-` + testContainerID + `.scope
+/proc/9005/cgroup:0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0f1e2d3c_4b5a_6978_8a9b_0c1d2e3f4a5b.slice/crio-` + testContainerID + `.scope
+/proc/9010/cgroup:0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0f1e2d3c_4b5a_6978_8a9b_0c1d2e3f4a5b.slice/crio-` + testContainerID + `.scope/container`,
+			want: []string{"9005", "9010"},
+		},
+		{
+			name: "docker cgroup v1 with truncated ID",
+			output: `/proc/77/cgroup:4:pids:/docker/3f4e5d6c7b8a
+/proc/78/cgroup:4:pids:/docker/3f4e5d6c7b8b`,
+			want: []string{"77"},
+		},
+		{
+			name:   "docker cgroup v2 systemd driver",
+			output: `/proc/1500/cgroup:0::/system.slice/docker-` + testContainerID + `.scope`,
+			want:   []string{"1500"},
+		},
+		{
+			name: "hybrid hierarchy and numeric order",
+			output: `/proc/10200/cgroup:1:name=systemd:/kubepods.slice/cri-containerd-` + testContainerID + `.scope
+/proc/10200/cgroup:0::/kubepods.slice/cri-containerd-` + testContainerID + `.scope
+/proc/998/cgroup:0::/kubepods.slice/cri-containerd-` + testContainerID + `.scope`,
+			want: []string{"998", "10200"},
+		},
+		{
+			name: "ID outside of a path component",
+			output: `/proc/300/cgroup:0::/user.slice/session-` + testContainerID[:12] + `.scope
+/proc/self/cgroup:0::/docker/` + testContainerID + `
+garbage`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseCgroupPIDs(tt.output, testContainerID))
+		})
+	}
+}
+
+func TestFindPIDsCommand(t *testing.T) {
+	// Truncated IDs in cgroup paths contain the short prefix of the ID
+	assert.Equal(t, "grep -H -F -e 3f4e5d6c7b8a /proc/[0-9]*/cgroup 2>/dev/null || true", findPIDsCommand(testContainerID))
+}
+
+func TestParseContainerCgroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name: "cgroup v1 perf_event hierarchy",
+			output: `/proc/4211/cgroup:12:memory:/kubepods/burstable/pod0f1e2d3c/` + testContainerID + `
+/proc/4211/cgroup:7:perf_event:/kubepods/burstable/pod0f1e2d3c/` + testContainerID + `
+/proc/4211/cgroup:0::/`,
+			want: "kubepods/burstable/pod0f1e2d3c/" + testContainerID,
+		},
+		{
+			name:   "cgroup v2 systemd driver",
+			output: `/proc/812/cgroup:0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0f1e2d3c.slice/cri-containerd-` + testContainerID + `.scope`,
+			want:   "kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0f1e2d3c.slice/cri-containerd-" + testContainerID + ".scope",
+		},
+		{
+			name: "cri-o nested container cgroup",
+			output: `/proc/9001/cgroup:0::/kubepods.slice/kubepods-pod0f1e2d3c.slice/crio-conmon-` + testContainerID + `.scope
+/proc/9010/cgroup:0::/kubepods.slice/kubepods-pod0f1e2d3c.slice/crio-` + testContainerID + `.scope/container`,
+			want: "kubepods.slice/kubepods-pod0f1e2d3c.slice/crio-" + testContainerID + ".scope",
+		},
+		{
+			name:   "not found",
+			output: `/proc/5120/cgroup:0::/kubepods.slice/cri-containerd-` + otherContainerID + `.scope`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseContainerCgroup(tt.output, testContainerID)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommonCgroupParent(t *testing.T) {
+	assert.Equal(t, "", commonCgroupParent(nil))
+	assert.Equal(t, "kubepods.slice/pod1.slice/cri-containerd-a.scope", commonCgroupParent([]string{
+		"kubepods.slice/pod1.slice/cri-containerd-a.scope",
+	}))
+	assert.Equal(t, "kubepods.slice/pod1.slice", commonCgroupParent([]string{
+		"kubepods.slice/pod1.slice/cri-containerd-a.scope",
+		"kubepods.slice/pod1.slice/cri-containerd-b.scope",
+	}))
+	assert.Equal(t, "", commonCgroupParent([]string{"kubepods/a", "system.slice/b"}))
+}
@@ -3,18 +3,22 @@ package cli
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"time"
 
+	"github.com/perfgo/perfgo/cli/cpu"
+	gocmd "github.com/perfgo/perfgo/cli/go"
 	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
 	"github.com/perfgo/perfgo/cli/ssh"
 	"github.com/perfgo/perfgo/model"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
 )
 
@@ -24,21 +28,82 @@ const defaultPerfImage = "docker.io/simonswine/perf-image@sha256:877dd618f656feb
 type App struct {
 	logger zerolog.Logger
 	cli    *cli.App
+
+	// Store archived binaries gzip compressed
+	compressBinaries bool
+
+	// Directory holding the history, overriding PERFGO_HOME and .perfgo
+	outputDir string
+
+	// Runs pprof in process for view --serve, servePprof if not set
+	servePprof func(args []string) error
+
+	// Runs local commands, runner.Default if not set
+	runner runner.Runner
+
+	// Settings of the current run, see newRun
+	runState
 }
 
-func New() *App {
+// runState holds the settings of a single run. RunTest works on a copy of
+// the App with its own runState, so an App can run tests concurrently.
+type runState struct {
+	// perf list output of each host, fetched once per run
+	perfEventLists map[string]*perf.EventList
+
+	// KEY=VALUE assignments added to the environment of the test binary
+	testEnv []string
+
+	// CPU list the test binary is pinned to (taskset -c)
+	testCPUAffinity string
+
+	// KEY=VALUE assignments added to the environment of go test -c
+	buildEnv []string
+
+	// Always build the test binary instead of using the build cache
+	noBuildCache bool
+
+	// Write the profile as folded stacks alongside the pprof profile
+	foldedStacks bool
+
+	// Additional format the profile is written in (--output)
+	profileOutput perf.OutputFormat
+
+	// Symbol files stored with a profile run (--symbols)
+	symbolFiles []symbolFile
+
+	// Archive the raw perf.data of profile, c2c and mem runs
+	keepPerfData bool
 
-	// Set default log level to info
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	// Number of times stat and profile runs execute the test (--repeat)
+	repeat int
 
-	logger :=
-		log.Output(zerolog.ConsoleWriter{
-			Out:        os.Stderr,
-			TimeFormat: time.RFC3339Nano,
-		})
+	// Clean up and exit on SIGINT and SIGTERM (TestOptions.HandleInterrupts)
+	handleSignals bool
 
+	// Cleanups of an interrupted local run, nil while interrupts aren't handled
+	interrupts *interruptCleanups
+}
+
+// newRun returns a copy of the App with an empty runState.
+func (a *App) newRun() *App {
+	run := *a
+	run.runState = runState{}
+	return &run
+}
+
+// cmdRunner returns the runner executing local commands.
+func (a *App) cmdRunner() runner.Runner {
+	if a.runner == nil {
+		return runner.Default
+	}
+	return a.runner
+}
+
+func New(opts ...Option) *App {
 	app := &App{
-		logger: logger,
+		logger: newLogger(os.Stderr, LogFormatConsole).Level(zerolog.InfoLevel),
+		runner: runner.Default,
 		cli: &cli.App{
 			Name: AppName,
 			Authors: []*cli.Author{
@@ -49,15 +114,32 @@ func New() *App {
 					Name:  "verbose",
 					Usage: "Enable verbose (debug) logging",
 				},
-			},
-			Before: func(ctx *cli.Context) error {
-				if ctx.Bool("verbose") {
-					zerolog.SetGlobalLevel(zerolog.DebugLevel)
-				}
-				return nil
+				&cli.BoolFlag{
+					Name:    "compress-binaries",
+					Usage:   "Store archived binaries gzip compressed to save disk space",
+					EnvVars: []string{"PERFGO_COMPRESS_BINARIES"},
+				},
+				&cli.StringFlag{
+					Name:  "output-dir",
+					Usage: "Directory to store the history in (default: $PERFGO_HOME, .perfgo in the git repository or current directory)",
+				},
 			},
 		},
 	}
+	app.cli.Flags = append(app.cli.Flags, logFlags()...)
+	app.cli.Before = func(ctx *cli.Context) error {
+		if err := app.configureLogging(ctx); err != nil {
+			return err
+		}
+		if err := app.loadConfigDefaults(); err != nil {
+			return err
+		}
+		app.compressBinaries = ctx.Bool("compress-binaries")
+		if dir := ctx.String("output-dir"); dir != "" {
+			app.outputDir = dir
+		}
+		return nil
+	}
 	app.cli.Commands = append(app.cli.Commands, &cli.Command{
 		Name:  "test",
 		Usage: "Run Go tests with optional perf integration",
@@ -66,80 +148,92 @@ func New() *App {
 				Name:   "default",
 				Usage:  "Run tests without perf (default behavior)",
 				Action: app.testDefault,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "remote-host",
-						Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
-					},
-					&cli.BoolFlag{
-						Name:  "keep",
-						Usage: "Keep remote artifacts (don't clean up after test execution)",
-					},
-				},
+				Flags:  testFlags(),
 			},
 			{
 				Name:   "stat",
 				Usage:  "Run tests with perf stat",
 				Action: app.testStat,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "remote-host",
-						Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
-					},
-					&cli.BoolFlag{
-						Name:  "keep",
-						Usage: "Keep remote artifacts (don't clean up after test execution)",
-					},
+				Flags: append(testFlags(
 					perf.StatEventFlag(),
 					perf.StatDetailFlag(),
-				},
+					perf.StatRepeatFlag(),
+					perf.StatPerCoreFlag(),
+					perf.StatPerSocketFlag(),
+					perf.StatPerThreadFlag(),
+					repeatFlag(),
+				), benchmarkFlags()...),
 			},
 			{
 				Name:   "profile",
 				Usage:  "Run tests with perf record and generate pprof profile",
 				Action: app.testProfile,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "remote-host",
-						Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
-					},
-					&cli.BoolFlag{
-						Name:  "keep",
-						Usage: "Keep remote artifacts (don't clean up after test execution)",
-					},
+				Flags: append(testFlags(
 					perf.ProfileEventFlag(),
+					defaultEventFlag(),
 					perf.ProfileCountFlag(),
-				},
+					perf.MaxDurationFlag(),
+					perf.BranchStackFlag(),
+					perf.BranchFilterFlag(),
+					perf.CallGraphAutoFlag(),
+					perf.FoldedFlag(),
+					perf.OutputFormatFlag(),
+					symbolsFlag(),
+					keepPerfDataFlag(),
+					perfDataInCWDFlag(),
+					perf.CopyConcurrencyFlag(),
+					perf.IncludeSystemLibsFlag(),
+					repeatFlag(),
+					watchFlag(),
+				), benchmarkFlags()...),
 			},
 			{
 				Name:    "c2c",
 				Aliases: []string{"cache-to-cache"},
 				Usage:   "Run tests with perf c2c to detect cache contention and false sharing",
 				Action:  app.testC2C,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "remote-host",
-						Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
-					},
-					&cli.BoolFlag{
-						Name:  "keep",
-						Usage: "Keep remote artifacts (don't clean up after test execution)",
-					},
-				},
+				Flags: testFlags(
+					perf.C2CEventFlag(),
+					perf.C2CCountFlag(),
+					keepPerfDataFlag(),
+					perfDataInCWDFlag(),
+				),
 			},
-		},
-		// Default action when no subcommand is specified
-		Action: app.testDefault,
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:  "remote-host",
-				Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
+			{
+				Name:   "mem",
+				Usage:  "Run tests with perf mem to analyze memory access latency",
+				Action: app.testMem,
+				Flags: testFlags(
+					perf.MemTypeFlag(),
+					perf.MemEventFlag(),
+					perf.MemLoadLatencyFlag(),
+					perf.MemSortFlag(),
+					keepPerfDataFlag(),
+					perfDataInCWDFlag(),
+				),
 			},
-			&cli.BoolFlag{
-				Name:  "keep",
-				Usage: "Keep remote artifacts (don't clean up after test execution)",
+			{
+				Name:   "cpuprofile",
+				Usage:  "Run tests with Go's CPU profiler (-test.cpuprofile) and store the pprof profile, for hosts without perf",
+				Action: app.testCPUProfile,
+				Flags: append(testFlags(
+					perf.FoldedFlag(),
+					perf.OutputFormatFlag(),
+					watchFlag(),
+				), benchmarkFlags()...),
+			},
+			{
+				Name:   "mprofile",
+				Usage:  "Run tests with Go's memory profiler (-test.memprofile) and store the allocation profile, without perf",
+				Action: app.testMProfile,
+				Flags: append(testFlags(
+					memProfileRateFlag(),
+				), benchmarkFlags()...),
 			},
 		},
+		// Default action when no subcommand is specified
+		Action: app.testDefault,
+		Flags:  testFlags(),
 	})
 	app.cli.Commands = append(app.cli.Commands, &cli.Command{
 		Name:   "list",
@@ -151,18 +245,32 @@ func New() *App {
 				Aliases: []string{"p"},
 				Usage:   "Filter by relative path (e.g., examples/false-sharing)",
 			},
+			&cli.StringFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Usage:   "Filter by run type (test or attach)",
+			},
 			&cli.IntFlag{
 				Name:    "limit",
 				Aliases: []string{"n"},
 				Usage:   "Limit number of results (default: 20)",
 				Value:   20,
 			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Usage: "Sort by time, duration, exit (failed first) or size (of the artifacts)",
+				Value: "time",
+			},
+			&cli.BoolFlag{
+				Name:  "reverse",
+				Usage: "Reverse the sort order, e.g. oldest or fastest runs first",
+			},
 		},
 	})
 	app.cli.Commands = append(app.cli.Commands, &cli.Command{
 		Name:            "view",
 		Usage:           "View test results from history",
-		ArgsUsage:       "[ID|INDEX]",
+		ArgsUsage:       "[--folded|--serve|--perf-report] [--tid TID] [--comm COMM] [ID|INDEX]",
 		Action:          app.view,
 		SkipFlagParsing: true,
 		Description: `View test results from history.
@@ -172,18 +280,144 @@ Arguments:
   -1          View 2nd last test run
   -2          View 3rd last test run
   <hex-id>    View test run matching the hex ID prefix
+  commit:<sha>
+              View newest test run of the commit matching the sha prefix
+  branch:<name>
+              View newest test run on the branch
+  --folded    Print the folded stacks of a run profiled with --folded
+  --serve     Open the profile in the pprof web UI built into perfgo, without go tool pprof
+  --perf-report
+              Open the perf.data of a run recorded with --keep-perf-data in perf report
+  --tid <tid> Only show the samples of the thread with this ID
+  --comm <name>
+              Only show the samples of threads with this command name
 
 Examples:
   perfgo view           # View last test run
   perfgo view -1        # View 2nd last test run
   perfgo view -2        # View 3rd last test run
   perfgo view abc123    # View test run with ID starting with abc123
+  perfgo view commit:1a2b3c    # View newest test run of commit 1a2b3c
+  perfgo view branch:main      # View newest test run on main
+  perfgo view --folded | flamegraph.pl > flame.svg
+  perfgo view --serve -1 -http=:8080
+  perfgo view --perf-report -1 -- --sort=dso
+  perfgo view --tid 4242 -1 -top
 
 Display Priority:
   1. Protobuf profiles (perf.pb.gz)
   2. Perf stat outputs
-  3. Test stdout/stderr
-  4. Binaries (not displayed, only listed)`,
+  3. Perf c2c and mem reports
+  4. Test stdout/stderr
+  5. Binaries (not displayed, only listed)`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:            "open",
+		Usage:           "Open the profile of a run from history in the pprof web UI",
+		ArgsUsage:       "[ID|INDEX] [pprof flags]",
+		Action:          app.open,
+		SkipFlagParsing: true,
+		Description: `Serve the profile of a run in the pprof web UI built into perfgo on a
+free local port, and open it in the browser.
+
+Examples:
+  perfgo open                    # Open the profile of the last run
+  perfgo open -1                 # Open the profile of the 2nd last run
+  perfgo open abc123 -no_browser # Only print the URL of run abc123
+  perfgo open 0 -http=:8080      # Serve on port 8080`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:            "annotate",
+		Usage:           "Print annotated source of functions in a profile from history",
+		ArgsUsage:       "[ID|INDEX] <func-regexp>",
+		Action:          app.annotate,
+		SkipFlagParsing: true,
+		Description: `Print the source of all functions matching the regexp, annotated with
+their sampled costs, using the binaries archived with the run.
+
+Examples:
+  perfgo annotate 'main\.work'         # Annotate functions of the last run
+  perfgo annotate -1 'Benchmark.*'     # Annotate functions of the 2nd last run
+  perfgo annotate abc123 'pkg\.Func'   # Annotate functions of run abc123`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:      "export",
+		Usage:     "Export a run from history with its profile and binaries as a tarball",
+		ArgsUsage: "<ID|INDEX> <out.tar.gz>",
+		Action:    app.export,
+		Description: `Bundle the metadata and artifacts of a run, including the binaries needed
+to symbolize its profile, into a tarball that 'perfgo import' unpacks.
+
+Examples:
+  perfgo export 0 run.tar.gz         # Export the last run
+  perfgo export abc123 run.tar.gz    # Export run abc123`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:      "import",
+		Usage:     "Import a run exported with 'perfgo export' into history",
+		ArgsUsage: "<in.tar.gz>",
+		Action:    app.importRun,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:            "stat-compare",
+		Usage:           "Compare the perf stat counters of two runs recorded with --repeat",
+		ArgsUsage:       "[OLD] [NEW]",
+		Action:          app.statCompare,
+		SkipFlagParsing: true,
+		Description: `Compare the mean of each perf stat counter of two runs recorded with
+'perfgo test stat --repeat N'. Deltas are tested with Welch's t-test and
+shown as ~ if they are not significant (p >= 0.05).
+
+Examples:
+  perfgo stat-compare                  # Compare the 2nd last with the last run
+  perfgo stat-compare -2               # Compare the 3rd last with the last run
+  perfgo stat-compare abc123 def456    # Compare run abc123 with run def456`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:            "bench-compare",
+		Usage:           "Compare the Go benchmark results of two runs",
+		ArgsUsage:       "[OLD] [NEW]",
+		Action:          app.benchCompare,
+		SkipFlagParsing: true,
+		Description: `Compare ns/op, and B/op and allocs/op of runs with -benchmem, of the
+benchmarks of two runs. Benchmarks are matched by package and name, increases
+of more than 5% are flagged as regressions.
+
+Examples:
+  perfgo bench-compare                  # Compare the 2nd last with the last run
+  perfgo bench-compare -2               # Compare the 3rd last with the last run
+  perfgo bench-compare abc123 def456    # Compare run abc123 with run def456`,
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:   "events",
+		Usage:  "List the perf events available locally or on a remote host, marking the recommended ones as supported or not",
+		Action: app.listEvents,
+		Flags:  eventsFlags(),
+	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:   "doctor",
+		Usage:  "Check that perf and the other prerequisites are set up locally and on a remote host",
+		Action: app.doctor,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "remote-host",
+				Usage: "SSH host to check in addition to the local machine",
+			},
+			&cli.IntFlag{
+				Name:  "ssh-port",
+				Usage: "SSH port of the remote host",
+			},
+			&cli.StringFlag{
+				Name:  "ssh-user",
+				Usage: "SSH login user for the remote host (overrides user@ in --remote-host)",
+			},
+			&cli.StringFlag{
+				Name:  "ssh-jump",
+				Usage: "Bastion host(s) to reach the remote host through (ssh -J syntax)",
+			},
+			sshPersistFlag(),
+			commandTimeoutFlag(),
+		},
 	})
 	app.cli.Commands = append(app.cli.Commands, &cli.Command{
 		Name:  "attach",
@@ -193,131 +427,307 @@ Display Priority:
 				Name:   "stat",
 				Usage:  "Run perf stat on a pod or node",
 				Action: app.attachStat,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "context",
-						Usage: "Kubernetes context to use",
-					},
-					&cli.StringFlag{
-						Name:  "pod",
-						Usage: "Pod name to attach to (mutually exclusive with --node)",
-					},
-					&cli.StringFlag{
-						Name:  "node",
-						Usage: "Node name to attach to (mutually exclusive with --pod)",
-					},
-					&cli.StringFlag{
-						Name:    "namespace",
-						Aliases: []string{"n"},
-						Usage:   "Kubernetes namespace (for pods, default: default)",
-					},
+				Flags: attachFlags(
 					perf.StatEventFlag(),
 					perf.StatDetailFlag(),
-					&cli.StringFlag{
-						Name:  "perf-image",
-						Usage: "Container image for running perf",
-						Value: defaultPerfImage,
-					},
+					perf.StatPerCoreFlag(),
+					perf.StatPerSocketFlag(),
+					perf.StatPerThreadFlag(),
 					perf.DurationFlag(),
-				},
+				),
 			},
 			{
 				Name:   "profile",
 				Usage:  "Run perf record on a pod or node and generate pprof profile",
 				Action: app.attachProfile,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "context",
-						Usage: "Kubernetes context to use",
-					},
-					&cli.StringFlag{
-						Name:  "pod",
-						Usage: "Pod name to attach to (mutually exclusive with --pod)",
-					},
-					&cli.StringFlag{
-						Name:  "node",
-						Usage: "Node name to attach to (mutually exclusive with --pod)",
-					},
-					&cli.StringFlag{
-						Name:    "namespace",
-						Aliases: []string{"n"},
-						Usage:   "Kubernetes namespace (for pods, default: default)",
-					},
+				Flags: attachFlags(
 					perf.ProfileEventFlag(),
+					defaultEventFlag(),
 					perf.ProfileCountFlag(),
-					&cli.StringFlag{
-						Name:  "perf-image",
-						Usage: "Container image for running perf",
-						Value: defaultPerfImage,
-					},
+					perf.BranchStackFlag(),
+					perf.BranchFilterFlag(),
+					perf.CgroupFlag(),
 					perf.DurationFlag(),
-				},
+					perf.FoldedFlag(),
+					perf.OutputFormatFlag(),
+					symbolsFlag(),
+					keepPerfDataFlag(),
+					perf.CopyConcurrencyFlag(),
+					perf.IncludeSystemLibsFlag(),
+				),
 			},
 			{
 				Name:    "c2c",
 				Aliases: []string{"cache-to-cache"},
 				Usage:   "Run perf c2c on a pod or node to detect cache contention",
 				Action:  app.attachC2C,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "context",
-						Usage: "Kubernetes context to use",
-					},
-					&cli.StringFlag{
-						Name:  "pod",
-						Usage: "Pod name to attach to (mutually exclusive with --node)",
-					},
-					&cli.StringFlag{
-						Name:  "node",
-						Usage: "Node name to attach to (mutually exclusive with --pod)",
-					},
-					&cli.StringFlag{
-						Name:    "namespace",
-						Aliases: []string{"n"},
-						Usage:   "Kubernetes namespace (for pods, default: default)",
-					},
-					&cli.StringFlag{
-						Name:  "perf-image",
-						Usage: "Container image for running perf",
-						Value: defaultPerfImage,
-					},
+				Flags: attachFlags(
+					perf.C2CEventFlag(),
+					perf.C2CCountFlag(),
 					perf.DurationFlag(),
-				},
+					keepPerfDataFlag(),
+				),
+			},
+			{
+				Name:   "mem",
+				Usage:  "Run perf mem on a pod or node to analyze memory access latency",
+				Action: app.attachMem,
+				Flags: attachFlags(
+					perf.MemTypeFlag(),
+					perf.MemEventFlag(),
+					perf.MemLoadLatencyFlag(),
+					perf.MemSortFlag(),
+					perf.DurationFlag(),
+					keepPerfDataFlag(),
+				),
 			},
 			{
 				Name:   "shell",
 				Usage:  "Open an interactive shell in a privileged pod on the same node as the target pod",
 				Action: app.attachShell,
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:  "context",
-						Usage: "Kubernetes context to use",
-					},
-					&cli.StringFlag{
-						Name:  "pod",
-						Usage: "Pod name to attach to (mutually exclusive with --node)",
-					},
-					&cli.StringFlag{
-						Name:  "node",
-						Usage: "Node name to attach to (mutually exclusive with --pod)",
-					},
-					&cli.StringFlag{
-						Name:    "namespace",
-						Aliases: []string{"n"},
-						Usage:   "Kubernetes namespace (for pods, default: default)",
-					},
-					&cli.StringFlag{
-						Name:  "perf-image",
-						Usage: "Container image for running perf",
-						Value: defaultPerfImage,
-					},
-				},
+				Flags:  attachFlags(),
 			},
 		},
 	})
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:  "system",
+		Usage: "Run perf on all CPUs of this machine or a remote host for a fixed duration",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "stat",
+				Usage:  "Run perf stat on all CPUs",
+				Action: app.systemStat,
+				Flags: systemFlags(
+					perf.StatEventFlag(),
+					perf.StatDetailFlag(),
+					perf.StatPerCoreFlag(),
+					perf.StatPerSocketFlag(),
+				),
+			},
+			{
+				Name:   "profile",
+				Usage:  "Run perf record on all CPUs and generate pprof profile",
+				Action: app.systemProfile,
+				Flags: systemFlags(
+					perf.ProfileEventFlag(),
+					defaultEventFlag(),
+					perf.ProfileCountFlag(),
+					perf.BranchStackFlag(),
+					perf.BranchFilterFlag(),
+					perf.FoldedFlag(),
+					perf.OutputFormatFlag(),
+					symbolsFlag(),
+					keepPerfDataFlag(),
+				),
+			},
+		},
+	})
+	for _, opt := range opts {
+		opt(app)
+	}
 	return app
 }
 
+// testFlags returns the flags shared by all test subcommands, followed by the
+// given mode-specific flags.
+func testFlags(extra ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "remote-host",
+			Usage: "SSH host to run tests on (will auto-detect OS and architecture)",
+		},
+		matrixFlag(),
+		&cli.BoolFlag{
+			Name:  "keep",
+			Usage: "Keep remote artifacts (don't clean up after test execution) and the intermediate files of interrupted local runs",
+		},
+		&cli.IntFlag{
+			Name:  "ssh-port",
+			Usage: "SSH port of the remote host",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-user",
+			Usage: "SSH login user for the remote host (overrides user@ in --remote-host)",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-jump",
+			Usage: "Bastion host(s) to reach the remote host through (ssh -J syntax)",
+		},
+		sshPersistFlag(),
+		&cli.StringFlag{
+			Name:  "remote-shared-path",
+			Usage: "Directory mounted under the same path locally and on the remote host (e.g., NFS), binaries and artifacts placed there are not copied",
+		},
+		&cli.StringFlag{
+			Name:  "remote-cache-dir",
+			Usage: "Cache directory on the remote host holding the synced repositories (default: $" + ssh.EnvRemoteCache + ", else $XDG_CACHE_HOME/perfgo on the remote host)",
+		},
+		commandTimeoutFlag(),
+		&cli.StringSliceFlag{
+			Name:  "env",
+			Usage: "Set an environment variable for the test binary (KEY=VALUE, can be repeated)",
+		},
+		&cli.IntFlag{
+			Name:  "gomaxprocs",
+			Usage: "Set GOMAXPROCS for the test binary",
+		},
+		cpuAffinityFlag("Pin the test binary to the given CPUs using taskset (e.g., 0-3,8)"),
+		metricsOutFlag(),
+	}
+	flags = append(flags, buildEnvFlags()...)
+	flags = append(flags, noBuildCacheFlag())
+	flags = append(flags, syncFlags()...)
+	return append(flags, extra...)
+}
+
+// benchmarkFlags returns the convenience flags for running benchmarks, which
+// are translated into the corresponding -test.* runtime arguments.
+func benchmarkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "bench",
+			Usage: "Run benchmarks matching the regexp (adds -test.bench)",
+		},
+		&cli.StringFlag{
+			Name:  "benchtime",
+			Usage: "Run each benchmark for the duration or count, e.g. 10s or 1000x (adds -test.benchtime)",
+		},
+		&cli.BoolFlag{
+			Name:  "benchmem",
+			Usage: "Report memory allocations for benchmarks (adds -test.benchmem)",
+		},
+	}
+}
+
+// attachFlags returns the flags shared by all attach subcommands, followed by
+// the given mode-specific flags.
+func attachFlags(extra ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "context",
+			Usage: "Kubernetes context to use",
+		},
+		&cli.StringFlag{
+			Name:  "kubeconfig",
+			Usage: "Path of the kubeconfig file kubectl uses (default: $KUBECONFIG, ~/.kube/config or the service account when running in a pod)",
+		},
+		&cli.StringFlag{
+			Name:  "pod",
+			Usage: "Pod name to attach to (mutually exclusive with --node and --selector)",
+		},
+		&cli.StringFlag{
+			Name:  "node",
+			Usage: "Node name to attach to (mutually exclusive with --pod and --selector)",
+		},
+		&cli.StringFlag{
+			Name:    "selector",
+			Aliases: []string{"l"},
+			Usage:   "Label selector of the pod to attach to, e.g. app=foo (mutually exclusive with --pod and --node)",
+		},
+		&cli.StringFlag{
+			Name:  "remote-host",
+			Usage: "SSH host to attach to without Kubernetes, the processes are selected by --pid or --process",
+		},
+		&cli.StringSliceFlag{
+			Name:  "pid",
+			Usage: "PID of a process on --remote-host to attach to (can be repeated or comma separated)",
+		},
+		&cli.StringFlag{
+			Name:  "process",
+			Usage: "Attach to the processes on --remote-host with this name, matched exactly like pgrep -x",
+		},
+		&cli.IntFlag{
+			Name:  "ssh-port",
+			Usage: "SSH port of the remote host",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-user",
+			Usage: "SSH login user for the remote host (overrides user@ in --remote-host)",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-jump",
+			Usage: "Bastion host(s) to reach the remote host through (ssh -J syntax)",
+		},
+		sshPersistFlag(),
+		&cli.BoolFlag{
+			Name:  "first",
+			Usage: "Attach to the first running pod by name if --selector matches several",
+		},
+		&cli.BoolFlag{
+			Name:  "include-init",
+			Usage: "Also attach to the running init containers of the pod, e.g. sidecars",
+		},
+		&cli.StringFlag{
+			Name:    "namespace",
+			Aliases: []string{"n"},
+			Usage:   "Kubernetes namespace (for pods, default: default)",
+		},
+		&cli.StringFlag{
+			Name:  "perf-image",
+			Usage: "Container image for running perf",
+			Value: defaultPerfImage,
+		},
+		sshdPathFlag(),
+		commandTimeoutFlag(),
+		cpuAffinityFlag("Pin the attached processes to the given CPUs using taskset (e.g., 0-3,8) during the run, their previous affinity is restored afterwards"),
+	}
+	return append(flags, extra...)
+}
+
+// commandTimeoutFlag returns the flag bounding how long auxiliary remote commands may run.
+func commandTimeoutFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "command-timeout",
+		Usage: "Abort remote helper commands (setup, perf script and reports, copies) that take longer than this (0 disables)",
+	}
+}
+
+// sshPersistFlag returns the flag setting how long the SSH master connection
+// is kept open for reuse by later invocations.
+func sshPersistFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "ssh-persist",
+		Usage: "Keep the SSH master connection open this long after perfgo exits, so later runs against the same host reuse it (0 closes it on exit)",
+		Value: ssh.DefaultControlPersist,
+	}
+}
+
+// copyOptions builds the options for copying binaries back from the remote
+// host from the profile flags.
+func copyOptions(ctx *cli.Context) perf.CopyOptions {
+	return perf.CopyOptions{
+		Concurrency:       ctx.Int("copy-concurrency"),
+		IncludeSystemLibs: ctx.Bool("include-system-libs"),
+	}
+}
+
+// sshOptions builds the SSH client options from the connection flags.
+func (a *App) sshOptions(ctx *cli.Context) []ssh.SSHOption {
+	opts := []ssh.SSHOption{ssh.WithProgress(os.Stderr)}
+	if port := ctx.Int("ssh-port"); port != 0 {
+		opts = append(opts, ssh.WithPort(port))
+	}
+	if user := ctx.String("ssh-user"); user != "" {
+		opts = append(opts, ssh.WithUser(user))
+	}
+	if jump := ctx.String("ssh-jump"); jump != "" {
+		opts = append(opts, ssh.WithProxyJump(jump))
+	}
+	if ctx.IsSet("ssh-persist") {
+		opts = append(opts, ssh.WithControlPersist(ctx.Duration("ssh-persist")))
+	}
+	if timeout := ctx.Duration("command-timeout"); timeout > 0 {
+		opts = append(opts, ssh.WithCommandTimeout(timeout))
+	}
+	if shared := ctx.String("remote-shared-path"); shared != "" {
+		opts = append(opts, ssh.WithSharedPath(shared))
+	}
+	if cacheDir := ssh.ResolveRemoteCacheDir(ctx.String("remote-cache-dir"), os.Getenv(ssh.EnvRemoteCache)); cacheDir != "" {
+		opts = append(opts, ssh.WithRemoteCacheDir(cacheDir))
+	}
+	return opts
+}
+
 func (a *App) Run(args []string) error {
 	return a.cli.Run(args)
 }
@@ -346,46 +756,299 @@ func (a *App) testC2C(ctx *cli.Context) error {
 	return a.runTest(ctx, "c2c")
 }
 
+func (a *App) testMem(ctx *cli.Context) error {
+	return a.runTest(ctx, "mem")
+}
+
+func (a *App) testMProfile(ctx *cli.Context) error {
+	return a.runTest(ctx, "mprofile")
+}
+
+func (a *App) testCPUProfile(ctx *cli.Context) error {
+	return a.runTest(ctx, "cpuprofile")
+}
+
+// memHistory returns the perf mem options to store in the history.
+func memHistory(memOpts perf.MemOptions, reportOpts perf.MemReportOptions) *model.PerfMem {
+	return &model.PerfMem{
+		Type:        memOpts.Type,
+		Event:       memOpts.Event,
+		LoadLatency: memOpts.LoadLatency,
+		Duration:    memOpts.Duration,
+		ReportMode:  reportOpts.Mode,
+		Sort:        reportOpts.Sort,
+	}
+}
+
 func (a *App) runTest(ctx *cli.Context, perfMode string) error {
+	if err := validateFlags(ctx); err != nil {
+		return err
+	}
+
+	opts := TestOptions{
+		Mode:         perfMode,
+		Args:         ctx.Args().Slice(),
+		RemoteHost:   ctx.String("remote-host"),
+		Keep:         ctx.Bool("keep"),
+		KeepPerfData: ctx.Bool("keep-perf-data"),
+		// perfgo owns the process, so it may exit on Ctrl-C
+		HandleInterrupts: true,
+		Env:              ctx.StringSlice("env"),
+		GOMAXPROCS:       ctx.Int("gomaxprocs"),
+		BuildEnv:         ctx.StringSlice("build-env"),
+		CGO:              ctx.Bool("cgo"),
+		NoBuildCache:     ctx.Bool("no-build-cache"),
+		CPUAffinity:      ctx.String("cpu-affinity"),
+		Bench:            ctx.String("bench"),
+		Benchtime:        ctx.String("benchtime"),
+		Benchmem:         ctx.Bool("benchmem"),
+		PerfDataInCWD:    ctx.Bool("perf-data-in-cwd"),
+		MetricsOut:       ctx.String("metrics-out"),
+		Copy:             copyOptions(ctx),
+	}
+
+	if perfMode == "profile" {
+		opts.Event = ctx.String("event")
+		opts.Count = ctx.Int("count")
+		opts.MaxDuration = ctx.Duration("max-duration")
+		opts.BranchStack = ctx.Bool("branch-stack")
+		opts.BranchFilter = ctx.String("branch-filter")
+		opts.CallGraphAuto = ctx.Bool("call-graph-auto")
+		opts.DefaultEvent = ctx.String("default-event")
+		opts.Folded = ctx.Bool("folded")
+		output, err := perf.ParseOutputFormat(ctx.String("output"))
+		if err != nil {
+			return err
+		}
+		opts.Output = output
+		opts.Repeat = ctx.Int("repeat")
+		opts.Symbols = ctx.StringSlice("symbols")
+	} else if perfMode == "stat" {
+		opts.Events = ctx.StringSlice("event")
+		opts.Detail = ctx.Bool("detail")
+		opts.Repeat = ctx.Int("repeat")
+		opts.Aggregation = perf.StatAggregation{
+			PerCore:   ctx.Bool("per-core"),
+			PerSocket: ctx.Bool("per-socket"),
+			PerThread: ctx.Bool("per-thread"),
+		}
+		opts.PerfRepeat = ctx.Int("perf-repeat")
+	} else if perfMode == "c2c" {
+		opts.C2CEvent = ctx.String("c2c-event")
+		opts.C2CCount = ctx.Int("c2c-count")
+	} else if perfMode == "mem" {
+		opts.Mem = perf.MemOptions{
+			Type:        ctx.String("mem-type"),
+			Event:       ctx.String("mem-event"),
+			LoadLatency: ctx.Int("ldlat"),
+		}
+		opts.MemSort = ctx.String("mem-sort")
+	} else if perfMode == "mprofile" {
+		opts.MemProfileRate = ctx.Int("memprofile-rate")
+	} else if perfMode == "cpuprofile" {
+		opts.Folded = ctx.Bool("folded")
+		output, err := perf.ParseOutputFormat(ctx.String("output"))
+		if err != nil {
+			return err
+		}
+		opts.Output = output
+	}
+
+	syncOpts, err := a.syncOptions(ctx)
+	if err != nil {
+		return err
+	}
+	opts.Sync = syncOpts
+	matrix, err := parseMatrix(ctx.StringSlice("matrix"))
+	if err != nil {
+		return err
+	}
+	if shared := ctx.String("remote-shared-path"); shared != "" {
+		if !filepath.IsAbs(shared) {
+			return fmt.Errorf("--remote-shared-path must be an absolute path, got %q", shared)
+		}
+	}
+	// A remote-host from .perfgo.yaml is replaced by the targets
+	if len(matrix) > 0 {
+		opts.RemoteHost = ""
+	}
+	if opts.RemoteHost != "" || hasMatrixHost(matrix) {
+		opts.SSH = a.sshOptions(ctx)
+	}
+
+	if ctx.Bool("watch") {
+		return a.watchTest(opts)
+	}
+	if len(matrix) > 0 {
+		_, err = a.runMatrix(opts, matrix)
+		return err
+	}
+	_, err = a.RunTest(opts)
+	return err
+}
+
+// RunTest builds and runs the tests of opts.Args, optionally under perf, and
+// records the run in the history. The result is returned once the history is
+// recorded, also when the test run failed.
+func (a *App) RunTest(opts TestOptions) (*TestResult, error) {
+	return a.newRun().runTestOptions(opts)
+}
+
+// runTestOptions runs the tests of opts, setting up the runState of a from
+// the options.
+func (a *App) runTestOptions(opts TestOptions) (result *TestResult, err error) {
 	startTime := time.Now()
 
-	remoteHost := ctx.String("remote-host")
-	keepArtifacts := ctx.Bool("keep")
+	perfMode := opts.Mode
+	remoteHost := opts.RemoteHost
+	keepArtifacts := opts.Keep
+	a.keepPerfData = opts.KeepPerfData
+	a.handleSignals = opts.HandleInterrupts
 
 	var perfEvent string
 	var perfCount int
 	var perfEvents []string
 	var perfDetail bool
+	var statAggregation perf.StatAggregation
+	var perfRepeat int
 	var c2cEvent string
 	var c2cCount int
 	var c2cReportMode string
 	var c2cShowAll bool
-
-	if perfMode == "profile" {
-		perfEvent = ctx.String("event")
-		perfCount = ctx.Int("count")
-	} else if perfMode == "stat" {
-		perfEvents = ctx.StringSlice("event")
-		perfDetail = ctx.Bool("detail")
-	} else if perfMode == "c2c" {
+	var memOpts perf.MemOptions
+	var memReportOpts perf.MemReportOptions
+	var memProfileRate int
+
+	var maxDuration time.Duration
+	var branchStack bool
+	var branchFilter string
+	var callGraphAuto bool
+	var defaultEvent string
+
+	switch perfMode {
+	case "":
+	case "profile":
+		perfEvent = opts.Event
+		perfCount = opts.Count
+		maxDuration = opts.MaxDuration
+		branchStack = opts.BranchStack
+		branchFilter = opts.BranchFilter
+		callGraphAuto = opts.CallGraphAuto
+		defaultEvent = opts.DefaultEvent
+		a.foldedStacks = opts.Folded
+		a.profileOutput = opts.Output
+		a.repeat = opts.Repeat
+		symbolFiles, err := parseSymbolFiles(opts.Symbols)
+		if err != nil {
+			return nil, err
+		}
+		a.symbolFiles = symbolFiles
+	case "stat":
+		perfEvents = opts.Events
+		perfDetail = opts.Detail
+		a.repeat = opts.Repeat
+		statAggregation = opts.Aggregation
+		if err := statAggregation.Validate(); err != nil {
+			return nil, err
+		}
+		perfRepeat = opts.PerfRepeat
+		if perfRepeat < 0 {
+			return nil, fmt.Errorf("invalid --perf-repeat %d: must not be negative", perfRepeat)
+		}
+	case "c2c":
+		c2cEvent = opts.C2CEvent
+		c2cCount = opts.C2CCount
 		// Use default values for c2c
 		c2cReportMode = "stdio"
 		c2cShowAll = false
+	case "mem":
+		memOpts = opts.Mem
+		memReportOpts = perf.MemReportOptions{
+			Mode: "stdio",
+			Sort: opts.MemSort,
+		}
+		if err := perf.ValidateMemType(memOpts.Type); err != nil {
+			return nil, err
+		}
+	case "cpuprofile":
+		a.foldedStacks = opts.Folded
+		a.profileOutput = opts.Output
+	case "mprofile":
+		memProfileRate = opts.MemProfileRate
+		if memProfileRate < 0 {
+			return nil, fmt.Errorf("invalid --memprofile-rate %d: must not be negative", memProfileRate)
+		}
+	default:
+		return nil, fmt.Errorf("unknown perf mode %q", perfMode)
+	}
+	if err := validateModeOptions(opts); err != nil {
+		return nil, err
+	}
+
+	testEnv, err := parseEnvVars("env", opts.Env)
+	if err != nil {
+		return nil, err
+	}
+	gomaxprocs := opts.GOMAXPROCS
+	a.testEnv, err = gomaxprocsEnv(testEnv, gomaxprocs)
+	if err != nil {
+		return nil, err
+	}
+	a.buildEnv, err = parseBuildEnv(opts.BuildEnv, opts.CGO)
+	if err != nil {
+		return nil, err
+	}
+	a.noBuildCache = opts.NoBuildCache
+	cpuAffinity := opts.CPUAffinity
+	if cpuAffinity != "" {
+		if err := validateCPUList(cpuAffinity); err != nil {
+			return nil, err
+		}
+	}
+
+	if perfMode == "profile" || perfMode == "stat" {
+		if err := validateRepeat(a.repeat); err != nil {
+			return nil, err
+		}
+	}
+
+	if maxDuration > 0 && remoteHost != "" {
+		return nil, fmt.Errorf("--max-duration is only supported for local runs")
+	}
+
+	// Local runs may cross-compile, e.g. for a --matrix target
+	localOS, localArch := runtime.GOOS, runtime.GOARCH
+	var buildOS, buildArch string
+	if opts.GOOS != "" || opts.GOARCH != "" {
+		if remoteHost != "" {
+			return nil, fmt.Errorf("a GOOS/GOARCH target runs locally, it can't be combined with a remote host")
+		}
+		if opts.GOOS == "" || opts.GOARCH == "" {
+			return nil, fmt.Errorf("GOOS and GOARCH must be given together")
+		}
+		localOS, localArch = opts.GOOS, opts.GOARCH
+		buildOS, buildArch = opts.GOOS, opts.GOARCH
 	}
 
-	// Get additional arguments passed after flags (or after --)
-	testArgs := ctx.Args().Slice()
+	// Events given explicitly are checked against perf list before building.
+	// c2c events are memory event names (perf c2c record -e list), which perf
+	// list doesn't show.
+	events := append(requestedEvents(perfEvent), perfEvents...)
+
+	// Package path followed by additional arguments
+	testArgs := append([]string(nil), opts.Args...)
 
 	// Generate random 16-byte ID
 	idBytes := make([]byte, 16)
 	if _, err := rand.Read(idBytes); err != nil {
-		return fmt.Errorf("failed to generate test run ID: %w", err)
+		return nil, fmt.Errorf("failed to generate test run ID: %w", err)
 	}
 	runID := hex.EncodeToString(idBytes)
 
 	// Prepare history recording
 	history := &model.History{
 		ID:        runID,
+		BatchID:   opts.BatchID,
 		Type:      model.HistoryTypeTest,
 		Timestamp: startTime,
 		Args:      os.Args,
@@ -403,17 +1066,14 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 	}
 
 	// Capture git info (non-fatal if it fails)
-	if commit, branch, err := a.getGitInfo(); err == nil {
-		history.Git = &model.Git{
-			Commit: commit,
-			Branch: branch,
-		}
+	if info, err := a.getGitInfo(); err == nil {
+		history.Git = info
 	}
 
 	// Create history directory early so artifacts can be written directly to it
 	runDir, err := a.prepareHistoryDir(history)
 	if err != nil {
-		return fmt.Errorf("failed to prepare history directory: %w", err)
+		return nil, fmt.Errorf("failed to prepare history directory: %w", err)
 	}
 
 	// Track final exit code
@@ -437,10 +1097,19 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 
 		// Clean up test binary after recording
 		if testBinaryPath != "" {
-			if err := os.Remove(testBinaryPath); err != nil {
+			if err := removeTestBinary(testBinaryPath); err != nil {
 				a.logger.Debug().Err(err).Str("binary", testBinaryPath).Msg("Failed to clean up test binary")
 			}
 		}
+
+		result = newTestResult(history, runDir)
+
+		// Written for failed runs too, with the counters and benchmarks they reported
+		if opts.MetricsOut != "" {
+			if metricsErr := writeMetricsFile(opts.MetricsOut, *history, runDir); metricsErr != nil && err == nil {
+				err = metricsErr
+			}
+		}
 	}()
 
 	if len(testArgs) > 0 {
@@ -449,12 +1118,24 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 
 	// Validate that the first argument (if present) is a valid path or pattern
 	if len(testArgs) < 1 {
-		return fmt.Errorf("no package path specified: please provide a test path that resolves into a single package (e.g., '.' or './pkg/example')")
+		return nil, fmt.Errorf("no package path specified: please provide a package path or pattern (e.g., '.', './pkg/example' or './...')")
 	}
 
 	// the first args, always needs to be the test path
-	if err := a.validateTestPath(testArgs[0]); err != nil {
-		return err
+	packages, err := a.resolveTestPackages(testArgs[0])
+	if err != nil {
+		return nil, err
+	}
+	history.Test.PackagePath = testArgs[0]
+
+	// Patterns matching several packages run one test binary per package.
+	// Perf modes producing a report from perf.data need a single package.
+	multiPackage := len(packages) > 1
+	if multiPackage && perfMode != "" && perfMode != "stat" {
+		return nil, fmt.Errorf("perf %s supports a single package, %q matches %d packages with tests", perfMode, testArgs[0], len(packages))
+	}
+	if multiPackage && a.repeated() > 1 {
+		return nil, fmt.Errorf("--repeat supports a single package, %q matches %d packages with tests", testArgs[0], len(packages))
 	}
 
 	// remove -- if given as separator
@@ -465,6 +1146,13 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 	// Separate build args from runtime args
 	buildArgs, runtimeArgs := a.separateTestArgs(testArgs)
 
+	// Add benchmark args from the convenience flags, explicit args win
+	runtimeArgs = addBenchmarkArgs(runtimeArgs, benchmarkOptions{
+		bench:     opts.Bench,
+		benchtime: opts.Benchtime,
+		benchmem:  opts.Benchmem,
+	})
+
 	if len(buildArgs) > 0 {
 		a.logger.Debug().Strs("build_args", buildArgs).Msg("Build-time arguments")
 	}
@@ -476,55 +1164,74 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 		a.logger.Info().Str("host", remoteHost).Msg("Connecting to remote host")
 
 		// Create SSH client for remote operations
-		sshClient, err := ssh.New(a.logger, remoteHost)
+		sshClient, err := ssh.New(a.logger, remoteHost, opts.SSH...)
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Failed to setup SSH connection")
-			return err
+			return nil, err
 		}
 		defer sshClient.Close()
 
+		if err := sshClient.ValidateSharedPath(); err != nil {
+			return nil, err
+		}
+
 		remoteOS, remoteArch, err := sshClient.DetectSystem()
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Failed to detect remote system")
-			return err
+			return nil, err
 		}
 
+		remoteVendor := sshClient.DetectCPUVendor(remoteOS, remoteArch)
+
 		// Store target information
 		history.Target = &model.Target{
 			RemoteHost: remoteHost,
 			OS:         remoteOS,
 			Arch:       remoteArch,
+			Vendor:     remoteVendor,
+		}
+		a.testCPUAffinity = a.resolveCPUAffinity(remoteOS, cpuAffinity)
+		history.Target.GOMAXPROCS = gomaxprocs
+		history.Target.CPUAffinity = a.testCPUAffinity
+		if remoteOS == "linux" {
+			history.Target.KernelRelease, history.Target.PerfVersion = detectVersions(remoteShellExec(sshClient))
 		}
 
 		a.logger.Info().
 			Str("os", remoteOS).
 			Str("arch", remoteArch).
+			Str("vendor", remoteVendor).
 			Msg("Detected remote system")
 
-		// Build test binary for remote system
-		testBinary, err := a.buildTestBinary(remoteOS, remoteArch, buildArgs)
-		if err != nil {
-			a.logger.Error().Err(err).Msg("Failed to build test binary")
-			return err
+		// perf is Linux only, Windows hosts can run the tests without it
+		if remoteOS == "windows" && perfMode != "" {
+			return nil, fmt.Errorf("perf %s is not available on Windows remote host %s, run perfgo test without a perf mode to execute the tests only", perfMode, remoteHost)
 		}
-		testBinaryPath = testBinary
 
-		a.logger.Info().Str("binary", testBinary).Msg("Test binary built successfully")
+		if needsPerf(perfMode) {
+			if _, _, err := sshClient.RunCommand("command -v perf"); err != nil {
+				return nil, perfNotFoundError(remoteHost, err)
+			}
+		}
+
+		if err := a.checkPerfEvents(remoteHost, remoteEventLister(sshClient), events); err != nil {
+			return nil, err
+		}
 
 		// Get remote base directory for this repository
 		remoteBaseDir, err := sshClient.GetRemoteRepositoryDir()
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Failed to determine remote repository directory")
-			return err
+			return nil, err
 		}
 
 		a.logger.Debug().Str("remoteBaseDir", remoteBaseDir).Msg("Using remote base directory")
 
 		// Sync current directory to remote host
-		remoteDir, err := sshClient.SyncDirectoryToRemote(remoteBaseDir)
+		remoteDir, err := sshClient.SyncDirectoryToRemote(remoteBaseDir, opts.Sync...)
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Failed to sync directory to remote host")
-			return err
+			return nil, err
 		}
 
 		a.logger.Info().
@@ -532,27 +1239,14 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 			Str("remote", remoteDir).
 			Msg("Directory synced to remote host")
 
-		// Copy test binary to remote host
-		remotePath, err := sshClient.CopyBinaryToRemote(testBinary, remoteBaseDir)
-		if err != nil {
-			a.logger.Error().Err(err).Msg("Failed to copy binary to remote host")
-			return err
-		}
-
-		a.logger.Info().
-			Str("local", testBinary).
-			Str("remote", remotePath).
-			Msg("Test binary copied to remote host")
-
-		// Clean up remote base directory after execution (unless --keep is specified)
+		// Clean up the binaries and perf files after execution (unless --keep
+		// is specified), the working tree stays for the next incremental sync
 		if !keepArtifacts {
 			defer func() {
-				// Clean up the entire base directory (includes working tree and binary)
-				cleanupCmd := fmt.Sprintf("rm -rf %s", remoteBaseDir)
-				if _, _, err := sshClient.RunCommand(cleanupCmd); err != nil {
-					a.logger.Warn().Err(err).Str("path", remoteBaseDir).Msg("Failed to clean up remote base directory")
+				if err := sshClient.RemoveRunFiles(remoteBaseDir); err != nil {
+					a.logger.Warn().Err(err).Str("path", remoteBaseDir).Msg("Failed to clean up remote run files")
 				} else {
-					a.logger.Debug().Str("path", remoteBaseDir).Msg("Remote base directory cleaned up")
+					a.logger.Debug().Str("path", remoteBaseDir).Msg("Remote run files cleaned up")
 				}
 			}()
 		} else {
@@ -561,6 +1255,55 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 				Msg("Keeping remote artifacts (cleanup skipped)")
 		}
 
+		// Transform runtime args to use -test. prefix
+		transformedArgs := a.transformTestFlags(runtimeArgs)
+
+		history.Test.BuildEnv = a.goBuildEnv(remoteOS, remoteArch)
+
+		if multiPackage {
+			statOpts := packageStatOptions(perfMode, perf.StatOptions{
+				Events:          perfEvents,
+				Detail:          perfDetail,
+				Repeat:          perfRepeat,
+				StatAggregation: statAggregation,
+			}, history)
+			finalErr = a.runTestPackages(packages, remoteOS, remoteArch, testArgs[0], buildArgs, history, &stdoutContent, &stderrContent,
+				func(pkg gocmd.Package, dir, binary string, stdout, stderr *string) error {
+					remotePath, err := sshClient.CopyBinaryToRemote(binary, remoteBaseDir)
+					if err != nil {
+						return err
+					}
+					if statOpts != nil {
+						return a.executeRemoteTestInDirWithStatOptions(sshClient, remotePath, remoteDir, remoteBaseDir, dir, *statOpts, transformedArgs, stdout, stderr)
+					}
+					return a.executeRemoteTestInDir(sshClient, remotePath, remoteDir, remoteBaseDir, dir, nil, transformedArgs, stdout, stderr)
+				})
+			return nil, finalErr
+		}
+
+		// Build test binary for remote system
+		testBinary, err := a.buildTestBinary(remoteOS, remoteArch, "", buildArgs)
+		if err != nil {
+			a.logger.Error().Err(err).Msg("Failed to build test binary")
+			return nil, err
+		}
+		testBinaryPath = testBinary
+		defer a.onInterrupt(func() { removeTestBinary(testBinary) })()
+
+		a.logger.Info().Str("binary", testBinary).Msg("Test binary built successfully")
+
+		// Copy test binary to remote host
+		remotePath, err := sshClient.CopyBinaryToRemote(testBinary, remoteBaseDir)
+		if err != nil {
+			a.logger.Error().Err(err).Msg("Failed to copy binary to remote host")
+			return nil, err
+		}
+
+		a.logger.Info().
+			Str("local", testBinary).
+			Str("remote", remotePath).
+			Msg("Test binary copied to remote host")
+
 		// Determine the package path to run tests in
 		packagePath := a.getPackagePath(buildArgs)
 
@@ -569,47 +1312,61 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 		// Execute the test binary remotely in the synced directory
 		a.logger.Info().Str("path", remotePath).Msg("Executing tests on remote host")
 
-		// Transform runtime args to use -test. prefix
-		transformedArgs := a.transformTestFlags(runtimeArgs)
-
 		if perfMode == "profile" {
 			recordOpts := &perf.RecordOptions{
-				Event: perfEvent,
-				Count: perfCount,
+				Event:        perfEvent,
+				Count:        perfCount,
+				BranchStack:  branchStack,
+				BranchFilter: branchFilter,
 			}
 
 			// Store perf options in history
 			history.Perf = &model.Perf{
 				Record: &model.PerfRecord{
-					Event: perfEvent,
-					Count: perfCount,
+					Event:        perfEvent,
+					Count:        perfCount,
+					BranchStack:  branchStack,
+					BranchFilter: branchFilter,
+					DefaultEvent: defaultEvent,
+					Repeat:       a.historyRepeat(),
 				},
 			}
 
-			err := a.executeRemoteTestInDir(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, recordOpts, transformedArgs, &stdoutContent, &stderrContent)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Remote test execution failed")
-				finalErr = err
-				return err
+			if callGraphAuto {
+				workDir, err := remoteWorkDir(remoteDir, packagePath)
+				if err != nil {
+					return nil, err
+				}
+				recordOpts.CallGraph = a.probeRemoteCallGraph(sshClient, *recordOpts, remotePath, transformedArgs, workDir, remoteBaseDir, remoteVendor)
+				history.Perf.Record.CallGraph = recordOpts.CallGraph
 			}
 
-			// Copy back and process perf.data
-			profilePath := filepath.Join(runDir, "perf.pb.gz")
-			binaryArtifacts, err := perf.ProcessPerfData(a.logger, sshClient, remoteBaseDir, profilePath, runDir, nil, history.ID)
+			err := a.repeatProfile(runDir, history, func(profilePath string) error {
+				var runStdout, runStderr string
+				err := a.executeRemoteTestInDir(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, recordOpts, transformedArgs, &runStdout, &runStderr)
+				stdoutContent += runStdout
+				stderrContent += runStderr
+				if err != nil {
+					a.logger.Error().Err(err).Msg("Remote test execution failed")
+					return err
+				}
+
+				// Copy back and process perf.data
+				binaryArtifacts, err := perf.ProcessPerfData(a.logger, sshClient, remoteBaseDir, profilePath, runDir, nil, opts.Copy, history.ID, recordOpts.HasBranchStack())
+				if errors.Is(err, perf.ErrNoSamples) {
+					history.Warnings = append(history.Warnings, err.Error())
+				} else if err != nil {
+					a.logger.Error().Err(err).Msg("Failed to process performance data")
+					return err
+				}
+				registerBinaryArtifacts(history, binaryArtifacts)
+				return nil
+			})
 			if err != nil {
-				a.logger.Error().Err(err).Msg("Failed to process performance data")
 				finalErr = err
-				return err
-			}
-
-			// Register binary artifacts
-			for _, binArtifact := range binaryArtifacts {
-				history.Artifacts = append(history.Artifacts, model.Artifact{
-					Type: model.ArtifactTypeTestBinary,
-					Size: binArtifact.Size,
-					File: binArtifact.LocalPath,
-				})
+				return nil, err
 			}
+			a.savePerfData(sshClient, remoteBaseDir+"/perf.data", runDir, history)
 
 			// Profile is written directly to history directory
 		} else if perfMode == "stat" {
@@ -618,25 +1375,42 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 				events = perfEvents
 			}
 			statOpts := perf.StatOptions{
-				Events: events,
-				Detail: perfDetail,
+				Events:          events,
+				Detail:          perfDetail,
+				Repeat:          perfRepeat,
+				StatAggregation: statAggregation,
 			}
 
 			// Store perf options in history
 			history.Perf = &model.Perf{
 				Stat: &model.PerfStat{
-					Events: events,
-					Detail: perfDetail,
+					Events:      events,
+					Detail:      perfDetail,
+					Repeat:      a.historyRepeat(),
+					PerfRepeat:  perfRepeat,
+					Aggregation: statAggregation.Mode(),
 				},
 			}
 
-			err := a.executeRemoteTestInDirWithStatOptions(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, statOpts, transformedArgs, &stdoutContent, &stderrContent)
+			var err error
+			if a.repeated() > 1 {
+				statOpts.CSV = true
+				err = a.repeatStat(runDir, history, perfDetail, &stdoutContent, &stderrContent, func(stdout, stderr *string) error {
+					return a.executeRemoteTestInDirWithStatOptions(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, statOpts, transformedArgs, stdout, stderr)
+				})
+			} else {
+				err = a.executeRemoteTestInDirWithStatOptions(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, statOpts, transformedArgs, &stdoutContent, &stderrContent)
+			}
 			if err != nil {
 				a.logger.Error().Err(err).Msg("Remote test execution failed")
 				finalErr = err
-				return err
+				return nil, err
 			}
 		} else if perfMode == "c2c" {
+			if c2cEvent == "" {
+				c2cEvent = perf.DefaultC2CEvent(remoteArch, remoteVendor)
+			}
+
 			c2cOpts := perf.C2COptions{
 				Event: c2cEvent,
 				Count: c2cCount,
@@ -657,54 +1431,129 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 				},
 			}
 
-			err := a.executeRemoteTestInDirWithC2COptions(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, c2cOpts, reportOpts, transformedArgs, &stdoutContent, &stderrContent)
+			c2cOpts.OutputPath = remoteBaseDir + "/perf.data"
+			c2cOpts.Binary = remotePath
+			c2cOpts.Args = transformedArgs
+			if err := a.recordRemoteReport(sshClient, c2cRecording(c2cOpts, reportOpts), remoteDir, remoteBaseDir, packagePath, runDir, history, &stdoutContent, &stderrContent); err != nil {
+				finalErr = err
+				return nil, err
+			}
+		} else if perfMode == "mem" {
+			// Store perf options in history
+			history.Perf = &model.Perf{
+				Mem: memHistory(memOpts, memReportOpts),
+			}
+
+			memOpts.OutputPath = remoteBaseDir + "/perf.data"
+			memOpts.Binary = remotePath
+			memOpts.Args = transformedArgs
+			if err := a.recordRemoteReport(sshClient, memRecording(memOpts, memReportOpts), remoteDir, remoteBaseDir, packagePath, runDir, history, &stdoutContent, &stderrContent); err != nil {
+				finalErr = err
+				return nil, err
+			}
+		} else if isGoProfileMode(perfMode) {
+			recordGoProfile(history, perfMode, memProfileRate)
+
+			profileFile := goProfileFile(perfMode)
+			remoteProfile := remoteBaseDir + "/" + profileFile
+			args := append(transformedArgs, goProfileArgs(perfMode, remoteProfile, memProfileRate)...)
+			err := a.executeRemoteTestInDir(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, nil, args, &stdoutContent, &stderrContent)
 			if err != nil {
 				a.logger.Error().Err(err).Msg("Remote test execution failed")
 				finalErr = err
-				return err
+				return nil, err
 			}
 
-			// Process perf c2c data and generate report
-			reportFilename, err := perf.ProcessC2CData(a.logger, sshClient, remoteBaseDir, runDir, reportOpts, history.ID)
+			// Copy back the profile
+			f, err := os.Create(filepath.Join(runDir, profileFile))
 			if err != nil {
-				a.logger.Error().Err(err).Msg("Failed to process c2c data")
 				finalErr = err
-				return err
+				return nil, err
 			}
-
-			// Get report file size
-			reportPath := filepath.Join(runDir, reportFilename)
-			if reportInfo, err := os.Stat(reportPath); err == nil {
-				history.Artifacts = append(history.Artifacts, model.Artifact{
-					Type: model.ArtifactTypePerfC2CReport,
-					Size: uint64(reportInfo.Size()),
-					File: reportFilename,
-				})
+			err = sshClient.CopyFromRemote(remoteProfile, f)
+			f.Close()
+			if err != nil {
+				finalErr = fmt.Errorf("failed to copy %s profile: %w", perfMode, err)
+				return nil, finalErr
+			}
+			if err := registerGoProfile(runDir, perfMode, history); err != nil {
+				finalErr = err
+				return nil, err
 			}
 		} else {
 			err := a.executeRemoteTestInDir(sshClient, remotePath, remoteDir, remoteBaseDir, packagePath, nil, transformedArgs, &stdoutContent, &stderrContent)
 			if err != nil {
 				a.logger.Error().Err(err).Msg("Remote test execution failed")
 				finalErr = err
-				return err
+				return nil, err
 			}
 		}
 	} else {
 		// Local test execution
 		a.logger.Info().Msg("Running tests locally")
 
+		// Don't leave the test binary and intermediate files behind on Ctrl-C,
+		// the run directory holds no history.json yet
+		if a.handleSignals {
+			defer a.handleInterrupts(keepArtifacts)()
+		}
+		defer a.onInterrupt(func() { os.RemoveAll(runDir) })()
+
 		// Capture local OS and architecture
 		history.Target = &model.Target{
-			OS:   runtime.GOOS,
-			Arch: runtime.GOARCH,
+			OS:     localOS,
+			Arch:   localArch,
+			Vendor: cpu.DetectLocalVendor(),
+		}
+		a.testCPUAffinity = a.resolveCPUAffinity(runtime.GOOS, cpuAffinity)
+		history.Target.GOMAXPROCS = gomaxprocs
+		history.Target.CPUAffinity = a.testCPUAffinity
+		if runtime.GOOS == "linux" {
+			history.Target.KernelRelease, history.Target.PerfVersion = detectVersions(a.localShellExec)
+		}
+
+		if needsPerf(perfMode) {
+			if _, err := exec.LookPath("perf"); err != nil {
+				return nil, perfNotFoundError("this machine", err)
+			}
+		}
+
+		if err := a.checkPerfEvents("", localEventLister, events); err != nil {
+			return nil, err
+		}
+
+		history.Test.BuildEnv = a.goBuildEnv(buildOS, buildArch)
+
+		if multiPackage {
+			statOpts := packageStatOptions(perfMode, perf.StatOptions{
+				Events:          perfEvents,
+				Detail:          perfDetail,
+				Repeat:          perfRepeat,
+				StatAggregation: statAggregation,
+			}, history)
+			transformedArgs := a.transformTestFlags(runtimeArgs)
+			finalErr = a.runTestPackages(packages, buildOS, buildArch, testArgs[0], buildArgs, history, &stdoutContent, &stderrContent,
+				func(pkg gocmd.Package, dir, binary string, stdout, stderr *string) error {
+					// Test binaries run in their package directory
+					binary, err := filepath.Abs(binary)
+					if err != nil {
+						return err
+					}
+					if statOpts != nil {
+						return a.executeLocalTestWithStatOptions(binary, dir, *statOpts, transformedArgs, stdout, stderr)
+					}
+					return a.executeLocalTestWithOptions(binary, dir, nil, transformedArgs, stdout, stderr)
+				})
+			return nil, finalErr
 		}
 
-		testBinary, err := a.buildTestBinary("", "", buildArgs)
+		testBinary, err := a.buildTestBinary(buildOS, buildArch, "", buildArgs)
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Failed to build test binary")
-			return err
+			return nil, err
 		}
 		testBinaryPath = testBinary
+		defer a.onInterrupt(func() { removeTestBinary(testBinary) })()
 
 		a.logger.Info().Str("binary", testBinary).Msg("Test binary built successfully")
 
@@ -714,43 +1563,48 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 		// Transform runtime args to use -test. prefix for local execution too
 		transformedArgs := a.transformTestFlags(runtimeArgs)
 
+		// perf.data is staged outside the working directory
+		perfDataPath := perfDataFile
+		if perfMode == "profile" || perfMode == "c2c" || perfMode == "mem" {
+			path, cleanup, err := a.localPerfDataPath(opts.PerfDataInCWD)
+			if err != nil {
+				return nil, err
+			}
+			defer cleanup()
+			perfDataPath = path
+		}
+
 		if perfMode == "profile" {
 			recordOpts := &perf.RecordOptions{
-				Event: perfEvent,
-				Count: perfCount,
+				Event:        perfEvent,
+				Count:        perfCount,
+				MaxDuration:  maxDuration,
+				BranchStack:  branchStack,
+				BranchFilter: branchFilter,
 			}
 
 			// Store perf options in history
 			history.Perf = &model.Perf{
 				Record: &model.PerfRecord{
-					Event: perfEvent,
-					Count: perfCount,
+					Event:              perfEvent,
+					Count:              perfCount,
+					MaxDurationSeconds: int(math.Ceil(maxDuration.Seconds())),
+					BranchStack:        branchStack,
+					BranchFilter:       branchFilter,
+					DefaultEvent:       defaultEvent,
+					Repeat:             a.historyRepeat(),
 				},
 			}
 
-			err := a.executeLocalTest(testBinary, recordOpts, transformedArgs, &stdoutContent, &stderrContent)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Local test execution failed")
-				finalErr = err
-				return err
+			if callGraphAuto {
+				recordOpts.CallGraph = a.probeLocalCallGraph(*recordOpts, testBinary, transformedArgs, "", history.Target.Vendor)
+				history.Perf.Record.CallGraph = recordOpts.CallGraph
 			}
 
-			// Process perf.data
-			profilePath := filepath.Join(runDir, "perf.pb.gz")
-			binaryArtifacts, err := perf.ConvertPerfToPprof(a.logger, "perf.data", profilePath, runDir, history.ID)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Failed to convert performance data to pprof")
+			recordOpts.OutputPath = perfDataPath
+			if err := a.profileLocalTest(testBinary, recordOpts, transformedArgs, runDir, history, &stdoutContent, &stderrContent); err != nil {
 				finalErr = err
-				return err
-			}
-
-			// Register binary artifacts
-			for _, binArtifact := range binaryArtifacts {
-				history.Artifacts = append(history.Artifacts, model.Artifact{
-					Type: model.ArtifactTypeTestBinary,
-					Size: binArtifact.Size,
-					File: binArtifact.LocalPath,
-				})
+				return nil, err
 			}
 
 			// Profile is written directly to history directory
@@ -760,29 +1614,46 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 				events = perfEvents
 			}
 			statOpts := perf.StatOptions{
-				Events: events,
-				Detail: perfDetail,
+				Events:          events,
+				Detail:          perfDetail,
+				Repeat:          perfRepeat,
+				StatAggregation: statAggregation,
 			}
 
 			// Store perf options in history
 			history.Perf = &model.Perf{
 				Stat: &model.PerfStat{
-					Events: events,
-					Detail: perfDetail,
+					Events:      events,
+					Detail:      perfDetail,
+					Repeat:      a.historyRepeat(),
+					PerfRepeat:  perfRepeat,
+					Aggregation: statAggregation.Mode(),
 				},
 			}
 
-			err := a.executeLocalTestWithStatOptions(testBinary, statOpts, transformedArgs, &stdoutContent, &stderrContent)
+			var err error
+			if a.repeated() > 1 {
+				statOpts.CSV = true
+				err = a.repeatStat(runDir, history, perfDetail, &stdoutContent, &stderrContent, func(stdout, stderr *string) error {
+					return a.executeLocalTestWithStatOptions(testBinary, "", statOpts, transformedArgs, stdout, stderr)
+				})
+			} else {
+				err = a.executeLocalTestWithStatOptions(testBinary, "", statOpts, transformedArgs, &stdoutContent, &stderrContent)
+			}
 			if err != nil {
 				a.logger.Error().Err(err).Msg("Local test execution failed")
 				finalErr = err
-				return err
+				return nil, err
 			}
 		} else if perfMode == "c2c" {
+			if c2cEvent == "" {
+				c2cEvent = perf.DefaultC2CEvent(runtime.GOARCH, history.Target.Vendor)
+			}
+
 			c2cOpts := perf.C2COptions{
 				Event:      c2cEvent,
 				Count:      c2cCount,
-				OutputPath: "perf.data",
+				OutputPath: perfDataPath,
 			}
 
 			reportOpts := perf.C2CReportOptions{
@@ -800,39 +1671,55 @@ func (a *App) runTest(ctx *cli.Context, perfMode string) error {
 				},
 			}
 
-			err := a.executeLocalTestWithC2COptions(testBinary, c2cOpts, reportOpts, transformedArgs, &stdoutContent, &stderrContent)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Local test execution failed")
+			c2cOpts.Binary = testBinary
+			c2cOpts.Args = transformedArgs
+			if err := a.recordLocalReport(c2cRecording(c2cOpts, reportOpts), runDir, history, &stdoutContent, &stderrContent); err != nil {
 				finalErr = err
-				return err
+				return nil, err
 			}
+		} else if perfMode == "mem" {
+			memOpts.OutputPath = perfDataPath
 
-			// Convert perf.data to c2c report
-			reportFilename, err := perf.ConvertPerfC2CToReport(a.logger, "perf.data", runDir, reportOpts, history.ID)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Failed to generate c2c report")
+			// Store perf options in history
+			history.Perf = &model.Perf{
+				Mem: memHistory(memOpts, memReportOpts),
+			}
+
+			memOpts.Binary = testBinary
+			memOpts.Args = transformedArgs
+			if err := a.recordLocalReport(memRecording(memOpts, memReportOpts), runDir, history, &stdoutContent, &stderrContent); err != nil {
 				finalErr = err
-				return err
+				return nil, err
 			}
+		} else if isGoProfileMode(perfMode) {
+			recordGoProfile(history, perfMode, memProfileRate)
 
-			// Get report file size and register artifact
-			reportPath := filepath.Join(runDir, reportFilename)
-			if reportInfo, err := os.Stat(reportPath); err == nil {
-				history.Artifacts = append(history.Artifacts, model.Artifact{
-					Type: model.ArtifactTypePerfC2CReport,
-					Size: uint64(reportInfo.Size()),
-					File: reportFilename,
-				})
+			// The test binary resolves relative paths against its output directory
+			profilePath, err := filepath.Abs(filepath.Join(runDir, goProfileFile(perfMode)))
+			if err != nil {
+				return nil, err
+			}
+			args := append(transformedArgs, goProfileArgs(perfMode, profilePath, memProfileRate)...)
+			err = a.executeLocalTest(testBinary, nil, args, &stdoutContent, &stderrContent)
+			if err != nil {
+				a.logger.Error().Err(err).Msg("Local test execution failed")
+				finalErr = err
+				return nil, err
+			}
+			if err := registerGoProfile(runDir, perfMode, history); err != nil {
+				finalErr = err
+				return nil, err
 			}
 		} else {
 			err := a.executeLocalTest(testBinary, nil, transformedArgs, &stdoutContent, &stderrContent)
 			if err != nil {
 				a.logger.Error().Err(err).Msg("Local test execution failed")
 				finalErr = err
-				return err
+				return nil, err
 			}
 		}
 	}
 
-	return nil
+	// The result is filled in once the history is recorded
+	return nil, nil
 }
@@ -0,0 +1,152 @@
+package cli
+
+// This file contains the gzip compression of archived binaries, and their
+// decompression when handing them to pprof.
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+)
+
+// compressFile replaces the file at path by a gzip compressed copy at
+// path.gz and returns the new path.
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	destPath := path + ".gz"
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create compressed file: %w", err)
+	}
+
+	zw := gzip.NewWriter(dest)
+	if _, err := io.Copy(zw, src); err != nil {
+		dest.Close()
+		os.Remove(destPath)
+		return "", fmt.Errorf("failed to compress file: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		dest.Close()
+		os.Remove(destPath)
+		return "", fmt.Errorf("failed to compress file: %w", err)
+	}
+	if err := dest.Close(); err != nil {
+		os.Remove(destPath)
+		return "", fmt.Errorf("failed to write compressed file: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove uncompressed file: %w", err)
+	}
+
+	return destPath, nil
+}
+
+// decompressFile writes the decompressed content of the gzip file src to dest.
+func decompressFile(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open compressed file: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read compressed file: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create decompressed file: %w", err)
+	}
+
+	if _, err := io.Copy(out, zr); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to decompress file: %w", err)
+	}
+
+	return out.Close()
+}
+
+// pprofProfile returns the profile to hand to pprof. If the entry's binaries
+// are compressed, they are decompressed into a temporary directory together
+// with a copy of the profile pointing to them, matched by GNU build-id first
+// and by name otherwise. Mappings with a stored symbol file point to it
+// instead of the binary. The returned cleanup function removes the temporary
+// files.
+func (a *App) pprofProfile(entry *history.Entry, profileArtifact *model.Artifact) (string, func(), error) {
+	profilePath := filepath.Join(entry.FullPath, profileArtifact.File)
+
+	var compressed []model.Artifact
+	for _, artifact := range entry.History.Artifacts {
+		if artifact.Compressed && (artifact.Type == model.ArtifactTypeTestBinary || artifact.Type == model.ArtifactTypeAttachBinary) {
+			compressed = append(compressed, artifact)
+		}
+	}
+	symbolsByBuildID, symbolsByName := storedSymbolFiles(entry.FullPath, entry.History.Artifacts)
+	if len(compressed) == 0 && len(symbolsByBuildID) == 0 && len(symbolsByName) == 0 {
+		return profilePath, func() {}, nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "perfgo-pprof-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			a.logger.Warn().Err(err).Str("path", tempDir).Msg("Failed to remove temporary directory")
+		}
+	}
+
+	binaries := make(map[string]string)
+	byBuildID := make(map[string]string)
+	for _, artifact := range compressed {
+		basename, ok := originalBasename(artifact.File)
+		if !ok {
+			continue
+		}
+
+		dest := filepath.Join(tempDir, strings.TrimSuffix(artifact.File, ".gz"))
+		if err := decompressFile(resolveArtifactPath(entry.FullPath, artifact), dest); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to decompress %s: %w", artifact.File, err)
+		}
+		binaries[basename] = dest
+		if artifact.BuildID != "" {
+			byBuildID[artifact.BuildID] = dest
+		}
+
+		a.logger.Debug().
+			Str("binary", artifact.File).
+			Str("dest", dest).
+			Msg("Decompressed binary for pprof")
+	}
+
+	// Symbol files take precedence over the binaries
+	for name, path := range symbolsByName {
+		binaries[name] = path
+	}
+	for buildID, path := range symbolsByBuildID {
+		byBuildID[buildID] = path
+	}
+
+	tempProfile := filepath.Join(tempDir, filepath.Base(profilePath))
+	if err := a.rewriteProfilePaths(profilePath, tempProfile, binaries, byBuildID); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return tempProfile, cleanup, nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFile_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "abc.perfgo.test.binary")
+	content := []byte(strings.Repeat("\x7fELF binary content ", 1000))
+	require.NoError(t, os.WriteFile(path, content, 0o755))
+
+	compressed, err := compressFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, path+".gz", compressed)
+	assert.NoFileExists(t, path)
+
+	info, err := os.Stat(compressed)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(len(content)))
+
+	dest := filepath.Join(dir, "decompressed")
+	require.NoError(t, decompressFile(compressed, dest))
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func TestPprofProfile_DecompressesBinaries(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "history", "20250101-120000-aaaaaaaa-11111111")
+	require.NoError(t, os.MkdirAll(runDir, 0o755))
+
+	testBinary := filepath.Join(t.TempDir(), "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("test binary with symbols"), 0o755))
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping:    []*profile.Mapping{{ID: 1, File: testBinary}},
+	}
+	f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	a := &App{logger: zerolog.Nop(), compressBinaries: true}
+	h := &model.History{}
+	require.NoError(t, a.saveArtifacts(runDir, h, testBinary))
+
+	require.Len(t, h.Artifacts, 2)
+	binary := h.Artifacts[0]
+	assert.True(t, binary.Compressed)
+	assert.True(t, strings.HasSuffix(binary.File, ".perfgo.test.binary.gz"))
+	assert.FileExists(t, filepath.Join(objectStoreDir(runDir), binary.Hash+".binary.gz"))
+
+	entry := &history.Entry{History: *h, FullPath: runDir}
+	profilePath, cleanup, err := a.pprofProfile(entry, &h.Artifacts[1])
+	require.NoError(t, err)
+
+	f, err = os.Open(profilePath)
+	require.NoError(t, err)
+	defer f.Close()
+	handed, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	// pprof receives an uncompressed copy of the binary
+	require.Len(t, handed.Mapping, 1)
+	data, err := os.ReadFile(handed.Mapping[0].File)
+	require.NoError(t, err)
+	assert.Equal(t, "test binary with symbols", string(data))
+
+	cleanup()
+	assert.NoFileExists(t, profilePath)
+	assert.NoFileExists(t, handed.Mapping[0].File)
+}
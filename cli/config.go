@@ -0,0 +1,211 @@
+package cli
+
+// This file contains the .perfgo.yaml config file, which sets the defaults
+// of flags shared by a team, e.g. the remote host or the perf events.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the name of the config file in the repository root and in
+// $PERFGO_HOME.
+const configFile = ".perfgo.yaml"
+
+// Config holds the flag defaults read from a config file. Keys are the flag
+// names, flags given on the command line or by environment variable win.
+type Config struct {
+	// perf events of test and attach, a single comma separated --event for
+	// profile and repeated --event for stat
+	Events        []string `yaml:"events"`
+	CallGraphAuto *bool    `yaml:"call-graph-auto"`
+	DefaultEvent  string   `yaml:"default-event"`
+	Output        string   `yaml:"output"`
+	KeepPerfData  *bool    `yaml:"keep-perf-data"`
+
+	RemoteHost       string         `yaml:"remote-host"`
+	SSHUser          string         `yaml:"ssh-user"`
+	SSHPort          int            `yaml:"ssh-port"`
+	SSHJump          string         `yaml:"ssh-jump"`
+	SSHPersist       *time.Duration `yaml:"ssh-persist"`
+	RemoteCacheDir   string         `yaml:"remote-cache-dir"`
+	RemoteSharedPath string         `yaml:"remote-shared-path"`
+	CopyConcurrency  int            `yaml:"copy-concurrency"`
+
+	Env         []string `yaml:"env"`
+	BuildEnv    []string `yaml:"build-env"`
+	GOMAXPROCS  int      `yaml:"gomaxprocs"`
+	CPUAffinity string   `yaml:"cpu-affinity"`
+
+	PerfImage  string `yaml:"perf-image"`
+	Namespace  string `yaml:"namespace"`
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+}
+
+// configPaths returns the config files to read, later files overriding
+// earlier ones: $PERFGO_HOME, then the repository root.
+func configPaths() []string {
+	var paths []string
+	if home := os.Getenv(history.EnvHome); home != "" {
+		paths = append(paths, filepath.Join(home, configFile))
+	}
+	if root, err := history.GitRoot(); err == nil {
+		paths = append(paths, filepath.Join(root, configFile))
+	}
+	return paths
+}
+
+// loadConfig reads the existing config files of paths into one Config.
+// Missing files are skipped, unknown keys are an error.
+func loadConfig(paths ...string) (*Config, []string, error) {
+	var cfg Config
+	var loaded []string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open config: %w", err)
+		}
+
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+		f.Close()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+		loaded = append(loaded, path)
+	}
+	return &cfg, loaded, nil
+}
+
+// flagValues returns the values of cfg by flag name, leaving out the unset
+// ones.
+func (cfg *Config) flagValues() map[string]any {
+	values := map[string]any{}
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			values[name] = value
+		}
+	}
+	setStrings := func(name string, value []string) {
+		if len(value) > 0 {
+			values[name] = value
+		}
+	}
+
+	setStrings("event", cfg.Events)
+	if cfg.CallGraphAuto != nil {
+		values["call-graph-auto"] = *cfg.CallGraphAuto
+	}
+	setString("default-event", cfg.DefaultEvent)
+	setString("output", cfg.Output)
+	if cfg.KeepPerfData != nil {
+		values["keep-perf-data"] = *cfg.KeepPerfData
+	}
+
+	setString("remote-host", cfg.RemoteHost)
+	setString("ssh-user", cfg.SSHUser)
+	setInt("ssh-port", cfg.SSHPort)
+	setString("ssh-jump", cfg.SSHJump)
+	if cfg.SSHPersist != nil {
+		values["ssh-persist"] = *cfg.SSHPersist
+	}
+	setString("remote-cache-dir", cfg.RemoteCacheDir)
+	setString("remote-shared-path", cfg.RemoteSharedPath)
+	setInt("copy-concurrency", cfg.CopyConcurrency)
+
+	setStrings("env", cfg.Env)
+	setStrings("build-env", cfg.BuildEnv)
+	setInt("gomaxprocs", cfg.GOMAXPROCS)
+	setString("cpu-affinity", cfg.CPUAffinity)
+
+	setString("perf-image", cfg.PerfImage)
+	setString("namespace", cfg.Namespace)
+	setString("kubeconfig", cfg.Kubeconfig)
+	setString("context", cfg.Context)
+	return values
+}
+
+// applyConfig sets the defaults of the flags of commands and their
+// subcommands to the values of cfg.
+func applyConfig(commands []*cli.Command, cfg *Config) {
+	values := cfg.flagValues()
+	var apply func(commands []*cli.Command)
+	apply = func(commands []*cli.Command) {
+		for _, cmd := range commands {
+			for _, flag := range cmd.Flags {
+				setFlagDefault(flag, values)
+			}
+			apply(cmd.Subcommands)
+		}
+	}
+	apply(commands)
+}
+
+// setFlagDefault sets the default of flag to its value in values, if any.
+func setFlagDefault(flag cli.Flag, values map[string]any) {
+	name := flag.Names()[0]
+	value, ok := values[name]
+	if !ok {
+		return
+	}
+
+	switch f := flag.(type) {
+	case *cli.StringFlag:
+		switch v := value.(type) {
+		case string:
+			f.Value = v
+		case []string:
+			f.Value = strings.Join(v, ",")
+		}
+	case *cli.StringSliceFlag:
+		if v, ok := value.([]string); ok {
+			f.Value = cli.NewStringSlice(v...)
+		}
+	case *cli.IntFlag:
+		if v, ok := value.(int); ok {
+			f.Value = v
+		}
+	case *cli.BoolFlag:
+		if v, ok := value.(bool); ok {
+			f.Value = v
+		}
+	case *cli.DurationFlag:
+		if v, ok := value.(time.Duration); ok {
+			f.Value = v
+		}
+	}
+}
+
+// loadConfigDefaults applies the config files to the flag defaults of the
+// commands, before their flags are parsed.
+func (a *App) loadConfigDefaults() error {
+	cfg, loaded, err := loadConfig(configPaths()...)
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return nil
+	}
+	a.logger.Debug().Strs("files", loaded).Msg("Loaded config")
+	applyConfig(a.cli.Commands, cfg)
+	return nil
+}
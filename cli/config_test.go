@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, configFile)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	home := writeConfig(t, t.TempDir(), `
+remote-host: perf@bench-01
+events: [cycles, instructions]
+ssh-persist: 10m
+perf-image: registry.example.com/perf:6.8
+`)
+	repo := writeConfig(t, t.TempDir(), `
+remote-host: perf@bench-02
+call-graph-auto: true
+env:
+  - GODEBUG=gctrace=1
+`)
+	empty := writeConfig(t, t.TempDir(), "")
+
+	cfg, loaded, err := loadConfig(home, filepath.Join(t.TempDir(), configFile), repo, empty)
+	require.NoError(t, err)
+	assert.Equal(t, []string{home, repo, empty}, loaded)
+
+	// Later files override earlier ones, keys they don't set are kept
+	assert.Equal(t, "perf@bench-02", cfg.RemoteHost)
+	assert.Equal(t, []string{"cycles", "instructions"}, cfg.Events)
+	require.NotNil(t, cfg.SSHPersist)
+	assert.Equal(t, 10*time.Minute, *cfg.SSHPersist)
+	assert.Equal(t, "registry.example.com/perf:6.8", cfg.PerfImage)
+	require.NotNil(t, cfg.CallGraphAuto)
+	assert.True(t, *cfg.CallGraphAuto)
+	assert.Equal(t, []string{"GODEBUG=gctrace=1"}, cfg.Env)
+
+	assert.Equal(t, map[string]any{
+		"remote-host":     "perf@bench-02",
+		"event":           []string{"cycles", "instructions"},
+		"ssh-persist":     10 * time.Minute,
+		"perf-image":      "registry.example.com/perf:6.8",
+		"call-graph-auto": true,
+		"env":             []string{"GODEBUG=gctrace=1"},
+	}, cfg.flagValues())
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "remote_host: perf@bench-01\n")
+	_, _, err := loadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse config "+path)
+	assert.Contains(t, err.Error(), "field remote_host not found")
+
+	path = writeConfig(t, t.TempDir(), "ssh-port: twenty-two\n")
+	_, _, err = loadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestConfig_FlagDefaults(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(history.EnvHome, home)
+	t.Chdir(t.TempDir())
+	writeConfig(t, home, `
+remote-host: perf@bench-01
+events: [cycles, instructions]
+gomaxprocs: 4
+call-graph-auto: true
+`)
+
+	type flags struct {
+		RemoteHost    string
+		Event         string
+		StatEvents    []string
+		GOMAXPROCS    int
+		CallGraphAuto bool
+	}
+	run := func(args ...string) flags {
+		var got flags
+		app := New()
+		for _, cmd := range app.cli.Commands {
+			if cmd.Name != "test" {
+				continue
+			}
+			for _, sub := range cmd.Subcommands {
+				sub.Action = func(ctx *cli.Context) error {
+					got = flags{
+						RemoteHost:    ctx.String("remote-host"),
+						GOMAXPROCS:    ctx.Int("gomaxprocs"),
+						CallGraphAuto: ctx.Bool("call-graph-auto"),
+					}
+					if ctx.Command.Name == "stat" {
+						got.StatEvents = ctx.StringSlice("event")
+					} else {
+						got.Event = ctx.String("event")
+					}
+					return nil
+				}
+			}
+		}
+		require.NoError(t, app.Run(append([]string{AppName, "test"}, args...)))
+		return got
+	}
+
+	assert.Equal(t, flags{
+		RemoteHost:    "perf@bench-01",
+		Event:         "cycles,instructions",
+		GOMAXPROCS:    4,
+		CallGraphAuto: true,
+	}, run("profile", "."))
+	assert.Equal(t, flags{
+		RemoteHost: "perf@bench-01",
+		StatEvents: []string{"cycles", "instructions"},
+		GOMAXPROCS: 4,
+	}, run("stat", "."))
+
+	// Flags given on the command line override the config
+	assert.Equal(t, flags{
+		RemoteHost:    "perf@bench-02",
+		Event:         "cache-misses",
+		GOMAXPROCS:    2,
+		CallGraphAuto: false,
+	}, run("profile", "--remote-host", "perf@bench-02", "-e", "cache-misses", "--gomaxprocs", "2", "--call-graph-auto=false", "."))
+	assert.Equal(t, flags{
+		RemoteHost: "perf@bench-01",
+		StatEvents: []string{"branch-misses"},
+		GOMAXPROCS: 4,
+	}, run("stat", "-e", "branch-misses", "."))
+}
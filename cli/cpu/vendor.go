@@ -0,0 +1,88 @@
+package cpu
+
+// vendor.go provides detection of the CPU vendor, which decides the perf
+// events available for memory sampling (e.g. IBS on AMD, PEBS on Intel).
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// CPU vendors as returned by DetectVendor.
+const (
+	VendorIntel   = "intel"
+	VendorAMD     = "amd"
+	VendorARM     = "arm"
+	VendorUnknown = "unknown"
+)
+
+// RunFunc runs a shell command and returns its stdout.
+type RunFunc func(command string) (string, error)
+
+// DetectVendor returns the CPU vendor of a system with the given GOOS and
+// GOARCH, reading /proc/cpuinfo or, on darwin, the machdep.cpu.vendor sysctl
+// through run.
+func DetectVendor(goos, goarch string, run RunFunc) string {
+	vendor := VendorUnknown
+	if goos == "darwin" {
+		// Apple silicon has no machdep.cpu.vendor
+		if out, err := run("sysctl -n machdep.cpu.vendor"); err == nil {
+			vendor = NormalizeVendor(out)
+		}
+	} else if out, err := run("cat /proc/cpuinfo"); err == nil {
+		vendor = ParseCPUInfo(out)
+	}
+
+	if vendor == VendorUnknown && (goarch == "arm64" || goarch == "arm") {
+		return VendorARM
+	}
+	return vendor
+}
+
+// DetectLocalVendor returns the CPU vendor of the local machine.
+func DetectLocalVendor() string {
+	return DetectVendor(runtime.GOOS, runtime.GOARCH, func(command string) (string, error) {
+		if command == "cat /proc/cpuinfo" {
+			data, err := os.ReadFile("/proc/cpuinfo")
+			return string(data), err
+		}
+		out, err := exec.Command("sh", "-c", command).Output()
+		return string(out), err
+	})
+}
+
+// ParseCPUInfo returns the CPU vendor from the contents of /proc/cpuinfo.
+// x86 systems report a vendor_id, arm systems a CPU implementer instead.
+func ParseCPUInfo(cpuinfo string) string {
+	scanner := bufio.NewScanner(strings.NewReader(cpuinfo))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "vendor_id":
+			return NormalizeVendor(value)
+		case "CPU implementer":
+			return VendorARM
+		}
+	}
+	return VendorUnknown
+}
+
+// NormalizeVendor converts a CPUID vendor string (e.g., GenuineIntel) to one
+// of the Vendor constants.
+func NormalizeVendor(vendorID string) string {
+	switch strings.TrimSpace(vendorID) {
+	case "GenuineIntel":
+		return VendorIntel
+	case "AuthenticAMD", "HygonGenuine":
+		// Hygon CPUs are Zen based and provide the same events as AMD
+		return VendorAMD
+	}
+	return VendorUnknown
+}
@@ -0,0 +1,72 @@
+package cpu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const intelCPUInfo = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 85
+model name	: Intel(R) Xeon(R) Gold 6248 CPU @ 2.50GHz
+flags		: fpu vme de pse tsc msr pae mce cx8 apic
+`
+
+const amdCPUInfo = `processor	: 0
+vendor_id	: AuthenticAMD
+cpu family	: 25
+model		: 1
+model name	: AMD EPYC 7763 64-Core Processor
+flags		: fpu vme de pse tsc msr pae mce cx8 apic ibs
+`
+
+const armCPUInfo = `processor	: 0
+BogoMIPS	: 243.75
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU part	: 0xd0c
+`
+
+func TestParseCPUInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuinfo string
+		want    string
+	}{
+		{"intel", intelCPUInfo, VendorIntel},
+		{"amd", amdCPUInfo, VendorAMD},
+		{"arm", armCPUInfo, VendorARM},
+		{"hygon", "vendor_id\t: HygonGenuine\n", VendorAMD},
+		{"empty", "", VendorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseCPUInfo(tt.cpuinfo))
+		})
+	}
+}
+
+func TestDetectVendor(t *testing.T) {
+	outputs := map[string]string{
+		"cat /proc/cpuinfo":            amdCPUInfo,
+		"sysctl -n machdep.cpu.vendor": "GenuineIntel\n",
+	}
+	run := func(command string) (string, error) {
+		out, ok := outputs[command]
+		if !ok {
+			return "", errors.New("unknown command")
+		}
+		return out, nil
+	}
+	failing := func(string) (string, error) { return "", errors.New("failed") }
+
+	assert.Equal(t, VendorAMD, DetectVendor("linux", "amd64", run))
+	assert.Equal(t, VendorIntel, DetectVendor("darwin", "amd64", run))
+	assert.Equal(t, VendorARM, DetectVendor("darwin", "arm64", failing))
+	assert.Equal(t, VendorUnknown, DetectVendor("linux", "amd64", failing))
+}
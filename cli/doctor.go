@@ -0,0 +1,276 @@
+package cli
+
+// This file contains the doctor command, which checks the prerequisites of
+// perfgo on the local machine and optionally on a remote host.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/urfave/cli/v2"
+
+	"github.com/perfgo/perfgo/cli/ssh"
+)
+
+// checkStatus is the outcome of a single doctor check.
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+// symbol returns the checklist marker of the status.
+func (s checkStatus) symbol() string {
+	switch s {
+	case checkOK:
+		return "✓"
+	case checkWarn:
+		return "!"
+	default:
+		return "✗"
+	}
+}
+
+// checkResult is the result of a single doctor check.
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	// Detail describes what was found (e.g., a version)
+	Detail string
+	// Hint describes how to fix a failed or warned check
+	Hint string
+}
+
+// shellExec runs a shell command on the checked host and returns its stdout
+// and stderr.
+type shellExec func(command string) (string, string, error)
+
+// doctorCheck checks a single prerequisite using exec.
+type doctorCheck func(exec shellExec) checkResult
+
+// localShellExec runs shell commands on the local machine.
+func (a *App) localShellExec(command string) (string, string, error) {
+	return a.cmdRunner().Run(context.Background(), "sh", "-c", command)
+}
+
+// remoteShellExec runs shell commands on the remote host through sh, as the
+// login shell of the remote user is not necessarily POSIX compatible.
+func remoteShellExec(client *ssh.Client) shellExec {
+	return func(command string) (string, string, error) {
+		return client.RunCommand("/bin/sh -c " + shellescape.Quote(command))
+	}
+}
+
+// checkTool checks that a tool is installed and reports the first line of
+// its version output. Missing optional tools only warn.
+func checkTool(name, versionCmd string, required bool, hint string) doctorCheck {
+	return func(exec shellExec) checkResult {
+		result := checkResult{Name: name}
+
+		if _, _, err := exec("command -v " + name); err != nil {
+			result.Status = checkWarn
+			if required {
+				result.Status = checkFail
+			}
+			result.Detail = "not found"
+			result.Hint = hint
+			return result
+		}
+
+		output, _, err := exec(versionCmd + " 2>&1")
+		if err != nil {
+			result.Status = checkWarn
+			result.Detail = "installed, but failed to get version"
+			return result
+		}
+		result.Detail = firstLine(output)
+		return result
+	}
+}
+
+// checkPerfParanoid checks that perf_event_paranoid allows profiling of the
+// user's processes.
+func checkPerfParanoid(exec shellExec) checkResult {
+	result := checkResult{Name: "perf_event_paranoid"}
+	const hint = "run 'sudo sysctl kernel.perf_event_paranoid=1' (add it to /etc/sysctl.d to persist)"
+
+	output, _, err := exec("cat /proc/sys/kernel/perf_event_paranoid")
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = "cannot read /proc/sys/kernel/perf_event_paranoid"
+		result.Hint = "perf events are only available on Linux"
+		return result
+	}
+
+	level, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		result.Status = checkFail
+		result.Detail = fmt.Sprintf("unexpected value %q", strings.TrimSpace(output))
+		return result
+	}
+
+	result.Detail = strconv.Itoa(level)
+	switch {
+	case level <= 1:
+		result.Status = checkOK
+	case level == 2:
+		result.Status = checkWarn
+		result.Detail += " (user space only, no kernel samples or c2c/mem)"
+		result.Hint = hint
+	default:
+		result.Status = checkFail
+		result.Detail += " (perf events disabled for unprivileged users)"
+		result.Hint = hint
+	}
+	return result
+}
+
+// perfProbeCommand records a few samples of a short running command into a
+// temporary file, which is removed afterwards.
+const perfProbeCommand = `f=$(mktemp) || exit 1; perf record -q -o "$f" -- sleep 0.1; rc=$?; rm -f "$f"; exit $rc`
+
+// checkPerfProbe checks that perf record can actually sample.
+func checkPerfProbe(exec shellExec) checkResult {
+	result := checkResult{Name: "perf record"}
+
+	if _, stderr, err := exec(perfProbeCommand); err != nil {
+		reason := firstLine(stderr)
+		if reason == "" {
+			reason = firstLine(err.Error())
+		}
+		result.Status = checkFail
+		result.Detail = "probe failed: " + reason
+		result.Hint = "check perf_event_paranoid and that perf matches the running kernel (linux-tools-$(uname -r))"
+		return result
+	}
+
+	result.Detail = "sampling works"
+	return result
+}
+
+// checkPerfKernelVersion checks that the version of perf matches the running
+// kernel, a perf built for another kernel may lack support for its events.
+func checkPerfKernelVersion(exec shellExec) checkResult {
+	result := checkResult{Name: "perf/kernel version"}
+
+	kernelRelease, perfVersion := detectVersions(exec)
+	if kernelRelease == "" || perfVersion == "" {
+		result.Status = checkWarn
+		result.Detail = "failed to detect kernel or perf version"
+		return result
+	}
+
+	result.Detail = fmt.Sprintf("perf %s, kernel %s", perfVersion, kernelRelease)
+	if majorMinor(perfVersion) != majorMinor(kernelRelease) {
+		result.Status = checkWarn
+		result.Hint = "install perf matching the running kernel (linux-tools-$(uname -r))"
+	}
+	return result
+}
+
+// perfChecks returns the checks of the perf setup shared by local and remote
+// hosts.
+func perfChecks() []doctorCheck {
+	return []doctorCheck{
+		checkTool("perf", "perf --version", true, "install perf, e.g. 'apt install linux-tools-$(uname -r)' or 'dnf install perf'"),
+		checkPerfKernelVersion,
+		checkPerfParanoid,
+		checkPerfProbe,
+	}
+}
+
+// localChecks returns the checks of the local machine. perf is only checked
+// on Linux, other systems have to profile on a remote host.
+func localChecks(goos string) []doctorCheck {
+	checks := []doctorCheck{
+		checkTool("go", "go version", true, "install Go from https://go.dev/dl/"),
+		checkTool("git", "git --version", true, "install git using your package manager"),
+		checkTool("ssh", "ssh -V", false, "install an OpenSSH client to use --remote-host"),
+		checkTool("kubectl", "kubectl version --client", false, "install kubectl to use perfgo attach"),
+	}
+	if goos == "linux" {
+		checks = append(checks, perfChecks()...)
+	}
+	return checks
+}
+
+// remoteChecks returns the checks of a remote host.
+func remoteChecks() []doctorCheck {
+	checks := []doctorCheck{
+		checkTool("tar", "tar --version", true, "install tar to sync the working tree"),
+		checkTool("rsync", "rsync --version", false, "install rsync for faster incremental syncs"),
+	}
+	return append(checks, perfChecks()...)
+}
+
+// runChecks runs all checks using exec.
+func runChecks(checks []doctorCheck, exec shellExec) []checkResult {
+	results := make([]checkResult, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, check(exec))
+	}
+	return results
+}
+
+// printChecklist prints the results under a heading and returns the number
+// of failed checks.
+func printChecklist(w io.Writer, heading string, results []checkResult) int {
+	failed := 0
+	fmt.Fprintf(w, "%s:\n", heading)
+	for _, result := range results {
+		fmt.Fprintf(w, "  %s %-20s %s\n", result.Status.symbol(), result.Name, result.Detail)
+		if result.Hint != "" {
+			fmt.Fprintf(w, "      hint: %s\n", result.Hint)
+		}
+		if result.Status == checkFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// firstLine returns the first non-empty line of s.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func (a *App) doctor(ctx *cli.Context) error {
+	if err := validateFlags(ctx); err != nil {
+		return err
+	}
+
+	failed := printChecklist(os.Stdout, "Local", runChecks(localChecks(runtime.GOOS), a.localShellExec))
+	if runtime.GOOS != "linux" {
+		fmt.Println("  perf checks skipped on " + runtime.GOOS + ", use --remote-host to check a Linux host")
+	}
+
+	if remoteHost := ctx.String("remote-host"); remoteHost != "" {
+		fmt.Println()
+		sshClient, err := ssh.New(a.logger, remoteHost, a.sshOptions(ctx)...)
+		if err != nil {
+			fmt.Printf("Remote (%s):\n  %s ssh connection failed: %v\n", remoteHost, checkFail.symbol(), err)
+			return fmt.Errorf("failed to connect to %s: %w", remoteHost, err)
+		}
+		defer sshClient.Close()
+
+		failed += printChecklist(os.Stdout, fmt.Sprintf("Remote (%s)", remoteHost), runChecks(remoteChecks(), remoteShellExec(sshClient)))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/perfgo/perfgo/cli/runner"
+)
+
+// fakeShell returns an App running local shell commands through a fake runner
+// answering each command with the given results. Unknown commands fail.
+func fakeShell(t *testing.T, results map[string]runner.Result) (*App, *runner.Fake) {
+	t.Helper()
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		require.Equal(t, "sh", cmd.Name)
+		require.Len(t, cmd.Args, 2)
+		if result, ok := results[cmd.Args[1]]; ok {
+			return result
+		}
+		return runner.Result{Err: errors.New("exit status 127")}
+	}}
+	return &App{logger: zerolog.Nop(), runner: fake}, fake
+}
+
+func TestCheckTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		results  map[string]runner.Result
+		want     checkResult
+	}{
+		{
+			name:     "installed",
+			required: true,
+			results: map[string]runner.Result{
+				"command -v go":   {Stdout: "/usr/bin/go\n"},
+				"go version 2>&1": {Stdout: "go version go1.24.6 linux/amd64\n"},
+			},
+			want: checkResult{Name: "go", Status: checkOK, Detail: "go version go1.24.6 linux/amd64"},
+		},
+		{
+			name:     "missing required",
+			required: true,
+			want:     checkResult{Name: "go", Status: checkFail, Detail: "not found", Hint: "install it"},
+		},
+		{
+			name: "missing optional",
+			want: checkResult{Name: "go", Status: checkWarn, Detail: "not found", Hint: "install it"},
+		},
+		{
+			name:     "version fails",
+			required: true,
+			results: map[string]runner.Result{
+				"command -v go": {Stdout: "/usr/bin/go\n"},
+			},
+			want: checkResult{Name: "go", Status: checkWarn, Detail: "installed, but failed to get version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := fakeShell(t, tt.results)
+			got := checkTool("go", "go version", tt.required, "install it")(app.localShellExec)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckPerfParanoid(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     runner.Result
+		wantStatus checkStatus
+		wantHint   bool
+	}{
+		{name: "unrestricted", result: runner.Result{Stdout: "-1\n"}, wantStatus: checkOK},
+		{name: "kernel profiling", result: runner.Result{Stdout: "1\n"}, wantStatus: checkOK},
+		{name: "user space only", result: runner.Result{Stdout: "2\n"}, wantStatus: checkWarn, wantHint: true},
+		{name: "disabled", result: runner.Result{Stdout: "4\n"}, wantStatus: checkFail, wantHint: true},
+		{name: "garbage", result: runner.Result{Stdout: "foo\n"}, wantStatus: checkFail},
+		{name: "unreadable", result: runner.Result{Err: errors.New("exit status 1")}, wantStatus: checkFail, wantHint: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := fakeShell(t, map[string]runner.Result{
+				"cat /proc/sys/kernel/perf_event_paranoid": tt.result,
+			})
+			got := checkPerfParanoid(app.localShellExec)
+			assert.Equal(t, "perf_event_paranoid", got.Name)
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.wantHint, got.Hint != "")
+		})
+	}
+}
+
+func TestCheckPerfProbe(t *testing.T) {
+	t.Run("samples", func(t *testing.T) {
+		app, fake := fakeShell(t, map[string]runner.Result{perfProbeCommand: {}})
+		got := checkPerfProbe(app.localShellExec)
+		assert.Equal(t, checkOK, got.Status)
+		require.Len(t, fake.Commands(), 1)
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		app, _ := fakeShell(t, map[string]runner.Result{perfProbeCommand: {
+			Stderr: "\nError:\nAccess to performance monitoring and observability operations is limited.\n",
+			Err:    errors.New("exit status 255"),
+		}})
+		got := checkPerfProbe(app.localShellExec)
+		assert.Equal(t, checkFail, got.Status)
+		assert.Equal(t, "probe failed: Error:", got.Detail)
+		assert.NotEmpty(t, got.Hint)
+	})
+}
+
+func TestCheckPerfKernelVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]runner.Result
+		want    checkResult
+	}{
+		{
+			name: "matching",
+			results: map[string]runner.Result{
+				"uname -r":            {Stdout: "6.8.0-45-generic\n"},
+				"perf --version 2>&1": {Stdout: "perf version 6.8.12\n"},
+			},
+			want: checkResult{Name: "perf/kernel version", Status: checkOK, Detail: "perf 6.8.12, kernel 6.8.0-45-generic"},
+		},
+		{
+			name: "mismatch",
+			results: map[string]runner.Result{
+				"uname -r":            {Stdout: "6.11.0-19-generic\n"},
+				"perf --version 2>&1": {Stdout: "perf version 6.8.12\n"},
+			},
+			want: checkResult{
+				Name:   "perf/kernel version",
+				Status: checkWarn,
+				Detail: "perf 6.8.12, kernel 6.11.0-19-generic",
+				Hint:   "install perf matching the running kernel (linux-tools-$(uname -r))",
+			},
+		},
+		{
+			name: "perf missing",
+			results: map[string]runner.Result{
+				"uname -r": {Stdout: "6.8.0-45-generic\n"},
+			},
+			want: checkResult{Name: "perf/kernel version", Status: checkWarn, Detail: "failed to detect kernel or perf version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := fakeShell(t, tt.results)
+			assert.Equal(t, tt.want, checkPerfKernelVersion(app.localShellExec))
+		})
+	}
+}
+
+func TestLocalChecks(t *testing.T) {
+	assert.Len(t, localChecks("linux"), 4+len(perfChecks()))
+	assert.Len(t, localChecks("darwin"), 4)
+}
+
+func TestPrintChecklist(t *testing.T) {
+	var buf bytes.Buffer
+	failed := printChecklist(&buf, "Local", []checkResult{
+		{Name: "go", Status: checkOK, Detail: "go1.24"},
+		{Name: "kubectl", Status: checkWarn, Detail: "not found", Hint: "install kubectl"},
+		{Name: "perf", Status: checkFail, Detail: "not found", Hint: "install perf"},
+	})
+
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "Local:\n"+
+		"  ✓ go                   go1.24\n"+
+		"  ! kubectl              not found\n"+
+		"      hint: install kubectl\n"+
+		"  ✗ perf                 not found\n"+
+		"      hint: install perf\n", buf.String())
+}
@@ -0,0 +1,87 @@
+package cli
+
+// This file contains handling of the environment variables passed to the
+// executed test binary with --env.
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/ssh"
+)
+
+// envNameRe matches the environment variable names that can be assigned in a
+// POSIX shell.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseEnvVars validates the KEY=VALUE assignments given with --flag.
+func parseEnvVars(flag string, values []string) ([]string, error) {
+	env := make([]string, 0, len(values))
+	for _, value := range values {
+		name, _, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --%s %q: must be KEY=VALUE", flag, value)
+		}
+		if !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid --%s %q: %q is not a valid variable name", flag, value, name)
+		}
+		env = append(env, value)
+	}
+	return env, nil
+}
+
+// localTestEnv returns the environment for a locally executed command, which
+// is inherited from perfgo with the --env assignments added. It returns nil,
+// which inherits the environment unchanged, if there are no assignments.
+func (a *App) localTestEnv() []string {
+	if len(a.testEnv) == 0 {
+		return nil
+	}
+	return append(os.Environ(), a.testEnv...)
+}
+
+// remoteEnvPrefix returns the shell assignments for env to prepend to a
+// remote command, with the values shell escaped.
+func remoteEnvPrefix(env []string) string {
+	var prefix strings.Builder
+	for _, assignment := range env {
+		name, value, _ := strings.Cut(assignment, "=")
+		prefix.WriteString(name)
+		prefix.WriteString("=")
+		prefix.WriteString(shellescape.Quote(value))
+		prefix.WriteString(" ")
+	}
+	return prefix.String()
+}
+
+// remoteTestCommand returns the remote command running command in workDir
+// with the --env assignments set, pinned to the --cpu-affinity CPUs.
+func (a *App) remoteTestCommand(workDir, command string) string {
+	if a.testCPUAffinity != "" {
+		command = fmt.Sprintf("taskset -c %s %s", shellescape.Quote(a.testCPUAffinity), command)
+	}
+	return fmt.Sprintf("cd %s && %s%s", shellescape.Quote(workDir), remoteEnvPrefix(a.testEnv), command)
+}
+
+// windowsTestCommand returns the remote command running binary with args in
+// workDir on a Windows host, with the --env assignments set.
+func (a *App) windowsTestCommand(workDir, binary string, args []string) string {
+	var script strings.Builder
+	fmt.Fprintf(&script, "Set-Location -LiteralPath %s; ", ssh.PowerShellQuote(workDir))
+	for _, assignment := range a.testEnv {
+		name, value, _ := strings.Cut(assignment, "=")
+		fmt.Fprintf(&script, "$env:%s = %s; ", name, ssh.PowerShellQuote(value))
+	}
+	script.WriteString("& ")
+	script.WriteString(ssh.PowerShellQuote(binary))
+	for _, arg := range args {
+		script.WriteString(" ")
+		script.WriteString(ssh.PowerShellQuote(arg))
+	}
+	// Pass on the exit code of the tests
+	script.WriteString("; exit $LASTEXITCODE")
+	return ssh.PowerShellCommand(script.String())
+}
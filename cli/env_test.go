@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvVars(t *testing.T) {
+	env, err := parseEnvVars("env", []string{"GOMAXPROCS=4", "FEATURE=a=b", "EMPTY="})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GOMAXPROCS=4", "FEATURE=a=b", "EMPTY="}, env)
+
+	for _, value := range []string{"NOVALUE", "=x", "1X=y", "A-B=c"} {
+		_, err := parseEnvVars("env", []string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRemoteTestCommand(t *testing.T) {
+	a := &App{}
+	assert.Equal(t, "cd /work/pkg && ./perfgo.test", a.remoteTestCommand("/work/pkg", "./perfgo.test"))
+
+	a.testEnv = []string{"GOMAXPROCS=4", "MSG=hello world", "Q=it's"}
+	assert.Equal(t,
+		`cd '/work/my pkg' && GOMAXPROCS=4 MSG='hello world' Q='it'"'"'s' perf stat -- ./perfgo.test`,
+		a.remoteTestCommand("/work/my pkg", "perf stat -- ./perfgo.test"),
+	)
+}
+
+func TestWindowsTestCommand(t *testing.T) {
+	a := &App{logger: zerolog.Nop(), runState: runState{testEnv: []string{"GOMAXPROCS=4", "Q=it's"}}}
+	command := a.windowsTestCommand("C:/work/my pkg", "C:/work/perfgo.test.exe", []string{"-test.run=^Foo$", "-test.v"})
+
+	encoded, ok := strings.CutPrefix(command, "powershell -NoProfile -NonInteractive -EncodedCommand ")
+	require.True(t, ok, command)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+
+	assert.Equal(t,
+		"Set-Location -LiteralPath 'C:/work/my pkg'; $env:GOMAXPROCS = '4'; $env:Q = 'it''s'; "+
+			"& 'C:/work/perfgo.test.exe' '-test.run=^Foo$' '-test.v'; exit $LASTEXITCODE",
+		string(utf16.Decode(units)),
+	)
+}
+
+func TestExecuteLocalTest_Env(t *testing.T) {
+	t.Setenv("PERFGO_TEST_INHERITED", "yes")
+	a := &App{logger: zerolog.Nop(), runState: runState{testEnv: []string{"PERFGO_TEST_ENV=hello world"}}}
+
+	// The assignment is added to the inherited environment
+	var stdout, stderr string
+	err := a.executeLocalTestWithOptions("/bin/sh", t.TempDir(), nil, []string{"-c", `echo "$PERFGO_TEST_ENV"; echo "$PERFGO_TEST_INHERITED"`}, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world\nyes\n", stdout)
+}
@@ -0,0 +1,179 @@
+package cli
+
+// This file contains the pre-flight check of requested perf events, which
+// fails a run before the test binary is built and copied, and the events
+// command listing the events of a host.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/urfave/cli/v2"
+)
+
+// eventLister returns the output of perf list on a host.
+type eventLister func() (string, error)
+
+// localEventLister runs perf list on the local machine.
+func localEventLister() (string, error) {
+	output, err := exec.Command("perf", "list").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run perf list: %w", err)
+	}
+	return string(output), nil
+}
+
+// remoteEventLister runs perf list on the host of the SSH client.
+func remoteEventLister(client *ssh.Client) eventLister {
+	return func() (string, error) {
+		output, _, err := client.RunCommand("perf list")
+		if err != nil {
+			return "", fmt.Errorf("failed to run perf list remotely: %w", err)
+		}
+		return output, nil
+	}
+}
+
+// requestedEvents returns the events given with -e, if any.
+func requestedEvents(events ...string) []string {
+	var requested []string
+	for _, event := range events {
+		if event != "" {
+			requested = append(requested, event)
+		}
+	}
+	return requested
+}
+
+// checkPerfEvents verifies that the requested events are available on host.
+// The perf list output is fetched once per host and run. Failing to list the
+// events is not fatal, perf reports unknown events itself later on.
+func (a *App) checkPerfEvents(host string, list eventLister, events []string) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	eventList, ok := a.perfEventLists[host]
+	if !ok {
+		output, err := list()
+		if err != nil {
+			a.logger.Warn().Err(err).Msg("Unable to list perf events, skipping event check")
+			return nil
+		}
+
+		eventList = perf.ParseEventList(output)
+		if a.perfEventLists == nil {
+			a.perfEventLists = make(map[string]*perf.EventList)
+		}
+		a.perfEventLists[host] = eventList
+	}
+
+	if eventList.Len() == 0 {
+		a.logger.Debug().Str("host", host).Msg("No perf events listed, skipping event check")
+		return nil
+	}
+
+	return eventList.Validate(events)
+}
+
+// eventsFlags returns the flags of the events command.
+func eventsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "remote-host",
+			Usage: "SSH host to list the events of instead of the local machine",
+		},
+		&cli.IntFlag{
+			Name:  "ssh-port",
+			Usage: "SSH port of the remote host",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-user",
+			Usage: "SSH login user for the remote host (overrides user@ in --remote-host)",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-jump",
+			Usage: "Bastion host(s) to reach the remote host through (ssh -J syntax)",
+		},
+		sshPersistFlag(),
+		commandTimeoutFlag(),
+		&cli.StringSliceFlag{
+			Name:  "category",
+			Usage: "List the events of a category: hardware, software, cache, raw, tracepoint, pmu or other (can be specified multiple times)",
+		},
+	}
+}
+
+// listEvents prints the recommended and available perf events of the local
+// machine or --remote-host.
+func (a *App) listEvents(ctx *cli.Context) error {
+	if err := validateFlags(ctx); err != nil {
+		return err
+	}
+
+	var categories []perf.EventCategory
+	for _, name := range ctx.StringSlice("category") {
+		category := perf.EventCategory(name)
+		if !slices.Contains(perf.EventCategories, category) {
+			return fmt.Errorf("unknown event category %q", name)
+		}
+		categories = append(categories, category)
+	}
+
+	host := "local"
+	list := eventLister(localEventLister)
+	if remoteHost := ctx.String("remote-host"); remoteHost != "" {
+		sshClient, err := ssh.New(a.logger, remoteHost, a.sshOptions(ctx)...)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", remoteHost, err)
+		}
+		defer sshClient.Close()
+		host = remoteHost
+		list = remoteEventLister(sshClient)
+	}
+
+	output, err := list()
+	if err != nil {
+		return err
+	}
+	eventList := perf.ParseEventList(output)
+	if eventList.Len() == 0 {
+		return fmt.Errorf("perf list printed no events on %s", host)
+	}
+
+	writeEventList(os.Stdout, host, eventList, categories)
+	return nil
+}
+
+// writeEventList prints the recommended events marked as supported or not,
+// the number of events of each category and the events of categories.
+func writeEventList(w io.Writer, host string, list *perf.EventList, categories []perf.EventCategory) {
+	fmt.Fprintf(w, "Recommended events (%s):\n", host)
+	for _, event := range perf.RecommendedEvents {
+		status := checkFail
+		if list.Listed(event.Name) {
+			status = checkOK
+		}
+		fmt.Fprintf(w, "  %s %-22s %s\n", status.symbol(), event.Name, event.Usage)
+	}
+
+	fmt.Fprintf(w, "\nAvailable events:\n")
+	for _, category := range perf.EventCategories {
+		if n := len(list.Category(category)); n > 0 {
+			fmt.Fprintf(w, "  %-12s %d\n", category, n)
+		}
+	}
+
+	for _, category := range categories {
+		fmt.Fprintf(w, "\n%s events:\n", strings.ToUpper(string(category[:1]))+string(category[1:]))
+		for _, name := range list.Category(category) {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+}
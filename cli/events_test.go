@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPerfEvents(t *testing.T) {
+	a := &App{logger: zerolog.Nop()}
+
+	calls := 0
+	list := func() (string, error) {
+		calls++
+		return "  cpu-cycles OR cycles                               [Hardware event]\n", nil
+	}
+
+	require.NoError(t, a.checkPerfEvents("bench", list, []string{"cycles"}))
+	err := a.checkPerfEvents("bench", list, []string{"cyclez"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did you mean: cycles")
+	assert.Equal(t, 1, calls, "perf list is run once per host")
+
+	// No events requested, perf list is not needed
+	require.NoError(t, a.checkPerfEvents("other", list, nil))
+	assert.Equal(t, 1, calls)
+
+	// Failing to list the events skips the check
+	failing := func() (string, error) { return "", errors.New("perf: command not found") }
+	require.NoError(t, a.checkPerfEvents("no-perf", failing, []string{"cyclez"}))
+}
+
+func TestWriteEventList(t *testing.T) {
+	list := perf.ParseEventList(`
+List of pre-defined events (to be used in -e or -M):
+
+  branch-instructions OR branches                    [Hardware event]
+  branch-misses                                      [Hardware event]
+  cpu-cycles OR cycles                               [Hardware event]
+  instructions                                       [Hardware event]
+  cpu-clock                                          [Software event]
+  L1-dcache-load-misses                              [Hardware cache event]
+  mem-loads OR cpu/mem-loads/                        [Kernel PMU event]
+  rNNN                                               [Raw hardware event descriptor]
+  sched:sched_switch                                 [Tracepoint event]
+  sched:sched_wakeup                                 [Tracepoint event]
+`)
+
+	var buf bytes.Buffer
+	writeEventList(&buf, "bench-01", list, []perf.EventCategory{perf.EventCategoryTracepoint})
+	assert.Equal(t, `Recommended events (bench-01):
+  ✓ cycles                 CPU time, where test profile spends its samples
+  ✓ instructions           Instructions per cycle (IPC) together with cycles
+  ✗ cache-references       Last level cache accesses
+  ✗ cache-misses           Last level cache misses of memory bound code
+  ✓ branch-misses          Mispredicted branches
+  ✓ L1-dcache-load-misses  Level 1 data cache misses, see examples/data-locality
+  ✓ mem-loads              Load latency sampling of test c2c and test mem on Intel
+  ✗ mem-stores             Store sampling of test c2c and test mem on Intel
+  ✗ ibs_op//               Instruction based sampling of test c2c and test mem on AMD
+  ✗ arm_spe_0//            Statistical profiling extension of test c2c and test mem on arm64
+
+Available events:
+  hardware     6
+  software     1
+  cache        1
+  raw          1
+  tracepoint   2
+  pmu          2
+
+Tracepoint events:
+  sched:sched_switch
+  sched:sched_wakeup
+`, buf.String())
+}
@@ -5,28 +5,63 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
 )
 
 func (a *App) executeLocalTest(binaryPath string, recordOpts *perf.RecordOptions, args []string, stdout, stderr *string) error {
-	return a.executeLocalTestWithOptions(binaryPath, recordOpts, args, stdout, stderr)
+	return a.executeLocalTestWithOptions(binaryPath, "", recordOpts, args, stdout, stderr)
 }
 
-func (a *App) executeLocalTestWithStatOptions(binaryPath string, statOpts perf.StatOptions, args []string, stdout, stderr *string) error {
+// testRunError returns the error to report for a test run that failed with
+// err. host names the remote host the test ran on, or is empty for the local
+// machine; underPerf reports whether the test ran under perf, in which case
+// a permission failure of perf takes precedence over the test's exit code.
+func (a *App) testRunError(err error, stderr, host string, underPerf bool) error {
+	if underPerf {
+		err = perf.CommandError(err, stderr, host)
+		if errors.Is(err, perf.ErrPermission) {
+			return err
+		}
+	}
+
+	// Test failures are expected to return non-zero exit codes
+	// Check if it's an ExitError (test failed) vs other errors
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		a.logger.Info().
+			Int("exit_code", exitErr.ExitCode()).
+			Msg("Tests completed with failures")
+		return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
+	}
+	if host != "" {
+		return fmt.Errorf("failed to execute remote test: %w", err)
+	}
+	return fmt.Errorf("failed to execute test: %w", err)
+}
+
+// executeLocalTestWithStatOptions runs the test binary under perf stat in
+// workDir, or the current directory if workDir is empty.
+func (a *App) executeLocalTestWithStatOptions(binaryPath, workDir string, statOpts perf.StatOptions, args []string, stdout, stderr *string) error {
 	a.logger.Debug().
 		Str("binary", binaryPath).
+		Str("work_dir", workDir).
 		Strs("args", args).
 		Msg("Starting local test execution with perf stat")
 
 	statOpts.Binary = binaryPath
 	statOpts.Args = args
 	perfArgs := perf.BuildStatArgs(statOpts)
-	cmd := exec.Command("perf", perfArgs...)
+	cmd := a.localTestCommand("perf", perfArgs...)
+	cmd.Dir = workDir
 
 	a.logger.Info().
 		Strs("events", statOpts.Events).
@@ -40,20 +75,12 @@ func (a *App) executeLocalTestWithStatOptions(binaryPath string, statOpts perf.S
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
 	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
 
-	if err := cmd.Run(); err != nil {
+	if err := a.cmdRunner().Stream(context.Background(), cmd); err != nil {
 		// Save captured output
 		*stdout = stdoutBuf.String()
 		*stderr = stderrBuf.String()
 
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
-		}
-		return fmt.Errorf("failed to execute test: %w", err)
+		return a.testRunError(err, *stderr, "", true)
 	}
 
 	// Save captured output
@@ -64,9 +91,12 @@ func (a *App) executeLocalTestWithStatOptions(binaryPath string, statOpts perf.S
 	return nil
 }
 
-func (a *App) executeLocalTestWithOptions(binaryPath string, recordOpts *perf.RecordOptions, args []string, stdout, stderr *string) error {
+// executeLocalTestWithOptions runs the test binary, optionally under perf
+// record, in workDir, or the current directory if workDir is empty.
+func (a *App) executeLocalTestWithOptions(binaryPath, workDir string, recordOpts *perf.RecordOptions, args []string, stdout, stderr *string) error {
 	logMsg := a.logger.Debug().
 		Str("binary", binaryPath).
+		Str("work_dir", workDir).
 		Strs("args", args)
 
 	if recordOpts != nil && recordOpts.Event != "" {
@@ -77,16 +107,46 @@ func (a *App) executeLocalTestWithOptions(binaryPath string, recordOpts *perf.Re
 	}
 	logMsg.Msg("Starting local test execution")
 
-	var cmd *exec.Cmd
+	var cmd runner.Cmd
 
 	if recordOpts != nil {
 		// Build perf record command
-		recordOpts.OutputPath = "perf.data"
+		if recordOpts.OutputPath == "" {
+			recordOpts.OutputPath = perfDataFile
+		}
 		recordOpts.Binary = binaryPath
 		recordOpts.Args = args
 
+		var control *os.File
+		if recordOpts.MaxDuration > 0 {
+			// Pass the read end of a pipe as the first extra file (fd 3)
+			ctlRead, ctlWrite, err := os.Pipe()
+			if err != nil {
+				return fmt.Errorf("failed to create perf control pipe: %w", err)
+			}
+			defer ctlRead.Close()
+			defer ctlWrite.Close()
+
+			recordOpts.ControlFD = 3
+			control = ctlRead
+
+			// Stop sampling once the limit is reached; the test keeps running
+			timer := time.AfterFunc(recordOpts.MaxDuration, func() {
+				a.logger.Info().
+					Dur("max_duration", recordOpts.MaxDuration).
+					Msg("Maximum record duration reached, disabling sampling")
+				if _, err := ctlWrite.WriteString("disable\n"); err != nil {
+					a.logger.Warn().Err(err).Msg("Failed to disable perf sampling")
+				}
+			})
+			defer timer.Stop()
+		}
+
 		perfArgs := perf.BuildRecordArgs(*recordOpts)
-		cmd = exec.Command("perf", perfArgs...)
+		cmd = a.localTestCommand("perf", perfArgs...)
+		if control != nil {
+			cmd.ExtraFiles = []*os.File{control}
+		}
 
 		logEvent := a.logger.Info()
 		if recordOpts.Event != "" {
@@ -98,8 +158,9 @@ func (a *App) executeLocalTestWithOptions(binaryPath string, recordOpts *perf.Re
 		logEvent.Msg("Wrapping test execution with perf record")
 	} else {
 		// Execute the test binary directly with arguments
-		cmd = exec.Command(binaryPath, args...)
+		cmd = a.localTestCommand(binaryPath, args...)
 	}
+	cmd.Dir = workDir
 
 	// Capture stdout and stderr for history
 	var stdoutBuf, stderrBuf bytes.Buffer
@@ -108,20 +169,12 @@ func (a *App) executeLocalTestWithOptions(binaryPath string, recordOpts *perf.Re
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
 	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
 
-	if err := cmd.Run(); err != nil {
+	if err := a.cmdRunner().Stream(context.Background(), cmd); err != nil {
 		// Save captured output
 		*stdout = stdoutBuf.String()
 		*stderr = stderrBuf.String()
 
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
-		}
-		return fmt.Errorf("failed to execute test: %w", err)
+		return a.testRunError(err, *stderr, "", recordOpts != nil)
 	}
 
 	// Save captured output
@@ -129,61 +182,41 @@ func (a *App) executeLocalTestWithOptions(binaryPath string, recordOpts *perf.Re
 	*stderr = stderrBuf.String()
 
 	if recordOpts != nil {
-		a.logger.Info().Str("output", "perf.data").Msg("Performance data collected")
+		a.logger.Info().Str("output", recordOpts.OutputPath).Msg("Performance data collected")
 	}
 
 	a.logger.Info().Msg("Tests completed successfully")
 	return nil
 }
 
-func (a *App) executeLocalTestWithC2COptions(binaryPath string, c2cOpts perf.C2COptions, reportOpts perf.C2CReportOptions, args []string, stdout, stderr *string) error {
-	a.logger.Debug().
-		Str("binary", binaryPath).
-		Strs("args", args).
-		Msg("Starting local test execution with perf c2c")
-
-	c2cOpts.Binary = binaryPath
-	c2cOpts.Args = args
-	perfArgs := perf.BuildC2CRecordArgs(c2cOpts)
-	cmd := exec.Command("perf", perfArgs...)
-
-	logMsg := a.logger.Info()
-	if c2cOpts.Event != "" {
-		logMsg.Str("event", c2cOpts.Event)
-		if c2cOpts.Count > 0 {
-			logMsg.Int("count", c2cOpts.Count)
+// profileLocalTest runs the test binary under perf record, writing
+// recordOpts.OutputPath, and converts the recording into the pprof profile
+// and binary artifacts of the run in runDir, once for each --repeat run.
+func (a *App) profileLocalTest(testBinary string, recordOpts *perf.RecordOptions, args []string, runDir string, history *model.History, stdout, stderr *string) error {
+	err := a.repeatProfile(runDir, history, func(profilePath string) error {
+		var runStdout, runStderr string
+		err := a.executeLocalTest(testBinary, recordOpts, args, &runStdout, &runStderr)
+		*stdout += runStdout
+		*stderr += runStderr
+		if err != nil {
+			a.logger.Error().Err(err).Msg("Local test execution failed")
+			return err
 		}
-	}
-	logMsg.Msg("Wrapping test execution with perf c2c record")
 
-	// Capture stdout and stderr for history
-	var stdoutBuf, stderrBuf bytes.Buffer
-
-	// Create multi-writers to both capture and display output
-	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
-	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
-
-	if err := cmd.Run(); err != nil {
-		// Save captured output
-		*stdout = stdoutBuf.String()
-		*stderr = stderrBuf.String()
-
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
+		// Process perf.data
+		binaryArtifacts, err := perf.ConvertPerfToPprof(a.logger, recordOpts.OutputPath, profilePath, runDir, history.ID, recordOpts.HasBranchStack())
+		if errors.Is(err, perf.ErrNoSamples) {
+			history.Warnings = append(history.Warnings, err.Error())
+		} else if err != nil {
+			a.logger.Error().Err(err).Msg("Failed to convert performance data to pprof")
+			return err
 		}
-		return fmt.Errorf("failed to execute test: %w", err)
+		registerBinaryArtifacts(history, binaryArtifacts)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	// Save captured output
-	*stdout = stdoutBuf.String()
-	*stderr = stderrBuf.String()
-
-	a.logger.Info().Str("output", "perf.data").Msg("C2C performance data collected")
-	a.logger.Info().Msg("Tests completed successfully")
+	a.savePerfData(nil, recordOpts.OutputPath, runDir, history)
 	return nil
 }
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePerf stands in for perf record: it writes a perf.data, starts the
+// workload and appends the command received on the control fd.
+const fakePerf = `#!/bin/sh
+out=perf.data
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o) out=$2; shift ;;
+	--control) ctl=${2#fd:}; shift ;;
+	--) shift; break ;;
+	esac
+	shift
+done
+echo sampling > "$out"
+"$@" &
+pid=$!
+eval "read -r cmd <&$ctl"
+echo "$cmd" >> "$out"
+wait "$pid"
+`
+
+func TestExecuteLocalTest_MaxDuration(t *testing.T) {
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(binDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "perf"), []byte(fakePerf), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The test binary outlives the sampling limit and fails
+	testBinary := filepath.Join(dir, "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("#!/bin/sh\nsleep 0.5\necho finished\nexit 3\n"), 0o755))
+
+	t.Chdir(dir)
+
+	a := &App{logger: zerolog.Nop()}
+	recordOpts := &perf.RecordOptions{MaxDuration: 50 * time.Millisecond}
+
+	var stdout, stderr string
+	err := a.executeLocalTest(testBinary, recordOpts, nil, &stdout, &stderr)
+	require.EqualError(t, err, "tests failed with exit code 3")
+	assert.Equal(t, "finished\n", stdout)
+
+	perfData, err := os.ReadFile(filepath.Join(dir, "perf.data"))
+	require.NoError(t, err)
+	assert.Equal(t, "sampling\ndisable\n", string(perfData))
+}
+
+func TestExecuteLocalTestWithStatOptions_Runner(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: "PASS\n", Stderr: " Performance counter stats\n"}
+	}}
+	a := &App{logger: zerolog.Nop(), runner: fake, runState: runState{testCPUAffinity: "2"}}
+
+	var stdout, stderr string
+	err := a.executeLocalTestWithStatOptions("./perfgo.test", "pkg", perf.StatOptions{Events: []string{"cycles"}}, []string{"-test.run=^$"}, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "PASS\n", stdout)
+	assert.Equal(t, " Performance counter stats\n", stderr)
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, "taskset", cmds[0].Name)
+	assert.Equal(t, "pkg", cmds[0].Dir)
+	assert.Equal(t, []string{"-c", "2", "perf", "stat", "-e", "cycles", "--", "./perfgo.test", "-test.run=^$"}, cmds[0].Args)
+}
+
+func TestExecuteLocalTest_PerfPermission(t *testing.T) {
+	paranoid := "Error:\nAccess to performance monitoring and observability operations is limited.\n"
+
+	tests := []struct {
+		name       string
+		recordOpts *perf.RecordOptions
+		wantErr    error
+	}{
+		{name: "perf record", recordOpts: &perf.RecordOptions{}, wantErr: perf.ErrPermission},
+		{name: "without perf", wantErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return runner.Result{Stderr: paranoid, Err: errors.New("exit status 255")}
+			}}
+			a := &App{logger: zerolog.Nop(), runner: fake}
+
+			var stdout, stderr string
+			err := a.executeLocalTest("./perfgo.test", tt.recordOpts, nil, &stdout, &stderr)
+			require.Error(t, err)
+			assert.Equal(t, paranoid, stderr)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NotErrorIs(t, err, perf.ErrPermission)
+			}
+		})
+	}
+}
+
+func TestExecuteLocalTestWithStatOptions_PerfPermission(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "Error:\nNo permission to enable cycles event.\n", Err: errors.New("exit status 255")}
+	}}
+	a := &App{logger: zerolog.Nop(), runner: fake}
+
+	var stdout, stderr string
+	err := a.executeLocalTestWithStatOptions("./perfgo.test", "", perf.StatOptions{}, nil, &stdout, &stderr)
+	require.ErrorIs(t, err, perf.ErrPermission)
+	assert.Contains(t, err.Error(), "on this machine")
+}
+
+// fakePerfPipeline stands in for the perf subcommands of a local profile run:
+// record writes the output file and runs the workload, script prints one
+// sample in the test binary given by $PERFGO_FAKE_BINARY.
+const fakePerfPipeline = `#!/bin/sh
+sub=$1; shift
+case "$sub" in
+record)
+	out=perf.data
+	while [ $# -gt 0 ]; do
+		case "$1" in
+		-o) out=$2; shift ;;
+		--) shift; break ;;
+		esac
+		shift
+	done
+	echo recorded > "$out"
+	"$@"
+	;;
+script)
+	printf 'perfgo.test 42 [000] 1.000000:     250000 cycles:\n\t          4a1b2c main.work+0x1c (%s)\n\n' "$PERFGO_FAKE_BINARY"
+	;;
+esac
+`
+
+func TestProfileLocalTest_LeavesWorkingDirectoryClean(t *testing.T) {
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(binDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "perf"), []byte(fakePerfPipeline), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	testBinary := filepath.Join(dir, "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("#!/bin/sh\necho PASS\n"), 0o755))
+	t.Setenv("PERFGO_FAKE_BINARY", testBinary)
+
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	runDir := t.TempDir()
+
+	a := &App{logger: zerolog.Nop()}
+	perfDataPath, cleanup, err := a.localPerfDataPath(false)
+	require.NoError(t, err)
+	assert.NotEqual(t, cwd, filepath.Dir(perfDataPath))
+
+	h := &model.History{ID: "0123456789abcdef"}
+	var stdout, stderr string
+	err = a.profileLocalTest(testBinary, &perf.RecordOptions{OutputPath: perfDataPath}, nil, runDir, h, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "PASS\n", stdout)
+	assert.FileExists(t, perfDataPath)
+	assert.FileExists(t, filepath.Join(runDir, "perf.pb.gz"))
+	require.Len(t, h.Artifacts, 1)
+	assert.Equal(t, model.ArtifactTypeTestBinary, h.Artifacts[0].Type)
+
+	cleanup()
+	assert.NoFileExists(t, perfDataPath)
+
+	entries, err := os.ReadDir(cwd)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "files created in the working directory")
+}
+
+func TestLocalPerfDataPath_InCWD(t *testing.T) {
+	a := &App{logger: zerolog.Nop()}
+	path, cleanup, err := a.localPerfDataPath(true)
+	require.NoError(t, err)
+	assert.Equal(t, "perf.data", path)
+	cleanup()
+}
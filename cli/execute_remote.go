@@ -5,84 +5,133 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"os/signal"
-	"syscall"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"al.essio.dev/pkg/shellescape"
 	"github.com/perfgo/perfgo/cli/perf"
 	"github.com/perfgo/perfgo/cli/ssh"
 )
 
+// remoteInterruptGrace is how long an interrupted remote command may take to
+// exit after it was signalled, e.g. while perf record writes perf.data, before
+// it is killed.
+var remoteInterruptGrace = 30 * time.Second
+
+// errInterrupted is returned by remote commands stopped by SIGINT or SIGTERM.
+var errInterrupted = errors.New("execution interrupted by user")
+
 // runRemoteCommandWithSignalHandling executes an SSH command with proper signal handling.
-// When SIGINT/SIGTERM is received, it sends the signal to the remote process and waits for it to terminate.
-func (a *App) runRemoteCommandWithSignalHandling(sshClient *ssh.Client, remoteCmd string, stdoutWriter, stderrWriter io.Writer) error {
+// The remote shell records its PID in pidFile, when SIGINT/SIGTERM is received the
+// processes it started (e.g. perf record) are interrupted through a second SSH command,
+// so they can finish their output and the caller's cleanup runs once they exited.
+// Without a pidFile (Windows hosts) the local ssh process is killed instead.
+func (a *App) runRemoteCommandWithSignalHandling(sshClient *ssh.Client, remoteCmd, pidFile string, stdoutWriter, stderrWriter io.Writer) error {
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	defer signal.Stop(sigChan)
-
-	// Build SSH command with -tt flag for TTY allocation which properly forwards signals
-	// -tt forces TTY allocation even when stdin is not a terminal
-	// -q suppresses SSH connection messages
-	args := []string{
-		"-o", fmt.Sprintf("ControlPath=%s", sshClient.ControlPath()),
-		"-o", "ControlMaster=auto",
-		"-tt", // Force TTY allocation to enable signal forwarding
-		"-q",  // Quiet mode - suppress connection messages
-		sshClient.Host(),
-		remoteCmd,
+	if a.handleSignals {
+		notifyInterrupt(sigChan)
+		defer signal.Stop(sigChan)
 	}
 
-	// Execute the command remotely
-	cmd := exec.Command("ssh", args...)
-	cmd.Stdout = stdoutWriter
-	cmd.Stderr = stderrWriter
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start remote command: %w", err)
+	if pidFile != "" {
+		remoteCmd = remotePIDCommand(pidFile, remoteCmd)
 	}
 
-	// Create a channel to wait for command completion
+	// Execute the command remotely, the TTY lets the test binary detect a
+	// terminal as when run locally. ssh runs in its own process group, as it
+	// would otherwise die on Ctrl-C before the remote process was stopped.
 	cmdDone := make(chan error, 1)
 	go func() {
-		cmdDone <- cmd.Wait()
+		cmdDone <- sshClient.RunContext(ctx, remoteCmd,
+			ssh.WithStdOut(stdoutWriter),
+			ssh.WithStdErr(stderrWriter),
+			ssh.WithTTY(true),
+			ssh.WithQuiet(),
+			ssh.WithNewProcessGroup(),
+		)
 	}()
 
 	// Wait for either signal or command completion
 	select {
-	case sig := <-sigChan:
-		a.logger.Info().Msg("Interrupt received, forwarding signal to remote process...")
-
-		// Forward the signal to the SSH process
-		// SSH with -t will forward the signal to the remote process
-		if cmd.Process != nil {
-			if err := cmd.Process.Signal(sig); err != nil {
-				a.logger.Warn().Err(err).Msg("Failed to send signal to SSH process")
-			}
-		}
+	case err := <-cmdDone:
+		return err
+	case <-sigChan:
+	}
 
-		// Wait for the command to actually finish
-		err := <-cmdDone
-		if err != nil {
-			// Check if it's an exit error (expected after interrupt)
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				a.logger.Debug().
-					Int("exit_code", exitErr.ExitCode()).
-					Msg("Remote process terminated after interrupt")
-			}
-		}
+	if pidFile == "" {
+		a.logger.Info().Msg("Interrupt received, stopping remote process...")
+		cancel()
+		<-cmdDone
+		return errInterrupted
+	}
 
-		a.logger.Info().Msg("Remote test execution stopped")
-		return fmt.Errorf("execution interrupted by user")
+	a.logger.Info().Msg("Interrupt received, stopping remote process (interrupt again to kill it)...")
+	a.signalRemote(sshClient, pidFile, "INT")
 
-	case err := <-cmdDone:
-		return err
+	timer := time.NewTimer(remoteInterruptGrace)
+	defer timer.Stop()
+
+	select {
+	case <-cmdDone:
+	case <-sigChan:
+		a.logger.Warn().Msg("Interrupted again, killing remote process")
+		a.killRemote(sshClient, pidFile, cancel, cmdDone)
+	case <-timer.C:
+		a.logger.Warn().Dur("grace", remoteInterruptGrace).Msg("Remote process did not stop in time, killing it")
+		a.killRemote(sshClient, pidFile, cancel, cmdDone)
 	}
+
+	a.logger.Info().Msg("Remote test execution stopped")
+	return errInterrupted
+}
+
+// killRemote kills the processes started by the remote shell and the local
+// ssh process, then waits for the command to return.
+func (a *App) killRemote(sshClient *ssh.Client, pidFile string, cancel context.CancelFunc, cmdDone <-chan error) {
+	a.signalRemote(sshClient, pidFile, "KILL")
+	cancel()
+	<-cmdDone
+}
+
+// signalRemote sends sig to the processes started by the remote shell whose
+// PID is recorded in pidFile.
+func (a *App) signalRemote(sshClient *ssh.Client, pidFile, sig string) {
+	if _, _, err := sshClient.RunCommand(remoteSignalCommand(pidFile, sig)); err != nil {
+		a.logger.Warn().Err(err).Str("signal", sig).Msg("Failed to signal remote process")
+	}
+}
+
+// remotePIDCommand prefixes remoteCmd with recording the PID of the remote
+// shell running it in pidFile.
+func remotePIDCommand(pidFile, remoteCmd string) string {
+	return fmt.Sprintf("echo $$ > %s && %s", shellescape.Quote(pidFile), remoteCmd)
+}
+
+// remoteSignalCommand returns the remote command sending sig to the children
+// of the shell whose PID is recorded in pidFile.
+func remoteSignalCommand(pidFile, sig string) string {
+	return fmt.Sprintf("pkill -%s -P \"$(cat %s)\"", sig, shellescape.Quote(pidFile))
+}
+
+// remotePIDFile returns the file the remote shell running the tests records
+// its PID in, or an empty string on Windows hosts.
+func remotePIDFile(sshClient *ssh.Client, remoteBaseDir string) string {
+	if sshClient.IsWindows() {
+		return ""
+	}
+	return path.Join(remoteBaseDir, "perfgo.pid")
 }
 
 func (a *App) executeRemoteTestInDir(sshClient *ssh.Client, remotePath, remoteDir, remoteBaseDir, packagePath string, recordOpts *perf.RecordOptions, args []string, stdout, stderr *string) error {
@@ -91,9 +140,9 @@ func (a *App) executeRemoteTestInDir(sshClient *ssh.Client, remotePath, remoteDi
 
 func (a *App) executeRemoteTestInDirWithStatOptions(sshClient *ssh.Client, remotePath, remoteDir, remoteBaseDir, packagePath string, statOpts perf.StatOptions, args []string, stdout, stderr *string) error {
 	// Construct the full working directory path
-	workDir := remoteDir
-	if packagePath != "." && packagePath != "" {
-		workDir = fmt.Sprintf("%s/%s", remoteDir, packagePath)
+	workDir, err := remoteWorkDir(remoteDir, packagePath)
+	if err != nil {
+		return err
 	}
 
 	a.logger.Debug().
@@ -108,7 +157,7 @@ func (a *App) executeRemoteTestInDirWithStatOptions(sshClient *ssh.Client, remot
 	statOpts.Binary = remotePath
 	statOpts.Args = args
 	perfCmd := perf.BuildStatCommand(statOpts)
-	remoteCmd := fmt.Sprintf("cd %s && %s", shellescape.Quote(workDir), perfCmd)
+	remoteCmd := a.remoteTestCommand(workDir, perfCmd)
 
 	a.logger.Info().
 		Strs("events", statOpts.Events).
@@ -123,20 +172,12 @@ func (a *App) executeRemoteTestInDirWithStatOptions(sshClient *ssh.Client, remot
 	stderrWriter := io.MultiWriter(os.Stderr, &stderrBuf)
 
 	// Execute the test binary remotely with signal handling
-	if err := a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, stdoutWriter, stderrWriter); err != nil {
+	if err := a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, remotePIDFile(sshClient, remoteBaseDir), stdoutWriter, stderrWriter); err != nil {
 		// Save captured output
 		*stdout = stdoutBuf.String()
 		*stderr = stderrBuf.String()
 
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
-		}
-		return fmt.Errorf("failed to execute remote test: %w", err)
+		return a.testRunError(err, *stderr, sshClient.Host(), true)
 	}
 
 	// Save captured output
@@ -149,9 +190,9 @@ func (a *App) executeRemoteTestInDirWithStatOptions(sshClient *ssh.Client, remot
 
 func (a *App) executeRemoteTestInDirWithOptions(sshClient *ssh.Client, remotePath, remoteDir, remoteBaseDir, packagePath string, recordOpts *perf.RecordOptions, args []string, stdout, stderr *string) error {
 	// Construct the full working directory path
-	workDir := remoteDir
-	if packagePath != "." && packagePath != "" {
-		workDir = fmt.Sprintf("%s/%s", remoteDir, packagePath)
+	workDir, err := remoteWorkDir(remoteDir, packagePath)
+	if err != nil {
+		return err
 	}
 
 	logMsg := a.logger.Debug().
@@ -180,7 +221,7 @@ func (a *App) executeRemoteTestInDirWithOptions(sshClient *ssh.Client, remotePat
 		recordOpts.Args = args
 
 		perfCmd := perf.BuildRecordCommand(*recordOpts)
-		remoteCmd = fmt.Sprintf("cd %s && %s", shellescape.Quote(workDir), perfCmd)
+		remoteCmd = a.remoteTestCommand(workDir, perfCmd)
 
 		logEvent := a.logger.Info().
 			Str("output", perfDataPath)
@@ -191,9 +232,11 @@ func (a *App) executeRemoteTestInDirWithOptions(sshClient *ssh.Client, remotePat
 			}
 		}
 		logEvent.Msg("Wrapping remote test execution with perf record")
+	} else if sshClient.IsWindows() {
+		remoteCmd = a.windowsTestCommand(workDir, remotePath, args)
 	} else {
 		// Direct execution without perf
-		remoteCmd = fmt.Sprintf("cd %s && %s", shellescape.Quote(workDir), shellescape.Quote(remotePath))
+		remoteCmd = a.remoteTestCommand(workDir, shellescape.Quote(remotePath))
 
 		// Append arguments for direct execution
 		if len(args) > 0 {
@@ -211,20 +254,12 @@ func (a *App) executeRemoteTestInDirWithOptions(sshClient *ssh.Client, remotePat
 	stderrWriter := io.MultiWriter(os.Stderr, &stderrBuf)
 
 	// Execute the test binary remotely with signal handling
-	if err := a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, stdoutWriter, stderrWriter); err != nil {
+	if err := a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, remotePIDFile(sshClient, remoteBaseDir), stdoutWriter, stderrWriter); err != nil {
 		// Save captured output
 		*stdout = stdoutBuf.String()
 		*stderr = stderrBuf.String()
 
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
-		}
-		return fmt.Errorf("failed to execute remote test: %w", err)
+		return a.testRunError(err, *stderr, sshClient.Host(), recordOpts != nil)
 	}
 
 	// Save captured output
@@ -242,72 +277,17 @@ func (a *App) executeRemoteTestInDirWithOptions(sshClient *ssh.Client, remotePat
 	return nil
 }
 
-func (a *App) executeRemoteTestInDirWithC2COptions(sshClient *ssh.Client, remotePath, remoteDir, remoteBaseDir, packagePath string, c2cOpts perf.C2COptions, reportOpts perf.C2CReportOptions, args []string, stdout, stderr *string) error {
-	// Construct the full working directory path
-	workDir := remoteDir
-	if packagePath != "." && packagePath != "" {
-		workDir = fmt.Sprintf("%s/%s", remoteDir, packagePath)
+// remoteWorkDir returns the directory of the package at packagePath within
+// the synced directory remoteDir. Package paths leaving the synced directory
+// are rejected. The result is not shell escaped, remote commands quote it as
+// a whole (see remoteTestCommand).
+func remoteWorkDir(remoteDir, packagePath string) (string, error) {
+	if packagePath == "." || packagePath == "" {
+		return remoteDir, nil
 	}
-
-	a.logger.Debug().
-		Str("host", sshClient.Host()).
-		Str("binary", remotePath).
-		Str("sync_dir", remoteDir).
-		Str("work_dir", workDir).
-		Str("package", packagePath).
-		Strs("args", args).
-		Msg("Starting remote test execution with perf c2c")
-
-	// Build perf c2c record command
-	perfDataPath := fmt.Sprintf("%s/perf.data", remoteBaseDir)
-	c2cOpts.OutputPath = perfDataPath
-	c2cOpts.Binary = remotePath
-	c2cOpts.Args = args
-	perfCmd := perf.BuildC2CRecordCommand(c2cOpts)
-	remoteCmd := fmt.Sprintf("cd %s && %s", shellescape.Quote(workDir), perfCmd)
-
-	logMsg := a.logger.Info().
-		Str("output", perfDataPath)
-	if c2cOpts.Event != "" {
-		logMsg.Str("event", c2cOpts.Event)
-		if c2cOpts.Count > 0 {
-			logMsg.Int("count", c2cOpts.Count)
-		}
-	}
-	logMsg.Msg("Wrapping remote test execution with perf c2c record")
-
-	// Capture stdout and stderr for history
-	var stdoutBuf, stderrBuf bytes.Buffer
-
-	// Create multi-writers to both capture and display output
-	stdoutWriter := io.MultiWriter(os.Stdout, &stdoutBuf)
-	stderrWriter := io.MultiWriter(os.Stderr, &stderrBuf)
-
-	// Execute the test binary remotely with signal handling
-	if err := a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, stdoutWriter, stderrWriter); err != nil {
-		// Save captured output
-		*stdout = stdoutBuf.String()
-		*stderr = stderrBuf.String()
-
-		// Test failures are expected to return non-zero exit codes
-		// Check if it's an ExitError (test failed) vs other errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			a.logger.Info().
-				Int("exit_code", exitErr.ExitCode()).
-				Msg("Tests completed with failures")
-			return fmt.Errorf("tests failed with exit code %d", exitErr.ExitCode())
-		}
-		return fmt.Errorf("failed to execute remote test: %w", err)
+	rel := path.Clean(filepath.ToSlash(packagePath))
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("package path %q is outside of the synced directory", packagePath)
 	}
-
-	// Save captured output
-	*stdout = stdoutBuf.String()
-	*stderr = stderrBuf.String()
-
-	a.logger.Info().
-		Str("output", perfDataPath).
-		Msg("C2C performance data collected on remote host")
-
-	a.logger.Info().Msg("Tests completed successfully")
-	return nil
+	return path.Join(remoteDir, rel), nil
 }
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteWorkDir(t *testing.T) {
+	tests := []struct {
+		packagePath string
+		want        string
+		wantErr     bool
+	}{
+		{packagePath: "", want: "/cache/repo"},
+		{packagePath: ".", want: "/cache/repo"},
+		{packagePath: "./pkg/foo", want: "/cache/repo/pkg/foo"},
+		{packagePath: "pkg/foo/../bar", want: "/cache/repo/pkg/bar"},
+		{packagePath: "my pkg; rm -rf ~", want: "/cache/repo/my pkg; rm -rf ~"},
+		{packagePath: "../other", wantErr: true},
+		{packagePath: "pkg/../../other", wantErr: true},
+		{packagePath: "/etc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.packagePath, func(t *testing.T) {
+			got, err := remoteWorkDir("/cache/repo", tt.packagePath)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRemoteTestCommand_PackagePathQuoting(t *testing.T) {
+	remoteDir := t.TempDir()
+	a := &App{logger: zerolog.Nop(), runState: runState{testEnv: []string{"GOGC=off"}}}
+
+	for _, packagePath := range []string{"my pkg", "pkg;touch injected", "pkg$(touch injected)", "it's `here`"} {
+		t.Run(packagePath, func(t *testing.T) {
+			require.NoError(t, os.MkdirAll(filepath.Join(remoteDir, packagePath), 0o755))
+
+			workDir, err := remoteWorkDir(remoteDir, packagePath)
+			require.NoError(t, err)
+			cmd := a.remoteTestCommand(workDir, "pwd")
+
+			// The shell changes into the package directory and runs nothing else
+			sh := exec.Command("sh", "-c", cmd)
+			sh.Dir = remoteDir
+			out, err := sh.Output()
+			require.NoError(t, err, cmd)
+			assert.Equal(t, filepath.Join(remoteDir, packagePath)+"\n", string(out))
+			assert.NoFileExists(t, filepath.Join(remoteDir, "injected"))
+		})
+	}
+}
+
+// interruptibleRemote returns an SSH client whose remote test command runs
+// until it is sent one of the stopOn signals through pkill, and a channel
+// closed once the test command started.
+func interruptibleRemote(t *testing.T, stopOn ...string) (*ssh.Client, *runner.Fake, <-chan struct{}) {
+	t.Helper()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	started, stopped := make(chan struct{}), make(chan struct{})
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		command := cmd.Args[len(cmd.Args)-1]
+		switch {
+		case strings.HasPrefix(command, "echo $$ > "):
+			close(started)
+			<-stopped
+			return runner.Result{Stdout: "PASS\n", Err: errors.New("exit status 130")}
+		case strings.HasPrefix(command, "pkill "):
+			for _, sig := range stopOn {
+				if strings.HasPrefix(command, "pkill -"+sig+" ") {
+					close(stopped)
+				}
+			}
+		}
+		return runner.Result{}
+	}}
+
+	client, err := ssh.New(zerolog.Nop(), "bench", ssh.WithRunner(fake))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client, fake, started
+}
+
+// captureInterrupts replaces the signal notification with one handing out
+// the channel, so tests can deliver interrupts.
+func captureInterrupts(t *testing.T) <-chan chan<- os.Signal {
+	t.Helper()
+
+	channels := make(chan chan<- os.Signal, 1)
+	orig := notifyInterrupt
+	notifyInterrupt = func(c chan<- os.Signal) { channels <- c }
+	t.Cleanup(func() { notifyInterrupt = orig })
+	return channels
+}
+
+// remoteSignals returns the signals sent to remote processes through pkill.
+func remoteSignals(fake *runner.Fake) []string {
+	var signals []string
+	for _, cmd := range fake.Commands() {
+		if sig, ok := strings.CutPrefix(cmd.Args[len(cmd.Args)-1], "pkill -"); ok {
+			signals = append(signals, sig)
+		}
+	}
+	return signals
+}
+
+func TestRunRemoteCommandWithSignalHandling_Interrupt(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopOn      []string
+		interrupts  int
+		wantSignals []string
+	}{
+		{
+			name:        "interrupt stops remote process",
+			stopOn:      []string{"INT", "KILL"},
+			interrupts:  1,
+			wantSignals: []string{`INT -P "$(cat /cache/perfgo.pid)"`},
+		},
+		{
+			name:       "second interrupt kills remote process",
+			stopOn:     []string{"KILL"},
+			interrupts: 2,
+			wantSignals: []string{
+				`INT -P "$(cat /cache/perfgo.pid)"`,
+				`KILL -P "$(cat /cache/perfgo.pid)"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interrupts := captureInterrupts(t)
+			client, fake, started := interruptibleRemote(t, tt.stopOn...)
+			a := &App{logger: zerolog.Nop(), runState: runState{handleSignals: true}}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- a.runRemoteCommandWithSignalHandling(client, "cd /cache/repo && ./test.bin", "/cache/perfgo.pid", io.Discard, io.Discard)
+			}()
+
+			sigs := <-interrupts
+			<-started
+			for range tt.interrupts {
+				sigs <- os.Interrupt
+			}
+
+			require.ErrorIs(t, <-done, errInterrupted)
+			assert.Equal(t, tt.wantSignals, remoteSignals(fake))
+		})
+	}
+}
+
+func TestRunRemoteCommandWithSignalHandling_KillsAfterGrace(t *testing.T) {
+	orig := remoteInterruptGrace
+	remoteInterruptGrace = 10 * time.Millisecond
+	t.Cleanup(func() { remoteInterruptGrace = orig })
+
+	interrupts := captureInterrupts(t)
+	client, fake, started := interruptibleRemote(t, "KILL")
+	a := &App{logger: zerolog.Nop(), runState: runState{handleSignals: true}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.runRemoteCommandWithSignalHandling(client, "./test.bin", "/cache/perfgo.pid", io.Discard, io.Discard)
+	}()
+	sigs := <-interrupts
+	<-started
+	sigs <- os.Interrupt
+
+	require.ErrorIs(t, <-done, errInterrupted)
+	assert.Equal(t, []string{`INT -P "$(cat /cache/perfgo.pid)"`, `KILL -P "$(cat /cache/perfgo.pid)"`}, remoteSignals(fake))
+}
+
+func TestExecuteRemoteTest_InterruptReturnsForCleanup(t *testing.T) {
+	interrupts := captureInterrupts(t)
+	client, fake, started := interruptibleRemote(t, "INT")
+	a := &App{logger: zerolog.Nop(), runState: runState{handleSignals: true}}
+
+	// The run returns after the remote perf record stopped, so the callers'
+	// deferred cleanup (removing the remote directory, recording the history)
+	// runs with the captured output
+	var stdout, stderr string
+	done := make(chan error, 1)
+	go func() {
+		done <- a.executeRemoteTestInDir(client, "/cache/test.bin", "/cache/repo", "/cache", ".", &perf.RecordOptions{}, nil, &stdout, &stderr)
+	}()
+	sigs := <-interrupts
+	<-started
+	sigs <- syscall.SIGTERM
+
+	require.ErrorIs(t, <-done, errInterrupted)
+	assert.Equal(t, "PASS\n", stdout)
+
+	var testCmd []string
+	for _, cmd := range fake.Commands() {
+		if strings.HasPrefix(cmd.Args[len(cmd.Args)-1], "echo $$") {
+			testCmd = cmd.Args
+		}
+	}
+	require.NotNil(t, testCmd)
+	assert.Contains(t, testCmd, "-q")
+	assert.True(t, strings.HasPrefix(testCmd[len(testCmd)-1], "echo $$ > /cache/perfgo.pid && cd /cache/repo && "))
+	assert.Contains(t, testCmd[len(testCmd)-1], "perf record")
+	assert.Equal(t, []string{`INT -P "$(cat /cache/perfgo.pid)"`}, remoteSignals(fake))
+}
+
+func TestRemoteSignalCommand_StopsRecordedShellChildren(t *testing.T) {
+	if _, err := exec.LookPath("pkill"); err != nil {
+		t.Skip("pkill not available")
+	}
+	pidFile := filepath.Join(t.TempDir(), "perfgo pid")
+
+	cmd := exec.Command("sh", "-c", remotePIDCommand(pidFile, "sleep 30"))
+	require.NoError(t, cmd.Start())
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		return err == nil && strings.TrimSpace(string(data)) != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Give the shell time to start its child
+	require.Eventually(t, func() bool {
+		return exec.Command("sh", "-c", remoteSignalCommand(pidFile, "INT")).Run() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("remote command was not interrupted")
+	}
+}
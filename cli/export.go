@@ -0,0 +1,271 @@
+package cli
+
+// This file contains the export and import commands, which bundle a run of
+// the history with its artifacts into a tarball to share it with others.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+func (a *App) export(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: perfgo export <ID|INDEX> <out.tar.gz>")
+	}
+
+	entry, err := a.resolveEntry(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	out := ctx.Args().Get(1)
+	if err := exportEntry(entry, out); err != nil {
+		return err
+	}
+	fmt.Printf("Exported run %s to %s\n", entry.History.ID[:8], out)
+	return nil
+}
+
+func (a *App) importRun(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("usage: perfgo import <in.tar.gz>")
+	}
+
+	perfgoRoot, err := history.Root(a.outputDir)
+	if err != nil {
+		return err
+	}
+
+	runDir, err := a.importEntry(ctx.Args().First(), perfgoRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported run to %s\n", runDir)
+	return nil
+}
+
+// exportEntry writes the history.json and the artifacts of entry into a gzip
+// compressed tarball at out, below a directory named like the run directory.
+// Binaries kept in the object store are included with their content.
+func exportEntry(entry *history.Entry, out string) (retErr error) {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("failed to close archive: %w", err)
+		}
+		if retErr != nil {
+			os.Remove(out)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	dir := filepath.Base(entry.FullPath)
+
+	// Runs in the legacy format are exported converted to history.json
+	h := entry.History
+	h.SchemaVersion = model.HistorySchemaVersion
+	metadata, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Join(dir, "history.json"),
+		Mode:    0644,
+		Size:    int64(len(metadata)),
+		ModTime: h.Timestamp,
+	}); err != nil {
+		return fmt.Errorf("failed to write history.json to archive: %w", err)
+	}
+	if _, err := tw.Write(metadata); err != nil {
+		return fmt.Errorf("failed to write history.json to archive: %w", err)
+	}
+
+	for _, artifact := range h.Artifacts {
+		if err := addArchiveFile(tw, resolveArtifactPath(entry.FullPath, artifact), path.Join(dir, artifact.File)); err != nil {
+			return fmt.Errorf("failed to add artifact %s to archive: %w", artifact.File, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// addArchiveFile adds the file at src, following symlinks to stored objects,
+// to the tarball as name.
+func addArchiveFile(tw *tar.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// importEntry unpacks a tarball written by exportEntry into a new run
+// directory of the history in perfgoRoot and returns its path. Binaries are
+// moved into the local object store.
+func (a *App) importEntry(archive, perfgoRoot string) (string, error) {
+	historyDir := filepath.Join(perfgoRoot, "history")
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	// Unpack into a hidden directory first, so a failed import leaves no run
+	// behind
+	stagingDir, err := os.MkdirTemp(historyDir, ".import-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create import directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := extractArchive(archive, stagingDir); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(stagingDir, "history.json"))
+	if err != nil {
+		return "", fmt.Errorf("archive %s contains no history.json: %w", archive, err)
+	}
+	var h model.History
+	if err := json.Unmarshal(data, &h); err != nil {
+		return "", fmt.Errorf("failed to parse history.json of archive %s: %w", archive, err)
+	}
+	if err := validateImportedHistory(&h); err != nil {
+		return "", fmt.Errorf("archive %s: %w", archive, err)
+	}
+	for _, artifact := range h.Artifacts {
+		if _, err := os.Stat(filepath.Join(stagingDir, artifact.File)); err != nil {
+			return "", fmt.Errorf("archive %s is missing artifact %s", archive, artifact.File)
+		}
+	}
+
+	runDir := filepath.Join(historyDir, runDirName(&h))
+	if _, err := os.Stat(runDir); err == nil {
+		return "", fmt.Errorf("run %s is already in the history at %s", h.ID[:8], runDir)
+	}
+	if err := os.Chmod(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to set permissions of imported run: %w", err)
+	}
+	if err := os.Rename(stagingDir, runDir); err != nil {
+		return "", fmt.Errorf("failed to move imported run into history: %w", err)
+	}
+
+	a.internBinaries(runDir, &h)
+	if err := writeHistoryMetadata(runDir, &h); err != nil {
+		return "", err
+	}
+	return runDir, nil
+}
+
+// Run IDs are 16 random bytes hex encoded, commits are hex object names.
+var (
+	historyIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	gitCommitRe = regexp.MustCompile(`^[0-9a-f]{8,64}$`)
+)
+
+// validateImportedHistory checks the parts of an imported history.json that
+// name files, before they are used as paths in the local history.
+func validateImportedHistory(h *model.History) error {
+	if !historyIDRe.MatchString(h.ID) {
+		return fmt.Errorf("invalid run ID %q", h.ID)
+	}
+	if h.Git != nil && h.Git.Commit != "" && !gitCommitRe.MatchString(h.Git.Commit) {
+		return fmt.Errorf("invalid git commit %q", h.Git.Commit)
+	}
+	for _, artifact := range h.Artifacts {
+		if !filepath.IsLocal(artifact.File) || artifact.File != filepath.Base(artifact.File) {
+			return fmt.Errorf("invalid artifact file %q", artifact.File)
+		}
+	}
+	return nil
+}
+
+// extractArchive unpacks the files of a tarball written by exportEntry into
+// dir, stripping the run directory. Entries outside of the run directory are
+// rejected.
+func extractArchive(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read archive %s: %w", archive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %s: %w", archive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		_, name, _ := strings.Cut(header.Name, "/")
+		if !filepath.IsLocal(name) || name != filepath.Base(name) {
+			return fmt.Errorf("archive %s contains unexpected file %s", archive, header.Name)
+		}
+
+		if err := extractFile(tr, filepath.Join(dir, name), os.FileMode(header.Mode).Perm()&0755); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+}
+
+// extractFile writes the content of r to a new file at path.
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
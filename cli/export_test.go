@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	a := &App{logger: zerolog.Nop()}
+
+	// A profiled run whose binary is kept in the object store
+	srcRoot := t.TempDir()
+	h := &model.History{
+		ID:        "0123456789abcdef0123456789abcdef",
+		Type:      model.HistoryTypeTest,
+		Timestamp: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		Args:      []string{"perfgo", "test", "profile", "./pkg"},
+		Git:       &model.Git{Commit: "1a2b3c4d5e6f", Branch: "main"},
+		Perf:      &model.Perf{Record: &model.PerfRecord{Event: "cycles"}},
+	}
+	runDir := filepath.Join(srcRoot, "history", runDirName(h))
+	require.NoError(t, os.MkdirAll(runDir, 0o755))
+	testBinary := filepath.Join(t.TempDir(), "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("test binary"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "perf.pb.gz"), []byte("profile"), 0o644))
+	require.NoError(t, a.recordHistory(h, runDir, testBinary, "PASS\n", ""))
+
+	// Only a link to the stored binary is left in the run directory
+	var binary model.Artifact
+	for _, artifact := range h.Artifacts {
+		if artifact.Type == model.ArtifactTypeTestBinary {
+			binary = artifact
+		}
+	}
+	require.NotEmpty(t, binary.Hash)
+	require.NoError(t, os.Remove(filepath.Join(runDir, binary.File)))
+
+	entries, err := history.LoadEntries(zerolog.Nop(), srcRoot)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	archive := filepath.Join(t.TempDir(), "run.tar.gz")
+	require.NoError(t, exportEntry(&entries[0], archive))
+
+	dstRoot := t.TempDir()
+	importedDir, err := a.importEntry(archive, dstRoot)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dstRoot, "history", "20260102-150405-1a2b3c4d-01234567"), importedDir)
+
+	imported, err := history.LoadEntries(zerolog.Nop(), dstRoot)
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+	assert.Equal(t, entries[0].History, imported[0].History)
+
+	for _, artifact := range imported[0].History.Artifacts {
+		want, err := os.ReadFile(resolveArtifactPath(runDir, artifact))
+		require.NoError(t, err)
+		got, err := os.ReadFile(resolveArtifactPath(importedDir, artifact))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, artifact.File)
+	}
+
+	// The binary was moved into the local object store
+	_, err = os.Stat(objectPath(filepath.Join(dstRoot, "objects"), binary.Hash, false))
+	assert.NoError(t, err)
+
+	// Importing the same run twice fails
+	_, err = a.importEntry(archive, dstRoot)
+	assert.ErrorContains(t, err, "run 01234567 is already in the history")
+}
+
+func TestImport_RejectsUnexpectedFiles(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.tar.gz")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "run/../../escape", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	a := &App{logger: zerolog.Nop()}
+	dstRoot := t.TempDir()
+	_, err = a.importEntry(archive, dstRoot)
+	require.ErrorContains(t, err, "contains unexpected file run/../../escape")
+
+	// Nothing is left in the history
+	dirs, err := os.ReadDir(filepath.Join(dstRoot, "history"))
+	require.NoError(t, err)
+	assert.Empty(t, dirs)
+}
+
+func TestImport_RejectsInvalidHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		history string
+		wantErr string
+	}{
+		{
+			name:    "short ID",
+			history: `{"id":"abc"}`,
+			wantErr: `invalid run ID "abc"`,
+		},
+		{
+			name:    "ID with path separators",
+			history: `{"id":"../../0123456789abcdef01234567"}`,
+			wantErr: `invalid run ID`,
+		},
+		{
+			name:    "commit with path separators",
+			history: `{"id":"0123456789abcdef0123456789abcdef","git":{"commit":"../../x"}}`,
+			wantErr: `invalid git commit "../../x"`,
+		},
+		{
+			name:    "artifact outside of the run",
+			history: `{"id":"0123456789abcdef0123456789abcdef","artifacts":[{"file":"../../objects/x"}]}`,
+			wantErr: `invalid artifact file "../../objects/x"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "run.tar.gz")
+			f, err := os.Create(archive)
+			require.NoError(t, err)
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "run/history.json", Mode: 0o644, Size: int64(len(tt.history)), Typeflag: tar.TypeReg}))
+			_, err = tw.Write([]byte(tt.history))
+			require.NoError(t, err)
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+			require.NoError(t, f.Close())
+
+			a := &App{logger: zerolog.Nop()}
+			dstRoot := t.TempDir()
+			_, err = a.importEntry(archive, dstRoot)
+			require.ErrorContains(t, err, tt.wantErr)
+
+			dirs, err := os.ReadDir(filepath.Join(dstRoot, "history"))
+			require.NoError(t, err)
+			assert.Empty(t, dirs)
+		})
+	}
+}
@@ -7,24 +7,83 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"github.com/perfgo/perfgo/model"
 )
 
-func (a *App) getGitInfo() (commit, branch string, err error) {
+// getGitInfo returns the commit, branch and worktree state of the git
+// repository containing the current directory. In detached HEAD state the
+// branch is left empty and the closest tag (or abbreviated commit) is
+// recorded instead.
+func (a *App) getGitInfo() (*model.Git, error) {
 	// Get current commit hash
-	cmd := exec.Command("git", "rev-parse", "HEAD")
-	output, err := cmd.Output()
+	commit, err := gitOutput("rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git commit: %w", err)
+	}
+	info := &model.Git{Commit: commit}
+
+	// Get current branch, rev-parse prints HEAD when detached
+	branch, err := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git branch: %w", err)
+	}
+	if branch != "HEAD" {
+		info.Branch = branch
+	} else if describe, err := gitOutput("describe", "--tags", "--always"); err == nil {
+		info.Describe = describe
+	} else {
+		a.logger.Debug().Err(err).Msg("Failed to describe detached HEAD")
+	}
+
+	status, err := gitOutput("status", "--porcelain")
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get git commit: %w", err)
+		return nil, fmt.Errorf("failed to get git status: %w", err)
 	}
-	commit = strings.TrimSpace(string(output))
+	info.Dirty = isDirtyStatus(status)
 
-	// Get current branch
-	cmd = exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	output, err = cmd.Output()
+	return info, nil
+}
+
+// isDirtyStatus reports whether git status --porcelain output lists any
+// tracked or untracked change. The .perfgo directory written by perfgo itself
+// is ignored, otherwise every run after the first would be dirty.
+func isDirtyStatus(status string) bool {
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		path := strings.Trim(line[3:], `"`)
+		if path == ".perfgo/" || strings.HasPrefix(path, ".perfgo/") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// gitOutput runs git with args and returns its output without trailing
+// newlines. Leading spaces are kept as they are significant in git status.
+func gitOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get git branch: %w", err)
+		return "", err
 	}
-	branch = strings.TrimSpace(string(output))
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
 
-	return commit, branch, nil
+// gitRefSuffix returns the branch or detached HEAD description and the dirty
+// marker printed after the commit, e.g. " (main) (dirty)".
+func gitRefSuffix(info *model.Git) string {
+	var suffix string
+	switch {
+	case info.Branch != "":
+		suffix = fmt.Sprintf(" (%s)", info.Branch)
+	case info.Describe != "":
+		suffix = fmt.Sprintf(" (detached at %s)", info.Describe)
+	}
+	if info.Dirty {
+		suffix += " (dirty)"
+	}
+	return suffix
 }
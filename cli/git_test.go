@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGitRepo creates a git repository with one tagged commit in a temporary
+// directory and changes into it.
+func newGitRepo(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	runGit(t, "init", "-q", "-b", "main")
+	runGit(t, "config", "user.email", "test@example.com")
+	runGit(t, "config", "user.name", "test")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	runGit(t, "add", "main.go")
+	runGit(t, "commit", "-q", "-m", "initial")
+	runGit(t, "tag", "v1.0.0")
+}
+
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+	output, err := gitOutput(args...)
+	require.NoError(t, err, "git %v", args)
+	return output
+}
+
+func TestGetGitInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		want  func(commit string) *model.Git
+	}{
+		{
+			name:  "clean",
+			setup: func(t *testing.T) {},
+			want: func(commit string) *model.Git {
+				return &model.Git{Commit: commit, Branch: "main"}
+			},
+		},
+		{
+			name: "dirty tracked file",
+			setup: func(t *testing.T) {
+				require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nfunc main() {}\n"), 0644))
+			},
+			want: func(commit string) *model.Git {
+				return &model.Git{Commit: commit, Branch: "main", Dirty: true}
+			},
+		},
+		{
+			name: "dirty untracked file",
+			setup: func(t *testing.T) {
+				require.NoError(t, os.WriteFile("new.go", []byte("package main\n"), 0644))
+			},
+			want: func(commit string) *model.Git {
+				return &model.Git{Commit: commit, Branch: "main", Dirty: true}
+			},
+		},
+		{
+			name: "perfgo history is ignored",
+			setup: func(t *testing.T) {
+				require.NoError(t, os.MkdirAll(filepath.Join(".perfgo", "history"), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(".perfgo", "history", "history.json"), []byte("{}"), 0644))
+			},
+			want: func(commit string) *model.Git {
+				return &model.Git{Commit: commit, Branch: "main"}
+			},
+		},
+		{
+			name: "detached at tag",
+			setup: func(t *testing.T) {
+				runGit(t, "checkout", "-q", "--detach", "v1.0.0")
+			},
+			want: func(commit string) *model.Git {
+				return &model.Git{Commit: commit, Describe: "v1.0.0"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newGitRepo(t)
+			tt.setup(t)
+
+			a := &App{logger: zerolog.Nop()}
+			info, err := a.getGitInfo()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want(runGit(t, "rev-parse", "HEAD")), info)
+		})
+	}
+}
+
+func TestIsDirtyStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{status: "", want: false},
+		{status: " M main.go", want: true},
+		{status: "?? new.go", want: true},
+		{status: "?? .perfgo/", want: false},
+		{status: "?? .perfgo/\n M main.go", want: true},
+		{status: "?? .perfgoish", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			assert.Equal(t, tt.want, isDirtyStatus(tt.status))
+		})
+	}
+}
+
+func TestGitRefSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		info *model.Git
+		want string
+	}{
+		{name: "branch", info: &model.Git{Branch: "main"}, want: " (main)"},
+		{name: "dirty branch", info: &model.Git{Branch: "main", Dirty: true}, want: " (main) (dirty)"},
+		{name: "detached", info: &model.Git{Describe: "v1.0.0-2-gabcdef0"}, want: " (detached at v1.0.0-2-gabcdef0)"},
+		{name: "commit only", info: &model.Git{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, gitRefSuffix(tt.info))
+		})
+	}
+}
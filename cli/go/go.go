@@ -5,14 +5,70 @@ package gocmd
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
+// Package describes a package matched by a 'go list' pattern.
+type Package struct {
+	ImportPath string // Import path (e.g., github.com/perfgo/perfgo/cli)
+	Dir        string // Absolute directory containing the package
+	HasTests   bool   // Whether the package has _test.go files
+}
+
+// packageFormat is the 'go list -f' template parsed by ListPackages.
+const packageFormat = `{{.ImportPath}}{{"\t"}}{{.Dir}}{{"\t"}}{{len .TestGoFiles}}{{"\t"}}{{len .XTestGoFiles}}`
+
 // List runs 'go list' on a package path and returns the list of packages.
 // Returns the packages found (one per line from stdout) and any error.
 // If an error occurs, it includes a user-friendly error message.
 func List(path string) ([]string, error) {
-	cmd := exec.Command("go", "list", path)
+	output, err := list(path)
+	if err != nil {
+		return nil, err
+	}
+	if output == "" {
+		return []string{}, nil
+	}
+
+	packages := strings.Split(output, "\n")
+	return packages, nil
+}
+
+// ListPackages expands a package pattern (e.g., ./...) into the packages it
+// matches, including their directories and whether they contain tests.
+func ListPackages(path string) ([]Package, error) {
+	output, err := list(path, "-f", packageFormat)
+	if err != nil {
+		return nil, err
+	}
+	if output == "" {
+		return []Package{}, nil
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected go list output: %q", line)
+		}
+		testFiles, _ := strconv.Atoi(fields[2])
+		xTestFiles, _ := strconv.Atoi(fields[3])
+		packages = append(packages, Package{
+			ImportPath: fields[0],
+			Dir:        fields[1],
+			HasTests:   testFiles+xTestFiles > 0,
+		})
+	}
+
+	return packages, nil
+}
+
+// list runs 'go list' with the given flags on a package path and returns its
+// trimmed stdout.
+func list(path string, flags ...string) (string, error) {
+	args := append([]string{"list"}, flags...)
+	cmd := exec.Command("go", append(args, path)...)
 
 	// Capture stdout and stderr separately
 	var stdout, stderr strings.Builder
@@ -27,32 +83,25 @@ func List(path string) ([]string, error) {
 
 		// Simplify common error messages
 		if strings.Contains(errMsg, "no Go files in") {
-			return nil, fmt.Errorf("invalid package path %q: directory contains no Go files", path)
+			return "", fmt.Errorf("invalid package path %q: directory contains no Go files", path)
 		}
 		if strings.Contains(errMsg, "is not in std") || strings.Contains(errMsg, "is not in GOROOT") {
-			return nil, fmt.Errorf("invalid package path %q: package not found", path)
+			return "", fmt.Errorf("invalid package path %q: package not found", path)
 		}
 		if strings.Contains(errMsg, "cannot find package") {
-			return nil, fmt.Errorf("invalid package path %q: package not found", path)
+			return "", fmt.Errorf("invalid package path %q: package not found", path)
 		}
 
 		// For other errors, show the first line of the error
 		lines := strings.Split(errMsg, "\n")
 		if len(lines) > 0 && lines[0] != "" {
-			return nil, fmt.Errorf("invalid package path %q: %s", path, lines[0])
+			return "", fmt.Errorf("invalid package path %q: %s", path, lines[0])
 		}
 
-		return nil, fmt.Errorf("invalid package path %q: %s", path, err.Error())
+		return "", fmt.Errorf("invalid package path %q: %s", path, err.Error())
 	}
 
-	// Parse packages from stdout (one per line)
-	output := strings.TrimSpace(stdout.String())
-	if output == "" {
-		return []string{}, nil
-	}
-
-	packages := strings.Split(output, "\n")
-	return packages, nil
+	return strings.TrimSpace(stdout.String()), nil
 }
 
 // Command creates an exec.Cmd for running a Go command.
@@ -0,0 +1,39 @@
+package gocmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPackages(t *testing.T) {
+	packages, err := ListPackages("../../model/...")
+	require.NoError(t, err)
+	require.Len(t, packages, 1)
+	require.Equal(t, "github.com/perfgo/perfgo/model", packages[0].ImportPath)
+	require.False(t, packages[0].HasTests)
+
+	wantDir, err := filepath.Abs("../../model")
+	require.NoError(t, err)
+	require.Equal(t, wantDir, packages[0].Dir)
+}
+
+func TestListPackages_Pattern(t *testing.T) {
+	packages, err := ListPackages("../...")
+	require.NoError(t, err)
+
+	byPath := make(map[string]Package)
+	for _, pkg := range packages {
+		byPath[pkg.ImportPath] = pkg
+	}
+	require.Contains(t, byPath, "github.com/perfgo/perfgo/cli")
+	require.Contains(t, byPath, "github.com/perfgo/perfgo/cli/perf")
+	require.True(t, byPath["github.com/perfgo/perfgo/cli/perf"].HasTests)
+}
+
+func TestListPackages_Invalid(t *testing.T) {
+	_, err := ListPackages("./does-not-exist")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid package path")
+}
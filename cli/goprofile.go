@@ -0,0 +1,96 @@
+package cli
+
+// This file contains the cpuprofile and mprofile modes, which profile a test
+// with Go's own profilers instead of perf, e.g. where perf isn't available.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// memProfileFile is the Go memory profile of an mprofile run in its run
+// directory.
+const memProfileFile = "mem.pb.gz"
+
+// cpuProfileFile is the Go CPU profile of a cpuprofile run in its run
+// directory. It takes the place of the perf record profile, so it is
+// registered, symbolized and converted like one.
+const cpuProfileFile = "perf.pb.gz"
+
+// memProfileRateFlag returns the flag setting the sampling rate of the
+// memory profiler.
+func memProfileRateFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "memprofile-rate",
+		Usage: "Sample one allocation per N allocated bytes (-test.memprofilerate), 1 records every allocation (default: the runtime's 512 KiB)",
+	}
+}
+
+// isGoProfileMode reports whether mode profiles with a Go profiler.
+func isGoProfileMode(mode string) bool {
+	return mode == "cpuprofile" || mode == "mprofile"
+}
+
+// needsPerf reports whether mode runs the test under perf.
+func needsPerf(mode string) bool {
+	return mode != "" && !isGoProfileMode(mode)
+}
+
+// perfNotFoundError returns the error of a perf mode run on host without
+// perf, pointing to the cpuprofile mode.
+func perfNotFoundError(host string, err error) error {
+	return fmt.Errorf("perf not found on %s, install it (see perfgo doctor) or use perfgo test cpuprofile for a Go CPU profile without perf: %w", host, err)
+}
+
+// goProfileFile returns the file the profile of mode is written to in the
+// run directory.
+func goProfileFile(mode string) string {
+	if mode == "mprofile" {
+		return memProfileFile
+	}
+	return cpuProfileFile
+}
+
+// goProfileArgs returns the test binary flags writing the profile of mode to
+// path, sampling allocations at memProfileRate if set.
+func goProfileArgs(mode, path string, memProfileRate int) []string {
+	if mode != "mprofile" {
+		return []string{"-test.cpuprofile=" + path}
+	}
+	args := []string{"-test.memprofile=" + path}
+	if memProfileRate > 0 {
+		args = append(args, fmt.Sprintf("-test.memprofilerate=%d", memProfileRate))
+	}
+	return args
+}
+
+// recordGoProfile stores the options of the profile of mode in history.
+func recordGoProfile(history *model.History, mode string, memProfileRate int) {
+	if mode == "mprofile" {
+		history.Test.MemProfile = &model.MemProfile{Rate: memProfileRate}
+	} else {
+		history.Test.CPUProfile = true
+	}
+}
+
+// registerGoProfile checks that the test binary wrote the profile of mode to
+// runDir. Memory profiles are registered as the profile of the run, CPU
+// profiles are registered by recordHistory like perf profiles.
+func registerGoProfile(runDir, mode string, history *model.History) error {
+	info, err := os.Stat(filepath.Join(runDir, goProfileFile(mode)))
+	if err != nil {
+		return fmt.Errorf("test binary wrote no %s profile: %w", mode, err)
+	}
+	if mode == "mprofile" {
+		history.Artifacts = append(history.Artifacts, model.Artifact{
+			Type: model.ArtifactTypePprofProfile,
+			Size: uint64(info.Size()),
+			File: memProfileFile,
+		})
+	}
+	return nil
+}
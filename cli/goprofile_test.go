@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoProfileArgs(t *testing.T) {
+	assert.Equal(t, []string{"-test.memprofile=/tmp/mem.pb.gz"}, goProfileArgs("mprofile", "/tmp/mem.pb.gz", 0))
+	assert.Equal(t, []string{"-test.memprofile=/tmp/mem.pb.gz", "-test.memprofilerate=1"}, goProfileArgs("mprofile", "/tmp/mem.pb.gz", 1))
+	assert.Equal(t, []string{"-test.cpuprofile=/tmp/perf.pb.gz"}, goProfileArgs("cpuprofile", "/tmp/perf.pb.gz", 0))
+
+	assert.True(t, needsPerf("profile"))
+	assert.True(t, needsPerf("stat"))
+	assert.False(t, needsPerf(""))
+	assert.False(t, needsPerf("cpuprofile"))
+	assert.False(t, needsPerf("mprofile"))
+}
+
+func TestRegisterGoProfile(t *testing.T) {
+	runDir := t.TempDir()
+	h := &model.History{}
+	err := registerGoProfile(runDir, "mprofile", h)
+	assert.ErrorContains(t, err, "test binary wrote no mprofile profile")
+	assert.Empty(t, h.Artifacts)
+
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, memProfileFile), []byte("profile"), 0o644))
+	require.NoError(t, registerGoProfile(runDir, "mprofile", h))
+	assert.Equal(t, []model.Artifact{{Type: model.ArtifactTypePprofProfile, Size: 7, File: memProfileFile}}, h.Artifacts)
+
+	// CPU profiles are registered when the history is recorded
+	h = &model.History{}
+	assert.ErrorContains(t, registerGoProfile(runDir, "cpuprofile", h), "test binary wrote no cpuprofile profile")
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, cpuProfileFile), []byte("profile"), 0o644))
+	require.NoError(t, registerGoProfile(runDir, "cpuprofile", h))
+	assert.Empty(t, h.Artifacts)
+}
+
+// fakeGoProfileRunner returns a runner building a fake test binary, whose
+// runs write the -test.cpuprofile or -test.memprofile profile.
+func fakeGoProfileRunner(t *testing.T) *runner.Fake {
+	t.Helper()
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{{ID: 1, Name: "example.com/cached.A"}},
+	}
+	prof.Location = []*profile.Location{{ID: 1, Line: []profile.Line{{Function: prof.Function[0]}}}}
+	prof.Sample = []*profile.Sample{{Location: prof.Location, Value: []int64{1, 10000000}}}
+
+	return &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		if cmd.Name == "go" {
+			binary := cmd.Args[slices.Index(cmd.Args, "-o")+1]
+			if err := os.WriteFile(binary, []byte("binary"), 0o755); err != nil {
+				return runner.Result{Err: err}
+			}
+			return runner.Result{}
+		}
+		for _, arg := range cmd.Args {
+			for _, flag := range []string{"-test.cpuprofile=", "-test.memprofile="} {
+				path, ok := strings.CutPrefix(arg, flag)
+				if !ok {
+					continue
+				}
+				f, err := os.Create(path)
+				if err == nil {
+					err = prof.Write(f)
+					f.Close()
+				}
+				if err != nil {
+					return runner.Result{Err: err}
+				}
+			}
+		}
+		return runner.Result{Stdout: "PASS\n"}
+	}}
+}
+
+func TestTestMProfile(t *testing.T) {
+	writeTestModule(t)
+	outputDir := t.TempDir()
+
+	fake := fakeGoProfileRunner(t)
+	app := New(WithRunner(fake))
+	captureStdout(t, func() {
+		require.NoError(t, app.Run([]string{AppName, "--output-dir", outputDir, "test", "mprofile", "--memprofile-rate", "1", "--", ".", "-run", "TestA"}))
+	})
+
+	var testCmd runner.Cmd
+	for _, cmd := range fake.Commands() {
+		if cmd.Name != "go" {
+			testCmd = cmd
+		}
+	}
+	assert.Contains(t, testCmd.Args, "-test.run")
+	assert.Contains(t, testCmd.Args, "-test.memprofilerate=1")
+
+	entries, err := history.LoadEntries(zerolog.Nop(), outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	h := entries[0].History
+	require.NotNil(t, h.Test.MemProfile)
+	assert.Equal(t, 1, h.Test.MemProfile.Rate)
+	assert.Nil(t, h.Perf)
+
+	var profile *model.Artifact
+	for i := range h.Artifacts {
+		if h.Artifacts[i].Type == model.ArtifactTypePprofProfile {
+			profile = &h.Artifacts[i]
+		}
+	}
+	require.NotNil(t, profile, "memory profile not registered")
+	assert.Equal(t, memProfileFile, profile.File)
+	assert.Contains(t, testCmd.Args, "-test.memprofile="+filepath.Join(entries[0].FullPath, memProfileFile))
+	assert.FileExists(t, filepath.Join(entries[0].FullPath, memProfileFile))
+}
+
+func TestTestCPUProfile(t *testing.T) {
+	writeTestModule(t)
+	outputDir := t.TempDir()
+
+	fake := fakeGoProfileRunner(t)
+	app := New(WithRunner(fake))
+	captureStdout(t, func() {
+		require.NoError(t, app.Run([]string{AppName, "--output-dir", outputDir, "test", "cpuprofile", "--output", "text", "--", ".", "-run", "TestA"}))
+	})
+
+	entries, err := history.LoadEntries(zerolog.Nop(), outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	h := entries[0].History
+	assert.True(t, h.Test.CPUProfile)
+	assert.Nil(t, h.Test.MemProfile)
+	assert.Nil(t, h.Perf)
+
+	var testCmd runner.Cmd
+	for _, cmd := range fake.Commands() {
+		if cmd.Name != "go" {
+			testCmd = cmd
+		}
+	}
+	assert.Contains(t, testCmd.Args, "-test.cpuprofile="+filepath.Join(entries[0].FullPath, cpuProfileFile))
+
+	// Registered like a perf record profile, with the --output formats
+	types := map[model.ArtifactType]string{}
+	for _, artifact := range h.Artifacts {
+		types[artifact.Type] = artifact.File
+	}
+	assert.Equal(t, cpuProfileFile, types[model.ArtifactTypePprofProfile])
+	assert.Equal(t, "perf.txt", types[model.ArtifactTypeProfileText])
+	assert.Contains(t, types, model.ArtifactTypeTestBinary)
+}
+
+func TestRunTest_PerfNotFound(t *testing.T) {
+	writeTestModule(t)
+	goBinary, err := exec.LookPath("go")
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.Symlink(goBinary, filepath.Join(binDir, "go")))
+	t.Setenv("PATH", binDir)
+
+	fake := fakeGoProfileRunner(t)
+	app := New(WithRunner(fake), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+	_, err = app.RunTest(TestOptions{Mode: "profile", Args: []string{"."}, Repeat: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "perf not found on this machine")
+	assert.Contains(t, err.Error(), "perfgo test cpuprofile")
+	for _, cmd := range fake.Commands() {
+		assert.NotEqual(t, "go", cmd.Name, "test binary built without perf")
+	}
+}
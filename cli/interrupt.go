@@ -0,0 +1,103 @@
+package cli
+
+// This file contains the cleanup of local runs interrupted by SIGINT or
+// SIGTERM, which would otherwise exit leaving the test binary and
+// intermediate perf files behind.
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// notifyInterrupt relays SIGINT and SIGTERM to c, it's replaced in tests.
+var notifyInterrupt = func(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
+
+// exitInterrupted terminates perfgo once an interrupt was handled, it's
+// replaced in tests.
+var exitInterrupted = func() {
+	os.Exit(130)
+}
+
+// interruptCleanups holds the functions removing the intermediate files of
+// a run if it's interrupted.
+type interruptCleanups struct {
+	mu   sync.Mutex
+	next int
+	fns  map[int]func()
+}
+
+// handleInterrupts runs the cleanups registered with onInterrupt and exits
+// when perfgo receives SIGINT or SIGTERM, unless keep is set (--keep). The
+// returned function stops handling interrupts.
+func (a *App) handleInterrupts(keep bool) func() {
+	cleanups := &interruptCleanups{fns: map[int]func(){}}
+	a.interrupts = cleanups
+
+	sigChan := make(chan os.Signal, 1)
+	notifyInterrupt(sigChan)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-sigChan:
+		case <-done:
+			return
+		}
+		// The run may have finished while the signal arrived
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if keep {
+			a.logger.Info().Msg("Interrupted, keeping intermediate files (--keep)")
+		} else {
+			a.logger.Info().Msg("Interrupted, cleaning up intermediate files")
+			cleanups.run()
+		}
+		exitInterrupted()
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+		a.interrupts = nil
+	}
+}
+
+// onInterrupt registers fn to run if the run is interrupted, until the
+// returned function is called. It's a no-op while interrupts aren't handled.
+func (a *App) onInterrupt(fn func()) func() {
+	cleanups := a.interrupts
+	if cleanups == nil {
+		return func() {}
+	}
+
+	cleanups.mu.Lock()
+	defer cleanups.mu.Unlock()
+	id := cleanups.next
+	cleanups.next++
+	cleanups.fns[id] = fn
+
+	return func() {
+		cleanups.mu.Lock()
+		defer cleanups.mu.Unlock()
+		delete(cleanups.fns, id)
+	}
+}
+
+// run runs the registered cleanups, the most recently registered first.
+func (c *interruptCleanups) run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := c.next - 1; id >= 0; id-- {
+		if fn, ok := c.fns[id]; ok {
+			fn()
+		}
+	}
+}
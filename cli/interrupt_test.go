@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureExit replaces exiting after an interrupt with closing the returned
+// channel.
+func captureExit(t *testing.T) <-chan struct{} {
+	t.Helper()
+
+	exited := make(chan struct{})
+	orig := exitInterrupted
+	exitInterrupted = func() { close(exited) }
+	t.Cleanup(func() { exitInterrupted = orig })
+	return exited
+}
+
+func TestHandleInterrupts_RunsCleanups(t *testing.T) {
+	tests := []struct {
+		name string
+		keep bool
+		want []string
+	}{
+		{name: "cleans up newest first", want: []string{"perf.data", "binary"}},
+		{name: "keeps files with --keep", keep: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interrupts := captureInterrupts(t)
+			exited := captureExit(t)
+			a := &App{logger: zerolog.Nop()}
+
+			stop := a.handleInterrupts(tt.keep)
+			defer stop()
+
+			var ran []string
+			a.onInterrupt(func() { ran = append(ran, "binary") })
+			unregister := a.onInterrupt(func() { ran = append(ran, "finished") })
+			a.onInterrupt(func() { ran = append(ran, "perf.data") })
+			unregister()
+
+			(<-interrupts) <- os.Interrupt
+			<-exited
+			assert.Equal(t, tt.want, ran)
+		})
+	}
+}
+
+func TestHandleInterrupts_Stop(t *testing.T) {
+	interrupts := captureInterrupts(t)
+	exited := captureExit(t)
+	a := &App{logger: zerolog.Nop()}
+
+	stop := a.handleInterrupts(false)
+	sigs := <-interrupts
+	ran := false
+	a.onInterrupt(func() { ran = true })
+	stop()
+
+	// Signals after the run finished are left to the default handling
+	assert.Nil(t, a.interrupts)
+	sigs <- os.Interrupt
+	assert.Never(t, func() bool {
+		select {
+		case <-exited:
+			return true
+		default:
+			return false
+		}
+	}, 50*time.Millisecond, 10*time.Millisecond)
+	assert.False(t, ran)
+
+	// Registering without a handler is a no-op
+	a.onInterrupt(func() { ran = true })()
+}
+
+func TestLocalPerfDataPath_RemovedOnInterrupt(t *testing.T) {
+	interrupts := captureInterrupts(t)
+	exited := captureExit(t)
+	a := &App{logger: zerolog.Nop()}
+	defer a.handleInterrupts(false)()
+
+	path, cleanup, err := a.localPerfDataPath(false)
+	require.NoError(t, err)
+	defer cleanup()
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+
+	(<-interrupts) <- os.Interrupt
+	<-exited
+	assert.NoDirExists(t, filepath.Dir(path))
+}
+
+func TestRunRemoteCommandWithSignalHandling_NotHandledByDefault(t *testing.T) {
+	notified := false
+	orig := notifyInterrupt
+	notifyInterrupt = func(chan<- os.Signal) { notified = true }
+	t.Cleanup(func() { notifyInterrupt = orig })
+
+	client, err := ssh.New(zerolog.Nop(), "bench", ssh.WithRunner(&runner.Fake{}))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	// Library runs leave the signals to the embedding program
+	a := &App{logger: zerolog.Nop()}
+	require.NoError(t, a.runRemoteCommandWithSignalHandling(client, "./test.bin", "/cache/perfgo.pid", io.Discard, io.Discard))
+	assert.False(t, notified)
+}
+
+func TestRunTest_KeepsRunStateOffApp(t *testing.T) {
+	app := New(WithRunner(&runner.Fake{}), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+
+	_, err := app.RunTest(TestOptions{Mode: "stat", Args: []string{"."}, Repeat: 3, Env: []string{"GOGC=off"}, Count: 1000})
+	require.Error(t, err)
+	assert.Equal(t, runState{}, app.runState)
+}
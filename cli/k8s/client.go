@@ -4,19 +4,59 @@ package k8s
 // It manages kubectl command execution with context and namespace configuration.
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
 )
 
 // Client manages kubectl commands for a specific Kubernetes context and namespace.
 type Client struct {
 	kubeContext string
 	namespace   string
+	kubeconfig  string
+	runner      runner.Runner
+
+	retryAttempts int
+	retryInterval time.Duration
+}
+
+// Defaults for retrying kubectl commands failing with transient API errors,
+// like API server throttling in busy clusters.
+const (
+	defaultRetryAttempts = 4
+	defaultRetryInterval = 500 * time.Millisecond
+)
+
+// Option is a function that configures a Kubernetes client.
+type Option func(*Client)
+
+// WithRunner sets the runner executing kubectl, runner.Default if not set.
+func WithRunner(r runner.Runner) Option {
+	return func(c *Client) {
+		c.runner = r
+	}
+}
+
+// WithKubeconfig sets the kubeconfig file passed to kubectl (--kubeconfig),
+// kubectl's default ($KUBECONFIG, ~/.kube/config or in-cluster) if empty.
+func WithKubeconfig(path string) Option {
+	return func(c *Client) {
+		c.kubeconfig = path
+	}
+}
+
+// WithRetry configures how often kubectl commands failing with transient API
+// errors are attempted, and the initial delay between attempts, which doubles
+// after each failure. Attempts of 1 disables retries.
+func WithRetry(attempts int, interval time.Duration) Option {
+	return func(c *Client) {
+		c.retryAttempts = attempts
+		c.retryInterval = interval
+	}
 }
 
 // Node represents a Kubernetes node.
@@ -98,8 +138,10 @@ type PodStatus struct {
 
 // PodCondition represents a condition of the pod.
 type PodCondition struct {
-	Type   string `json:"type"`
-	Status string `json:"status"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // ContainerStatus contains container status information.
@@ -145,11 +187,18 @@ type PodList struct {
 // New creates a new Kubernetes client for the specified context and namespace.
 // If kubeContext is empty, the current context will be used.
 // If namespace is empty, the default namespace will be used.
-func New(kubeContext, namespace string) *Client {
-	return &Client{
-		kubeContext: kubeContext,
-		namespace:   namespace,
+func New(kubeContext, namespace string, opts ...Option) *Client {
+	c := &Client{
+		kubeContext:   kubeContext,
+		namespace:     namespace,
+		runner:        runner.Default,
+		retryAttempts: defaultRetryAttempts,
+		retryInterval: defaultRetryInterval,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // GetNodes retrieves all nodes in the cluster.
@@ -225,6 +274,34 @@ func (c *Client) GetPodsInNamespace(ctx context.Context, namespace string) ([]Po
 	return podList.Items, nil
 }
 
+// GetPodsBySelector retrieves the pods matching the label selector (e.g.,
+// "app=foo,tier!=cache") in the configured namespace.
+func (c *Client) GetPodsBySelector(ctx context.Context, selector string) ([]Pod, error) {
+	args := []string{"get", "pods", "-o", "json", "-l", selector}
+
+	// Add context if specified
+	if c.kubeContext != "" {
+		args = append([]string{"--context", c.kubeContext}, args...)
+	}
+
+	// Add namespace if specified
+	if c.namespace != "" {
+		args = append(args, "-n", c.namespace)
+	}
+
+	output, err := c.runKubectl(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods matching %s: %w", selector, err)
+	}
+
+	var podList PodList
+	if err := json.Unmarshal([]byte(output), &podList); err != nil {
+		return nil, fmt.Errorf("failed to parse pods response: %w", err)
+	}
+
+	return podList.Items, nil
+}
+
 // GetPod retrieves a specific pod by name in the configured namespace.
 func (c *Client) GetPod(ctx context.Context, name string) (*Pod, error) {
 	args := []string{"get", "pod", name, "-o", "json"}
@@ -275,6 +352,47 @@ func GetContainerIDs(pod *Pod) map[string]string {
 	return containerIDs
 }
 
+// SkippedContainer is a container of a pod without processes to attach to.
+type SkippedContainer struct {
+	Name   string // Container name
+	Init   bool   // Whether it is an init container
+	State  string // waiting, terminated or unknown
+	Reason string // Reason of the state reported by the kubelet, if any
+}
+
+// RunningContainerIDs extracts the IDs of the running containers of a pod,
+// like GetContainerIDs, and returns the containers that aren't running as
+// skipped. Init containers, which usually terminated before the pod started,
+// are only included with includeInit.
+func RunningContainerIDs(pod *Pod, includeInit bool) (map[string]string, []SkippedContainer) {
+	containerIDs := make(map[string]string)
+	var skipped []SkippedContainer
+
+	add := func(status ContainerStatus, init bool) {
+		switch {
+		case status.State.Running != nil && status.ContainerID != "":
+			containerIDs[status.Name] = stripContainerIDPrefix(status.ContainerID)
+		case status.State.Terminated != nil:
+			skipped = append(skipped, SkippedContainer{Name: status.Name, Init: init, State: "terminated", Reason: status.State.Terminated.Reason})
+		case status.State.Waiting != nil:
+			skipped = append(skipped, SkippedContainer{Name: status.Name, Init: init, State: "waiting", Reason: status.State.Waiting.Reason})
+		default:
+			skipped = append(skipped, SkippedContainer{Name: status.Name, Init: init, State: "unknown"})
+		}
+	}
+
+	if includeInit {
+		for _, status := range pod.Status.InitContainerStatuses {
+			add(status, true)
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		add(status, false)
+	}
+
+	return containerIDs, skipped
+}
+
 // stripContainerIDPrefix removes the runtime prefix from container IDs.
 // For example, "containerd://abc123" becomes "abc123".
 func stripContainerIDPrefix(containerID string) string {
@@ -337,37 +455,107 @@ func (c *Client) CreatePrivilegedPod(ctx context.Context, name, image, nodeName
 	return nil
 }
 
-// WaitForPodReady waits for a pod to be in the Running phase and ready.
-// It polls the pod status until it's ready or the context is cancelled.
-func (c *Client) WaitForPodReady(ctx context.Context, name string) error {
-	ticker := time.NewTicker(2 * time.Second)
+// podReadyPollInterval is how often WaitForPodReady checks the pod.
+var podReadyPollInterval = 2 * time.Second
+
+// WaitForPodReady waits for a pod to be in the Running phase and ready. It
+// gives up after timeout, if positive, or when ctx is done. The error then
+// includes why the pod isn't ready, e.g. a container waiting in
+// ImagePullBackOff or the pod being unschedulable.
+func (c *Client) WaitForPodReady(ctx context.Context, name string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(podReadyPollInterval)
 	defer ticker.Stop()
 
+	var last *Pod
 	for {
+		// The pod might not exist yet
+		if pod, err := c.GetPod(ctx, name); err == nil {
+			if podReady(pod) {
+				return nil
+			}
+			last = pod
+		}
+
 		select {
 		case <-ctx.Done():
+			if last != nil {
+				if reason := podNotReadyReason(last); reason != "" {
+					return fmt.Errorf("timeout waiting for pod %s to be ready, %s: %w", name, reason, ctx.Err())
+				}
+			}
 			return fmt.Errorf("timeout waiting for pod %s to be ready: %w", name, ctx.Err())
 		case <-ticker.C:
-			pod, err := c.GetPod(ctx, name)
-			if err != nil {
-				continue // Pod might not exist yet
-			}
+		}
+	}
+}
 
-			if pod.Status.Phase == "Running" {
-				// Check if all containers are ready
-				allReady := true
-				for _, status := range pod.Status.ContainerStatuses {
-					if !status.Ready {
-						allReady = false
-						break
-					}
-				}
-				if allReady {
-					return nil
-				}
+// podReady returns whether the pod is running and all its containers are
+// ready.
+func podReady(pod *Pod) bool {
+	if pod.Status.Phase != "Running" {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// podNotReadyReason describes why the pod isn't ready from the states of its
+// containers, falling back to its failed conditions and its phase.
+func podNotReadyReason(pod *Pod) string {
+	var reasons []string
+	statuses := append(append([]ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		switch {
+		case status.State.Waiting != nil && status.State.Waiting.Reason != "":
+			reasons = append(reasons, withMessage(
+				fmt.Sprintf("container %s is waiting: %s", status.Name, status.State.Waiting.Reason),
+				status.State.Waiting.Message))
+		case status.State.Terminated != nil:
+			terminated := status.State.Terminated
+			reason := fmt.Sprintf("container %s terminated with exit code %d", status.Name, terminated.ExitCode)
+			if terminated.Reason != "" {
+				reason += ": " + terminated.Reason
 			}
+			reasons = append(reasons, withMessage(reason, terminated.Message))
+		}
+	}
+	if len(reasons) > 0 {
+		return strings.Join(reasons, "; ")
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Status == "False" && condition.Reason != "" {
+			reasons = append(reasons, withMessage(
+				fmt.Sprintf("%s: %s", condition.Type, condition.Reason),
+				condition.Message))
 		}
 	}
+	if len(reasons) > 0 {
+		return strings.Join(reasons, "; ")
+	}
+
+	if pod.Status.Phase != "" {
+		return "pod is " + pod.Status.Phase
+	}
+	return ""
+}
+
+// withMessage appends the message to the reason, if any.
+func withMessage(reason, message string) string {
+	if message == "" {
+		return reason
+	}
+	return reason + " (" + message + ")"
 }
 
 // ExecCommand executes a command in a pod container.
@@ -436,17 +624,106 @@ func (c *Client) Namespace() string {
 	return c.namespace
 }
 
-// runKubectl executes a kubectl command with the given arguments.
+// Kubeconfig returns the kubeconfig file this client is configured for.
+func (c *Client) Kubeconfig() string {
+	return c.kubeconfig
+}
+
+// GlobalArgs returns the kubectl flags selecting the kubeconfig and context of
+// the client, for kubectl commands run outside of it (e.g., ssh proxies).
+func (c *Client) GlobalArgs() []string {
+	var args []string
+	if c.kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.kubeconfig)
+	}
+	if c.kubeContext != "" {
+		args = append(args, "--context", c.kubeContext)
+	}
+	return args
+}
+
+// runKubectl executes a kubectl command with the given arguments, using the
+// kubeconfig of the client if set. Commands failing with transient API errors
+// are retried with exponential backoff while the context allows.
 func (c *Client) runKubectl(ctx context.Context, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	if c.kubeconfig != "" {
+		args = append([]string{"--kubeconfig", c.kubeconfig}, args...)
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	attempts := max(c.retryAttempts, 1)
+	interval := c.retryInterval
+	for attempt := 1; ; attempt++ {
+		stdout, stderr, err := c.runner.Run(ctx, "kubectl", args...)
+		if err == nil {
+			return stdout, nil
+		}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("kubectl command failed: %w (stderr: %s)", err, stderr.String())
+		err = fmt.Errorf("kubectl command failed: %w (stderr: %s)", err, stderr)
+		if attempt >= attempts || !isRetryable(stderr) || !waitRetry(ctx, interval) {
+			return "", err
+		}
+		interval *= 2
 	}
+}
 
-	return stdout.String(), nil
+// permanentErrorMessages are kubectl error messages (lower case) for requests
+// that fail the same way when retried.
+var permanentErrorMessages = []string{
+	"notfound",
+	"not found",
+	"forbidden",
+	"unauthorized",
+	"alreadyexists",
+	"already exists",
+}
+
+// transientErrorMessages are kubectl error messages (lower case) for requests
+// that may succeed when retried: connection failures, timeouts and
+// throttling.
+var transientErrorMessages = []string{
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"tls handshake timeout",
+	"client.timeout exceeded",
+	"toomanyrequests",
+	"too many requests",
+	"the server is currently unable to handle the request",
+	"the server was unable to return a response in the time allotted",
+	"http2: client connection lost",
+	"unable to connect to the server",
+}
+
+// isRetryable reports whether kubectl's stderr indicates a transient API
+// error, as opposed to e.g. a missing resource or denied access.
+func isRetryable(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+	for _, msg := range permanentErrorMessages {
+		if strings.Contains(stderr, msg) {
+			return false
+		}
+	}
+	for _, msg := range transientErrorMessages {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitRetry waits for interval and reports whether a retry should follow,
+// which it shouldn't if the context is done or its deadline is too close.
+func waitRetry(ctx context.Context, interval time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < interval {
+		return false
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
@@ -0,0 +1,293 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetPod(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: `{
+			"metadata": {"name": "api-0", "namespace": "prod"},
+			"spec": {"nodeName": "node-1"},
+			"status": {
+				"phase": "Running",
+				"containerStatuses": [{"name": "api", "ready": true, "containerID": "containerd://abc123"}]
+			}
+		}`}
+	}}
+	client := New("staging", "prod", WithRunner(fake))
+
+	pod, err := client.GetPod(context.Background(), "api-0")
+	require.NoError(t, err)
+	assert.Equal(t, "node-1", pod.Spec.NodeName)
+	assert.Equal(t, map[string]string{"api": "abc123"}, GetContainerIDs(pod))
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, "kubectl", cmds[0].Name)
+	assert.Contains(t, cmds[0].Args, "--context")
+	assert.Contains(t, cmds[0].Args, "staging")
+	assert.Contains(t, cmds[0].Args, "api-0")
+}
+
+func TestClient_ExecCommand(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "pod not found", Err: errors.New("exit status 1")}
+	}}
+	client := New("", "default", WithRunner(fake))
+
+	_, err := client.ExecCommand(context.Background(), "missing", []string{"cat", "/etc/os-release"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pod not found")
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, []string{"-n", "default", "exec", "missing", "--", "cat", "/etc/os-release"}, cmds[0].Args)
+}
+
+func TestClient_GetPodsBySelector(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: `{"items": [
+			{"metadata": {"name": "api-0", "labels": {"app": "api"}}, "status": {"phase": "Running"}},
+			{"metadata": {"name": "api-1", "labels": {"app": "api"}}, "status": {"phase": "Pending"}}
+		]}`}
+	}}
+	client := New("staging", "prod", WithRunner(fake))
+
+	pods, err := client.GetPodsBySelector(context.Background(), "app=api,tier!=cache")
+	require.NoError(t, err)
+	require.Len(t, pods, 2)
+	assert.Equal(t, "api-0", pods[0].Metadata.Name)
+	assert.Equal(t, "Pending", pods[1].Status.Phase)
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, []string{"--context", "staging", "get", "pods", "-o", "json", "-l", "app=api,tier!=cache", "-n", "prod"}, cmds[0].Args)
+}
+
+func TestClient_Kubeconfig(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		call func(c *Client) error
+	}{
+		{name: "GetNodes", call: func(c *Client) error { _, err := c.GetNodes(ctx); return err }},
+		{name: "GetPods", call: func(c *Client) error { _, err := c.GetPods(ctx); return err }},
+		{name: "GetPodsInNamespace", call: func(c *Client) error { _, err := c.GetPodsInNamespace(ctx, "kube-system"); return err }},
+		{name: "GetPodsBySelector", call: func(c *Client) error { _, err := c.GetPodsBySelector(ctx, "app=api"); return err }},
+		{name: "GetPod", call: func(c *Client) error { _, err := c.GetPod(ctx, "api-0"); return err }},
+		{name: "CreatePrivilegedPod", call: func(c *Client) error { return c.CreatePrivilegedPod(ctx, "perfgo-api-0", "perf:latest", "node-1") }},
+		{name: "ExecCommand", call: func(c *Client) error { _, err := c.ExecCommand(ctx, "api-0", []string{"true"}); return err }},
+		{name: "ReadFileFromPod", call: func(c *Client) error { _, err := c.ReadFileFromPod(ctx, "api-0", "/etc/hostname"); return err }},
+		{name: "DeletePod", call: func(c *Client) error { return c.DeletePod(ctx, "perfgo-api-0") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return runner.Result{Stdout: "{}"}
+			}}
+			client := New("staging", "prod", WithRunner(fake), WithKubeconfig("/etc/perfgo/kubeconfig"))
+			require.NoError(t, tt.call(client))
+
+			cmds := fake.Commands()
+			require.Len(t, cmds, 1)
+			assert.Equal(t, []string{"--kubeconfig", "/etc/perfgo/kubeconfig", "--context", "staging"}, cmds[0].Args[:4])
+		})
+	}
+}
+
+func TestClient_GlobalArgs(t *testing.T) {
+	assert.Empty(t, New("", "default").GlobalArgs())
+	assert.Equal(t, []string{"--context", "prod"}, New("prod", "").GlobalArgs())
+	assert.Equal(t, []string{"--kubeconfig", "/tmp/kc", "--context", "prod"}, New("prod", "", WithKubeconfig("/tmp/kc")).GlobalArgs())
+}
+
+func TestClient_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		calls++
+		switch calls {
+		case 1:
+			return runner.Result{Stderr: "Unable to connect to the server: dial tcp 10.0.0.1:443: connect: connection refused", Err: errors.New("exit status 1")}
+		case 2:
+			return runner.Result{Stderr: "Error from server (TooManyRequests): the server has received too many requests and has asked us to try again later", Err: errors.New("exit status 1")}
+		}
+		return runner.Result{Stdout: `{"metadata": {"name": "api-0"}}`}
+	}}
+	client := New("", "prod", WithRunner(fake), WithRetry(4, time.Millisecond))
+
+	pod, err := client.GetPod(context.Background(), "api-0")
+	require.NoError(t, err)
+	assert.Equal(t, "api-0", pod.Metadata.Name)
+	assert.Len(t, fake.Commands(), 3)
+}
+
+func TestClient_DoesNotRetryPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+	}{
+		{name: "forbidden", stderr: `Error from server (Forbidden): pods "api-0" is forbidden: User "dev" cannot get resource "pods"`},
+		{name: "not found", stderr: `Error from server (NotFound): pods "api-0" not found`},
+		{name: "unknown", stderr: "error: unknown flag: --bogus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return runner.Result{Stderr: tt.stderr, Err: errors.New("exit status 1")}
+			}}
+			client := New("", "prod", WithRunner(fake), WithRetry(4, time.Millisecond))
+
+			_, err := client.GetPod(context.Background(), "api-0")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.stderr)
+			assert.Len(t, fake.Commands(), 1)
+		})
+	}
+}
+
+func TestClient_RetryBounds(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "dial tcp: i/o timeout", Err: errors.New("exit status 1")}
+	}}
+
+	// Attempts are bounded
+	client := New("", "prod", WithRunner(fake), WithRetry(3, time.Millisecond))
+	require.Error(t, client.DeletePod(context.Background(), "api-0"))
+	assert.Len(t, fake.Commands(), 3)
+
+	// No retry is attempted past the deadline of the context
+	fake = &runner.Fake{Handler: fake.Handler}
+	client = New("", "prod", WithRunner(fake), WithRetry(3, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	require.Error(t, client.DeletePod(ctx, "api-0"))
+	assert.Len(t, fake.Commands(), 1)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable("read tcp 10.0.0.2:5000->10.0.0.1:443: read: connection reset by peer"))
+	assert.True(t, isRetryable("net/http: TLS handshake timeout"))
+	assert.True(t, isRetryable("Error from server: the server was unable to return a response in the time allotted, but may still be processing the request"))
+	assert.False(t, isRetryable(`Error from server (AlreadyExists): pods "perfgo-api-0" already exists`))
+	// Permanent errors win over transient ones
+	assert.False(t, isRetryable(`Error from server (Forbidden): connection refused by admission webhook`))
+	assert.False(t, isRetryable(""))
+}
+
+func TestClient_WaitForPodReady(t *testing.T) {
+	defer func(interval time.Duration) { podReadyPollInterval = interval }(podReadyPollInterval)
+	podReadyPollInterval = time.Millisecond
+
+	polls := 0
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		polls++
+		if polls < 3 {
+			return runner.Result{Stdout: `{"status": {"phase": "Pending"}}`}
+		}
+		return runner.Result{Stdout: `{"status": {"phase": "Running", "containerStatuses": [{"name": "perf", "ready": true}]}}`}
+	}}
+	client := New("", "default", WithRunner(fake))
+
+	require.NoError(t, client.WaitForPodReady(context.Background(), "perfgo-api-0", time.Minute))
+	assert.Equal(t, 3, polls)
+}
+
+func TestClient_WaitForPodReadyTimeout(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: `{
+			"metadata": {"name": "perfgo-api-0"},
+			"status": {
+				"phase": "Pending",
+				"containerStatuses": [{
+					"name": "perf",
+					"ready": false,
+					"state": {"waiting": {
+						"reason": "ImagePullBackOff",
+						"message": "Back-off pulling image \"registry.example.com/perf:missing\""
+					}}
+				}]
+			}
+		}`}
+	}}
+	client := New("", "default", WithRunner(fake))
+
+	err := client.WaitForPodReady(context.Background(), "perfgo-api-0", 10*time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, `timeout waiting for pod perfgo-api-0 to be ready, container perf is waiting: ImagePullBackOff (Back-off pulling image "registry.example.com/perf:missing"): context deadline exceeded`)
+}
+
+func TestPodNotReadyReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		status PodStatus
+		want   string
+	}{
+		{
+			name: "unschedulable",
+			status: PodStatus{
+				Phase: "Pending",
+				Conditions: []PodCondition{
+					{Type: "PodScheduled", Status: "False", Reason: "Unschedulable", Message: "0/3 nodes are available: 3 node(s) didn't match Pod's node affinity"},
+				},
+			},
+			want: "PodScheduled: Unschedulable (0/3 nodes are available: 3 node(s) didn't match Pod's node affinity)",
+		},
+		{
+			name: "crashing",
+			status: PodStatus{
+				Phase: "Running",
+				ContainerStatuses: []ContainerStatus{
+					{Name: "perf", State: ContainerState{Terminated: &ContainerStateTerminated{ExitCode: 127, Reason: "Error"}}},
+				},
+			},
+			want: "container perf terminated with exit code 127: Error",
+		},
+		{
+			name:   "phase only",
+			status: PodStatus{Phase: "Pending"},
+			want:   "pod is Pending",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, podNotReadyReason(&Pod{Status: tt.status}))
+		})
+	}
+}
+
+func TestRunningContainerIDs(t *testing.T) {
+	pod := &Pod{Status: PodStatus{
+		InitContainerStatuses: []ContainerStatus{
+			{Name: "migrate", ContainerID: "containerd://aaa", State: ContainerState{Terminated: &ContainerStateTerminated{Reason: "Completed"}}},
+			{Name: "proxy", ContainerID: "containerd://bbb", State: ContainerState{Running: &ContainerStateRunning{}}},
+		},
+		ContainerStatuses: []ContainerStatus{
+			{Name: "api", ContainerID: "containerd://ccc", State: ContainerState{Running: &ContainerStateRunning{}}},
+			{Name: "worker", State: ContainerState{Waiting: &ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+		},
+	}}
+
+	ids, skipped := RunningContainerIDs(pod, false)
+	assert.Equal(t, map[string]string{"api": "ccc"}, ids)
+	assert.Equal(t, []SkippedContainer{{Name: "worker", State: "waiting", Reason: "CrashLoopBackOff"}}, skipped)
+
+	ids, skipped = RunningContainerIDs(pod, true)
+	assert.Equal(t, map[string]string{"proxy": "bbb", "api": "ccc"}, ids)
+	assert.Equal(t, []SkippedContainer{
+		{Name: "migrate", Init: true, State: "terminated", Reason: "Completed"},
+		{Name: "worker", State: "waiting", Reason: "CrashLoopBackOff"},
+	}, skipped)
+}
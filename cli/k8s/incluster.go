@@ -0,0 +1,45 @@
+package k8s
+
+// incluster.go contains the detection of perfgo running in a pod, where
+// kubectl authenticates with the service account of the pod.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir is where Kubernetes mounts the service account
+// credentials into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// InCluster reports whether perfgo runs in a pod with service account
+// credentials, which kubectl uses when no kubeconfig is found.
+func InCluster() bool {
+	return inCluster(os.Getenv, serviceAccountDir)
+}
+
+// InClusterNamespace returns the namespace of the pod perfgo runs in, empty
+// if not running in a cluster.
+func InClusterNamespace() string {
+	return inClusterNamespace(os.Getenv, serviceAccountDir)
+}
+
+func inCluster(getenv func(string) string, dir string) bool {
+	if getenv("KUBERNETES_SERVICE_HOST") == "" || getenv("KUBERNETES_SERVICE_PORT") == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, "token"))
+	return err == nil
+}
+
+func inClusterNamespace(getenv func(string) string, dir string) string {
+	if !inCluster(getenv, dir) {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "namespace"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
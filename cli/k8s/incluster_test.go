@@ -0,0 +1,33 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInCluster(t *testing.T) {
+	dir := t.TempDir()
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.96.0.1",
+		"KUBERNETES_SERVICE_PORT": "443",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	// The service account token is not mounted
+	assert.False(t, inCluster(getenv, dir))
+	assert.Empty(t, inClusterNamespace(getenv, dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("token"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("observability\n"), 0o644))
+	assert.True(t, inCluster(getenv, dir))
+	assert.Equal(t, "observability", inClusterNamespace(getenv, dir))
+
+	// Outside of a pod the service environment is missing
+	delete(env, "KUBERNETES_SERVICE_HOST")
+	assert.False(t, inCluster(getenv, dir))
+	assert.Empty(t, inClusterNamespace(getenv, dir))
+}
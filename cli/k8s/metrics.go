@@ -0,0 +1,178 @@
+package k8s
+
+// metrics.go contains the resource usage of pods as reported by kubectl top,
+// which requires the metrics API (metrics-server) in the cluster.
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ContainerMetrics is the resource usage of a container.
+type ContainerMetrics struct {
+	Name          string // Container name
+	CPUMillicores int64  // CPU usage in millicores
+	MemoryBytes   int64  // Memory working set in bytes
+}
+
+// PodMetrics is the resource usage of the containers of a pod.
+type PodMetrics struct {
+	Pod        string
+	Containers []ContainerMetrics
+}
+
+// CPUMillicores returns the CPU usage of all containers in millicores.
+func (m *PodMetrics) CPUMillicores() int64 {
+	var total int64
+	for _, c := range m.Containers {
+		total += c.CPUMillicores
+	}
+	return total
+}
+
+// MemoryBytes returns the memory working set of all containers in bytes.
+func (m *PodMetrics) MemoryBytes() int64 {
+	var total int64
+	for _, c := range m.Containers {
+		total += c.MemoryBytes
+	}
+	return total
+}
+
+// GetPodMetrics retrieves the current resource usage of the containers of a
+// pod in the configured namespace.
+func (c *Client) GetPodMetrics(ctx context.Context, name string) (*PodMetrics, error) {
+	args := []string{"top", "pod", name, "--containers"}
+
+	// Add context if specified
+	if c.kubeContext != "" {
+		args = append([]string{"--context", c.kubeContext}, args...)
+	}
+
+	// Add namespace if specified
+	if c.namespace != "" {
+		args = append(args, "-n", c.namespace)
+	}
+
+	output, err := c.runKubectl(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics of pod %s: %w", name, err)
+	}
+
+	metrics, err := parseTopOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics of pod %s: %w", name, err)
+	}
+	metrics.Pod = name
+	return metrics, nil
+}
+
+// parseTopOutput parses the table printed by kubectl top pod --containers:
+//
+//	POD     NAME   CPU(cores)   MEMORY(bytes)
+//	api-0   api    12m          45Mi
+//
+// Columns are located by their header, without --containers the NAME column
+// holds the pod, which is reported as a single container.
+func parseTopOutput(output string) (*PodMetrics, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, fmt.Errorf("empty output")
+	}
+
+	nameCol, cpuCol, memCol := -1, -1, -1
+	for i, header := range strings.Fields(lines[0]) {
+		switch {
+		case header == "NAME":
+			nameCol = i
+		case strings.HasPrefix(header, "CPU"):
+			cpuCol = i
+		case strings.HasPrefix(header, "MEMORY"):
+			memCol = i
+		}
+	}
+	if nameCol < 0 || cpuCol < 0 || memCol < 0 {
+		return nil, fmt.Errorf("unexpected header %q", lines[0])
+	}
+
+	metrics := &PodMetrics{}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) <= max(nameCol, cpuCol, memCol) {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		cpu, err := parseCPUMillicores(fields[cpuCol])
+		if err != nil {
+			return nil, err
+		}
+		memory, err := parseMemoryBytes(fields[memCol])
+		if err != nil {
+			return nil, err
+		}
+		metrics.Containers = append(metrics.Containers, ContainerMetrics{
+			Name:          fields[nameCol],
+			CPUMillicores: cpu,
+			MemoryBytes:   memory,
+		})
+	}
+	return metrics, nil
+}
+
+// cpuSuffixes are the suffixes of CPU quantities with their multiplier to
+// millicores.
+var cpuSuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"n", 1e-6}, {"u", 1e-3}, {"m", 1},
+}
+
+// parseCPUMillicores parses a CPU quantity (e.g., 250m, 2 or 1500000n) into
+// millicores.
+func parseCPUMillicores(quantity string) (int64, error) {
+	number, factor := quantity, 1000.0
+	for _, s := range cpuSuffixes {
+		if n, ok := strings.CutSuffix(quantity, s.suffix); ok {
+			number, factor = n, s.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU quantity %q", quantity)
+	}
+	return int64(value * factor), nil
+}
+
+// memorySuffixes are the binary and decimal suffixes of memory quantities.
+var memorySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseMemoryBytes parses a memory quantity (e.g., 45Mi, 1G or 1024) into
+// bytes.
+func parseMemoryBytes(quantity string) (int64, error) {
+	number, multiplier := quantity, 1.0
+	for _, s := range memorySuffixes {
+		if n, ok := strings.CutSuffix(quantity, s.suffix); ok {
+			number, multiplier = n, s.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory quantity %q", quantity)
+	}
+	return int64(value * multiplier), nil
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []ContainerMetrics
+		wantErr string
+	}{
+		{
+			name: "containers",
+			output: `POD     NAME      CPU(cores)   MEMORY(bytes)
+api-0   api       250m         45Mi
+api-0   sidecar   1            512Ki
+`,
+			want: []ContainerMetrics{
+				{Name: "api", CPUMillicores: 250, MemoryBytes: 45 << 20},
+				{Name: "sidecar", CPUMillicores: 1000, MemoryBytes: 512 << 10},
+			},
+		},
+		{
+			name: "pod",
+			output: `NAME    CPU(cores)   MEMORY(bytes)
+api-0   1500000n     1G
+`,
+			want: []ContainerMetrics{{Name: "api-0", CPUMillicores: 1, MemoryBytes: 1e9}},
+		},
+		{
+			name:    "empty",
+			output:  "",
+			wantErr: "empty output",
+		},
+		{
+			name:    "unexpected header",
+			output:  "error: Metrics API not available\n",
+			wantErr: `unexpected header "error: Metrics API not available"`,
+		},
+		{
+			name: "invalid quantity",
+			output: `NAME    CPU(cores)   MEMORY(bytes)
+api-0   lots         45Mi
+`,
+			wantErr: `invalid CPU quantity "lots"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := parseTopOutput(tt.output)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metrics.Containers)
+		})
+	}
+}
+
+func TestParseQuantities(t *testing.T) {
+	for quantity, want := range map[string]int64{"250m": 250, "2": 2000, "0.5": 500, "3000000n": 3, "1500u": 1} {
+		got, err := parseCPUMillicores(quantity)
+		require.NoError(t, err, quantity)
+		assert.Equal(t, want, got, quantity)
+	}
+
+	for quantity, want := range map[string]int64{"45Mi": 45 << 20, "2Gi": 2 << 30, "1k": 1000, "1024": 1024} {
+		got, err := parseMemoryBytes(quantity)
+		require.NoError(t, err, quantity)
+		assert.Equal(t, want, got, quantity)
+	}
+
+	_, err := parseMemoryBytes("Mi")
+	assert.EqualError(t, err, `invalid memory quantity "Mi"`)
+}
+
+func TestClient_GetPodMetrics(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: "POD     NAME   CPU(cores)   MEMORY(bytes)\napi-0   api    120m         40Mi\napi-0   envoy  30m          20Mi\n"}
+	}}
+	client := New("staging", "prod", WithRunner(fake))
+
+	metrics, err := client.GetPodMetrics(context.Background(), "api-0")
+	require.NoError(t, err)
+	assert.Equal(t, "api-0", metrics.Pod)
+	assert.Equal(t, int64(150), metrics.CPUMillicores())
+	assert.Equal(t, int64(60<<20), metrics.MemoryBytes())
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, []string{"--context", "staging", "top", "pod", "api-0", "--containers", "-n", "prod"}, cmds[0].Args)
+
+	// Clusters without metrics-server fail
+	fake.Handler = func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "error: Metrics API not available", Err: errors.New("exit status 1")}
+	}
+	_, err = client.GetPodMetrics(context.Background(), "api-0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get metrics of pod api-0")
+}
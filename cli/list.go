@@ -3,7 +3,10 @@ package cli
 // This file contains the list command for displaying previous test runs.
 
 import (
+	"cmp"
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 	"time"
@@ -15,10 +18,19 @@ import (
 
 func (a *App) list(ctx *cli.Context) error {
 	filterPath := ctx.String("path")
+	filterType := model.HistoryType(ctx.String("type"))
 	limit := ctx.Int("limit")
+	sortField := ctx.String("sort")
+	if _, ok := entryComparers[sortField]; !ok {
+		return fmt.Errorf("invalid sort field %q: must be time, duration, exit or size", sortField)
+	}
+
+	if filterType != "" && filterType != model.HistoryTypeTest && filterType != model.HistoryTypeAttach {
+		return fmt.Errorf("invalid type %q: must be %s or %s", filterType, model.HistoryTypeTest, model.HistoryTypeAttach)
+	}
 
 	// Get perfgo root directory
-	perfgoRoot, err := history.GetPerfgoRoot()
+	perfgoRoot, err := history.GetPerfgoRoot(a.outputDir)
 	if err != nil {
 		return err
 	}
@@ -29,13 +41,8 @@ func (a *App) list(ctx *cli.Context) error {
 		return fmt.Errorf("failed to load history: %w", err)
 	}
 
-	// Apply path filter if specified
-	var filteredEntries []history.Entry
-	for _, entry := range historyEntries {
-		if filterPath == "" || strings.Contains(entry.History.WorkDir, filterPath) {
-			filteredEntries = append(filteredEntries, entry)
-		}
-	}
+	// Apply path and type filters if specified
+	filteredEntries := filterEntries(historyEntries, filterPath, filterType)
 
 	if len(filteredEntries) == 0 {
 		if filterPath != "" {
@@ -46,10 +53,7 @@ func (a *App) list(ctx *cli.Context) error {
 		return nil
 	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(filteredEntries, func(i, j int) bool {
-		return filteredEntries[i].History.Timestamp.After(filteredEntries[j].History.Timestamp)
-	})
+	sortEntries(filteredEntries, sortField, ctx.Bool("reverse"))
 
 	// Apply limit
 	displayRuns := filteredEntries
@@ -60,46 +64,226 @@ func (a *App) list(ctx *cli.Context) error {
 	fmt.Printf("\n=== History (%d total) ===\n\n", len(filteredEntries))
 
 	for _, entry := range displayRuns {
-		tr := entry.History
-		timestamp := tr.Timestamp.Format("2006-01-02 15:04:05")
+		printEntry(os.Stdout, entry)
+	}
+	printSummary(os.Stdout, summarizeEntries(displayRuns))
 
-		// Format duration
-		duration := tr.Duration.Round(time.Millisecond)
+	fmt.Println("\nView test output: cat <path>/stdout.txt")
+	fmt.Println("View profile: perfgo view <ID>")
 
-		// Determine status indicator
-		status := "✓"
-		if tr.ExitCode != 0 {
-			status = "✗"
+	return nil
+}
+
+// filterEntries returns the entries whose working directory contains
+// filterPath and, if filterType is set, that are of that type.
+func filterEntries(entries []history.Entry, filterPath string, filterType model.HistoryType) []history.Entry {
+	var filtered []history.Entry
+	for _, entry := range entries {
+		if filterPath != "" && !strings.Contains(entry.History.WorkDir, filterPath) {
+			continue
+		}
+		if filterType != "" && entryType(entry.History) != filterType {
+			continue
 		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
 
-		// Format args (skip the program name)
-		args := ""
-		if len(tr.Args) > 1 {
-			args = strings.Join(tr.Args[1:], " ")
+// entryComparers compare history entries by the fields list can sort by,
+// ordering the newest, slowest, failed and largest runs first.
+var entryComparers = map[string]func(a, b *model.History) int{
+	"time": func(a, b *model.History) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	},
+	"duration": func(a, b *model.History) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	},
+	"exit": func(a, b *model.History) int {
+		return cmp.Compare(b.ExitCode, a.ExitCode)
+	},
+	"size": func(a, b *model.History) int {
+		return cmp.Compare(artifactsSize(b), artifactsSize(a))
+	},
+}
+
+// sortEntries sorts the entries by field, one of the keys of entryComparers,
+// breaking ties newest first. reverse inverts the order.
+func sortEntries(entries []history.Entry, field string, reverse bool) {
+	compare := entryComparers[field]
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := &entries[i].History, &entries[j].History
+		c := compare(a, b)
+		if c == 0 {
+			c = entryComparers["time"](a, b)
 		}
+		if reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+}
 
-		// Show short ID (first 8 chars)
-		shortID := tr.ID
-		if len(shortID) > 8 {
-			shortID = shortID[:8]
+// artifactsSize returns the total size of the artifacts of a run in bytes.
+func artifactsSize(h *model.History) uint64 {
+	var size uint64
+	for _, artifact := range h.Artifacts {
+		size += artifact.Size
+	}
+	return size
+}
+
+// listSummary aggregates the runs shown by list.
+type listSummary struct {
+	Passed int
+	Failed int
+	Size   uint64    // Total size of the artifacts in bytes
+	Oldest time.Time // Zero if no run has a timestamp
+	Newest time.Time
+}
+
+// summarizeEntries aggregates the exit codes, artifact sizes and timestamps
+// of the entries.
+func summarizeEntries(entries []history.Entry) listSummary {
+	var summary listSummary
+	for i := range entries {
+		h := &entries[i].History
+		if h.ExitCode == 0 {
+			summary.Passed++
+		} else {
+			summary.Failed++
 		}
+		summary.Size += artifactsSize(h)
 
-		fmt.Printf("%s  %s  [%s]  exit=%d  id=%s\n", status, timestamp, duration, tr.ExitCode, shortID)
-		if args != "" {
-			fmt.Printf("   Args: %s\n", args)
+		if h.Timestamp.IsZero() {
+			continue
+		}
+		if summary.Oldest.IsZero() || h.Timestamp.Before(summary.Oldest) {
+			summary.Oldest = h.Timestamp
+		}
+		if h.Timestamp.After(summary.Newest) {
+			summary.Newest = h.Timestamp
 		}
+	}
+	return summary
+}
+
+// printSummary writes the summary footer of list to w.
+func printSummary(w io.Writer, summary listSummary) {
+	fmt.Fprintf(w, "Summary: %d passed, %d failed, %s of artifacts", summary.Passed, summary.Failed, formatSize(summary.Size))
+	if !summary.Oldest.IsZero() {
+		fmt.Fprintf(w, ", %s to %s", summary.Oldest.Format("2006-01-02 15:04:05"), summary.Newest.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintln(w)
+}
+
+// formatSize formats a size in bytes with a binary unit, e.g. 1.5 MB.
+func formatSize(size uint64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+}
+
+// entryType returns the type of a history entry, entries recorded before the
+// type was stored are test runs.
+func entryType(h model.History) model.HistoryType {
+	if h.Type == "" {
+		return model.HistoryTypeTest
+	}
+	return h.Type
+}
+
+// printEntry writes the summary of a history entry to w. Attach runs show
+// their Kubernetes, SSH or system-wide target, test runs their path, target and commit.
+func printEntry(w io.Writer, entry history.Entry) {
+	tr := entry.History
+	timestamp := tr.Timestamp.Format("2006-01-02 15:04:05")
+
+	// Format duration
+	duration := tr.Duration.Round(time.Millisecond)
+
+	// Determine status indicator
+	status := "✓"
+	if tr.ExitCode != 0 {
+		status = "✗"
+	}
+
+	// Format args (skip the program name)
+	args := ""
+	if len(tr.Args) > 1 {
+		args = strings.Join(tr.Args[1:], " ")
+	}
+
+	// Show short ID (first 8 chars)
+	shortID := tr.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+
+	fmt.Fprintf(w, "%s  %s  [%s]  exit=%d  id=%s", status, timestamp, duration, tr.ExitCode, shortID)
+	if tr.BatchID != "" {
+		fmt.Fprintf(w, "  batch=%s", tr.BatchID)
+	}
+	fmt.Fprintln(w)
+	if args != "" {
+		fmt.Fprintf(w, "   Args: %s\n", args)
+	}
+
+	if entryType(tr) == model.HistoryTypeAttach && tr.Attach != nil {
+		if tr.Attach.KubeContext != "" {
+			fmt.Fprintf(w, "   Context: %s\n", tr.Attach.KubeContext)
+		}
+		if tr.Attach.PodName != "" {
+			fmt.Fprintf(w, "   Pod: %s/%s", tr.Attach.Namespace, tr.Attach.PodName)
+			if tr.Attach.Selector != "" {
+				fmt.Fprintf(w, " (selector %s)", tr.Attach.Selector)
+			}
+			fmt.Fprintln(w)
+		}
+		if tr.Attach.UsageBefore != nil || tr.Attach.UsageAfter != nil {
+			fmt.Fprintf(w, "   Usage: %s\n", formatResourceUsage(tr.Attach.UsageBefore, tr.Attach.UsageAfter))
+		}
+		if tr.Attach.NodeName != "" {
+			fmt.Fprintf(w, "   Node: %s", tr.Attach.NodeName)
+			if tr.Target != nil && tr.Target.OS != "" && tr.Target.Arch != "" {
+				fmt.Fprintf(w, " (%s/%s)", tr.Target.OS, tr.Target.Arch)
+			}
+			fmt.Fprintln(w)
+		}
+		if tr.Attach.Host != "" {
+			fmt.Fprintf(w, "   Host: %s", tr.Attach.Host)
+			if tr.Target != nil && tr.Target.OS != "" && tr.Target.Arch != "" {
+				fmt.Fprintf(w, " (%s/%s)", tr.Target.OS, tr.Target.Arch)
+			}
+			fmt.Fprintln(w)
+		}
+		if tr.Attach.Process != "" {
+			fmt.Fprintf(w, "   Process: %s\n", tr.Attach.Process)
+		}
+		if tr.Attach.SystemWide {
+			if tr.Attach.Host == "" && tr.Target != nil && tr.Target.OS != "" && tr.Target.Arch != "" {
+				fmt.Fprintf(w, "   Local: %s/%s\n", tr.Target.OS, tr.Target.Arch)
+			}
+			fmt.Fprintln(w, "   System-wide: all CPUs")
+		}
+	} else {
 		if tr.WorkDir != "" {
-			fmt.Printf("   Path: %s\n", tr.WorkDir)
+			fmt.Fprintf(w, "   Path: %s\n", tr.WorkDir)
 		}
 		if tr.Target != nil {
 			if tr.Target.RemoteHost != "" {
-				fmt.Printf("   Remote: %s", tr.Target.RemoteHost)
+				fmt.Fprintf(w, "   Remote: %s", tr.Target.RemoteHost)
 				if tr.Target.OS != "" && tr.Target.Arch != "" {
-					fmt.Printf(" (%s/%s)", tr.Target.OS, tr.Target.Arch)
+					fmt.Fprintf(w, " (%s/%s)", tr.Target.OS, tr.Target.Arch)
 				}
-				fmt.Println()
+				fmt.Fprintln(w)
 			} else if tr.Target.OS != "" && tr.Target.Arch != "" {
-				fmt.Printf("   Local: %s/%s\n", tr.Target.OS, tr.Target.Arch)
+				fmt.Fprintf(w, "   Local: %s/%s\n", tr.Target.OS, tr.Target.Arch)
 			}
 		}
 		if tr.Git != nil && tr.Git.Commit != "" {
@@ -107,38 +291,48 @@ func (a *App) list(ctx *cli.Context) error {
 			if len(shortCommit) > 8 {
 				shortCommit = shortCommit[:8]
 			}
-			fmt.Printf("   Commit: %s", shortCommit)
-			if tr.Git.Branch != "" {
-				fmt.Printf(" (%s)", tr.Git.Branch)
-			}
-			fmt.Println()
-		}
-		if len(tr.Artifacts) > 0 {
-			for _, artifact := range tr.Artifacts {
-				var typeName string
-				switch artifact.Type {
-				case model.ArtifactTypePprofProfile:
-					typeName = "profile"
-				case model.ArtifactTypeTestBinary:
-					typeName = "binary"
-				case model.ArtifactTypeAttachBinary:
-					typeName = "binary"
-				case model.ArtifactTypeStdout:
-					typeName = "stdout"
-				case model.ArtifactTypeStderr:
-					typeName = "stderr"
-				}
-				if typeName != "" {
-					fmt.Printf("   %s: %s (%.1f KB)\n", typeName, artifact.File, float64(artifact.Size)/1024)
-				}
-			}
+			fmt.Fprintf(w, "   Commit: %s%s\n", shortCommit, gitRefSuffix(tr.Git))
 		}
-		fmt.Printf("   %s\n", entry.FullPath)
-		fmt.Println()
 	}
 
-	fmt.Println("\nView test output: cat <path>/stdout.txt")
-	fmt.Println("View profile: perfgo view <ID>")
-
-	return nil
+	for _, artifact := range tr.Artifacts {
+		var typeName string
+		switch artifact.Type {
+		case model.ArtifactTypePprofProfile:
+			typeName = "profile"
+		case model.ArtifactTypePprofProfileRun:
+			typeName = "run profile"
+		case model.ArtifactTypeTestBinary:
+			typeName = "binary"
+		case model.ArtifactTypeAttachBinary:
+			typeName = "binary"
+		case model.ArtifactTypePerfStat, model.ArtifactTypePerfStatDetailed:
+			typeName = "stat"
+		case model.ArtifactTypePerfStatRun:
+			typeName = "run stat"
+		case model.ArtifactTypePerfC2CReport:
+			typeName = "c2c"
+		case model.ArtifactTypePerfMemReport:
+			typeName = "mem"
+		case model.ArtifactTypeFoldedStacks:
+			typeName = "folded"
+		case model.ArtifactTypeProfileText:
+			typeName = "text"
+		case model.ArtifactTypeProfileJSON:
+			typeName = "json"
+		case model.ArtifactTypeSymbols:
+			typeName = "symbols"
+		case model.ArtifactTypePerfData:
+			typeName = "perf.data"
+		case model.ArtifactTypeStdout:
+			typeName = "stdout"
+		case model.ArtifactTypeStderr:
+			typeName = "stderr"
+		}
+		if typeName != "" {
+			fmt.Fprintf(w, "   %s: %s (%.1f KB)\n", typeName, artifact.File, float64(artifact.Size)/1024)
+		}
+	}
+	fmt.Fprintf(w, "   %s\n", entry.FullPath)
+	fmt.Fprintln(w)
 }
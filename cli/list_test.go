@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func listTestEntries() []history.Entry {
+	ts := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	return []history.Entry{
+		{
+			FullPath: "/repo/.perfgo/history/test-run",
+			History: model.History{
+				ID:        "aaaaaaaa11111111",
+				Type:      model.HistoryTypeTest,
+				Timestamp: ts,
+				Duration:  1500 * time.Millisecond,
+				Args:      []string{"perfgo", "test", "stat", "./pkg"},
+				WorkDir:   "pkg/foo",
+				Target:    &model.Target{RemoteHost: "bench", OS: "linux", Arch: "amd64"},
+				Git:       &model.Git{Commit: "0123456789abcdef", Branch: "main", Dirty: true},
+			},
+		},
+		{
+			FullPath: "/repo/.perfgo/history/attach-run",
+			History: model.History{
+				ID:        "bbbbbbbb22222222",
+				Type:      model.HistoryTypeAttach,
+				Timestamp: ts,
+				ExitCode:  1,
+				Args:      []string{"perfgo", "attach", "stat", "--pod", "checkout"},
+				WorkDir:   "pkg/foo",
+				Target:    &model.Target{RemoteHost: "worker-01", OS: "linux", Arch: "arm64"},
+				Git:       &model.Git{Commit: "0123456789abcdef"},
+				Attach: &model.AttachRun{
+					KubeContext: "prod",
+					Namespace:   "shop",
+					PodName:     "checkout",
+					NodeName:    "worker-01",
+					UsageBefore: &model.ResourceUsage{CPUMillicores: 120, MemoryBytes: 45 << 20},
+					UsageAfter:  &model.ResourceUsage{CPUMillicores: 480, MemoryBytes: 60 << 20},
+				},
+				Artifacts: []model.Artifact{{Type: model.ArtifactTypePerfStat, File: "perf-stat.txt", Size: 2048}},
+			},
+		},
+		{
+			// Recorded before the type was stored
+			FullPath: "/repo/.perfgo/history/legacy-run",
+			History:  model.History{ID: "cccccccc33333333", WorkDir: "other"},
+		},
+	}
+}
+
+func TestPrintEntry(t *testing.T) {
+	entries := listTestEntries()
+
+	var test bytes.Buffer
+	printEntry(&test, entries[0])
+	assert.Equal(t, `✓  2026-01-02 15:04:05  [1.5s]  exit=0  id=aaaaaaaa
+   Args: test stat ./pkg
+   Path: pkg/foo
+   Remote: bench (linux/amd64)
+   Commit: 01234567 (main) (dirty)
+   /repo/.perfgo/history/test-run
+
+`, test.String())
+
+	var batch bytes.Buffer
+	entries[2].History.BatchID = "0123456789abcdef"
+	printEntry(&batch, entries[2])
+	assert.Contains(t, batch.String(), "id=cccccccc  batch=0123456789abcdef\n")
+
+	var attach bytes.Buffer
+	printEntry(&attach, entries[1])
+	assert.Equal(t, `✗  2026-01-02 15:04:05  [0s]  exit=1  id=bbbbbbbb
+   Args: attach stat --pod checkout
+   Context: prod
+   Pod: shop/checkout
+   Usage: cpu 120m -> 480m, memory 45Mi -> 60Mi
+   Node: worker-01 (linux/arm64)
+   stat: perf-stat.txt (2.0 KB)
+   /repo/.perfgo/history/attach-run
+
+`, attach.String())
+
+	var host bytes.Buffer
+	entries[1].History.Attach = &model.AttachRun{Host: "user@bench", Process: "myserver"}
+	printEntry(&host, entries[1])
+	assert.Contains(t, host.String(), "   Host: user@bench (linux/arm64)\n   Process: myserver\n")
+
+	var system bytes.Buffer
+	entries[1].History.Attach = &model.AttachRun{SystemWide: true}
+	printEntry(&system, entries[1])
+	assert.Contains(t, system.String(), "   Local: linux/arm64\n   System-wide: all CPUs\n")
+}
+
+func TestFilterEntries(t *testing.T) {
+	entries := listTestEntries()
+
+	ids := func(entries []history.Entry) []string {
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.History.ID[:8])
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb", "cccccccc"}, ids(filterEntries(entries, "", "")))
+	assert.Equal(t, []string{"aaaaaaaa", "cccccccc"}, ids(filterEntries(entries, "", model.HistoryTypeTest)))
+	assert.Equal(t, []string{"bbbbbbbb"}, ids(filterEntries(entries, "", model.HistoryTypeAttach)))
+	assert.Equal(t, []string{"aaaaaaaa"}, ids(filterEntries(entries, "pkg", model.HistoryTypeTest)))
+}
+
+func TestSortEntries(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	entry := func(id string, age, duration time.Duration, exitCode int, sizes ...uint64) history.Entry {
+		h := model.History{ID: id, Timestamp: ts.Add(-age), Duration: duration, ExitCode: exitCode}
+		for _, size := range sizes {
+			h.Artifacts = append(h.Artifacts, model.Artifact{Size: size})
+		}
+		return history.Entry{History: h}
+	}
+
+	tests := []struct {
+		field   string
+		reverse bool
+		want    []string
+	}{
+		{field: "time", want: []string{"new", "mid", "old", "oldest"}},
+		{field: "time", reverse: true, want: []string{"oldest", "old", "mid", "new"}},
+		{field: "duration", want: []string{"old", "mid", "new", "oldest"}},
+		{field: "duration", reverse: true, want: []string{"oldest", "new", "mid", "old"}},
+		// Ties are broken newest first
+		{field: "exit", want: []string{"mid", "oldest", "new", "old"}},
+		{field: "size", want: []string{"new", "oldest", "mid", "old"}},
+		{field: "size", reverse: true, want: []string{"old", "mid", "oldest", "new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s reverse=%t", tt.field, tt.reverse), func(t *testing.T) {
+			entries := []history.Entry{
+				entry("old", 2*time.Hour, time.Minute, 0, 100),
+				entry("new", 0, 10*time.Second, 0, 4096, 4096),
+				entry("oldest", 3*time.Hour, time.Second, 2, 5000),
+				entry("mid", time.Hour, 30*time.Second, 2, 1000),
+			}
+			sortEntries(entries, tt.field, tt.reverse)
+
+			var ids []string
+			for _, e := range entries {
+				ids = append(ids, e.History.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestSummarizeEntries(t *testing.T) {
+	entries := listTestEntries()
+	entries[0].History.Artifacts = []model.Artifact{{Size: 3 << 20}}
+	entries[0].History.Timestamp = entries[0].History.Timestamp.Add(-48 * time.Hour)
+
+	summary := summarizeEntries(entries)
+	assert.Equal(t, listSummary{
+		Passed: 2,
+		Failed: 1,
+		Size:   3<<20 + 2048,
+		Oldest: time.Date(2025, 12, 31, 15, 4, 5, 0, time.UTC),
+		Newest: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+	}, summary)
+
+	var out bytes.Buffer
+	printSummary(&out, summary)
+	assert.Equal(t, "Summary: 2 passed, 1 failed, 3.0 MB of artifacts, 2025-12-31 15:04:05 to 2026-01-02 15:04:05\n", out.String())
+
+	// Entries recorded before timestamps were stored have no date range
+	out.Reset()
+	printSummary(&out, summarizeEntries(entries[2:]))
+	assert.Equal(t, "Summary: 1 passed, 0 failed, 0.0 KB of artifacts\n", out.String())
+}
@@ -0,0 +1,93 @@
+package cli
+
+// This file contains the configuration of perfgo's own log output with
+// --log-format and --log-level.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/progress"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// Log formats of --log-format
+const (
+	LogFormatConsole = "console" // Human readable, colored on a terminal
+	LogFormatJSON    = "json"    // One JSON object per line
+)
+
+// logFlags returns the global flags configuring the log output.
+func logFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "log-format",
+			Usage:   "Log format, console or json (default: console on a terminal, json otherwise)",
+			EnvVars: []string{"PERFGO_LOG_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    "log-level",
+			Usage:   "Log level, debug, info, warn or error",
+			Value:   zerolog.InfoLevel.String(),
+			EnvVars: []string{"PERFGO_LOG_LEVEL"},
+		},
+	}
+}
+
+// resolveLogFormat returns the log format to use for --log-format format,
+// console on a terminal and json otherwise if no format is given.
+func resolveLogFormat(format string, terminal bool) (string, error) {
+	switch format {
+	case "":
+		if terminal {
+			return LogFormatConsole, nil
+		}
+		return LogFormatJSON, nil
+	case LogFormatConsole, LogFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid --log-format %q: must be %s or %s", format, LogFormatConsole, LogFormatJSON)
+	}
+}
+
+// parseLogLevel parses --log-level, --verbose always logs at debug level.
+func parseLogLevel(level string, verbose bool) (zerolog.Level, error) {
+	if verbose {
+		return zerolog.DebugLevel, nil
+	}
+	switch l := strings.ToLower(level); l {
+	case "debug", "info", "warn", "error":
+		return zerolog.ParseLevel(l)
+	default:
+		return zerolog.NoLevel, fmt.Errorf("invalid --log-level %q: must be debug, info, warn or error", level)
+	}
+}
+
+// newLogger returns a logger writing to w in the given format.
+func newLogger(w io.Writer, format string) zerolog.Logger {
+	if format == LogFormatJSON {
+		return zerolog.New(w).With().Timestamp().Logger()
+	}
+	return zerolog.New(zerolog.ConsoleWriter{
+		Out:        w,
+		TimeFormat: time.RFC3339Nano,
+	}).With().Timestamp().Logger()
+}
+
+// configureLogging sets up the logger and the log level from the flags.
+func (a *App) configureLogging(ctx *cli.Context) error {
+	format, err := resolveLogFormat(ctx.String("log-format"), progress.IsTerminal(os.Stderr))
+	if err != nil {
+		return err
+	}
+	level, err := parseLogLevel(ctx.String("log-level"), ctx.Bool("verbose"))
+	if err != nil {
+		return err
+	}
+	a.logger = newLogger(os.Stderr, format).Level(level)
+	return nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestResolveLogFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		terminal bool
+		want     string
+		wantErr  string
+	}{
+		{name: "default on terminal", terminal: true, want: LogFormatConsole},
+		{name: "default without terminal", want: LogFormatJSON},
+		{name: "console without terminal", format: "console", want: LogFormatConsole},
+		{name: "json on terminal", format: "json", terminal: true, want: LogFormatJSON},
+		{name: "invalid", format: "xml", wantErr: `invalid --log-format "xml": must be console or json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLogFormat(tt.format, tt.terminal)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		verbose bool
+		want    zerolog.Level
+		wantErr bool
+	}{
+		{name: "info", level: "info", want: zerolog.InfoLevel},
+		{name: "warn", level: "warn", want: zerolog.WarnLevel},
+		{name: "uppercase", level: "ERROR", want: zerolog.ErrorLevel},
+		{name: "verbose wins", level: "error", verbose: true, want: zerolog.DebugLevel},
+		{name: "invalid", level: "trace", wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogLevel(tt.level, tt.verbose)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, LogFormatJSON)
+	logger.Info().Str("host", "example").Msg("Connecting")
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "example", entry["host"])
+	assert.Equal(t, "Connecting", entry["message"])
+	assert.Contains(t, entry, "time")
+
+	buf.Reset()
+	logger = newLogger(&buf, LogFormatConsole)
+	logger.Info().Str("host", "example").Msg("Connecting")
+	assert.False(t, json.Valid(buf.Bytes()))
+	assert.Contains(t, buf.String(), "Connecting")
+	assert.Contains(t, buf.String(), "host=")
+}
+
+func TestConfigureLogging(t *testing.T) {
+	globalLevel := zerolog.GlobalLevel()
+
+	var app *App
+	run := func(args ...string) error {
+		app = New()
+		app.cli.Commands = nil
+		app.cli.Action = func(*cli.Context) error { return nil }
+		return app.Run(append([]string{AppName}, args...))
+	}
+
+	require.NoError(t, run("--log-level", "warn"))
+	assert.Equal(t, zerolog.WarnLevel, app.logger.GetLevel())
+
+	require.NoError(t, run("--log-level", "warn", "--verbose"))
+	assert.Equal(t, zerolog.DebugLevel, app.logger.GetLevel())
+
+	// The level is set on perfgo's logger, not globally
+	assert.Equal(t, globalLevel, zerolog.GlobalLevel())
+
+	assert.EqualError(t, run("--log-format", "xml"), `invalid --log-format "xml": must be console or json`)
+	assert.Error(t, run("--log-level", "loud"))
+}
@@ -0,0 +1,130 @@
+package cli
+
+// This file contains the --matrix option, which runs the same test on several
+// targets in one command and groups the recorded runs into a batch.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// matrixFlag returns the flag listing the targets of a matrix run.
+func matrixFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "matrix",
+		Usage: "Run on each target in turn, a remote host or a goos/goarch to cross-compile for and run locally (can be repeated or comma separated)",
+	}
+}
+
+// matrixTarget is a target of a matrix run, either a remote host or a
+// platform the tests are built for and run locally.
+type matrixTarget struct {
+	Host   string
+	GOOS   string
+	GOARCH string
+}
+
+// String returns the target as given on the command line.
+func (t matrixTarget) String() string {
+	if t.Host != "" {
+		return t.Host
+	}
+	return t.GOOS + "/" + t.GOARCH
+}
+
+// parseMatrix parses the --matrix values. Values containing a slash are
+// goos/goarch platforms, all others SSH hosts.
+func parseMatrix(values []string) ([]matrixTarget, error) {
+	var targets []matrixTarget
+	seen := map[matrixTarget]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		var target matrixTarget
+		if goos, goarch, ok := strings.Cut(value, "/"); ok {
+			if goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+				return nil, fmt.Errorf("invalid --matrix target %q: must be a host or goos/goarch", value)
+			}
+			target = matrixTarget{GOOS: goos, GOARCH: goarch}
+		} else {
+			target = matrixTarget{Host: value}
+		}
+
+		if seen[target] {
+			return nil, fmt.Errorf("duplicate --matrix target %q", value)
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// hasMatrixHost reports whether any of the targets is a remote host.
+func hasMatrixHost(targets []matrixTarget) bool {
+	for _, target := range targets {
+		if target.Host != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newBatchID returns a random ID shared by the runs of a matrix.
+func newBatchID() (string, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to generate batch ID: %w", err)
+	}
+	return hex.EncodeToString(idBytes), nil
+}
+
+// matrixOptions returns the options of the run of opts on target, recorded
+// as part of batchID.
+func matrixOptions(opts TestOptions, target matrixTarget, batchID string) TestOptions {
+	opts.RemoteHost = target.Host
+	opts.GOOS = target.GOOS
+	opts.GOARCH = target.GOARCH
+	opts.BatchID = batchID
+	return opts
+}
+
+// runMatrix runs opts on every target in turn, recording each run in the
+// history under a shared batch ID. A failing target doesn't stop the others,
+// an error is returned after all targets ran if any of them failed.
+func (a *App) runMatrix(opts TestOptions, targets []matrixTarget) ([]*TestResult, error) {
+	batchID, err := newBatchID()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*TestResult
+	failed := 0
+	for _, target := range targets {
+		a.logger.Info().
+			Str("target", target.String()).
+			Str("batch", batchID).
+			Msg("Running matrix target")
+
+		result, err := a.RunTest(matrixOptions(opts, target, batchID))
+		if err != nil {
+			a.logger.Error().Err(err).Str("target", target.String()).Msg("Matrix target failed")
+			failed++
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+
+	fmt.Printf("Batch %s: %d of %d targets passed\n", batchID, len(targets)-failed, len(targets))
+	if failed > 0 {
+		return results, fmt.Errorf("tests failed on %d of %d matrix targets", failed, len(targets))
+	}
+	return results, nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/history"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMatrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []matrixTarget
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name:   "hosts and platforms",
+			values: []string{"bench-amd64", "ubuntu@bench-arm64", " linux/arm64 ", "linux/386"},
+			want: []matrixTarget{
+				{Host: "bench-amd64"},
+				{Host: "ubuntu@bench-arm64"},
+				{GOOS: "linux", GOARCH: "arm64"},
+				{GOOS: "linux", GOARCH: "386"},
+			},
+		},
+		{name: "missing goarch", values: []string{"linux/"}, wantErr: `invalid --matrix target "linux/"`},
+		{name: "too many parts", values: []string{"linux/arm/v7"}, wantErr: `invalid --matrix target "linux/arm/v7"`},
+		{name: "duplicate", values: []string{"linux/arm64", "bench", "linux/arm64"}, wantErr: `duplicate --matrix target "linux/arm64"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMatrix(tt.values)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatrixOptions(t *testing.T) {
+	opts := TestOptions{Mode: "profile", Args: []string{"."}, RemoteHost: "ignored"}
+
+	host := matrixOptions(opts, matrixTarget{Host: "bench"}, "batch")
+	assert.Equal(t, "bench", host.RemoteHost)
+	assert.Empty(t, host.GOOS)
+	assert.Equal(t, "batch", host.BatchID)
+	assert.Equal(t, "profile", host.Mode)
+
+	platform := matrixOptions(opts, matrixTarget{GOOS: "linux", GOARCH: "arm64"}, "batch")
+	assert.Empty(t, platform.RemoteHost)
+	assert.Equal(t, "linux", platform.GOOS)
+	assert.Equal(t, "arm64", platform.GOARCH)
+}
+
+func TestTestMatrix(t *testing.T) {
+	writeTestModule(t)
+	outputDir := t.TempDir()
+
+	fake := fakeGoProfileRunner(t)
+	app := New(WithRunner(fake))
+	captureStdout(t, func() {
+		require.NoError(t, app.Run([]string{AppName, "--output-dir", outputDir, "test", "--matrix", "linux/amd64,linux/arm64", "--", ".", "-run", "TestA"}))
+	})
+
+	entries, err := history.LoadEntries(zerolog.Nop(), outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// One run per target, sharing the batch ID
+	batchID := entries[0].History.BatchID
+	assert.NotEmpty(t, batchID)
+	var arches []string
+	for _, entry := range entries {
+		assert.Equal(t, batchID, entry.History.BatchID)
+		require.NotNil(t, entry.History.Target)
+		arches = append(arches, entry.History.Target.Arch)
+	}
+	assert.NotEqual(t, entries[0].History.ID, entries[1].History.ID)
+	assert.NotEqual(t, entries[0].FullPath, entries[1].FullPath)
+	assert.ElementsMatch(t, []string{"amd64", "arm64"}, arches)
+
+	// Each target is cross-compiled for its platform
+	var builds []runner.Cmd
+	for _, cmd := range fake.Commands() {
+		if cmd.Name == "go" && cmd.Args[0] == "test" {
+			builds = append(builds, cmd)
+		}
+	}
+	require.Len(t, builds, 2)
+	assert.True(t, slices.Contains(builds[0].Env, "GOARCH=amd64"))
+	assert.True(t, slices.Contains(builds[1].Env, "GOARCH=arm64"))
+}
+
+func TestTestMatrix_RemoteHostConflict(t *testing.T) {
+	app := New(WithRunner(&runner.Fake{}), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+	err := app.Run([]string{AppName, "test", "--matrix", "linux/arm64", "--remote-host", "bench", "--", "."})
+	require.ErrorContains(t, err, "--matrix and --remote-host are mutually exclusive")
+}
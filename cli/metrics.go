@@ -0,0 +1,132 @@
+package cli
+
+// This file contains --metrics-out, which writes the perf stat counters and
+// benchmark results of a test run in the Prometheus text exposition format,
+// so CI jobs can push them to a metrics backend.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/perfgo/perfgo/perfstat"
+	"github.com/urfave/cli/v2"
+)
+
+// Names of the metrics written by --metrics-out
+const (
+	metricPerfStat         = "perfgo_perf_stat_value"
+	metricBenchmarkNsPerOp = "perfgo_benchmark_ns_per_op"
+)
+
+// metricsOutFlag returns the flag writing the metrics of a test run to a file.
+func metricsOutFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "metrics-out",
+		Usage: "Write the perf stat counters and benchmark ns/op of the run to this file in the Prometheus text format, e.g. for a Pushgateway or the node exporter's textfile collector",
+	}
+}
+
+// metricLabel is a label of a metric sample.
+type metricLabel struct {
+	name, value string
+}
+
+// labelValueEscaper escapes label values as the text format requires.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetricSample writes a sample line of metric with the labels and value.
+func writeMetricSample(w io.Writer, metric string, labels []metricLabel, value float64) {
+	quoted := make([]string, len(labels))
+	for i, l := range labels {
+		quoted[i] = fmt.Sprintf(`%s="%s"`, l.name, labelValueEscaper.Replace(l.value))
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", metric, strings.Join(quoted, ","), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// writeMetrics writes the mean of the perf stat counters in summaries and
+// the ns/op of the benchmarks of h in the Prometheus text format. Samples are
+// labelled with the commit and working directory of the run. Events that
+// were never counted are left out.
+func writeMetrics(w io.Writer, h model.History, summaries []perfstat.Summary) error {
+	var commit string
+	if h.Git != nil {
+		commit = h.Git.Commit
+	}
+	runLabels := []metricLabel{{"commit", commit}, {"workdir", h.WorkDir}}
+
+	bw := bufio.NewWriter(w)
+	if slices.ContainsFunc(summaries, func(s perfstat.Summary) bool { return s.Runs > 0 }) {
+		fmt.Fprintf(bw, "# HELP %s Mean value of a perf stat event over the runs.\n", metricPerfStat)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metricPerfStat)
+		for _, s := range summaries {
+			if s.Runs == 0 {
+				continue
+			}
+			labels := append([]metricLabel{
+				{"event", s.Event},
+				{"unit", s.Unit},
+				{"aggregation", s.Aggregation},
+			}, runLabels...)
+			writeMetricSample(bw, metricPerfStat, labels, s.Mean)
+		}
+	}
+
+	if h.Test != nil && len(h.Test.Benchmarks) > 0 {
+		fmt.Fprintf(bw, "# HELP %s Nanoseconds per iteration of a benchmark.\n", metricBenchmarkNsPerOp)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metricBenchmarkNsPerOp)
+		for _, b := range h.Test.Benchmarks {
+			labels := append([]metricLabel{
+				{"package", b.Package},
+				{"benchmark", b.Name},
+			}, runLabels...)
+			writeMetricSample(bw, metricBenchmarkNsPerOp, labels, b.NsPerOp)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeMetricsFile writes the metrics of the run recorded in runDir to path.
+// The file is renamed into place, so a scraper never reads a partial file.
+func writeMetricsFile(path string, h model.History, runDir string) error {
+	var summaries []perfstat.Summary
+	hasRuns := slices.ContainsFunc(h.Artifacts, func(a model.Artifact) bool {
+		return a.Type == model.ArtifactTypePerfStatRun
+	})
+	if hasRuns {
+		runs, err := statRuns(&history.Entry{History: h, FullPath: runDir})
+		if err != nil {
+			return err
+		}
+		summaries = perfstat.Aggregate(runs)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeMetrics(tmp, h, summaries); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	// CreateTemp creates the file readable by the owner only
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/perfgo/perfgo/perfstat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// promSample matches a sample line of the Prometheus text format with labels.
+var promSample = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*\{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\\n]|\\[\\"n])*",?)*\} (\S+)$`)
+
+func metricsTestHistory() model.History {
+	return model.History{
+		WorkDir: `pkg/"foo"`,
+		Git:     &model.Git{Commit: "0123456789abcdef"},
+		Test: &model.TestRun{Benchmarks: []model.BenchmarkResult{
+			{Package: "example.com/foo", Name: "BenchmarkFoo-8", Iterations: 1000, NsPerOp: 1234.5},
+		}},
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	summaries := []perfstat.Summary{
+		{Event: "cycles", Runs: 2, Mean: 1.5e9},
+		{Event: "task-clock", Unit: "msec", Runs: 2, Mean: 512.25},
+		{Event: "instructions", Aggregation: "S0", Runs: 1, Mean: 42},
+		{Event: "cache-misses", Runs: 0},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, metricsTestHistory(), summaries))
+	assert.Equal(t, `# HELP perfgo_perf_stat_value Mean value of a perf stat event over the runs.
+# TYPE perfgo_perf_stat_value gauge
+perfgo_perf_stat_value{event="cycles",unit="",aggregation="",commit="0123456789abcdef",workdir="pkg/\"foo\""} 1.5e+09
+perfgo_perf_stat_value{event="task-clock",unit="msec",aggregation="",commit="0123456789abcdef",workdir="pkg/\"foo\""} 512.25
+perfgo_perf_stat_value{event="instructions",unit="",aggregation="S0",commit="0123456789abcdef",workdir="pkg/\"foo\""} 42
+# HELP perfgo_benchmark_ns_per_op Nanoseconds per iteration of a benchmark.
+# TYPE perfgo_benchmark_ns_per_op gauge
+perfgo_benchmark_ns_per_op{package="example.com/foo",benchmark="BenchmarkFoo-8",commit="0123456789abcdef",workdir="pkg/\"foo\""} 1234.5
+`, buf.String())
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		match := promSample.FindStringSubmatch(line)
+		require.NotNil(t, match, "invalid sample line %q", line)
+		_, err := strconv.ParseFloat(match[len(match)-1], 64)
+		assert.NoError(t, err, "invalid sample value in %q", line)
+	}
+}
+
+func TestWriteMetrics_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, model.History{}, []perfstat.Summary{{Event: "cycles"}}))
+	assert.Empty(t, buf.String())
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	runDir := t.TempDir()
+	h := metricsTestHistory()
+	for i, value := range []float64{100, 300} {
+		var buf bytes.Buffer
+		require.NoError(t, perfstat.WriteCSV(&buf, []perfstat.Counter{{Event: "cycles", Value: value, Counted: true, Running: 100}}))
+		require.NoError(t, os.WriteFile(filepath.Join(runDir, runStatFile(i+1)), buf.Bytes(), 0o644))
+		h.Artifacts = append(h.Artifacts, model.Artifact{Type: model.ArtifactTypePerfStatRun, File: runStatFile(i + 1)})
+	}
+
+	outDir := t.TempDir()
+	path := filepath.Join(outDir, "perfgo.prom")
+	require.NoError(t, os.WriteFile(path, []byte("stale\n"), 0o644))
+	require.NoError(t, writeMetricsFile(path, h, runDir))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `perfgo_perf_stat_value{event="cycles",unit="",aggregation="",commit="0123456789abcdef",workdir="pkg/\"foo\""} 200`+"\n")
+	assert.Contains(t, string(data), "perfgo_benchmark_ns_per_op{")
+	assert.NotContains(t, string(data), "stale")
+
+	// The temporary file was renamed into place
+	files, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,138 @@
+package cli
+
+// This file contains the content-addressed object store, which keeps a single
+// copy of archived binaries shared by all history entries.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perfgo/perfgo/model"
+)
+
+// objectStoreDir returns the object store of the .perfgo directory containing
+// runDir (.perfgo/history/<run> -> .perfgo/objects).
+func objectStoreDir(runDir string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(runDir)), "objects")
+}
+
+// objectPath returns the path of the stored object with the given hash.
+func objectPath(storeDir, hash string, compressed bool) string {
+	if compressed {
+		return filepath.Join(storeDir, hash+".binary.gz")
+	}
+	return filepath.Join(storeDir, hash+".binary")
+}
+
+// binaryHash extracts the content hash from an archived binary filename:
+// <hash>.<basename>.binary[.gz] -> <hash>.
+func binaryHash(file string) (string, bool) {
+	if !strings.HasSuffix(strings.TrimSuffix(file, ".gz"), ".binary") {
+		return "", false
+	}
+	hash, _, ok := strings.Cut(file, ".")
+	return hash, ok && hash != ""
+}
+
+// internObject moves the file at path into the object store as obj, unless
+// an identical object is already stored, and replaces it by a link to the
+// stored object.
+func internObject(storeDir, obj, path string) error {
+	if objInfo, err := os.Stat(obj); err == nil {
+		// Nothing to do if path already links to the stored object
+		if info, err := os.Stat(path); err == nil && os.SameFile(objInfo, info) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove duplicate of stored object: %w", err)
+		}
+	} else {
+		if err := os.MkdirAll(storeDir, 0755); err != nil {
+			return fmt.Errorf("failed to create object store: %w", err)
+		}
+		if err := os.Rename(path, obj); err != nil {
+			return fmt.Errorf("failed to move file into object store: %w", err)
+		}
+	}
+
+	return linkObject(obj, path)
+}
+
+// linkObject makes the stored object available at path. It prefers a hard
+// link, falls back to a symlink and finally to a copy.
+func linkObject(obj, path string) error {
+	if err := os.Link(obj, path); err == nil {
+		return nil
+	}
+
+	if absObj, err := filepath.Abs(obj); err == nil {
+		if err := os.Symlink(absObj, path); err == nil {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(obj)
+	if err != nil {
+		return fmt.Errorf("failed to read stored object: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0755); err != nil {
+		return fmt.Errorf("failed to copy stored object: %w", err)
+	}
+	return nil
+}
+
+// internBinaries moves all archived binaries of the run into the object store
+// and records their hash in the artifacts. Binaries are gzip compressed first
+// if compression is enabled.
+func (a *App) internBinaries(runDir string, history *model.History) {
+	storeDir := objectStoreDir(runDir)
+
+	for i := range history.Artifacts {
+		artifact := &history.Artifacts[i]
+		if artifact.Type != model.ArtifactTypeTestBinary && artifact.Type != model.ArtifactTypeAttachBinary {
+			continue
+		}
+
+		hash, ok := binaryHash(artifact.File)
+		if !ok {
+			continue
+		}
+
+		if a.compressBinaries && !artifact.Compressed {
+			compressed, err := compressFile(filepath.Join(runDir, artifact.File))
+			if err != nil {
+				a.logger.Warn().Err(err).Str("file", artifact.File).Msg("Failed to compress binary")
+			} else {
+				artifact.File = filepath.Base(compressed)
+				artifact.Compressed = true
+			}
+		}
+
+		obj := objectPath(storeDir, hash, artifact.Compressed)
+		if err := internObject(storeDir, obj, filepath.Join(runDir, artifact.File)); err != nil {
+			a.logger.Warn().Err(err).Str("file", artifact.File).Msg("Failed to move binary into object store")
+			continue
+		}
+		artifact.Hash = hash
+
+		a.logger.Debug().
+			Str("hash", hash).
+			Str("file", artifact.File).
+			Msg("Stored binary in object store")
+	}
+}
+
+// resolveArtifactPath returns the path of the artifact's content. Binaries
+// missing from the run directory are resolved through the object store.
+func resolveArtifactPath(runDir string, artifact model.Artifact) string {
+	path := filepath.Join(runDir, artifact.File)
+	if artifact.Hash == "" {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return objectPath(objectStoreDir(runDir), artifact.Hash, artifact.Compressed)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryHash(t *testing.T) {
+	hash, ok := binaryHash("abc123.perfgo.test.binary")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", hash)
+
+	_, ok = binaryHash("perf.pb.gz")
+	assert.False(t, ok)
+}
+
+func TestSaveArtifacts_DeduplicatesBinaries(t *testing.T) {
+	perfgoRoot := t.TempDir()
+	testBinary := filepath.Join(t.TempDir(), "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("identical test binary"), 0o755))
+
+	a := &App{logger: zerolog.Nop()}
+
+	var runDirs []string
+	var histories []*model.History
+	for _, run := range []string{"20250101-120000-aaaaaaaa-11111111", "20250101-130000-aaaaaaaa-22222222"} {
+		runDir := filepath.Join(perfgoRoot, "history", run)
+		require.NoError(t, os.MkdirAll(runDir, 0o755))
+
+		h := &model.History{}
+		require.NoError(t, a.saveArtifacts(runDir, h, testBinary))
+		require.Len(t, h.Artifacts, 1)
+		require.NotEmpty(t, h.Artifacts[0].Hash)
+
+		runDirs = append(runDirs, runDir)
+		histories = append(histories, h)
+	}
+
+	// Both runs reference the same single stored object
+	objects, err := os.ReadDir(filepath.Join(perfgoRoot, "objects"))
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, histories[0].Artifacts[0].Hash+".binary", objects[0].Name())
+	assert.Equal(t, histories[0].Artifacts[0], histories[1].Artifacts[0])
+
+	for i, runDir := range runDirs {
+		data, err := os.ReadFile(resolveArtifactPath(runDir, histories[i].Artifacts[0]))
+		require.NoError(t, err)
+		assert.Equal(t, "identical test binary", string(data))
+	}
+
+	// Runs whose link is gone still resolve through the store
+	artifact := histories[0].Artifacts[0]
+	require.NoError(t, os.Remove(filepath.Join(runDirs[0], artifact.File)))
+	resolved := resolveArtifactPath(runDirs[0], artifact)
+	assert.Equal(t, filepath.Join(perfgoRoot, "objects", artifact.Hash+".binary"), resolved)
+	data, err := os.ReadFile(resolved)
+	require.NoError(t, err)
+	assert.Equal(t, "identical test binary", string(data))
+}
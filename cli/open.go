@@ -0,0 +1,109 @@
+package cli
+
+// This file contains the open command, which serves the profile of a run in
+// the pprof web UI on a free port.
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+func (a *App) open(ctx *cli.Context) error {
+	arg, pprofArgs := parseViewArgs(ctx.Args().Slice())
+
+	entry, err := a.resolveEntry(arg)
+	if err != nil {
+		return err
+	}
+	return a.openEntry(os.Stdout, entry, pprofArgs)
+}
+
+// openEntry serves the profile of entry in the pprof web UI built into
+// perfgo and writes its URL to w.
+func (a *App) openEntry(w io.Writer, entry *history.Entry, pprofArgs []string) error {
+	artifact, err := findProfile(&entry.History)
+	if err != nil {
+		return err
+	}
+
+	profilePath, cleanup, err := a.pprofProfile(entry, artifact)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	pprofArgs = a.defaultSampleIndex(&entry.History, profilePath, pprofArgs)
+
+	addr, ok := pprofFlagValue(pprofArgs, "http")
+	if !ok {
+		addr, err = freeAddr()
+		if err != nil {
+			return err
+		}
+		pprofArgs = append([]string{"-http=" + addr}, pprofArgs...)
+	}
+
+	binary, err := mainBinary(profilePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Serving profile of run %s at %s\n", entry.History.ID[:8], pprofURL(addr))
+	return a.pprofServer()(serveArgs(pprofArgs, binary, profilePath))
+}
+
+// findProfile returns the pprof profile of a run.
+func findProfile(h *model.History) (*model.Artifact, error) {
+	for i := range h.Artifacts {
+		if h.Artifacts[i].Type == model.ArtifactTypePprofProfile {
+			return &h.Artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("run %s has no pprof profile, record one with perfgo test profile or perfgo attach profile", h.ID[:8])
+}
+
+// freeAddr returns a loopback address with a port that is free to listen on.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return fmt.Sprintf("localhost:%d", l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// pprofFlagValue returns the value of the pprof flag name given as -name=value
+// or -name value in args.
+func pprofFlagValue(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if flagName != name {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// pprofURL returns the URL of the pprof web UI listening on addr, which may
+// omit the host like pprof's -http=:8080.
+func pprofURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeAddr(t *testing.T) {
+	addr, err := freeAddr()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(addr, "localhost:"), addr)
+
+	// The port is released for pprof to listen on
+	l, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+}
+
+func TestPprofFlagValue(t *testing.T) {
+	value, ok := pprofFlagValue([]string{"-top", "-http=:8080"}, "http")
+	assert.True(t, ok)
+	assert.Equal(t, ":8080", value)
+
+	value, ok = pprofFlagValue([]string{"--http", "localhost:9090", "-no_browser"}, "http")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:9090", value)
+
+	_, ok = pprofFlagValue([]string{"-no_browser"}, "http")
+	assert.False(t, ok)
+}
+
+func TestPprofURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", pprofURL(":8080"))
+	assert.Equal(t, "http://localhost:41234", pprofURL("localhost:41234"))
+}
+
+func TestOpenEntry(t *testing.T) {
+	runDir := t.TempDir()
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}}}
+	profilePath := filepath.Join(runDir, "perf.pb.gz")
+	f, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	entry := &history.Entry{
+		FullPath: runDir,
+		History: model.History{
+			ID:        "0123456789abcdef",
+			Artifacts: []model.Artifact{{Type: model.ArtifactTypePprofProfile, File: "perf.pb.gz"}},
+		},
+	}
+
+	var got []string
+	a := &App{logger: zerolog.Nop(), servePprof: func(args []string) error {
+		got = args
+		return nil
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, a.openEntry(&out, entry, nil))
+	require.Len(t, got, 2)
+	addr, ok := strings.CutPrefix(got[0], "-http=localhost:")
+	require.True(t, ok, got[0])
+	assert.NotEqual(t, "0", addr)
+	assert.Equal(t, profilePath, got[1])
+	assert.Equal(t, "Serving profile of run 01234567 at http://localhost:"+addr+"\n", out.String())
+
+	// An explicit address is kept
+	out.Reset()
+	require.NoError(t, a.openEntry(&out, entry, []string{"-http=:8080", "-no_browser"}))
+	assert.Equal(t, []string{"-http=:8080", "-no_browser", profilePath}, got)
+	assert.Equal(t, "Serving profile of run 01234567 at http://localhost:8080\n", out.String())
+
+	// Runs without a profile can't be opened
+	entry.History.Artifacts = []model.Artifact{{Type: model.ArtifactTypePerfStat, File: "perf-stat.txt"}}
+	err = a.openEntry(&out, entry, nil)
+	require.EqualError(t, err, "run 01234567 has no pprof profile, record one with perfgo test profile or perfgo attach profile")
+}
@@ -0,0 +1,168 @@
+package cli
+
+// This file contains support for running the tests of several packages
+// matched by a single package pattern (e.g., ./...) in one test run.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gocmd "github.com/perfgo/perfgo/cli/go"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+)
+
+// packageRunner runs the test binary of pkg, whose directory relative to the
+// working directory is dir, and captures its output.
+type packageRunner func(pkg gocmd.Package, dir, binary string, stdout, stderr *string) error
+
+// resolveTestPackages expands the package pattern into the packages to test.
+// A pattern matching several packages only keeps the packages with tests.
+func (a *App) resolveTestPackages(pattern string) ([]gocmd.Package, error) {
+	packages, err := gocmd.ListPackages(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("package pattern %q matches no packages", pattern)
+	}
+	if len(packages) == 1 {
+		return packages, nil
+	}
+
+	withTests, skipped := selectTestPackages(packages)
+	for _, importPath := range skipped {
+		a.logger.Debug().Str("package", importPath).Msg("Skipping package without test files")
+	}
+	if len(withTests) == 0 {
+		return nil, fmt.Errorf("package pattern %q matches no packages with test files", pattern)
+	}
+
+	return withTests, nil
+}
+
+// selectTestPackages splits packages into the ones with test files and the
+// import paths of the ones without.
+func selectTestPackages(packages []gocmd.Package) (withTests []gocmd.Package, skipped []string) {
+	for _, pkg := range packages {
+		if pkg.HasTests {
+			withTests = append(withTests, pkg)
+		} else {
+			skipped = append(skipped, pkg.ImportPath)
+		}
+	}
+	return withTests, skipped
+}
+
+// packageBuildArgs returns the build args for a single package by replacing
+// the package pattern with the package's import path. Flag values equal to the
+// pattern (e.g., -coverpkg ./...) are kept.
+func packageBuildArgs(buildArgs []string, pattern, importPath string) []string {
+	args := make([]string, 0, len(buildArgs)+1)
+	for i := 0; i < len(buildArgs); i++ {
+		arg := buildArgs[i]
+		if _, separateValue := buildOnlyFlag(arg); separateValue && i+1 < len(buildArgs) {
+			i++
+			args = append(args, arg, buildArgs[i])
+			continue
+		}
+		if arg != pattern {
+			args = append(args, arg)
+		}
+	}
+	return append(args, importPath)
+}
+
+// packageDir returns the package directory relative to root, using forward
+// slashes so it can be used on the remote host.
+func packageDir(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "."
+	}
+	return filepath.ToSlash(rel)
+}
+
+// packageBinaryName returns a test binary name unique to the package.
+func packageBinaryName(importPath string) string {
+	return "perfgo." + strings.NewReplacer("/", "_", ".", "_").Replace(importPath)
+}
+
+// packageStatOptions returns the perf stat options used for every package in
+// stat mode and stores them in history. It returns nil for plain test runs.
+func packageStatOptions(perfMode string, opts perf.StatOptions, history *model.History) *perf.StatOptions {
+	if perfMode != "stat" {
+		return nil
+	}
+
+	history.Perf = &model.Perf{
+		Stat: &model.PerfStat{
+			Events:      opts.Events,
+			Detail:      opts.Detail,
+			PerfRepeat:  opts.Repeat,
+			Aggregation: opts.Mode(),
+		},
+	}
+	return &opts
+}
+
+// runTestPackages builds and runs the test binary of every package in turn,
+// recording the result of each package in history. The output of all
+// packages is collected into stdout and stderr. Test failures don't stop the
+// run, an error is returned after all packages ran if any of them failed.
+func (a *App) runTestPackages(packages []gocmd.Package, goos, goarch, pattern string, buildArgs []string, history *model.History, stdout, stderr *string, run packageRunner) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	failed := 0
+	for _, pkg := range packages {
+		binary, err := a.buildTestBinary(goos, goarch, packageBinaryName(pkg.ImportPath), packageBuildArgs(buildArgs, pattern, pkg.ImportPath))
+		if err != nil {
+			return fmt.Errorf("package %s: %w", pkg.ImportPath, err)
+		}
+		unregister := a.onInterrupt(func() { removeTestBinary(binary) })
+
+		dir := packageDir(cwd, pkg.Dir)
+		a.logger.Info().Str("package", pkg.ImportPath).Str("dir", dir).Msg("Running package tests")
+
+		start := time.Now()
+		var pkgStdout, pkgStderr string
+		runErr := run(pkg, dir, binary, &pkgStdout, &pkgStderr)
+		duration := time.Since(start)
+
+		if err := removeTestBinary(binary); err != nil {
+			a.logger.Debug().Err(err).Str("binary", binary).Msg("Failed to clean up test binary")
+		}
+		unregister()
+
+		result := model.PackageResult{
+			ImportPath: pkg.ImportPath,
+			Dir:        dir,
+			Duration:   duration,
+		}
+		status := "ok  "
+		if runErr != nil {
+			a.logger.Error().Err(runErr).Str("package", pkg.ImportPath).Msg("Package tests failed")
+			result.ExitCode = 1
+			status = "FAIL"
+			failed++
+		}
+		history.Test.Packages = append(history.Test.Packages, result)
+
+		// Summarize each package like go test does
+		summary := fmt.Sprintf("%s\t%s\t%.3fs\n", status, pkg.ImportPath, duration.Seconds())
+		fmt.Print(summary)
+		*stdout += pkgStdout + summary
+		*stderr += pkgStderr
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("tests failed in %d of %d packages", failed, len(packages))
+	}
+	return nil
+}
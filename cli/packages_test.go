@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"testing"
+
+	gocmd "github.com/perfgo/perfgo/cli/go"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTestPackages(t *testing.T) {
+	a := &App{logger: zerolog.Nop()}
+
+	// A single package is kept even without tests
+	packages, err := a.resolveTestPackages("../model")
+	require.NoError(t, err)
+	require.Len(t, packages, 1)
+	assert.Equal(t, "github.com/perfgo/perfgo/model", packages[0].ImportPath)
+
+	// Patterns expand into every package with tests
+	packages, err = a.resolveTestPackages("../examples/...")
+	require.NoError(t, err)
+	var importPaths []string
+	for _, pkg := range packages {
+		importPaths = append(importPaths, pkg.ImportPath)
+	}
+	assert.Equal(t, []string{
+		"github.com/perfgo/perfgo/examples/branch-prediction",
+		"github.com/perfgo/perfgo/examples/data-locality",
+		"github.com/perfgo/perfgo/examples/false-sharing",
+	}, importPaths)
+
+	_, err = a.resolveTestPackages("./does-not-exist")
+	require.Error(t, err)
+}
+
+func TestSelectTestPackages(t *testing.T) {
+	withTests, skipped := selectTestPackages([]gocmd.Package{
+		{ImportPath: "example.com/a", HasTests: true},
+		{ImportPath: "example.com/b"},
+		{ImportPath: "example.com/c", HasTests: true},
+	})
+	assert.Equal(t, []gocmd.Package{
+		{ImportPath: "example.com/a", HasTests: true},
+		{ImportPath: "example.com/c", HasTests: true},
+	}, withTests)
+	assert.Equal(t, []string{"example.com/b"}, skipped)
+}
+
+func TestPackageBuildArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildArgs []string
+		pattern   string
+		want      []string
+	}{
+		{
+			name:      "pattern replaced",
+			buildArgs: []string{"./...", "-tags", "integration"},
+			pattern:   "./...",
+			want:      []string{"-tags", "integration", "example.com/pkg"},
+		},
+		{
+			name:      "flag value equal to pattern kept",
+			buildArgs: []string{"./...", "-coverpkg", "./..."},
+			pattern:   "./...",
+			want:      []string{"-coverpkg", "./...", "example.com/pkg"},
+		},
+		{
+			name:      "pattern not in build args",
+			buildArgs: []string{"-race"},
+			pattern:   ".",
+			want:      []string{"-race", "example.com/pkg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, packageBuildArgs(tt.buildArgs, tt.pattern, "example.com/pkg"))
+		})
+	}
+}
+
+func TestPackageDir(t *testing.T) {
+	assert.Equal(t, ".", packageDir("/repo", "/repo"))
+	assert.Equal(t, "pkg/foo", packageDir("/repo", "/repo/pkg/foo"))
+}
+
+func TestPackageBinaryName(t *testing.T) {
+	assert.Equal(t, "perfgo.github_com_perfgo_perfgo_cli_go", packageBinaryName("github.com/perfgo/perfgo/cli/go"))
+	assert.NotEqual(t, packageBinaryName("example.com/a/go"), packageBinaryName("example.com/b/go"))
+}
+
+func TestPackageStatOptions(t *testing.T) {
+	h := &model.History{}
+	assert.Nil(t, packageStatOptions("", perf.StatOptions{}, h))
+	assert.Nil(t, h.Perf)
+
+	opts := packageStatOptions("stat", perf.StatOptions{
+		Events:          []string{"cycles"},
+		Detail:          true,
+		Repeat:          3,
+		StatAggregation: perf.StatAggregation{PerCore: true},
+	}, h)
+	require.NotNil(t, opts)
+	assert.Equal(t, []string{"cycles"}, opts.Events)
+	assert.True(t, opts.Detail)
+	assert.True(t, opts.PerCore)
+	assert.Equal(t, &model.PerfStat{Events: []string{"cycles"}, Detail: true, PerfRepeat: 3, Aggregation: "core"}, h.Perf.Stat)
+}
+
+func TestGetPackagePath(t *testing.T) {
+	a := &App{}
+	tests := []struct {
+		name      string
+		buildArgs []string
+		want      string
+	}{
+		{name: "no args", want: "."},
+		{name: "relative package", buildArgs: []string{"./pkg/foo"}, want: "pkg/foo"},
+		{name: "recursive pattern", buildArgs: []string{"./pkg/..."}, want: "pkg"},
+		{name: "all packages", buildArgs: []string{"./..."}, want: "."},
+		{name: "flags skipped", buildArgs: []string{"-race", "./cmd/api"}, want: "cmd/api"},
+		{name: "flag values skipped", buildArgs: []string{"-tags", "integration netgo", "-ldflags", "-X main.x=y", "./cmd/api"}, want: "cmd/api"},
+		{name: "attached flag value", buildArgs: []string{"-tags=integration", "./cmd/api"}, want: "cmd/api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, a.getPackagePath(tt.buildArgs))
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/cpu"
 	"github.com/perfgo/perfgo/cli/ssh"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
@@ -35,6 +36,26 @@ type C2CReportOptions struct {
 	ShowCPU   bool   // Show CPU information (--show-cpu-cnt)
 }
 
+// DefaultC2CEvent returns the perf c2c record event known to work on the given
+// architecture (GOARCH) and CPU vendor (cpu.VendorIntel, ...), or an empty string
+// to leave the choice to perf. The events are perf's memory event names as
+// listed by perf c2c record -e list: ldlat-loads,ldlat-stores on Intel,
+// mem-ldst (backed by IBS) on AMD and spe-ldst on arm64.
+func DefaultC2CEvent(arch, vendor string) string {
+	switch arch {
+	case "amd64", "386":
+		switch vendor {
+		case cpu.VendorIntel:
+			return "ldlat-loads,ldlat-stores"
+		case cpu.VendorAMD:
+			return "mem-ldst"
+		}
+	case "arm64":
+		return "spe-ldst"
+	}
+	return ""
+}
+
 // BuildC2CRecordArgs builds perf c2c record command arguments for local execution.
 func BuildC2CRecordArgs(opts C2COptions) []string {
 	args := []string{"c2c", "record"}
@@ -242,8 +263,10 @@ func ProcessC2CData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir
 	// Build the perf c2c report command for remote execution
 	perfReportCmd := BuildC2CReportCommand(reportOpts)
 
-	// Run perf c2c report remotely and stream output to file
-	if err := sshClient.Run(perfReportCmd, ssh.WithStdOut(reportFile)); err != nil {
+	// Run perf c2c report remotely and stream output to file, within --command-timeout
+	cmdCtx, cancel := sshClient.CommandContext()
+	defer cancel()
+	if err := sshClient.RunContext(cmdCtx, perfReportCmd, ssh.WithStdOut(reportFile)); err != nil {
 		return "", fmt.Errorf("failed to run perf c2c report remotely: %w", err)
 	}
 
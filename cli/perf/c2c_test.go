@@ -0,0 +1,42 @@
+package perf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultC2CEvent(t *testing.T) {
+	tests := []struct {
+		arch   string
+		vendor string
+		want   string
+	}{
+		{"amd64", "intel", "ldlat-loads,ldlat-stores"},
+		{"amd64", "amd", "mem-ldst"},
+		{"386", "intel", "ldlat-loads,ldlat-stores"},
+		{"amd64", "unknown", ""},
+		{"arm64", "", "spe-ldst"},
+		{"arm64", "arm", "spe-ldst"},
+		{"riscv64", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch+"/"+tt.vendor, func(t *testing.T) {
+			assert.Equal(t, tt.want, DefaultC2CEvent(tt.arch, tt.vendor))
+		})
+	}
+}
+
+func TestBuildC2CRecordArgs_DefaultEvent(t *testing.T) {
+	args := BuildC2CRecordArgs(C2COptions{
+		Event:  DefaultC2CEvent("amd64", "intel"),
+		Binary: "./perfgo.test",
+	})
+	assert.Equal(t, []string{
+		"c2c", "record",
+		"-e", "ldlat-loads,ldlat-stores",
+		"-o", "perf.data",
+		"--", "./perfgo.test",
+	}, args)
+}
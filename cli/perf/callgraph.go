@@ -0,0 +1,99 @@
+package perf
+
+// callgraph.go contains the automatic selection of the call graph mode: a
+// short probe recorded with frame pointers shows whether the binary keeps
+// them, otherwise stacks are unwound with LBR or DWARF instead.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/urfave/cli/v2"
+
+	"github.com/perfgo/perfgo/cli/cpu"
+	"github.com/perfgo/perfgo/perfscript"
+)
+
+// Call graph modes of perf record --call-graph.
+const (
+	CallGraphFP    = "fp"
+	CallGraphDWARF = "dwarf"
+	CallGraphLBR   = "lbr"
+)
+
+// ShallowStackDepth is the median stack depth up to which frame pointer
+// unwinding is considered broken. Go functions are at least called from the
+// runtime and a test function, so working stacks are deeper.
+const ShallowStackDepth = 2
+
+// CallGraphProbeDuration is how long the probe samples the workload.
+const CallGraphProbeDuration = 2 * time.Second
+
+// CallGraphAutoFlag returns the flag enabling the call graph probe.
+func CallGraphAutoFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "call-graph-auto",
+		Usage: "Record a short probe first and unwind with lbr or dwarf instead of frame pointers if its stacks are shallow",
+	}
+}
+
+// ProbeRecordOptions returns the options of the probe recording of opts to
+// outputPath, which samples the workload for CallGraphProbeDuration with
+// frame pointers before interrupting it.
+func ProbeRecordOptions(opts RecordOptions, outputPath string) RecordOptions {
+	probe := opts
+	probe.CallGraph = CallGraphFP
+	probe.OutputPath = outputPath
+	probe.MaxDuration = 0
+	probe.ControlFD = 0
+	probe.Args = append([]string{"-s", "INT", fmt.Sprintf("%gs", CallGraphProbeDuration.Seconds()), opts.Binary}, opts.Args...)
+	probe.Binary = "timeout"
+	return probe
+}
+
+// ParseScript parses perf script output into a profile.
+func ParseScript(scriptOutput string) (*profile.Profile, error) {
+	prof, err := perfscript.New().Parse(strings.NewReader(scriptOutput))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse perf script: %w", err)
+	}
+	return prof, nil
+}
+
+// MedianStackDepth returns the median number of frames of the samples in
+// prof, or 0 if it has no samples.
+func MedianStackDepth(prof *profile.Profile) int {
+	if len(prof.Sample) == 0 {
+		return 0
+	}
+
+	depths := make([]int, 0, len(prof.Sample))
+	for _, sample := range prof.Sample {
+		depth := 0
+		for _, loc := range sample.Location {
+			// Inlined functions share a location
+			depth += max(1, len(loc.Line))
+		}
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	return depths[len(depths)/2]
+}
+
+// ChooseCallGraph returns the call graph mode to record with, given the
+// profile of a probe recorded with frame pointers. Frame pointers are kept
+// unless the probe's stacks are shallow. LBR is preferred as fallback on
+// Intel CPUs, as DWARF unwinding copies the user stack with every sample,
+// unless the LBR is already used for branch stacks.
+func ChooseCallGraph(probe *profile.Profile, vendor string, branchStack bool) string {
+	if len(probe.Sample) == 0 || MedianStackDepth(probe) > ShallowStackDepth {
+		return CallGraphFP
+	}
+	if vendor == cpu.VendorIntel && !branchStack {
+		return CallGraphLBR
+	}
+	return CallGraphDWARF
+}
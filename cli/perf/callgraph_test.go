@@ -0,0 +1,82 @@
+package perf
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/perfgo/perfgo/cli/cpu"
+)
+
+// stackProfile returns a profile with one sample per given stack depth.
+func stackProfile(depths ...int) *profile.Profile {
+	prof := &profile.Profile{}
+	for _, depth := range depths {
+		sample := &profile.Sample{Value: []int64{1}}
+		for i := 0; i < depth; i++ {
+			sample.Location = append(sample.Location, &profile.Location{
+				ID:   uint64(i + 1),
+				Line: []profile.Line{{Function: &profile.Function{Name: "f"}}},
+			})
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+func TestMedianStackDepth(t *testing.T) {
+	assert.Equal(t, 0, MedianStackDepth(stackProfile()))
+	assert.Equal(t, 1, MedianStackDepth(stackProfile(1, 1, 12)))
+	assert.Equal(t, 8, MedianStackDepth(stackProfile(1, 8, 12)))
+
+	// Inlined functions count as frames
+	prof := stackProfile(1)
+	prof.Sample[0].Location[0].Line = append(prof.Sample[0].Location[0].Line, profile.Line{}, profile.Line{})
+	assert.Equal(t, 3, MedianStackDepth(prof))
+}
+
+func TestChooseCallGraph(t *testing.T) {
+	tests := []struct {
+		name        string
+		probe       *profile.Profile
+		vendor      string
+		branchStack bool
+		want        string
+	}{
+		{name: "deep stacks", probe: stackProfile(9, 12, 15, 1), vendor: cpu.VendorIntel, want: CallGraphFP},
+		{name: "no samples", probe: stackProfile(), vendor: cpu.VendorIntel, want: CallGraphFP},
+		{name: "shallow on intel", probe: stackProfile(1, 2, 1, 12), vendor: cpu.VendorIntel, want: CallGraphLBR},
+		{name: "shallow on amd", probe: stackProfile(1, 2, 1), vendor: cpu.VendorAMD, want: CallGraphDWARF},
+		{name: "shallow on arm", probe: stackProfile(1), vendor: cpu.VendorARM, want: CallGraphDWARF},
+		{name: "shallow with branch stacks", probe: stackProfile(2, 2), vendor: cpu.VendorIntel, branchStack: true, want: CallGraphDWARF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ChooseCallGraph(tt.probe, tt.vendor, tt.branchStack))
+		})
+	}
+}
+
+func TestProbeRecordOptions(t *testing.T) {
+	opts := RecordOptions{
+		Event:      "cycles",
+		OutputPath: "perf.data",
+		ControlFD:  3,
+		CallGraph:  CallGraphDWARF,
+		Binary:     "./perfgo.test",
+		Args:       []string{"-test.bench=."},
+	}
+
+	assert.Equal(t, []string{
+		"record", "-g", "--call-graph", "fp",
+		"-e", "cycles",
+		"-o", "/tmp/probe.data",
+		"--", "timeout", "-s", "INT", "2s", "./perfgo.test", "-test.bench=.",
+	}, BuildRecordArgs(ProbeRecordOptions(opts, "/tmp/probe.data")))
+
+	// The options of the actual recording are unchanged
+	assert.Equal(t, []string{"-test.bench=."}, opts.Args)
+	assert.Equal(t, "./perfgo.test", opts.Binary)
+}
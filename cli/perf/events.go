@@ -0,0 +1,324 @@
+package perf
+
+// events.go contains parsing of perf list output and validation of
+// requested events against it, so typos are caught before a test is built.
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxEventSuggestions is the maximum number of close matches suggested for
+// an unknown event.
+const maxEventSuggestions = 5
+
+// rawEventRe matches raw hardware event descriptors (e.g., r412e, r0040).
+var rawEventRe = regexp.MustCompile(`^r[0-9a-fA-F]+$`)
+
+// eventModifierRe matches the modifiers perf accepts after an event, e.g. the
+// u of cycles:u or the ppp of instructions:ppp.
+var eventModifierRe = regexp.MustCompile(`^[ukhIGHpPSDWeb]+$`)
+
+// tracepointRe matches a tracepoint, e.g. sched:sched_switch.
+var tracepointRe = regexp.MustCompile(`^\w+:\w+$`)
+
+// eventTypeRe matches the event type perf list prints at the end of an
+// event line, e.g. [Hardware event].
+var eventTypeRe = regexp.MustCompile(`\[([^\[\]]+)\]$`)
+
+// EventCategory groups the events of perf list by their type.
+type EventCategory string
+
+// Event categories, in the order perf list prints them
+const (
+	EventCategoryHardware   EventCategory = "hardware"
+	EventCategorySoftware   EventCategory = "software"
+	EventCategoryCache      EventCategory = "cache"
+	EventCategoryRaw        EventCategory = "raw"
+	EventCategoryTracepoint EventCategory = "tracepoint"
+	EventCategoryPMU        EventCategory = "pmu"
+	EventCategoryOther      EventCategory = "other"
+)
+
+// EventCategories lists the event categories in display order.
+var EventCategories = []EventCategory{
+	EventCategoryHardware,
+	EventCategorySoftware,
+	EventCategoryCache,
+	EventCategoryRaw,
+	EventCategoryTracepoint,
+	EventCategoryPMU,
+	EventCategoryOther,
+}
+
+// eventCategory returns the category of the event type printed by perf list.
+func eventCategory(eventType string) EventCategory {
+	switch eventType {
+	case "Hardware event":
+		return EventCategoryHardware
+	case "Software event":
+		return EventCategorySoftware
+	case "Hardware cache event":
+		return EventCategoryCache
+	case "Raw hardware event descriptor":
+		return EventCategoryRaw
+	case "Tracepoint event":
+		return EventCategoryTracepoint
+	case "Kernel PMU event":
+		return EventCategoryPMU
+	default:
+		return EventCategoryOther
+	}
+}
+
+// EventList is the set of events reported by perf list.
+type EventList struct {
+	names      map[string]struct{}
+	categories map[EventCategory][]string
+}
+
+// ParseEventList parses the output of perf list. Each event line is indented
+// by two spaces and lists the event name and its aliases separated by "OR",
+// followed by the event type in brackets. Descriptions, which are indented
+// further, and section headers are skipped.
+func ParseEventList(output string) *EventList {
+	list := &EventList{
+		names:      make(map[string]struct{}),
+		categories: make(map[EventCategory][]string),
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Event lines are indented by exactly two spaces
+		if !strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "   ") {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		category := EventCategoryOther
+		if m := eventTypeRe.FindStringSubmatch(line); m != nil {
+			category = eventCategory(m[1])
+		}
+
+		// Strip the event type, e.g. "[Hardware event]"
+		if idx := strings.Index(line, "["); idx > 0 {
+			line = line[:idx]
+		}
+
+		for _, alias := range strings.Split(line, " OR ") {
+			fields := strings.Fields(alias)
+			if len(fields) == 0 {
+				continue
+			}
+			if _, ok := list.names[fields[0]]; ok {
+				continue
+			}
+			list.names[fields[0]] = struct{}{}
+			list.categories[category] = append(list.categories[category], fields[0])
+		}
+	}
+
+	for _, names := range list.categories {
+		sort.Strings(names)
+	}
+	return list
+}
+
+// Category returns the sorted names of the listed events of category.
+func (l *EventList) Category(category EventCategory) []string {
+	return l.categories[category]
+}
+
+// Listed reports whether perf list printed event. Unlike Has, events with
+// PMU terms or modifiers are only listed if perf list printed them verbatim.
+func (l *EventList) Listed(event string) bool {
+	_, ok := l.names[event]
+	return ok
+}
+
+// Len returns the number of known events.
+func (l *EventList) Len() int {
+	return len(l.names)
+}
+
+// Has reports whether event is available. Modifiers (e.g., cycles:u), raw
+// events (r412e), breakpoints and PMU events with terms (cpu/event=0x3c/)
+// are accepted as long as their base event is known or cannot be checked.
+// Tracepoints (sched:sched_switch) are missing from perf list for users who
+// can't read tracefs, so unlisted ones are accepted as well.
+func (l *EventList) Has(event string) bool {
+	if _, ok := l.names[event]; ok {
+		return true
+	}
+
+	// PMU terms and breakpoints are not listed by perf list
+	if strings.Contains(event, "/") || strings.HasPrefix(event, "mem:") {
+		return true
+	}
+
+	// Strip modifiers, listed tracepoints (sched:sched_switch) matched above
+	base := event
+	if idx := strings.LastIndex(base, ":"); idx > 0 && eventModifierRe.MatchString(base[idx+1:]) {
+		base = base[:idx]
+		if _, ok := l.names[base]; ok {
+			return true
+		}
+	}
+
+	// Tracepoints perf list didn't print can't be checked
+	if tracepointRe.MatchString(base) {
+		return true
+	}
+
+	return rawEventRe.MatchString(base)
+}
+
+// Suggest returns up to maxEventSuggestions known events close to event.
+func (l *EventList) Suggest(event string) []string {
+	if idx := strings.LastIndex(event, ":"); idx > 0 {
+		event = event[:idx]
+	}
+	event = strings.ToLower(event)
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+
+	maxDistance := max(2, len(event)/4)
+	for name := range l.names {
+		lower := strings.ToLower(name)
+		distance := levenshtein(event, lower)
+		if distance > maxDistance && !strings.Contains(lower, event) {
+			continue
+		}
+		candidates = append(candidates, candidate{name: name, distance: distance})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	suggestions := make([]string, 0, maxEventSuggestions)
+	for i := 0; i < len(candidates) && i < maxEventSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// Validate returns an error naming every unavailable event together with
+// close matches. Each element of events may be a comma separated list as
+// accepted by perf -e, including event groups ({cycles,instructions}).
+func (l *EventList) Validate(events []string) error {
+	var unknown []string
+	for _, spec := range events {
+		for _, event := range SplitEvents(spec) {
+			if l.Has(event) {
+				continue
+			}
+
+			msg := fmt.Sprintf("%q", event)
+			if suggestions := l.Suggest(event); len(suggestions) > 0 {
+				msg += fmt.Sprintf(" (did you mean: %s?)", strings.Join(suggestions, ", "))
+			}
+			unknown = append(unknown, msg)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unknown perf event %s, see perf list for available events", strings.Join(unknown, ", "))
+}
+
+// SplitEvents splits a perf -e argument into single events. Commas inside
+// PMU terms (cpu/event=0x3c,umask=0x0/) do not split, group braces and group
+// modifiers are removed.
+func SplitEvents(spec string) []string {
+	var events []string
+	var current strings.Builder
+	inTerms := false
+
+	flush := func() {
+		event := strings.Trim(current.String(), "{} ")
+		// Drop group modifiers, e.g. {cycles,instructions}:S
+		if idx := strings.Index(event, "}"); idx >= 0 {
+			event = event[:idx]
+		}
+		if event != "" {
+			events = append(events, event)
+		}
+		current.Reset()
+	}
+
+	for _, r := range spec {
+		switch {
+		case r == '/':
+			inTerms = !inTerms
+		case r == ',' && !inTerms:
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+
+	return events
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// RecommendedEvent is an event perfgo suggests for one of its analyses.
+type RecommendedEvent struct {
+	Name  string // Event name as printed by perf list
+	Usage string // Analysis the event is used for
+}
+
+// RecommendedEvents are the events shown by perfgo events. The memory
+// sampling events back the c2c and mem modes, which need one of them.
+var RecommendedEvents = []RecommendedEvent{
+	{Name: "cycles", Usage: "CPU time, where test profile spends its samples"},
+	{Name: "instructions", Usage: "Instructions per cycle (IPC) together with cycles"},
+	{Name: "cache-references", Usage: "Last level cache accesses"},
+	{Name: "cache-misses", Usage: "Last level cache misses of memory bound code"},
+	{Name: "branch-misses", Usage: "Mispredicted branches"},
+	{Name: "L1-dcache-load-misses", Usage: "Level 1 data cache misses, see examples/data-locality"},
+	{Name: "mem-loads", Usage: "Load latency sampling of test c2c and test mem on Intel"},
+	{Name: "mem-stores", Usage: "Store sampling of test c2c and test mem on Intel"},
+	{Name: "ibs_op//", Usage: "Instruction based sampling of test c2c and test mem on AMD"},
+	{Name: "arm_spe_0//", Usage: "Statistical profiling extension of test c2c and test mem on arm64"},
+}
@@ -0,0 +1,144 @@
+package perf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePerfList = `
+List of pre-defined events (to be used in -e or -M):
+
+  branch-instructions OR branches                    [Hardware event]
+  branch-misses                                      [Hardware event]
+  cache-misses                                       [Hardware event]
+  cache-references                                   [Hardware event]
+  cpu-cycles OR cycles                               [Hardware event]
+  instructions                                       [Hardware event]
+  alignment-faults                                   [Software event]
+  context-switches OR cs                             [Software event]
+  cpu-clock                                          [Software event]
+  task-clock                                         [Software event]
+  L1-dcache-load-misses                              [Hardware cache event]
+  L1-dcache-loads                                    [Hardware cache event]
+  LLC-load-misses                                    [Hardware cache event]
+  cpu/cache-misses/                                  [Kernel PMU event]
+  mem-loads OR cpu/mem-loads/                        [Kernel PMU event]
+  rNNN                                               [Raw hardware event descriptor]
+  cpu/t1=v1[,t2=v2,t3 ...]/modifier                  [Raw hardware event descriptor]
+  mem:<addr>[/len][:access]                          [Hardware breakpoint]
+  sched:sched_switch                                 [Tracepoint event]
+
+cache:
+  l1d.replacement
+       [Counts the number of cache lines replaced in L1 data cache. Unit:
+        cpu_core]
+  longest_lat_cache.miss
+       [Core-originated cacheable requests that missed L3 (Except hardware
+        prefetches to the L3). Unit: cpu_core]
+`
+
+func TestParseEventList(t *testing.T) {
+	list := ParseEventList(samplePerfList)
+
+	for _, event := range []string{
+		"branches", "branch-instructions", "cycles", "cpu-cycles", "cs",
+		"task-clock", "L1-dcache-loads", "cpu/cache-misses/", "mem-loads",
+		"sched:sched_switch", "l1d.replacement", "longest_lat_cache.miss",
+	} {
+		assert.True(t, list.Has(event), event)
+	}
+
+	// Description lines are not events
+	assert.False(t, list.Has("cpu_core]"))
+	assert.False(t, list.Has("prefetches"))
+	assert.False(t, list.Has("cache:"))
+}
+
+func TestEventList_Category(t *testing.T) {
+	list := ParseEventList(samplePerfList)
+
+	assert.Equal(t, []string{
+		"branch-instructions", "branch-misses", "branches", "cache-misses",
+		"cache-references", "cpu-cycles", "cycles", "instructions",
+	}, list.Category(EventCategoryHardware))
+	assert.Equal(t, []string{"alignment-faults", "context-switches", "cpu-clock", "cs", "task-clock"}, list.Category(EventCategorySoftware))
+	assert.Equal(t, []string{"L1-dcache-load-misses", "L1-dcache-loads", "LLC-load-misses"}, list.Category(EventCategoryCache))
+	assert.Equal(t, []string{"cpu/t1=v1", "rNNN"}, list.Category(EventCategoryRaw))
+	assert.Equal(t, []string{"sched:sched_switch"}, list.Category(EventCategoryTracepoint))
+	assert.Equal(t, []string{"cpu/cache-misses/", "cpu/mem-loads/", "mem-loads"}, list.Category(EventCategoryPMU))
+	assert.Equal(t, []string{"l1d.replacement", "longest_lat_cache.miss", "mem:<addr>"}, list.Category(EventCategoryOther))
+
+	assert.True(t, list.Listed("mem-loads"))
+	assert.False(t, list.Listed("mem-stores"))
+	assert.False(t, list.Listed("cycles:u"))
+	assert.False(t, list.Listed("ibs_op//"))
+}
+
+func TestEventList_Has(t *testing.T) {
+	list := ParseEventList(samplePerfList)
+
+	tests := []struct {
+		event string
+		want  bool
+	}{
+		{"cycles", true},
+		{"cycles:u", true},
+		{"instructions:ppp", true},
+		{"r412e", true},
+		{"r0040:u", true},
+		{"cpu/event=0x3c,umask=0x0/", true},
+		{"mem:0x1000:rw", true},
+		{"cyclez", false},
+		{"cyclez:u", false},
+		{"rxyz", false},
+		// Unlisted tracepoints, e.g. for users who can't read tracefs
+		{"syscalls:sys_enter_openat", true},
+		{"syscalls:sys_enter_openat:k", true},
+		{"sched:sched_switch:u", true},
+		{"L1-dcache-stores", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			assert.Equal(t, tt.want, list.Has(tt.event))
+		})
+	}
+}
+
+func TestEventList_Validate(t *testing.T) {
+	list := ParseEventList(samplePerfList)
+
+	require.NoError(t, list.Validate([]string{"cycles,instructions", "{cache-misses,cache-references}:S"}))
+	require.NoError(t, list.Validate([]string{"cpu/event=0x3c,umask=0x0/,branch-misses"}))
+
+	err := list.Validate([]string{"cyclez"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"cyclez"`)
+	assert.Contains(t, err.Error(), "did you mean: cycles")
+
+	err = list.Validate([]string{"instructions,L1-dcache-laods"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"L1-dcache-laods" (did you mean: L1-dcache-loads`)
+	assert.NotContains(t, err.Error(), `"instructions"`)
+}
+
+func TestSplitEvents(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"cycles", []string{"cycles"}},
+		{"cycles,instructions", []string{"cycles", "instructions"}},
+		{"{cycles,instructions}:S", []string{"cycles", "instructions"}},
+		{"cpu/event=0x3c,umask=0x0/,cycles:u", []string{"cpu/event=0x3c,umask=0x0/", "cycles:u"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			assert.Equal(t, tt.want, SplitEvents(tt.spec))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package perf
+
+// folded.go contains the conversion of profiles to the folded stack format
+// read by flamegraph tools (e.g., flamegraph.pl, inferno, speedscope).
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/urfave/cli/v2"
+)
+
+// FoldedFile is the name of the folded stacks artifact in the run directory.
+const FoldedFile = "perf.folded"
+
+// FoldedFlag returns the flag enabling the folded stacks artifact.
+func FoldedFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "folded",
+		Usage: "Also write the profile as folded stacks (perf.folded) for flamegraph tools",
+	}
+}
+
+// FoldStacks returns the samples of prof in the folded stack format: one
+// line per distinct stack, listing the frames from the root to the leaf
+// separated by semicolons, followed by the summed value at valueIndex.
+// Stacks without value are omitted, lines are sorted by stack.
+func FoldStacks(prof *profile.Profile, valueIndex int) []string {
+	counts := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		if valueIndex >= len(sample.Value) || sample.Value[valueIndex] == 0 {
+			continue
+		}
+		counts[foldStack(sample)] += sample.Value[valueIndex]
+	}
+
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	lines := make([]string, 0, len(stacks))
+	for _, stack := range stacks {
+		lines = append(lines, fmt.Sprintf("%s %d", stack, counts[stack]))
+	}
+	return lines
+}
+
+// foldStack returns the frames of sample from the root to the leaf joined by
+// semicolons. Locations are ordered leaf first, as are the inlined functions
+// of a location.
+func foldStack(sample *profile.Sample) string {
+	var frames []string
+	for i := len(sample.Location) - 1; i >= 0; i-- {
+		loc := sample.Location[i]
+		if len(loc.Line) == 0 {
+			frames = append(frames, fmt.Sprintf("0x%x", loc.Address))
+			continue
+		}
+		for j := len(loc.Line) - 1; j >= 0; j-- {
+			frames = append(frames, frameName(loc, loc.Line[j]))
+		}
+	}
+	return strings.Join(frames, ";")
+}
+
+// frameName returns the name of a frame, which must not contain the frame
+// separator of the folded format.
+func frameName(loc *profile.Location, line profile.Line) string {
+	if line.Function == nil || line.Function.Name == "" {
+		return fmt.Sprintf("0x%x", loc.Address)
+	}
+	return strings.ReplaceAll(line.Function.Name, ";", ":")
+}
+
+// WriteFolded writes the folded stacks of the first sample type of prof to w.
+func WriteFolded(w io.Writer, prof *profile.Profile) error {
+	for _, line := range FoldStacks(prof, 0) {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
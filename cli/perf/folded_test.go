@@ -0,0 +1,65 @@
+package perf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldStacks(t *testing.T) {
+	fn := func(name string) *profile.Function { return &profile.Function{Name: name} }
+	loc := func(id uint64, names ...string) *profile.Location {
+		l := &profile.Location{ID: id, Address: 0x1000 + id}
+		for _, name := range names {
+			l.Line = append(l.Line, profile.Line{Function: fn(name)})
+		}
+		return l
+	}
+
+	main := loc(1, "main.main")
+	work := loc(2, "main.work")
+	// main.sum is inlined into main.hash
+	hash := loc(3, "main.sum", "main.hash")
+	unknown := loc(4)
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles"}, {Type: "instructions"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{work, main}, Value: []int64{5, 50}},
+			{Location: []*profile.Location{hash, work, main}, Value: []int64{3, 30}},
+			{Location: []*profile.Location{unknown, main}, Value: []int64{1, 0}},
+			// Same stack as the first sample, e.g. from another thread
+			{Location: []*profile.Location{work, main}, Value: []int64{2, 20}},
+			{Location: []*profile.Location{main}, Value: []int64{0, 10}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"main.main;0x1004 1",
+		"main.main;main.work 7",
+		"main.main;main.work;main.hash;main.sum 3",
+	}, FoldStacks(prof, 0))
+
+	assert.Equal(t, []string{
+		"main.main 10",
+		"main.main;main.work 70",
+		"main.main;main.work;main.hash;main.sum 30",
+	}, FoldStacks(prof, 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFolded(&buf, prof))
+	assert.Equal(t, "main.main;0x1004 1\nmain.main;main.work 7\nmain.main;main.work;main.hash;main.sum 3\n", buf.String())
+}
+
+func TestFoldStacks_EscapesSeparator(t *testing.T) {
+	prof := &profile.Profile{
+		Sample: []*profile.Sample{{
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "operator new(a;b)"}}}}},
+			Value:    []int64{1},
+		}},
+	}
+	assert.Equal(t, []string{"operator new(a:b) 1"}, FoldStacks(prof, 0))
+}
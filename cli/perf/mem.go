@@ -0,0 +1,289 @@
+package perf
+
+// mem.go contains utilities for building perf mem commands and
+// processing mem reports to analyze memory access latency.
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// Memory operation types that can be sampled by perf mem record.
+const (
+	MemTypeLoad  = "load"
+	MemTypeStore = "store"
+)
+
+// memDefaultEvents maps the memory operation types to the events recorded
+// when no event is specified.
+var memDefaultEvents = map[string]string{
+	MemTypeLoad:  "ldlat-loads",
+	MemTypeStore: "ldlat-stores",
+}
+
+// MemOptions contains options for perf mem record command.
+type MemOptions struct {
+	Type        string   // Memory operation type: "load", "store" or "" for both
+	Event       string   // Event to record (derived from Type if empty)
+	LoadLatency int      // Minimum load latency in cycles to sample (--ldlat)
+	PIDs        []string // Process IDs to attach to
+	Duration    int      // Duration in seconds (used with sleep)
+	OutputPath  string   // Output file path (default: perf.data)
+	Binary      string   // Binary to execute (mutually exclusive with PIDs)
+	Args        []string // Arguments for the binary
+}
+
+// MemReportOptions contains options for perf mem report command.
+type MemReportOptions struct {
+	InputPath string // Input perf.data file path
+	Mode      string // Report mode: "stdio" (text) or "tui" (interactive)
+	Sort      string // Sort keys (e.g., "mem,sym,dso")
+}
+
+// ValidateMemType returns an error if typ is not a memory operation type
+// supported by perf mem record. An empty type samples both loads and stores.
+func ValidateMemType(typ string) error {
+	switch typ {
+	case "", MemTypeLoad, MemTypeStore:
+		return nil
+	default:
+		return fmt.Errorf("invalid mem type %q: must be %s or %s", typ, MemTypeLoad, MemTypeStore)
+	}
+}
+
+// memEvents returns the events to record for the given options.
+func memEvents(opts MemOptions) []string {
+	if opts.Event != "" {
+		return []string{opts.Event}
+	}
+
+	switch opts.Type {
+	case MemTypeLoad, MemTypeStore:
+		return []string{memDefaultEvents[opts.Type]}
+	default:
+		return []string{memDefaultEvents[MemTypeLoad], memDefaultEvents[MemTypeStore]}
+	}
+}
+
+// BuildMemRecordArgs builds perf mem record command arguments for local execution.
+func BuildMemRecordArgs(opts MemOptions) []string {
+	args := []string{"mem", "record"}
+
+	// Add events, one -e per event
+	for _, event := range memEvents(opts) {
+		args = append(args, "-e", event)
+	}
+
+	// Add load latency threshold
+	if opts.LoadLatency > 0 {
+		args = append(args, "--ldlat", fmt.Sprintf("%d", opts.LoadLatency))
+	}
+
+	// Add output path
+	outputPath := opts.OutputPath
+	if outputPath == "" {
+		outputPath = "perf.data"
+	}
+	args = append(args, "-o", outputPath)
+
+	// Add PIDs or binary execution
+	if len(opts.PIDs) > 0 {
+		pidList := strings.Join(opts.PIDs, ",")
+		args = append(args, "-p", pidList)
+
+		// When attaching to PIDs, use sleep for duration
+		args = append(args, "sleep", fmt.Sprintf("%d", opts.Duration))
+	} else if opts.Binary != "" {
+		args = append(args, "--", opts.Binary)
+		args = append(args, opts.Args...)
+	}
+
+	return args
+}
+
+// BuildMemRecordCommand builds perf mem record command string for remote execution.
+// It reuses BuildMemRecordArgs and joins the arguments with proper shell escaping.
+func BuildMemRecordCommand(opts MemOptions) string {
+	args := BuildMemRecordArgs(opts)
+
+	// Build command with proper shell escaping
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, "perf")
+
+	for _, arg := range args {
+		parts = append(parts, shellescape.Quote(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// BuildMemReportArgs builds perf mem report command arguments for local execution.
+func BuildMemReportArgs(opts MemReportOptions) []string {
+	args := []string{"mem", "report"}
+
+	// Add input path
+	if opts.InputPath != "" {
+		args = append(args, "-i", opts.InputPath)
+	}
+
+	// Add report mode - default to stdio for text output
+	if opts.Mode == "" || opts.Mode == "stdio" {
+		args = append(args, "--stdio")
+	}
+	// Note: tui mode doesn't need a flag, it's the default interactive mode
+
+	// Add sort keys
+	if opts.Sort != "" {
+		args = append(args, "--sort", opts.Sort)
+	}
+
+	return args
+}
+
+// BuildMemReportCommand builds perf mem report command string for remote execution.
+func BuildMemReportCommand(opts MemReportOptions) string {
+	args := BuildMemReportArgs(opts)
+
+	// Build command with proper shell escaping
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, "perf")
+
+	for _, arg := range args {
+		parts = append(parts, shellescape.Quote(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// MemTypeFlag returns the memory operation type flag for perf mem record.
+func MemTypeFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "mem-type",
+		Usage: "Memory operations to sample: load, store or both if not specified",
+	}
+}
+
+// MemEventFlag returns the event flag for perf mem record.
+func MemEventFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "mem-event",
+		Usage: "Event to record for mem analysis (ldlat-loads/ldlat-stores if not specified)",
+	}
+}
+
+// MemLoadLatencyFlag returns the load latency threshold flag for perf mem record.
+func MemLoadLatencyFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "ldlat",
+		Usage: "Only sample loads with a latency of at least N cycles",
+	}
+}
+
+// MemSortFlag returns the sort flag for perf mem report.
+func MemSortFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "mem-sort",
+		Usage: "Sort keys for the mem report (e.g., mem,sym,dso)",
+	}
+}
+
+// ConvertPerfMemToReport converts a local perf.data file to a mem report.
+// The report is saved to mem-report.txt in the runDir.
+// Returns the artifact filename (relative to runDir).
+func ConvertPerfMemToReport(logger zerolog.Logger, perfDataPath string, runDir string, reportOpts MemReportOptions, historyID string) (string, error) {
+	logger.Info().Str("input", perfDataPath).Msg("Generating mem report locally")
+
+	// Set the input path
+	reportOpts.InputPath = perfDataPath
+
+	// Create output file for the report
+	reportFilename := "mem-report.txt"
+	reportPath := fmt.Sprintf("%s/%s", runDir, reportFilename)
+	reportFile, err := os.Create(reportPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer reportFile.Close()
+
+	// Build the perf mem report command
+	args := BuildMemReportArgs(reportOpts)
+
+	// Run perf mem report locally and write to file
+	cmd := exec.Command("perf", args...)
+	cmd.Stdout = reportFile
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run perf mem report: %w", err)
+	}
+
+	// Get file size for logging
+	fileInfo, _ := reportFile.Stat()
+	logger.Info().
+		Int64("size_bytes", fileInfo.Size()).
+		Str("report", reportPath).
+		Msg("Mem report generated successfully")
+
+	shortID := historyID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	logger.Info().Msgf("View report with: perfgo view %s", shortID)
+
+	return reportFilename, nil
+}
+
+// ProcessMemData processes perf mem data from a remote host and creates a report.
+// The report is saved to mem-report.txt in the runDir.
+// Returns the artifact filename (relative to runDir).
+func ProcessMemData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir string, runDir string, reportOpts MemReportOptions, historyID string) (string, error) {
+	remotePerfData := fmt.Sprintf("%s/perf.data", remoteBaseDir)
+
+	logger.Info().
+		Str("remote", remotePerfData).
+		Msg("Generating mem report on remote host")
+
+	// Create output file for the report
+	reportFilename := "mem-report.txt"
+	reportPath := fmt.Sprintf("%s/%s", runDir, reportFilename)
+	reportFile, err := os.Create(reportPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer reportFile.Close()
+
+	// Set the remote input path
+	reportOpts.InputPath = remotePerfData
+
+	// Build the perf mem report command for remote execution
+	perfReportCmd := BuildMemReportCommand(reportOpts)
+
+	// Run perf mem report remotely and stream output to file, within --command-timeout
+	cmdCtx, cancel := sshClient.CommandContext()
+	defer cancel()
+	if err := sshClient.RunContext(cmdCtx, perfReportCmd, ssh.WithStdOut(reportFile)); err != nil {
+		return "", fmt.Errorf("failed to run perf mem report remotely: %w", err)
+	}
+
+	// Get file size for logging
+	fileInfo, _ := reportFile.Stat()
+	logger.Info().
+		Int64("size_bytes", fileInfo.Size()).
+		Str("report", reportPath).
+		Msg("Mem report generated successfully")
+
+	shortID := historyID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	logger.Info().Msgf("View report with: perfgo view %s", shortID)
+
+	return reportFilename, nil
+}
@@ -0,0 +1,104 @@
+package perf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMemRecordArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts MemOptions
+		want []string
+	}{
+		{
+			name: "default loads and stores",
+			opts: MemOptions{Binary: "./perfgo.test", Args: []string{"-test.bench=."}},
+			want: []string{
+				"mem", "record",
+				"-e", "ldlat-loads", "-e", "ldlat-stores",
+				"-o", "perf.data",
+				"--", "./perfgo.test", "-test.bench=.",
+			},
+		},
+		{
+			name: "loads only with latency threshold",
+			opts: MemOptions{Type: MemTypeLoad, LoadLatency: 50, OutputPath: "/tmp/perf.data", Binary: "./perfgo.test"},
+			want: []string{
+				"mem", "record",
+				"-e", "ldlat-loads",
+				"--ldlat", "50",
+				"-o", "/tmp/perf.data",
+				"--", "./perfgo.test",
+			},
+		},
+		{
+			name: "stores only",
+			opts: MemOptions{Type: MemTypeStore, Binary: "./perfgo.test"},
+			want: []string{"mem", "record", "-e", "ldlat-stores", "-o", "perf.data", "--", "./perfgo.test"},
+		},
+		{
+			name: "explicit event wins over type",
+			opts: MemOptions{Type: MemTypeLoad, Event: "spe-load", Binary: "./perfgo.test"},
+			want: []string{"mem", "record", "-e", "spe-load", "-o", "perf.data", "--", "./perfgo.test"},
+		},
+		{
+			name: "attach to PIDs",
+			opts: MemOptions{PIDs: []string{"1", "2"}, Duration: 10},
+			want: []string{
+				"mem", "record",
+				"-e", "ldlat-loads", "-e", "ldlat-stores",
+				"-o", "perf.data",
+				"-p", "1,2", "sleep", "10",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildMemRecordArgs(tt.opts))
+		})
+	}
+}
+
+func TestBuildMemRecordCommand(t *testing.T) {
+	cmd := BuildMemRecordCommand(MemOptions{
+		Type:   MemTypeLoad,
+		Binary: "/tmp/my dir/perfgo.test",
+	})
+	assert.Equal(t, "perf mem record -e ldlat-loads -o perf.data -- '/tmp/my dir/perfgo.test'", cmd)
+}
+
+func TestBuildMemReportArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts MemReportOptions
+		want []string
+	}{
+		{
+			name: "defaults to stdio",
+			opts: MemReportOptions{InputPath: "perf.data"},
+			want: []string{"mem", "report", "-i", "perf.data", "--stdio"},
+		},
+		{
+			name: "tui with sort",
+			opts: MemReportOptions{Mode: "tui", Sort: "mem,sym"},
+			want: []string{"mem", "report", "--sort", "mem,sym"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildMemReportArgs(tt.opts))
+		})
+	}
+	assert.Equal(t, "perf mem report -i /tmp/perf.data --stdio", BuildMemReportCommand(MemReportOptions{InputPath: "/tmp/perf.data"}))
+}
+
+func TestValidateMemType(t *testing.T) {
+	assert.NoError(t, ValidateMemType(""))
+	assert.NoError(t, ValidateMemType(MemTypeLoad))
+	assert.NoError(t, ValidateMemType(MemTypeStore))
+	assert.Error(t, ValidateMemType("loads"))
+}
@@ -0,0 +1,213 @@
+package perf
+
+// output.go contains the formats a profile can be written in besides pprof:
+// a text summary of the top functions, folded stacks and JSON.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+	"github.com/urfave/cli/v2"
+)
+
+// OutputFormat is a format profiles are written in.
+type OutputFormat string
+
+const (
+	// OutputPprof is the gzipped pprof protobuf (perf.pb.gz), always written
+	OutputPprof OutputFormat = "pprof"
+	// OutputText is a summary of the flat and cumulative counts per function
+	OutputText OutputFormat = "text"
+	// OutputFolded are the folded stacks read by flamegraph tools
+	OutputFolded OutputFormat = "folded"
+	// OutputJSON are the flat and cumulative counts per function as JSON
+	OutputJSON OutputFormat = "json"
+)
+
+// OutputFormats are the supported output formats.
+var OutputFormats = []OutputFormat{OutputPprof, OutputText, OutputFolded, OutputJSON}
+
+// OutputFormatFlag returns the flag selecting the format the profile is
+// written in alongside the pprof profile.
+func OutputFormatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "output",
+		Usage: "Also write the profile as text (perf.txt), folded (perf.folded) or json (perf.json), pprof writes perf.pb.gz only",
+		Value: string(OutputPprof),
+	}
+}
+
+// ParseOutputFormat returns the output format named s.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	for _, format := range OutputFormats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --output %q, expected one of pprof, text, folded or json", s)
+}
+
+// File returns the name of the artifact of the format in the run directory.
+func (f OutputFormat) File() string {
+	switch f {
+	case OutputText:
+		return "perf.txt"
+	case OutputFolded:
+		return FoldedFile
+	case OutputJSON:
+		return "perf.json"
+	default:
+		return "perf.pb.gz"
+	}
+}
+
+// WriteOutput writes prof to w in the format f.
+func WriteOutput(w io.Writer, prof *profile.Profile, f OutputFormat) error {
+	switch f {
+	case OutputPprof:
+		return prof.Write(w)
+	case OutputText:
+		return WriteText(w, prof)
+	case OutputFolded:
+		return WriteFolded(w, prof)
+	case OutputJSON:
+		return WriteJSON(w, prof)
+	default:
+		return fmt.Errorf("unknown output format %q", f)
+	}
+}
+
+// FunctionTotal is the flat and cumulative value of a function in a profile.
+type FunctionTotal struct {
+	Name string `json:"name"`
+	// Value of the samples with the function as leaf
+	Flat int64 `json:"flat"`
+	// Value of the samples with the function anywhere in their stack
+	Cum int64 `json:"cum"`
+}
+
+// FunctionTotals returns the totals of each function at valueIndex, sorted by
+// flat value, then cumulative value and name, like pprof -top.
+func FunctionTotals(prof *profile.Profile, valueIndex int) []FunctionTotal {
+	totals := make(map[string]*FunctionTotal)
+	total := func(name string) *FunctionTotal {
+		t, ok := totals[name]
+		if !ok {
+			t = &FunctionTotal{Name: name}
+			totals[name] = t
+		}
+		return t
+	}
+
+	for _, sample := range prof.Sample {
+		if valueIndex >= len(sample.Value) || sample.Value[valueIndex] == 0 || len(sample.Location) == 0 {
+			continue
+		}
+		value := sample.Value[valueIndex]
+
+		// The leaf is the innermost inlined function of the first location
+		leaf := sample.Location[0]
+		if len(leaf.Line) == 0 {
+			total(fmt.Sprintf("0x%x", leaf.Address)).Flat += value
+		} else {
+			total(frameName(leaf, leaf.Line[0])).Flat += value
+		}
+
+		// Recursive functions count once per sample
+		seen := make(map[string]bool)
+		for _, loc := range sample.Location {
+			names := []string{fmt.Sprintf("0x%x", loc.Address)}
+			if len(loc.Line) > 0 {
+				names = names[:0]
+				for _, line := range loc.Line {
+					names = append(names, frameName(loc, line))
+				}
+			}
+			for _, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					total(name).Cum += value
+				}
+			}
+		}
+	}
+
+	result := make([]FunctionTotal, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Flat != result[j].Flat {
+			return result[i].Flat > result[j].Flat
+		}
+		if result[i].Cum != result[j].Cum {
+			return result[i].Cum > result[j].Cum
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// sampleTotal returns the summed value at valueIndex of all samples.
+func sampleTotal(prof *profile.Profile, valueIndex int) int64 {
+	var total int64
+	for _, sample := range prof.Sample {
+		if valueIndex < len(sample.Value) {
+			total += sample.Value[valueIndex]
+		}
+	}
+	return total
+}
+
+// WriteText writes the function totals of the first sample type of prof to
+// w in the layout of pprof -top.
+func WriteText(w io.Writer, prof *profile.Profile) error {
+	if len(prof.SampleType) > 0 {
+		fmt.Fprintf(w, "Type: %s\n", prof.SampleType[0].Type)
+	}
+	total := sampleTotal(prof, 0)
+	percent := func(v int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(v) / float64(total) * 100
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "flat\tflat%%\tsum%%\tcum\tcum%%\t\n")
+	var sum int64
+	for _, t := range FunctionTotals(prof, 0) {
+		sum += t.Flat
+		fmt.Fprintf(tw, "%d\t%.2f%%\t%.2f%%\t%d\t%.2f%%\t %s\n",
+			t.Flat, percent(t.Flat), percent(sum), t.Cum, percent(t.Cum), t.Name)
+	}
+	return tw.Flush()
+}
+
+// jsonProfile is the JSON output of a profile.
+type jsonProfile struct {
+	SampleType string          `json:"sample_type"`
+	Unit       string          `json:"unit"`
+	Total      int64           `json:"total"`
+	Functions  []FunctionTotal `json:"functions"`
+}
+
+// WriteJSON writes the function totals of the first sample type of prof to
+// w as JSON.
+func WriteJSON(w io.Writer, prof *profile.Profile) error {
+	out := jsonProfile{
+		Total:     sampleTotal(prof, 0),
+		Functions: FunctionTotals(prof, 0),
+	}
+	if len(prof.SampleType) > 0 {
+		out.SampleType = prof.SampleType[0].Type
+		out.Unit = prof.SampleType[0].Unit
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,117 @@
+package perf
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outputProfile returns a small profile of main.main calling main.work,
+// which calls the recursive main.walk.
+func outputProfile() *profile.Profile {
+	mapping := &profile.Mapping{ID: 1, File: "/path/to/binary"}
+	fns := map[string]*profile.Function{}
+	var locs []*profile.Location
+	loc := func(name string) *profile.Location {
+		fn := &profile.Function{ID: uint64(len(fns) + 1), Name: name}
+		fns[name] = fn
+		l := &profile.Location{ID: uint64(len(locs) + 1), Mapping: mapping, Address: 0x1000 * uint64(len(locs)+1), Line: []profile.Line{{Function: fn}}}
+		locs = append(locs, l)
+		return l
+	}
+	main, work, walk := loc("main.main"), loc("main.work"), loc("main.walk")
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{work, main}, Value: []int64{6}},
+			{Location: []*profile.Location{walk, walk, work, main}, Value: []int64{3}},
+			{Location: []*profile.Location{main}, Value: []int64{1}},
+		},
+		Mapping:  []*profile.Mapping{mapping},
+		Location: locs,
+	}
+	for _, fn := range fns {
+		prof.Function = append(prof.Function, fn)
+	}
+	return prof
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, format := range OutputFormats {
+		parsed, err := ParseOutputFormat(string(format))
+		require.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+	_, err := ParseOutputFormat("svg")
+	require.EqualError(t, err, `invalid --output "svg", expected one of pprof, text, folded or json`)
+
+	assert.Equal(t, "perf.pb.gz", OutputPprof.File())
+	assert.Equal(t, "perf.txt", OutputText.File())
+	assert.Equal(t, "perf.folded", OutputFolded.File())
+	assert.Equal(t, "perf.json", OutputJSON.File())
+}
+
+func TestFunctionTotals(t *testing.T) {
+	// Recursive functions count once per sample in the cumulative value
+	assert.Equal(t, []FunctionTotal{
+		{Name: "main.work", Flat: 6, Cum: 9},
+		{Name: "main.walk", Flat: 3, Cum: 3},
+		{Name: "main.main", Flat: 1, Cum: 10},
+	}, FunctionTotals(outputProfile(), 0))
+}
+
+func TestWriteOutput(t *testing.T) {
+	prof := outputProfile()
+
+	t.Run("pprof", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteOutput(&buf, prof, OutputPprof))
+		parsed, err := profile.Parse(&buf)
+		require.NoError(t, err)
+		assert.Len(t, parsed.Sample, 3)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteOutput(&buf, prof, OutputText))
+		assert.Equal(t, ""+
+			"Type: cycles\n"+
+			" flat  flat%    sum% cum    cum%\n"+
+			"    6 60.00%  60.00%   9  90.00% main.work\n"+
+			"    3 30.00%  90.00%   3  30.00% main.walk\n"+
+			"    1 10.00% 100.00%  10 100.00% main.main\n",
+			buf.String())
+	})
+
+	t.Run("folded", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteOutput(&buf, prof, OutputFolded))
+		assert.Equal(t, ""+
+			"main.main 1\n"+
+			"main.main;main.work 6\n"+
+			"main.main;main.work;main.walk;main.walk 3\n",
+			buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteOutput(&buf, prof, OutputJSON))
+		var out struct {
+			SampleType string          `json:"sample_type"`
+			Unit       string          `json:"unit"`
+			Total      int64           `json:"total"`
+			Functions  []FunctionTotal `json:"functions"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		assert.Equal(t, "cycles", out.SampleType)
+		assert.Equal(t, "count", out.Unit)
+		assert.Equal(t, int64(10), out.Total)
+		require.Len(t, out.Functions, 3)
+		assert.Equal(t, FunctionTotal{Name: "main.work", Flat: 6, Cum: 9}, out.Functions[0])
+	})
+}
@@ -0,0 +1,64 @@
+package perf
+
+// permission.go contains the detection of perf failures caused by
+// kernel.perf_event_paranoid or missing capabilities, which perf only
+// reports on stderr before exiting with an opaque exit code.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPermission is returned when perf is not permitted to open events.
+var ErrPermission = errors.New("perf is not permitted to access performance events")
+
+// permissionMarkers are messages perf prints when perf_event_open fails
+// because of perf_event_paranoid or missing capabilities.
+var permissionMarkers = []string{
+	"perf_event_paranoid",
+	"Access to performance monitoring and observability operations is limited",
+	"You may not have permission to collect",
+	"No permission to enable",
+}
+
+// IsPermissionFailure reports whether perf's stderr shows that it was not
+// permitted to open the requested events.
+func IsPermissionFailure(stderr string) bool {
+	for _, marker := range permissionMarkers {
+		if strings.Contains(stderr, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPermission returns an error wrapping ErrPermission that explains how
+// to allow perf to sample if stderr shows a permission failure, nil
+// otherwise. host names the remote host perf ran on, or is empty for the
+// local machine.
+func CheckPermission(stderr, host string) error {
+	if !IsPermissionFailure(stderr) {
+		return nil
+	}
+
+	where := "on this machine"
+	if host != "" {
+		where = "on " + host
+	}
+	return fmt.Errorf("%w %s: lower the restriction with 'sudo sysctl kernel.perf_event_paranoid=1' "+
+		"(add it to /etc/sysctl.d to persist) or grant perf CAP_PERFMON with "+
+		"'sudo setcap cap_perfmon,cap_sys_ptrace+ep $(command -v perf)', then check the setup with 'perfgo doctor'",
+		ErrPermission, where)
+}
+
+// CommandError returns the error to report for a perf command that failed
+// with err. perf exits with the same generic code whether the workload or
+// perf itself failed, so a permission failure shown on stderr is reported
+// through CheckPermission in place of err.
+func CommandError(err error, stderr, host string) error {
+	if permErr := CheckPermission(stderr, host); permErr != nil {
+		return permErr
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package perf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		stderr  string
+		host    string
+		wantErr string
+	}{
+		{
+			name: "paranoid",
+			stderr: `Error:
+Access to performance monitoring and observability operations is limited.
+Consider adjusting /proc/sys/kernel/perf_event_paranoid setting to open
+access to performance monitoring and observability operations for processes
+without CAP_PERFMON, CAP_SYS_PTRACE or CAP_SYS_ADMIN Linux capability.
+More information can be found at 'Perf events and tool security' document:
+https://www.kernel.org/doc/html/latest/admin-guide/perf-security.html
+perf_event_paranoid setting is 4:
+`,
+			wantErr: "perf is not permitted to access performance events on this machine",
+		},
+		{
+			name: "older perf",
+			stderr: `Error:
+You may not have permission to collect stats.
+
+Consider tweaking /proc/sys/kernel/perf_event_paranoid,
+which controls use of the performance events system by
+unprivileged users (without CAP_SYS_ADMIN).
+`,
+			host:    "user@remote",
+			wantErr: "perf is not permitted to access performance events on user@remote",
+		},
+		{
+			name:    "event not permitted",
+			stderr:  "Error:\nNo permission to enable cycles event.\n",
+			wantErr: "perf is not permitted to access performance events on this machine",
+		},
+		{
+			name:   "test failure",
+			stderr: "--- FAIL: TestFoo (0.00s)\n    foo_test.go:12: open /etc/shadow: permission denied\nFAIL\n",
+		},
+		{
+			name:   "unknown event",
+			stderr: "event syntax error: 'cyles'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPermission(tt.stderr, tt.host)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrPermission)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Contains(t, err.Error(), "kernel.perf_event_paranoid=1")
+			assert.Contains(t, err.Error(), "cap_perfmon")
+		})
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	runErr := errors.New("exit status 255")
+
+	err := CommandError(runErr, "Error:\nNo permission to enable cycles event.\n", "user@remote")
+	require.ErrorIs(t, err, ErrPermission)
+	assert.Contains(t, err.Error(), "on user@remote")
+
+	err = CommandError(runErr, "--- FAIL: TestFoo (0.00s)\nFAIL\n", "")
+	assert.Same(t, runErr, err)
+}
@@ -5,21 +5,26 @@ package perf
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"encoding/base32"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/progress"
 	"github.com/perfgo/perfgo/cli/ssh"
 	"github.com/perfgo/perfgo/perfscript"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 // RecordOptions contains options for perf record command.
@@ -31,15 +36,43 @@ type RecordOptions struct {
 	OutputPath string   // Output file path (default: perf.data)
 	Binary     string   // Binary to execute (mutually exclusive with PIDs)
 	Args       []string // Arguments for the binary
+	SystemWide bool     // Profile all CPUs (-a) for Duration, ignoring PIDs and Binary
+
+	// Cgroup to profile system-wide (perf record -a -G), relative to the root
+	// of the cgroup filesystem. Unlike PIDs it includes processes started
+	// while profiling, takes precedence over PIDs
+	CgroupPath string
+
+	MaxDuration time.Duration // Stop sampling after this long, letting the binary run to completion
+	ControlFD   int           // File descriptor perf reads control commands from (perf record --control), 0 disables
+
+	BranchStack  bool   // Record the last branch records (perf record -b)
+	BranchFilter string // Branch types to record, e.g. "any_call,u" (perf record -j), implies BranchStack
+
+	CallGraph string // Call graph mode (fp, dwarf or lbr), default fp
+}
+
+// HasBranchStack reports whether branch stacks are recorded.
+func (opts RecordOptions) HasBranchStack() bool {
+	return opts.BranchStack || opts.BranchFilter != ""
 }
 
 // BuildRecordArgs builds perf record command arguments for local execution.
 func BuildRecordArgs(opts RecordOptions) []string {
-	args := []string{"record", "-g", "--call-graph", "fp"}
+	callGraph := opts.CallGraph
+	if callGraph == "" {
+		callGraph = CallGraphFP
+	}
+	args := []string{"record", "-g", "--call-graph", callGraph}
 
-	// Add event
-	if opts.Event != "" {
-		args = append(args, "-e", opts.Event)
+	// Add event, perf requires the events before the cgroups they are
+	// restricted to and records cycles by default
+	event := opts.Event
+	if event == "" && opts.CgroupPath != "" {
+		event = "cycles"
+	}
+	if event != "" {
+		args = append(args, "-e", event)
 
 		// Add count (event period) - only if event is specified
 		if opts.Count > 0 {
@@ -47,6 +80,13 @@ func BuildRecordArgs(opts RecordOptions) []string {
 		}
 	}
 
+	// Add branch stack sampling
+	if opts.BranchFilter != "" {
+		args = append(args, "-j", opts.BranchFilter)
+	} else if opts.BranchStack {
+		args = append(args, "-b")
+	}
+
 	// Add output path
 	outputPath := opts.OutputPath
 	if outputPath == "" {
@@ -54,8 +94,23 @@ func BuildRecordArgs(opts RecordOptions) []string {
 	}
 	args = append(args, "-o", outputPath)
 
-	// Add PIDs or binary execution
-	if len(opts.PIDs) > 0 {
+	// Add control file descriptor, used to stop sampling without stopping the workload
+	if opts.ControlFD > 0 {
+		args = append(args, "--control", fmt.Sprintf("fd:%d", opts.ControlFD))
+	}
+
+	// Add cgroup, all CPUs, PIDs or binary execution
+	if opts.CgroupPath != "" {
+		// Each event is restricted to the cgroup at the same position
+		cgroups := make([]string, len(SplitEvents(event)))
+		for i := range cgroups {
+			cgroups[i] = opts.CgroupPath
+		}
+		args = append(args, "-a", "-G", strings.Join(cgroups, ","))
+		args = append(args, "sleep", fmt.Sprintf("%d", opts.Duration))
+	} else if opts.SystemWide {
+		args = append(args, "-a", "sleep", fmt.Sprintf("%d", opts.Duration))
+	} else if len(opts.PIDs) > 0 {
 		pidList := strings.Join(opts.PIDs, ",")
 		args = append(args, "-p", pidList)
 
@@ -94,6 +149,30 @@ func ProfileEventFlag() cli.Flag {
 	}
 }
 
+// BranchStackFlag returns the flag enabling branch stack (LBR) sampling.
+func BranchStackFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "branch-stack",
+		Usage: "Sample the last branch records (perf record -b), requires LBR or equivalent hardware support",
+	}
+}
+
+// BranchFilterFlag returns the flag selecting the branch types to sample.
+func BranchFilterFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "branch-filter",
+		Usage: "Branch types to sample, e.g. any_call,u (perf record -j), implies --branch-stack",
+	}
+}
+
+// CgroupFlag returns the flag profiling the cgroup of a pod instead of its PIDs.
+func CgroupFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "cgroup",
+		Usage: "Profile the cgroup of the pod's containers system-wide (perf record -G) instead of their PIDs, including processes started while profiling",
+	}
+}
+
 // ProfileCountFlag returns the count flag for perf record (event period).
 func ProfileCountFlag() cli.Flag {
 	return &cli.IntFlag{
@@ -103,11 +182,97 @@ func ProfileCountFlag() cli.Flag {
 	}
 }
 
+// DefaultCopyConcurrency is the default number of binaries copied from the
+// remote host at once. sshd allows 10 sessions per connection by default
+// (MaxSessions), which the control master shares with other commands.
+const DefaultCopyConcurrency = 4
+
+// systemLibDirs are the directories holding system libraries, which are not
+// copied from the remote host unless requested.
+var systemLibDirs = []string{"/usr", "/lib", "/lib32", "/lib64", "/opt"}
+
+// CopyOptions controls which binaries referenced by a remote profile are
+// copied back and how.
+type CopyOptions struct {
+	Concurrency       int  // Binaries copied at once
+	IncludeSystemLibs bool // Also copy binaries in system library directories
+}
+
+// isSystemLib reports whether path lies in a system library directory.
+func isSystemLib(path string) bool {
+	for _, dir := range systemLibDirs {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeSystemLibsFlag returns the flag to copy system libraries back as well.
+func IncludeSystemLibsFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "include-system-libs",
+		Usage: "Also copy binaries under /usr, /lib and /opt from the remote host (skipped by default)",
+	}
+}
+
+// CopyConcurrencyFlag returns the flag limiting how many binaries referenced
+// by a profile are copied from the remote host at once.
+func CopyConcurrencyFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "copy-concurrency",
+		Usage: "Number of binaries copied from the remote host in parallel",
+		Value: DefaultCopyConcurrency,
+	}
+}
+
+// MaxDurationFlag returns the flag bounding how long perf record samples.
+func MaxDurationFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "max-duration",
+		Usage: "Stop sampling after this long while the test runs to completion (local only, requires perf >= 5.10)",
+	}
+}
+
+// BuildScriptArgs builds the perf script arguments for converting perfDataPath.
+// Branch stacks are only printed when requested, as perf script rejects the
+// field for data recorded without them. mmap events are printed for the
+// build-ids of the mapped binaries.
+func BuildScriptArgs(perfDataPath string, branchStack bool) []string {
+	args := []string{"script", "-i", perfDataPath, "--show-mmap-events"}
+	if branchStack {
+		args = append(args, "-F", "+brstacksym")
+	}
+	return args
+}
+
+// BuildIDListArgs builds the perf buildid-list arguments listing the GNU
+// build-ids stored in perfDataPath.
+func BuildIDListArgs(perfDataPath string) []string {
+	return []string{"buildid-list", "-i", perfDataPath}
+}
+
+// parseBuildIDs parses the perf buildid-list output. Build-ids only improve
+// matching binaries, so failures are logged and yield none.
+func parseBuildIDs(logger zerolog.Logger, output string, err error) map[string]string {
+	if err != nil {
+		logger.Debug().Err(err).Msg("Failed to list build-ids, matching binaries by name")
+		return nil
+	}
+	buildIDs, err := perfscript.ParseBuildIDList(strings.NewReader(output))
+	if err != nil {
+		logger.Debug().Err(err).Msg("Failed to parse build-ids, matching binaries by name")
+		return nil
+	}
+	logger.Debug().Int("count", len(buildIDs)).Msg("Read build-ids of profiled binaries")
+	return buildIDs
+}
+
 // ConvertPerfToPprof converts a local perf.data file to pprof format.
 // The perf script output is written to a temporary file that is deleted after processing.
 // Returns a list of binaries that were copied for artifact registration.
 // Binaries are stored as <base32-sha256>.<basename>.binary in runDir.
-func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath string, runDir string, historyID string) ([]BinaryArtifact, error) {
+func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath string, runDir string, historyID string, branchStack bool) ([]BinaryArtifact, error) {
 	logger.Info().Str("input", perfDataPath).Str("output", outputPath).Msg("Processing performance data locally")
 
 	// Create temporary file for perf script output
@@ -123,7 +288,7 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 	}()
 
 	// Run perf script locally and write to temp file
-	cmd := exec.Command("perf", "script", "-i", perfDataPath)
+	cmd := exec.Command("perf", BuildScriptArgs(perfDataPath, branchStack)...)
 	cmd.Stdout = tempFile
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("failed to run perf script: %w", err)
@@ -136,6 +301,9 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 		Str("temp_file", tempPath).
 		Msg("Performance script output written to temporary file")
 
+	buildIDList, err := exec.Command("perf", BuildIDListArgs(perfDataPath)...).Output()
+	buildIDs := parseBuildIDs(logger, string(buildIDList), err)
+
 	// Seek back to beginning for reading
 	if _, err := tempFile.Seek(0, 0); err != nil {
 		return nil, fmt.Errorf("failed to seek temporary file: %w", err)
@@ -174,45 +342,23 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 				continue
 			}
 
-			// Hash the local binary
-			hash, size, err := hashLocalBinary(binaryPath)
+			artifact, err := archiveLocalBinary(binaryPath, runDir)
 			if err != nil {
 				logger.Warn().
 					Err(err).
 					Str("path", binaryPath).
-					Msg("Failed to hash binary")
+					Msg("Failed to archive binary")
 				continue
 			}
+			artifact.BuildID = buildIDs[binaryPath]
 
-			// Construct filename with hash and original basename
-			basename := filepath.Base(binaryPath)
-			binaryFilename := hash + "." + basename + ".binary"
-			destPath := filepath.Join(runDir, binaryFilename)
-
-			// Copy binary to destination
-			if err := copyLocalBinary(binaryPath, destPath); err != nil {
-				logger.Warn().
-					Err(err).
-					Str("src", binaryPath).
-					Str("dest", destPath).
-					Msg("Failed to copy binary")
-				continue
-			}
-
-			localBinaries[binaryPath] = destPath
-
-			// Collect artifact information
-			binaryArtifacts = append(binaryArtifacts, BinaryArtifact{
-				RemotePath: binaryPath,
-				LocalPath:  binaryFilename,
-				Size:       size,
-				Hash:       hash,
-			})
+			localBinaries[binaryPath] = filepath.Join(runDir, artifact.LocalPath)
+			binaryArtifacts = append(binaryArtifacts, artifact)
 
 			logger.Debug().
 				Str("original", binaryPath).
-				Str("hash", hash).
-				Str("dest", binaryFilename).
+				Str("hash", artifact.Hash).
+				Str("dest", artifact.LocalPath).
 				Msg("Copied binary")
 		}
 
@@ -221,11 +367,40 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 			Msg("Binaries processed successfully")
 	}
 
+	// Parse the perf script output and write the profile
+	if err := writeProfile(logger, scriptOutput, buildIDs, localBinaries, outputPath, len(binaryArtifacts), historyID); err != nil {
+		if errors.Is(err, ErrNoSamples) {
+			return binaryArtifacts, err
+		}
+		return nil, err
+	}
+
+	return binaryArtifacts, nil
+}
+
+// ErrNoSamples is returned alongside a successfully written, but empty,
+// profile. Callers should treat it as a warning rather than a failure.
+var ErrNoSamples = errors.New("profile contains no samples")
+
+// writeProfile parses the perf script output into a pprof profile, points its
+// mappings to the archived binaries and writes it to outputPath. Mappings
+// carry the build-ids of buildIDs, by path. It returns
+// ErrNoSamples if perf collected no samples, e.g. as the workload finished
+// before the first sample was taken.
+func writeProfile(logger zerolog.Logger, scriptOutput string, buildIDs, localBinaries map[string]string, outputPath string, binaries int, historyID string) error {
 	// Parse and create the profile
-	parser := perfscript.New()
+	parser := perfscript.New(perfscript.WithBuildIDs(buildIDs), perfscript.WithThreadLabels(true))
 	prof, err := parser.Parse(strings.NewReader(scriptOutput))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse perf script: %w", err)
+		return fmt.Errorf("failed to parse perf script: %w", err)
+	}
+
+	if stats := parser.Stats(); stats.SkippedLines > 0 || stats.UnparseableFrames > 0 || stats.InvalidCounts > 0 {
+		logger.Debug().
+			Int("skipped_lines", stats.SkippedLines).
+			Int("unparseable_frames", stats.UnparseableFrames).
+			Int("invalid_counts", stats.InvalidCounts).
+			Msg("Parts of the perf script output could not be parsed")
 	}
 
 	// Update binary paths in the profile to point to local copies
@@ -238,17 +413,25 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 	// Write profile to file
 	f, err := os.Create(outputPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create profile file: %w", err)
+		return fmt.Errorf("failed to create profile file: %w", err)
 	}
 	defer f.Close()
 
 	if err := prof.Write(f); err != nil {
-		return nil, fmt.Errorf("failed to write profile: %w", err)
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	if len(prof.Sample) == 0 {
+		logger.Warn().
+			Str("profile", outputPath).
+			Msg("Profile contains no samples, the workload likely finished before perf collected any. " +
+				"Run it for longer, e.g. with -count=N, -benchtime=10s or a larger input, or sample more often with a lower --count")
+		return ErrNoSamples
 	}
 
 	logger.Info().
 		Str("profile", outputPath).
-		Int("binaries", len(binaryArtifacts)).
+		Int("binaries", binaries).
 		Int("samples", len(prof.Sample)).
 		Int("functions", len(prof.Function)).
 		Int("locations", len(prof.Location)).
@@ -260,7 +443,7 @@ func ConvertPerfToPprof(logger zerolog.Logger, perfDataPath string, outputPath s
 	}
 	logger.Info().Msgf("View profile with: perfgo view %s", shortID)
 
-	return binaryArtifacts, nil
+	return nil
 }
 
 // hashLocalBinary calculates the SHA256 hash of a local binary file.
@@ -292,20 +475,91 @@ func copyLocalBinary(src, dest string) error {
 	return nil
 }
 
+// archiveLocalBinary copies a local binary to runDir as
+// <hash>.<basename>.binary and returns its artifact.
+func archiveLocalBinary(binaryPath, runDir string) (BinaryArtifact, error) {
+	hash, size, err := hashLocalBinary(binaryPath)
+	if err != nil {
+		return BinaryArtifact{}, err
+	}
+
+	// Construct filename with hash and original basename
+	binaryFilename := hash + "." + filepath.Base(binaryPath) + ".binary"
+	if err := copyLocalBinary(binaryPath, filepath.Join(runDir, binaryFilename)); err != nil {
+		return BinaryArtifact{}, err
+	}
+
+	return BinaryArtifact{
+		RemotePath: binaryPath,
+		LocalPath:  binaryFilename,
+		Size:       size,
+		Hash:       hash,
+	}, nil
+}
+
+// skipSystemLibs splits binaryPaths into the binaries to copy and the system
+// libraries to skip. Binaries in the shared path are never skipped, as they
+// are read locally.
+func skipSystemLibs(binaryPaths []string, isShared func(string) bool) (keep, skipped []string) {
+	for _, path := range binaryPaths {
+		if isSystemLib(path) && !isShared(path) {
+			skipped = append(skipped, path)
+		} else {
+			keep = append(keep, path)
+		}
+	}
+	return keep, skipped
+}
+
+// binarySource identifies where a binary referenced by a remote profile is
+// read from.
+type binarySource int
+
+const (
+	// binarySourceNone skips the binary, e.g. [kernel.kallsyms]
+	binarySourceNone binarySource = iota
+	// binarySourceShared reads the binary directly from the shared path
+	binarySourceShared
+	// binarySourceProc copies the binary through /proc/<pid>/root
+	binarySourceProc
+)
+
+// selectBinarySource picks how the binary at remotePath is archived. Binaries
+// in the shared path are read locally, others are copied from the remote host
+// when the profiled PIDs are known.
+func selectBinarySource(remotePath string, shared, hasPIDs bool) binarySource {
+	switch {
+	case strings.HasPrefix(remotePath, "["):
+		return binarySourceNone
+	case shared:
+		return binarySourceShared
+	case hasPIDs:
+		return binarySourceProc
+	default:
+		return binarySourceNone
+	}
+}
+
 // BinaryArtifact represents a binary that was copied for the profile.
 type BinaryArtifact struct {
 	RemotePath string // Original path on remote
 	LocalPath  string // Filename in history directory (e.g., "ABC123...XYZ.binary")
 	Size       uint64 // File size in bytes
 	Hash       string // Base32-encoded SHA256 hash
+	BuildID    string // GNU build-id recorded by perf, if any
 }
 
 // ProcessPerfData processes perf data from a remote host and creates a pprof profile.
-// It resolves binary paths through /proc/<pid>/root for containerized processes.
+// It resolves binary paths through /proc/<pid>/root for containerized processes,
+// binaries within the client's shared path are read locally instead.
 // The perf script output is written to a temporary file that is deleted after processing.
-// Returns a list of binaries that were copied for artifact registration.
+// Up to copyOpts.Concurrency binaries are copied at once, each over its own
+// session of the multiplexed connection. System libraries are skipped unless
+// copyOpts.IncludeSystemLibs is set, their mappings keep the remote path.
+// Returns a list of binaries that were copied for artifact registration,
+// ordered by path.
 // Binaries are stored as <base32-sha256>.binary in runDir.
-func ProcessPerfData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir string, outputPath string, runDir string, pids []string, historyID string) ([]BinaryArtifact, error) {
+func ProcessPerfData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir string, outputPath string, runDir string, pids []string, copyOpts CopyOptions, historyID string, branchStack bool) ([]BinaryArtifact, error) {
 	remotePerfData := fmt.Sprintf("%s/perf.data", remoteBaseDir)
 
 	logger.Info().
@@ -324,12 +578,26 @@ func ProcessPerfData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir
 		logger.Debug().Str("temp_file", tempPath).Msg("Cleaned up temporary perf script file")
 	}()
 
-	// Run perf script remotely and stream output to temp file
-	perfScriptCmd := fmt.Sprintf("perf script -i %s", remotePerfData)
-	if err := sshClient.Run(perfScriptCmd, ssh.WithStdOut(tempFile)); err != nil {
+	// Run perf script remotely and stream output to temp file, within
+	// --command-timeout
+	scriptArgs := BuildScriptArgs(remotePerfData, branchStack)
+	for i, arg := range scriptArgs {
+		scriptArgs[i] = shellescape.Quote(arg)
+	}
+	perfScriptCmd := "perf " + strings.Join(scriptArgs, " ")
+	cmdCtx, cancel := sshClient.CommandContext()
+	defer cancel()
+	if err := sshClient.RunContext(cmdCtx, perfScriptCmd, ssh.WithStdOut(tempFile)); err != nil {
 		return nil, fmt.Errorf("failed to run perf script remotely: %w", err)
 	}
 
+	buildIDArgs := BuildIDListArgs(remotePerfData)
+	for i, arg := range buildIDArgs {
+		buildIDArgs[i] = shellescape.Quote(arg)
+	}
+	buildIDList, _, err := sshClient.RunCommand("perf " + strings.Join(buildIDArgs, " "))
+	buildIDs := parseBuildIDs(logger, buildIDList, err)
+
 	// Get file size for logging
 	fileInfo, _ := tempFile.Stat()
 	logger.Info().
@@ -358,81 +626,46 @@ func ProcessPerfData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir
 	// Copy binaries from remote host
 	localBinaries := make(map[string]string) // remote path -> local path
 	var binaryArtifacts []BinaryArtifact
-	if len(binaryPaths) > 0 && len(pids) > 0 {
-		logger.Info().Msg("Copying binaries from remote host")
-
-		for _, remotePath := range binaryPaths {
-			// Skip special paths like [kernel.kallsyms], [vdso], etc.
-			if strings.HasPrefix(remotePath, "[") {
-				continue
+	if len(binaryPaths) > 0 && (len(pids) > 0 || sshClient.SharedPath() != "") {
+		if !copyOpts.IncludeSystemLibs {
+			var skipped []string
+			binaryPaths, skipped = skipSystemLibs(binaryPaths, sshClient.IsShared)
+			if len(skipped) > 0 {
+				logger.Info().
+					Strs("binaries", skipped).
+					Msg("Skipping system libraries, use --include-system-libs to copy them")
 			}
+		}
 
-			// Try to find binary through /proc/<pid>/root for each PID
-			var foundProcPath string
-			var foundPID string
-			for _, pid := range pids {
-				procPath := fmt.Sprintf("/proc/%s/root%s", pid, remotePath)
-
-				// Check if binary exists via /proc/<pid>/root
-				checkCmd := fmt.Sprintf("test -f %s && echo exists", procPath)
-				output, _, err := sshClient.RunCommand(checkCmd)
-				if err == nil && strings.TrimSpace(output) == "exists" {
-					foundProcPath = procPath
-					foundPID = pid
-					break
+		concurrency := max(copyOpts.Concurrency, 1)
+		logger.Info().
+			Int("concurrency", concurrency).
+			Msg("Copying binaries from remote host")
+
+		// Each binary is copied over its own session of the multiplexed
+		// connection, results are kept in the order of binaryPaths
+		results := make([]*BinaryArtifact, len(binaryPaths))
+		bar := sshClient.Progress("Copying binaries", 0)
+		var g errgroup.Group
+		g.SetLimit(concurrency)
+		for i, remotePath := range binaryPaths {
+			g.Go(func() error {
+				if artifact, ok := fetchRemoteBinary(logger, sshClient, remotePath, runDir, pids, bar); ok {
+					results[i] = &artifact
 				}
-			}
-
-			if foundProcPath == "" {
-				logger.Debug().
-					Str("path", remotePath).
-					Msg("Binary not found via /proc/pid/root for any PID, skipping")
-				continue
-			}
-
-			// Get hash from remote system first
-			hash, size, err := getRemoteBinaryHash(logger, sshClient, foundProcPath)
-			if err != nil {
-				logger.Warn().
-					Err(err).
-					Str("remote", remotePath).
-					Str("proc_path", foundProcPath).
-					Msg("Failed to get binary hash")
-				continue
-			}
-
-			// Construct final filename with hash and original basename
-			basename := filepath.Base(remotePath)
-			binaryFilename := hash + "." + basename + ".binary"
-			localPath := filepath.Join(runDir, binaryFilename)
+				return nil
+			})
+		}
+		_ = g.Wait() // failures are logged and skipped
+		bar.Done()
 
-			// Copy binary directly to final location and verify hash
-			if err := copyBinaryFromRemote(logger, sshClient, foundProcPath, localPath, hash); err != nil {
-				logger.Warn().
-					Err(err).
-					Str("remote", remotePath).
-					Str("proc_path", foundProcPath).
-					Msg("Failed to copy binary")
+		for _, artifact := range results {
+			if artifact == nil {
 				continue
 			}
-
-			localBinaries[remotePath] = localPath
-
-			// Collect artifact information
-			binaryArtifacts = append(binaryArtifacts, BinaryArtifact{
-				RemotePath: remotePath,
-				LocalPath:  binaryFilename,
-				Size:       size,
-				Hash:       hash,
-			})
-
-			logger.Debug().
-				Str("remote", remotePath).
-				Str("pid", foundPID).
-				Str("proc_path", foundProcPath).
-				Str("hash", hash).
-				Str("local", binaryFilename).
-				Msg("Copied binary")
+			artifact.BuildID = buildIDs[artifact.RemotePath]
+			localBinaries[artifact.RemotePath] = filepath.Join(runDir, artifact.LocalPath)
+			binaryArtifacts = append(binaryArtifacts, *artifact)
 		}
 
 		logger.Info().
@@ -440,47 +673,108 @@ func ProcessPerfData(logger zerolog.Logger, sshClient *ssh.Client, remoteBaseDir
 			Msg("Binaries copied successfully")
 	}
 
-	// Parse and create the profile
-	parser := perfscript.New()
-	prof, err := parser.Parse(strings.NewReader(scriptOutput))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse perf script: %w", err)
+	// Parse the perf script output and write the profile
+	if err := writeProfile(logger, scriptOutput, buildIDs, localBinaries, outputPath, len(binaryArtifacts), historyID); err != nil {
+		if errors.Is(err, ErrNoSamples) {
+			return binaryArtifacts, err
+		}
+		return nil, err
 	}
 
-	// Update binary paths in the profile to point to local copies
-	for _, mapping := range prof.Mapping {
-		if localPath, ok := localBinaries[mapping.File]; ok {
-			mapping.File = localPath
+	return binaryArtifacts, nil
+}
+
+// fetchRemoteBinary archives the binary at remotePath, referenced by a remote
+// profile, in runDir. It reports false if the binary is skipped or can't be
+// copied. Copies from the remote host are reported on bar. It is safe for
+// concurrent use.
+func fetchRemoteBinary(logger zerolog.Logger, sshClient *ssh.Client, remotePath, runDir string, pids []string, bar *progress.Bar) (BinaryArtifact, bool) {
+	switch selectBinarySource(remotePath, sshClient.IsShared(remotePath), len(pids) > 0) {
+	case binarySourceNone:
+		// Special paths like [kernel.kallsyms], [vdso], etc.
+		return BinaryArtifact{}, false
+	case binarySourceShared:
+		artifact, err := archiveLocalBinary(remotePath, runDir)
+		if err != nil {
+			logger.Warn().
+				Err(err).
+				Str("shared", remotePath).
+				Msg("Failed to archive binary from shared path")
+			return BinaryArtifact{}, false
 		}
-	}
 
-	// Write profile to file
-	profileFile := outputPath
-	f, err := os.Create(profileFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create profile file: %w", err)
+		logger.Debug().
+			Str("shared", remotePath).
+			Str("hash", artifact.Hash).
+			Str("local", artifact.LocalPath).
+			Msg("Archived binary from shared path")
+		return artifact, true
+	}
+
+	// Try to find binary through /proc/<pid>/root for each PID
+	var foundProcPath string
+	var foundPID string
+	for _, pid := range pids {
+		procPath := fmt.Sprintf("/proc/%s/root%s", pid, remotePath)
+
+		// Check if binary exists via /proc/<pid>/root
+		checkCmd := fmt.Sprintf("test -f %s && echo exists", procPath)
+		output, _, err := sshClient.RunCommand(checkCmd)
+		if err == nil && strings.TrimSpace(output) == "exists" {
+			foundProcPath = procPath
+			foundPID = pid
+			break
+		}
 	}
-	defer f.Close()
 
-	if err := prof.Write(f); err != nil {
-		return nil, fmt.Errorf("failed to write profile: %w", err)
+	if foundProcPath == "" {
+		logger.Debug().
+			Str("path", remotePath).
+			Msg("Binary not found via /proc/pid/root for any PID, skipping")
+		return BinaryArtifact{}, false
 	}
 
-	logger.Info().
-		Str("profile", profileFile).
-		Int("binaries", len(binaryArtifacts)).
-		Int("samples", len(prof.Sample)).
-		Int("functions", len(prof.Function)).
-		Int("locations", len(prof.Location)).
-		Msg("Performance profile created")
-
-	shortID := historyID
-	if len(shortID) > 8 {
-		shortID = shortID[:8]
+	// Get hash from remote system first
+	hash, size, err := getRemoteBinaryHash(logger, sshClient, foundProcPath)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("remote", remotePath).
+			Str("proc_path", foundProcPath).
+			Msg("Failed to get binary hash")
+		return BinaryArtifact{}, false
+	}
+
+	// Construct final filename with hash and original basename
+	basename := filepath.Base(remotePath)
+	binaryFilename := hash + "." + basename + ".binary"
+	localPath := filepath.Join(runDir, binaryFilename)
+
+	// Copy binary directly to final location and verify hash
+	bar.AddTotal(int64(size))
+	if err := copyBinaryFromRemote(logger, sshClient, foundProcPath, localPath, hash, bar); err != nil {
+		logger.Warn().
+			Err(err).
+			Str("remote", remotePath).
+			Str("proc_path", foundProcPath).
+			Msg("Failed to copy binary")
+		return BinaryArtifact{}, false
 	}
-	logger.Info().Msgf("View profile with: perfgo view %s", shortID)
 
-	return binaryArtifacts, nil
+	logger.Debug().
+		Str("remote", remotePath).
+		Str("pid", foundPID).
+		Str("proc_path", foundProcPath).
+		Str("hash", hash).
+		Str("local", binaryFilename).
+		Msg("Copied binary")
+
+	return BinaryArtifact{
+		RemotePath: remotePath,
+		LocalPath:  binaryFilename,
+		Size:       size,
+		Hash:       hash,
+	}, true
 }
 
 // extractBinaryPaths extracts unique binary paths from perf script output.
@@ -505,11 +799,12 @@ func extractBinaryPaths(scriptOutput string) []string {
 		}
 	}
 
-	// Convert set to slice
+	// Convert set to slice, sorted for a stable artifact order
 	binaries := make([]string, 0, len(binarySet))
 	for path := range binarySet {
 		binaries = append(binaries, path)
 	}
+	sort.Strings(binaries)
 	return binaries
 }
 
@@ -556,20 +851,13 @@ func getRemoteBinaryHash(logger zerolog.Logger, sshClient *ssh.Client, remotePat
 }
 
 // copyBinaryFromRemote copies a binary from the remote host to local filesystem and verifies the hash.
-func copyBinaryFromRemote(logger zerolog.Logger, sshClient *ssh.Client, remotePath, localPath, expectedHash string) error {
-	// Use base64 encoding to transfer the binary
-	// This avoids issues with binary data in SSH output
-	cmd := fmt.Sprintf("base64 %s", remotePath)
-	base64Output, _, err := sshClient.RunCommand(cmd)
-	if err != nil {
+// The received bytes are reported on bar.
+func copyBinaryFromRemote(logger zerolog.Logger, sshClient *ssh.Client, remotePath, localPath, expectedHash string, bar *progress.Bar) error {
+	var buf bytes.Buffer
+	if err := sshClient.CopyFromRemote(remotePath, bar.Writer(&buf)); err != nil {
 		return fmt.Errorf("failed to read remote binary: %w", err)
 	}
-
-	// Decode base64
-	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(base64Output))
-	if err != nil {
-		return fmt.Errorf("failed to decode base64: %w", err)
-	}
+	data := buf.Bytes()
 
 	// Calculate local hash for verification
 	localHashBytes := sha256.Sum256(data)
@@ -0,0 +1,440 @@
+package perf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRecordArgs_ControlFD(t *testing.T) {
+	args := BuildRecordArgs(RecordOptions{
+		OutputPath: "perf.data",
+		ControlFD:  3,
+		Binary:     "./perfgo.test",
+	})
+	assert.Equal(t, []string{
+		"record", "-g", "--call-graph", "fp",
+		"-o", "perf.data",
+		"--control", "fd:3",
+		"--", "./perfgo.test",
+	}, args)
+}
+
+func TestBuildRecordArgs_Cgroup(t *testing.T) {
+	const cgroup = "kubepods.slice/kubepods-burstable.slice/cri-containerd-abc.scope"
+
+	tests := []struct {
+		name string
+		opts RecordOptions
+		want []string
+	}{
+		{
+			name: "default event",
+			opts: RecordOptions{OutputPath: "perf.data", CgroupPath: cgroup, PIDs: []string{"42"}, Duration: 10},
+			want: []string{
+				"record", "-g", "--call-graph", "fp",
+				"-e", "cycles",
+				"-o", "perf.data",
+				"-a", "-G", cgroup,
+				"sleep", "10",
+			},
+		},
+		{
+			name: "cgroup per event",
+			opts: RecordOptions{OutputPath: "perf.data", CgroupPath: cgroup, Event: "cycles,cpu/event=0x3c,umask=0x0/", Count: 1000, Duration: 5},
+			want: []string{
+				"record", "-g", "--call-graph", "fp",
+				"-e", "cycles,cpu/event=0x3c,umask=0x0/", "-c", "1000",
+				"-o", "perf.data",
+				"-a", "-G", cgroup + "," + cgroup,
+				"sleep", "5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildRecordArgs(tt.opts))
+		})
+	}
+}
+
+func TestBuildRecordArgs_SystemWide(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RecordOptions
+		want []string
+	}{
+		{
+			name: "all CPUs",
+			opts: RecordOptions{OutputPath: "perf.data", SystemWide: true, Duration: 10},
+			want: []string{
+				"record", "-g", "--call-graph", "fp",
+				"-o", "perf.data",
+				"-a", "sleep", "10",
+			},
+		},
+		{
+			name: "ignores PIDs and binary",
+			opts: RecordOptions{OutputPath: "perf.data", SystemWide: true, Event: "cache-misses", Duration: 5, PIDs: []string{"42"}, Binary: "./perfgo.test", Args: []string{"-test.v"}},
+			want: []string{
+				"record", "-g", "--call-graph", "fp",
+				"-e", "cache-misses",
+				"-o", "perf.data",
+				"-a", "sleep", "5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := BuildRecordArgs(tt.opts)
+			assert.Equal(t, tt.want, args)
+			assert.NotContains(t, args, "-p")
+			assert.NotContains(t, args, "--")
+		})
+	}
+}
+
+func TestWriteProfile_NoSamples(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	outputPath := filepath.Join(t.TempDir(), "perf.pb.gz")
+
+	err := writeProfile(logger, "", nil, nil, outputPath, 0, "0123456789abcdef")
+	require.ErrorIs(t, err, ErrNoSamples)
+
+	// The empty profile is still written
+	f, err := os.Open(outputPath)
+	require.NoError(t, err)
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	require.NoError(t, err)
+	assert.Empty(t, prof.Sample)
+
+	assert.Contains(t, logs.String(), `"level":"warn"`)
+	assert.Contains(t, logs.String(), "-benchtime")
+	assert.NotContains(t, logs.String(), "Performance profile created")
+}
+
+func TestWriteProfile_WithSamples(t *testing.T) {
+	script := `perfgo.test 1234 [000] 1.000000:     250000 cycles:
+	          4a1b2c main.work+0x1c (/tmp/perfgo.test)
+	          4a0000 main.main+0x10 (/tmp/perfgo.test)
+
+`
+	localBinaries := map[string]string{"/tmp/perfgo.test": "/history/abc.perfgo.test.binary"}
+	outputPath := filepath.Join(t.TempDir(), "perf.pb.gz")
+
+	err := writeProfile(zerolog.Nop(), script, nil, localBinaries, outputPath, 1, "0123456789abcdef")
+	require.NoError(t, err)
+
+	f, err := os.Open(outputPath)
+	require.NoError(t, err)
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	require.NoError(t, err)
+	require.Len(t, prof.Sample, 1)
+	require.Len(t, prof.Mapping, 1)
+	assert.Equal(t, "/history/abc.perfgo.test.binary", prof.Mapping[0].File)
+}
+
+func TestBuildRecordArgs_BranchStack(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RecordOptions
+		want []string
+	}{
+		{
+			name: "any branch",
+			opts: RecordOptions{OutputPath: "perf.data", BranchStack: true},
+			want: []string{"record", "-g", "--call-graph", "fp", "-b", "-o", "perf.data"},
+		},
+		{
+			name: "filtered",
+			opts: RecordOptions{OutputPath: "perf.data", BranchStack: true, BranchFilter: "any_call,u"},
+			want: []string{"record", "-g", "--call-graph", "fp", "-j", "any_call,u", "-o", "perf.data"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildRecordArgs(tt.opts))
+			assert.True(t, tt.opts.HasBranchStack())
+		})
+	}
+}
+
+func TestBuildScriptArgs(t *testing.T) {
+	assert.Equal(t, []string{"script", "-i", "perf.data", "--show-mmap-events"}, BuildScriptArgs("perf.data", false))
+	assert.Equal(t, []string{"script", "-i", "perf.data", "--show-mmap-events", "-F", "+brstacksym"}, BuildScriptArgs("perf.data", true))
+}
+
+func TestSelectBinarySource(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		shared  bool
+		hasPIDs bool
+		want    binarySource
+	}{
+		{name: "kernel", path: "[kernel.kallsyms]", shared: true, hasPIDs: true, want: binarySourceNone},
+		{name: "shared test binary", path: "/mnt/shared/repositories/app/perfgo.test", shared: true, want: binarySourceShared},
+		{name: "shared preferred over proc", path: "/mnt/shared/app", shared: true, hasPIDs: true, want: binarySourceShared},
+		{name: "attached process", path: "/usr/bin/app", hasPIDs: true, want: binarySourceProc},
+		{name: "test binary without shared path", path: "/home/user/.cache/perfgo/perfgo.test", want: binarySourceNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, selectBinarySource(tt.path, tt.shared, tt.hasPIDs))
+		})
+	}
+}
+
+func TestArchiveLocalBinary(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "perfgo.test")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0755))
+	runDir := t.TempDir()
+
+	artifact, err := archiveLocalBinary(binary, runDir)
+	require.NoError(t, err)
+	assert.Equal(t, binary, artifact.RemotePath)
+	assert.Equal(t, artifact.Hash+".perfgo.test.binary", artifact.LocalPath)
+	assert.Equal(t, uint64(6), artifact.Size)
+	assert.FileExists(t, filepath.Join(runDir, artifact.LocalPath))
+}
+
+// fakeRemoteBinaries answers the ssh commands ProcessPerfData runs against a
+// remote host exposing binaries through /proc/<pid>/root.
+type fakeRemoteBinaries struct {
+	script   string
+	buildIDs string            // perf buildid-list output
+	binaries map[string]string // remote path -> content
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (f *fakeRemoteBinaries) handle(cmd runner.Cmd) runner.Result {
+	if cmd.Name != "ssh" || len(cmd.Args) == 0 {
+		return runner.Result{}
+	}
+	command := cmd.Args[len(cmd.Args)-1]
+
+	// The binary path follows /proc/<pid>/root in every command
+	content := func() (string, bool) {
+		for path, content := range f.binaries {
+			if strings.Contains(command, "/root"+path+" ") || strings.HasSuffix(command, "/root"+path) {
+				return content, true
+			}
+		}
+		return "", false
+	}
+
+	switch {
+	case strings.HasPrefix(command, "perf script"):
+		return runner.Result{Stdout: f.script}
+	case strings.HasPrefix(command, "perf buildid-list"):
+		return runner.Result{Stdout: f.buildIDs}
+	case strings.HasPrefix(command, "test -f"):
+		if _, ok := content(); ok {
+			return runner.Result{Stdout: "exists\n"}
+		}
+		return runner.Result{Err: errors.New("exit status 1")}
+	case strings.HasPrefix(command, "sha256sum"):
+		data, _ := content()
+		sum := sha256.Sum256([]byte(data))
+		return runner.Result{Stdout: hex.EncodeToString(sum[:]) + "\n"}
+	case strings.HasPrefix(command, "stat"):
+		data, _ := content()
+		return runner.Result{Stdout: fmt.Sprintf("%d\n", len(data))}
+	case strings.HasPrefix(command, "base64"):
+		n := f.inFlight.Add(1)
+		defer f.inFlight.Add(-1)
+		for {
+			old := f.maxInFlight.Load()
+			if n <= old || f.maxInFlight.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		data, _ := content()
+		return runner.Result{Stdout: base64.StdEncoding.EncodeToString([]byte(data)) + "\n"}
+	}
+	return runner.Result{}
+}
+
+func TestProcessPerfData_ParallelCopy(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	paths := []string{"/usr/bin/app", "/lib/libc.so.6", "/lib/libm.so.6", "/usr/lib/libssl.so.3", "/usr/lib/libz.so.1", "/opt/plugin.so"}
+	fake := &fakeRemoteBinaries{binaries: make(map[string]string)}
+	var script strings.Builder
+	for i, path := range paths {
+		fake.binaries[path] = "binary " + path
+		fmt.Fprintf(&script, "app 42 [000] 1.%06d:     250000 cycles:\n\t          4a1b2c fn%d+0x1c (%s)\n\t          ffffffff81000000 kfn+0x10 ([kernel.kallsyms])\n\n", i, i, path)
+	}
+	fake.script = script.String()
+
+	run := func() []BinaryArtifact {
+		client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(&runner.Fake{Handler: fake.handle}))
+		require.NoError(t, err)
+
+		runDir := t.TempDir()
+		artifacts, err := ProcessPerfData(zerolog.Nop(), client, "/tmp", filepath.Join(runDir, "perf.pb.gz"), runDir, []string{"42"}, CopyOptions{Concurrency: 3, IncludeSystemLibs: true}, "0123456789abcdef", false)
+		require.NoError(t, err)
+
+		for _, artifact := range artifacts {
+			data, err := os.ReadFile(filepath.Join(runDir, artifact.LocalPath))
+			require.NoError(t, err)
+			assert.Equal(t, fake.binaries[artifact.RemotePath], string(data))
+		}
+		return artifacts
+	}
+
+	artifacts := run()
+	require.Len(t, artifacts, len(paths))
+
+	// Artifacts are ordered by path regardless of completion order
+	var got []string
+	for _, artifact := range artifacts {
+		got = append(got, artifact.RemotePath)
+	}
+	want := append([]string(nil), paths...)
+	sort.Strings(want)
+	assert.Equal(t, want, got)
+	assert.Equal(t, artifacts, run())
+
+	assert.LessOrEqual(t, fake.maxInFlight.Load(), int32(3))
+	assert.Greater(t, fake.maxInFlight.Load(), int32(1))
+}
+
+func TestIsSystemLib(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/usr/lib/x86_64-linux-gnu/libc.so.6", want: true},
+		{path: "/lib/ld-musl-x86_64.so.1", want: true},
+		{path: "/lib64/ld-linux-x86-64.so.2", want: true},
+		{path: "/opt/vendor/libfoo.so", want: true},
+		{path: "/app/server", want: false},
+		{path: "/library/app", want: false},
+		{path: "/home/user/.cache/perfgo/perfgo.test", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, isSystemLib(tt.path))
+		})
+	}
+}
+
+func TestSkipSystemLibs(t *testing.T) {
+	isShared := func(path string) bool { return strings.HasPrefix(path, "/opt/shared/") }
+
+	keep, skipped := skipSystemLibs([]string{
+		"/app/server",
+		"/lib/libc.so.6",
+		"/opt/shared/perfgo.test",
+		"/usr/lib/libssl.so.3",
+	}, isShared)
+	assert.Equal(t, []string{"/app/server", "/opt/shared/perfgo.test"}, keep)
+	assert.Equal(t, []string{"/lib/libc.so.6", "/usr/lib/libssl.so.3"}, skipped)
+}
+
+func TestProcessPerfData_SkipsSystemLibs(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	fake := &fakeRemoteBinaries{
+		binaries: map[string]string{
+			"/app/server":    "binary server",
+			"/lib/libc.so.6": "binary libc",
+		},
+		script: "server 42 [000] 1.000000:     250000 cycles:\n" +
+			"\t          7f0000001000 memcpy+0x10 (/lib/libc.so.6)\n" +
+			"\t          4a1b2c main.work+0x1c (/app/server)\n\n",
+	}
+	client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(&runner.Fake{Handler: fake.handle}))
+	require.NoError(t, err)
+
+	runDir := t.TempDir()
+	profilePath := filepath.Join(runDir, "perf.pb.gz")
+	artifacts, err := ProcessPerfData(zerolog.Nop(), client, "/tmp", profilePath, runDir, []string{"42"}, CopyOptions{Concurrency: 2}, "0123456789abcdef", false)
+	require.NoError(t, err)
+
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "/app/server", artifacts[0].RemotePath)
+
+	f, err := os.Open(profilePath)
+	require.NoError(t, err)
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	files := make(map[string]bool)
+	for _, mapping := range prof.Mapping {
+		files[mapping.File] = true
+	}
+	// The skipped library keeps its remote path, the copied binary is archived
+	assert.True(t, files["/lib/libc.so.6"], "mappings: %v", files)
+	assert.True(t, files[filepath.Join(runDir, artifacts[0].LocalPath)], "mappings: %v", files)
+}
+
+func TestProcessPerfData_BuildIDs(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	fake := &fakeRemoteBinaries{
+		binaries: map[string]string{
+			"/app/server": "binary server",
+		},
+		script: "server 42 [000] 1.000000:     250000 cycles:\n" +
+			"\t          7f0000001000 memcpy+0x10 (/lib/libc.so.6)\n" +
+			"\t          4a1b2c main.work+0x1c (/app/server)\n\n",
+		buildIDs: "a1b2c3d4 /app/server\ne5f6a7b8 /lib/libc.so.6\n",
+	}
+	client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(&runner.Fake{Handler: fake.handle}))
+	require.NoError(t, err)
+
+	runDir := t.TempDir()
+	profilePath := filepath.Join(runDir, "perf.pb.gz")
+	artifacts, err := ProcessPerfData(zerolog.Nop(), client, "/tmp", profilePath, runDir, []string{"42"}, CopyOptions{Concurrency: 1}, "0123456789abcdef", false)
+	require.NoError(t, err)
+
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "a1b2c3d4", artifacts[0].BuildID)
+
+	f, err := os.Open(profilePath)
+	require.NoError(t, err)
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	buildIDs := make(map[string]string)
+	for _, mapping := range prof.Mapping {
+		buildIDs[mapping.File] = mapping.BuildID
+	}
+	assert.Equal(t, map[string]string{
+		filepath.Join(runDir, artifacts[0].LocalPath): "a1b2c3d4",
+		"/lib/libc.so.6": "e5f6a7b8",
+	}, buildIDs)
+}
@@ -4,20 +4,73 @@ package perf
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/perfstat"
 	"github.com/urfave/cli/v2"
 )
 
 // StatOptions contains options for perf stat command.
 type StatOptions struct {
-	Events   []string // Events to measure
-	PIDs     []string // Process IDs to attach to
-	Duration int      // Duration in seconds (used with sleep)
-	Binary   string   // Binary to execute (mutually exclusive with PIDs)
-	Args     []string // Arguments for the binary
-	Detail   bool     // Add detailed statistics (-d flag)
+	Events     []string // Events to measure
+	PIDs       []string // Process IDs to attach to
+	Duration   int      // Duration in seconds (used with sleep)
+	Binary     string   // Binary to execute (mutually exclusive with PIDs)
+	Args       []string // Arguments for the binary
+	SystemWide bool     // Count on all CPUs (-a) for Duration, ignoring PIDs and Binary
+	Detail     bool     // Add detailed statistics (-d flag)
+	CSV        bool     // Print the counters as CSV (-x,) for perfstat.ParseCSV
+	// Number of times perf stat runs the binary, reporting the mean and
+	// variance of the counters (-r), unlike perfgo's --repeat
+	Repeat int
+
+	// Aggregation mode of the counts, the whole run if none is set
+	StatAggregation
+}
+
+// StatAggregation selects how perf stat aggregates the counts of the CPUs or
+// threads. The modes are mutually exclusive.
+type StatAggregation struct {
+	PerCore   bool // Count per physical core (--per-core)
+	PerSocket bool // Count per socket (--per-socket)
+	PerThread bool // Count per monitored thread (--per-thread)
+}
+
+// Mode returns the name of the aggregation mode (core, socket or thread), or
+// an empty string if the counts are aggregated over the whole run.
+func (a StatAggregation) Mode() string {
+	switch {
+	case a.PerCore:
+		return "core"
+	case a.PerSocket:
+		return "socket"
+	case a.PerThread:
+		return "thread"
+	}
+	return ""
+}
+
+// Validate returns an error if more than one aggregation mode is set.
+func (a StatAggregation) Validate() error {
+	var modes []string
+	for _, m := range []struct {
+		set  bool
+		flag string
+	}{
+		{a.PerCore, "--per-core"},
+		{a.PerSocket, "--per-socket"},
+		{a.PerThread, "--per-thread"},
+	} {
+		if m.set {
+			modes = append(modes, m.flag)
+		}
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf("%s are mutually exclusive", strings.Join(modes, " and "))
+	}
+	return nil
 }
 
 // BuildStatArgs builds perf stat command arguments for local execution.
@@ -29,6 +82,18 @@ func BuildStatArgs(opts StatOptions) []string {
 		args = append(args, "-d")
 	}
 
+	if opts.CSV {
+		args = append(args, "-x", perfstat.Separator)
+	}
+
+	if mode := opts.Mode(); mode != "" {
+		args = append(args, "--per-"+mode)
+	}
+
+	if opts.Repeat > 1 {
+		args = append(args, "-r", strconv.Itoa(opts.Repeat))
+	}
+
 	// Add events
 	if len(opts.Events) > 0 {
 		for _, event := range opts.Events {
@@ -36,8 +101,10 @@ func BuildStatArgs(opts StatOptions) []string {
 		}
 	}
 
-	// Add PIDs or binary execution
-	if len(opts.PIDs) > 0 {
+	// Add all CPUs, PIDs or binary execution
+	if opts.SystemWide {
+		args = append(args, "-a", "sleep", fmt.Sprintf("%d", opts.Duration))
+	} else if len(opts.PIDs) > 0 {
 		pidList := strings.Join(opts.PIDs, ",")
 		args = append(args, "-p", pidList)
 
@@ -85,6 +152,38 @@ func StatDetailFlag() cli.Flag {
 	}
 }
 
+// StatRepeatFlag returns the flag letting perf stat repeat the test.
+func StatRepeatFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "perf-repeat",
+		Usage: "Let perf stat run the test N times and report the variance of each counter (-r flag to perf); --repeat re-runs the whole test instead",
+	}
+}
+
+// StatPerCoreFlag returns the flag aggregating perf stat counts per core.
+func StatPerCoreFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "per-core",
+		Usage: "Aggregate counts per physical core (--per-core flag to perf)",
+	}
+}
+
+// StatPerSocketFlag returns the flag aggregating perf stat counts per socket.
+func StatPerSocketFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "per-socket",
+		Usage: "Aggregate counts per socket, e.g. to compare NUMA nodes (--per-socket flag to perf)",
+	}
+}
+
+// StatPerThreadFlag returns the flag aggregating perf stat counts per thread.
+func StatPerThreadFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "per-thread",
+		Usage: "Aggregate counts per monitored thread (--per-thread flag to perf)",
+	}
+}
+
 // DurationFlag returns the duration flag for performance data collection.
 func DurationFlag() cli.Flag {
 	return &cli.IntFlag{
@@ -0,0 +1,93 @@
+package perf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildStatArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts StatOptions
+		want []string
+	}{
+		{
+			name: "attach with detail",
+			opts: StatOptions{Events: []string{"cycles", " instructions"}, PIDs: []string{"10", "11"}, Duration: 5, Detail: true},
+			want: []string{"stat", "-d", "-e", "cycles", "-e", "instructions", "-p", "10,11", "sleep", "5"},
+		},
+		{
+			name: "attach without detail",
+			opts: StatOptions{PIDs: []string{"10"}, Duration: 5},
+			want: []string{"stat", "-p", "10", "sleep", "5"},
+		},
+		{
+			name: "binary",
+			opts: StatOptions{Binary: "./perfgo.test", Args: []string{"-test.run=^$"}, Detail: true},
+			want: []string{"stat", "-d", "--", "./perfgo.test", "-test.run=^$"},
+		},
+		{
+			name: "csv",
+			opts: StatOptions{Events: []string{"cycles"}, Binary: "./perfgo.test", CSV: true},
+			want: []string{"stat", "-x", ",", "-e", "cycles", "--", "./perfgo.test"},
+		},
+		{
+			name: "perf repeat",
+			opts: StatOptions{Binary: "./perfgo.test", CSV: true, Repeat: 5},
+			want: []string{"stat", "-x", ",", "-r", "5", "--", "./perfgo.test"},
+		},
+		{
+			name: "single perf run",
+			opts: StatOptions{Binary: "./perfgo.test", Repeat: 1},
+			want: []string{"stat", "--", "./perfgo.test"},
+		},
+		{
+			name: "per core",
+			opts: StatOptions{Binary: "./perfgo.test", CSV: true, StatAggregation: StatAggregation{PerCore: true}},
+			want: []string{"stat", "-x", ",", "--per-core", "--", "./perfgo.test"},
+		},
+		{
+			name: "per socket",
+			opts: StatOptions{Binary: "./perfgo.test", StatAggregation: StatAggregation{PerSocket: true}},
+			want: []string{"stat", "--per-socket", "--", "./perfgo.test"},
+		},
+		{
+			name: "per thread",
+			opts: StatOptions{PIDs: []string{"10"}, Duration: 5, StatAggregation: StatAggregation{PerThread: true}},
+			want: []string{"stat", "--per-thread", "-p", "10", "sleep", "5"},
+		},
+		{
+			name: "system wide",
+			opts: StatOptions{Events: []string{"cycles"}, SystemWide: true, Duration: 5, StatAggregation: StatAggregation{PerSocket: true}},
+			want: []string{"stat", "--per-socket", "-e", "cycles", "-a", "sleep", "5"},
+		},
+		{
+			name: "system wide ignores PIDs and binary",
+			opts: StatOptions{SystemWide: true, Duration: 5, PIDs: []string{"10"}, Binary: "./perfgo.test"},
+			want: []string{"stat", "-a", "sleep", "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildStatArgs(tt.opts))
+		})
+	}
+}
+
+func TestBuildStatCommand(t *testing.T) {
+	cmd := BuildStatCommand(StatOptions{Events: []string{"cycles:u"}, PIDs: []string{"10"}, Duration: 3, Detail: true})
+	assert.Equal(t, "perf stat -d -e cycles:u -p 10 sleep 3", cmd)
+}
+
+func TestStatAggregation(t *testing.T) {
+	assert.Equal(t, "", StatAggregation{}.Mode())
+	assert.NoError(t, StatAggregation{}.Validate())
+	assert.Equal(t, "core", StatAggregation{PerCore: true}.Mode())
+	assert.NoError(t, StatAggregation{PerSocket: true}.Validate())
+	assert.Equal(t, "thread", StatAggregation{PerThread: true}.Mode())
+
+	assert.EqualError(t, StatAggregation{PerCore: true, PerSocket: true}.Validate(), "--per-core and --per-socket are mutually exclusive")
+	assert.EqualError(t, StatAggregation{PerCore: true, PerSocket: true, PerThread: true}.Validate(), "--per-core and --per-socket and --per-thread are mutually exclusive")
+}
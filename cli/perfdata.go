@@ -0,0 +1,153 @@
+package cli
+
+// This file contains --keep-perf-data, which archives the raw perf.data of a
+// run so it can be analyzed with perf report later (view --perf-report).
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// perfDataFile is the name of the perf.data artifact in the run directory.
+const perfDataFile = "perf.data"
+
+// keepPerfDataFlag returns the flag archiving the raw perf.data of a run.
+func keepPerfDataFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "keep-perf-data",
+		Usage: "Keep the raw perf.data in the history to analyze it later with perf report (view --perf-report)",
+	}
+}
+
+// perfDataInCWDFlag returns the flag writing perf.data of local runs to the
+// working directory.
+func perfDataInCWDFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "perf-data-in-cwd",
+		Usage: "Write perf.data of local runs to the working directory and keep it there, for debugging",
+	}
+}
+
+// localPerfDataPath returns the path local perf runs write perf.data to: a
+// temporary directory removed by the returned cleanup function or when the
+// run is interrupted, or the working directory if inCWD is set.
+func (a *App) localPerfDataPath(inCWD bool) (string, func(), error) {
+	if inCWD {
+		return perfDataFile, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "perfgo-perf-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create perf.data directory: %w", err)
+	}
+	unregister := a.onInterrupt(func() { os.RemoveAll(dir) })
+	cleanup := func() {
+		unregister()
+		if err := os.RemoveAll(dir); err != nil {
+			a.logger.Warn().Err(err).Str("path", dir).Msg("Failed to remove perf.data directory")
+		}
+	}
+	return filepath.Join(dir, perfDataFile), cleanup, nil
+}
+
+// savePerfData copies the perf.data at path into runDir and registers it as
+// artifact if --keep-perf-data is set. The file is read from the remote host
+// if client is set. Failures are logged, as the run's results don't depend on
+// the raw data.
+func (a *App) savePerfData(client *ssh.Client, path, runDir string, history *model.History) {
+	if !a.keepPerfData {
+		return
+	}
+
+	dest := filepath.Join(runDir, perfDataFile)
+	if err := copyPerfData(client, path, dest); err != nil {
+		a.logger.Warn().Err(err).Str("path", path).Msg("Failed to keep perf.data")
+		os.Remove(dest)
+		return
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		a.logger.Warn().Err(err).Str("path", dest).Msg("Failed to keep perf.data")
+		return
+	}
+	history.Artifacts = append(history.Artifacts, model.Artifact{
+		Type: model.ArtifactTypePerfData,
+		Size: uint64(info.Size()),
+		File: perfDataFile,
+	})
+	a.logger.Debug().
+		Str("path", path).
+		Int64("size", info.Size()).
+		Msg("Registered perf.data artifact")
+}
+
+// copyPerfData copies the perf.data at path, on the remote host if client is
+// set, to dest.
+func copyPerfData(client *ssh.Client, path, dest string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	defer out.Close()
+
+	if client != nil {
+		if err := client.CopyFromRemote(path, out); err != nil {
+			return fmt.Errorf("failed to copy %s from remote host: %w", path, err)
+		}
+	} else {
+		in, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer in.Close()
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", path, err)
+		}
+	}
+	return out.Close()
+}
+
+// perfReportArgs returns the perf arguments opening perfDataPath with the
+// report matching how it was recorded, followed by the given extra arguments.
+func perfReportArgs(h *model.History, perfDataPath string, extra []string) []string {
+	var args []string
+	switch {
+	case h.Perf != nil && h.Perf.C2C != nil:
+		args = []string{"c2c", "report"}
+	case h.Perf != nil && h.Perf.Mem != nil:
+		args = []string{"mem", "report"}
+	default:
+		args = []string{"report"}
+	}
+	args = append(args, "-i", perfDataPath)
+	return append(args, extra...)
+}
+
+// perfReportCommand returns the command running perf with the given
+// arguments in runDir, attached to the terminal.
+func perfReportCommand(runDir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("perf", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = runDir
+	return cmd
+}
+
+// findPerfData returns the perf.data artifact of the run.
+func findPerfData(h *model.History) (*model.Artifact, error) {
+	for i := range h.Artifacts {
+		if h.Artifacts[i].Type == model.ArtifactTypePerfData {
+			return &h.Artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("run %s has no perf.data, record it with --keep-perf-data", h.ID[:8])
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavePerfData_Local(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "perf.data")
+	require.NoError(t, os.WriteFile(src, []byte("PERFILE2 samples"), 0o600))
+
+	// Without --keep-perf-data nothing is archived
+	runDir := t.TempDir()
+	h := &model.History{}
+	a := &App{logger: zerolog.Nop()}
+	a.savePerfData(nil, src, runDir, h)
+	assert.Empty(t, h.Artifacts)
+	assert.NoFileExists(t, filepath.Join(runDir, perfDataFile))
+
+	a.keepPerfData = true
+	a.savePerfData(nil, src, runDir, h)
+	assert.Equal(t, []model.Artifact{{Type: model.ArtifactTypePerfData, Size: 16, File: perfDataFile}}, h.Artifacts)
+	data, err := os.ReadFile(filepath.Join(runDir, perfDataFile))
+	require.NoError(t, err)
+	assert.Equal(t, "PERFILE2 samples", string(data))
+
+	// The source file is kept
+	assert.FileExists(t, src)
+}
+
+func TestSavePerfData_Remote(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		if cmd.Name == "ssh" && strings.HasSuffix(cmd.Args[len(cmd.Args)-1], "base64 /tmp/perf.data") {
+			return runner.Result{Stdout: base64.StdEncoding.EncodeToString([]byte("PERFILE2 remote")) + "\n"}
+		}
+		return runner.Result{}
+	}}
+	client, err := ssh.New(zerolog.Nop(), "host", ssh.WithRunner(fake))
+	require.NoError(t, err)
+
+	runDir := t.TempDir()
+	h := &model.History{}
+	a := &App{logger: zerolog.Nop(), runState: runState{keepPerfData: true}}
+	a.savePerfData(client, "/tmp/perf.data", runDir, h)
+
+	require.Len(t, h.Artifacts, 1)
+	assert.Equal(t, model.ArtifactTypePerfData, h.Artifacts[0].Type)
+	data, err := os.ReadFile(filepath.Join(runDir, perfDataFile))
+	require.NoError(t, err)
+	assert.Equal(t, "PERFILE2 remote", string(data))
+}
+
+func TestSavePerfData_Missing(t *testing.T) {
+	runDir := t.TempDir()
+	h := &model.History{}
+	a := &App{logger: zerolog.Nop(), runState: runState{keepPerfData: true}}
+	a.savePerfData(nil, filepath.Join(t.TempDir(), "perf.data"), runDir, h)
+
+	assert.Empty(t, h.Artifacts)
+	assert.NoFileExists(t, filepath.Join(runDir, perfDataFile))
+}
+
+func TestPerfReportArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		perf  *model.Perf
+		extra []string
+		want  []string
+	}{
+		{name: "profile", perf: &model.Perf{Record: &model.PerfRecord{Event: "cycles"}}, want: []string{"report", "-i", "/runs/perf.data"}},
+		{name: "no perf options", want: []string{"report", "-i", "/runs/perf.data"}},
+		{name: "c2c", perf: &model.Perf{C2C: &model.PerfC2C{}}, want: []string{"c2c", "report", "-i", "/runs/perf.data"}},
+		{name: "mem", perf: &model.Perf{Mem: &model.PerfMem{}}, want: []string{"mem", "report", "-i", "/runs/perf.data"}},
+		{name: "extra arguments", perf: &model.Perf{Record: &model.PerfRecord{}}, extra: []string{"--sort=dso", "--stdio"}, want: []string{"report", "-i", "/runs/perf.data", "--sort=dso", "--stdio"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &model.History{Perf: tt.perf}
+			assert.Equal(t, tt.want, perfReportArgs(h, "/runs/perf.data", tt.extra))
+		})
+	}
+}
+
+func TestPerfReportCommand(t *testing.T) {
+	cmd := perfReportCommand("/runs/abc", "report", "-i", "/runs/abc/perf.data")
+	assert.Equal(t, []string{"perf", "report", "-i", "/runs/abc/perf.data"}, cmd.Args)
+	assert.Equal(t, "/runs/abc", cmd.Dir)
+}
+
+func TestRunPerfReport_NoPerfData(t *testing.T) {
+	entry := &history.Entry{
+		FullPath: t.TempDir(),
+		History:  model.History{ID: "0123456789abcdef"},
+	}
+	a := &App{logger: zerolog.Nop()}
+	assert.EqualError(t, a.runPerfReport(entry, nil), "run 01234567 has no perf.data, record it with --keep-perf-data")
+}
@@ -0,0 +1,103 @@
+package cli
+
+// This file contains the verification of the image of the privileged perf
+// pod, which has to provide perf and an sshd that perfgo connects through.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/k8s"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultSSHDPath is the path of sshd in the default perf image.
+const defaultSSHDPath = "/usr/sbin/sshd"
+
+// sshdPathFlag returns the flag setting the path of sshd in the perf image.
+func sshdPathFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "sshd-path",
+		Usage: "Path of sshd in the perf image, started through kubectl exec to connect to the perf pod",
+		Value: defaultSSHDPath,
+	}
+}
+
+// imageRequirement is a tool the perf image has to provide.
+type imageRequirement struct {
+	Name  string // Name reported if the tool is missing
+	Check string // Shell command succeeding if the tool is usable
+}
+
+// perfImageRequirements returns the tools perfgo uses in the perf pod.
+func perfImageRequirements(sshdPath string) []imageRequirement {
+	return []imageRequirement{
+		{Name: "perf", Check: "perf --version"},
+		{Name: "sshd (" + sshdPath + ")", Check: "test -x " + shellescape.Quote(sshdPath)},
+		{Name: "ssh-keygen", Check: "command -v ssh-keygen"},
+		{Name: "bash", Check: "command -v bash"},
+	}
+}
+
+// verifyImageCommand returns the command checking all requirements in one
+// exec, printing "ok" or "missing" and the index of each requirement.
+func verifyImageCommand(reqs []imageRequirement) []string {
+	checks := make([]string, 0, len(reqs))
+	for i, req := range reqs {
+		checks = append(checks, fmt.Sprintf("if %s >/dev/null 2>&1; then echo ok %d; else echo missing %d; fi", req.Check, i, i))
+	}
+	return []string{"sh", "-c", strings.Join(checks, "; ")}
+}
+
+// parseImageVerification returns an error listing the requirements reported
+// missing in the output of verifyImageCommand. Requirements without a result
+// are reported missing as well.
+func parseImageVerification(output string, reqs []imageRequirement, image string) error {
+	ok := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if index, found := strings.CutPrefix(strings.TrimSpace(line), "ok "); found {
+			ok[index] = true
+		}
+	}
+
+	var missing []string
+	for i, req := range reqs {
+		if !ok[fmt.Sprint(i)] {
+			missing = append(missing, req.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("perf image %s is missing %s, use a --perf-image providing them or point --sshd-path to sshd", image, strings.Join(missing, ", "))
+}
+
+// verifyPerfImage checks that the perf pod provides the tools perfgo uses, so
+// a custom --perf-image lacking them fails with a clear error.
+func (a *App) verifyPerfImage(ctx context.Context, client *k8s.Client, podName, image, sshdPath string) error {
+	a.logger.Info().
+		Str("perf_pod", podName).
+		Msg("Verifying perf image")
+
+	reqs := perfImageRequirements(sshdPath)
+	output, err := client.ExecCommand(ctx, podName, verifyImageCommand(reqs))
+	if err != nil {
+		return fmt.Errorf("failed to verify perf image %s, it needs a POSIX sh: %w", image, err)
+	}
+	return parseImageVerification(output, reqs, image)
+}
+
+// sshdProxyCommand returns the ssh ProxyCommand starting sshd in inetd mode
+// in the perf pod, with kubectl exec forwarding its stdin and stdout.
+// kubectlArgs select the kubeconfig and context (see k8s.Client.GlobalArgs).
+func sshdProxyCommand(kubectlArgs []string, namespace, podName, sshdPath string) string {
+	parts := []string{"kubectl"}
+	for _, arg := range kubectlArgs {
+		parts = append(parts, shellescape.Quote(arg))
+	}
+	sshdCmd := shellescape.Quote(sshdPath) + " -i 2> /dev/null"
+	parts = append(parts, "exec", "-i", "-n", namespace, podName, "--", "bash", "-c", shellescape.Quote(sshdCmd))
+	return strings.Join(parts, " ")
+}
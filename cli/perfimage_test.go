@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/k8s"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyImageCommand(t *testing.T) {
+	reqs := []imageRequirement{
+		{Name: "present", Check: "true"},
+		{Name: "absent", Check: "false"},
+		{Name: "quoted path", Check: "test -x '/no such/sshd'"},
+	}
+
+	cmd := verifyImageCommand(reqs)
+	require.Equal(t, "sh", cmd[0])
+
+	// The script is valid sh and reports each requirement
+	output, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "ok 0\nmissing 1\nmissing 2\n", string(output))
+}
+
+func TestParseImageVerification(t *testing.T) {
+	reqs := perfImageRequirements("/opt/ssh/sbin/sshd")
+
+	assert.NoError(t, parseImageVerification("ok 0\nok 1\nok 2\nok 3\n", reqs, "perf:latest"))
+
+	err := parseImageVerification("ok 0\nmissing 1\nok 2\n", reqs, "perf:latest")
+	require.EqualError(t, err, "perf image perf:latest is missing sshd (/opt/ssh/sbin/sshd), bash, use a --perf-image providing them or point --sshd-path to sshd")
+}
+
+func TestVerifyPerfImage(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: "missing 0\nok 1\nok 2\nok 3\n"}
+	}}
+	a := &App{logger: zerolog.Nop()}
+	client := k8s.New("", "default", k8s.WithRunner(fake))
+
+	err := a.verifyPerfImage(context.Background(), client, "perfgo-api-0", "custom:1", defaultSSHDPath)
+	require.EqualError(t, err, "perf image custom:1 is missing perf, use a --perf-image providing them or point --sshd-path to sshd")
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, []string{"-n", "default", "exec", "perfgo-api-0", "--", "sh", "-c"}, cmds[0].Args[:7])
+	assert.Contains(t, cmds[0].Args[7], "test -x /usr/sbin/sshd")
+
+	// Images without sh can't be verified
+	fake.Handler = func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: `exec: "sh": executable file not found`, Err: errors.New("exit status 1")}
+	}
+	err = a.verifyPerfImage(context.Background(), client, "perfgo-api-0", "custom:1", defaultSSHDPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to verify perf image custom:1, it needs a POSIX sh")
+}
+
+func TestSSHDProxyCommand(t *testing.T) {
+	assert.Equal(t,
+		"kubectl exec -i -n default perfgo-api-0 -- bash -c '/usr/sbin/sshd -i 2> /dev/null'",
+		sshdProxyCommand(nil, "default", "perfgo-api-0", defaultSSHDPath))
+	assert.Equal(t,
+		`kubectl --kubeconfig '/home/me/my clusters.yaml' --context prod exec -i -n shop perfgo-api-0 -- bash -c ''"'"'/opt/open ssh/sshd'"'"' -i 2> /dev/null'`,
+		sshdProxyCommand([]string{"--kubeconfig", "/home/me/my clusters.yaml", "--context", "prod"}, "shop", "perfgo-api-0", "/opt/open ssh/sshd"))
+}
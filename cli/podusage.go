@@ -0,0 +1,67 @@
+package cli
+
+// This file contains the capture of the resource usage of an attached pod
+// before and after the perf run, which tells whether the pod was CPU
+// throttled or under memory pressure while it was profiled.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/k8s"
+	"github.com/perfgo/perfgo/model"
+)
+
+// podUsageTimeout bounds how long capturing the resource usage may take, it
+// is captured after the perf run when the attach context may have expired.
+const podUsageTimeout = 30 * time.Second
+
+// podResourceUsage returns the current resource usage of the pod, nil if it
+// is not available, e.g. because the cluster runs no metrics-server.
+func (a *App) podResourceUsage(client *k8s.Client, podName string) *model.ResourceUsage {
+	ctx, cancel := context.WithTimeout(context.Background(), podUsageTimeout)
+	defer cancel()
+
+	metrics, err := client.GetPodMetrics(ctx, podName)
+	if err != nil {
+		a.logger.Debug().Err(err).Str("pod", podName).Msg("Resource usage of the pod is not available")
+		return nil
+	}
+	return resourceUsage(metrics)
+}
+
+// resourceUsage converts pod metrics into their history representation.
+func resourceUsage(metrics *k8s.PodMetrics) *model.ResourceUsage {
+	usage := &model.ResourceUsage{
+		CPUMillicores: metrics.CPUMillicores(),
+		MemoryBytes:   metrics.MemoryBytes(),
+	}
+	for _, c := range metrics.Containers {
+		usage.Containers = append(usage.Containers, model.ContainerUsage{
+			Name:          c.Name,
+			CPUMillicores: c.CPUMillicores,
+			MemoryBytes:   c.MemoryBytes,
+		})
+	}
+	return usage
+}
+
+// formatResourceUsage returns the CPU and memory usage before and after the
+// perf run, e.g. "cpu 120m -> 480m, memory 45Mi -> 60Mi". A missing capture
+// is shown as ?.
+func formatResourceUsage(before, after *model.ResourceUsage) string {
+	cpu := func(u *model.ResourceUsage) string {
+		if u == nil {
+			return "?"
+		}
+		return fmt.Sprintf("%dm", u.CPUMillicores)
+	}
+	memory := func(u *model.ResourceUsage) string {
+		if u == nil {
+			return "?"
+		}
+		return fmt.Sprintf("%dMi", u.MemoryBytes>>20)
+	}
+	return fmt.Sprintf("cpu %s -> %s, memory %s -> %s", cpu(before), cpu(after), memory(before), memory(after))
+}
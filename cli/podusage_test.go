@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/k8s"
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceUsage(t *testing.T) {
+	usage := resourceUsage(&k8s.PodMetrics{Pod: "api-0", Containers: []k8s.ContainerMetrics{
+		{Name: "api", CPUMillicores: 120, MemoryBytes: 40 << 20},
+		{Name: "envoy", CPUMillicores: 30, MemoryBytes: 20 << 20},
+	}})
+	assert.Equal(t, &model.ResourceUsage{
+		CPUMillicores: 150,
+		MemoryBytes:   60 << 20,
+		Containers: []model.ContainerUsage{
+			{Name: "api", CPUMillicores: 120, MemoryBytes: 40 << 20},
+			{Name: "envoy", CPUMillicores: 30, MemoryBytes: 20 << 20},
+		},
+	}, usage)
+}
+
+func TestFormatResourceUsage(t *testing.T) {
+	before := &model.ResourceUsage{CPUMillicores: 5, MemoryBytes: 1 << 30}
+	assert.Equal(t, "cpu 5m -> ?, memory 1024Mi -> ?", formatResourceUsage(before, nil))
+	assert.Equal(t, "cpu ? -> 5m, memory ? -> 1024Mi", formatResourceUsage(nil, before))
+}
@@ -0,0 +1,147 @@
+package progress
+
+// Package progress reports the progress of long running transfers, like
+// syncing the working tree or copying binaries, as a single line on a
+// terminal. Reporting is suppressed when the output is not a terminal, so
+// logs and captured output stay clean.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// renderInterval is the minimum time between two renders of a bar.
+const renderInterval = 200 * time.Millisecond
+
+// Bar reports the bytes transferred out of a total. A nil Bar is valid and
+// reports nothing, so callers don't need to check whether reporting is
+// enabled.
+type Bar struct {
+	out   io.Writer
+	label string
+	total atomic.Int64
+	done  atomic.Int64
+
+	mu       sync.Mutex
+	rendered time.Time
+	now      func() time.Time
+}
+
+// New returns a bar writing to out. total may be zero if it's not known yet,
+// see AddTotal.
+func New(out io.Writer, label string, total int64) *Bar {
+	b := &Bar{out: out, label: label, now: time.Now}
+	b.total.Store(total)
+	return b
+}
+
+// ForTerminal returns a bar writing to f, or nil if f is not a terminal.
+func ForTerminal(f *os.File, label string, total int64) *Bar {
+	if !IsTerminal(f) {
+		return nil
+	}
+	return New(f, label, total)
+}
+
+// IsTerminal reports whether f is a character device such as a terminal.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// AddTotal grows the total, for transfers whose parts become known while
+// the transfer runs.
+func (b *Bar) AddTotal(n int64) {
+	if b == nil {
+		return
+	}
+	b.total.Add(n)
+}
+
+// Add records n transferred bytes.
+func (b *Bar) Add(n int64) {
+	if b == nil {
+		return
+	}
+	b.done.Add(n)
+	b.render(false)
+}
+
+// Done renders the final state and ends the line.
+func (b *Bar) Done() {
+	if b == nil {
+		return
+	}
+	b.render(true)
+	b.mu.Lock()
+	fmt.Fprintln(b.out)
+	b.mu.Unlock()
+}
+
+// Writer returns a writer counting the bytes written to w. For a nil Bar it
+// returns w itself.
+func (b *Bar) Writer(w io.Writer) io.Writer {
+	if b == nil {
+		return w
+	}
+	return &countingWriter{w: w, bar: b}
+}
+
+// render prints the progress line, at most every renderInterval unless
+// forced.
+func (b *Bar) render(force bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !force && now.Sub(b.rendered) < renderInterval {
+		return
+	}
+	b.rendered = now
+
+	// Clear the rest of the line, the previous render may have been longer
+	fmt.Fprintf(b.out, "\r%s\x1b[K", Line(b.label, b.done.Load(), b.total.Load()))
+}
+
+// Line formats a progress line, e.g. "Syncing 12.0 MB / 48.0 MB (25%)".
+func Line(label string, done, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s %s", label, FormatBytes(done))
+	}
+	// Estimated totals may be exceeded slightly
+	percent := min(done*100/total, 100)
+	return fmt.Sprintf("%s %s / %s (%d%%)", label, FormatBytes(done), FormatBytes(total), percent)
+}
+
+// FormatBytes formats a byte count for humans, e.g. 1.5 GB.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// countingWriter forwards writes to w and counts them on bar.
+type countingWriter struct {
+	w   io.Writer
+	bar *Bar
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.bar.Add(int64(n))
+	return n, err
+}
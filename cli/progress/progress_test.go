@@ -0,0 +1,107 @@
+package progress
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1536, want: "1.5 KB"},
+		{size: 100 << 20, want: "100.0 MB"},
+		{size: 3 << 30, want: "3.0 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, FormatBytes(tt.size))
+		})
+	}
+}
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		done  int64
+		total int64
+		want  string
+	}{
+		{name: "unknown total", done: 2048, want: "Copying 2.0 KB"},
+		{name: "partial", done: 12 << 20, total: 48 << 20, want: "Copying 12.0 MB / 48.0 MB (25%)"},
+		{name: "estimate exceeded", done: 50 << 20, total: 48 << 20, want: "Copying 50.0 MB / 48.0 MB (100%)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Line("Copying", tt.done, tt.total))
+		})
+	}
+}
+
+func TestBar_Writer(t *testing.T) {
+	var out, dst bytes.Buffer
+	bar := New(&out, "Syncing", 1000)
+	now := time.Unix(0, 0)
+	bar.now = func() time.Time { return now }
+
+	w := bar.Writer(&dst)
+	n, err := w.Write(make([]byte, 300))
+	require.NoError(t, err)
+	assert.Equal(t, 300, n)
+	assert.Equal(t, 300, dst.Len())
+	assert.Equal(t, "\rSyncing 300 B / 1000 B (30%)\x1b[K", out.String())
+
+	// Renders are throttled
+	_, err = w.Write(make([]byte, 200))
+	require.NoError(t, err)
+	assert.Equal(t, "\rSyncing 300 B / 1000 B (30%)\x1b[K", out.String())
+
+	now = now.Add(renderInterval)
+	bar.AddTotal(1000)
+	_, err = w.Write(make([]byte, 500))
+	require.NoError(t, err)
+	assert.Equal(t, "\rSyncing 300 B / 1000 B (30%)\x1b[K\rSyncing 1000 B / 2.0 KB (50%)\x1b[K", out.String())
+
+	out.Reset()
+	bar.Done()
+	assert.Equal(t, "\rSyncing 1000 B / 2.0 KB (50%)\x1b[K\n", out.String())
+	assert.Equal(t, 1000, dst.Len())
+}
+
+func TestForTerminal_NotTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	assert.Nil(t, ForTerminal(f, "Syncing", 100))
+	assert.Nil(t, ForTerminal(w, "Syncing", 100))
+	assert.Nil(t, ForTerminal(nil, "Syncing", 100))
+	assert.False(t, IsTerminal(f))
+}
+
+func TestBar_Nil(t *testing.T) {
+	var bar *Bar
+	var dst bytes.Buffer
+
+	// A nil bar passes writes through without reporting
+	assert.Same(t, &dst, bar.Writer(&dst))
+	bar.AddTotal(10)
+	bar.Add(10)
+	bar.Done()
+}
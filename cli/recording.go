@@ -7,67 +7,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
+	"github.com/perfgo/perfgo/history"
 	"github.com/perfgo/perfgo/model"
 )
 
 // prepareHistoryDir creates the history directory and returns its path.
 // It also updates the history object with git repository information.
-func (a *App) prepareHistoryDir(history *model.History) (string, error) {
-	// Get repository root
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	output, err := cmd.Output()
+func (a *App) prepareHistoryDir(h *model.History) (string, error) {
+	perfgoRoot, err := history.Root(a.outputDir)
 	if err != nil {
-		return "", fmt.Errorf("not in a git repository: %w", err)
+		return "", err
 	}
-	repoRoot := strings.TrimSpace(string(output))
-	repoName := filepath.Base(repoRoot)
 
-	// Store repo name in history
-	if history.Git == nil {
-		history.Git = &model.Git{}
+	// Outside of a git repository the working directory stays absolute and
+	// no git information is recorded
+	if repoRoot, err := history.GitRoot(); err == nil {
+		// Store repo name in history
+		if h.Git == nil {
+			h.Git = &model.Git{}
+		}
+		h.Git.Repo = filepath.Base(repoRoot)
+
+		// Get relative path from repo root
+		relPath := "."
+		if h.WorkDir != "" {
+			if rel, err := filepath.Rel(repoRoot, h.WorkDir); err == nil {
+				relPath = rel
+			}
+		}
+
+		// Update WorkDir to be relative to repo root
+		h.WorkDir = relPath
 	}
-	history.Git.Repo = repoName
 
-	// Get relative path from repo root
-	relPath := "."
-	if history.WorkDir != "" {
-		if rel, err := filepath.Rel(repoRoot, history.WorkDir); err == nil {
-			relPath = rel
-		}
+	// Create directory in <perfgo root>/history/<timestamp>-<commit>-<id>
+	runDir := filepath.Join(perfgoRoot, "history", runDirName(h))
+
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %w", err)
 	}
 
-	// Update WorkDir to be relative to repo root
-	history.WorkDir = relPath
+	return runDir, nil
+}
 
-	// Create directory in .perfgo/history/<timestamp>-<commit>-<id>
-	timestamp := history.Timestamp.Format("20060102-150405")
+// runDirName returns the name of the history directory of a run:
+// <timestamp>-<commit>-<id>.
+func runDirName(h *model.History) string {
+	timestamp := h.Timestamp.Format("20060102-150405")
 	shortCommit := ""
-	if history.Git != nil && history.Git.Commit != "" {
-		shortCommit = history.Git.Commit
+	if h.Git != nil && h.Git.Commit != "" {
+		shortCommit = h.Git.Commit
 		if len(shortCommit) > 8 {
 			shortCommit = shortCommit[:8]
 		}
 	}
-	shortID := history.ID
+	shortID := h.ID
 	if len(shortID) > 8 {
 		shortID = shortID[:8]
 	}
 
-	runName := fmt.Sprintf("%s-%s-%s", timestamp, shortCommit, shortID)
-	runDir := filepath.Join(repoRoot, ".perfgo", "history", runName)
-
-	if err := os.MkdirAll(runDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create run directory: %w", err)
-	}
-
-	return runDir, nil
+	return fmt.Sprintf("%s-%s-%s", timestamp, shortCommit, shortID)
 }
 
 func (a *App) recordHistory(history *model.History, runDir string, testBinaryPath string, stdoutContent string, stderrContent string) error {
+	// Keep the benchmark results of test runs structured
+	if history.Test != nil {
+		history.Test.Benchmarks = parseBenchmarkResults(stdoutContent)
+	}
 
 	// Save stdout as artifact if present
 	if stdoutContent != "" {
@@ -108,6 +116,18 @@ func (a *App) recordHistory(history *model.History, runDir string, testBinaryPat
 	}
 
 	// Write history metadata
+	if err := writeHistoryMetadata(runDir, history); err != nil {
+		return err
+	}
+
+	a.logger.Debug().Str("dir", runDir).Str("id", history.ID).Msg("Recorded history")
+	return nil
+}
+
+// writeHistoryMetadata writes the history.json of a run in the current
+// schema version.
+func writeHistoryMetadata(runDir string, history *model.History) error {
+	history.SchemaVersion = model.HistorySchemaVersion
 	metadataPath := filepath.Join(runDir, "history.json")
 	metadataJSON, err := json.MarshalIndent(history, "", "  ")
 	if err != nil {
@@ -117,7 +137,5 @@ func (a *App) recordHistory(history *model.History, runDir string, testBinaryPat
 	if err := os.WriteFile(metadataPath, metadataJSON, 0644); err != nil {
 		return fmt.Errorf("failed to write history metadata: %w", err)
 	}
-
-	a.logger.Debug().Str("dir", runDir).Str("id", history.ID).Msg("Recorded history")
 	return nil
 }
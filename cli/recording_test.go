@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareHistoryDir_NoGit(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv(history.EnvHome, "")
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	h := &model.History{
+		ID:        "0123456789abcdef",
+		Timestamp: time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC),
+		WorkDir:   cwd,
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	runDir, err := a.prepareHistoryDir(h)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(cwd, ".perfgo", "history", "20250314-092653--01234567"), runDir)
+	assert.DirExists(t, runDir)
+	assert.Nil(t, h.Git)
+	assert.Equal(t, cwd, h.WorkDir)
+}
+
+func TestPrepareHistoryDir_OutputDir(t *testing.T) {
+	outputDir := t.TempDir()
+	t.Setenv(history.EnvHome, "/should/not/be/used")
+
+	h := &model.History{
+		ID:        "0123456789abcdef",
+		Timestamp: time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC),
+		Git:       &model.Git{Commit: "fedcba9876543210"},
+	}
+
+	a := &App{logger: zerolog.Nop(), outputDir: outputDir}
+	runDir, err := a.prepareHistoryDir(h)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(outputDir, "history", "20250314-092653-fedcba98-01234567"), runDir)
+	assert.DirExists(t, runDir)
+}
@@ -0,0 +1,224 @@
+package cli
+
+// This file contains --repeat, which runs a profiled test several times to
+// even out the noise of single runs: the perf stat counters of the runs are
+// aggregated and the profiles of the runs merged.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+	"github.com/perfgo/perfgo/perfstat"
+	"github.com/urfave/cli/v2"
+)
+
+// repeatFlag returns the flag running the test several times.
+func repeatFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:    "repeat",
+		Aliases: []string{"n"},
+		Usage:   "Run the test N times, aggregating the perf stat counters (mean and standard deviation) or merging the profiles of the runs",
+		Value:   1,
+	}
+}
+
+// validateRepeat returns an error if repeat is not a valid --repeat count.
+func validateRepeat(repeat int) error {
+	if repeat < 1 {
+		return fmt.Errorf("invalid --repeat %d: must be at least 1", repeat)
+	}
+	return nil
+}
+
+// runProfileFile returns the name of the profile of the i-th run.
+func runProfileFile(i int) string {
+	return fmt.Sprintf("perf.%d.pb.gz", i)
+}
+
+// runStatFile returns the name of the perf stat counters of the i-th run.
+func runStatFile(i int) string {
+	return fmt.Sprintf("perf-stat.%d.csv", i)
+}
+
+// repeated returns the number of runs of a test, 1 unless --repeat is given.
+func (a *App) repeated() int {
+	return max(a.repeat, 1)
+}
+
+// historyRepeat returns the number of runs recorded in the history, 0 for a
+// single run.
+func (a *App) historyRepeat() int {
+	if a.repeat > 1 {
+		return a.repeat
+	}
+	return 0
+}
+
+// repeatProfile calls run for each --repeat run, which executes the test
+// under perf record and writes the profile of the run to profilePath. A
+// single run writes perf.pb.gz in runDir directly, repeated runs are kept as
+// artifacts and merged into perf.pb.gz.
+func (a *App) repeatProfile(runDir string, history *model.History, run func(profilePath string) error) error {
+	repeat := a.repeated()
+	if repeat == 1 {
+		return run(filepath.Join(runDir, "perf.pb.gz"))
+	}
+
+	var profiles []string
+	for i := 1; i <= repeat; i++ {
+		a.logger.Info().Int("run", i).Int("repeat", repeat).Msg("Starting profiled test run")
+
+		profilePath := filepath.Join(runDir, runProfileFile(i))
+		if err := run(profilePath); err != nil {
+			return err
+		}
+
+		// A run without samples writes no profile
+		info, err := os.Stat(profilePath)
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, profilePath)
+		history.Artifacts = append(history.Artifacts, model.Artifact{
+			Type: model.ArtifactTypePprofProfileRun,
+			Size: uint64(info.Size()),
+			File: runProfileFile(i),
+		})
+	}
+
+	if len(profiles) == 0 {
+		return nil
+	}
+	if err := mergeProfiles(profiles, filepath.Join(runDir, "perf.pb.gz")); err != nil {
+		return err
+	}
+	a.logger.Info().Int("profiles", len(profiles)).Msg("Merged profiles of the runs")
+	return nil
+}
+
+// mergeProfiles writes the merge of the profiles at paths to outputPath. The
+// samples of identical stacks are summed.
+func mergeProfiles(paths []string, outputPath string) error {
+	profiles := make([]*profile.Profile, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read profile: %w", err)
+		}
+		prof, err := profile.ParseData(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse profile %s: %w", filepath.Base(path), err)
+		}
+		profiles = append(profiles, prof)
+	}
+
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return fmt.Errorf("failed to merge profiles: %w", err)
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create merged profile: %w", err)
+	}
+	if err := merged.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write merged profile: %w", err)
+	}
+	return f.Close()
+}
+
+// repeatStat calls run for each --repeat run, which executes the test under
+// perf stat with CSV output and returns its output in stdout and stderr. The
+// counters of each run are kept as artifacts and their mean and standard
+// deviation is printed and saved as the perf stat artifact.
+func (a *App) repeatStat(runDir string, history *model.History, detail bool, stdout, stderr *string, run func(stdout, stderr *string) error) error {
+	repeat := a.repeated()
+
+	var runs [][]perfstat.Counter
+	var stdoutAll, stderrAll strings.Builder
+	defer func() {
+		*stdout = stdoutAll.String()
+		*stderr = stderrAll.String()
+	}()
+
+	for i := 1; i <= repeat; i++ {
+		a.logger.Info().Int("run", i).Int("repeat", repeat).Msg("Starting perf stat test run")
+
+		var runStdout, runStderr string
+		err := run(&runStdout, &runStderr)
+		stdoutAll.WriteString(runStdout)
+		stderrAll.WriteString(runStderr)
+		if err != nil {
+			return err
+		}
+
+		counters := perfstat.ParseCSV(runStderr)
+		if len(counters) == 0 {
+			history.Warnings = append(history.Warnings, fmt.Sprintf("run %d reported no perf stat counters", i))
+			continue
+		}
+		runs = append(runs, counters)
+		if err := a.saveStatRun(runDir, history, i, counters); err != nil {
+			a.logger.Warn().Err(err).Int("run", i).Msg("Failed to save perf stat counters of the run")
+		}
+	}
+
+	if len(runs) == 0 {
+		return errors.New("no perf stat counters found in the output of the runs")
+	}
+
+	var summary bytes.Buffer
+	if err := perfstat.WriteSummaries(&summary, perfstat.Aggregate(runs), len(runs)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "\n%s", summary.String())
+
+	return a.saveStatArtifact(runDir, history, summary.String(), detail)
+}
+
+// saveStatRun writes the counters of the i-th run to runDir and registers
+// them as artifact.
+func (a *App) saveStatRun(runDir string, history *model.History, i int, counters []perfstat.Counter) error {
+	var buf bytes.Buffer
+	if err := perfstat.WriteCSV(&buf, counters); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(runDir, runStatFile(i)), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write perf stat counters: %w", err)
+	}
+	history.Artifacts = append(history.Artifacts, model.Artifact{
+		Type: model.ArtifactTypePerfStatRun,
+		Size: uint64(buf.Len()),
+		File: runStatFile(i),
+	})
+	return nil
+}
+
+// registerBinaryArtifacts adds the binaries copied for a profile to the
+// artifacts of history, skipping binaries registered by an earlier run.
+func registerBinaryArtifacts(history *model.History, binaries []perf.BinaryArtifact) {
+	registered := make(map[string]bool, len(history.Artifacts))
+	for _, artifact := range history.Artifacts {
+		registered[artifact.File] = true
+	}
+	for _, binArtifact := range binaries {
+		if registered[binArtifact.LocalPath] {
+			continue
+		}
+		registered[binArtifact.LocalPath] = true
+		history.Artifacts = append(history.Artifacts, model.Artifact{
+			Type:    model.ArtifactTypeTestBinary,
+			Size:    binArtifact.Size,
+			File:    binArtifact.LocalPath,
+			BuildID: binArtifact.BuildID,
+		})
+	}
+}
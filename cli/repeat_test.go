@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRunProfile writes a profile with a sample of value in each of the
+// functions named by funcs to path.
+func writeRunProfile(t *testing.T, path string, value int64, funcs ...string) {
+	t.Helper()
+	mapping := &profile.Mapping{ID: 1, Start: 0x1000, Limit: 0x2000, File: "/tmp/perfgo.test"}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping:    []*profile.Mapping{mapping},
+	}
+	for i, name := range funcs {
+		fn := &profile.Function{ID: uint64(i + 1), Name: name}
+		loc := &profile.Location{ID: uint64(i + 1), Mapping: mapping, Address: 0x1000 + uint64(i), Line: []profile.Line{{Function: fn}}}
+		prof.Function = append(prof.Function, fn)
+		prof.Location = append(prof.Location, loc)
+		prof.Sample = append(prof.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{value}})
+	}
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+}
+
+// functionValues returns the summed sample values by function of the profile
+// at path.
+func functionValues(t *testing.T, path string) map[string]int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	prof, err := profile.ParseData(data)
+	require.NoError(t, err)
+
+	values := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		values[sample.Location[0].Line[0].Function.Name] += sample.Value[0]
+	}
+	return values
+}
+
+func TestValidateRepeat(t *testing.T) {
+	assert.NoError(t, validateRepeat(1))
+	assert.NoError(t, validateRepeat(5))
+	assert.Error(t, validateRepeat(0))
+	assert.Error(t, validateRepeat(-2))
+}
+
+func TestMergeProfiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "perf.1.pb.gz")
+	second := filepath.Join(dir, "perf.2.pb.gz")
+	writeRunProfile(t, first, 3, "main.hot", "main.cold")
+	writeRunProfile(t, second, 4, "main.hot")
+
+	merged := filepath.Join(dir, "perf.pb.gz")
+	require.NoError(t, mergeProfiles([]string{first, second}, merged))
+
+	// Samples of identical stacks are summed
+	assert.Equal(t, map[string]int64{"main.hot": 7, "main.cold": 3}, functionValues(t, merged))
+}
+
+func TestRepeatProfile(t *testing.T) {
+	runDir := t.TempDir()
+	a := &App{logger: zerolog.Nop(), runState: runState{repeat: 3}}
+	h := &model.History{}
+
+	var paths []string
+	err := a.repeatProfile(runDir, h, func(profilePath string) error {
+		paths = append(paths, profilePath)
+		// The second run has no samples and writes no profile
+		if len(paths) != 2 {
+			writeRunProfile(t, profilePath, int64(len(paths)), "main.hot")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(runDir, "perf.1.pb.gz"),
+		filepath.Join(runDir, "perf.2.pb.gz"),
+		filepath.Join(runDir, "perf.3.pb.gz"),
+	}, paths)
+	require.Len(t, h.Artifacts, 2)
+	assert.Equal(t, model.ArtifactTypePprofProfileRun, h.Artifacts[0].Type)
+	assert.Equal(t, "perf.1.pb.gz", h.Artifacts[0].File)
+	assert.Equal(t, "perf.3.pb.gz", h.Artifacts[1].File)
+	assert.Equal(t, map[string]int64{"main.hot": 4}, functionValues(t, filepath.Join(runDir, "perf.pb.gz")))
+}
+
+func TestRepeatProfile_Single(t *testing.T) {
+	runDir := t.TempDir()
+	a := &App{logger: zerolog.Nop()}
+	h := &model.History{}
+
+	var paths []string
+	require.NoError(t, a.repeatProfile(runDir, h, func(profilePath string) error {
+		paths = append(paths, profilePath)
+		return nil
+	}))
+	assert.Equal(t, []string{filepath.Join(runDir, "perf.pb.gz")}, paths)
+	assert.Empty(t, h.Artifacts)
+}
+
+func TestRepeatStat(t *testing.T) {
+	runDir := t.TempDir()
+	a := &App{logger: zerolog.Nop(), runState: runState{repeat: 3}}
+	h := &model.History{}
+
+	runs := 0
+	var stdout, stderr string
+	err := a.repeatStat(runDir, h, false, &stdout, &stderr, func(stdout, stderr *string) error {
+		runs++
+		*stdout = "PASS\n"
+		*stderr = fmt.Sprintf("%d,,cycles,1000,100.00,,\n10,msec,task-clock,1000,100.00,1.0,CPUs utilized\n", runs*100)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "PASS\nPASS\nPASS\n", stdout)
+	assert.Contains(t, stderr, "300,,cycles")
+
+	var files []string
+	for _, artifact := range h.Artifacts {
+		files = append(files, artifact.File)
+	}
+	assert.Equal(t, []string{"perf-stat.1.csv", "perf-stat.2.csv", "perf-stat.3.csv", "perf-stat.txt"}, files)
+	assert.Equal(t, model.ArtifactTypePerfStatRun, h.Artifacts[0].Type)
+	assert.Equal(t, model.ArtifactTypePerfStat, h.Artifacts[3].Type)
+
+	summary, err := os.ReadFile(filepath.Join(runDir, "perf-stat.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "(3 runs)")
+	assert.Regexp(t, `200\.00\s+cycles\s+\+- 50\.00%`, string(summary))
+	assert.Regexp(t, `10\.00\s+msec\s+task-clock\s+\+- 0\.00%`, string(summary))
+}
+
+func TestRepeatStat_RunFails(t *testing.T) {
+	a := &App{logger: zerolog.Nop(), runState: runState{repeat: 3}}
+	h := &model.History{}
+
+	runs := 0
+	var stdout, stderr string
+	err := a.repeatStat(t.TempDir(), h, false, &stdout, &stderr, func(stdout, stderr *string) error {
+		runs++
+		*stdout = fmt.Sprintf("run %d\n", runs)
+		if runs == 2 {
+			return fmt.Errorf("tests failed with exit code 1")
+		}
+		return nil
+	})
+	require.Error(t, err)
+	assert.Equal(t, 2, runs)
+	// The output of all runs so far is kept
+	assert.Equal(t, "run 1\nrun 2\n", stdout)
+}
+
+func TestRegisterBinaryArtifacts(t *testing.T) {
+	h := &model.History{}
+	binaries := []perf.BinaryArtifact{{LocalPath: "abc.perfgo.test.binary", Size: 10, BuildID: "ff"}}
+
+	registerBinaryArtifacts(h, binaries)
+	registerBinaryArtifacts(h, binaries)
+	assert.Equal(t, []model.Artifact{
+		{Type: model.ArtifactTypeTestBinary, Size: 10, File: "abc.perfgo.test.binary", BuildID: "ff"},
+	}, h.Artifacts)
+}
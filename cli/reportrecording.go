@@ -0,0 +1,249 @@
+package cli
+
+// This file contains the recording of the report modes, perf c2c and perf
+// mem, which record the workload, create a text report of the recording and
+// register it with the history entry of the run.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+)
+
+// reportRecording holds what differs between recording perf c2c and perf
+// mem: the record command, the report and its artifact type.
+type reportRecording struct {
+	name         string             // perf subcommand, "c2c" or "mem"
+	artifactType model.ArtifactType // Type of the report artifact
+	outputPath   string             // perf.data written by the recording
+	pids         []string           // Process IDs recorded, if attaching
+	duration     int                // Duration in seconds, if attaching
+
+	recordArgs    []string // perf arguments for local execution
+	recordCommand string   // perf command for remote execution
+
+	// logFields adds the mode's record options to a log event
+	logFields func(e *zerolog.Event)
+	// convert creates the report of a local perf.data in runDir
+	convert func(logger zerolog.Logger, perfDataPath, runDir, historyID string) (string, error)
+	// process creates the report of remoteBaseDir/perf.data in runDir
+	process func(logger zerolog.Logger, client *ssh.Client, remoteBaseDir, runDir, historyID string) (string, error)
+}
+
+// c2cRecording returns the recording of perf c2c with opts, which name the
+// workload and output path, reported with reportOpts.
+func c2cRecording(opts perf.C2COptions, reportOpts perf.C2CReportOptions) reportRecording {
+	return reportRecording{
+		name:          "c2c",
+		artifactType:  model.ArtifactTypePerfC2CReport,
+		outputPath:    opts.OutputPath,
+		pids:          opts.PIDs,
+		duration:      opts.Duration,
+		recordArgs:    perf.BuildC2CRecordArgs(opts),
+		recordCommand: perf.BuildC2CRecordCommand(opts),
+		logFields: func(e *zerolog.Event) {
+			if opts.Event != "" {
+				e.Str("event", opts.Event)
+				if opts.Count > 0 {
+					e.Int("count", opts.Count)
+				}
+			}
+		},
+		convert: func(logger zerolog.Logger, perfDataPath, runDir, historyID string) (string, error) {
+			return perf.ConvertPerfC2CToReport(logger, perfDataPath, runDir, reportOpts, historyID)
+		},
+		process: func(logger zerolog.Logger, client *ssh.Client, remoteBaseDir, runDir, historyID string) (string, error) {
+			return perf.ProcessC2CData(logger, client, remoteBaseDir, runDir, reportOpts, historyID)
+		},
+	}
+}
+
+// memRecording returns the recording of perf mem with opts, which name the
+// workload and output path, reported with reportOpts.
+func memRecording(opts perf.MemOptions, reportOpts perf.MemReportOptions) reportRecording {
+	return reportRecording{
+		name:          "mem",
+		artifactType:  model.ArtifactTypePerfMemReport,
+		outputPath:    opts.OutputPath,
+		pids:          opts.PIDs,
+		duration:      opts.Duration,
+		recordArgs:    perf.BuildMemRecordArgs(opts),
+		recordCommand: perf.BuildMemRecordCommand(opts),
+		logFields: func(e *zerolog.Event) {
+			if opts.Type != "" {
+				e.Str("type", opts.Type)
+			}
+			if opts.Event != "" {
+				e.Str("event", opts.Event)
+			}
+			if opts.LoadLatency > 0 {
+				e.Int("ldlat", opts.LoadLatency)
+			}
+		},
+		convert: func(logger zerolog.Logger, perfDataPath, runDir, historyID string) (string, error) {
+			return perf.ConvertPerfMemToReport(logger, perfDataPath, runDir, reportOpts, historyID)
+		},
+		process: func(logger zerolog.Logger, client *ssh.Client, remoteBaseDir, runDir, historyID string) (string, error) {
+			return perf.ProcessMemData(logger, client, remoteBaseDir, runDir, reportOpts, historyID)
+		},
+	}
+}
+
+// recordLocalReport runs the test binary under rec on this machine and saves
+// the report and the recording to runDir.
+func (a *App) recordLocalReport(rec reportRecording, runDir string, history *model.History, stdout, stderr *string) error {
+	a.logger.Debug().
+		Strs("perf_args", rec.recordArgs).
+		Msgf("Starting local test execution with perf %s", rec.name)
+
+	cmd := a.localTestCommand("perf", rec.recordArgs...)
+
+	logMsg := a.logger.Info()
+	rec.logFields(logMsg)
+	logMsg.Msgf("Wrapping test execution with perf %s record", rec.name)
+
+	// Capture stdout and stderr for history
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	// Create multi-writers to both capture and display output
+	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
+
+	err := a.cmdRunner().Stream(context.Background(), cmd)
+	*stdout = stdoutBuf.String()
+	*stderr = stderrBuf.String()
+	if err != nil {
+		err = a.testRunError(err, *stderr, "", true)
+		a.logger.Error().Err(err).Msg("Local test execution failed")
+		return err
+	}
+
+	a.logger.Info().Str("output", rec.outputPath).Msgf("perf %s data collected", rec.name)
+	a.logger.Info().Msg("Tests completed successfully")
+
+	reportFilename, err := rec.convert(a.logger, rec.outputPath, runDir, history.ID)
+	if err != nil {
+		a.logger.Error().Err(err).Msgf("Failed to generate %s report", rec.name)
+		return err
+	}
+	a.savePerfData(nil, rec.outputPath, runDir, history)
+	a.registerReport(rec, runDir, reportFilename, history)
+	return nil
+}
+
+// recordRemoteReport runs the synced test binary under rec in the directory
+// of packagePath within remoteDir on the remote host and saves the report and
+// the recording to runDir. rec writes its recording to remoteBaseDir.
+func (a *App) recordRemoteReport(sshClient *ssh.Client, rec reportRecording, remoteDir, remoteBaseDir, packagePath, runDir string, history *model.History, stdout, stderr *string) error {
+	// Construct the full working directory path
+	workDir, err := remoteWorkDir(remoteDir, packagePath)
+	if err != nil {
+		return err
+	}
+
+	a.logger.Debug().
+		Str("host", sshClient.Host()).
+		Str("sync_dir", remoteDir).
+		Str("work_dir", workDir).
+		Str("package", packagePath).
+		Str("command", rec.recordCommand).
+		Msgf("Starting remote test execution with perf %s", rec.name)
+
+	remoteCmd := a.remoteTestCommand(workDir, rec.recordCommand)
+
+	logMsg := a.logger.Info().
+		Str("output", rec.outputPath)
+	rec.logFields(logMsg)
+	logMsg.Msgf("Wrapping remote test execution with perf %s record", rec.name)
+
+	// Capture stdout and stderr for history
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	// Create multi-writers to both capture and display output
+	stdoutWriter := io.MultiWriter(os.Stdout, &stdoutBuf)
+	stderrWriter := io.MultiWriter(os.Stderr, &stderrBuf)
+
+	// Execute the test binary remotely with signal handling
+	err = a.runRemoteCommandWithSignalHandling(sshClient, remoteCmd, remotePIDFile(sshClient, remoteBaseDir), stdoutWriter, stderrWriter)
+	*stdout = stdoutBuf.String()
+	*stderr = stderrBuf.String()
+	if err != nil {
+		err = a.testRunError(err, *stderr, sshClient.Host(), true)
+		a.logger.Error().Err(err).Msg("Remote test execution failed")
+		return err
+	}
+
+	a.logger.Info().
+		Str("output", rec.outputPath).
+		Msgf("perf %s data collected on remote host", rec.name)
+	a.logger.Info().Msg("Tests completed successfully")
+
+	reportFilename, err := rec.process(a.logger, sshClient, remoteBaseDir, runDir, history.ID)
+	if err != nil {
+		a.logger.Error().Err(err).Msgf("Failed to process %s data", rec.name)
+		return err
+	}
+	a.savePerfData(sshClient, rec.outputPath, runDir, history)
+	a.registerReport(rec, runDir, reportFilename, history)
+	return nil
+}
+
+// recordAttachReport runs rec on the attached processes via SSH and saves the
+// report and the recording to runDir. rec writes its recording to remoteDir.
+func (a *App) recordAttachReport(ctx context.Context, client *ssh.Client, rec reportRecording, remoteDir, runDir string, history *model.History) error {
+	logEvent := a.logger.Info().
+		Strs("pids", rec.pids).
+		Int("duration", rec.duration)
+	rec.logFields(logEvent)
+	logEvent.Msgf("Running perf %s record on PIDs", rec.name)
+
+	a.logger.Debug().Str("command", rec.recordCommand).Msgf("Executing perf %s record command", rec.name)
+
+	output, _, err := client.RunCommandContext(ctx, rec.recordCommand)
+	if err != nil {
+		return fmt.Errorf("perf %s record failed: %w", rec.name, err)
+	}
+
+	// Display the output
+	if output != "" {
+		fmt.Println(output)
+	}
+
+	a.logger.Info().
+		Str("remote_path", rec.outputPath).
+		Msgf("perf %s data collected on remote host", rec.name)
+
+	reportFilename, err := rec.process(a.logger, client, remoteDir, runDir, history.ID)
+	if err != nil {
+		return fmt.Errorf("failed to process %s data: %w", rec.name, err)
+	}
+	a.savePerfData(client, rec.outputPath, runDir, history)
+	a.registerReport(rec, runDir, reportFilename, history)
+	return nil
+}
+
+// registerReport adds the report reportFilename in runDir to the artifacts
+// of history. A report that can't be found is left out.
+func (a *App) registerReport(rec reportRecording, runDir, reportFilename string, history *model.History) {
+	reportInfo, err := os.Stat(filepath.Join(runDir, reportFilename))
+	if err != nil {
+		return
+	}
+	history.Artifacts = append(history.Artifacts, model.Artifact{
+		Type: rec.artifactType,
+		Size: uint64(reportInfo.Size()),
+		File: reportFilename,
+	})
+	a.logger.Debug().
+		Str("report", reportFilename).
+		Uint64("size", uint64(reportInfo.Size())).
+		Msgf("Registered %s report artifact", rec.name)
+}
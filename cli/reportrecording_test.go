@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportRecordings(t *testing.T) {
+	c2c := c2cRecording(perf.C2COptions{
+		Event:      "ldlat-loads",
+		OutputPath: "/cache/perf.data",
+		Binary:     "./pkg.test",
+		Args:       []string{"-test.run", "Test Foo"},
+	}, perf.C2CReportOptions{})
+	assert.Equal(t, "c2c", c2c.name)
+	assert.Equal(t, model.ArtifactTypePerfC2CReport, c2c.artifactType)
+	assert.Equal(t, "/cache/perf.data", c2c.outputPath)
+	assert.Equal(t, []string{"c2c", "record", "-e", "ldlat-loads", "-o", "/cache/perf.data", "--", "./pkg.test", "-test.run", "Test Foo"}, c2c.recordArgs)
+	assert.Equal(t, "perf c2c record -e ldlat-loads -o /cache/perf.data -- ./pkg.test -test.run 'Test Foo'", c2c.recordCommand)
+
+	mem := memRecording(perf.MemOptions{
+		Type:       perf.MemTypeLoad,
+		PIDs:       []string{"1", "2"},
+		Duration:   5,
+		OutputPath: "/cache/perf.data",
+	}, perf.MemReportOptions{})
+	assert.Equal(t, "mem", mem.name)
+	assert.Equal(t, model.ArtifactTypePerfMemReport, mem.artifactType)
+	assert.Equal(t, []string{"1", "2"}, mem.pids)
+	assert.Equal(t, 5, mem.duration)
+	assert.Equal(t, []string{"mem", "record", "-e", "ldlat-loads", "-o", "/cache/perf.data", "-p", "1,2", "sleep", "5"}, mem.recordArgs)
+}
+
+func TestRegisterReport(t *testing.T) {
+	runDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "mem-report.txt"), []byte("report"), 0o600))
+
+	a := &App{logger: zerolog.Nop()}
+	rec := memRecording(perf.MemOptions{}, perf.MemReportOptions{})
+	h := &model.History{}
+	a.registerReport(rec, runDir, "mem-report.txt", h)
+	assert.Equal(t, []model.Artifact{{Type: model.ArtifactTypePerfMemReport, Size: 6, File: "mem-report.txt"}}, h.Artifacts)
+
+	// A missing report is not registered
+	a.registerReport(rec, runDir, "c2c-report.txt", h)
+	assert.Len(t, h.Artifacts, 1)
+}
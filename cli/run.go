@@ -0,0 +1,127 @@
+package cli
+
+// run.go contains the options of a test run, so runs can be started
+// programmatically as well as through the test subcommands.
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+)
+
+// Option configures an App created by New.
+type Option func(*App)
+
+// WithLogger sets the logger of the App.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(a *App) {
+		a.logger = logger
+	}
+}
+
+// WithOutputDir sets the directory holding the history, like --output-dir.
+func WithOutputDir(dir string) Option {
+	return func(a *App) {
+		a.outputDir = dir
+	}
+}
+
+// WithRunner sets the runner executing local commands.
+func WithRunner(r runner.Runner) Option {
+	return func(a *App) {
+		a.runner = r
+	}
+}
+
+// TestOptions configures a test run. The fields correspond to the flags of
+// the test subcommands, options of other perf modes than Mode are rejected.
+type TestOptions struct {
+	// Perf mode: "" runs the tests only, "profile", "stat", "c2c", "mem",
+	// "cpuprofile" or "mprofile", the latter record Go profiles without perf
+	Mode string
+	// Package path or pattern, followed by build flags and test arguments
+	Args []string
+
+	RemoteHost   string // Run on this host over SSH, locally if empty
+	GOOS         string // Cross-compile for GOOS/GOARCH and run locally
+	GOARCH       string
+	BatchID      string // Shared by the runs of a --matrix
+	Keep         bool   // Keep the remote artifacts
+	KeepPerfData bool   // Archive the raw perf.data
+	// Remove the intermediate files of a local run and exit on SIGINT and
+	// SIGTERM, and stop a remote run on them. Only set this when perfgo owns
+	// the process, the test subcommands do.
+	HandleInterrupts bool
+
+	// profile, Folded and Output apply to cpuprofile as well
+	Event         string
+	Count         int
+	MaxDuration   time.Duration
+	BranchStack   bool
+	BranchFilter  string
+	CallGraphAuto bool
+	DefaultEvent  string
+	Folded        bool
+	Output        perf.OutputFormat
+	Symbols       []string // NAME=PATH or PATH of symbol files
+
+	// stat
+	Events      []string
+	Detail      bool
+	Aggregation perf.StatAggregation
+	PerfRepeat  int
+
+	// Number of runs of profile and stat, at least 1
+	Repeat int
+
+	// c2c
+	C2CEvent string
+	C2CCount int
+
+	// mem
+	Mem     perf.MemOptions
+	MemSort string
+
+	// mprofile, bytes per sampled allocation
+	MemProfileRate int
+
+	Env          []string // KEY=VALUE environment of the test
+	GOMAXPROCS   int
+	BuildEnv     []string // KEY=VALUE environment of go test -c
+	CGO          bool
+	NoBuildCache bool
+	CPUAffinity  string
+
+	Bench     string
+	Benchtime string
+	Benchmem  bool
+
+	PerfDataInCWD bool
+	MetricsOut    string // Write the metrics of the run in the Prometheus text format
+	Copy          perf.CopyOptions
+	SSH           []ssh.SSHOption
+	Sync          []ssh.SyncOption
+}
+
+// TestResult is the outcome of a test run.
+type TestResult struct {
+	History *model.History
+	// Directory of the run in the history
+	RunDir string
+	// Paths of the artifacts in RunDir
+	Artifacts []string
+}
+
+// newTestResult returns the result of the run recorded in runDir.
+func newTestResult(h *model.History, runDir string) *TestResult {
+	result := &TestResult{History: h, RunDir: runDir}
+	for _, artifact := range h.Artifacts {
+		result.Artifacts = append(result.Artifacts, filepath.Join(runDir, artifact.File))
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package runner
+
+// fake.go contains a Runner for tests which records commands instead of
+// running them.
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Result is the outcome of a command run by Fake.
+type Result struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// Fake is a Runner for tests. It records every command and answers with the
+// Result returned by Handler, writing its output to the command's streams.
+type Fake struct {
+	// Handler returns the result of cmd. A nil Handler lets every command
+	// succeed without output.
+	Handler func(cmd Cmd) Result
+
+	mu   sync.Mutex
+	cmds []Cmd
+}
+
+// Run implements Runner.
+func (f *Fake) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	return run(ctx, f, name, args...)
+}
+
+// Stream implements Runner.
+func (f *Fake) Stream(ctx context.Context, cmd Cmd) error {
+	f.mu.Lock()
+	f.cmds = append(f.cmds, cmd)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.Handler == nil {
+		return nil
+	}
+
+	result := f.Handler(cmd)
+	if cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, result.Stdout); err != nil {
+			return err
+		}
+	}
+	if cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, result.Stderr); err != nil {
+			return err
+		}
+	}
+	return result.Err
+}
+
+// Commands returns the commands run so far.
+func (f *Fake) Commands() []Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Cmd{}, f.cmds...)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package runner
+
+import "os/exec"
+
+// setProcessGroup is a no-op, process groups are a unix concept.
+func setProcessGroup(c *exec.Cmd) {}
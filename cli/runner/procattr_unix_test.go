@@ -0,0 +1,33 @@
+//go:build unix
+
+package runner
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec_NewProcessGroup(t *testing.T) {
+	pgid := func(group bool) int {
+		var stdout strings.Builder
+		err := Exec{}.Stream(context.Background(), Cmd{
+			Name:            "sh",
+			Args:            []string{"-c", "ps -o pgid= -p $$"},
+			Stdout:          &stdout,
+			NewProcessGroup: group,
+		})
+		require.NoError(t, err)
+		id, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+		require.NoError(t, err)
+		return id
+	}
+
+	assert.Equal(t, syscall.Getpgrp(), pgid(false))
+	assert.NotEqual(t, syscall.Getpgrp(), pgid(true))
+}
@@ -0,0 +1,86 @@
+package runner
+
+// Package runner abstracts running local commands, so code shelling out to
+// tools like git, go, ssh, kubectl or perf can be tested with a fake instead
+// of requiring the real tools.
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Cmd describes a command to run.
+type Cmd struct {
+	Name       string        // Program to run, looked up in PATH
+	Args       []string      // Arguments, not including the program name
+	Dir        string        // Working directory, empty for the current directory
+	Env        []string      // Environment, nil inherits perfgo's environment
+	Stdin      io.Reader     // Standard input, nil for no input
+	Stdout     io.Writer     // Standard output, nil discards it
+	Stderr     io.Writer     // Standard error, nil discards it
+	ExtraFiles []*os.File    // Open files passed as fd 3 and up
+	WaitDelay  time.Duration // How long to wait for the streams after the process exited or was killed
+	// Start the process in its own process group, so signals sent by the
+	// terminal (e.g. on Ctrl-C) reach only perfgo, which then stops it
+	NewProcessGroup bool
+}
+
+// String returns the command line, for logging.
+func (c Cmd) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Runner runs commands.
+type Runner interface {
+	// Run runs name with args and returns its standard output and error.
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr string, err error)
+	// Stream runs cmd with its streams connected to the readers and writers
+	// given in cmd.
+	Stream(ctx context.Context, cmd Cmd) error
+}
+
+// Exec runs commands as local processes using os/exec. A process that exits
+// with a non-zero status returns an *exec.ExitError. The process is killed
+// when the context is done.
+type Exec struct{}
+
+// Default is the Runner used when none is configured.
+var Default Runner = Exec{}
+
+// Run implements Runner.
+func (e Exec) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	return run(ctx, e, name, args...)
+}
+
+// Stream implements Runner.
+func (Exec) Stream(ctx context.Context, cmd Cmd) error {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Env = cmd.Env
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	c.ExtraFiles = cmd.ExtraFiles
+	c.WaitDelay = cmd.WaitDelay
+	if cmd.NewProcessGroup {
+		setProcessGroup(c)
+	}
+	return c.Run()
+}
+
+// run implements Run on top of the Stream method of r.
+func run(ctx context.Context, r Runner, name string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := r.Stream(ctx, Cmd{
+		Name:   name,
+		Args:   args,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	return stdout.String(), stderr.String(), err
+}
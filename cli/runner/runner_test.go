@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec_Run(t *testing.T) {
+	stdout, stderr, err := Exec{}.Run(context.Background(), "sh", "-c", "echo out; echo err >&2")
+	require.NoError(t, err)
+	assert.Equal(t, "out\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+
+	_, _, err = Exec{}.Run(context.Background(), "sh", "-c", "exit 3")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+}
+
+func TestExec_Stream(t *testing.T) {
+	dir := t.TempDir()
+	var stdout bytes.Buffer
+	err := Exec{}.Stream(context.Background(), Cmd{
+		Name:   "sh",
+		Args:   []string{"-c", `pwd; echo "$PERFGO_RUNNER"; cat`},
+		Dir:    dir,
+		Env:    []string{"PERFGO_RUNNER=set"},
+		Stdin:  strings.NewReader("input\n"),
+		Stdout: &stdout,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, dir+"\nset\ninput\n", stdout.String())
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{Handler: func(cmd Cmd) Result {
+		if cmd.Name == "git" {
+			return Result{Stdout: "main\n"}
+		}
+		return Result{Stderr: "not found", Err: errors.New("exit status 1")}
+	}}
+
+	stdout, _, err := f.Run(context.Background(), "git", "rev-parse", "--abbrev-ref", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "main\n", stdout)
+
+	var stderr bytes.Buffer
+	err = f.Stream(context.Background(), Cmd{Name: "perf", Args: []string{"list"}, Stderr: &stderr})
+	require.Error(t, err)
+	assert.Equal(t, "not found", stderr.String())
+
+	cmds := f.Commands()
+	require.Len(t, cmds, 2)
+	assert.Equal(t, "git rev-parse --abbrev-ref HEAD", cmds[0].String())
+	assert.Equal(t, "perf list", cmds[1].String())
+}
+
+func TestFake_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f := &Fake{}
+	_, _, err := f.Run(ctx, "sleep", "1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, f.Commands(), 1)
+}
@@ -0,0 +1,86 @@
+package cli
+
+// This file contains --default-event, the sample type a multi-event profile
+// opens with in view unless -sample_index is given.
+
+import (
+	"os"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultEventFlag returns the flag selecting the event view shows first.
+func defaultEventFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "default-event",
+		Usage: "Event shown by default when viewing a profile of multiple events, e.g. instructions for --event cycles,instructions",
+	}
+}
+
+// sampleType returns the sample type of prof recorded for event. perf script
+// names sample types after the event including its modifiers, e.g.
+// cycles:u, which matches cycles.
+func sampleType(prof *profile.Profile, event string) (string, bool) {
+	for _, st := range prof.SampleType {
+		if st.Type == event {
+			return st.Type, true
+		}
+	}
+	for _, st := range prof.SampleType {
+		if name, _, _ := strings.Cut(st.Type, ":"); name == event {
+			return st.Type, true
+		}
+	}
+	return "", false
+}
+
+// sampleIndexArgs returns the pprof arguments selecting the sample type of
+// event, followed by pprofArgs. pprofArgs are returned unchanged if they
+// select a sample type themselves, or if no sample type matches event.
+func sampleIndexArgs(pprofArgs []string, prof *profile.Profile, event string) []string {
+	if event == "" || hasPprofFlag(pprofArgs, "sample_index") {
+		return pprofArgs
+	}
+	st, ok := sampleType(prof, event)
+	if !ok {
+		return pprofArgs
+	}
+	return append([]string{"-sample_index=" + st}, pprofArgs...)
+}
+
+// defaultSampleIndex returns pprofArgs selecting the default event of the
+// run h for the profile at profilePath.
+func (a *App) defaultSampleIndex(h *model.History, profilePath string, pprofArgs []string) []string {
+	if h.Perf == nil || h.Perf.Record == nil || h.Perf.Record.DefaultEvent == "" {
+		return pprofArgs
+	}
+	event := h.Perf.Record.DefaultEvent
+
+	f, err := os.Open(profilePath)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to open profile, not selecting the default event")
+		return pprofArgs
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to parse profile, not selecting the default event")
+		return pprofArgs
+	}
+
+	if _, ok := sampleType(prof, event); !ok {
+		types := make([]string, 0, len(prof.SampleType))
+		for _, st := range prof.SampleType {
+			types = append(types, st.Type)
+		}
+		a.logger.Warn().
+			Str("default_event", event).
+			Strs("sample_types", types).
+			Msg("Profile has no samples of the default event")
+		return pprofArgs
+	}
+	return sampleIndexArgs(pprofArgs, prof, event)
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleIndexArgs(t *testing.T) {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "cycles:u", Unit: "count"},
+			{Type: "instructions:u", Unit: "count"},
+			{Type: "instructions", Unit: "count"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pprofArgs []string
+		event     string
+		want      []string
+	}{
+		{name: "no default event", pprofArgs: []string{"-top"}, want: []string{"-top"}},
+		{name: "event with modifier", event: "cycles", pprofArgs: []string{"-top"}, want: []string{"-sample_index=cycles:u", "-top"}},
+		{name: "exact match first", event: "instructions", want: []string{"-sample_index=instructions"}},
+		{name: "full sample type", event: "instructions:u", want: []string{"-sample_index=instructions:u"}},
+		{name: "unknown event", event: "cache-misses", pprofArgs: []string{"-top"}, want: []string{"-top"}},
+		{name: "explicit sample index", event: "cycles", pprofArgs: []string{"-sample_index=1", "-top"}, want: []string{"-sample_index=1", "-top"}},
+		{name: "explicit sample index as separate argument", event: "cycles", pprofArgs: []string{"--sample_index", "instructions"}, want: []string{"--sample_index", "instructions"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sampleIndexArgs(tt.pprofArgs, prof, tt.event))
+		})
+	}
+}
+
+func TestDisplayProfile_DefaultEvent(t *testing.T) {
+	runDir := t.TempDir()
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "cycles:u", Unit: "count"},
+			{Type: "instructions:u", Unit: "count"},
+		},
+	}
+	profilePath := filepath.Join(runDir, "perf.pb.gz")
+	f, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	entry := &history.Entry{
+		FullPath: runDir,
+		History: model.History{
+			ID:        "0123456789abcdef",
+			Timestamp: time.Now(),
+			Perf: &model.Perf{
+				Record: &model.PerfRecord{Event: "cycles,instructions", DefaultEvent: "instructions"},
+			},
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypePprofProfile, File: "perf.pb.gz"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pprofArgs []string
+		want      []string
+	}{
+		{
+			name: "default event",
+			want: []string{"-sample_index=instructions:u", "-http=localhost:0", profilePath},
+		},
+		{
+			name:      "explicit sample index",
+			pprofArgs: []string{"-sample_index=cycles:u"},
+			want:      []string{"-sample_index=cycles:u", "-http=localhost:0", profilePath},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			a := &App{logger: zerolog.Nop(), servePprof: func(args []string) error {
+				got = args
+				return nil
+			}}
+
+			out := captureStdout(t, func() {
+				require.NoError(t, a.displayHistoryEntry(entry, tt.pprofArgs, true, threadFilter{}))
+			})
+			assert.Contains(t, out, "default-event=instructions")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
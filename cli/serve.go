@@ -0,0 +1,124 @@
+package cli
+
+// This file contains view --serve, which runs the pprof web UI in process so
+// viewing a recorded profile doesn't require a Go installation.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/pprof/driver"
+	"github.com/google/pprof/profile"
+)
+
+// defaultServeAddr lets pprof pick a free port on the loopback interface.
+const defaultServeAddr = "localhost:0"
+
+// pprofFlags implements driver.FlagSet on top of the flag package, parsing
+// the given arguments instead of the command line.
+type pprofFlags struct {
+	*flag.FlagSet
+	args       []string
+	extraUsage []string
+}
+
+func newPprofFlags(args []string) *pprofFlags {
+	return &pprofFlags{
+		FlagSet: flag.NewFlagSet("pprof", flag.ContinueOnError),
+		args:    args,
+	}
+}
+
+// StringList implements driver.FlagSet. Like pprof's own flag set, it
+// accepts a single value.
+func (f *pprofFlags) StringList(name, def, usage string) *[]*string {
+	return &[]*string{f.String(name, def, usage)}
+}
+
+// ExtraUsage implements driver.FlagSet.
+func (f *pprofFlags) ExtraUsage() string {
+	return strings.Join(f.extraUsage, "\n")
+}
+
+// AddExtraUsage implements driver.FlagSet.
+func (f *pprofFlags) AddExtraUsage(eu string) {
+	f.extraUsage = append(f.extraUsage, eu)
+}
+
+// Parse implements driver.FlagSet.
+func (f *pprofFlags) Parse(usage func()) []string {
+	f.Usage = usage
+	if err := f.FlagSet.Parse(f.args); err != nil {
+		return nil
+	}
+	args := f.Args()
+	if len(args) == 0 {
+		usage()
+	}
+	return args
+}
+
+// servePprof runs pprof in process with the given arguments.
+func servePprof(args []string) error {
+	return driver.PProf(&driver.Options{Flagset: newPprofFlags(args)})
+}
+
+// pprofServer returns the function running pprof in process.
+func (a *App) pprofServer() func(args []string) error {
+	if a.servePprof == nil {
+		return servePprof
+	}
+	return a.servePprof
+}
+
+// serveArgs returns the pprof arguments serving profilePath: the given pprof
+// arguments, an -http address unless given, the main binary if it is
+// archived and the profile.
+func serveArgs(pprofArgs []string, binary, profilePath string) []string {
+	args := append([]string{}, pprofArgs...)
+	if !hasPprofFlag(pprofArgs, "http") {
+		args = append(args, "-http="+defaultServeAddr)
+	}
+	if binary != "" {
+		args = append(args, binary)
+	}
+	return append(args, profilePath)
+}
+
+// hasPprofFlag reports whether args set the pprof flag name, e.g. http for
+// the address of the pprof web UI.
+func hasPprofFlag(args []string, name string) bool {
+	for _, arg := range args {
+		flagName, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && flagName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mainBinary returns the binary of the main mapping of the profile at
+// profilePath, or an empty string if it isn't available locally.
+func mainBinary(profilePath string) (string, error) {
+	f, err := os.Open(profilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer f.Close()
+
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse profile: %w", err)
+	}
+	if len(prof.Mapping) == 0 {
+		return "", nil
+	}
+
+	binary := prof.Mapping[0].File
+	if info, err := os.Stat(binary); err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+	return binary, nil
+}
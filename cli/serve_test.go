@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisplayProfile_Serve(t *testing.T) {
+	runDir := t.TempDir()
+	binary := filepath.Join(runDir, "aaaa.perfgo.test.binary")
+	require.NoError(t, os.WriteFile(binary, []byte("ELF"), 0o755))
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping: []*profile.Mapping{
+			{ID: 1, File: binary},
+			{ID: 2, File: "[kernel.kallsyms]"},
+		},
+	}
+	profilePath := filepath.Join(runDir, "perf.pb.gz")
+	f, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	entry := &history.Entry{
+		FullPath: runDir,
+		History: model.History{
+			ID:        "0123456789abcdef",
+			Timestamp: time.Now(),
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypeTestBinary, File: "aaaa.perfgo.test.binary"},
+				{Type: model.ArtifactTypePprofProfile, File: "perf.pb.gz"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pprofArgs []string
+		want      []string
+	}{
+		{
+			name: "default address",
+			want: []string{"-http=localhost:0", binary, profilePath},
+		},
+		{
+			name:      "explicit address",
+			pprofArgs: []string{"-http=:8080", "-no_browser"},
+			want:      []string{"-http=:8080", "-no_browser", binary, profilePath},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			a := &App{logger: zerolog.Nop(), servePprof: func(args []string) error {
+				got = args
+				return nil
+			}}
+
+			captureStdout(t, func() {
+				require.NoError(t, a.displayHistoryEntry(entry, tt.pprofArgs, true, threadFilter{}))
+			})
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServeArgs_MissingBinary(t *testing.T) {
+	assert.Equal(t, []string{"-http=localhost:0", "perf.pb.gz"}, serveArgs(nil, "", "perf.pb.gz"))
+}
+
+func TestHasPprofFlag(t *testing.T) {
+	assert.True(t, hasPprofFlag([]string{"-http=:8080"}, "http"))
+	assert.True(t, hasPprofFlag([]string{"--http", ":8080"}, "http"))
+	assert.False(t, hasPprofFlag([]string{"-top"}, "http"))
+	assert.False(t, hasPprofFlag([]string{"http"}, "http"))
+	assert.True(t, hasPprofFlag([]string{"-top", "-sample_index=1"}, "sample_index"))
+}
+
+func TestPprofFlags(t *testing.T) {
+	flags := newPprofFlags([]string{"-http=:8080", "-symbolize=none", "binary", "perf.pb.gz"})
+	http := flags.String("http", "", "")
+	symbolize := flags.StringList("symbolize", "", "")
+	top := flags.Bool("top", false, "")
+
+	usageCalled := false
+	args := flags.Parse(func() { usageCalled = true })
+
+	assert.Equal(t, []string{"binary", "perf.pb.gz"}, args)
+	assert.Equal(t, ":8080", *http)
+	require.Len(t, *symbolize, 1)
+	assert.Equal(t, "none", *(*symbolize)[0])
+	assert.False(t, *top)
+	assert.False(t, usageCalled)
+}
@@ -0,0 +1,85 @@
+package ssh
+
+// This file contains the cache directory on the remote host, which holds the
+// synced repositories and test binaries.
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// EnvRemoteCache is the environment variable setting the remote cache
+// directory, overridden by --remote-cache-dir.
+const EnvRemoteCache = "PERFGO_REMOTE_CACHE"
+
+// remoteCacheDirScript prints the default cache directory of a POSIX host:
+// $XDG_CACHE_HOME/perfgo, $HOME/.cache/perfgo or /tmp/perfgo.
+const remoteCacheDirScript = `if [ -n "$XDG_CACHE_HOME" ]; then echo "$XDG_CACHE_HOME/perfgo"; elif [ -n "$HOME" ]; then echo "$HOME/.cache/perfgo"; else echo "/tmp/perfgo"; fi`
+
+// WithRemoteCacheDir sets the cache directory on the remote host instead of
+// the XDG default. It has to be writable by the remote user.
+func WithRemoteCacheDir(dir string) SSHOption {
+	return func(c *Client) {
+		if dir != "" {
+			c.remoteCacheDir = path.Clean(filepath.ToSlash(dir))
+		}
+	}
+}
+
+// ResolveRemoteCacheDir returns the configured remote cache directory: the
+// flag value (--remote-cache-dir), else env (PERFGO_REMOTE_CACHE). Empty
+// means the XDG default of the remote host is used.
+func ResolveRemoteCacheDir(flag, env string) string {
+	if flag != "" {
+		return flag
+	}
+	return env
+}
+
+// getRemoteCacheDir determines the cache directory on the remote host.
+func (c *Client) getRemoteCacheDir() (string, error) {
+	if c.remoteCacheDir != "" {
+		if err := c.validateRemoteCacheDir(c.remoteCacheDir); err != nil {
+			return "", err
+		}
+		return c.remoteCacheDir, nil
+	}
+
+	if c.windows {
+		cacheDir, _, err := c.RunCommand(PowerShellCommand(windowsCacheDirCmd))
+		if err != nil {
+			return "", fmt.Errorf("failed to determine remote cache directory: %w", err)
+		}
+		// Windows accepts forward slashes, which keeps joining paths uniform
+		return strings.ReplaceAll(strings.TrimSpace(cacheDir), `\`, "/"), nil
+	}
+
+	// Explicitly use /bin/sh to ensure POSIX shell compatibility
+	// (remote host may use fish or other non-POSIX shells by default)
+	cacheDir, _, err := c.RunCommand("/bin/sh -c " + shellescape.Quote(remoteCacheDirScript))
+	if err != nil {
+		return "", fmt.Errorf("failed to determine remote cache directory: %w", err)
+	}
+
+	return strings.TrimSpace(cacheDir), nil
+}
+
+// validateRemoteCacheDir creates the configured cache directory on the remote
+// host and checks that the remote user can write to it.
+func (c *Client) validateRemoteCacheDir(dir string) error {
+	command := "/bin/sh -c " + shellescape.Quote(fmt.Sprintf("mkdir -p %s && test -w %s", shellescape.Quote(dir), shellescape.Quote(dir)))
+	if c.windows {
+		probe := dir + "/.perfgo-write-test"
+		command = PowerShellCommand(fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | Out-Null; Set-Content -Path %s -Value ''; Remove-Item %s",
+			PowerShellQuote(dir), PowerShellQuote(probe), PowerShellQuote(probe)))
+	}
+
+	if _, _, err := c.RunCommand(command); err != nil {
+		return fmt.Errorf("remote cache directory %s is not writable: %w", dir, err)
+	}
+	return nil
+}
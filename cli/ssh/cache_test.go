@@ -0,0 +1,82 @@
+package ssh
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shellRunner runs the remote commands with the local sh in the given
+// environment, standing in for a POSIX remote host.
+func shellRunner(t *testing.T, env []string) *runner.Fake {
+	return &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		sh := exec.Command("sh", "-c", cmd.Args[len(cmd.Args)-1])
+		sh.Env = env
+		var stderr strings.Builder
+		sh.Stderr = &stderr
+		stdout, err := sh.Output()
+		return runner.Result{Stdout: string(stdout), Stderr: stderr.String(), Err: err}
+	}}
+}
+
+func TestGetRemoteCacheDir_Precedence(t *testing.T) {
+	writable := t.TempDir()
+
+	tests := []struct {
+		name string
+		flag string
+		env  string
+		xdg  string
+		home string
+		want string
+	}{
+		{name: "flag", flag: writable + "/flag", env: writable + "/env", xdg: "/xdg", home: "/home/dev", want: writable + "/flag"},
+		{name: "env", env: writable + "/env", xdg: "/xdg", home: "/home/dev", want: writable + "/env"},
+		{name: "xdg", xdg: "/xdg", home: "/home/dev", want: "/xdg/perfgo"},
+		{name: "home", home: "/home/dev", want: "/home/dev/.cache/perfgo"},
+		{name: "tmp", want: "/tmp/perfgo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := []string{"PATH=/usr/bin:/bin"}
+			if tt.xdg != "" {
+				env = append(env, "XDG_CACHE_HOME="+tt.xdg)
+			}
+			if tt.home != "" {
+				env = append(env, "HOME="+tt.home)
+			}
+
+			c := newTestClient()
+			WithRunner(shellRunner(t, env))(c)
+			WithRemoteCacheDir(ResolveRemoteCacheDir(tt.flag, tt.env))(c)
+
+			cacheDir, err := c.getRemoteCacheDir()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cacheDir)
+		})
+	}
+}
+
+func TestGetRemoteCacheDir_NotWritable(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "mkdir: cannot create directory '/srv/perfgo': Permission denied\n", Err: errors.New("exit status 1")}
+	}}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	WithRemoteCacheDir("/srv/perfgo/")(c)
+
+	_, err := c.getRemoteCacheDir()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "remote cache directory /srv/perfgo is not writable")
+	assert.Contains(t, err.Error(), "Permission denied")
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, `/bin/sh -c 'mkdir -p /srv/perfgo && test -w /srv/perfgo'`, cmds[0].Args[len(cmds[0].Args)-1])
+}
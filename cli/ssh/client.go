@@ -6,15 +6,25 @@ package ssh
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/cpu"
+	"github.com/perfgo/perfgo/cli/progress"
+	"github.com/perfgo/perfgo/cli/runner"
 	"github.com/rs/zerolog"
 )
 
@@ -26,9 +36,41 @@ type Client struct {
 	identityFile   string
 	knownHostsFile string
 	proxyCommand   string
+	proxyJump      string
+	port           int
+	user           string
+	commandTimeout time.Duration
 	extraOptions   []string
+	runner         runner.Runner
+	sharedPath     string
+	remoteCacheDir string
+	progressOut    *os.File
+	windows        bool
+
+	connectAttempts int
+	connectInterval time.Duration
+
+	// controlPersist is how long the master connection stays open after the
+	// last session, so later invocations can reuse it. Zero disables this.
+	controlPersist time.Duration
 }
 
+const (
+	// commandWaitDelay bounds how long a cancelled command may keep its output
+	// streams open before they are forcibly closed.
+	commandWaitDelay = 5 * time.Second
+
+	// Defaults for retrying the master connection. Freshly started hosts (e.g.
+	// a perf pod that is ready before sshd accepts connections) commonly
+	// refuse the first attempts.
+	defaultConnectAttempts = 5
+	defaultConnectInterval = 500 * time.Millisecond
+
+	// DefaultControlPersist is how long an idle master connection is kept
+	// open for reuse by default.
+	DefaultControlPersist = 30 * time.Second
+)
+
 // SSHOption is a function that configures an SSH client.
 type SSHOption func(*Client)
 
@@ -53,6 +95,70 @@ func WithProxyCommand(command string) SSHOption {
 	}
 }
 
+// WithProxyJump connects through the given jump host(s) ([user@]host[:port],
+// comma separated for multiple hops), as with ssh -J. The jump is only made
+// when the multiplexed master connection is established; all subsequent
+// sessions reuse the master and don't reconnect through the bastion.
+func WithProxyJump(jump string) SSHOption {
+	return func(c *Client) {
+		c.proxyJump = jump
+	}
+}
+
+// WithPort sets a non-standard port to connect to.
+func WithPort(port int) SSHOption {
+	return func(c *Client) {
+		c.port = port
+	}
+}
+
+// WithUser sets the login user, overriding any user given as part of the host.
+func WithUser(user string) SSHOption {
+	return func(c *Client) {
+		c.user = user
+	}
+}
+
+// WithCommandTimeout limits how long RunCommand waits for a remote command
+// to complete. A zero timeout waits indefinitely.
+func WithCommandTimeout(timeout time.Duration) SSHOption {
+	return func(c *Client) {
+		c.commandTimeout = timeout
+	}
+}
+
+// WithConnectRetry configures how often establishing the master connection is
+// attempted, and the initial delay between attempts, which doubles after each
+// failure. Authentication failures are never retried.
+func WithConnectRetry(attempts int, interval time.Duration) SSHOption {
+	return func(c *Client) {
+		c.connectAttempts = attempts
+		c.connectInterval = interval
+	}
+}
+
+// WithRunner sets the runner executing the local ssh, scp, rsync and git
+// commands, runner.Default if not set.
+func WithRunner(r runner.Runner) SSHOption {
+	return func(c *Client) {
+		c.runner = r
+	}
+}
+
+// WithProgress reports the progress of syncs and copies to out, if it is a
+// terminal.
+func WithProgress(out *os.File) SSHOption {
+	return func(c *Client) {
+		c.progressOut = out
+	}
+}
+
+// Progress returns a progress bar for a transfer of total bytes, or nil if
+// progress is not reported.
+func (c *Client) Progress(label string, total int64) *progress.Bar {
+	return progress.ForTerminal(c.progressOut, label, total)
+}
+
 // WithExtraOptions adds extra SSH options to the connection.
 func WithExtraOptions(options ...string) SSHOption {
 	return func(c *Client) {
@@ -60,11 +166,23 @@ func WithExtraOptions(options ...string) SSHOption {
 	}
 }
 
+// WithControlPersist sets how long the master connection stays open after
+// the last session, allowing later perfgo invocations to reuse it. A zero
+// duration closes the master connection with the client.
+func WithControlPersist(d time.Duration) SSHOption {
+	return func(c *Client) {
+		c.controlPersist = max(d, 0)
+	}
+}
+
 // New creates a new SSH client and establishes a multiplexed connection to the host.
 func New(logger zerolog.Logger, host string, opts ...SSHOption) (*Client, error) {
 	c := &Client{
-		logger: logger,
-		host:   host,
+		logger:          logger,
+		host:            host,
+		connectAttempts: defaultConnectAttempts,
+		connectInterval: defaultConnectInterval,
+		controlPersist:  DefaultControlPersist,
 	}
 
 	// Apply options
@@ -82,58 +200,115 @@ func New(logger zerolog.Logger, host string, opts ...SSHOption) (*Client, error)
 	return c, nil
 }
 
-// Close closes the SSH connection and cleans up the control socket.
+// cmdRunner returns the runner executing local commands.
+func (c *Client) cmdRunner() runner.Runner {
+	if c.runner == nil {
+		return runner.Default
+	}
+	return c.runner
+}
+
+// Close closes the SSH connection and cleans up the control socket. Only the
+// last client of the process which started the master connection closes it,
+// and only if it doesn't persist, such masters are private to the process (see
+// controlSocketName). Other masters are left running for their users and exit
+// on their own once idle for the persist duration.
 func (c *Client) Close() {
+	ref, last := releaseMaster(c.controlPath)
+	if !last {
+		c.logger.Debug().Str("controlPath", c.controlPath).Msg("SSH master connection still in use by other clients")
+		return
+	}
+	if ref == nil || !ref.owned || ref.persist > 0 {
+		c.logger.Debug().Str("controlPath", c.controlPath).Msg("Leaving SSH master connection for reuse")
+		return
+	}
+
+	// The master may have exited already, e.g. when the host went away
+	if !c.masterAlive(c.controlPath) {
+		return
+	}
+
 	c.logger.Debug().Str("controlPath", c.controlPath).Msg("Cleaning up SSH multiplexing")
 
 	// Close the master connection
 	args := []string{
 		"-o", fmt.Sprintf("ControlPath=%s", c.controlPath),
 		"-O", "exit",
-		c.host,
+		c.destination(),
 	}
-	cmd := exec.Command("ssh", args...)
-	_ = cmd.Run() // Ignore errors on cleanup
+	_, _, _ = c.cmdRunner().Run(context.Background(), "ssh", args...) // Ignore errors on cleanup
 
 	// Remove the control socket file if it still exists
 	_ = os.Remove(c.controlPath)
 }
 
+// runOptions holds the streams and terminal settings of a remote command.
 type runOptions struct {
 	stdout io.Writer
 	stderr io.Writer
 	stdin  io.Reader
 	tty    bool
+	quiet  bool
+	group  bool
 }
 
+// RunOption configures how a remote command is run.
 type RunOption func(*runOptions)
 
+// WithStdOut streams the remote command's standard output to w.
 func WithStdOut(w io.Writer) RunOption {
 	return func(o *runOptions) {
 		o.stdout = w
 	}
 }
 
+// WithStdErr streams the remote command's standard error to w.
 func WithStdErr(w io.Writer) RunOption {
 	return func(o *runOptions) {
 		o.stderr = w
 	}
 }
 
+// WithStdIn feeds r to the remote command's standard input.
 func WithStdIn(r io.Reader) RunOption {
 	return func(o *runOptions) {
 		o.stdin = r
 	}
 }
 
+// WithTTY forces allocation of a pseudo-terminal for interactive commands.
 func WithTTY(tty bool) RunOption {
 	return func(o *runOptions) {
 		o.tty = tty
 	}
 }
 
-// RunCommand executes a command on the remote host and returns the output.
+// WithQuiet suppresses ssh's diagnostic messages, such as the notice that the
+// connection was closed after a command with a TTY.
+func WithQuiet() RunOption {
+	return func(o *runOptions) {
+		o.quiet = true
+	}
+}
+
+// WithNewProcessGroup runs the local ssh process in its own process group, so
+// a Ctrl-C in the terminal doesn't kill it and the caller may stop the remote
+// command gracefully instead. It must not be combined with a terminal stdin.
+func WithNewProcessGroup() RunOption {
+	return func(o *runOptions) {
+		o.group = true
+	}
+}
+
+// Run executes a command on the remote host, wiring up the streams given as options.
 func (c *Client) Run(command string, optFuncs ...RunOption) error {
+	return c.RunContext(context.Background(), command, optFuncs...)
+}
+
+// RunContext executes a command on the remote host, wiring up the streams given as options.
+// The local ssh process is killed when the context is done.
+func (c *Client) RunContext(ctx context.Context, command string, optFuncs ...RunOption) error {
 	args := c.buildSSHArgs()
 
 	opts := &runOptions{}
@@ -145,35 +320,64 @@ func (c *Client) Run(command string, optFuncs ...RunOption) error {
 	if opts.tty {
 		args = append(args, "-t", "-t") // -t -t forces TTY allocation even without controlling terminal
 	}
+	if opts.quiet {
+		args = append(args, "-q")
+	}
 
-	args = append(args, c.host, command)
+	args = append(args, c.destination(), command)
 
-	cmd := exec.Command("ssh", args...)
+	cmd := runner.Cmd{
+		Name:      "ssh",
+		Args:      args,
+		Stdin:     opts.stdin,
+		Stdout:    opts.stdout,
+		Stderr:    opts.stderr,
+		WaitDelay: commandWaitDelay,
 
-	cmd.Stdout = opts.stdout
-	cmd.Stderr = opts.stderr
-	cmd.Stdin = opts.stdin
+		NewProcessGroup: opts.group,
+	}
 
 	c.logger.Debug().
-		Str("host", c.host).
+		Str("host", c.destination()).
 		Str("command", command).
 		Msg("Running remote command")
 
-	if err := cmd.Run(); err != nil {
+	if err := c.cmdRunner().Stream(ctx, cmd); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("remote command %q cancelled: %w", command, ctxErr)
+		}
 		return err
 	}
 
 	return nil
 }
 
+// CommandContext returns a context bounded by the client's command timeout,
+// if configured, for helper commands run with RunContext.
+func (c *Client) CommandContext() (context.Context, context.CancelFunc) {
+	if c.commandTimeout > 0 {
+		return context.WithTimeout(context.Background(), c.commandTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
 // RunCommand executes a command on the remote host and returns the output.
+// The command is bounded by the client's command timeout, if configured.
 func (c *Client) RunCommand(command string, optFuncs ...RunOption) (string, string, error) {
+	ctx, cancel := c.CommandContext()
+	defer cancel()
+	return c.RunCommandContext(ctx, command, optFuncs...)
+}
+
+// RunCommandContext executes a command on the remote host and returns the output.
+// The command is aborted when the context is done.
+func (c *Client) RunCommandContext(ctx context.Context, command string, optFuncs ...RunOption) (string, string, error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
-	if err := c.Run(
-		command,
+	optFuncs = append(optFuncs,
 		WithStdOut(&stdoutBuf),
 		WithStdErr(&stderrBuf),
-	); err != nil {
+	)
+	if err := c.RunContext(ctx, command, optFuncs...); err != nil {
 		return "", "", fmt.Errorf("command failed: %w (stderr: %s)", err, stderrBuf.String())
 	}
 	return stdoutBuf.String(), stderrBuf.String(), nil
@@ -191,6 +395,19 @@ func (c *Client) buildSSHArgs() []string {
 		)
 	}
 
+	return append(args, c.connectionArgs()...)
+}
+
+// connectionArgs returns the arguments describing how to reach and
+// authenticate against the host, shared by the master and all sessions.
+func (c *Client) connectionArgs() []string {
+	args := []string{}
+
+	// Add port if specified
+	if c.port != 0 {
+		args = append(args, "-p", strconv.Itoa(c.port))
+	}
+
 	// Add identity file if specified
 	if c.identityFile != "" {
 		args = append(args, "-i", c.identityFile)
@@ -206,6 +423,11 @@ func (c *Client) buildSSHArgs() []string {
 		args = append(args, "-o", fmt.Sprintf("ProxyCommand=%s", c.proxyCommand))
 	}
 
+	// Add jump host if specified
+	if c.proxyJump != "" {
+		args = append(args, "-J", c.proxyJump)
+	}
+
 	// Add extra options
 	for _, opt := range c.extraOptions {
 		args = append(args, "-o", opt)
@@ -214,11 +436,39 @@ func (c *Client) buildSSHArgs() []string {
 	return args
 }
 
+// buildSCPArgs converts the SSH arguments to scp syntax, which uses -P for the port.
+func (c *Client) buildSCPArgs() []string {
+	args := c.buildSSHArgs()
+	for i := range args {
+		if args[i] == "-p" {
+			args[i] = "-P"
+		}
+	}
+	return args
+}
+
+// destination returns the host to connect to, prefixed with the login user if configured.
+func (c *Client) destination() string {
+	if c.user == "" {
+		return c.host
+	}
+	host := c.host
+	if idx := strings.LastIndex(host, "@"); idx >= 0 {
+		host = host[idx+1:]
+	}
+	return c.user + "@" + host
+}
+
 // DetectSystem detects the OS and architecture of the remote system.
 func (c *Client) DetectSystem() (string, string, error) {
 	// Detect OS
 	osName, _, err := c.RunCommand("uname -s")
 	if err != nil {
+		// Windows has no uname, unless the default shell is e.g. MSYS2
+		if arch, ok := c.detectWindows(); ok {
+			c.windows = true
+			return "windows", arch, nil
+		}
 		return "", "", fmt.Errorf("failed to detect OS: %w", err)
 	}
 
@@ -228,28 +478,73 @@ func (c *Client) DetectSystem() (string, string, error) {
 		return "", "", fmt.Errorf("failed to detect architecture: %w", err)
 	}
 
-	// Normalize OS name to Go's GOOS format
-	osName = strings.ToLower(strings.TrimSpace(osName))
-	if osName == "darwin" {
-		osName = "darwin"
-	} else if osName == "linux" {
-		osName = "linux"
+	osName = NormalizeOS(osName)
+	if osName == "solaris" {
+		// illumos distributions report SunOS as well, uname -o tells them apart
+		if opSys, _, err := c.RunCommand("uname -o"); err == nil && strings.EqualFold(strings.TrimSpace(opSys), "illumos") {
+			osName = "illumos"
+		}
+	}
+
+	return osName, NormalizeArch(arch), nil
+}
+
+// DetectCPUVendor detects the CPU vendor of the remote system, given the OS
+// and architecture returned by DetectSystem.
+func (c *Client) DetectCPUVendor(osName, arch string) string {
+	return cpu.DetectVendor(osName, arch, func(command string) (string, error) {
+		stdout, _, err := c.RunCommand(command)
+		return stdout, err
+	})
+}
+
+// NormalizeOS converts the output of uname -s to Go's GOOS format.
+// Unknown systems are returned lowercased.
+func NormalizeOS(unameS string) string {
+	osName := strings.ToLower(strings.TrimSpace(unameS))
+
+	// Windows shells report their flavour and version, e.g. MINGW64_NT-10.0-19045
+	for _, prefix := range []string{"mingw", "msys", "cygwin", "windows_nt"} {
+		if strings.HasPrefix(osName, prefix) {
+			return "windows"
+		}
+	}
+
+	if osName == "sunos" {
+		return "solaris"
 	}
 
-	// Normalize architecture to Go's GOARCH format
-	arch = strings.TrimSpace(arch)
+	// darwin, linux, freebsd, openbsd, netbsd and dragonfly already match GOOS
+	return osName
+}
+
+// NormalizeArch converts the output of uname -m to Go's GOARCH format.
+// Unknown architectures are returned unchanged.
+func NormalizeArch(unameM string) string {
+	arch := strings.TrimSpace(unameM)
 	switch arch {
 	case "x86_64", "amd64":
-		arch = "amd64"
-	case "aarch64", "arm64":
-		arch = "arm64"
-	case "i386", "i686":
-		arch = "386"
-	case "armv7l":
-		arch = "arm"
+		return "amd64"
+	case "aarch64", "arm64", "aarch64_be":
+		return "arm64"
+	case "i386", "i486", "i586", "i686", "i86pc":
+		return "386"
+	case "armv6l", "armv7l", "armv7", "arm":
+		return "arm"
+	case "riscv64":
+		return "riscv64"
+	case "ppc64le":
+		return "ppc64le"
+	case "ppc64":
+		return "ppc64"
+	case "s390x":
+		return "s390x"
+	case "mips64":
+		return "mips64"
+	case "loongarch64":
+		return "loong64"
 	}
-
-	return osName, arch, nil
+	return arch
 }
 
 // GetRemoteRepositoryDir determines the remote directory path for the current repository.
@@ -264,12 +559,11 @@ func (c *Client) GetRemoteRepositoryDir() (string, error) {
 	repoBaseName := filepath.Base(cwd)
 
 	// Get git repository root to create a stable hash
-	gitRootCmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	gitRootOut, err := gitRootCmd.Output()
+	gitRootOut, _, err := c.cmdRunner().Run(context.Background(), "git", "rev-parse", "--show-toplevel")
 	if err != nil {
 		return "", fmt.Errorf("failed to get git root: %w", err)
 	}
-	gitRoot := strings.TrimSpace(string(gitRootOut))
+	gitRoot := strings.TrimSpace(gitRootOut)
 
 	// Create a hash of the git root path for uniqueness
 	hash := sha256.Sum256([]byte(gitRoot))
@@ -278,10 +572,13 @@ func (c *Client) GetRemoteRepositoryDir() (string, error) {
 	// Construct repository identifier
 	repoIdent := fmt.Sprintf("%s-%s", repoBaseName, pathHash)
 
-	// Get remote cache directory path
-	cacheDir, err := c.getRemoteCacheDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get remote cache directory: %w", err)
+	// Get remote cache directory path, the shared directory if there is one
+	cacheDir := c.sharedPath
+	if cacheDir == "" {
+		cacheDir, err = c.getRemoteCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get remote cache directory: %w", err)
+		}
 	}
 
 	// Construct full path
@@ -290,8 +587,17 @@ func (c *Client) GetRemoteRepositoryDir() (string, error) {
 	return remoteBaseDir, nil
 }
 
+// worktreeDir is the directory of the synced working tree in the remote base
+// directory of a repository, it's kept between runs.
+const worktreeDir = "worktree"
+
 // SyncDirectoryToRemote syncs the current git working tree to the remote host.
-func (c *Client) SyncDirectoryToRemote(remoteBaseDir string) (string, error) {
+func (c *Client) SyncDirectoryToRemote(remoteBaseDir string, optFuncs ...SyncOption) (string, error) {
+	opts := &syncOptions{}
+	for _, opt := range optFuncs {
+		opt(opts)
+	}
+
 	// Get current working directory
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -299,74 +605,195 @@ func (c *Client) SyncDirectoryToRemote(remoteBaseDir string) (string, error) {
 	}
 
 	// Check if we're in a git repository
-	gitCheckCmd := exec.Command("git", "rev-parse", "--git-dir")
-	if err := gitCheckCmd.Run(); err != nil {
+	if _, _, err := c.cmdRunner().Run(context.Background(), "git", "rev-parse", "--git-dir"); err != nil {
 		return "", fmt.Errorf("not in a git repository: %w", err)
 	}
 
+	if err := c.checkUntracked(opts); err != nil {
+		return "", err
+	}
+
 	// Use the worktree subdirectory within the base directory
-	remoteDir := fmt.Sprintf("%s/worktree", remoteBaseDir)
+	remoteDir := fmt.Sprintf("%s/%s", remoteBaseDir, worktreeDir)
 
 	c.logger.Info().
 		Str("local", cwd).
 		Str("remote", remoteDir).
 		Msg("Syncing git working tree to remote host")
 
+	// Prefer rsync for incremental transfers, fall back to a full tar archive
+	method := c.detectSyncMethod()
+
+	// The worktree of an earlier run is kept for rsync to update, tar can
+	// only add files, so it extracts into an empty directory
+	if method != syncMethodRsync {
+		if err := c.RemoveAll(remoteDir); err != nil {
+			return "", err
+		}
+	}
+
 	// Create remote directory
-	mkdirCmd := fmt.Sprintf("mkdir -p %s", remoteDir)
-	if _, _, err := c.RunCommand(mkdirCmd); err != nil {
+	if _, _, err := c.RunCommand(c.mkdirCommand(remoteDir)); err != nil {
 		return "", fmt.Errorf("failed to create remote directory: %w", err)
 	}
 
+	if method == syncMethodRsync {
+		if err := c.syncWithRsync(remoteDir, opts.noUntracked); err != nil {
+			return "", err
+		}
+	} else {
+		if err := c.syncWithTar(remoteDir, opts.noUntracked); err != nil {
+			return "", err
+		}
+	}
+
+	c.logger.Debug().Msg("Working tree synced successfully")
+
+	return remoteDir, nil
+}
+
+// RemoveRunFiles removes the test binaries and perf files of a run from
+// remoteBaseDir on the remote host. The synced working tree is kept, so the
+// next sync only transfers what changed.
+func (c *Client) RemoveRunFiles(remoteBaseDir string) error {
+	command := fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 ! -name %s -exec rm -rf {} +", shellescape.Quote(remoteBaseDir), shellescape.Quote(worktreeDir))
+	if c.windows {
+		command = PowerShellCommand(fmt.Sprintf("Get-ChildItem -LiteralPath %s -ErrorAction SilentlyContinue | Where-Object Name -ne %s | Remove-Item -Recurse -Force",
+			PowerShellQuote(remoteBaseDir), PowerShellQuote(worktreeDir)))
+	}
+	if _, _, err := c.RunCommand(command); err != nil {
+		return fmt.Errorf("failed to remove run files from %s: %w", remoteBaseDir, err)
+	}
+	return nil
+}
+
+// syncWithTar streams a tar archive of the working tree to remoteDir.
+func (c *Client) syncWithTar(remoteDir string, noUntracked bool) error {
 	// Create a tar archive of the current working tree (including uncommitted changes)
 	// and pipe it directly to the remote host
 	c.logger.Debug().Msg("Creating archive of working tree")
 
 	// Use git ls-files to get all tracked files (with current modifications)
-	// and git ls-files --others to get untracked files (respecting .gitignore)
+	// and unless disabled untracked files (respecting .gitignore)
 	// Then tar them all and pipe through SSH
-	archiveCmd := exec.Command("sh", "-c",
-		"(git ls-files -z; git ls-files --others --exclude-standard -z) | tar --null -T - -czf -",
-	)
+	archiveCmd := runner.Cmd{
+		Name: "sh",
+		Args: []string{"-c", tarFileList(noUntracked) + " | tar --null -T - -cf -"},
+	}
 
 	// Pipe directly to SSH and extract on remote
 	args := c.buildSSHArgs()
-	args = append(args, c.host, fmt.Sprintf("cd %s && tar -xzf -", remoteDir))
-	sshCmd := exec.Command("ssh", args...)
+	args = append(args, c.destination(), c.extractCommand(remoteDir))
+	sshCmd := runner.Cmd{Name: "ssh", Args: args}
+
+	// The archive is compressed here rather than by tar, so progress can be
+	// reported against the uncompressed size of the files
+	bar := c.Progress("Syncing working tree", c.estimateArchiveSize(noUntracked))
+	defer bar.Done()
 
 	// Connect the archive output to ssh input
-	pipe, err := archiveCmd.StdoutPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create pipe: %w", err)
-	}
-	sshCmd.Stdin = pipe
+	pipeReader, pipeWriter := io.Pipe()
+	gzipWriter := gzip.NewWriter(pipeWriter)
+	archiveCmd.Stdout = bar.Writer(gzipWriter)
+	sshCmd.Stdin = pipeReader
 
 	var archiveStderr, sshStderr bytes.Buffer
 	archiveCmd.Stderr = &archiveStderr
 	sshCmd.Stderr = &sshStderr
 
-	// Start both commands
-	if err := sshCmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start SSH: %w (stderr: %s)", err, sshStderr.String())
+	// Run ssh concurrently, reading the archive as it is created
+	sshDone := make(chan error, 1)
+	go func() {
+		err := c.cmdRunner().Stream(context.Background(), sshCmd)
+		// Unblock the archive if ssh exits early
+		pipeReader.CloseWithError(io.ErrClosedPipe)
+		sshDone <- err
+	}()
+
+	archiveErr := c.cmdRunner().Stream(context.Background(), archiveCmd)
+	if err := gzipWriter.Close(); err != nil && archiveErr == nil {
+		archiveErr = err
 	}
+	pipeWriter.Close()
+	sshErr := <-sshDone
 
-	if err := archiveCmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start archive: %w (stderr: %s)", err, archiveStderr.String())
+	if archiveErr != nil {
+		return fmt.Errorf("archive failed: %w (stderr: %s)", archiveErr, archiveStderr.String())
+	}
+	if sshErr != nil {
+		return fmt.Errorf("failed to extract on remote: %w (stderr: %s)", sshErr, sshStderr.String())
 	}
 
-	// Wait for archive to finish
-	if err := archiveCmd.Wait(); err != nil {
-		return "", fmt.Errorf("archive failed: %w (stderr: %s)", err, archiveStderr.String())
+	return nil
+}
+
+// estimateArchiveSize returns the approximate size of the uncompressed tar
+// archive of the working tree, or 0 if progress is not reported.
+func (c *Client) estimateArchiveSize(noUntracked bool) int64 {
+	if !progress.IsTerminal(c.progressOut) {
+		return 0
 	}
 
-	// Wait for ssh to finish
-	if err := sshCmd.Wait(); err != nil {
-		return "", fmt.Errorf("failed to extract on remote: %w (stderr: %s)", err, sshStderr.String())
+	listArgs := [][]string{{"ls-files", "-z"}}
+	if !noUntracked {
+		listArgs = append(listArgs, []string{"ls-files", "--others", "--exclude-standard", "-z"})
 	}
 
-	c.logger.Debug().Msg("Working tree synced successfully")
+	var paths []string
+	for _, args := range listArgs {
+		output, _, err := c.cmdRunner().Run(context.Background(), "git", args...)
+		if err != nil {
+			c.logger.Debug().Err(err).Msg("Failed to list files for progress")
+			return 0
+		}
+		paths = append(paths, splitNul(output)...)
+	}
+	return tarSize(paths)
+}
 
-	return remoteDir, nil
+// tarSize returns the size of a tar archive of the files at paths: a 512 byte
+// header per file, the content padded to 512 bytes and two end blocks.
+func tarSize(paths []string) int64 {
+	const block = 512
+	size := int64(2 * block)
+	for _, path := range paths {
+		size += block
+		if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+			size += (info.Size() + block - 1) / block * block
+		}
+	}
+	return size
+}
+
+// CopyFromRemote writes the contents of remotePath to w. The file is
+// transferred base64 encoded, which avoids issues with binary data in the
+// output of the SSH session, and decoded while it is received.
+func (c *Client) CopyFromRemote(remotePath string, w io.Writer) error {
+	ctx, cancel := c.CommandContext()
+	defer cancel()
+
+	pipeReader, pipeWriter := io.Pipe()
+	decoded := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, pipeReader))
+		// Unblock the remote command if decoding fails
+		pipeReader.CloseWithError(err)
+		decoded <- err
+	}()
+
+	var stderr bytes.Buffer
+	command := "base64 " + shellescape.Quote(remotePath)
+	runErr := c.RunContext(ctx, command, WithStdOut(pipeWriter), WithStdErr(&stderr))
+	pipeWriter.CloseWithError(runErr)
+	decodeErr := <-decoded
+
+	if decodeErr != nil && (runErr == nil || !errors.Is(decodeErr, runErr)) {
+		return fmt.Errorf("failed to decode base64: %w", decodeErr)
+	}
+	if runErr != nil {
+		return fmt.Errorf("command failed: %w (stderr: %s)", runErr, stderr.String())
+	}
+	return nil
 }
 
 // CopyBinaryToRemote copies a local binary to the remote host and makes it executable.
@@ -374,36 +801,52 @@ func (c *Client) CopyBinaryToRemote(localPath, remoteBaseDir string) (string, er
 	// Store binary in the base directory
 	remotePath := fmt.Sprintf("%s/%s", remoteBaseDir, filepath.Base(localPath))
 
+	// The remote host reads the binary from the shared directory
+	if c.IsShared(remotePath) {
+		c.logger.Info().
+			Str("local", localPath).
+			Str("shared", remotePath).
+			Msg("Copying binary to shared path")
+
+		if err := copyBinaryToShared(localPath, remotePath); err != nil {
+			return "", err
+		}
+		return remotePath, nil
+	}
+
 	c.logger.Info().
 		Str("local", localPath).
 		Str("remote", remotePath).
 		Msg("Copying binary to remote host")
 
 	// Ensure the remote base directory exists
-	mkdirCmd := fmt.Sprintf("mkdir -p %s", remoteBaseDir)
-	if _, _, err := c.RunCommand(mkdirCmd); err != nil {
+	if _, _, err := c.RunCommand(c.mkdirCommand(remoteBaseDir)); err != nil {
 		return "", fmt.Errorf("failed to create remote base directory: %w", err)
 	}
 
 	// Use scp with the SSH multiplexing control path
-	args := c.buildSSHArgs()
-	args = append(args, localPath, fmt.Sprintf("%s:%s", c.host, remotePath))
-	cmd := exec.Command("scp", args...)
+	args := c.buildSCPArgs()
+	args = append(args, localPath, fmt.Sprintf("%s:%s", c.destination(), remotePath))
+	cmd := runner.Cmd{Name: "scp", Args: args}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
 	c.logger.Debug().
 		Str("command", cmd.String()).
 		Msg("Executing scp")
 
-	if err := cmd.Run(); err != nil {
+	if err := c.cmdRunner().Stream(context.Background(), cmd); err != nil {
 		return "", fmt.Errorf("failed to copy binary: %w (stderr: %s)", err, stderr.String())
 	}
 
+	// Windows executes binaries by their .exe extension instead
+	if c.windows {
+		return remotePath, nil
+	}
+
 	// Make the binary executable on the remote host
-	chmodCmd := fmt.Sprintf("chmod +x %s", remotePath)
+	chmodCmd := fmt.Sprintf("chmod +x %s", shellescape.Quote(remotePath))
 	if _, _, err := c.RunCommand(chmodCmd); err != nil {
 		return "", fmt.Errorf("failed to make binary executable: %w", err)
 	}
@@ -413,9 +856,9 @@ func (c *Client) CopyBinaryToRemote(localPath, remoteBaseDir string) (string, er
 	return remotePath, nil
 }
 
-// Host returns the remote host this client is connected to.
+// Host returns the remote host this client is connected to, including the login user if configured.
 func (c *Client) Host() string {
-	return c.host
+	return c.destination()
 }
 
 // ControlPath returns the SSH control socket path.
@@ -433,70 +876,203 @@ func (c *Client) setupMultiplexing() (string, error) {
 		return "", fmt.Errorf("failed to create control directory: %w", err)
 	}
 
-	// Create a short hash of the host to avoid Unix socket path length limits
-	// Unix domain sockets have a path length limit (typically 104-108 chars)
-	hash := sha256.Sum256([]byte(c.host))
-	hostHash := hex.EncodeToString(hash[:])[:12] // Use first 12 chars of hash
-
-	// Create control path with short identifier
-	socketName := fmt.Sprintf("ssh-%s", hostHash)
+	socketName := c.controlSocketName()
 	controlPath := filepath.Join(controlDir, socketName)
 
 	c.logger.Debug().
-		Str("host", c.host).
-		Str("hostHash", hostHash).
+		Str("host", c.destination()).
+		Str("socket", socketName).
 		Str("controlDir", controlDir).
 		Str("controlPath", controlPath).
 		Int("pathLength", len(controlPath)).
 		Msg("Setting up SSH multiplexing")
 
-	// Establish the master connection
+	// Reuse a master connection left by an earlier or concurrent invocation
+	if c.masterAlive(controlPath) {
+		retainMaster(controlPath, false, c.controlPersist)
+		c.logger.Debug().Str("host", c.destination()).Msg("Reusing existing SSH master connection")
+		return controlPath, nil
+	}
+
+	if err := c.connectMaster(c.masterArgs(controlPath)); err != nil {
+		return "", err
+	}
+	retainMaster(controlPath, true, c.controlPersist)
+
+	c.logger.Debug().Str("host", c.destination()).Msg("SSH master connection established")
+	return controlPath, nil
+}
+
+// masterArgs returns the ssh arguments establishing the master connection on
+// the control socket at controlPath.
+func (c *Client) masterArgs(controlPath string) []string {
 	args := []string{
 		"-o", "ControlMaster=auto",
 		"-o", fmt.Sprintf("ControlPath=%s", controlPath),
-		"-o", "ControlPersist=30s",
+		"-o", fmt.Sprintf("ControlPersist=%s", controlPersistValue(c.controlPersist)),
 		"-o", "ConnectTimeout=10",
 		"-o", "ServerAliveInterval=15",
 		"-o", "ServerAliveCountMax=3",
 	}
 
-	// Add identity file if specified
-	if c.identityFile != "" {
-		args = append(args, "-i", c.identityFile)
+	args = append(args, c.connectionArgs()...)
+
+	return append(args,
+		"-f", // Run in background
+		"-N", // Don't execute a remote command
+		c.destination(),
+	)
+}
+
+// controlPersistValue formats d for ssh's ControlPersist option in whole
+// seconds. ssh reads 0 as persisting forever, so zero disables persistence.
+func controlPersistValue(d time.Duration) string {
+	if d <= 0 {
+		return "no"
 	}
+	return fmt.Sprintf("%ds", max(int64(d/time.Second), 1))
+}
 
-	// Add known hosts file if specified
-	if c.knownHostsFile != "" {
-		args = append(args, "-o", fmt.Sprintf("UserKnownHostsFile=%s", c.knownHostsFile))
+// masterRef tracks the clients of this process sharing the master connection
+// of a control socket.
+type masterRef struct {
+	clients int
+	owned   bool          // the master was started by this process
+	persist time.Duration // ControlPersist the master was started with
+}
+
+var (
+	mastersMu sync.Mutex
+	masters   = map[string]*masterRef{}
+)
+
+// retainMaster registers a client of the master connection at controlPath.
+// owned is set when the client started the master itself.
+func retainMaster(controlPath string, owned bool, persist time.Duration) {
+	mastersMu.Lock()
+	defer mastersMu.Unlock()
+
+	ref := masters[controlPath]
+	if ref == nil {
+		ref = &masterRef{}
+		masters[controlPath] = ref
+	}
+	ref.clients++
+	if owned {
+		ref.owned, ref.persist = true, persist
 	}
+}
 
-	// Add proxy command if specified
-	if c.proxyCommand != "" {
-		args = append(args, "-o", fmt.Sprintf("ProxyCommand=%s", c.proxyCommand))
+// releaseMaster unregisters a client of the master connection at
+// controlPath. It returns the master's reference and whether the client was
+// the last one of this process, the reference is nil for unknown paths.
+func releaseMaster(controlPath string) (*masterRef, bool) {
+	mastersMu.Lock()
+	defer mastersMu.Unlock()
+
+	ref := masters[controlPath]
+	if ref == nil {
+		return nil, true
 	}
+	ref.clients--
+	if ref.clients > 0 {
+		return ref, false
+	}
+	delete(masters, controlPath)
+	return ref, true
+}
 
-	// Add extra options
-	for _, opt := range c.extraOptions {
-		args = append(args, "-o", opt)
+// masterAlive reports whether a master connection is listening on the control
+// socket at controlPath. Sockets left behind by a dead master fail the check
+// and are removed, so a new master can bind the path.
+func (c *Client) masterAlive(controlPath string) bool {
+	if _, err := os.Stat(controlPath); err != nil {
+		return false
 	}
 
-	args = append(args,
-		"-f", // Run in background
-		"-N", // Don't execute a remote command
-		c.host,
-	)
+	args := []string{
+		"-o", fmt.Sprintf("ControlPath=%s", controlPath),
+		"-O", "check",
+		c.destination(),
+	}
+	if _, stderr, err := c.cmdRunner().Run(context.Background(), "ssh", args...); err != nil {
+		c.logger.Debug().Err(err).Str("stderr", strings.TrimSpace(stderr)).Msg("Stale SSH control socket")
+		_ = os.Remove(controlPath)
+		return false
+	}
+	return true
+}
+
+// connectMaster runs the master connection command, retrying with exponential
+// backoff unless the failure is an authentication error.
+func (c *Client) connectMaster(args []string) error {
+	attempts := max(c.connectAttempts, 1)
+	interval := c.connectInterval
+
+	for attempt := 1; ; attempt++ {
+		var stderr bytes.Buffer
+		err := c.cmdRunner().Stream(context.Background(), runner.Cmd{Name: "ssh", Args: args, Stderr: &stderr})
+		if err == nil {
+			return nil
+		}
 
-	cmd := exec.Command("ssh", args...)
+		err = fmt.Errorf("failed to establish SSH master connection: %w (stderr: %s)", err, stderr.String())
+		if isAuthFailure(stderr.String()) || attempt >= attempts {
+			return err
+		}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+		c.logger.Debug().
+			Err(err).
+			Int("attempt", attempt).
+			Dur("retry_in", interval).
+			Msg("SSH master connection failed, retrying")
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to establish SSH master connection: %w (stderr: %s)", err, stderr.String())
+		time.Sleep(interval)
+		interval *= 2
 	}
+}
 
-	c.logger.Debug().Str("host", c.host).Msg("SSH master connection established")
-	return controlPath, nil
+// authFailureMessages are ssh error messages which indicate that retrying the
+// connection can't succeed.
+var authFailureMessages = []string{
+	"Permission denied",
+	"Host key verification failed",
+	"Too many authentication failures",
+	"REMOTE HOST IDENTIFICATION HAS CHANGED",
+}
+
+// isAuthFailure reports whether ssh's stderr indicates an authentication or
+// host verification failure, as opposed to a connection refused or timeout.
+func isAuthFailure(stderr string) bool {
+	for _, msg := range authFailureMessages {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// processID returns the ID of this process, it's replaced in tests.
+var processID = os.Getpid
+
+// controlSocketName returns a short, unique name for the control socket.
+// It hashes the destination, port and the options choosing the route and
+// credentials of the connection to avoid Unix socket path length limits
+// (typically 104-108 chars) and collisions between different ports, users,
+// jump hosts or keys of the same host. A master which doesn't persist is exited once this
+// process is done with it, so its socket is named after the process and never
+// reused by others.
+func (c *Client) controlSocketName() string {
+	key := fmt.Sprintf("%s:%d", c.destination(), c.port)
+	if c.proxyJump != "" || c.proxyCommand != "" || c.identityFile != "" {
+		key += fmt.Sprintf("\x00%s\x00%s\x00%s", c.proxyJump, c.proxyCommand, c.identityFile)
+	}
+	hash := sha256.Sum256([]byte(key))
+	hostHash := hex.EncodeToString(hash[:])[:12] // Use first 12 chars of hash
+	if c.controlPersist <= 0 {
+		return fmt.Sprintf("ssh-%s-%d", hostHash, processID())
+	}
+	return fmt.Sprintf("ssh-%s", hostHash)
 }
 
 // getControlSocketDir returns the directory to use for SSH control sockets.
@@ -522,18 +1098,3 @@ func (c *Client) getControlSocketDir() string {
 	// Last resort: use temp directory
 	return filepath.Join(os.TempDir(), "perfgo")
 }
-
-// getRemoteCacheDir determines the cache directory on the remote host.
-func (c *Client) getRemoteCacheDir() (string, error) {
-	// Query remote host for XDG_CACHE_HOME or default
-	// Explicitly use /bin/sh to ensure POSIX shell compatibility
-	// (remote host may use fish or other non-POSIX shells by default)
-	getCacheDirCmd := `/bin/sh -c 'if [ -n "$XDG_CACHE_HOME" ]; then echo "$XDG_CACHE_HOME/perfgo"; elif [ -n "$HOME" ]; then echo "$HOME/.cache/perfgo"; else echo "/tmp/perfgo"; fi'`
-
-	cacheDir, _, err := c.RunCommand(getCacheDirCmd)
-	if err != nil {
-		return "", fmt.Errorf("failed to determine remote cache directory: %w", err)
-	}
-
-	return strings.TrimSpace(cacheDir), nil
-}
@@ -0,0 +1,539 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSSHArgs_PortAndUser(t *testing.T) {
+	c := &Client{
+		logger:      zerolog.Nop(),
+		host:        "bench@host.example.com",
+		controlPath: "/run/perfgo/ssh-abc",
+	}
+	WithPort(2222)(c)
+	WithUser("perf")(c)
+
+	require.Equal(t, []string{
+		"-o", "ControlPath=/run/perfgo/ssh-abc",
+		"-o", "ControlMaster=auto",
+		"-p", "2222",
+	}, c.buildSSHArgs())
+	assert.Equal(t, "perf@host.example.com", c.destination())
+	assert.Equal(t, "perf@host.example.com", c.Host())
+
+	// scp takes the port as -P
+	assert.Equal(t, []string{
+		"-o", "ControlPath=/run/perfgo/ssh-abc",
+		"-o", "ControlMaster=auto",
+		"-P", "2222",
+	}, c.buildSCPArgs())
+}
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		user string
+		want string
+	}{
+		{name: "bare host", host: "host", want: "host"},
+		{name: "host with user", host: "alice@host", want: "alice@host"},
+		{name: "user option on bare host", host: "host", user: "bob", want: "bob@host"},
+		{name: "user option overrides host user", host: "alice@host", user: "bob", want: "bob@host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{host: tt.host, user: tt.user}
+			assert.Equal(t, tt.want, c.destination())
+		})
+	}
+}
+
+func TestControlSocketName(t *testing.T) {
+	plain := &Client{host: "host"}
+	otherPort := &Client{host: "host", port: 2222}
+	otherUser := &Client{host: "host", user: "perf"}
+
+	persistent := &Client{host: "host", controlPersist: DefaultControlPersist}
+
+	assert.Regexp(t, `^ssh-[0-9a-f]{12}$`, persistent.controlSocketName())
+	assert.Equal(t, fmt.Sprintf("%s-%d", persistent.controlSocketName(), os.Getpid()), plain.controlSocketName())
+	assert.Equal(t, plain.controlSocketName(), (&Client{host: "host"}).controlSocketName())
+	assert.NotEqual(t, plain.controlSocketName(), otherPort.controlSocketName())
+	assert.NotEqual(t, plain.controlSocketName(), otherUser.controlSocketName())
+	assert.NotEqual(t, otherPort.controlSocketName(), otherUser.controlSocketName())
+
+	// Connections through other jump hosts or with other keys don't share a master
+	jump := &Client{host: "host", proxyJump: "bastion"}
+	otherJump := &Client{host: "host", proxyJump: "bastion-2"}
+	identity := &Client{host: "host", identityFile: "/keys/perf"}
+	assert.NotEqual(t, plain.controlSocketName(), jump.controlSocketName())
+	assert.NotEqual(t, jump.controlSocketName(), otherJump.controlSocketName())
+	assert.NotEqual(t, plain.controlSocketName(), identity.controlSocketName())
+	assert.Equal(t, jump.controlSocketName(), (&Client{host: "host", proxyJump: "bastion"}).controlSocketName())
+}
+
+func TestBuildSSHArgs_ProxyJump(t *testing.T) {
+	c := &Client{
+		logger:      zerolog.Nop(),
+		host:        "bench-01",
+		controlPath: "/run/perfgo/ssh-abc",
+	}
+	for _, opt := range []SSHOption{
+		WithIdentityFile("/keys/id_ed25519"),
+		WithKnownHostsFile("/keys/known_hosts"),
+		WithProxyJump("admin@bastion:2200"),
+	} {
+		opt(c)
+	}
+
+	require.Equal(t, []string{
+		"-o", "ControlPath=/run/perfgo/ssh-abc",
+		"-o", "ControlMaster=auto",
+		"-i", "/keys/id_ed25519",
+		"-o", "UserKnownHostsFile=/keys/known_hosts",
+		"-J", "admin@bastion:2200",
+	}, c.buildSSHArgs())
+
+	// The master connection is established with the same connection arguments
+	assert.Contains(t, c.connectionArgs(), "-J")
+}
+
+// installFlakySSH puts an ssh stand-in on PATH that fails with the given
+// stderr message for the first failures invocations, then succeeds. It
+// returns a function reporting the number of invocations.
+func installFlakySSH(t *testing.T, failures int, message string) func() int {
+	t.Helper()
+
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "count")
+	script := fmt.Sprintf(`#!/bin/sh
+n=$(cat %[1]q 2>/dev/null || echo 0)
+n=$((n + 1))
+echo "$n" > %[1]q
+if [ "$n" -le %[2]d ]; then
+	echo %[3]q >&2
+	exit 255
+fi
+`, counter, failures, message)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+
+	return func() int {
+		data, err := os.ReadFile(counter)
+		require.NoError(t, err)
+		n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		require.NoError(t, err)
+		return n
+	}
+}
+
+func TestNew_RetriesMasterConnection(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		message   string
+		attempts  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "succeeds after connection refused",
+			failures:  2,
+			message:   "ssh: connect to host bench port 22: Connection refused",
+			attempts:  5,
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up after max attempts",
+			failures:  10,
+			message:   "ssh: connect to host bench port 22: Connection timed out",
+			attempts:  3,
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name:      "does not retry auth failures",
+			failures:  10,
+			message:   "bench: Permission denied (publickey).",
+			attempts:  5,
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := installFlakySSH(t, tt.failures, tt.message)
+
+			c, err := New(zerolog.Nop(), "bench", WithConnectRetry(tt.attempts, time.Millisecond))
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.message)
+			} else {
+				require.NoError(t, err)
+				assert.NotEmpty(t, c.controlPath)
+			}
+			assert.Equal(t, tt.wantCalls, calls())
+		})
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	assert.True(t, isAuthFailure("root@pod: Permission denied (publickey)."))
+	assert.True(t, isAuthFailure("Host key verification failed."))
+	assert.False(t, isAuthFailure("ssh: connect to host bench port 22: Connection refused"))
+	assert.False(t, isAuthFailure("kex_exchange_identification: Connection closed by remote host"))
+}
+
+func TestNormalizeOS(t *testing.T) {
+	tests := []struct {
+		uname string
+		want  string
+	}{
+		{"Linux\n", "linux"},
+		{"Darwin", "darwin"},
+		{"FreeBSD", "freebsd"},
+		{"OpenBSD", "openbsd"},
+		{"NetBSD", "netbsd"},
+		{"DragonFly", "dragonfly"},
+		{"SunOS", "solaris"},
+		{"MINGW64_NT-10.0-19045", "windows"},
+		{"MSYS_NT-10.0-22631", "windows"},
+		{"CYGWIN_NT-10.0", "windows"},
+		{"Plan9", "plan9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uname, func(t *testing.T) {
+			assert.Equal(t, tt.want, NormalizeOS(tt.uname))
+		})
+	}
+}
+
+func TestNormalizeArch(t *testing.T) {
+	tests := []struct {
+		uname string
+		want  string
+	}{
+		{"x86_64\n", "amd64"},
+		{"amd64", "amd64"},
+		{"aarch64", "arm64"},
+		{"arm64", "arm64"},
+		{"i686", "386"},
+		{"i86pc", "386"},
+		{"armv6l", "arm"},
+		{"armv7l", "arm"},
+		{"riscv64", "riscv64"},
+		{"ppc64le", "ppc64le"},
+		{"s390x", "s390x"},
+		{"loongarch64", "loong64"},
+		{"sparc64", "sparc64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uname, func(t *testing.T) {
+			assert.Equal(t, tt.want, NormalizeArch(tt.uname))
+		})
+	}
+}
+
+func TestCopyBinaryToRemote_Runner(t *testing.T) {
+	fake := &runner.Fake{}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	WithPort(2222)(c)
+
+	remotePath, err := c.CopyBinaryToRemote("/tmp/build/perfgo.test", "/cache/repo")
+	require.NoError(t, err)
+	assert.Equal(t, "/cache/repo/perfgo.test", remotePath)
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 3)
+
+	// mkdir, scp with -P for the port, then chmod
+	assert.Equal(t, "ssh", cmds[0].Name)
+	assert.Equal(t, "mkdir -p /cache/repo", cmds[0].Args[len(cmds[0].Args)-1])
+	assert.Equal(t, "scp", cmds[1].Name)
+	assert.Contains(t, cmds[1].Args, "-P")
+	assert.Equal(t, []string{"/tmp/build/perfgo.test", "host:/cache/repo/perfgo.test"}, cmds[1].Args[len(cmds[1].Args)-2:])
+	assert.Equal(t, "chmod +x /cache/repo/perfgo.test", cmds[2].Args[len(cmds[2].Args)-1])
+}
+
+func TestRunCommand_RunnerError(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stderr: "uname: not found", Err: errors.New("exit status 127")}
+	}}
+	c := newTestClient()
+	WithRunner(fake)(c)
+
+	_, _, err := c.DetectSystem()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "uname: not found")
+}
+
+func TestMasterArgs(t *testing.T) {
+	c := &Client{logger: zerolog.Nop(), host: "bench-01", controlPersist: 10 * time.Minute}
+	WithPort(2222)(c)
+
+	args := c.masterArgs("/run/perfgo/ssh-abc")
+	assert.Equal(t, []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=/run/perfgo/ssh-abc",
+		"-o", "ControlPersist=600s",
+	}, args[:6])
+	assert.Contains(t, args, "2222")
+	assert.Equal(t, []string{"-f", "-N", "bench-01"}, args[len(args)-3:])
+
+	WithControlPersist(0)(c)
+	assert.Contains(t, c.masterArgs("/run/perfgo/ssh-abc"), "ControlPersist=no")
+}
+
+func TestControlPersistValue(t *testing.T) {
+	assert.Equal(t, "no", controlPersistValue(0))
+	assert.Equal(t, "1s", controlPersistValue(200*time.Millisecond))
+	assert.Equal(t, "30s", controlPersistValue(DefaultControlPersist))
+	assert.Equal(t, "90s", controlPersistValue(90*time.Second))
+}
+
+func TestSetupMultiplexing_ReusesLiveMaster(t *testing.T) {
+	tests := []struct {
+		name      string
+		socket    bool
+		checkErr  error
+		wantReuse bool
+		wantCmds  []string
+	}{
+		{
+			name:      "reuses live master",
+			socket:    true,
+			wantReuse: true,
+			wantCmds:  []string{"-O check"},
+		},
+		{
+			name:     "replaces stale socket",
+			socket:   true,
+			checkErr: errors.New("exit status 255"),
+			wantCmds: []string{"-O check", "-f -N"},
+		},
+		{
+			name:     "starts master without socket",
+			wantCmds: []string{"-f -N"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_RUNTIME_DIR", dir)
+
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				if slices.Contains(cmd.Args, "check") {
+					return runner.Result{Err: tt.checkErr, Stderr: "Control socket connect: Connection refused"}
+				}
+				return runner.Result{}
+			}}
+			c := &Client{logger: zerolog.Nop(), host: "bench-01", runner: fake, controlPersist: DefaultControlPersist}
+			socket := filepath.Join(dir, "perfgo", c.controlSocketName())
+			if tt.socket {
+				require.NoError(t, os.MkdirAll(filepath.Dir(socket), 0o700))
+				require.NoError(t, os.WriteFile(socket, nil, 0o600))
+			}
+
+			controlPath, err := c.setupMultiplexing()
+			require.NoError(t, err)
+			assert.Equal(t, socket, controlPath)
+			require.Contains(t, masters, controlPath)
+			assert.Equal(t, !tt.wantReuse, masters[controlPath].owned)
+			t.Cleanup(func() { releaseMaster(controlPath) })
+
+			cmds := fake.Commands()
+			require.Len(t, cmds, len(tt.wantCmds))
+			for i, want := range tt.wantCmds {
+				assert.Contains(t, strings.Join(cmds[i].Args, " "), want)
+			}
+
+			// A stale socket is removed, so the new master can bind the path
+			if tt.checkErr != nil {
+				assert.NoFileExists(t, socket)
+			}
+		})
+	}
+}
+
+// fakeMaster returns a runner standing in for ssh, whose master connection
+// command creates the control socket and whose exit command removes it.
+func fakeMaster(t *testing.T) *runner.Fake {
+	t.Helper()
+
+	return &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		var controlPath string
+		for _, arg := range cmd.Args {
+			if path, ok := strings.CutPrefix(arg, "ControlPath="); ok {
+				controlPath = path
+			}
+		}
+
+		if slices.Contains(cmd.Args, "-N") {
+			require.NoError(t, os.WriteFile(controlPath, nil, 0o600))
+			return runner.Result{}
+		}
+
+		switch {
+		case slices.Contains(cmd.Args, "check"):
+			if _, err := os.Stat(controlPath); err != nil {
+				return runner.Result{Err: errors.New("exit status 255")}
+			}
+		case slices.Contains(cmd.Args, "exit"):
+			require.NoError(t, os.Remove(controlPath))
+		}
+		return runner.Result{}
+	}}
+}
+
+// controlCommands returns the -O control commands fake received.
+func controlCommands(fake *runner.Fake) []string {
+	var ops []string
+	for _, cmd := range fake.Commands() {
+		if i := slices.Index(cmd.Args, "-O"); i >= 0 {
+			ops = append(ops, cmd.Args[i+1])
+		}
+	}
+	return ops
+}
+
+func TestClose_SharedMasterOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		persist time.Duration
+		// first closes the client which started the master first
+		ownerFirst bool
+		wantOps    []string
+	}{
+		{
+			name:       "owner closing first keeps master for other client",
+			ownerFirst: true,
+			wantOps:    []string{"check", "check", "exit"},
+		},
+		{
+			name:    "owner closing last exits master",
+			wantOps: []string{"check", "check", "exit"},
+		},
+		{
+			name:       "persisting master is kept",
+			persist:    DefaultControlPersist,
+			ownerFirst: true,
+			wantOps:    []string{"check"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+			fake := fakeMaster(t)
+
+			owner, err := New(zerolog.Nop(), "bench-01", WithRunner(fake), WithControlPersist(tt.persist))
+			require.NoError(t, err)
+			other, err := New(zerolog.Nop(), "bench-01", WithRunner(fake), WithControlPersist(tt.persist))
+			require.NoError(t, err)
+			require.Equal(t, owner.ControlPath(), other.ControlPath())
+
+			first, second := other, owner
+			if tt.ownerFirst {
+				first, second = owner, other
+			}
+
+			// The master stays up while any client of the process uses it
+			first.Close()
+			assert.FileExists(t, owner.ControlPath())
+
+			second.Close()
+			assert.Equal(t, tt.wantOps, controlCommands(fake))
+			assert.NotContains(t, masters, owner.ControlPath())
+		})
+	}
+}
+
+func TestClose_KeepsMasterOfOtherProcess(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	fake := fakeMaster(t)
+
+	// Another perfgo process left a live persisting master behind
+	c := &Client{logger: zerolog.Nop(), host: "bench-01", controlPersist: DefaultControlPersist}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "perfgo"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "perfgo", c.controlSocketName()), nil, 0o600))
+
+	c, err := New(zerolog.Nop(), "bench-01", WithRunner(fake), WithControlPersist(DefaultControlPersist))
+	require.NoError(t, err)
+	c.Close()
+
+	assert.Equal(t, []string{"check"}, controlCommands(fake))
+	assert.FileExists(t, c.ControlPath())
+}
+
+func TestClose_NonPersistentMasterOfOtherProcess(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	fake := fakeMaster(t)
+
+	// Two processes attach to the same host without persistence
+	first, err := New(zerolog.Nop(), "bench-01", WithRunner(fake), WithControlPersist(0))
+	require.NoError(t, err)
+	processID = func() int { return os.Getpid() + 1 }
+	t.Cleanup(func() { processID = os.Getpid })
+	second, err := New(zerolog.Nop(), "bench-01", WithRunner(fake), WithControlPersist(0))
+	require.NoError(t, err)
+	require.NotEqual(t, first.ControlPath(), second.ControlPath())
+
+	// The first one exiting its master leaves the other's session running
+	first.Close()
+	assert.NoFileExists(t, first.ControlPath())
+	assert.FileExists(t, second.ControlPath())
+
+	second.Close()
+	assert.Equal(t, []string{"check", "exit", "check", "exit"}, controlCommands(fake))
+}
+
+func TestRemoveRunFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows bool
+		want    string
+	}{
+		{"posix", false, "find '/cache/repositories/my repo-1a2b3c4d' -mindepth 1 -maxdepth 1 ! -name worktree -exec rm -rf {} +"},
+		{"windows", true, "Get-ChildItem -LiteralPath '/cache/repositories/my repo-1a2b3c4d' -ErrorAction SilentlyContinue | Where-Object Name -ne 'worktree' | Remove-Item -Recurse -Force"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{}
+			c := newTestClient()
+			c.windows = tt.windows
+			WithRunner(fake)(c)
+
+			require.NoError(t, c.RemoveRunFiles("/cache/repositories/my repo-1a2b3c4d"))
+			cmds := fake.Commands()
+			require.Len(t, cmds, 1)
+			command := cmds[0].Args[len(cmds[0].Args)-1]
+			if tt.windows {
+				command = decodePowerShellCommand(t, command)
+			}
+			assert.Equal(t, tt.want, command)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFromRemote(t *testing.T) {
+	content := bytes.Repeat([]byte("\x00\x7fELF binary\xff"), 100)
+	encoded := base64.StdEncoding.EncodeToString(content)
+
+	// base64 wraps its output at 76 characters
+	var wrapped strings.Builder
+	for len(encoded) > 76 {
+		wrapped.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	wrapped.WriteString(encoded + "\n")
+
+	tests := []struct {
+		name    string
+		result  runner.Result
+		want    []byte
+		wantErr string
+	}{
+		{name: "decoded", result: runner.Result{Stdout: wrapped.String()}, want: content},
+		{name: "invalid base64", result: runner.Result{Stdout: "not base64!\n"}, wantErr: "failed to decode base64"},
+		{name: "command failed", result: runner.Result{Stderr: "No such file", Err: errors.New("exit status 1")}, wantErr: "No such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return tt.result
+			}}
+			c := newTestClient()
+			WithRunner(fake)(c)
+
+			var buf bytes.Buffer
+			err := c.CopyFromRemote("/proc/42/root/usr/bin/app", &buf)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, buf.Bytes())
+
+			cmds := fake.Commands()
+			require.Len(t, cmds, 1)
+			assert.Equal(t, "base64 /proc/42/root/usr/bin/app", cmds[0].Args[len(cmds[0].Args)-1])
+		})
+	}
+}
+
+func TestTarSize(t *testing.T) {
+	writeUntracked(t, map[string]int{
+		"empty":       0,
+		"small.txt":   10,
+		"dir/exact":   512,
+		"dir/partial": 513,
+	})
+
+	// Header per file, content padded to blocks, two end blocks
+	want := int64(4*512 + 0 + 512 + 512 + 1024 + 2*512)
+	assert.Equal(t, want, tarSize([]string{"empty", "small.txt", "dir/exact", "dir/partial"}))
+}
+
+func TestProgress_NotTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	fake := &runner.Fake{}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	assert.Nil(t, c.Progress("Syncing", 100))
+
+	WithProgress(f)(c)
+	assert.Nil(t, c.Progress("Syncing", 100))
+
+	// The archive size is only estimated when progress is shown
+	assert.Zero(t, c.estimateArchiveSize(false))
+	assert.Empty(t, fake.Commands())
+}
@@ -0,0 +1,146 @@
+package ssh
+
+// rsync.go contains the rsync based incremental synchronisation of the
+// git working tree, used in favour of the tar upload when rsync is available
+// on both ends of the connection.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/perfgo/perfgo/cli/runner"
+)
+
+// syncMethod identifies how the working tree is transferred to the remote host.
+type syncMethod string
+
+const (
+	syncMethodTar   syncMethod = "tar"
+	syncMethodRsync syncMethod = "rsync"
+)
+
+// selectSyncMethod picks rsync when it is installed locally and remotely,
+// otherwise it falls back to streaming a tar archive.
+func selectSyncMethod(localRsync, remoteRsync bool) syncMethod {
+	if localRsync && remoteRsync {
+		return syncMethodRsync
+	}
+	return syncMethodTar
+}
+
+// detectSyncMethod checks for rsync on both ends of the connection.
+func (c *Client) detectSyncMethod() syncMethod {
+	_, err := exec.LookPath("rsync")
+	localRsync := err == nil
+
+	remoteRsync := false
+	if localRsync {
+		if _, _, err := c.RunCommand("command -v rsync"); err == nil {
+			remoteRsync = true
+		}
+	}
+
+	method := selectSyncMethod(localRsync, remoteRsync)
+	c.logger.Debug().
+		Bool("local_rsync", localRsync).
+		Bool("remote_rsync", remoteRsync).
+		Str("method", string(method)).
+		Msg("Selected sync method")
+
+	return method
+}
+
+// rsyncShell returns the remote shell command rsync uses to connect, reusing
+// the multiplexed control socket and all configured SSH options.
+func (c *Client) rsyncShell() string {
+	parts := []string{"ssh"}
+	for _, arg := range c.buildSSHArgs() {
+		parts = append(parts, shellescape.Quote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// buildRsyncArgs constructs the rsync arguments to mirror the current directory
+// into remoteDir, excluding the paths listed in excludeFile.
+func (c *Client) buildRsyncArgs(excludeFile, remoteDir string) []string {
+	args := []string{
+		"--archive",
+		"--compress",
+		"--delete",
+		"--exclude=/.git",
+	}
+
+	if excludeFile != "" {
+		args = append(args, "--exclude-from="+excludeFile)
+	}
+
+	args = append(args,
+		"-e", c.rsyncShell(),
+		"./",
+		fmt.Sprintf("%s:%s/", c.destination(), remoteDir),
+	)
+
+	return args
+}
+
+// buildRsyncExcludes converts the output of
+// `git ls-files --others --ignored --exclude-standard --directory`
+// into rsync exclude patterns anchored at the transfer root.
+func buildRsyncExcludes(ignored string) []string {
+	var excludes []string
+	for _, path := range strings.Split(ignored, "\n") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		excludes = append(excludes, "/"+path)
+	}
+	return excludes
+}
+
+// syncWithRsync mirrors the working tree to remoteDir using rsync, only
+// transferring files that changed since the last sync.
+func (c *Client) syncWithRsync(remoteDir string, noUntracked bool) error {
+	// Collect the files git ignores, so rsync skips them like the tar path does
+	ignored, _, err := c.cmdRunner().Run(context.Background(), "git", rsyncExcludeListArgs(noUntracked)...)
+	if err != nil {
+		return fmt.Errorf("failed to list ignored files: %w", err)
+	}
+
+	excludeFile, err := os.CreateTemp("", "perfgo-rsync-exclude-*")
+	if err != nil {
+		return fmt.Errorf("failed to create exclude file: %w", err)
+	}
+	defer os.Remove(excludeFile.Name())
+
+	excludes := buildRsyncExcludes(ignored)
+	if _, err := excludeFile.WriteString(strings.Join(excludes, "\n")); err != nil {
+		excludeFile.Close()
+		return fmt.Errorf("failed to write exclude file: %w", err)
+	}
+	if err := excludeFile.Close(); err != nil {
+		return fmt.Errorf("failed to write exclude file: %w", err)
+	}
+
+	args := c.buildRsyncArgs(excludeFile.Name(), remoteDir)
+	cmd := runner.Cmd{Name: "rsync", Args: args}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	c.logger.Debug().
+		Int("excludes", len(excludes)).
+		Str("command", cmd.String()).
+		Msg("Executing rsync")
+
+	if err := c.cmdRunner().Stream(context.Background(), cmd); err != nil {
+		return fmt.Errorf("rsync failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectSyncMethod(t *testing.T) {
+	tests := []struct {
+		name        string
+		localRsync  bool
+		remoteRsync bool
+		want        syncMethod
+	}{
+		{name: "rsync on both ends", localRsync: true, remoteRsync: true, want: syncMethodRsync},
+		{name: "rsync missing locally", localRsync: false, remoteRsync: true, want: syncMethodTar},
+		{name: "rsync missing remotely", localRsync: true, remoteRsync: false, want: syncMethodTar},
+		{name: "rsync missing everywhere", localRsync: false, remoteRsync: false, want: syncMethodTar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, selectSyncMethod(tt.localRsync, tt.remoteRsync))
+		})
+	}
+}
+
+func TestBuildRsyncArgs(t *testing.T) {
+	c := &Client{
+		logger:       zerolog.Nop(),
+		host:         "user@host",
+		controlPath:  "/run/perfgo/ssh-abc",
+		identityFile: "/keys/id ed25519",
+	}
+
+	args := c.buildRsyncArgs("/tmp/exclude", "/cache/repo/worktree")
+
+	require.Equal(t, []string{
+		"--archive",
+		"--compress",
+		"--delete",
+		"--exclude=/.git",
+		"--exclude-from=/tmp/exclude",
+		"-e", "ssh -o ControlPath=/run/perfgo/ssh-abc -o ControlMaster=auto -i '/keys/id ed25519'",
+		"./",
+		"user@host:/cache/repo/worktree/",
+	}, args)
+}
+
+func TestBuildRsyncExcludes(t *testing.T) {
+	excludes := buildRsyncExcludes("bin/\nperfgo.test\n\n.perfgo/\n")
+	assert.Equal(t, []string{"/bin/", "/perfgo.test", "/.perfgo/"}, excludes)
+
+	assert.Empty(t, buildRsyncExcludes(""))
+}
@@ -0,0 +1,112 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// installFakeSSH puts an ssh stand-in on PATH that runs the remote command
+// (its last argument) through the local shell. Commands that should be killed
+// on cancellation must exec, as the stand-in is the only process signalled.
+func installFakeSSH(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func newTestClient() *Client {
+	return &Client{
+		logger:      zerolog.Nop(),
+		host:        "host",
+		controlPath: "/nonexistent/ssh-test",
+	}
+}
+
+func TestRunCommandContext_Deadline(t *testing.T) {
+	installFakeSSH(t)
+	c := newTestClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := c.RunCommandContext(ctx, "exec sleep 5")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestRunCommand_CommandTimeout(t *testing.T) {
+	installFakeSSH(t)
+	c := newTestClient()
+	WithCommandTimeout(100 * time.Millisecond)(c)
+
+	start := time.Now()
+	_, _, err := c.RunCommand("exec sleep 5")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	stdout, _, err := c.RunCommand("echo ok")
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", stdout)
+}
+
+func TestCommandContext(t *testing.T) {
+	c := newTestClient()
+	ctx, cancel := c.CommandContext()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	WithCommandTimeout(time.Minute)(c)
+	ctx, cancel = c.CommandContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+func TestRun_StreamsStdout(t *testing.T) {
+	installFakeSSH(t)
+	c := newTestClient()
+
+	var stdout, stderr bytes.Buffer
+	err := c.Run("printf 'line1\\nline2\\n'; echo oops >&2", WithStdOut(&stdout), WithStdErr(&stderr))
+	require.NoError(t, err)
+	assert.Equal(t, "line1\nline2\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestRun_FeedsStdin(t *testing.T) {
+	installFakeSSH(t)
+	c := newTestClient()
+
+	var stdout bytes.Buffer
+	err := c.Run("tr a-z A-Z", WithStdIn(strings.NewReader("perf data\n")), WithStdOut(&stdout))
+	require.NoError(t, err)
+	assert.Equal(t, "PERF DATA\n", stdout.String())
+}
+
+func TestRun_ExitError(t *testing.T) {
+	installFakeSSH(t)
+	c := newTestClient()
+
+	err := c.Run("exit 3")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+}
@@ -0,0 +1,100 @@
+package ssh
+
+// shared.go contains support for a directory shared between the local
+// machine and the remote host (e.g., an NFS mount visible under the same path
+// on both ends). Files placed there don't need to be transferred over SSH.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// WithSharedPath sets a directory visible under the same path locally and on
+// the remote host. The remote repository directory is placed inside it, so
+// binaries and artifacts are accessed directly instead of being copied.
+func WithSharedPath(dir string) SSHOption {
+	return func(c *Client) {
+		if dir != "" {
+			c.sharedPath = path.Clean(filepath.ToSlash(dir))
+		}
+	}
+}
+
+// SharedPath returns the shared directory, or an empty string if none is set.
+func (c *Client) SharedPath() string {
+	return c.sharedPath
+}
+
+// IsShared reports whether remotePath lies within the shared directory and
+// can therefore be read locally.
+func (c *Client) IsShared(remotePath string) bool {
+	return isWithin(c.sharedPath, remotePath)
+}
+
+// isWithin reports whether p is dir or lies below it.
+func isWithin(dir, p string) bool {
+	if dir == "" || p == "" {
+		return false
+	}
+	p = path.Clean(p)
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// ValidateSharedPath checks that the shared directory exists locally and is
+// a writable directory on the remote host.
+func (c *Client) ValidateSharedPath() error {
+	if c.sharedPath == "" {
+		return nil
+	}
+
+	info, err := os.Stat(c.sharedPath)
+	if err != nil {
+		return fmt.Errorf("shared path %s not accessible locally: %w", c.sharedPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("shared path %s is not a directory", c.sharedPath)
+	}
+
+	quoted := shellescape.Quote(c.sharedPath)
+	checkCmd := fmt.Sprintf("test -d %s && test -w %s", quoted, quoted)
+	if _, _, err := c.RunCommand(checkCmd); err != nil {
+		return fmt.Errorf("shared path %s is not a writable directory on %s: %w", c.sharedPath, c.destination(), err)
+	}
+
+	return nil
+}
+
+// copyBinaryToShared copies a local binary into the shared directory, where
+// the remote host sees it at remotePath.
+func copyBinaryToShared(localPath, remotePath string) error {
+	if err := os.MkdirAll(filepath.Dir(remotePath), 0755); err != nil {
+		return fmt.Errorf("failed to create shared directory: %w", err)
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open binary: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(remotePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create shared binary: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to copy binary: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to copy binary: %w", err)
+	}
+
+	// The mode is only applied to new files, an existing binary may lack it
+	return os.Chmod(remotePath, 0755)
+}
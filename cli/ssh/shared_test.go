@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		dir  string
+		path string
+		want bool
+	}{
+		{dir: "/mnt/shared", path: "/mnt/shared/repositories/app/perfgo.test", want: true},
+		{dir: "/mnt/shared", path: "/mnt/shared", want: true},
+		{dir: "/mnt/shared", path: "/mnt/shared/../home/perfgo.test", want: false},
+		{dir: "/mnt/shared", path: "/mnt/shared-other/perfgo.test", want: false},
+		{dir: "/mnt/shared", path: "/home/user/.cache/perfgo/perfgo.test", want: false},
+		{dir: "/", path: "/anything", want: true},
+		{dir: "", path: "/mnt/shared/perfgo.test", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, isWithin(tt.dir, tt.path))
+		})
+	}
+}
+
+func TestCopyBinaryToRemote_Shared(t *testing.T) {
+	shared := t.TempDir()
+	binary := filepath.Join(t.TempDir(), "perfgo.test")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0644))
+
+	fake := &runner.Fake{}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	WithSharedPath(shared)(c)
+
+	remoteBaseDir := shared + "/repositories/app-12345678"
+	remotePath, err := c.CopyBinaryToRemote(binary, remoteBaseDir)
+	require.NoError(t, err)
+	assert.Equal(t, remoteBaseDir+"/perfgo.test", remotePath)
+
+	// Neither scp nor any remote command is needed
+	assert.Empty(t, fake.Commands())
+
+	data, err := os.ReadFile(remotePath)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(data))
+	info, err := os.Stat(remotePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func TestCopyBinaryToRemote_OutsideShared(t *testing.T) {
+	fake := &runner.Fake{}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	WithSharedPath(t.TempDir())(c)
+
+	_, err := c.CopyBinaryToRemote("/tmp/build/perfgo.test", "/cache/repo")
+	require.NoError(t, err)
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 3)
+	assert.Equal(t, "scp", cmds[1].Name)
+}
+
+func TestGetRemoteRepositoryDir_Shared(t *testing.T) {
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		return runner.Result{Stdout: "/src/app\n"}
+	}}
+	c := newTestClient()
+	WithRunner(fake)(c)
+	WithSharedPath("/mnt/shared/")(c)
+
+	dir, err := c.GetRemoteRepositoryDir()
+	require.NoError(t, err)
+	assert.Regexp(t, `^/mnt/shared/repositories/[^/]+-[0-9a-f]{8}$`, dir)
+
+	// Only git is asked, the remote cache directory is not looked up
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, "git", cmds[0].Name)
+}
+
+func TestValidateSharedPath(t *testing.T) {
+	shared := t.TempDir()
+	file := filepath.Join(shared, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteErr  error
+		wantErr    string
+		wantRemote bool
+	}{
+		{name: "unset"},
+		{name: "valid", path: shared, wantRemote: true},
+		{name: "missing locally", path: filepath.Join(shared, "missing"), wantErr: "not accessible locally"},
+		{name: "not a directory", path: file, wantErr: "is not a directory"},
+		{name: "missing remotely", path: shared, remoteErr: errors.New("exit status 1"), wantErr: "not a writable directory on host", wantRemote: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return runner.Result{Err: tt.remoteErr}
+			}}
+			c := newTestClient()
+			WithRunner(fake)(c)
+			WithSharedPath(tt.path)(c)
+
+			err := c.ValidateSharedPath()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			cmds := fake.Commands()
+			if tt.wantRemote {
+				require.Len(t, cmds, 1)
+				assert.Contains(t, cmds[0].Args[len(cmds[0].Args)-1], "test -d ")
+			} else {
+				assert.Empty(t, cmds)
+			}
+		})
+	}
+}
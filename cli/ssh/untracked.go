@@ -0,0 +1,169 @@
+package ssh
+
+// untracked.go contains the checks run before syncing the working tree:
+// untracked files are shipped to the remote host as well, so large build
+// caches or data fixtures lying around in the worktree are reported before
+// they are transferred.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/perfgo/perfgo/cli/progress"
+)
+
+// maxReportedUntracked is the number of largest untracked files listed when
+// the untracked files exceed the warning size.
+const maxReportedUntracked = 5
+
+// syncOptions holds the settings of a single working tree sync.
+type syncOptions struct {
+	warnSize    int64
+	strict      bool
+	noUntracked bool
+	confirm     func(msg string) bool
+}
+
+// SyncOption configures how the working tree is synced.
+type SyncOption func(*syncOptions)
+
+// WithSyncWarnSize reports the largest untracked files when their total size
+// exceeds size bytes. Zero disables the check.
+func WithSyncWarnSize(size int64) SyncOption {
+	return func(o *syncOptions) {
+		o.warnSize = size
+	}
+}
+
+// WithStrictSync fails the sync instead of warning when the untracked files
+// exceed the warning size.
+func WithStrictSync(strict bool) SyncOption {
+	return func(o *syncOptions) {
+		o.strict = strict
+	}
+}
+
+// WithNoUntracked syncs tracked files only.
+func WithNoUntracked(noUntracked bool) SyncOption {
+	return func(o *syncOptions) {
+		o.noUntracked = noUntracked
+	}
+}
+
+// WithSyncConfirm asks confirm whether to continue when the untracked files
+// exceed the warning size. Without it the sync continues after logging a
+// warning.
+func WithSyncConfirm(confirm func(msg string) bool) SyncOption {
+	return func(o *syncOptions) {
+		o.confirm = confirm
+	}
+}
+
+// untrackedFile is an untracked file that would be synced.
+type untrackedFile struct {
+	Path string
+	Size int64
+}
+
+// splitNul splits NUL separated git output (-z) into paths.
+func splitNul(output string) []string {
+	var paths []string
+	for _, path := range strings.Split(output, "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// statUntracked returns the untracked files sorted by size, largest first,
+// together with their total size. Files vanishing in between are skipped.
+func statUntracked(paths []string) ([]untrackedFile, int64) {
+	files := make([]untrackedFile, 0, len(paths))
+	var total int64
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, untrackedFile{Path: path, Size: info.Size()})
+		total += info.Size()
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	return files, total
+}
+
+// untrackedSizeMessage describes the untracked files exceeding the warning
+// size, listing the largest ones.
+func untrackedSizeMessage(files []untrackedFile, total, warnSize int64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "untracked files to sync total %s (%d files), exceeding %s; largest:", progress.FormatBytes(total), len(files), progress.FormatBytes(warnSize))
+	for i := 0; i < len(files) && i < maxReportedUntracked; i++ {
+		fmt.Fprintf(&b, "\n  %10s  %s", progress.FormatBytes(files[i].Size), files[i].Path)
+	}
+	b.WriteString("\nuse --no-untracked to sync tracked files only or add them to .gitignore")
+	return b.String()
+}
+
+// checkUntracked sums the sizes of the untracked files that would be synced
+// and warns, asks for confirmation or fails when they exceed the warning size.
+func (c *Client) checkUntracked(opts *syncOptions) error {
+	if opts.noUntracked || opts.warnSize <= 0 {
+		return nil
+	}
+
+	output, _, err := c.cmdRunner().Run(context.Background(), "git", "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return fmt.Errorf("failed to list untracked files: %w", err)
+	}
+
+	files, total := statUntracked(splitNul(output))
+	c.logger.Debug().
+		Int("files", len(files)).
+		Int64("bytes", total).
+		Msg("Scanned untracked files")
+
+	if total <= opts.warnSize {
+		return nil
+	}
+
+	msg := untrackedSizeMessage(files, total, opts.warnSize)
+	switch {
+	case opts.strict:
+		return fmt.Errorf("%s", msg)
+	case opts.confirm != nil:
+		if !opts.confirm(msg) {
+			return fmt.Errorf("sync aborted: untracked files total %s", progress.FormatBytes(total))
+		}
+	default:
+		c.logger.Warn().Msg(msg)
+	}
+
+	return nil
+}
+
+// tarFileList returns the shell command listing the files to archive, NUL
+// separated. Tracked files include uncommitted modifications, untracked
+// files respect .gitignore.
+func tarFileList(noUntracked bool) string {
+	if noUntracked {
+		return "git ls-files -z"
+	}
+	return "(git ls-files -z; git ls-files --others --exclude-standard -z)"
+}
+
+// rsyncExcludeListArgs returns the git arguments listing the paths rsync
+// excludes: the ignored files, or every untracked file when only tracked
+// files are synced.
+func rsyncExcludeListArgs(noUntracked bool) []string {
+	if noUntracked {
+		return []string{"ls-files", "--others", "--directory"}
+	}
+	return []string{"ls-files", "--others", "--ignored", "--exclude-standard", "--directory"}
+}
@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeUntracked creates files of the given sizes in a temporary directory
+// and changes into it.
+func writeUntracked(t *testing.T, sizes map[string]int) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for path, size := range sizes {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	}
+}
+
+func TestStatUntracked(t *testing.T) {
+	writeUntracked(t, map[string]int{
+		"small.txt":         10,
+		"cache/big.bin":     3000,
+		"testdata/mid.json": 500,
+	})
+	require.NoError(t, os.Symlink("cache/big.bin", "link"))
+
+	files, total := statUntracked(splitNul("small.txt\x00cache/big.bin\x00testdata/mid.json\x00link\x00gone.txt\x00"))
+	assert.Equal(t, int64(3510), total)
+	assert.Equal(t, []untrackedFile{
+		{Path: "cache/big.bin", Size: 3000},
+		{Path: "testdata/mid.json", Size: 500},
+		{Path: "small.txt", Size: 10},
+	}, files)
+}
+
+func TestUntrackedSizeMessage(t *testing.T) {
+	var files []untrackedFile
+	for i := 0; i < 7; i++ {
+		files = append(files, untrackedFile{Path: "file" + string(rune('a'+i)), Size: int64(7-i) << 20})
+	}
+
+	msg := untrackedSizeMessage(files, 28<<20, 10<<20)
+	assert.Contains(t, msg, "total 28.0 MB (7 files), exceeding 10.0 MB")
+	assert.Contains(t, msg, "7.0 MB  filea")
+	assert.Contains(t, msg, "filee")
+	assert.NotContains(t, msg, "filef")
+	assert.NotContains(t, msg, "fileg")
+}
+
+func TestSyncFileList_NoUntracked(t *testing.T) {
+	assert.Equal(t, "(git ls-files -z; git ls-files --others --exclude-standard -z)", tarFileList(false))
+	assert.Equal(t, "git ls-files -z", tarFileList(true))
+
+	assert.Equal(t, []string{"ls-files", "--others", "--ignored", "--exclude-standard", "--directory"}, rsyncExcludeListArgs(false))
+	assert.Equal(t, []string{"ls-files", "--others", "--directory"}, rsyncExcludeListArgs(true))
+}
+
+func TestCheckUntracked(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      syncOptions
+		confirm   bool
+		wantErr   string
+		wantGit   bool
+		wantAsked bool
+	}{
+		{name: "below threshold", opts: syncOptions{warnSize: 1 << 20}, wantGit: true},
+		{name: "warn only", opts: syncOptions{warnSize: 1000}, wantGit: true},
+		{name: "strict", opts: syncOptions{warnSize: 1000, strict: true}, wantErr: "exceeding 1000 B", wantGit: true},
+		{name: "confirmed", opts: syncOptions{warnSize: 1000}, confirm: true, wantGit: true, wantAsked: true},
+		{name: "declined", opts: syncOptions{warnSize: 1000}, wantErr: "sync aborted", wantGit: true, wantAsked: true},
+		{name: "disabled", opts: syncOptions{}},
+		{name: "no untracked", opts: syncOptions{warnSize: 1000, noUntracked: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeUntracked(t, map[string]int{"data.bin": 4096})
+
+			fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+				return runner.Result{Stdout: "data.bin\x00"}
+			}}
+			c := newTestClient()
+			WithRunner(fake)(c)
+
+			asked := false
+			opts := tt.opts
+			if tt.wantAsked {
+				opts.confirm = func(msg string) bool {
+					asked = true
+					assert.Contains(t, msg, "data.bin")
+					return tt.confirm
+				}
+			}
+
+			err := c.checkUntracked(&opts)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAsked, asked)
+
+			cmds := fake.Commands()
+			if tt.wantGit {
+				require.Len(t, cmds, 1)
+				assert.Equal(t, "git ls-files --others --exclude-standard -z", cmds[0].String())
+			} else {
+				assert.Empty(t, cmds)
+			}
+		})
+	}
+}
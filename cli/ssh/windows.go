@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// The default shell of OpenSSH on Windows is cmd.exe, but it may be
+// configured to be PowerShell. Commands for Windows hosts are therefore run as
+// an encoded PowerShell script, which is passed through either shell verbatim
+// and leaves no quoting to the remote default shell.
+
+// detectWindowsCmd prints the platform and architecture of a Windows host.
+const detectWindowsCmd = "[Environment]::OSVersion.Platform; $env:PROCESSOR_ARCHITECTURE"
+
+// IsWindows reports whether DetectSystem found a Windows remote host.
+func (c *Client) IsWindows() bool {
+	return c.windows
+}
+
+// detectWindows checks whether the remote host runs Windows, where uname is
+// not available. It returns the architecture in Go's GOARCH format.
+func (c *Client) detectWindows() (string, bool) {
+	stdout, _, err := c.RunCommand(PowerShellCommand(detectWindowsCmd))
+	if err != nil {
+		return "", false
+	}
+
+	lines := strings.Fields(stdout)
+	if len(lines) != 2 || !strings.EqualFold(lines[0], "Win32NT") {
+		return "", false
+	}
+	return NormalizeWindowsArch(lines[1]), true
+}
+
+// NormalizeWindowsArch converts %PROCESSOR_ARCHITECTURE% to Go's GOARCH
+// format. Unknown architectures are returned lowercased.
+func NormalizeWindowsArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	switch arch {
+	case "x86":
+		return "386"
+	case "arm":
+		return "arm"
+	}
+	return NormalizeArch(arch)
+}
+
+// PowerShellQuote quotes s as a literal PowerShell string.
+func PowerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// PowerShellCommand returns the command line running script with PowerShell.
+// The script is passed UTF-16 and base64 encoded, so it is safe to run from
+// both cmd.exe and PowerShell as the remote default shell.
+func PowerShellCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	encoded := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(encoded[2*i:], u)
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(encoded)
+}
+
+// mkdirCommand returns the command creating dir and its parents on the
+// remote host.
+func (c *Client) mkdirCommand(dir string) string {
+	if c.windows {
+		return PowerShellCommand(fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | Out-Null", PowerShellQuote(dir)))
+	}
+	return fmt.Sprintf("mkdir -p %s", shellescape.Quote(dir))
+}
+
+// extractCommand returns the command extracting a gzipped tar archive read
+// from stdin into dir. Windows ships bsdtar as tar.exe since Windows 10.
+func (c *Client) extractCommand(dir string) string {
+	if c.windows {
+		// Run tar directly, PowerShell does not pass its stdin on to commands
+		return fmt.Sprintf(`tar -xzf - -C "%s"`, dir)
+	}
+	return fmt.Sprintf("cd %s && tar -xzf -", shellescape.Quote(dir))
+}
+
+// RemoveAll removes path and everything it contains on the remote host.
+func (c *Client) RemoveAll(path string) error {
+	command := fmt.Sprintf("rm -rf %s", shellescape.Quote(path))
+	if c.windows {
+		command = PowerShellCommand(fmt.Sprintf("Remove-Item -Recurse -Force -LiteralPath %s -ErrorAction SilentlyContinue", PowerShellQuote(path)))
+	}
+	if _, _, err := c.RunCommand(command); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// windowsCacheDirCmd prints the cache directory on a Windows host.
+const windowsCacheDirCmd = `if ($env:LOCALAPPDATA) { Join-Path $env:LOCALAPPDATA 'perfgo' } else { Join-Path $env:TEMP 'perfgo' }`
@@ -0,0 +1,174 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodePowerShellCommand returns the script of a command built by
+// PowerShellCommand.
+func decodePowerShellCommand(t *testing.T, command string) string {
+	t.Helper()
+	encoded, ok := strings.CutPrefix(command, "powershell -NoProfile -NonInteractive -EncodedCommand ")
+	require.True(t, ok, "not a PowerShell command: %s", command)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	require.Zero(t, len(data)%2)
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestPowerShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{`C:\Users\dev\perfgo.test.exe`, `'C:\Users\dev\perfgo.test.exe'`},
+		{"it's", "'it''s'"},
+		{"$env:PATH; rm -r /", "'$env:PATH; rm -r /'"},
+		{`-test.run=^Foo "bar"$`, `'-test.run=^Foo "bar"$'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, PowerShellQuote(tt.in))
+		})
+	}
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	script := "Set-Location -LiteralPath 'C:/perfgo/ü'; & 'x.exe' 'a b'"
+	command := PowerShellCommand(script)
+
+	// Only characters without a special meaning to cmd.exe and PowerShell
+	assert.NotContains(t, command, "'")
+	assert.NotContains(t, command, "&")
+	assert.Equal(t, script, decodePowerShellCommand(t, command))
+}
+
+func TestNormalizeWindowsArch(t *testing.T) {
+	tests := []struct {
+		arch string
+		want string
+	}{
+		{"AMD64", "amd64"},
+		{"ARM64", "arm64"},
+		{"x86", "386"},
+		{"ARM", "arm"},
+		{"IA64\r\n", "ia64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			assert.Equal(t, tt.want, NormalizeWindowsArch(tt.arch))
+		})
+	}
+}
+
+// windowsRunner answers commands like an OpenSSH server on Windows.
+func windowsRunner(t *testing.T) *runner.Fake {
+	return &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		command := cmd.Args[len(cmd.Args)-1]
+		if cmd.Name != "ssh" || !strings.HasPrefix(command, "powershell ") {
+			return runner.Result{}
+		}
+		switch decodePowerShellCommand(t, command) {
+		case detectWindowsCmd:
+			return runner.Result{Stdout: "Win32NT\r\nAMD64\r\n"}
+		case windowsCacheDirCmd:
+			return runner.Result{Stdout: "C:\\Users\\dev\\AppData\\Local\\perfgo\r\n"}
+		}
+		return runner.Result{}
+	}}
+}
+
+func TestDetectSystem_Windows(t *testing.T) {
+	fake := windowsRunner(t)
+	uname := fake.Handler
+	fake.Handler = func(cmd runner.Cmd) runner.Result {
+		if strings.HasPrefix(cmd.Args[len(cmd.Args)-1], "uname") {
+			return runner.Result{Stderr: "'uname' is not recognized as an internal or external command", Err: errors.New("exit status 1")}
+		}
+		return uname(cmd)
+	}
+	c := newTestClient()
+	WithRunner(fake)(c)
+
+	osName, arch, err := c.DetectSystem()
+	require.NoError(t, err)
+	assert.Equal(t, "windows", osName)
+	assert.Equal(t, "amd64", arch)
+	assert.True(t, c.IsWindows())
+
+	cacheDir, err := c.getRemoteCacheDir()
+	require.NoError(t, err)
+	assert.Equal(t, "C:/Users/dev/AppData/Local/perfgo", cacheDir)
+}
+
+func TestCopyBinaryToRemote_Windows(t *testing.T) {
+	fake := windowsRunner(t)
+	c := newTestClient()
+	c.windows = true
+	WithRunner(fake)(c)
+
+	remotePath, err := c.CopyBinaryToRemote("/tmp/build/perfgo.test.exe", "C:/cache/repo")
+	require.NoError(t, err)
+	assert.Equal(t, "C:/cache/repo/perfgo.test.exe", remotePath)
+
+	// mkdir and scp, Windows has no chmod
+	cmds := fake.Commands()
+	require.Len(t, cmds, 2)
+	assert.Equal(t, "New-Item -ItemType Directory -Force -Path 'C:/cache/repo' | Out-Null", decodePowerShellCommand(t, cmds[0].Args[len(cmds[0].Args)-1]))
+	assert.Equal(t, "scp", cmds[1].Name)
+	assert.Equal(t, "host:C:/cache/repo/perfgo.test.exe", cmds[1].Args[len(cmds[1].Args)-1])
+}
+
+func TestRemoveAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows bool
+		want    string
+	}{
+		{"posix", false, "rm -rf '/cache/my repo'"},
+		{"windows", true, "Remove-Item -Recurse -Force -LiteralPath '/cache/my repo' -ErrorAction SilentlyContinue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{}
+			c := newTestClient()
+			c.windows = tt.windows
+			WithRunner(fake)(c)
+
+			require.NoError(t, c.RemoveAll("/cache/my repo"))
+			cmds := fake.Commands()
+			require.Len(t, cmds, 1)
+			command := cmds[0].Args[len(cmds[0].Args)-1]
+			if tt.windows {
+				command = decodePowerShellCommand(t, command)
+			}
+			assert.Equal(t, tt.want, command)
+		})
+	}
+}
+
+func TestMkdirCommand(t *testing.T) {
+	c := newTestClient()
+	assert.Equal(t, "mkdir -p '/home/user/perf cache/repositories'", c.mkdirCommand("/home/user/perf cache/repositories"))
+	assert.Equal(t, "cd '/home/user/perf cache/worktree' && tar -xzf -", c.extractCommand("/home/user/perf cache/worktree"))
+
+	c.windows = true
+	assert.Equal(t, "New-Item -ItemType Directory -Force -Path '/home/user/perf cache' | Out-Null", decodePowerShellCommand(t, c.mkdirCommand("/home/user/perf cache")))
+}
@@ -0,0 +1,118 @@
+package cli
+
+// This file contains the stat-compare command, which compares the perf stat
+// counters of two runs recorded with --repeat and tells which changes are
+// significant.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/perfgo/perfgo/perfstat"
+	"github.com/urfave/cli/v2"
+)
+
+// parseStatCompareArgs returns the history entry references of the old and
+// the new run. They default to the 2nd last and the last run.
+func parseStatCompareArgs(in []string) (oldArg, newArg string, err error) {
+	switch len(in) {
+	case 0:
+		return "-1", "0", nil
+	case 1:
+		return in[0], "0", nil
+	case 2:
+		return in[0], in[1], nil
+	default:
+		return "", "", fmt.Errorf("expected [OLD] [NEW], got %d arguments", len(in))
+	}
+}
+
+// statRuns returns the perf stat counters of each run of entry, which are
+// kept per run by --repeat.
+func statRuns(entry *history.Entry) ([][]perfstat.Counter, error) {
+	shortID := entry.History.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+
+	var runs [][]perfstat.Counter
+	for _, artifact := range entry.History.Artifacts {
+		if artifact.Type != model.ArtifactTypePerfStatRun {
+			continue
+		}
+		data, err := os.ReadFile(resolveArtifactPath(entry.FullPath, artifact))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read perf stat counters of %s: %w", shortID, err)
+		}
+		runs = append(runs, perfstat.ParseCSV(string(data)))
+	}
+
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("history entry %s has no perf stat counters per run, stat-compare requires runs of 'perfgo test stat --repeat N'", shortID)
+	}
+	return runs, nil
+}
+
+// writeStatCompareEntry writes the line identifying entry in the comparison.
+func writeStatCompareEntry(w io.Writer, label string, h model.History) {
+	fmt.Fprintf(w, "%s: %s %s", label, h.ID[:8], h.Timestamp.Format("2006-01-02 15:04:05"))
+	if h.Git != nil && h.Git.Commit != "" {
+		fmt.Fprintf(w, " %s%s", h.Git.Commit[:8], gitRefSuffix(h.Git))
+	}
+	if len(h.Args) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(h.Args, " "))
+	}
+	fmt.Fprintln(w)
+}
+
+func (a *App) statCompare(ctx *cli.Context) error {
+	oldArg, newArg, err := parseStatCompareArgs(ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	perfgoRoot, err := history.GetPerfgoRoot(a.outputDir)
+	if err != nil {
+		return err
+	}
+	historyEntries, err := history.LoadEntries(a.logger, perfgoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	oldEntry, err := findEntry(historyEntries, oldArg)
+	if err != nil {
+		return err
+	}
+	newEntry, err := findEntry(historyEntries, newArg)
+	if err != nil {
+		return err
+	}
+
+	oldRuns, err := statRuns(oldEntry)
+	if err != nil {
+		return err
+	}
+	newRuns, err := statRuns(newEntry)
+	if err != nil {
+		return err
+	}
+
+	comparisons := perfstat.Compare(oldRuns, newRuns, perfstat.DefaultAlpha)
+	if len(comparisons) == 0 {
+		return fmt.Errorf("runs %s and %s have no perf stat events in common", oldEntry.History.ID[:8], newEntry.History.ID[:8])
+	}
+
+	writeStatCompareEntry(os.Stdout, "old", oldEntry.History)
+	writeStatCompareEntry(os.Stdout, "new", newEntry.History)
+	fmt.Println()
+	if err := perfstat.WriteComparisons(os.Stdout, comparisons); err != nil {
+		return err
+	}
+	fmt.Printf("\n~ marks deltas that are not significant (p >= %.2f, Welch's t-test)\n", perfstat.DefaultAlpha)
+	return nil
+}
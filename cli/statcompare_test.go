@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/perfgo/perfgo/perfstat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatCompareArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		wantOld string
+		wantNew string
+		wantErr bool
+	}{
+		{name: "defaults", in: nil, wantOld: "-1", wantNew: "0"},
+		{name: "old only", in: []string{"-2"}, wantOld: "-2", wantNew: "0"},
+		{name: "old and new", in: []string{"abc123", "def456"}, wantOld: "abc123", wantNew: "def456"},
+		{name: "too many", in: []string{"-2", "-1", "0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldArg, newArg, err := parseStatCompareArgs(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOld, oldArg)
+			assert.Equal(t, tt.wantNew, newArg)
+		})
+	}
+}
+
+func TestStatRuns(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "perf-stat.1.csv"), []byte("100,,cycles,,100.00\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "perf-stat.2.csv"), []byte("120,,cycles,,100.00\n"), 0o644))
+
+	entry := &history.Entry{
+		FullPath: dir,
+		History: model.History{
+			ID: "0123456789abcdef",
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypePerfStatRun, File: "perf-stat.1.csv"},
+				{Type: model.ArtifactTypePerfStatRun, File: "perf-stat.2.csv"},
+				{Type: model.ArtifactTypePerfStat, File: "perf-stat.txt"},
+			},
+		},
+	}
+
+	runs, err := statRuns(entry)
+	require.NoError(t, err)
+	assert.Equal(t, [][]perfstat.Counter{
+		{{Event: "cycles", Value: 100, Counted: true, Running: 100}},
+		{{Event: "cycles", Value: 120, Counted: true, Running: 100}},
+	}, runs)
+
+	// Single runs keep no counters per run
+	entry.History.Artifacts = entry.History.Artifacts[2:]
+	_, err = statRuns(entry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "history entry 01234567 has no perf stat counters per run")
+}
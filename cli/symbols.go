@@ -0,0 +1,163 @@
+package cli
+
+// This file contains support for symbol files (unstripped binaries or .debug
+// files) stored with a run, which view and annotate use instead of the
+// archived binaries of the matching mappings.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+// symbolsFlag returns the flag associating symbol files with a profile run.
+func symbolsFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "symbols",
+		Usage: "Unstripped binary or .debug file to symbolize the profile with, matched by GNU build-id or file name (NAME=PATH to match binary NAME, can be repeated)",
+	}
+}
+
+// symbolFile is a symbol file given with --symbols.
+type symbolFile struct {
+	// Basename of the binary the symbols belong to
+	Name string
+	// Path of the symbol file
+	Path string
+}
+
+// parseSymbolFiles parses the --symbols values, either NAME=PATH or a path
+// whose basename, without a .debug suffix, names the binary.
+func parseSymbolFiles(specs []string) ([]symbolFile, error) {
+	files := make([]symbolFile, 0, len(specs))
+	for _, spec := range specs {
+		name, path, ok := strings.Cut(spec, "=")
+		if !ok {
+			path = spec
+			name = strings.TrimSuffix(filepath.Base(path), ".debug")
+		}
+		if name == "" || path == "" {
+			return nil, fmt.Errorf("invalid --symbols %q, expected PATH or NAME=PATH", spec)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --symbols %q: %w", spec, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("invalid --symbols %q: not a regular file", spec)
+		}
+
+		files = append(files, symbolFile{Name: name, Path: path})
+	}
+	return files, nil
+}
+
+// elfBuildID returns the GNU build-id of the ELF file at path, or an empty
+// string if it has none or isn't an ELF file.
+func elfBuildID(path string) string {
+	f, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := f.Section(".note.gnu.build-id")
+	if section == nil {
+		return ""
+	}
+	data, err := section.Data()
+	if err != nil {
+		return ""
+	}
+	return parseBuildIDNote(data, f.ByteOrder)
+}
+
+// ntGNUBuildID is the type of the GNU build-id note.
+const ntGNUBuildID = 3
+
+// parseBuildIDNote returns the build-id of a GNU build-id note: the name and
+// descriptor sizes and the note type, followed by the 4-byte aligned name
+// "GNU" and the build-id as descriptor.
+func parseBuildIDNote(note []byte, order binary.ByteOrder) string {
+	const headerSize = 12
+	if len(note) < headerSize {
+		return ""
+	}
+	nameSize := int(order.Uint32(note[0:4]))
+	descSize := int(order.Uint32(note[4:8]))
+	noteType := order.Uint32(note[8:12])
+
+	descStart := headerSize + (nameSize+3)&^3
+	if noteType != ntGNUBuildID || descStart+descSize > len(note) {
+		return ""
+	}
+	if !bytes.Equal(note[headerSize:headerSize+nameSize], []byte("GNU\x00")) {
+		return ""
+	}
+	return hex.EncodeToString(note[descStart : descStart+descSize])
+}
+
+// saveSymbolFiles stores the symbol files of the run in runDir as
+// <hash>.<name>.symbols and registers them as artifacts.
+func (a *App) saveSymbolFiles(runDir string, history *model.History) error {
+	for _, file := range a.symbolFiles {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read symbol file: %w", err)
+		}
+
+		hashBytes := sha256.Sum256(data)
+		hash := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(hashBytes[:]))
+		filename := hash + "." + file.Name + ".symbols"
+		if err := os.WriteFile(filepath.Join(runDir, filename), data, 0644); err != nil {
+			return fmt.Errorf("failed to write symbol file: %w", err)
+		}
+
+		buildID := elfBuildID(file.Path)
+		history.Artifacts = append(history.Artifacts, model.Artifact{
+			Type:    model.ArtifactTypeSymbols,
+			Size:    uint64(len(data)),
+			File:    filename,
+			BuildID: buildID,
+		})
+		a.logger.Debug().
+			Str("path", file.Path).
+			Str("name", file.Name).
+			Str("build_id", buildID).
+			Msg("Saved symbol file")
+	}
+	return nil
+}
+
+// storedSymbolFiles returns the paths of the symbol files stored in runDir
+// by build-id and by the name of the binary they belong to.
+func storedSymbolFiles(runDir string, artifacts []model.Artifact) (byBuildID, byName map[string]string) {
+	byBuildID = make(map[string]string)
+	byName = make(map[string]string)
+	for _, artifact := range artifacts {
+		if artifact.Type != model.ArtifactTypeSymbols {
+			continue
+		}
+
+		path := filepath.Join(runDir, artifact.File)
+		if artifact.BuildID != "" {
+			byBuildID[artifact.BuildID] = path
+		}
+		trimmed := strings.TrimSuffix(artifact.File, ".symbols")
+		if _, name, ok := strings.Cut(trimmed, "."); ok && name != "" {
+			byName[name] = path
+		}
+	}
+	return byBuildID, byName
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildIDNote returns a note section entry with the given name, type and
+// descriptor.
+func buildIDNote(order binary.ByteOrder, name string, noteType uint32, desc []byte) []byte {
+	note := make([]byte, 12)
+	order.PutUint32(note[0:4], uint32(len(name)))
+	order.PutUint32(note[4:8], uint32(len(desc)))
+	order.PutUint32(note[8:12], noteType)
+	note = append(note, name...)
+	for len(note)%4 != 0 {
+		note = append(note, 0)
+	}
+	return append(note, desc...)
+}
+
+func TestParseBuildIDNote(t *testing.T) {
+	desc := []byte{0xa1, 0xb2, 0xc3, 0xd4, 0xe5}
+	tests := []struct {
+		name  string
+		note  []byte
+		order binary.ByteOrder
+		want  string
+	}{
+		{name: "little endian", note: buildIDNote(binary.LittleEndian, "GNU\x00", ntGNUBuildID, desc), order: binary.LittleEndian, want: "a1b2c3d4e5"},
+		{name: "big endian", note: buildIDNote(binary.BigEndian, "GNU\x00", ntGNUBuildID, desc), order: binary.BigEndian, want: "a1b2c3d4e5"},
+		{name: "other note type", note: buildIDNote(binary.LittleEndian, "GNU\x00", 1, desc), order: binary.LittleEndian},
+		{name: "other owner", note: buildIDNote(binary.LittleEndian, "Go\x00\x00", ntGNUBuildID, desc), order: binary.LittleEndian},
+		{name: "truncated", note: buildIDNote(binary.LittleEndian, "GNU\x00", ntGNUBuildID, desc)[:18], order: binary.LittleEndian},
+		{name: "empty", order: binary.LittleEndian},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseBuildIDNote(tt.note, tt.order))
+		})
+	}
+}
+
+func TestElfBuildID_NotELF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perfgo.test.debug")
+	require.NoError(t, os.WriteFile(path, []byte("not an ELF file"), 0o644))
+	assert.Empty(t, elfBuildID(path))
+}
+
+func TestParseSymbolFiles(t *testing.T) {
+	dir := t.TempDir()
+	debugFile := filepath.Join(dir, "perfgo.test.debug")
+	require.NoError(t, os.WriteFile(debugFile, []byte("symbols"), 0o644))
+
+	files, err := parseSymbolFiles([]string{debugFile, "myapp=" + debugFile})
+	require.NoError(t, err)
+	assert.Equal(t, []symbolFile{
+		{Name: "perfgo.test", Path: debugFile},
+		{Name: "myapp", Path: debugFile},
+	}, files)
+
+	_, err = parseSymbolFiles([]string{filepath.Join(dir, "missing.debug")})
+	assert.Error(t, err)
+
+	_, err = parseSymbolFiles([]string{dir})
+	assert.ErrorContains(t, err, "not a regular file")
+
+	_, err = parseSymbolFiles([]string{"=" + debugFile})
+	assert.ErrorContains(t, err, "expected PATH or NAME=PATH")
+}
+
+func TestPprofProfile_SymbolFiles(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "history", "20250101-120000-aaaaaaaa-11111111")
+	require.NoError(t, os.MkdirAll(runDir, 0o755))
+
+	tmp := t.TempDir()
+	testBinary := filepath.Join(tmp, "perfgo.test")
+	require.NoError(t, os.WriteFile(testBinary, []byte("stripped binary"), 0o755))
+	testSymbols := filepath.Join(tmp, "perfgo.test.debug")
+	require.NoError(t, os.WriteFile(testSymbols, []byte("test symbols"), 0o644))
+	libSymbols := filepath.Join(tmp, "libother.debug")
+	require.NoError(t, os.WriteFile(libSymbols, []byte("library symbols"), 0o644))
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Mapping: []*profile.Mapping{
+			{ID: 1, File: testBinary},
+			{ID: 2, File: "/usr/lib/libfoo.so", BuildID: "a1b2c3d4"},
+		},
+	}
+	f, err := os.Create(filepath.Join(runDir, "perf.pb.gz"))
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	symbolFiles, err := parseSymbolFiles([]string{testSymbols, libSymbols})
+	require.NoError(t, err)
+	a := &App{logger: zerolog.Nop(), runState: runState{symbolFiles: symbolFiles}}
+	h := &model.History{}
+	require.NoError(t, a.saveArtifacts(runDir, h, testBinary))
+
+	var symbols []model.Artifact
+	for _, artifact := range h.Artifacts {
+		if artifact.Type == model.ArtifactTypeSymbols {
+			symbols = append(symbols, artifact)
+		}
+	}
+	require.Len(t, symbols, 2)
+
+	// Associate the library symbols by build-id, as if read from the file
+	for i := range h.Artifacts {
+		if h.Artifacts[i].File == symbols[1].File {
+			h.Artifacts[i].BuildID = "a1b2c3d4"
+		}
+	}
+
+	var profileArtifact *model.Artifact
+	for i := range h.Artifacts {
+		if h.Artifacts[i].Type == model.ArtifactTypePprofProfile {
+			profileArtifact = &h.Artifacts[i]
+		}
+	}
+	require.NotNil(t, profileArtifact)
+
+	entry := &history.Entry{History: *h, FullPath: runDir}
+	profilePath, cleanup, err := a.pprofProfile(entry, profileArtifact)
+	require.NoError(t, err)
+	defer cleanup()
+
+	f, err = os.Open(profilePath)
+	require.NoError(t, err)
+	defer f.Close()
+	handed, err := profile.Parse(f)
+	require.NoError(t, err)
+
+	// Symbol files take precedence over the archived binary
+	require.Len(t, handed.Mapping, 2)
+	assert.Equal(t, filepath.Join(runDir, symbols[0].File), handed.Mapping[0].File)
+	assert.Equal(t, filepath.Join(runDir, symbols[1].File), handed.Mapping[1].File)
+
+	data, err := os.ReadFile(handed.Mapping[0].File)
+	require.NoError(t, err)
+	assert.Equal(t, "test symbols", string(data))
+}
@@ -0,0 +1,104 @@
+package cli
+
+// This file contains the options controlling how the working tree is synced
+// to a remote host.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/perfgo/perfgo/cli/progress"
+	"github.com/perfgo/perfgo/cli/ssh"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultSyncWarnSize is the total size of untracked files above which a
+// sync warns.
+const defaultSyncWarnSize = "100MB"
+
+// byteSizeUnits maps size suffixes to their multiplier. Units are binary, so
+// 1MB is 1024*1024 bytes.
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GIB", 1 << 30}, {"GB", 1 << 30}, {"G", 1 << 30},
+	{"MIB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+	{"KIB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as 512, 64KB or 1.5GB into bytes.
+func parseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500KB, 100MB or 2GB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// syncFlags returns the flags controlling the working tree sync to remote hosts.
+func syncFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sync-warn-size",
+			Usage: "Warn when untracked files synced to the remote host exceed this size (0 disables)",
+			Value: defaultSyncWarnSize,
+		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "Fail instead of warning when untracked files exceed --sync-warn-size",
+		},
+		&cli.BoolFlag{
+			Name:  "no-untracked",
+			Usage: "Only sync files tracked by git to the remote host",
+		},
+	}
+}
+
+// syncOptions builds the sync options from the sync flags. Outside of strict
+// mode an interactive terminal is asked for confirmation.
+func (a *App) syncOptions(ctx *cli.Context) ([]ssh.SyncOption, error) {
+	warnSize, err := parseByteSize(ctx.String("sync-warn-size"))
+	if err != nil {
+		return nil, fmt.Errorf("--sync-warn-size: %w", err)
+	}
+
+	opts := []ssh.SyncOption{
+		ssh.WithSyncWarnSize(warnSize),
+		ssh.WithStrictSync(ctx.Bool("strict")),
+		ssh.WithNoUntracked(ctx.Bool("no-untracked")),
+	}
+	if progress.IsTerminal(os.Stdin) {
+		opts = append(opts, ssh.WithSyncConfirm(func(msg string) bool {
+			return confirm(os.Stdin, os.Stderr, msg+"\nContinue syncing?")
+		}))
+	}
+	return opts, nil
+}
+
+// confirm prints question to w and reports whether the answer read from r
+// is yes.
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
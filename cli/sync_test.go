@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "0", want: 0},
+		{input: "512", want: 512},
+		{input: "512B", want: 512},
+		{input: "64KB", want: 64 << 10},
+		{input: "100MB", want: 100 << 20},
+		{input: "100mb", want: 100 << 20},
+		{input: "1.5GiB", want: 3 << 29},
+		{input: "2 G", want: 2 << 30},
+		{input: "lots", wantErr: true},
+		{input: "-1MB", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseByteSize(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{answer: "y\n", want: true},
+		{answer: "YES\n", want: true},
+		{answer: "n\n", want: false},
+		{answer: "\n", want: false},
+		{answer: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.answer), func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Equal(t, tt.want, confirm(strings.NewReader(tt.answer), &out, "Continue?"))
+			assert.Equal(t, "Continue? [y/N] ", out.String())
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package cli
+
+// This file contains the system command, which runs perf on all CPUs of the
+// local machine or an SSH host for a fixed duration.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/cpu"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
+	"github.com/urfave/cli/v2"
+)
+
+func (a *App) systemStat(ctx *cli.Context) error {
+	return a.runSystem(ctx, "stat")
+}
+
+func (a *App) systemProfile(ctx *cli.Context) error {
+	return a.runSystem(ctx, "profile")
+}
+
+// systemFlags returns the flags shared by all system subcommands, followed by
+// the given mode-specific flags.
+func systemFlags(extra ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "remote-host",
+			Usage: "SSH host to run perf on instead of this machine",
+		},
+		&cli.IntFlag{
+			Name:  "ssh-port",
+			Usage: "SSH port of the remote host",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-user",
+			Usage: "SSH login user for the remote host (overrides user@ in --remote-host)",
+		},
+		&cli.StringFlag{
+			Name:  "ssh-jump",
+			Usage: "Bastion host(s) to reach the remote host through (ssh -J syntax)",
+		},
+		sshPersistFlag(),
+		commandTimeoutFlag(),
+		perf.DurationFlag(),
+	}
+	return append(flags, extra...)
+}
+
+// runSystem runs perf in mode on all CPUs for --duration seconds, on
+// --remote-host or this machine, and records the run as attach run.
+func (a *App) runSystem(ctx *cli.Context, mode string) (retErr error) {
+	startTime := time.Now()
+
+	if err := validateFlags(ctx); err != nil {
+		return err
+	}
+
+	perfOpts, err := a.parseAttachOptions(ctx, mode)
+	if err != nil {
+		return err
+	}
+	perfOpts.systemWide = true
+
+	// Without a bound perf would sample all CPUs until interrupted
+	if perfOpts.duration <= 0 {
+		return fmt.Errorf("invalid --duration %d: must be a positive number of seconds", perfOpts.duration)
+	}
+
+	// Generate unique run ID
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	runID := hex.EncodeToString(idBytes)
+
+	// Prepare history recording
+	history := newAttachHistory(runID, startTime, "", "")
+	history.Attach.SystemWide = true
+
+	// Capture working directory
+	if cwd, err := os.Getwd(); err == nil {
+		history.WorkDir = cwd
+	}
+
+	// Capture git info (non-fatal if it fails)
+	if info, err := a.getGitInfo(); err == nil {
+		history.Git = info
+	}
+
+	// Create history directory early so artifacts can be written directly to it
+	runDir, err := a.prepareHistoryDir(history)
+	if err != nil {
+		return fmt.Errorf("failed to prepare history directory: %w", err)
+	}
+
+	// Track stdout and stderr content
+	var stdoutContent, stderrContent string
+
+	defer func() {
+		history.Duration = time.Since(startTime)
+		if retErr != nil {
+			if exitErr, ok := retErr.(*exec.ExitError); ok {
+				history.ExitCode = exitErr.ExitCode()
+			} else {
+				history.ExitCode = 1
+			}
+		}
+
+		// Record the history (non-fatal if it fails)
+		if err := a.recordHistory(history, runDir, "", stdoutContent, stderrContent); err != nil {
+			a.logger.Warn().Err(err).Msg("Failed to record history")
+		}
+	}()
+
+	if remoteHost := ctx.String("remote-host"); remoteHost != "" {
+		return a.attachHost(ctx, mode, remoteHost, perfOpts, runDir, history, &stdoutContent, &stderrContent)
+	}
+	return a.systemLocal(ctx, mode, perfOpts, runDir, history, &stdoutContent, &stderrContent)
+}
+
+// systemLocal runs perf in mode on all CPUs of this machine and archives the
+// results in runDir.
+func (a *App) systemLocal(ctx *cli.Context, mode string, opts attachOptions, runDir string, history *model.History, stdout, stderr *string) error {
+	history.Target = &model.Target{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		Vendor: cpu.DetectLocalVendor(),
+	}
+	history.Target.KernelRelease, history.Target.PerfVersion = detectVersions(a.localShellExec)
+
+	if _, _, err := a.localShellExec("command -v perf"); err != nil {
+		return fmt.Errorf("perf not found on this machine, install it (see perfgo doctor): %w", err)
+	}
+	if err := a.checkPerfEvents("", localEventLister, requestedEvents(opts.event)); err != nil {
+		return err
+	}
+
+	perfCtx, perfCancel := perfRunContext(opts.duration, ctx.Duration("command-timeout"))
+	defer perfCancel()
+
+	switch mode {
+	case "stat":
+		history.Perf = &model.Perf{
+			Stat: &model.PerfStat{
+				Events:      opts.events,
+				Duration:    opts.duration,
+				Detail:      opts.detail,
+				Aggregation: opts.statAggregation.Mode(),
+			},
+		}
+
+		statOpts := perf.StatOptions{
+			Events:          opts.events,
+			Duration:        opts.duration,
+			SystemWide:      true,
+			Detail:          opts.detail,
+			StatAggregation: opts.statAggregation,
+		}
+		if err := a.runLocalPerf(perfCtx, perf.BuildStatArgs(statOpts), stdout, stderr); err != nil {
+			return fmt.Errorf("perf stat failed: %w", err)
+		}
+
+		// perf stat writes the counts to stderr
+		return a.saveStatArtifact(runDir, history, *stderr, opts.detail)
+	case "profile":
+		perfDataPath, cleanup, err := a.localPerfDataPath(false)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		recordOpts := perf.RecordOptions{
+			Event:        opts.event,
+			Count:        opts.count,
+			Duration:     opts.duration,
+			OutputPath:   perfDataPath,
+			SystemWide:   true,
+			BranchStack:  ctx.Bool("branch-stack"),
+			BranchFilter: ctx.String("branch-filter"),
+		}
+		history.Perf = &model.Perf{
+			Record: &model.PerfRecord{
+				Event:        opts.event,
+				Count:        opts.count,
+				Duration:     opts.duration,
+				BranchStack:  recordOpts.BranchStack,
+				BranchFilter: recordOpts.BranchFilter,
+				DefaultEvent: ctx.String("default-event"),
+			},
+		}
+
+		if err := a.runLocalPerf(perfCtx, perf.BuildRecordArgs(recordOpts), stdout, stderr); err != nil {
+			return fmt.Errorf("perf record failed: %w", err)
+		}
+
+		profilePath := filepath.Join(runDir, "perf.pb.gz")
+		binaryArtifacts, err := perf.ConvertPerfToPprof(a.logger, perfDataPath, profilePath, runDir, history.ID, recordOpts.HasBranchStack())
+		if errors.Is(err, perf.ErrNoSamples) {
+			history.Warnings = append(history.Warnings, err.Error())
+		} else if err != nil {
+			return fmt.Errorf("failed to convert performance data to pprof: %w", err)
+		}
+		registerBinaryArtifacts(history, binaryArtifacts)
+		a.savePerfData(nil, perfDataPath, runDir, history)
+		return nil
+	}
+	return fmt.Errorf("unsupported system mode %q", mode)
+}
+
+// runLocalPerf runs perf with args on this machine, showing and capturing its
+// output.
+func (a *App) runLocalPerf(ctx context.Context, args []string, stdout, stderr *string) error {
+	a.logger.Info().Strs("args", args).Msg("Running perf on all CPUs")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd := runner.Cmd{
+		Name:   "perf",
+		Args:   args,
+		Stdout: io.MultiWriter(os.Stdout, &stdoutBuf),
+		Stderr: io.MultiWriter(os.Stderr, &stderrBuf),
+	}
+	err := a.cmdRunner().Stream(ctx, cmd)
+	*stdout = stdoutBuf.String()
+	*stderr = stderrBuf.String()
+	if err != nil {
+		return perf.CommandError(err, *stderr, "")
+	}
+	return nil
+}
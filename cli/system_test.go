@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemStat_Local(t *testing.T) {
+	t.Chdir(t.TempDir())
+	outputDir := t.TempDir()
+
+	const statOutput = " Performance counter stats for 'system wide':\n\n     1,234      cycles\n"
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		if cmd.Name == "perf" {
+			return runner.Result{Stderr: statOutput}
+		}
+		return runner.Result{}
+	}}
+	app := New(WithRunner(fake), WithLogger(zerolog.Nop()))
+	captureStdout(t, func() {
+		require.NoError(t, app.Run([]string{AppName, "--output-dir", outputDir, "system", "stat", "--duration", "2", "--per-socket"}))
+	})
+
+	var perfCmd runner.Cmd
+	for _, cmd := range fake.Commands() {
+		if cmd.Name == "perf" {
+			perfCmd = cmd
+		}
+	}
+	assert.Equal(t, []string{"stat", "-d", "--per-socket", "-a", "sleep", "2"}, perfCmd.Args)
+
+	entries, err := history.LoadEntries(zerolog.Nop(), outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	h := entries[0].History
+	assert.Equal(t, model.HistoryTypeAttach, h.Type)
+	assert.Equal(t, 0, h.ExitCode)
+	require.NotNil(t, h.Attach)
+	assert.True(t, h.Attach.SystemWide)
+	require.NotNil(t, h.Perf.Stat)
+	assert.Equal(t, "socket", h.Perf.Stat.Aggregation)
+	assert.Empty(t, h.Perf.Stat.PIDs)
+
+	var stat *model.Artifact
+	for i := range h.Artifacts {
+		if h.Artifacts[i].Type == model.ArtifactTypePerfStatDetailed {
+			stat = &h.Artifacts[i]
+		}
+	}
+	require.NotNil(t, stat, "perf stat output not registered")
+	data, err := os.ReadFile(filepath.Join(entries[0].FullPath, stat.File))
+	require.NoError(t, err)
+	assert.Equal(t, statOutput, string(data))
+}
+
+func TestSystemStat_PerfMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	outputDir := t.TempDir()
+
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		if cmd.Name == "sh" && cmd.Args[len(cmd.Args)-1] == "command -v perf" {
+			return runner.Result{Err: errors.New("exit status 127")}
+		}
+		return runner.Result{}
+	}}
+	app := New(WithRunner(fake), WithLogger(zerolog.Nop()))
+	err := app.Run([]string{AppName, "--output-dir", outputDir, "system", "stat"})
+	require.ErrorContains(t, err, "perf not found on this machine")
+
+	// The failed run is recorded
+	entries, err := history.LoadEntries(zerolog.Nop(), outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].History.ExitCode)
+}
+
+func TestSystem_InvalidFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "zero duration",
+			args:    []string{"system", "profile", "--duration", "0"},
+			wantErr: "invalid --duration 0: must be a positive number of seconds",
+		},
+		{
+			name:    "ssh port without remote host",
+			args:    []string{"system", "stat", "--ssh-port", "2222"},
+			wantErr: "--ssh-port requires --remote-host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &runner.Fake{}
+			app := New(WithRunner(fake), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+			err := app.Run(append([]string{AppName}, tt.args...))
+			require.EqualError(t, err, tt.wantErr)
+			assert.Empty(t, fake.Commands())
+		})
+	}
+}
@@ -6,32 +6,21 @@ package cli
 import (
 	"fmt"
 	"strings"
-
-	gocmd "github.com/perfgo/perfgo/cli/go"
 )
 
-// validateTestPath validates that a Go package path is valid.
-// It uses 'go list' to check if the package pattern is valid and ensures
-// that only a single package matches (not a pattern that matches multiple packages).
-func (a *App) validateTestPath(path string) error {
-	packages, err := gocmd.List(path)
-	if err != nil {
-		return err
-	}
-
-	// Ensure only one package matches
-	if len(packages) > 1 {
-		return fmt.Errorf("package pattern %q matches multiple packages (%d total), please specify a single package path", path, len(packages))
-	}
-
-	return nil
-}
-
 func (a *App) getPackagePath(buildArgs []string) string {
 	// Look for package path in build args
 	// Package paths typically look like: ./..., ./pkg/..., ./cmd/api, etc.
 	// Default to current directory if not specified
-	for _, arg := range buildArgs {
+	for i := 0; i < len(buildArgs); i++ {
+		arg := buildArgs[i]
+
+		// Skip the values of build flags (e.g., -tags integration)
+		if _, separateValue := buildOnlyFlag(arg); separateValue {
+			i++
+			continue
+		}
+
 		// Check if it's a package path (not a flag)
 		if !strings.HasPrefix(arg, "-") {
 			// Clean up the path
@@ -51,34 +40,102 @@ func (a *App) getPackagePath(buildArgs []string) string {
 	return "."
 }
 
-func (a *App) separateTestArgs(args []string) (buildArgs, runtimeArgs []string) {
-	// Build-only flags (used during go test -c)
-	buildOnlyFlags := map[string]bool{
-		"-tags":       true,
-		"-race":       true,
-		"-msan":       true,
-		"-asan":       true,
-		"-cover":      true,
-		"-covermode":  true,
-		"-coverpkg":   true,
-		"-gcflags":    true,
-		"-ldflags":    true,
-		"-asmflags":   true,
-		"-gccgoflags": true,
-		"-mod":        true,
-		"-modfile":    true,
-		"-overlay":    true,
-		"-pkgdir":     true,
-		"-toolexec":   true,
-		"-work":       true,
+// runtimeValueFlags are the test binary flags taking a value. A value given
+// as a separate argument always belongs to the flag, even if it looks like a
+// package path (e.g., -run TestFoo/...) or a flag.
+var runtimeValueFlags = map[string]bool{
+	"bench":                true,
+	"benchtime":            true,
+	"blockprofile":         true,
+	"blockprofilerate":     true,
+	"count":                true,
+	"coverprofile":         true,
+	"cpu":                  true,
+	"cpuprofile":           true,
+	"fuzz":                 true,
+	"fuzzminimizetime":     true,
+	"fuzztime":             true,
+	"list":                 true,
+	"memprofile":           true,
+	"memprofilerate":       true,
+	"mutexprofile":         true,
+	"mutexprofilefraction": true,
+	"outputdir":            true,
+	"parallel":             true,
+	"run":                  true,
+	"shuffle":              true,
+	"skip":                 true,
+	"timeout":              true,
+	"trace":                true,
+}
+
+// isRuntimeValueFlag reports whether arg is a test binary flag taking a
+// value that is passed as the next argument. Flags may use the -test. prefix.
+func isRuntimeValueFlag(arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
 	}
+	name := strings.TrimLeft(arg, "-")
+	name = strings.TrimPrefix(name, "test.")
+	return runtimeValueFlags[name]
+}
 
+// buildOnlyFlags are the go test flags used when building the test binary,
+// mapped to whether they take a value. A value given as a separate argument
+// always belongs to the flag, even if it looks like a flag itself (e.g.,
+// -ldflags "-X main.version=1" or -gcflags "-N -l").
+var buildOnlyFlags = map[string]bool{
+	"tags":       true,
+	"race":       false,
+	"msan":       false,
+	"asan":       false,
+	"cover":      false,
+	"covermode":  true,
+	"coverpkg":   true,
+	"gcflags":    true,
+	"ldflags":    true,
+	"asmflags":   true,
+	"gccgoflags": true,
+	"mod":        true,
+	"modfile":    true,
+	"overlay":    true,
+	"pkgdir":     true,
+	"toolexec":   true,
+	"work":       false,
+}
+
+// buildOnlyFlag reports whether arg is a build-only flag, given as -name,
+// --name or with an attached -name=value, and whether its value is passed as
+// the next argument.
+func buildOnlyFlag(arg string) (isBuild, separateValue bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return false, false
+	}
+	name, _, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+	takesValue, ok := buildOnlyFlags[name]
+	if !ok {
+		return false, false
+	}
+	return true, takesValue && !hasValue
+}
+
+func (a *App) separateTestArgs(args []string) (buildArgs, runtimeArgs []string) {
 	buildArgs = []string{}
 	runtimeArgs = []string{}
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
+		// Runtime flags keep their value, whatever it looks like
+		if isRuntimeValueFlag(arg) {
+			runtimeArgs = append(runtimeArgs, arg)
+			if i+1 < len(args) {
+				i++
+				runtimeArgs = append(runtimeArgs, args[i])
+			}
+			continue
+		}
+
 		// Skip package paths (they're only for build, not execution)
 		if strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../") ||
 			arg == "..." || strings.Contains(arg, "/...") {
@@ -86,27 +143,16 @@ func (a *App) separateTestArgs(args []string) (buildArgs, runtimeArgs []string)
 			continue
 		}
 
-		// Check if it's a build-only flag
-		if buildOnlyFlags[arg] {
+		// Check if it's a build-only flag, keeping a separate value with it
+		if isBuild, separateValue := buildOnlyFlag(arg); isBuild {
 			buildArgs = append(buildArgs, arg)
-			// Some flags take a value, include it
-			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			if separateValue && i+1 < len(args) {
 				i++
 				buildArgs = append(buildArgs, args[i])
 			}
 			continue
 		}
 
-		// Check if it's a build-only flag with = syntax (e.g., -tags=foo)
-		flagName := arg
-		if idx := strings.Index(arg, "="); idx > 0 {
-			flagName = arg[:idx]
-		}
-		if buildOnlyFlags[flagName] {
-			buildArgs = append(buildArgs, arg)
-			continue
-		}
-
 		// Everything else is a runtime arg
 		runtimeArgs = append(runtimeArgs, arg)
 	}
@@ -146,3 +192,41 @@ func (a *App) transformTestFlags(args []string) []string {
 
 	return transformed
 }
+
+// benchmarkOptions holds the convenience flags for running benchmarks.
+type benchmarkOptions struct {
+	bench     string // Benchmark regexp (-test.bench)
+	benchtime string // Benchmark run time or iteration count (-test.benchtime)
+	benchmem  bool   // Report memory allocations (-test.benchmem)
+}
+
+// addBenchmarkArgs appends the runtime args synthesized from the benchmark
+// flags. Flags the user already passed explicitly take precedence and are
+// not added again.
+func addBenchmarkArgs(args []string, opts benchmarkOptions) []string {
+	explicit := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		name = strings.TrimPrefix(name, "test.")
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name = name[:idx]
+		}
+		explicit[name] = true
+	}
+
+	result := append([]string{}, args...)
+	if opts.bench != "" && !explicit["bench"] {
+		result = append(result, "-test.bench="+opts.bench)
+	}
+	if opts.benchtime != "" && !explicit["benchtime"] {
+		result = append(result, "-test.benchtime="+opts.benchtime)
+	}
+	if opts.benchmem && !explicit["benchmem"] {
+		result = append(result, "-test.benchmem")
+	}
+
+	return result
+}
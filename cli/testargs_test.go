@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddBenchmarkArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		opts benchmarkOptions
+		want []string
+	}{
+		{
+			name: "no benchmark flags",
+			args: []string{"-run=^$"},
+			want: []string{"-run=^$"},
+		},
+		{
+			name: "all benchmark flags",
+			args: []string{"-run=^$"},
+			opts: benchmarkOptions{bench: ".", benchtime: "10s", benchmem: true},
+			want: []string{"-run=^$", "-test.bench=.", "-test.benchtime=10s", "-test.benchmem"},
+		},
+		{
+			name: "explicit bench wins",
+			args: []string{"-bench=NoPadding"},
+			opts: benchmarkOptions{bench: ".", benchmem: true},
+			want: []string{"-bench=NoPadding", "-test.benchmem"},
+		},
+		{
+			name: "explicit benchtime with separate value wins",
+			args: []string{"-benchtime", "1000x"},
+			opts: benchmarkOptions{bench: ".", benchtime: "10s"},
+			want: []string{"-benchtime", "1000x", "-test.bench=."},
+		},
+		{
+			name: "explicit -test. prefixed flags win",
+			args: []string{"-test.bench=Foo", "-test.benchmem"},
+			opts: benchmarkOptions{bench: ".", benchmem: true},
+			want: []string{"-test.bench=Foo", "-test.benchmem"},
+		},
+		{
+			name: "benchmem does not shadow bench",
+			args: []string{"-benchmem"},
+			opts: benchmarkOptions{bench: "."},
+			want: []string{"-benchmem", "-test.bench=."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, addBenchmarkArgs(tt.args, tt.opts))
+		})
+	}
+}
+
+func TestAddBenchmarkArgs_Transformed(t *testing.T) {
+	a := &App{}
+	args := addBenchmarkArgs([]string{"-run=^$", "-count", "5"}, benchmarkOptions{bench: ".", benchtime: "100x"})
+	assert.Equal(t,
+		[]string{"-test.run=^$", "-test.count", "5", "-test.bench=.", "-test.benchtime=100x"},
+		a.transformTestFlags(args),
+	)
+}
+
+func TestSeparateTestArgs(t *testing.T) {
+	a := &App{}
+	tests := []struct {
+		name        string
+		args        []string
+		wantBuild   []string
+		wantRuntime []string
+	}{
+		{
+			name:        "run before package pattern",
+			args:        []string{"-run", "TestX", "./pkg/..."},
+			wantBuild:   []string{"./pkg/..."},
+			wantRuntime: []string{"-run", "TestX"},
+		},
+		{
+			name:        "run value looking like a pattern",
+			args:        []string{"./pkg", "-run", "TestX/..."},
+			wantBuild:   []string{"./pkg"},
+			wantRuntime: []string{"-run", "TestX/..."},
+		},
+		{
+			name:        "count with equals",
+			args:        []string{"./pkg", "-count=5"},
+			wantBuild:   []string{"./pkg"},
+			wantRuntime: []string{"-count=5"},
+		},
+		{
+			name:        "timeout with separate value",
+			args:        []string{"./pkg", "-timeout", "30s", "-v"},
+			wantBuild:   []string{"./pkg"},
+			wantRuntime: []string{"-timeout", "30s", "-v"},
+		},
+		{
+			name:        "test prefixed flag",
+			args:        []string{"-test.run", "./x", "./pkg"},
+			wantBuild:   []string{"./pkg"},
+			wantRuntime: []string{"-test.run", "./x"},
+		},
+		{
+			name:        "build flags with values",
+			args:        []string{"./pkg", "-tags", "integration", "-bench", ".", "-race"},
+			wantBuild:   []string{"./pkg", "-tags", "integration", "-race"},
+			wantRuntime: []string{"-bench", "."},
+		},
+		{
+			name:        "ldflags value looking like a flag",
+			args:        []string{"./pkg", "-ldflags", "-X main.x=y", "-run", "TestX"},
+			wantBuild:   []string{"./pkg", "-ldflags", "-X main.x=y"},
+			wantRuntime: []string{"-run", "TestX"},
+		},
+		{
+			name:        "tags value with spaces",
+			args:        []string{"./pkg", "-tags", "integration netgo", "-v"},
+			wantBuild:   []string{"./pkg", "-tags", "integration netgo"},
+			wantRuntime: []string{"-v"},
+		},
+		{
+			name:        "gcflags with double dash",
+			args:        []string{"./pkg", "--gcflags", "-N -l", "-bench", "."},
+			wantBuild:   []string{"./pkg", "--gcflags", "-N -l"},
+			wantRuntime: []string{"-bench", "."},
+		},
+		{
+			name:        "build flags with equals",
+			args:        []string{"./pkg", "-ldflags=-s -w", "-tags=netgo", "-race"},
+			wantBuild:   []string{"./pkg", "-ldflags=-s -w", "-tags=netgo", "-race"},
+			wantRuntime: []string{},
+		},
+		{
+			name:        "boolean build flag before runtime flag",
+			args:        []string{"./pkg", "-cover", "-v"},
+			wantBuild:   []string{"./pkg", "-cover"},
+			wantRuntime: []string{"-v"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			build, runtime := a.separateTestArgs(tt.args)
+			assert.Equal(t, tt.wantBuild, build)
+			assert.Equal(t, tt.wantRuntime, runtime)
+		})
+	}
+}
+
+func TestBuildTestBinary_BuildFlagsIntact(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		// go test -c -o <binary>
+		require.NoError(t, os.WriteFile(cmd.Args[3], nil, 0o755))
+		return runner.Result{}
+	}}
+	a := &App{logger: zerolog.Nop(), runner: fake, runState: runState{noBuildCache: true}}
+
+	buildArgs, runtimeArgs := a.separateTestArgs([]string{
+		"./pkg", "-ldflags", "-X main.x=y", "-tags", "integration netgo", "-bench", ".",
+	})
+	assert.Equal(t, []string{"-bench", "."}, runtimeArgs)
+
+	// Cross-compiling for a remote host
+	_, err := a.buildTestBinary("linux", "arm64", "", buildArgs)
+	require.NoError(t, err)
+
+	cmds := fake.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, "go", cmds[0].Name)
+	require.Len(t, cmds[0].Args, 9)
+	assert.Equal(t, "perfgo.test.linux.arm64", filepath.Base(cmds[0].Args[3]))
+	assert.Equal(t, []string{
+		"test", "-c", "-o", cmds[0].Args[3],
+		"./pkg", "-ldflags", "-X main.x=y", "-tags", "integration netgo",
+	}, cmds[0].Args)
+}
@@ -0,0 +1,160 @@
+package cli
+
+// This file contains the --tid and --comm options of view, which narrow a
+// profile down to the samples of one thread before opening it in pprof.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/perfscript"
+)
+
+// threadFilter selects samples by the thread labels perfgo records: the
+// thread ID and the command name. Zero fields match any thread.
+type threadFilter struct {
+	TID  int64
+	Comm string
+}
+
+// empty reports whether f matches all samples.
+func (f threadFilter) empty() bool {
+	return f.TID == 0 && f.Comm == ""
+}
+
+// String describes f for messages, e.g. "tid 4242 and comm worker".
+func (f threadFilter) String() string {
+	var parts []string
+	if f.TID != 0 {
+		parts = append(parts, fmt.Sprintf("tid %d", f.TID))
+	}
+	if f.Comm != "" {
+		parts = append(parts, "comm "+f.Comm)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// match reports whether the sample s was taken on a thread f selects.
+func (f threadFilter) match(s *profile.Sample) bool {
+	if f.TID != 0 && !slices.Contains(s.NumLabel[perfscript.LabelTID], f.TID) {
+		return false
+	}
+	if f.Comm != "" && !slices.Contains(s.Label[perfscript.LabelComm], f.Comm) {
+		return false
+	}
+	return true
+}
+
+// extractViewValue removes the flag name and its value, given as "name value"
+// or "name=value", from the arguments preceding a "--" separator and returns
+// the value.
+func extractViewValue(in []string, name string) ([]string, string, error) {
+	for i, arg := range in {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return append(append([]string{}, in[:i]...), in[i+1:]...), value, nil
+		}
+		if arg == name {
+			if i+1 >= len(in) || in[i+1] == "--" {
+				return nil, "", fmt.Errorf("flag %s requires a value", name)
+			}
+			return append(append([]string{}, in[:i]...), in[i+2:]...), in[i+1], nil
+		}
+	}
+	return in, "", nil
+}
+
+// extractThreadFilter removes --tid and --comm from the view arguments and
+// returns the filter they select.
+func extractThreadFilter(in []string) ([]string, threadFilter, error) {
+	var filter threadFilter
+	args, tid, err := extractViewValue(in, "--tid")
+	if err != nil {
+		return nil, filter, err
+	}
+	if tid != "" {
+		filter.TID, err = strconv.ParseInt(tid, 10, 64)
+		if err != nil || filter.TID <= 0 {
+			return nil, filter, fmt.Errorf("invalid --tid %q, expected a thread ID", tid)
+		}
+	}
+	args, filter.Comm, err = extractViewValue(args, "--comm")
+	if err != nil {
+		return nil, filter, err
+	}
+	return args, filter, nil
+}
+
+// filterThreadSamples returns a copy of prof with only the samples f
+// matches. Profiles recorded without thread labels can't be filtered.
+func filterThreadSamples(prof *profile.Profile, f threadFilter) (*profile.Profile, error) {
+	labelled := false
+	filtered := prof.Copy()
+	samples := filtered.Sample
+	filtered.Sample = nil
+	for _, s := range samples {
+		if len(s.Label[perfscript.LabelComm]) > 0 || len(s.NumLabel[perfscript.LabelTID]) > 0 {
+			labelled = true
+		}
+		if f.match(s) {
+			filtered.Sample = append(filtered.Sample, s)
+		}
+	}
+
+	if !labelled {
+		return nil, fmt.Errorf("profile has no thread labels to filter by %s, record it again with this version of perfgo", f)
+	}
+	if len(filtered.Sample) == 0 {
+		return nil, fmt.Errorf("profile has no samples of %s", f)
+	}
+	return filtered.Compact(), nil
+}
+
+// filterProfile writes the samples of profilePath that filter selects to a
+// temporary profile and returns its path and a function removing it.
+func (a *App) filterProfile(profilePath string, filter threadFilter) (string, func(), error) {
+	f, err := os.Open(profilePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+
+	filtered, err := filterThreadSamples(prof, filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "perfgo-filter-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			a.logger.Warn().Err(err).Str("path", tempDir).Msg("Failed to remove temporary directory")
+		}
+	}
+
+	filteredPath := filepath.Join(tempDir, filepath.Base(profilePath))
+	out, err := os.Create(filteredPath)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create filtered profile: %w", err)
+	}
+	defer out.Close()
+	if err := filtered.Write(out); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write filtered profile: %w", err)
+	}
+	return filteredPath, cleanup, nil
+}
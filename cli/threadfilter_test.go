@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/perfgo/perfgo/perfscript"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// threadProfile returns a profile with a sample per thread, labelled like
+// perfscript.WithThreadLabels does.
+func threadProfile() *profile.Profile {
+	mapping := &profile.Mapping{ID: 1, File: "/path/to/binary"}
+	work := &profile.Function{ID: 1, Name: "main.work"}
+	idle := &profile.Function{ID: 2, Name: "runtime.usleep"}
+	workLoc := &profile.Location{ID: 1, Mapping: mapping, Address: 0x401000, Line: []profile.Line{{Function: work}}}
+	idleLoc := &profile.Location{ID: 2, Mapping: mapping, Address: 0x402000, Line: []profile.Line{{Function: idle}}}
+
+	sample := func(loc *profile.Location, value int64, comm string, tid int64) *profile.Sample {
+		return &profile.Sample{
+			Location: []*profile.Location{loc},
+			Value:    []int64{value},
+			Label:    map[string][]string{perfscript.LabelComm: {comm}},
+			NumLabel: map[string][]int64{perfscript.LabelTID: {tid}},
+		}
+	}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Sample: []*profile.Sample{
+			sample(workLoc, 10, "worker", 101),
+			sample(idleLoc, 20, "sysmon", 102),
+			sample(workLoc, 30, "worker", 103),
+		},
+		Mapping:  []*profile.Mapping{mapping},
+		Location: []*profile.Location{workLoc, idleLoc},
+		Function: []*profile.Function{work, idle},
+	}
+}
+
+func TestFilterThreadSamples(t *testing.T) {
+	prof := threadProfile()
+
+	t.Run("tid", func(t *testing.T) {
+		filtered, err := filterThreadSamples(prof, threadFilter{TID: 102})
+		require.NoError(t, err)
+		require.NoError(t, filtered.CheckValid())
+		require.Len(t, filtered.Sample, 1)
+		assert.Equal(t, []int64{20}, filtered.Sample[0].Value)
+		// Locations of other threads are dropped
+		require.Len(t, filtered.Location, 1)
+		assert.Equal(t, "runtime.usleep", filtered.Location[0].Line[0].Function.Name)
+	})
+
+	t.Run("comm", func(t *testing.T) {
+		filtered, err := filterThreadSamples(prof, threadFilter{Comm: "worker"})
+		require.NoError(t, err)
+		require.Len(t, filtered.Sample, 2)
+		assert.Equal(t, []int64{10}, filtered.Sample[0].Value)
+		assert.Equal(t, []int64{30}, filtered.Sample[1].Value)
+	})
+
+	t.Run("tid and comm", func(t *testing.T) {
+		filtered, err := filterThreadSamples(prof, threadFilter{TID: 103, Comm: "worker"})
+		require.NoError(t, err)
+		require.Len(t, filtered.Sample, 1)
+		assert.Equal(t, []int64{30}, filtered.Sample[0].Value)
+
+		_, err = filterThreadSamples(prof, threadFilter{TID: 102, Comm: "worker"})
+		require.EqualError(t, err, "profile has no samples of tid 102 and comm worker")
+	})
+
+	// The original profile is left untouched
+	require.Len(t, prof.Sample, 3)
+
+	t.Run("unlabelled", func(t *testing.T) {
+		unlabelled := threadProfile()
+		for _, s := range unlabelled.Sample {
+			s.Label, s.NumLabel = nil, nil
+		}
+		_, err := filterThreadSamples(unlabelled, threadFilter{TID: 101})
+		require.ErrorContains(t, err, "profile has no thread labels to filter by tid 101")
+	})
+}
+
+func TestExtractThreadFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         []string
+		wantArgs   []string
+		wantFilter threadFilter
+		wantErr    bool
+	}{
+		{name: "none", in: []string{"-1", "-top"}, wantArgs: []string{"-1", "-top"}},
+		{name: "tid", in: []string{"--tid", "4242", "-1"}, wantArgs: []string{"-1"}, wantFilter: threadFilter{TID: 4242}},
+		{name: "comm with equals", in: []string{"--comm=worker", "abc123"}, wantArgs: []string{"abc123"}, wantFilter: threadFilter{Comm: "worker"}},
+		{name: "both", in: []string{"--comm", "worker", "--tid=7", "--", "-top"}, wantArgs: []string{"--", "-top"}, wantFilter: threadFilter{TID: 7, Comm: "worker"}},
+		{name: "pprof args after separator", in: []string{"--", "--tid", "1"}, wantArgs: []string{"--", "--tid", "1"}},
+		{name: "missing value", in: []string{"--tid"}, wantErr: true},
+		{name: "invalid tid", in: []string{"--tid", "main"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, filter, err := extractThreadFilter(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantArgs, args)
+			assert.Equal(t, tt.wantFilter, filter)
+		})
+	}
+}
+
+func TestFilterProfile(t *testing.T) {
+	profilePath := filepath.Join(t.TempDir(), "perf.pb.gz")
+	f, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, threadProfile().Write(f))
+	require.NoError(t, f.Close())
+
+	a := &App{logger: zerolog.Nop()}
+	filteredPath, cleanup, err := a.filterProfile(profilePath, threadFilter{Comm: "sysmon"})
+	require.NoError(t, err)
+
+	f, err = os.Open(filteredPath)
+	require.NoError(t, err)
+	filtered, err := profile.Parse(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Len(t, filtered.Sample, 1)
+	assert.Equal(t, []int64{20}, filtered.Sample[0].Value)
+
+	cleanup()
+	assert.NoFileExists(t, filteredPath)
+}
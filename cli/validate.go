@@ -0,0 +1,163 @@
+package cli
+
+// This file contains the validation of flag and option combinations, done
+// before anything is built or started so that options which would be ignored
+// or contradict each other are rejected up front.
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/urfave/cli/v2"
+)
+
+// flagRule constrains the flags flag may be combined with.
+type flagRule struct {
+	flag     string
+	requires []string // At least one of these must be set as well
+	excludes []string // None of these may be set
+}
+
+// flagRules are the constraints between the flags of the test, attach,
+// events and doctor commands. Flags set in .perfgo.yaml aren't checked, they
+// are defaults for the commands that use them.
+var flagRules = []flagRule{
+	{flag: "matrix", excludes: []string{"remote-host"}},
+	{flag: "watch", excludes: []string{"matrix"}},
+	{flag: "metrics-out", excludes: []string{"matrix"}},
+	{flag: "remote-shared-path", requires: []string{"remote-host", "matrix"}},
+	{flag: "remote-cache-dir", requires: []string{"remote-host", "matrix"}},
+	{flag: "ssh-port", requires: []string{"remote-host", "matrix"}},
+	{flag: "ssh-user", requires: []string{"remote-host", "matrix"}},
+	{flag: "ssh-jump", requires: []string{"remote-host", "matrix"}},
+	{flag: "ssh-persist", requires: []string{"remote-host", "matrix"}},
+	{flag: "pod", excludes: []string{"node", "selector", "remote-host"}},
+	{flag: "node", excludes: []string{"selector", "remote-host"}},
+	{flag: "selector", excludes: []string{"remote-host"}},
+	{flag: "pid", requires: []string{"remote-host"}, excludes: []string{"process"}},
+	{flag: "process", requires: []string{"remote-host"}},
+	{flag: "cgroup", requires: []string{"pod", "selector"}},
+	{flag: "first", requires: []string{"selector"}},
+	{flag: "default-event", requires: []string{"event"}},
+}
+
+// validateFlags checks the flags given to the command against flagRules.
+func validateFlags(ctx *cli.Context) error {
+	for _, rule := range flagRules {
+		if !ctx.IsSet(rule.flag) {
+			continue
+		}
+		for _, excluded := range rule.excludes {
+			if ctx.IsSet(excluded) {
+				return fmt.Errorf("--%s and --%s are mutually exclusive", rule.flag, excluded)
+			}
+		}
+		if len(rule.requires) > 0 && !slices.ContainsFunc(rule.requires, ctx.IsSet) {
+			// Only name the flags the command has, e.g. no --matrix for attach
+			required := slices.DeleteFunc(slices.Clone(rule.requires), func(name string) bool {
+				return !definesFlag(ctx, name)
+			})
+			if len(required) == 0 {
+				required = rule.requires
+			}
+			return fmt.Errorf("--%s requires --%s", rule.flag, strings.Join(required, " or --"))
+		}
+	}
+
+	if ctx.IsSet("default-event") {
+		return validateDefaultEvent(ctx.String("event"), ctx.String("default-event"))
+	}
+	return nil
+}
+
+// definesFlag reports whether the command of ctx has the flag name.
+func definesFlag(ctx *cli.Context, name string) bool {
+	if ctx.Command == nil {
+		return false
+	}
+	for _, flag := range ctx.Command.Flags {
+		if slices.Contains(flag.Names(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDefaultEvent checks that defaultEvent is one of the comma separated
+// events recorded, ignoring their modifiers such as :u.
+func validateDefaultEvent(events, defaultEvent string) error {
+	if events == "" || defaultEvent == "" {
+		return nil
+	}
+	for _, event := range strings.Split(events, ",") {
+		name, _, _ := strings.Cut(event, ":")
+		if event == defaultEvent || name == defaultEvent {
+			return nil
+		}
+	}
+	return fmt.Errorf("--default-event %s is not one of the recorded events %s", defaultEvent, events)
+}
+
+// modeOption is an option of TestOptions that only applies to some modes,
+// named after its flag.
+type modeOption struct {
+	flag  string
+	set   bool
+	modes []string
+}
+
+// modeOptions returns the mode-specific options of opts.
+func modeOptions(opts TestOptions) []modeOption {
+	return []modeOption{
+		{"--event", opts.Event != "", []string{"profile"}},
+		{"--event", len(opts.Events) > 0, []string{"stat"}},
+		{"--count", opts.Count != 0, []string{"profile"}},
+		{"--max-duration", opts.MaxDuration != 0, []string{"profile"}},
+		{"--branch-stack", opts.BranchStack, []string{"profile"}},
+		{"--branch-filter", opts.BranchFilter != "", []string{"profile"}},
+		{"--call-graph-auto", opts.CallGraphAuto, []string{"profile"}},
+		{"--default-event", opts.DefaultEvent != "", []string{"profile"}},
+		{"--symbols", len(opts.Symbols) > 0, []string{"profile"}},
+		{"--folded", opts.Folded, []string{"profile", "cpuprofile"}},
+		{"--output", opts.Output != "" && opts.Output != perf.OutputPprof, []string{"profile", "cpuprofile"}},
+		{"--detail", opts.Detail, []string{"stat"}},
+		{"--per-" + opts.Aggregation.Mode(), opts.Aggregation.Mode() != "", []string{"stat"}},
+		{"--perf-repeat", opts.PerfRepeat != 0, []string{"stat"}},
+		{"--repeat", opts.Repeat > 1, []string{"profile", "stat"}},
+		{"--c2c-event", opts.C2CEvent != "", []string{"c2c"}},
+		{"--c2c-count", opts.C2CCount != 0, []string{"c2c"}},
+		{"--mem-type", opts.Mem.Type != "", []string{"mem"}},
+		{"--mem-event", opts.Mem.Event != "", []string{"mem"}},
+		{"--ldlat", opts.Mem.LoadLatency != 0, []string{"mem"}},
+		{"--mem-sort", opts.MemSort != "", []string{"mem"}},
+		{"--memprofile-rate", opts.MemProfileRate != 0, []string{"mprofile"}},
+		{"--keep-perf-data", opts.KeepPerfData, []string{"profile", "c2c", "mem"}},
+		{"--perf-data-in-cwd", opts.PerfDataInCWD, []string{"profile", "c2c", "mem"}},
+	}
+}
+
+// validateModeOptions rejects options of opts that don't apply to its mode,
+// e.g. a perf record event period for a perf stat run.
+func validateModeOptions(opts TestOptions) error {
+	for _, option := range modeOptions(opts) {
+		if !option.set || slices.Contains(option.modes, opts.Mode) {
+			continue
+		}
+		modes := option.modes[len(option.modes)-1]
+		if len(option.modes) > 1 {
+			modes = strings.Join(option.modes[:len(option.modes)-1], ", ") + " and " + modes
+		}
+		return fmt.Errorf("%s is only supported by perfgo test %s, not %s", option.flag, modes, testCommand(opts.Mode))
+	}
+	return validateDefaultEvent(opts.Event, opts.DefaultEvent)
+}
+
+// testCommand returns the test subcommand running mode.
+func testCommand(mode string) string {
+	if mode == "" {
+		return "perfgo test"
+	}
+	return "perfgo test " + mode
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "ssh flag without remote host",
+			args:    []string{"test", "--ssh-port", "2222", "--", "."},
+			wantErr: "--ssh-port requires --remote-host or --matrix",
+		},
+		{
+			name:    "remote cache without remote host",
+			args:    []string{"test", "stat", "--remote-cache-dir", "/scratch", "--", "."},
+			wantErr: "--remote-cache-dir requires --remote-host or --matrix",
+		},
+		{
+			name:    "shared path without remote host",
+			args:    []string{"test", "profile", "--remote-shared-path", "/mnt/shared", "--", "."},
+			wantErr: "--remote-shared-path requires --remote-host or --matrix",
+		},
+		{
+			name:    "matrix and remote host",
+			args:    []string{"test", "--matrix", "linux/arm64", "--remote-host", "bench", "--", "."},
+			wantErr: "--matrix and --remote-host are mutually exclusive",
+		},
+		{
+			name:    "watch and matrix",
+			args:    []string{"test", "profile", "--watch", "--matrix", "linux/arm64", "--", "."},
+			wantErr: "--watch and --matrix are mutually exclusive",
+		},
+		{
+			name:    "metrics out and matrix",
+			args:    []string{"test", "stat", "--metrics-out", "metrics.prom", "--matrix", "linux/arm64", "--", "."},
+			wantErr: "--metrics-out and --matrix are mutually exclusive",
+		},
+		{
+			name:    "default event without events",
+			args:    []string{"test", "profile", "--default-event", "instructions", "--", "."},
+			wantErr: "--default-event requires --event",
+		},
+		{
+			name:    "default event not recorded",
+			args:    []string{"test", "profile", "--event", "cycles,instructions", "--default-event", "branches", "--", "."},
+			wantErr: "--default-event branches is not one of the recorded events cycles,instructions",
+		},
+		{
+			name:    "pod and node",
+			args:    []string{"attach", "profile", "--pod", "checkout", "--node", "worker-01"},
+			wantErr: "--pod and --node are mutually exclusive",
+		},
+		{
+			name:    "node and selector",
+			args:    []string{"attach", "stat", "--node", "worker-01", "--selector", "app=checkout"},
+			wantErr: "--node and --selector are mutually exclusive",
+		},
+		{
+			name:    "cgroup without pod",
+			args:    []string{"attach", "profile", "--node", "worker-01", "--cgroup"},
+			wantErr: "--cgroup requires --pod or --selector",
+		},
+		{
+			name:    "first without selector",
+			args:    []string{"attach", "profile", "--pod", "checkout", "--first"},
+			wantErr: "--first requires --selector",
+		},
+		{
+			name:    "pod and remote host",
+			args:    []string{"attach", "profile", "--pod", "checkout", "--remote-host", "bench"},
+			wantErr: "--pod and --remote-host are mutually exclusive",
+		},
+		{
+			name:    "pid without remote host",
+			args:    []string{"attach", "profile", "--node", "worker-01", "--pid", "1234"},
+			wantErr: "--pid requires --remote-host",
+		},
+		{
+			name:    "pid and process",
+			args:    []string{"attach", "stat", "--remote-host", "bench", "--pid", "1234", "--process", "server"},
+			wantErr: "--pid and --process are mutually exclusive",
+		},
+		{
+			name:    "remote host without processes",
+			args:    []string{"attach", "profile", "--remote-host", "bench"},
+			wantErr: "--remote-host requires --pid or --process to select the processes to attach to",
+		},
+		{
+			name:    "attach ssh port without remote host",
+			args:    []string{"attach", "profile", "--pod", "checkout", "--ssh-port", "2222"},
+			wantErr: "--ssh-port requires --remote-host",
+		},
+		{
+			name:    "events with ssh user",
+			args:    []string{"events", "--ssh-user", "perf"},
+			wantErr: "--ssh-user requires --remote-host",
+		},
+		{
+			name:    "doctor with ssh jump",
+			args:    []string{"doctor", "--ssh-jump", "bastion"},
+			wantErr: "--ssh-jump requires --remote-host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			fake := &runner.Fake{}
+			app := New(WithRunner(fake), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+
+			err := app.Run(append([]string{AppName}, tt.args...))
+			require.EqualError(t, err, tt.wantErr)
+			// Rejected before anything ran
+			assert.Empty(t, fake.Commands())
+		})
+	}
+}
+
+func TestValidateDefaultEvent(t *testing.T) {
+	assert.NoError(t, validateDefaultEvent("", "instructions"))
+	assert.NoError(t, validateDefaultEvent("cycles,instructions", ""))
+	assert.NoError(t, validateDefaultEvent("cycles,instructions", "instructions"))
+	assert.NoError(t, validateDefaultEvent("cycles:u,instructions:u", "cycles"))
+	assert.NoError(t, validateDefaultEvent("cycles:u,instructions:u", "cycles:u"))
+	assert.Error(t, validateDefaultEvent("cycles,instructions", "branches"))
+}
+
+func TestValidateModeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    TestOptions
+		wantErr string
+	}{
+		{name: "plain test", opts: TestOptions{Repeat: 1}},
+		{name: "profile options", opts: TestOptions{Mode: "profile", Event: "cycles", Count: 1000, Folded: true, Output: perf.OutputJSON, Repeat: 3, KeepPerfData: true}},
+		{name: "stat options", opts: TestOptions{Mode: "stat", Events: []string{"cycles"}, Detail: true, Aggregation: perf.StatAggregation{PerCore: true}, PerfRepeat: 3}},
+		{name: "cpuprofile output", opts: TestOptions{Mode: "cpuprofile", Folded: true, Output: perf.OutputText}},
+		{name: "default pprof output", opts: TestOptions{Mode: "stat", Output: perf.OutputPprof}},
+		{
+			name:    "count without profile",
+			opts:    TestOptions{Mode: "stat", Count: 1000},
+			wantErr: "--count is only supported by perfgo test profile, not perfgo test stat",
+		},
+		{
+			name:    "detail without stat",
+			opts:    TestOptions{Mode: "profile", Detail: true},
+			wantErr: "--detail is only supported by perfgo test stat, not perfgo test profile",
+		},
+		{
+			name:    "c2c event on plain test",
+			opts:    TestOptions{C2CEvent: "ldlat-loads"},
+			wantErr: "--c2c-event is only supported by perfgo test c2c, not perfgo test",
+		},
+		{
+			name:    "folded in c2c",
+			opts:    TestOptions{Mode: "c2c", Folded: true},
+			wantErr: "--folded is only supported by perfgo test profile and cpuprofile, not perfgo test c2c",
+		},
+		{
+			name:    "aggregation without stat",
+			opts:    TestOptions{Mode: "profile", Aggregation: perf.StatAggregation{PerSocket: true}},
+			wantErr: "--per-socket is only supported by perfgo test stat",
+		},
+		{
+			name:    "repeat in mem",
+			opts:    TestOptions{Mode: "mem", Repeat: 3},
+			wantErr: "--repeat is only supported by perfgo test profile and stat, not perfgo test mem",
+		},
+		{
+			name:    "mem sort in c2c",
+			opts:    TestOptions{Mode: "c2c", MemSort: "mem"},
+			wantErr: "--mem-sort is only supported by perfgo test mem",
+		},
+		{
+			name:    "max duration in stat",
+			opts:    TestOptions{Mode: "stat", MaxDuration: time.Second},
+			wantErr: "--max-duration is only supported by perfgo test profile",
+		},
+		{
+			name:    "memprofile rate in cpuprofile",
+			opts:    TestOptions{Mode: "cpuprofile", MemProfileRate: 1},
+			wantErr: "--memprofile-rate is only supported by perfgo test mprofile, not perfgo test cpuprofile",
+		},
+		{
+			name:    "keep perf data without perf.data",
+			opts:    TestOptions{Mode: "mprofile", KeepPerfData: true},
+			wantErr: "--keep-perf-data is only supported by perfgo test profile, c2c and mem",
+		},
+		{
+			name:    "default event not recorded",
+			opts:    TestOptions{Mode: "profile", Event: "cycles", DefaultEvent: "instructions"},
+			wantErr: "--default-event instructions is not one of the recorded events cycles",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateModeOptions(tt.opts)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRunTest_RejectsOptionsOfOtherModes(t *testing.T) {
+	fake := &runner.Fake{}
+	app := New(WithRunner(fake), WithOutputDir(t.TempDir()), WithLogger(zerolog.Nop()))
+
+	_, err := app.RunTest(TestOptions{Mode: "stat", Args: []string{"."}, Count: 1000})
+	require.ErrorContains(t, err, "--count is only supported by perfgo test profile")
+	assert.Empty(t, fake.Commands())
+}
@@ -0,0 +1,46 @@
+package cli
+
+// This file contains the detection of the kernel and perf versions of the
+// host a run is profiled on, as profiles recorded with different versions
+// can behave differently.
+
+import (
+	"strings"
+)
+
+// detectVersions returns the kernel release (uname -r) and the perf version
+// (perf --version) of the host exec runs on. Versions that can't be detected
+// are empty.
+func detectVersions(exec shellExec) (kernelRelease, perfVersion string) {
+	if output, _, err := exec("uname -r"); err == nil {
+		kernelRelease = firstLine(output)
+	}
+	if output, _, err := exec("perf --version 2>&1"); err == nil {
+		perfVersion = parsePerfVersion(output)
+	}
+	return kernelRelease, perfVersion
+}
+
+// parsePerfVersion extracts the version from the output of perf --version,
+// e.g. "perf version 6.8.12" -> "6.8.12".
+func parsePerfVersion(output string) string {
+	line := firstLine(output)
+	if version, ok := strings.CutPrefix(line, "perf version "); ok {
+		return strings.TrimSpace(version)
+	}
+	return line
+}
+
+// majorMinor returns the major.minor prefix of a kernel or perf version,
+// e.g. "6.8.0-45-generic" -> "6.8".
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	return parts[0] + "." + minor
+}
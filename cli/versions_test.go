@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectVersions(t *testing.T) {
+	app, fake := fakeShell(t, map[string]runner.Result{
+		"uname -r":            {Stdout: "6.8.0-45-generic\n"},
+		"perf --version 2>&1": {Stdout: "perf version 6.8.12\n"},
+	})
+	kernelRelease, perfVersion := detectVersions(app.localShellExec)
+	assert.Equal(t, "6.8.0-45-generic", kernelRelease)
+	assert.Equal(t, "6.8.12", perfVersion)
+	assert.Len(t, fake.Commands(), 2)
+
+	// Hosts without perf have no perf version
+	app, _ = fakeShell(t, map[string]runner.Result{"uname -r": {Stdout: "6.8.0-45-generic\n"}})
+	kernelRelease, perfVersion = detectVersions(app.localShellExec)
+	assert.Equal(t, "6.8.0-45-generic", kernelRelease)
+	assert.Empty(t, perfVersion)
+}
+
+func TestParsePerfVersion(t *testing.T) {
+	assert.Equal(t, "6.8.12", parsePerfVersion("perf version 6.8.12\n"))
+	assert.Equal(t, "5.15.173", parsePerfVersion("\nperf version 5.15.173\n"))
+	assert.Equal(t, "unexpected", parsePerfVersion("unexpected\n"))
+}
+
+func TestMajorMinor(t *testing.T) {
+	assert.Equal(t, "6.8", majorMinor("6.8.0-45-generic"))
+	assert.Equal(t, "6.8", majorMinor("6.8.12"))
+	assert.Equal(t, "6.11", majorMinor("6.11-rc3"))
+	assert.Equal(t, "6", majorMinor("6"))
+}
+
+func TestWriteHistoryMetadata_Versions(t *testing.T) {
+	runDir := t.TempDir()
+	h := &model.History{
+		ID:     "0123456789abcdef",
+		Target: &model.Target{OS: "linux", Arch: "amd64", KernelRelease: "6.8.0-45-generic", PerfVersion: "6.8.12"},
+	}
+	require.NoError(t, writeHistoryMetadata(runDir, h))
+
+	data, err := os.ReadFile(filepath.Join(runDir, "history.json"))
+	require.NoError(t, err)
+	var raw struct {
+		Target map[string]any `json:"target"`
+	}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Equal(t, "6.8.0-45-generic", raw.Target["kernel_release"])
+	assert.Equal(t, "6.8.12", raw.Target["perf_version"])
+}
@@ -4,6 +4,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -60,24 +61,30 @@ func parseViewArgs(in []string) (idArg string, pprofArgs []string) {
 	return in[0], removeFirstDashDash(in[1:])
 }
 
-func (a *App) view(ctx *cli.Context) error {
-	// Parse arguments to extract ID/index and pprof args
-	arg, pprofArgs := parseViewArgs(ctx.Args().Slice())
-
+// resolveEntry loads the history and returns the entry referenced by arg,
+// which is either an index (0 for the last run, -1 for the one before, ...),
+// a hex ID prefix, or commit:<sha-prefix> or branch:<name> selecting the
+// newest run of a commit or branch.
+func (a *App) resolveEntry(arg string) (*history.Entry, error) {
 	// Get perfgo root directory
-	perfgoRoot, err := history.GetPerfgoRoot()
+	perfgoRoot, err := history.GetPerfgoRoot(a.outputDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Load all history entries
 	historyEntries, err := history.LoadEntries(a.logger, perfgoRoot)
 	if err != nil {
-		return fmt.Errorf("failed to load history: %w", err)
+		return nil, fmt.Errorf("failed to load history: %w", err)
 	}
 
+	return findEntry(historyEntries, arg)
+}
+
+// findEntry returns the entry referenced by arg, see resolveEntry.
+func findEntry(historyEntries []history.Entry, arg string) (*history.Entry, error) {
 	if len(historyEntries) == 0 {
-		return fmt.Errorf("no history entries found")
+		return nil, fmt.Errorf("no history entries found")
 	}
 
 	// Sort by timestamp (newest first)
@@ -85,43 +92,138 @@ func (a *App) view(ctx *cli.Context) error {
 		return historyEntries[i].History.Timestamp.After(historyEntries[j].History.Timestamp)
 	})
 
-	// Parse argument to find the target entry
-	var targetEntry *history.Entry
-
 	// Try to parse as integer first
 	if parsed, err := strconv.ParseInt(arg, 10, 64); err == nil && parsed <= 0 {
 		// 0 or negative integer: count from the end (0=last, -1=second-to-last, -2=third-to-last, etc.)
 		index := int(-parsed) // Convert to positive index (0 -> 0, -1 -> 1, -2 -> 2)
 		if index >= len(historyEntries) {
-			return fmt.Errorf("index %s out of range (only %d history entries)", arg, len(historyEntries))
+			return nil, fmt.Errorf("index %s out of range (only %d history entries)", arg, len(historyEntries))
 		}
-		targetEntry = &historyEntries[index]
-	} else {
-		// Validate that it's a valid hex string before treating as ID prefix
-		if !isValidHexString(arg) {
-			return fmt.Errorf("invalid argument: %s (use 0 for last, -1 for second-to-last, or a valid hex ID prefix)", arg)
+		return &historyEntries[index], nil
+	}
+
+	// Newest run of a commit or branch
+	if commit, ok := strings.CutPrefix(arg, "commit:"); ok {
+		if !isValidHexString(commit) {
+			return nil, fmt.Errorf("invalid commit: %s (use a hex commit prefix)", commit)
+		}
+		commit = strings.ToLower(commit)
+		return findNewestEntry(historyEntries, arg, func(h *model.History) bool {
+			return h.Git != nil && strings.HasPrefix(strings.ToLower(h.Git.Commit), commit)
+		})
+	}
+	if branch, ok := strings.CutPrefix(arg, "branch:"); ok {
+		if branch == "" {
+			return nil, fmt.Errorf("invalid argument: %s (branch name missing)", arg)
 		}
+		return findNewestEntry(historyEntries, arg, func(h *model.History) bool {
+			return h.Git != nil && h.Git.Branch == branch
+		})
+	}
 
-		// Treat as hex ID prefix
-		hexID := strings.ToLower(arg)
-		found := false
-		for i := range historyEntries {
-			if strings.HasPrefix(strings.ToLower(historyEntries[i].History.ID), hexID) {
-				targetEntry = &historyEntries[i]
-				found = true
-				break
-			}
+	// Validate that it's a valid hex string before treating as ID prefix
+	if !isValidHexString(arg) {
+		return nil, fmt.Errorf("invalid argument: %s (use 0 for last, -1 for second-to-last, a valid hex ID prefix, commit:<sha> or branch:<name>)", arg)
+	}
+
+	// Treat as hex ID prefix
+	hexID := strings.ToLower(arg)
+	for i := range historyEntries {
+		if strings.HasPrefix(strings.ToLower(historyEntries[i].History.ID), hexID) {
+			return &historyEntries[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no history entry found matching ID: %s", arg)
+}
+
+// findNewestEntry returns the first entry of historyEntries, which are sorted
+// newest first, the match function accepts.
+func findNewestEntry(historyEntries []history.Entry, arg string, match func(*model.History) bool) (*history.Entry, error) {
+	for i := range historyEntries {
+		if match(&historyEntries[i].History) {
+			return &historyEntries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no history entry found matching %s", arg)
+}
+
+// extractViewFlag removes the boolean flag name (e.g., --folded) from the
+// arguments preceding a "--" separator and reports whether it was given.
+func extractViewFlag(in []string, name string) ([]string, bool) {
+	for i, arg := range in {
+		if arg == "--" {
+			break
 		}
-		if !found {
-			return fmt.Errorf("no history entry found matching ID: %s", arg)
+		if arg == name {
+			return append(append([]string{}, in[:i]...), in[i+1:]...), true
 		}
 	}
+	return in, false
+}
+
+func (a *App) view(ctx *cli.Context) error {
+	args, folded := extractViewFlag(ctx.Args().Slice(), "--folded")
+	args, serve := extractViewFlag(args, "--serve")
+	args, perfReport := extractViewFlag(args, "--perf-report")
+	args, filter, err := extractThreadFilter(args)
+	if err != nil {
+		return err
+	}
+
+	// Parse arguments to extract ID/index and pprof args
+	arg, pprofArgs := parseViewArgs(args)
+
+	targetEntry, err := a.resolveEntry(arg)
+	if err != nil {
+		return err
+	}
+
+	if folded {
+		return a.displayFolded(os.Stdout, targetEntry)
+	}
+
+	if perfReport {
+		return a.runPerfReport(targetEntry, pprofArgs)
+	}
 
 	// Display the entry
-	return a.displayHistoryEntry(targetEntry, pprofArgs)
+	return a.displayHistoryEntry(targetEntry, pprofArgs, serve, filter)
+}
+
+// displayFolded writes the folded stacks of entry to w, without any header
+// so the output can be piped into flamegraph tools.
+func (a *App) displayFolded(w io.Writer, entry *history.Entry) error {
+	for _, artifact := range entry.History.Artifacts {
+		if artifact.Type != model.ArtifactTypeFoldedStacks {
+			continue
+		}
+		f, err := os.Open(filepath.Join(entry.FullPath, artifact.File))
+		if err != nil {
+			return fmt.Errorf("failed to open folded stacks: %w", err)
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+	return fmt.Errorf("run %s has no folded stacks, record it with --folded", entry.History.ID[:8])
+}
+
+// runPerfReport opens the perf.data of entry in perf report, passing args on
+// to perf.
+func (a *App) runPerfReport(entry *history.Entry, args []string) error {
+	artifact, err := findPerfData(&entry.History)
+	if err != nil {
+		return err
+	}
+	perfDataPath := filepath.Join(entry.FullPath, artifact.File)
+	return perfReportCommand(entry.FullPath, perfReportArgs(&entry.History, perfDataPath, args)...).Run()
 }
 
-func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) error {
+// displayHistoryEntry prints the entry and its most relevant artifact. A
+// profile is opened with go tool pprof, or with the pprof built into perfgo
+// if serve is set, narrowed down to the samples filter selects.
+func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string, serve bool, filter threadFilter) error {
 	h := entry.History
 
 	// Print header
@@ -129,16 +231,40 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 	fmt.Printf("Time: %s\n", h.Timestamp.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Duration: %s\n", h.Duration)
 	fmt.Printf("Exit Code: %d\n", h.ExitCode)
+	for _, warning := range h.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
 	if h.WorkDir != "" {
 		fmt.Printf("Working Dir: %s\n", h.WorkDir)
 	}
+	if h.Target != nil && h.Target.KernelRelease != "" {
+		fmt.Printf("Kernel: %s\n", h.Target.KernelRelease)
+	}
+	if h.Target != nil && h.Target.PerfVersion != "" {
+		fmt.Printf("Perf Version: %s\n", h.Target.PerfVersion)
+	}
 	if h.Git != nil {
 		if h.Git.Commit != "" {
-			fmt.Printf("Git Commit: %s", h.Git.Commit[:8])
-			if h.Git.Branch != "" {
-				fmt.Printf(" (%s)", h.Git.Branch)
+			fmt.Printf("Git Commit: %s%s\n", h.Git.Commit[:8], gitRefSuffix(h.Git))
+		}
+	}
+	if h.Test != nil && len(h.Test.BuildEnv) > 0 {
+		fmt.Printf("Build Env: %s\n", strings.Join(h.Test.BuildEnv, " "))
+	}
+	if h.Test != nil && len(h.Test.Packages) > 0 {
+		fmt.Printf("Packages: %d\n", len(h.Test.Packages))
+		for _, pkg := range h.Test.Packages {
+			status := "ok  "
+			if pkg.ExitCode != 0 {
+				status = "FAIL"
 			}
-			fmt.Println()
+			fmt.Printf("  %s %s (%s)\n", status, pkg.ImportPath, pkg.Duration)
+		}
+	}
+	if h.Test != nil && len(h.Test.Benchmarks) > 0 {
+		fmt.Printf("Benchmarks: %d\n", len(h.Test.Benchmarks))
+		if err := writeBenchmarkResults(os.Stdout, h.Test.Benchmarks); err != nil {
+			return err
 		}
 	}
 	if h.Perf != nil {
@@ -147,10 +273,37 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 			if h.Perf.Record.Count > 0 {
 				fmt.Printf(", count=%d", h.Perf.Record.Count)
 			}
+			if h.Perf.Record.BranchFilter != "" {
+				fmt.Printf(", branch-filter=%s", h.Perf.Record.BranchFilter)
+			} else if h.Perf.Record.BranchStack {
+				fmt.Printf(", branch-stack")
+			}
+			if h.Perf.Record.Cgroup != "" {
+				fmt.Printf(", cgroup=%s", h.Perf.Record.Cgroup)
+			}
+			if h.Perf.Record.CallGraph != "" {
+				fmt.Printf(", call-graph=%s", h.Perf.Record.CallGraph)
+			}
+			if h.Perf.Record.DefaultEvent != "" {
+				fmt.Printf(", default-event=%s", h.Perf.Record.DefaultEvent)
+			}
+			if h.Perf.Record.Repeat > 0 {
+				fmt.Printf(", merged from %d runs", h.Perf.Record.Repeat)
+			}
 			fmt.Println()
 		}
 		if h.Perf.Stat != nil {
-			fmt.Printf("Perf Stat: events=%v\n", h.Perf.Stat.Events)
+			fmt.Printf("Perf Stat: events=%v", h.Perf.Stat.Events)
+			if h.Perf.Stat.Aggregation != "" {
+				fmt.Printf(", per %s", h.Perf.Stat.Aggregation)
+			}
+			if h.Perf.Stat.PerfRepeat > 1 {
+				fmt.Printf(", perf stat -r %d", h.Perf.Stat.PerfRepeat)
+			}
+			if h.Perf.Stat.Repeat > 0 {
+				fmt.Printf(", aggregated from %d runs", h.Perf.Stat.Repeat)
+			}
+			fmt.Println()
 		}
 		if h.Perf.C2C != nil {
 			fmt.Printf("Perf C2C: event=%s", h.Perf.C2C.Event)
@@ -162,15 +315,44 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 			}
 			fmt.Println()
 		}
+		if h.Perf.Mem != nil {
+			fmt.Printf("Perf Mem:")
+			if h.Perf.Mem.Type != "" {
+				fmt.Printf(" type=%s", h.Perf.Mem.Type)
+			} else {
+				fmt.Printf(" type=load,store")
+			}
+			if h.Perf.Mem.Event != "" {
+				fmt.Printf(", event=%s", h.Perf.Mem.Event)
+			}
+			if h.Perf.Mem.LoadLatency > 0 {
+				fmt.Printf(", ldlat=%d", h.Perf.Mem.LoadLatency)
+			}
+			fmt.Println()
+		}
+	}
+	if h.Test != nil && h.Test.CPUProfile {
+		fmt.Println("CPU Profile: go test -cpuprofile")
+	}
+	if h.Test != nil && h.Test.MemProfile != nil {
+		if h.Test.MemProfile.Rate > 0 {
+			fmt.Printf("Memory Profile: rate=%d\n", h.Test.MemProfile.Rate)
+		} else {
+			fmt.Println("Memory Profile: rate=default")
+		}
+	}
+	if artifact, err := findPerfData(&h); err == nil {
+		fmt.Printf("Perf Data: %s (open with perfgo view --perf-report %s)\n", filepath.Join(entry.FullPath, artifact.File), h.ID[:8])
 	}
 	fmt.Println()
 
 	// Prioritize artifacts for display
-	// Highest priority: pprof profiles, perf stat outputs, c2c reports
+	// Highest priority: pprof profiles, perf stat outputs, c2c and mem reports
 	// Lowest priority: binaries
 	var profileArtifact *model.Artifact
 	var statArtifact *model.Artifact
 	var c2cReportArtifact *model.Artifact
+	var memReportArtifact *model.Artifact
 	var stdoutArtifact *model.Artifact
 	var stderrArtifact *model.Artifact
 
@@ -183,6 +365,8 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 			statArtifact = artifact
 		case model.ArtifactTypePerfC2CReport:
 			c2cReportArtifact = artifact
+		case model.ArtifactTypePerfMemReport:
+			memReportArtifact = artifact
 		case model.ArtifactTypeStdout:
 			stdoutArtifact = artifact
 		case model.ArtifactTypeStderr:
@@ -192,7 +376,10 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 
 	// Display highest priority artifact first
 	if profileArtifact != nil {
-		return a.displayProfile(entry.FullPath, profileArtifact, pprofArgs)
+		return a.displayProfile(entry, profileArtifact, pprofArgs, serve, filter)
+	}
+	if !filter.empty() {
+		return fmt.Errorf("run %s has no profile to filter by %s", h.ID[:8], filter)
 	}
 
 	if statArtifact != nil {
@@ -203,6 +390,10 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 		return a.displayC2CReport(entry.FullPath, c2cReportArtifact)
 	}
 
+	if memReportArtifact != nil {
+		return a.displayMemReport(entry.FullPath, memReportArtifact)
+	}
+
 	if stdoutArtifact != nil {
 		return a.displayStdout(entry.FullPath, stdoutArtifact)
 	}
@@ -217,9 +408,8 @@ func (a *App) displayHistoryEntry(entry *history.Entry, pprofArgs []string) erro
 	return nil
 }
 
-func (a *App) displayProfile(runDir string, artifact *model.Artifact, pprofArgs []string) error {
-	profilePath := filepath.Join(runDir, artifact.File)
-	fmt.Printf("Profile: %s (%.1f KB)\n", profilePath, float64(artifact.Size)/1024)
+func (a *App) displayProfile(entry *history.Entry, artifact *model.Artifact, pprofArgs []string, serve bool, filter threadFilter) error {
+	fmt.Printf("Profile: %s (%.1f KB)\n", filepath.Join(entry.FullPath, artifact.File), float64(artifact.Size)/1024)
 
 	// Check for LLVM tools in PATH and warn if missing
 	if _, err := exec.LookPath("llvm-symbolizer"); err != nil {
@@ -229,11 +419,40 @@ func (a *App) displayProfile(runDir string, artifact *model.Artifact, pprofArgs
 		a.logger.Warn().Msg("llvm-objdump not found in PATH - disassembly may be limited")
 	}
 
+	profilePath, cleanup, err := a.pprofProfile(entry, artifact)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if !filter.empty() {
+		filteredPath, filterCleanup, err := a.filterProfile(profilePath, filter)
+		if err != nil {
+			return err
+		}
+		defer filterCleanup()
+		fmt.Printf("Filtered to the samples of %s\n", filter)
+		profilePath = filteredPath
+	}
+	pprofArgs = a.defaultSampleIndex(&entry.History, profilePath, pprofArgs)
+
+	if serve {
+		binary, err := mainBinary(profilePath)
+		if err != nil {
+			return err
+		}
+		return a.pprofServer()(serveArgs(pprofArgs, binary, profilePath))
+	}
+
+	args := append(append([]string{}, pprofArgs...), profilePath)
+	return pprofCommand(entry.FullPath, args...).Run()
+}
+
+// pprofCommand returns the command running pprof with the given arguments in
+// runDir, attached to the terminal.
+func pprofCommand(runDir string, args ...string) *exec.Cmd {
 	// Build pprof command with specific version
 	// Use go run github.com/google/pprof@<version> instead of go tool pprof
-	args := []string{"run", "github.com/google/pprof@v0.0.0-20260115054156-294ebfa9ad83"}
-	args = append(args, pprofArgs...)
-	args = append(args, profilePath)
+	args = append([]string{"run", "github.com/google/pprof@v0.0.0-20260115054156-294ebfa9ad83"}, args...)
 
 	cmd := exec.Command("go", args...)
 	cmd.Stdin = os.Stdin
@@ -241,7 +460,7 @@ func (a *App) displayProfile(runDir string, artifact *model.Artifact, pprofArgs
 	cmd.Stderr = os.Stderr
 	cmd.Dir = runDir
 
-	return cmd.Run()
+	return cmd
 }
 
 func (a *App) displayPerfStat(runDir string, artifact *model.Artifact) error {
@@ -266,6 +485,17 @@ func (a *App) displayC2CReport(runDir string, artifact *model.Artifact) error {
 	return nil
 }
 
+func (a *App) displayMemReport(runDir string, artifact *model.Artifact) error {
+	reportPath := filepath.Join(runDir, artifact.File)
+	fmt.Printf("Mem Report: %s\n", reportPath)
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return fmt.Errorf("failed to read mem report: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
 func (a *App) displayStdout(runDir string, artifact *model.Artifact) error {
 	stdoutPath := filepath.Join(runDir, artifact.File)
 	fmt.Printf("Test Output (stdout): %s\n", stdoutPath)
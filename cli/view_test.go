@@ -1,8 +1,18 @@
 package cli
 
 import (
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/history"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRemoveFirstDashDash(t *testing.T) {
@@ -127,6 +137,12 @@ func TestParseViewArgs(t *testing.T) {
 			wantID:        "-2",
 			wantPprofArgs: []string{"-http=:8080", "-nodefraction=0.1"},
 		},
+		{
+			name:          "commit with pprof args",
+			in:            []string{"commit:1a2b3c", "-top"},
+			wantID:        "commit:1a2b3c",
+			wantPprofArgs: []string{"-top"},
+		},
 		{
 			name:          "ID 0 with -- and multiple pprof args",
 			in:            []string{"0", "--", "-http=:8080", "-top", "-cum"},
@@ -147,3 +163,150 @@ func TestParseViewArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestFindEntry(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	entry := func(id string, age time.Duration, git *model.Git) history.Entry {
+		return history.Entry{History: model.History{ID: id, Timestamp: ts.Add(-age), Git: git}}
+	}
+	// Unsorted, the newest run of commit 1a2b3c on main is bbbb
+	entries := []history.Entry{
+		entry("aaaa", 3*time.Hour, &model.Git{Commit: "1a2b3c4d", Branch: "main"}),
+		entry("bbbb", time.Hour, &model.Git{Commit: "1A2B3C4D", Branch: "main"}),
+		entry("cccc", 0, &model.Git{Commit: "9f8e7d6c", Branch: "feature/x"}),
+		entry("dddd", 2*time.Hour, &model.Git{Commit: "1a2b3c4d", Branch: "main"}),
+		entry("eeee", 30*time.Minute, nil),
+	}
+
+	tests := []struct {
+		arg     string
+		wantID  string
+		wantErr string
+	}{
+		{arg: "0", wantID: "cccc"},
+		{arg: "-1", wantID: "eeee"},
+		{arg: "dd", wantID: "dddd"},
+		{arg: "commit:1a2b", wantID: "bbbb"},
+		{arg: "commit:1A2B3C4D", wantID: "bbbb"},
+		{arg: "commit:9f8", wantID: "cccc"},
+		{arg: "branch:main", wantID: "bbbb"},
+		{arg: "branch:feature/x", wantID: "cccc"},
+		{arg: "commit:ffff", wantErr: "no history entry found matching commit:ffff"},
+		{arg: "commit:xyz", wantErr: "invalid commit: xyz (use a hex commit prefix)"},
+		{arg: "branch:release", wantErr: "no history entry found matching branch:release"},
+		{arg: "branch:", wantErr: "invalid argument: branch: (branch name missing)"},
+		{arg: "tag:v1", wantErr: "invalid argument: tag:v1 (use 0 for last, -1 for second-to-last, a valid hex ID prefix, commit:<sha> or branch:<name>)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := findEntry(entries, tt.arg)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantID, got.History.ID)
+		})
+	}
+}
+
+// captureStdout returns everything written to os.Stdout while fn runs.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	fn()
+	require.NoError(t, w.Close())
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestDisplayHistoryEntry_MemReport(t *testing.T) {
+	runDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "mem-report.txt"), []byte("# Samples: 42 of event 'ldlat-loads'\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "stdout.txt"), []byte("PASS\n"), 0644))
+
+	entry := &history.Entry{
+		FullPath: runDir,
+		History: model.History{
+			ID:        "0123456789abcdef",
+			Timestamp: time.Now(),
+			Perf: &model.Perf{
+				Mem: &model.PerfMem{Type: "load", LoadLatency: 30},
+			},
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypeStdout, File: "stdout.txt"},
+				{Type: model.ArtifactTypePerfMemReport, File: "mem-report.txt"},
+				{Type: model.ArtifactTypePerfData, File: "perf.data"},
+			},
+		},
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	var err error
+	out := captureStdout(t, func() {
+		err = a.displayHistoryEntry(entry, nil, false, threadFilter{})
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, out, "Perf Mem: type=load, ldlat=30")
+	require.Contains(t, out, "Perf Data: "+filepath.Join(runDir, "perf.data")+" (open with perfgo view --perf-report 01234567)")
+	require.Contains(t, out, "Mem Report: "+filepath.Join(runDir, "mem-report.txt"))
+	require.Contains(t, out, "# Samples: 42 of event 'ldlat-loads'")
+	// The mem report takes priority over the test output
+	require.NotContains(t, out, "PASS")
+}
+
+func TestExtractViewFlag(t *testing.T) {
+	tests := []struct {
+		in         []string
+		wantArgs   []string
+		wantFolded bool
+	}{
+		{in: nil, wantArgs: nil},
+		{in: []string{"--folded"}, wantArgs: []string{}, wantFolded: true},
+		{in: []string{"--folded", "-1"}, wantArgs: []string{"-1"}, wantFolded: true},
+		{in: []string{"abc123", "--folded"}, wantArgs: []string{"abc123"}, wantFolded: true},
+		{in: []string{"-1", "--", "--folded"}, wantArgs: []string{"-1", "--", "--folded"}},
+		{in: []string{"-top"}, wantArgs: []string{"-top"}},
+	}
+
+	for _, tt := range tests {
+		args, folded := extractViewFlag(tt.in, "--folded")
+		require.Equal(t, tt.wantArgs, args, "args of %v", tt.in)
+		require.Equal(t, tt.wantFolded, folded, "folded of %v", tt.in)
+	}
+}
+
+func TestDisplayFolded(t *testing.T) {
+	runDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, "perf.folded"), []byte("main.main;main.work 7\n"), 0644))
+
+	entry := &history.Entry{
+		FullPath: runDir,
+		History: model.History{
+			ID: "0123456789abcdef",
+			Artifacts: []model.Artifact{
+				{Type: model.ArtifactTypePprofProfile, File: "perf.pb.gz"},
+				{Type: model.ArtifactTypeFoldedStacks, File: "perf.folded"},
+			},
+		},
+	}
+
+	a := &App{logger: zerolog.Nop()}
+	var buf strings.Builder
+	require.NoError(t, a.displayFolded(&buf, entry))
+	require.Equal(t, "main.main;main.work 7\n", buf.String())
+
+	entry.History.Artifacts = entry.History.Artifacts[:1]
+	require.EqualError(t, a.displayFolded(&buf, entry), "run 01234567 has no folded stacks, record it with --folded")
+}
@@ -0,0 +1,236 @@
+package cli
+
+// This file contains test --watch, which re-runs a profile whenever a Go file
+// of the tested packages changes and serves the latest profile in the pprof
+// web UI at a fixed address.
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/pprof/driver"
+	"github.com/perfgo/perfgo/history"
+	"github.com/urfave/cli/v2"
+)
+
+// watchDebounce is how long the files must be left unchanged before a change
+// triggers a run, so saving several files at once runs the tests once.
+const watchDebounce = 300 * time.Millisecond
+
+// watchFlag returns the flag re-running the tests on file changes.
+func watchFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "watch",
+		Usage: "Re-run whenever a Go file of the package changes, serving the latest profile in the pprof web UI",
+	}
+}
+
+// isWatchedFile reports whether a change to the file name triggers a run.
+// Only Go files do, hidden files such as editor swap files are ignored.
+func isWatchedFile(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasSuffix(base, ".go") && !strings.HasPrefix(base, ".")
+}
+
+// debounce sends on the returned channel once nothing was received from in
+// for delay, so a burst of values results in a single one. The returned
+// channel is closed when in is closed.
+func debounce(in <-chan struct{}, delay time.Duration) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(delay)
+		timer.Stop()
+		var fire <-chan time.Time
+		for {
+			select {
+			case _, ok := <-in:
+				if !ok {
+					timer.Stop()
+					return
+				}
+				timer.Reset(delay)
+				fire = timer.C
+			case <-fire:
+				fire = nil
+				// A run that is still pending covers this change too
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// watchChanges relays the changes of Go files reported by watcher to
+// changes until the watcher is closed.
+func watchChanges(watcher *fsnotify.Watcher, changes chan<- struct{}) {
+	defer close(changes)
+	for event := range watcher.Events {
+		if event.Op == fsnotify.Chmod || !isWatchedFile(event.Name) {
+			continue
+		}
+		changes <- struct{}{}
+	}
+}
+
+// profileUI serves the pprof web UI of the latest profile of a watch,
+// swapping in the handlers of each new profile.
+type profileUI struct {
+	mu      sync.RWMutex
+	mux     *http.ServeMux
+	cleanup func()
+}
+
+// ServeHTTP implements http.Handler.
+func (u *profileUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.RLock()
+	mux := u.mux
+	u.mu.RUnlock()
+
+	if mux == nil {
+		http.Error(w, "waiting for the first profile", http.StatusServiceUnavailable)
+		return
+	}
+	mux.ServeHTTP(w, r)
+}
+
+// load runs pprof with args and serves its web UI in place of the previous
+// one. cleanup removes the files of the profile once it's replaced.
+func (u *profileUI) load(args []string, cleanup func()) error {
+	err := driver.PProf(&driver.Options{
+		Flagset: newPprofFlags(args),
+		HTTPServer: func(args *driver.HTTPServerArgs) error {
+			mux := http.NewServeMux()
+			for pattern, handler := range args.Handlers {
+				mux.Handle(pattern, handler)
+			}
+
+			u.mu.Lock()
+			defer u.mu.Unlock()
+			u.mux = mux
+			// The replaced profile's files are removed below instead
+			u.cleanup, cleanup = cleanup, u.cleanup
+			return nil
+		},
+	})
+	if cleanup != nil {
+		cleanup()
+	}
+	return err
+}
+
+// close removes the files of the profile served last.
+func (u *profileUI) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.cleanup != nil {
+		u.cleanup()
+		u.cleanup = nil
+	}
+}
+
+// serveResult serves the profile of the run in ui at addr, opening the
+// browser if openBrowser is set.
+func (a *App) serveResult(ui *profileUI, result *TestResult, addr string, openBrowser bool) error {
+	entry := &history.Entry{History: *result.History, FullPath: result.RunDir}
+	artifact, err := findProfile(&entry.History)
+	if err != nil {
+		return err
+	}
+
+	profilePath, cleanup, err := a.pprofProfile(entry, artifact)
+	if err != nil {
+		return err
+	}
+	pprofArgs := a.defaultSampleIndex(&entry.History, profilePath, []string{"-http=" + addr})
+	if !openBrowser {
+		pprofArgs = append(pprofArgs, "-no_browser")
+	}
+
+	binary, err := mainBinary(profilePath)
+	if err != nil {
+		cleanup()
+		return err
+	}
+	return ui.load(serveArgs(pprofArgs, binary, profilePath), cleanup)
+}
+
+// watchTest runs the tests of opts, then runs them again whenever a Go file
+// of the tested packages changes until perfgo is interrupted. The profile of
+// the latest successful run is served in the pprof web UI.
+func (a *App) watchTest(opts TestOptions) error {
+	if len(opts.Args) < 1 {
+		return fmt.Errorf("no package path specified: please provide a package path or pattern (e.g., '.', './pkg/example' or './...')")
+	}
+	packages, err := a.resolveTestPackages(opts.Args[0])
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch files: %w", err)
+	}
+	defer watcher.Close()
+	for _, pkg := range packages {
+		if err := watcher.Add(pkg.Dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", pkg.Dir, err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return fmt.Errorf("failed to start the pprof web UI: %w", err)
+	}
+	addr := listener.Addr().String()
+	ui := &profileUI{}
+	defer ui.close()
+	server := &http.Server{Handler: ui}
+	go server.Serve(listener)
+	defer server.Close()
+
+	changes := make(chan struct{})
+	go watchChanges(watcher, changes)
+	runs := debounce(changes, watchDebounce)
+
+	sigChan := make(chan os.Signal, 1)
+	notifyInterrupt(sigChan)
+	defer signal.Stop(sigChan)
+
+	served := false
+	for {
+		result, err := a.RunTest(opts)
+		if err != nil {
+			a.logger.Error().Err(err).Msg("Run failed")
+		}
+		if result != nil && result.History.ExitCode == 0 {
+			if err := a.serveResult(ui, result, addr, !served); err != nil {
+				a.logger.Error().Err(err).Msg("Failed to serve profile")
+			} else {
+				served = true
+				fmt.Printf("Serving profile of run %s at %s\n", result.History.ID[:8], pprofURL(addr))
+			}
+		}
+		fmt.Printf("Watching %d package directories for changes, press Ctrl-C to stop\n", len(packages))
+
+		select {
+		case <-runs:
+			a.logger.Info().Msg("Go files changed, re-running")
+		case err := <-watcher.Errors:
+			return fmt.Errorf("failed to watch files: %w", err)
+		case <-sigChan:
+			return nil
+		}
+	}
+}
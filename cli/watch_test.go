@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWatchedFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "/src/pkg/a.go", want: true},
+		{name: "/src/pkg/a_test.go", want: true},
+		{name: "a.go", want: true},
+		{name: "/src/pkg/go.mod"},
+		{name: "/src/pkg/README.md"},
+		{name: "/src/pkg/a.go~"},
+		{name: "/src/pkg/.a.go.swp"},
+		{name: "/src/pkg/.#a.go"},
+		{name: "/src/pkg/testdata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isWatchedFile(tt.name))
+		})
+	}
+}
+
+// receive returns how many values arrive on c within wait.
+func receive(c <-chan struct{}, wait time.Duration) int {
+	n := 0
+	timeout := time.After(wait)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return n
+			}
+			n++
+		case <-timeout:
+			return n
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	in := make(chan struct{})
+	out := debounce(in, delay)
+
+	// Nothing is sent without changes
+	assert.Equal(t, 0, receive(out, 3*delay))
+
+	// A burst of changes results in a single run
+	for range 5 {
+		in <- struct{}{}
+		time.Sleep(delay / 4)
+	}
+	assert.Equal(t, 1, receive(out, 5*delay))
+
+	// Changes after the quiet period run again
+	in <- struct{}{}
+	assert.Equal(t, 1, receive(out, 5*delay))
+
+	close(in)
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestWatchChanges(t *testing.T) {
+	dir := t.TempDir()
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	require.NoError(t, watcher.Add(dir))
+
+	changes := make(chan struct{}, 10)
+	go watchChanges(watcher, changes)
+
+	// Only Go files trigger
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".a.go.swp"), []byte("swap"), 0o644))
+	assert.Equal(t, 0, receive(changes, 100*time.Millisecond))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o644))
+	assert.Positive(t, receive(changes, 100*time.Millisecond))
+
+	require.NoError(t, watcher.Close())
+	assert.Equal(t, 0, receive(changes, time.Second))
+}
+
+func TestProfileUI_WaitsForProfile(t *testing.T) {
+	ui := &profileUI{}
+	rec := httptest.NewRecorder()
+	ui.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flamegraph", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestProfileUI_Load(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{4}}},
+	}
+	path := filepath.Join(t.TempDir(), "perf.pb.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(f))
+	require.NoError(t, f.Close())
+
+	ui := &profileUI{}
+	var cleaned []string
+	args := []string{"-http=localhost:0", "-no_browser", path}
+	require.NoError(t, ui.load(args, func() { cleaned = append(cleaned, "first") }))
+
+	rec := httptest.NewRecorder()
+	ui.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "main.work")
+
+	// The replaced profile is cleaned up, the served one on close
+	require.NoError(t, ui.load(args, func() { cleaned = append(cleaned, "second") }))
+	assert.Equal(t, []string{"first"}, cleaned)
+	ui.close()
+	assert.Equal(t, []string{"first", "second"}, cleaned)
+}
@@ -20,15 +20,57 @@ type Entry struct {
 	FullPath string
 }
 
-// GetPerfgoRoot returns the .perfgo directory path from the git repository root.
-func GetPerfgoRoot() (string, error) {
+// EnvHome is the environment variable overriding the perfgo root directory.
+const EnvHome = "PERFGO_HOME"
+
+// ResolveRoot returns the perfgo root directory holding the history. In order
+// of precedence it is outputDir (--output-dir), home (PERFGO_HOME), .perfgo in
+// the git repository root or .perfgo in the current directory when not
+// running in a git repository.
+func ResolveRoot(outputDir, home, gitRoot, cwd string) string {
+	switch {
+	case outputDir != "":
+		return outputDir
+	case home != "":
+		return home
+	case gitRoot != "":
+		return filepath.Join(gitRoot, ".perfgo")
+	default:
+		return filepath.Join(cwd, ".perfgo")
+	}
+}
+
+// Root returns the perfgo root directory for the current directory, see
+// ResolveRoot.
+func Root(outputDir string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Not being in a git repository is fine, the current directory is used
+	gitRoot, _ := GitRoot()
+
+	return ResolveRoot(outputDir, os.Getenv(EnvHome), gitRoot, cwd), nil
+}
+
+// GitRoot returns the root directory of the git repository containing the
+// current directory.
+func GitRoot() (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("not in a git repository: %w", err)
 	}
-	repoRoot := strings.TrimSpace(string(output))
-	perfgoRoot := filepath.Join(repoRoot, ".perfgo")
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetPerfgoRoot returns the existing perfgo root directory, see Root.
+func GetPerfgoRoot(outputDir string) (string, error) {
+	perfgoRoot, err := Root(outputDir)
+	if err != nil {
+		return "", err
+	}
 
 	// Check if .perfgo directory exists
 	if _, err := os.Stat(perfgoRoot); os.IsNotExist(err) {
@@ -38,7 +80,7 @@ func GetPerfgoRoot() (string, error) {
 	return perfgoRoot, nil
 }
 
-// LoadEntries loads all history entries from the .perfgo directory.
+// LoadEntries loads all history entries from the perfgo root directory.
 func LoadEntries(logger zerolog.Logger, perfgoRoot string) ([]Entry, error) {
 	var entries []Entry
 
@@ -49,6 +91,7 @@ func LoadEntries(logger zerolog.Logger, perfgoRoot string) ([]Entry, error) {
 
 		if d.IsDir() {
 			historyPath := filepath.Join(path, "history.json")
+			legacyPath := filepath.Join(path, legacyTestRunFile)
 			if _, err := os.Stat(historyPath); err == nil {
 				history, err := parseHistoryJSON(historyPath)
 				if err != nil {
@@ -56,6 +99,19 @@ func LoadEntries(logger zerolog.Logger, perfgoRoot string) ([]Entry, error) {
 					return nil
 				}
 
+				entries = append(entries, Entry{
+					History:  history,
+					FullPath: path,
+				})
+			} else if _, err := os.Stat(legacyPath); err == nil {
+				// Runs recorded before history.json are converted in memory
+				history, err := parseLegacyTestRun(legacyPath)
+				if err != nil {
+					logger.Warn().Err(err).Str("path", legacyPath).Msg("Failed to parse legacy testrun.json")
+					return nil
+				}
+				logger.Debug().Str("path", legacyPath).Msg("Migrated legacy testrun.json")
+
 				entries = append(entries, Entry{
 					History:  history,
 					FullPath: path,
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveRoot(t *testing.T) {
+	tests := []struct {
+		name      string
+		outputDir string
+		home      string
+		gitRoot   string
+		cwd       string
+		want      string
+	}{
+		{
+			name:      "output dir takes precedence",
+			outputDir: "/out",
+			home:      "/home/perfgo",
+			gitRoot:   "/src/repo",
+			cwd:       "/src/repo/pkg",
+			want:      "/out",
+		},
+		{
+			name:    "home before git repository",
+			home:    "/home/perfgo",
+			gitRoot: "/src/repo",
+			cwd:     "/src/repo/pkg",
+			want:    "/home/perfgo",
+		},
+		{
+			name:    "git repository root",
+			gitRoot: "/src/repo",
+			cwd:     "/src/repo/pkg",
+			want:    filepath.Join("/src/repo", ".perfgo"),
+		},
+		{
+			name: "current directory outside git",
+			cwd:  "/tmp/work",
+			want: filepath.Join("/tmp/work", ".perfgo"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ResolveRoot(tt.outputDir, tt.home, tt.gitRoot, tt.cwd))
+		})
+	}
+}
+
+func TestRoot_NoGit(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv(EnvHome, "")
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	_, err := GitRoot()
+	require.Error(t, err)
+
+	root, err := Root("")
+	require.NoError(t, err)
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cwd, ".perfgo"), root)
+
+	t.Setenv(EnvHome, "/home/perfgo")
+	root, err = Root("")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/perfgo", root)
+}
+
+func TestGetPerfgoRoot_Missing(t *testing.T) {
+	_, err := GetPerfgoRoot(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no test runs found")
+}
@@ -0,0 +1,79 @@
+package history
+
+// This file contains the migration of runs recorded in the legacy
+// testrun.json format, which predates history.json.
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/perfgo/perfgo/model"
+)
+
+// legacyTestRunFile is the metadata file of runs recorded before history.json.
+const legacyTestRunFile = "testrun.json"
+
+// legacyTestRun is the flat metadata format of testrun.json.
+type legacyTestRun struct {
+	ID         string           `json:"id"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Args       []string         `json:"args"`
+	WorkDir    string           `json:"workdir"`
+	ExitCode   int              `json:"exit_code"`
+	Duration   time.Duration    `json:"duration"`
+	Commit     string           `json:"commit,omitempty"`
+	Branch     string           `json:"branch,omitempty"`
+	RemoteHost string           `json:"remote_host,omitempty"`
+	OS         string           `json:"os,omitempty"`
+	Arch       string           `json:"arch,omitempty"`
+	Artifacts  []model.Artifact `json:"artifacts,omitempty"`
+}
+
+// parseLegacyTestRun parses a testrun.json file and converts it to a History.
+func parseLegacyTestRun(path string) (model.History, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return model.History{}, err
+	}
+
+	var run legacyTestRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return model.History{}, err
+	}
+
+	return convertLegacyTestRun(run), nil
+}
+
+// convertLegacyTestRun maps a legacy test run to the current History format.
+func convertLegacyTestRun(run legacyTestRun) model.History {
+	history := model.History{
+		SchemaVersion: model.HistorySchemaVersion,
+		ID:            run.ID,
+		Type:          model.HistoryTypeTest,
+		Timestamp:     run.Timestamp,
+		Args:          run.Args,
+		WorkDir:       run.WorkDir,
+		ExitCode:      run.ExitCode,
+		Duration:      run.Duration,
+		Artifacts:     run.Artifacts,
+		Test:          &model.TestRun{},
+	}
+
+	if run.Commit != "" || run.Branch != "" {
+		history.Git = &model.Git{
+			Commit: run.Commit,
+			Branch: run.Branch,
+		}
+	}
+
+	if run.RemoteHost != "" || run.OS != "" || run.Arch != "" {
+		history.Target = &model.Target{
+			RemoteHost: run.RemoteHost,
+			OS:         run.OS,
+			Arch:       run.Arch,
+		}
+	}
+
+	return history
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleTestRunJSON = `{
+  "id": "8f3a2c1d4e5b6a7980f1e2d3c4b5a697",
+  "timestamp": "2025-03-14T09:26:53Z",
+  "args": ["perfgo", "test", "profile", "--", "./examples/false-sharing", "-bench=."],
+  "workdir": "examples/false-sharing",
+  "exit_code": 1,
+  "duration": 2500000000,
+  "commit": "0123456789abcdef0123456789abcdef01234567",
+  "branch": "main",
+  "remote_host": "bench@perf-01",
+  "os": "linux",
+  "arch": "amd64",
+  "artifacts": [
+    {"type": 0, "size": 2048, "file": "perf.pb.gz"},
+    {"type": 1, "size": 4096, "file": "abc.perfgo.test.binary"}
+  ]
+}`
+
+func TestParseLegacyTestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), legacyTestRunFile)
+	require.NoError(t, os.WriteFile(path, []byte(sampleTestRunJSON), 0o644))
+
+	history, err := parseLegacyTestRun(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, model.History{
+		SchemaVersion: model.HistorySchemaVersion,
+		ID:            "8f3a2c1d4e5b6a7980f1e2d3c4b5a697",
+		Type:          model.HistoryTypeTest,
+		Timestamp:     time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC),
+		Args:          []string{"perfgo", "test", "profile", "--", "./examples/false-sharing", "-bench=."},
+		WorkDir:       "examples/false-sharing",
+		ExitCode:      1,
+		Duration:      2500 * time.Millisecond,
+		Git: &model.Git{
+			Commit: "0123456789abcdef0123456789abcdef01234567",
+			Branch: "main",
+		},
+		Target: &model.Target{
+			RemoteHost: "bench@perf-01",
+			OS:         "linux",
+			Arch:       "amd64",
+		},
+		Artifacts: []model.Artifact{
+			{Type: model.ArtifactTypePprofProfile, Size: 2048, File: "perf.pb.gz"},
+			{Type: model.ArtifactTypeTestBinary, Size: 4096, File: "abc.perfgo.test.binary"},
+		},
+		Test: &model.TestRun{},
+	}, history)
+}
+
+func TestConvertLegacyTestRun_Minimal(t *testing.T) {
+	history := convertLegacyTestRun(legacyTestRun{ID: "abc"})
+	assert.Nil(t, history.Git)
+	assert.Nil(t, history.Target)
+	assert.Equal(t, model.HistoryTypeTest, history.Type)
+}
+
+func TestLoadEntries_MigratesLegacyTestRun(t *testing.T) {
+	root := t.TempDir()
+
+	legacyDir := filepath.Join(root, "history", "8f3a2c1d4e5b6a7980f1e2d3c4b5a697")
+	require.NoError(t, os.MkdirAll(legacyDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(legacyDir, legacyTestRunFile), []byte(sampleTestRunJSON), 0o644))
+
+	currentDir := filepath.Join(root, "history", "20250315-100000-01234567-deadbeef")
+	require.NoError(t, os.MkdirAll(currentDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(currentDir, "history.json"), []byte(`{"schema_version": 1, "id": "deadbeef", "type": "test"}`), 0o644))
+
+	entries, err := LoadEntries(zerolog.Nop(), root)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	ids := map[string]string{}
+	for _, entry := range entries {
+		ids[entry.History.ID] = entry.FullPath
+	}
+	assert.Equal(t, legacyDir, ids["8f3a2c1d4e5b6a7980f1e2d3c4b5a697"])
+	assert.Equal(t, currentDir, ids["deadbeef"])
+}
@@ -10,11 +10,19 @@ const (
 	HistoryTypeAttach HistoryType = "attach"
 )
 
+// HistorySchemaVersion is the current version of the history.json format.
+// Entries without a version predate versioning and are read as version 0.
+const HistorySchemaVersion = 1
+
 // History represents a single perfgo execution (test or attach)
 // It contains common fields shared by all execution types.
 type History struct {
+	// Version of the history.json format
+	SchemaVersion int `json:"schema_version,omitempty"`
 	// Unique ID for this execution (16 random bytes, hex encoded)
 	ID string `json:"id"`
+	// ID shared by the runs of one --matrix invocation
+	BatchID string `json:"batch_id,omitempty"`
 	// Type of execution (test or attach)
 	Type HistoryType `json:"type"`
 	// Timestamp when the execution started
@@ -27,6 +35,8 @@ type History struct {
 	ExitCode int `json:"exit_code"`
 	// Duration of execution
 	Duration time.Duration `json:"duration"`
+	// Non-fatal problems detected during the execution (e.g. an empty profile)
+	Warnings []string `json:"warnings,omitempty"`
 	// Git information
 	Git *Git `json:"git,omitempty"`
 	// Target execution environment
@@ -49,6 +59,10 @@ type Git struct {
 	Branch string `json:"branch,omitempty"`
 	// Repository name
 	Repo string `json:"repo,omitempty"`
+	// Closest tag or abbreviated commit when HEAD was detached
+	Describe string `json:"describe,omitempty"`
+	// Whether the worktree had uncommitted or untracked changes
+	Dirty bool `json:"dirty,omitempty"`
 }
 
 // Target contains information about the execution environment
@@ -59,16 +73,28 @@ type Target struct {
 	OS string `json:"os,omitempty"`
 	// CPU architecture of the execution environment
 	Arch string `json:"arch,omitempty"`
+	// CPU vendor of the execution environment (intel, amd, arm or unknown)
+	Vendor string `json:"vendor,omitempty"`
+	// Kernel release of the execution environment (uname -r)
+	KernelRelease string `json:"kernel_release,omitempty"`
+	// Version of perf in the execution environment (perf --version)
+	PerfVersion string `json:"perf_version,omitempty"`
+	// GOMAXPROCS the test binary was run with
+	GOMAXPROCS int `json:"gomaxprocs,omitempty"`
+	// CPUs the execution was pinned to (taskset -c list)
+	CPUAffinity string `json:"cpu_affinity,omitempty"`
 }
 
 // Perf contains performance profiling options that were used
 type Perf struct {
-	// Record options (for profile mode) - only one of Record, Stat, or C2C should be set
+	// Record options (for profile mode) - only one of Record, Stat, C2C, or Mem should be set
 	Record *PerfRecord `json:"record,omitempty"`
-	// Stat options (for stat mode) - only one of Record, Stat, or C2C should be set
+	// Stat options (for stat mode) - only one of Record, Stat, C2C, or Mem should be set
 	Stat *PerfStat `json:"stat,omitempty"`
-	// C2C options (for cache-to-cache mode) - only one of Record, Stat, or C2C should be set
+	// C2C options (for cache-to-cache mode) - only one of Record, Stat, C2C, or Mem should be set
 	C2C *PerfC2C `json:"c2c,omitempty"`
+	// Mem options (for memory access mode) - only one of Record, Stat, C2C, or Mem should be set
+	Mem *PerfMem `json:"mem,omitempty"`
 }
 
 // PerfRecord contains perf record options that were used
@@ -79,8 +105,23 @@ type PerfRecord struct {
 	Count int `json:"count,omitempty"`
 	// Process IDs that were profiled
 	PIDs []string `json:"pids,omitempty"`
+	// Cgroup that was profiled system-wide instead of the PIDs (--cgroup)
+	Cgroup string `json:"cgroup,omitempty"`
 	// Duration in seconds (for attach mode)
 	Duration int `json:"duration,omitempty"`
+	// Seconds after which sampling was stopped while the test kept running,
+	// rounded up
+	MaxDurationSeconds int `json:"max_duration_seconds,omitempty"`
+	// Whether branch stacks (LBR) were recorded
+	BranchStack bool `json:"branch_stack,omitempty"`
+	// Branch types that were recorded (perf record -j)
+	BranchFilter string `json:"branch_filter,omitempty"`
+	// Call graph mode selected by the probe (fp, dwarf or lbr)
+	CallGraph string `json:"call_graph,omitempty"`
+	// Event view selects in profiles of multiple events (--default-event)
+	DefaultEvent string `json:"default_event,omitempty"`
+	// Number of runs whose profiles were merged (--repeat)
+	Repeat int `json:"repeat,omitempty"`
 }
 
 // PerfStat contains perf stat options that were used
@@ -93,6 +134,12 @@ type PerfStat struct {
 	Duration int `json:"duration,omitempty"`
 	// Whether detailed statistics were enabled
 	Detail bool `json:"detail,omitempty"`
+	// Number of runs whose counters were aggregated (--repeat)
+	Repeat int `json:"repeat,omitempty"`
+	// Number of runs perf stat aggregated itself (--perf-repeat, perf stat -r)
+	PerfRepeat int `json:"perf_repeat,omitempty"`
+	// Aggregation mode of the counts (core, socket or thread), empty for the whole run
+	Aggregation string `json:"aggregation,omitempty"`
 }
 
 // PerfC2C contains perf c2c options that were used
@@ -111,10 +158,75 @@ type PerfC2C struct {
 	ShowAll bool `json:"show_all,omitempty"`
 }
 
+// PerfMem contains perf mem options that were used
+type PerfMem struct {
+	// Memory operation type sampled (load, store, or empty for both)
+	Type string `json:"type,omitempty"`
+	// Event to record (e.g., "ldlat-loads")
+	Event string `json:"event,omitempty"`
+	// Minimum load latency in cycles that was sampled
+	LoadLatency int `json:"load_latency,omitempty"`
+	// Process IDs that were profiled
+	PIDs []string `json:"pids,omitempty"`
+	// Duration in seconds (for attach mode)
+	Duration int `json:"duration,omitempty"`
+	// Report mode used (stdio or tui)
+	ReportMode string `json:"report_mode,omitempty"`
+	// Sort keys used for the report
+	Sort string `json:"sort,omitempty"`
+}
+
 // TestRun contains test-specific fields
 type TestRun struct {
 	// Package path that was tested (e.g., ".", "./pkg/foo")
 	PackagePath string `json:"package_path,omitempty"`
+	// Results per package when the package path matched several packages
+	Packages []PackageResult `json:"packages,omitempty"`
+	// Environment assignments go test -c was run with (e.g., GOOS, CGO_ENABLED, CC)
+	BuildEnv []string `json:"build_env,omitempty"`
+	// Results of the benchmarks found in the test output
+	Benchmarks []BenchmarkResult `json:"benchmarks,omitempty"`
+	// Go memory profile options (for mprofile mode)
+	MemProfile *MemProfile `json:"mem_profile,omitempty"`
+	// Whether the profile is a Go CPU profile (-test.cpuprofile) instead of a perf record profile
+	CPUProfile bool `json:"cpu_profile,omitempty"`
+}
+
+// MemProfile contains the options of a Go memory profile written by the test
+// binary (-test.memprofile)
+type MemProfile struct {
+	// Bytes allocated per sampled allocation (-test.memprofilerate), 0 for the runtime default
+	Rate int `json:"rate,omitempty"`
+}
+
+// BenchmarkResult contains the result of a benchmark as printed by go test -bench
+type BenchmarkResult struct {
+	// Import path of the benchmark's package, if printed (pkg: line)
+	Package string `json:"package,omitempty"`
+	// Benchmark name including the GOMAXPROCS suffix (e.g., BenchmarkFoo-8)
+	Name string `json:"name"`
+	// Number of iterations the result was measured over
+	Iterations int64 `json:"iterations"`
+	// Nanoseconds per iteration
+	NsPerOp float64 `json:"ns_per_op"`
+	// Whether the memory allocations were reported (-benchmem)
+	Benchmem bool `json:"benchmem,omitempty"`
+	// Bytes allocated per iteration
+	BytesPerOp int64 `json:"bytes_per_op,omitempty"`
+	// Allocations per iteration
+	AllocsPerOp int64 `json:"allocs_per_op,omitempty"`
+}
+
+// PackageResult contains the outcome of running the tests of one package
+type PackageResult struct {
+	// Import path of the package
+	ImportPath string `json:"import_path"`
+	// Package directory relative to the working directory
+	Dir string `json:"dir,omitempty"`
+	// Exit code of the package's test binary
+	ExitCode int `json:"exit_code"`
+	// Duration of the package's test run
+	Duration time.Duration `json:"duration"`
 }
 
 // AttachRun contains attach-specific fields
@@ -125,8 +237,39 @@ type AttachRun struct {
 	Namespace string `json:"namespace,omitempty"`
 	// Pod name that was attached to
 	PodName string `json:"pod_name,omitempty"`
+	// Label selector the pod was chosen by (--selector)
+	Selector string `json:"selector,omitempty"`
 	// Node name that was attached to
 	NodeName string `json:"node_name,omitempty"`
+	// SSH host that was attached to without Kubernetes (--remote-host)
+	Host string `json:"host,omitempty"`
+	// Name the attached processes were found by (--process)
+	Process string `json:"process,omitempty"`
+	// Whether perf ran on all CPUs instead of selected processes (perfgo system)
+	SystemWide bool `json:"system_wide,omitempty"`
+	// Resource usage of the pod before and after the perf run (kubectl top)
+	UsageBefore *ResourceUsage `json:"usage_before,omitempty"`
+	UsageAfter  *ResourceUsage `json:"usage_after,omitempty"`
+}
+
+// ResourceUsage contains the resource usage of a pod at a point in time
+type ResourceUsage struct {
+	// CPU usage of all containers in millicores
+	CPUMillicores int64 `json:"cpu_millicores"`
+	// Memory working set of all containers in bytes
+	MemoryBytes int64 `json:"memory_bytes"`
+	// Usage of each container
+	Containers []ContainerUsage `json:"containers,omitempty"`
+}
+
+// ContainerUsage contains the resource usage of a container
+type ContainerUsage struct {
+	// Container name
+	Name string `json:"name"`
+	// CPU usage in millicores
+	CPUMillicores int64 `json:"cpu_millicores"`
+	// Memory working set in bytes
+	MemoryBytes int64 `json:"memory_bytes"`
 }
 
 // ArtifactType identifies the type of artifact
@@ -142,11 +285,22 @@ const (
 	ArtifactTypePerfC2CReport
 	ArtifactTypeStdout
 	ArtifactTypeStderr
+	ArtifactTypePerfMemReport
+	ArtifactTypeFoldedStacks
+	ArtifactTypeSymbols
+	ArtifactTypePerfData
+	ArtifactTypePprofProfileRun
+	ArtifactTypePerfStatRun
+	ArtifactTypeProfileText
+	ArtifactTypeProfileJSON
 )
 
 // Artifact represents a file generated during execution
 type Artifact struct {
-	Type ArtifactType `json:"type"`
-	Size uint64       `json:"size"`
-	File string       `json:"file"` // relative to run dir
+	Type       ArtifactType `json:"type"`
+	Size       uint64       `json:"size"`
+	File       string       `json:"file"`                 // relative to run dir
+	Hash       string       `json:"hash,omitempty"`       // content hash of binaries kept in the shared object store
+	Compressed bool         `json:"compressed,omitempty"` // file is gzip compressed (File ends in .gz)
+	BuildID    string       `json:"build_id,omitempty"`   // GNU build-id of binaries and symbol files
 }
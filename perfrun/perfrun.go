@@ -0,0 +1,109 @@
+// Package perfrun runs Go tests under perf from Go code, the library
+// counterpart of the perfgo test subcommands.
+package perfrun
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perfgo/perfgo/cli"
+	"github.com/perfgo/perfgo/cli/perf"
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+)
+
+// Perf modes of a run
+const (
+	ModeTest    = ""        // Run the tests without perf
+	ModeProfile = "profile" // perf record, writing a pprof profile
+	ModeStat    = "stat"    // perf stat counters
+	ModeC2C     = "c2c"     // perf c2c cache line contention report
+	ModeMem     = "mem"     // perf mem memory access report
+
+	// Go CPU and memory profiles, without perf
+	ModeCPUProfile = "cpuprofile"
+	ModeMemProfile = "mprofile"
+)
+
+// Options configures a run.
+type Options struct {
+	Package string   // Package path or pattern, e.g. ./pkg/example
+	Args    []string // Build flags and test arguments, e.g. -run TestFoo
+	Mode    string   // One of the Mode constants
+	Events  []string // perf events, the mode's default event if empty
+
+	RemoteHost string // Run on this host over SSH, locally if empty
+	OutputDir  string // Directory holding the history, found like perfgo does if empty
+
+	Runner runner.Runner   // Runs local commands, runner.Default if nil
+	Logger *zerolog.Logger // Logs progress, perfgo's console logger if nil
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	History *model.History
+	// Directory of the run in the history
+	Dir string
+	// Paths of the profiles, reports and binaries stored with the run
+	Artifacts []string
+}
+
+// Run builds and runs the tests of opts.Package and records the run in the
+// history. A failing test returns the recorded result along with the error.
+func Run(opts Options) (*Result, error) {
+	testOpts, err := testOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var appOpts []cli.Option
+	if opts.OutputDir != "" {
+		appOpts = append(appOpts, cli.WithOutputDir(opts.OutputDir))
+	}
+	if opts.Runner != nil {
+		appOpts = append(appOpts, cli.WithRunner(opts.Runner))
+	}
+	if opts.Logger != nil {
+		appOpts = append(appOpts, cli.WithLogger(*opts.Logger))
+	}
+
+	res, err := cli.New(appOpts...).RunTest(testOpts)
+	if res == nil {
+		return nil, err
+	}
+	return &Result{History: res.History, Dir: res.RunDir, Artifacts: res.Artifacts}, err
+}
+
+// testOptions maps opts to the options of the test subcommands.
+func testOptions(opts Options) (cli.TestOptions, error) {
+	if opts.Package == "" {
+		return cli.TestOptions{}, fmt.Errorf("no package path specified")
+	}
+
+	testOpts := cli.TestOptions{
+		Mode:       opts.Mode,
+		Args:       append([]string{opts.Package}, opts.Args...),
+		RemoteHost: opts.RemoteHost,
+		Repeat:     1,
+		Copy:       perf.CopyOptions{Concurrency: perf.DefaultCopyConcurrency},
+	}
+	events := strings.Join(opts.Events, ",")
+	switch opts.Mode {
+	case ModeTest, ModeCPUProfile, ModeMemProfile:
+		if len(opts.Events) > 0 {
+			return cli.TestOptions{}, fmt.Errorf("events require a perf mode")
+		}
+	case ModeProfile:
+		testOpts.Event = events
+	case ModeStat:
+		testOpts.Events = opts.Events
+	case ModeC2C:
+		testOpts.C2CEvent = events
+	case ModeMem:
+		testOpts.Mem.Event = events
+	default:
+		return cli.TestOptions{}, fmt.Errorf("unknown perf mode %q", opts.Mode)
+	}
+	return testOpts, nil
+}
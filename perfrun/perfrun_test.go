@@ -0,0 +1,138 @@
+package perfrun
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/perfgo/perfgo/cli/runner"
+	"github.com/perfgo/perfgo/model"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePerfScript prints one sample in the binary given by
+// $PERFGO_FAKE_BINARY, standing in for the perf commands run directly.
+const fakePerfScript = `#!/bin/sh
+case "$1" in
+script)
+	printf 'perfgo.test 42 [000] 1.000000:     250000 cycles:\n\t          4a1b2c main.work+0x1c (%s)\n\n' "$PERFGO_FAKE_BINARY"
+	;;
+esac
+`
+
+// flagValue returns the value following flag in args.
+func flagValue(args []string, flag string) string {
+	if i := slices.Index(args, flag); i >= 0 && i+1 < len(args) {
+		return args[i+1]
+	}
+	return ""
+}
+
+func TestRun_LocalProfile(t *testing.T) {
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(binDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "perf"), []byte(fakePerfScript), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	module := filepath.Join(dir, "module")
+	require.NoError(t, os.Mkdir(module, 0o755))
+	files := map[string]string{
+		"go.mod":    "module example.com/perfrun\n\ngo 1.24\n",
+		"a.go":      "package perfrun\n\nfunc A() int { return 1 }\n",
+		"a_test.go": "package perfrun\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(module, name), []byte(content), 0o644))
+	}
+	t.Chdir(module)
+
+	fake := &runner.Fake{Handler: func(cmd runner.Cmd) runner.Result {
+		switch {
+		case cmd.Name == "go" && slices.Contains(cmd.Args, "-c"):
+			binary := flagValue(cmd.Args, "-o")
+			t.Setenv("PERFGO_FAKE_BINARY", binary)
+			if err := os.WriteFile(binary, []byte("binary"), 0o755); err != nil {
+				return runner.Result{Err: err}
+			}
+		case cmd.Name == "perf" && len(cmd.Args) > 0 && cmd.Args[0] == "record":
+			if err := os.WriteFile(flagValue(cmd.Args, "-o"), []byte("recorded"), 0o644); err != nil {
+				return runner.Result{Err: err}
+			}
+			return runner.Result{Stdout: "PASS\n"}
+		}
+		return runner.Result{}
+	}}
+	logger := zerolog.Nop()
+	outputDir := filepath.Join(dir, "history")
+
+	result, err := Run(Options{
+		Package:   ".",
+		Args:      []string{"-run", "TestA"},
+		Mode:      ModeProfile,
+		Events:    []string{"cycles"},
+		OutputDir: outputDir,
+		Runner:    fake,
+		Logger:    &logger,
+	})
+	require.NoError(t, err)
+
+	h := result.History
+	assert.Equal(t, ".", h.Test.PackagePath)
+	assert.Equal(t, 0, h.ExitCode)
+	require.NotNil(t, h.Perf)
+	require.NotNil(t, h.Perf.Record)
+	assert.Equal(t, "cycles", h.Perf.Record.Event)
+	assert.Equal(t, filepath.Join(outputDir, "history"), filepath.Dir(result.Dir))
+	assert.FileExists(t, filepath.Join(result.Dir, "history.json"))
+
+	stdout, err := os.ReadFile(filepath.Join(result.Dir, "stdout.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "PASS\n", string(stdout))
+
+	profile := filepath.Join(result.Dir, "perf.pb.gz")
+	assert.Contains(t, result.Artifacts, profile)
+	assert.FileExists(t, profile)
+	for i, artifact := range h.Artifacts {
+		assert.Equal(t, filepath.Join(result.Dir, artifact.File), result.Artifacts[i])
+	}
+	types := make([]model.ArtifactType, len(h.Artifacts))
+	for i, artifact := range h.Artifacts {
+		types[i] = artifact.Type
+	}
+	assert.Contains(t, types, model.ArtifactTypeTestBinary)
+
+	var record []string
+	for _, cmd := range fake.Commands() {
+		if cmd.Name == "perf" {
+			record = cmd.Args
+		}
+	}
+	require.NotEmpty(t, record, "perf record not run")
+	assert.Equal(t, "cycles", flagValue(record, "-e"))
+	assert.Contains(t, record, "-test.run")
+}
+
+func TestTestOptions(t *testing.T) {
+	opts, err := testOptions(Options{Package: "./pkg", Mode: ModeStat, Events: []string{"cycles", "instructions"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./pkg"}, opts.Args)
+	assert.Equal(t, []string{"cycles", "instructions"}, opts.Events)
+	assert.Equal(t, 1, opts.Repeat)
+
+	opts, err = testOptions(Options{Package: "./pkg", Mode: ModeProfile, Events: []string{"cycles", "instructions"}})
+	require.NoError(t, err)
+	assert.Equal(t, "cycles,instructions", opts.Event)
+
+	_, err = testOptions(Options{Mode: ModeProfile})
+	assert.EqualError(t, err, "no package path specified")
+
+	_, err = testOptions(Options{Package: ".", Events: []string{"cycles"}})
+	assert.EqualError(t, err, "events require a perf mode")
+
+	_, err = testOptions(Options{Package: ".", Mode: "trace"})
+	assert.EqualError(t, err, `unknown perf mode "trace"`)
+}
@@ -0,0 +1,90 @@
+package perfscript
+
+// This file contains parsing of branch stack records (perf record -b), which
+// are turned into two frame samples of the branch source and target.
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// SampleTypeBranches counts the sampled branches between two locations
+	SampleTypeBranches = "branches"
+	// SampleTypeBranchMisses counts the sampled mispredicted branches
+	SampleTypeBranchMisses = "branch-mispredicts"
+)
+
+// findEventField returns the index of the event name in the fields of a sample
+// header line, which is the last field ending in ":" that follows the sample
+// count. It returns -1 if there is no such field.
+func findEventField(parts []string) int {
+	for i := len(parts) - 1; i > 0; i-- {
+		if !strings.HasSuffix(parts[i], ":") {
+			continue
+		}
+		if _, ok := parseCount(parts[i-1]); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBranchEntry parses a branch stack entry as printed by perf script
+// -F +brstack (0x401234/0x401000/P/-/-/0) or -F +brstacksym
+// (main.work+0x1c/main.loop+0x0/M/-/-/0). The flags field is M for
+// mispredicted and P for predicted branches.
+func (p *Parser) parseBranchEntry(entry string) (from, to *profile.Location, mispredicted, ok bool) {
+	fields := strings.Split(entry, "/")
+	if len(fields) < 3 {
+		return nil, nil, false, false
+	}
+
+	from = p.branchLocation(fields[0])
+	to = p.branchLocation(fields[1])
+	if from == nil || to == nil {
+		return nil, nil, false, false
+	}
+
+	return from, to, fields[2] == "M", true
+}
+
+// branchLocation returns the location of one side of a branch stack entry,
+// which is either an address or a symbol with offset, optionally followed by
+// the binary in parentheses.
+func (p *Parser) branchLocation(s string) *profile.Location {
+	var mapping *profile.Mapping
+	if idx := strings.Index(s, "("); idx > 0 && strings.HasSuffix(s, ")") {
+		mapping = p.getOrCreateMapping(s[idx+1 : len(s)-1])
+		s = s[:idx]
+	}
+	if s == "" {
+		return nil
+	}
+
+	if hex, ok := strings.CutPrefix(s, "0x"); ok {
+		addr, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return nil
+		}
+		return p.getOrCreateLocation(s, addr, mapping)
+	}
+
+	funcName := s
+	if idx := strings.LastIndex(funcName, "+"); idx > 0 {
+		funcName = funcName[:idx]
+	}
+	return p.getOrCreateLocation(funcName, 0, mapping)
+}
+
+// addBranch adds a sampled branch as a sample with the target as leaf and
+// the source as its caller.
+func (p *Parser) addBranch(from, to *profile.Location, mispredicted bool) {
+	stack := []*profile.Location{to, from}
+	p.addSample(stack, SampleTypeBranches, 1)
+	if mispredicted {
+		p.addSample(stack, SampleTypeBranchMisses, 1)
+	}
+}
@@ -0,0 +1,46 @@
+package perfscript
+
+// This file contains parsing of perf buildid-list output, which lists the
+// GNU build-ids perf stored in the perf.data header for the binaries with
+// samples.
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// hexRe matches a build-id.
+var hexRe = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// WithBuildIDs sets the GNU build-ids of mapped binaries by path, e.g. as
+// read with ParseBuildIDList. Build-ids of mmap events take precedence.
+func WithBuildIDs(buildIDs map[string]string) Option {
+	return func(p *Parser) {
+		for path, buildID := range buildIDs {
+			p.buildIDs[path] = buildID
+		}
+	}
+}
+
+// ParseBuildIDList parses perf buildid-list output into the build-ids of
+// binaries by path.
+//
+// Format: BUILDID PATH
+func ParseBuildIDList(reader io.Reader) (map[string]string, error) {
+	buildIDs := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		buildID, path, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		path = strings.TrimSpace(path)
+		if !ok || path == "" || !hexRe.MatchString(buildID) {
+			continue
+		}
+		buildIDs[path] = strings.ToLower(buildID)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return buildIDs, nil
+}
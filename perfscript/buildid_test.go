@@ -0,0 +1,53 @@
+package perfscript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuildIDList(t *testing.T) {
+	output := `a1b2c3d4e5f60718293a4b5c6d7e8f9012345678 [kernel.kallsyms]
+0123456789ABCDEF0123456789abcdef01234567 /tmp/go-build123/perfgo.test
+fedcba9876543210fedcba9876543210fedcba98 /opt/my app/lib plugin.so
+no build-id here
+deadbeef
+`
+
+	buildIDs, err := ParseBuildIDList(strings.NewReader(output))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"[kernel.kallsyms]":            "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678",
+		"/tmp/go-build123/perfgo.test": "0123456789abcdef0123456789abcdef01234567",
+		"/opt/my app/lib plugin.so":    "fedcba9876543210fedcba9876543210fedcba98",
+	}, buildIDs)
+}
+
+func TestParser_WithBuildIDs(t *testing.T) {
+	output := `perfgo.test 4711 0.000000: PERF_RECORD_MMAP2 4711/4711: [0x400000(0x2a000) @ 0 <e5e5>]: r-xp /tmp/perfgo.test
+perfgo.test 4711 [000] 123.456789:          1 cycles:u:
+	401000 main.work+0x10 (/tmp/perfgo.test)
+	7f0000001000 memmove+0x20 (/usr/lib/libc.so.6)
+	7f0000002000 compress+0x20 (/usr/lib/libz.so.1)
+`
+
+	parser := New(WithBuildIDs(map[string]string{
+		"/tmp/perfgo.test":   "a1a1",
+		"/usr/lib/libc.so.6": "b2b2",
+	}))
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+
+	buildIDs := make(map[string]string)
+	for _, m := range prof.Mapping {
+		buildIDs[m.File] = m.BuildID
+	}
+	// Build-ids of mmap events take precedence
+	assert.Equal(t, map[string]string{
+		"/tmp/perfgo.test":   "e5e5",
+		"/usr/lib/libc.so.6": "b2b2",
+		"/usr/lib/libz.so.1": "",
+	}, buildIDs)
+}
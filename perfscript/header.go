@@ -0,0 +1,107 @@
+package perfscript
+
+// This file contains parsing of sample header lines, which start each sample
+// in perf script output.
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// headerRe matches a sample header: the command name, which may contain
+// spaces and colons, followed by PID[/TID], an optional [CPU] and the
+// timestamp. The count, event and branch stack entries follow.
+//
+// Format: comm PID[/TID] [CPU] TIMESTAMP: COUNT EVENT: [BRANCHES...]
+var headerRe = regexp.MustCompile(`^\s*(.+?)\s+(\d+)(?:/(\d+))?\s+(?:\[(\d+)\]\s+)?(\d+(?:\.\d+)?):\s*(.*)$`)
+
+// sampleHeader is a parsed sample header line.
+type sampleHeader struct {
+	Comm     string
+	PID      int
+	TID      int
+	Event    string
+	Count    int64
+	Branches []string // Branch stack entries (perf script -F +brstack/+brstacksym)
+
+	// The count couldn't be parsed and defaults to 1
+	InvalidCount bool
+	// perf printed no period, the sample counts once
+	NoPeriod bool
+}
+
+// parseHeader parses a sample header line. Headers not matching headerRe are
+// parsed by field position, with the event being the last field ending in a
+// colon that follows the count. Counts that are no number default to 1 with
+// InvalidCount set, fractional counts are truncated.
+func parseHeader(line string) (sampleHeader, error) {
+	if m := headerRe.FindStringSubmatch(line); m != nil {
+		h := sampleHeader{Comm: m[1]}
+		h.PID, _ = strconv.Atoi(m[2])
+		h.TID = h.PID
+		if m[3] != "" {
+			h.TID, _ = strconv.Atoi(m[3])
+		}
+
+		fields := strings.Fields(m[6])
+		if len(fields) == 0 {
+			return sampleHeader{}, fmt.Errorf("invalid event line: %s", line)
+		}
+
+		// Without -F period perf prints no count, each sample counts once
+		h.Count = 1
+		h.NoPeriod = true
+		if !strings.HasSuffix(fields[0], ":") && len(fields) > 1 {
+			h.NoPeriod = false
+			if v, ok := parseCount(fields[0]); ok {
+				h.Count = v
+			} else {
+				h.InvalidCount = true
+			}
+			fields = fields[1:]
+		}
+		h.Event = strings.TrimSuffix(fields[0], ":")
+		h.Branches = fields[1:]
+		return h, nil
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return sampleHeader{}, fmt.Errorf("invalid event line: %s", line)
+	}
+
+	eventIdx := len(parts) - 1
+	if idx := findEventField(parts); idx > 0 {
+		eventIdx = idx
+	}
+	count, ok := parseCount(parts[eventIdx-1])
+	if !ok {
+		count = 1
+	}
+
+	return sampleHeader{
+		Event:        strings.TrimSuffix(parts[eventIdx], ":"),
+		Count:        count,
+		Branches:     parts[eventIdx+1:],
+		InvalidCount: !ok,
+	}, nil
+}
+
+// parseCount parses the count of a sample. Periods of some events are
+// printed as floating point numbers, which are truncated.
+func parseCount(s string) (int64, bool) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsNaN(v) {
+		return 0, false
+	}
+	if v >= math.MaxInt64 {
+		return math.MaxInt64, true
+	}
+	return int64(v), true
+}
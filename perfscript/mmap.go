@@ -0,0 +1,37 @@
+package perfscript
+
+// This file contains parsing of the mmap events printed by perf script
+// --show-mmap-events, which carry the GNU build-id of the mapped binary if
+// perf recorded it (perf record --buildid-mmap).
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mmapEventMarker identifies mmap event lines, which would otherwise be
+// mistaken for sample headers.
+const mmapEventMarker = "PERF_RECORD_MMAP"
+
+// mmapRe matches the mapping of an mmap event and the mapped path. The
+// mapping ends in the build-id in angle brackets if it was recorded, or in
+// the device and inode otherwise.
+//
+// Format: ... PERF_RECORD_MMAP2 PID/TID: [ADDR(LEN) @ PGOFF <BUILDID>]: PROT PATH
+var mmapRe = regexp.MustCompile(`PERF_RECORD_MMAP2?\s.*\[(.*)\]:\s+\S+\s+(.+)$`)
+
+// buildIDRe matches the build-id of an mmap event's mapping.
+var buildIDRe = regexp.MustCompile(`<([0-9a-fA-F]+)>$`)
+
+// parseMmapEvent returns the path and, if recorded, the build-id of an mmap
+// event line.
+func parseMmapEvent(line string) (path, buildID string, ok bool) {
+	m := mmapRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	if id := buildIDRe.FindStringSubmatch(strings.TrimSpace(m[1])); id != nil {
+		buildID = strings.ToLower(id[1])
+	}
+	return strings.TrimSpace(m[2]), buildID, true
+}
@@ -0,0 +1,76 @@
+package perfscript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMmapEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantPath    string
+		wantBuildID string
+		wantOK      bool
+	}{
+		{
+			name:        "mmap2 with build-id",
+			line:        "perfgo.test 4711 0.000000: PERF_RECORD_MMAP2 4711/4711: [0x400000(0x2a000) @ 0 <A1B2C3D4E5F60718293A4B5C6D7E8F9012345678>]: r-xp /tmp/perfgo.test",
+			wantPath:    "/tmp/perfgo.test",
+			wantBuildID: "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678",
+			wantOK:      true,
+		},
+		{
+			name:     "mmap2 with device and inode",
+			line:     "perfgo.test 4711 0.000000: PERF_RECORD_MMAP2 4711/4711: [0x7f0000000000(0x1c000) @ 0 fd:01 1234 0]: r-xp /usr/lib/libc.so.6",
+			wantPath: "/usr/lib/libc.so.6",
+			wantOK:   true,
+		},
+		{
+			name:     "mmap",
+			line:     "perfgo.test 4711 0.000000: PERF_RECORD_MMAP 4711/4711: [0x400000(0x2a000) @ 0]: x /tmp/perfgo.test",
+			wantPath: "/tmp/perfgo.test",
+			wantOK:   true,
+		},
+		{
+			name: "sample header",
+			line: "perfgo.test 4711 [000] 123.456789:          1 cycles:u:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, buildID, ok := parseMmapEvent(tt.line)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.wantBuildID, buildID)
+		})
+	}
+}
+
+func TestParser_MmapBuildID(t *testing.T) {
+	output := `perfgo.test 4711 0.000000: PERF_RECORD_MMAP2 4711/4711: [0x400000(0x2a000) @ 0 <a1b2c3d4>]: r-xp /tmp/perfgo.test
+perfgo.test 4711 0.000000: PERF_RECORD_MMAP2 4711/4711: [0x7f0000000000(0x1c000) @ 0 fd:01 1234 0]: r-xp /usr/lib/libc.so.6
+perfgo.test 4711 [000] 123.456789:          1 cycles:u:
+	401000 main.work+0x10 (/tmp/perfgo.test)
+	7f0000001000 memmove+0x20 (/usr/lib/libc.so.6)
+`
+
+	prof, err := New().Parse(strings.NewReader(output))
+	require.NoError(t, err)
+
+	// mmap events aren't samples
+	require.Len(t, prof.Sample, 1)
+
+	buildIDs := make(map[string]string)
+	for _, m := range prof.Mapping {
+		buildIDs[m.File] = m.BuildID
+	}
+	assert.Equal(t, map[string]string{
+		"/tmp/perfgo.test":   "a1b2c3d4",
+		"/usr/lib/libc.so.6": "",
+	}, buildIDs)
+}
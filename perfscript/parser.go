@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -11,24 +12,82 @@ import (
 	"github.com/google/pprof/profile"
 )
 
+const (
+	// LabelComm labels samples with the command name of their thread
+	LabelComm = "comm"
+	// LabelTID labels samples with the ID of their thread
+	LabelTID = "tid"
+)
+
+// unknownName is the symbol and binary perf prints for unresolved frames
+const unknownName = "[unknown]"
+
+// isUnknownBinary reports whether a binary path printed by perf script
+// stands for an unresolved binary.
+func isUnknownBinary(path string) bool {
+	return path == unknownName || path == "unknown"
+}
+
 // Parser parses perf script output
 type Parser struct {
 	// Internal state for building the profile
 	profile   *profile.Profile
-	functions map[string]*profile.Function
+	functions map[string]*profile.Function // by binary and name
 	locations map[string]*profile.Location
 	mappings  map[string]*profile.Mapping
 	nextID    uint64
+
+	// GNU build-ids of mapped binaries by path, from mmap events
+	buildIDs map[string]string
+
+	// Diagnostics of the last Parse call and the ParseInto calls following it
+	stats Stats
+
+	// Drop frames without address and symbol
+	dropUnknown bool
+
+	// Label samples with the thread they were taken on
+	threadLabels bool
+	comm         string
+	tid          int
+
+	// The current sample carries no period, only counts once
+	noPeriod bool
+}
+
+// Option configures a Parser
+type Option func(*Parser)
+
+// WithDropUnknown drops frames perf couldn't resolve at all, i.e. frames
+// without address and symbol such as "0 [unknown] ([unknown])".
+func WithDropUnknown(drop bool) Option {
+	return func(p *Parser) {
+		p.dropUnknown = drop
+	}
+}
+
+// WithThreadLabels labels each sample with the command name (comm) and the
+// thread ID (tid) of its sample header. Samples of the same stack are then
+// only merged if they were taken on the same thread.
+func WithThreadLabels(enabled bool) Option {
+	return func(p *Parser) {
+		p.threadLabels = enabled
+	}
 }
 
 // New creates a new parser instance
-func New() *Parser {
-	return &Parser{
+func New(opts ...Option) *Parser {
+	p := &Parser{
 		functions: make(map[string]*profile.Function),
 		locations: make(map[string]*profile.Location),
 		mappings:  make(map[string]*profile.Mapping),
+		buildIDs:  make(map[string]string),
 		nextID:    1,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Parse parses perf script output from an io.Reader and returns a pprof profile
@@ -41,7 +100,31 @@ func (p *Parser) Parse(reader io.Reader) (*profile.Profile, error) {
 		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
 		Period:        1,
 	}
+	p.stats = Stats{EventTotals: make(map[string]int64)}
+
+	// Functions, locations and mappings of previous profiles are not reused,
+	// their IDs restart with the new profile
+	p.functions = make(map[string]*profile.Function)
+	p.locations = make(map[string]*profile.Location)
+	p.mappings = make(map[string]*profile.Mapping)
+
+	return p.parse(reader)
+}
+
+// ParseInto parses perf script output from an io.Reader into the profile of
+// the previous Parse or ParseInto call and returns it, e.g. to merge the perf
+// script outputs of several perf.data files. Functions, locations and
+// mappings are shared by all inputs, samples of the same stack are merged and
+// Stats accumulate. Without a previous call it is the same as Parse.
+func (p *Parser) ParseInto(reader io.Reader) (*profile.Profile, error) {
+	if p.profile == nil {
+		return p.Parse(reader)
+	}
+	return p.parse(reader)
+}
 
+// parse parses perf script output into p.profile.
+func (p *Parser) parse(reader io.Reader) (*profile.Profile, error) {
 	scanner := bufio.NewScanner(reader)
 
 	var currentStack []*profile.Location
@@ -54,8 +137,16 @@ func (p *Parser) Parse(reader io.Reader) (*profile.Profile, error) {
 			continue
 		}
 
+		// mmap event line (perf script --show-mmap-events)
+		if strings.Contains(line, mmapEventMarker) {
+			if path, buildID, ok := parseMmapEvent(line); ok && buildID != "" {
+				p.buildIDs[path] = buildID
+			}
+			continue
+		}
+
 		// Sample header line
-		// Format: program PID.TID 12345.123456: event:value
+		// Format: program PID/TID [CPU] 12345.123456: count event:
 		if strings.Contains(line, ":") && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "    ") {
 			// If we have a previous stack, add it as a sample
 			if len(currentStack) > 0 {
@@ -65,16 +156,36 @@ func (p *Parser) Parse(reader io.Reader) (*profile.Profile, error) {
 			// Start new stack
 			currentStack = nil
 
-			// Extract event type
-			parts := strings.Fields(line)
-			if len(parts) < 2 {
-				return nil, fmt.Errorf("invalid event line: %s", line)
+			header, err := parseHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			currentEventType = header.Event
+			currentCount = header.Count
+			p.comm, p.tid = header.Comm, header.TID
+			p.noPeriod = header.NoPeriod
+			p.stats.Samples++
+			if header.InvalidCount {
+				p.stats.InvalidCounts++
 			}
-			currentEventType = strings.TrimSuffix(strings.TrimSpace(parts[len(parts)-1]), ":")
-			if v, err := strconv.ParseInt(strings.TrimSpace(parts[len(parts)-2]), 10, 64); err == nil {
-				currentCount = v
-			} else {
-				return nil, fmt.Errorf("invalid count: %s", parts[1])
+			p.stats.EventTotals[currentEventType] += currentCount
+			for _, entry := range header.Branches {
+				if from, to, mispredicted, ok := p.parseBranchEntry(entry); ok {
+					p.addBranch(from, to, mispredicted)
+				}
+			}
+			continue
+		}
+
+		// Branch record line
+		// Format: 	401234 main.work+0x1c (/path/to/binary) -> 401000 main.loop+0x0 (/path/to/binary)
+		if fromStr, toStr, ok := strings.Cut(line, " -> "); ok {
+			from, fromDropped := p.parseStackFrame(fromStr)
+			to, toDropped := p.parseStackFrame(toStr)
+			if from != nil && to != nil {
+				p.addBranch(from, to, false)
+			} else if !fromDropped && !toDropped {
+				p.stats.UnparseableFrames++
 			}
 			continue
 		}
@@ -82,11 +193,16 @@ func (p *Parser) Parse(reader io.Reader) (*profile.Profile, error) {
 		// Stack frame line
 		// Format: 	ffffffffa1234567 function_name+0x12 (/path/to/binary)
 		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ") {
-			loc := p.parseStackFrame(line)
+			loc, dropped := p.parseStackFrame(line)
 			if loc != nil {
 				currentStack = append(currentStack, loc)
+			} else if !dropped {
+				p.stats.UnparseableFrames++
 			}
+			continue
 		}
+
+		p.stats.SkippedLines++
 	}
 
 	// Add the last sample
@@ -100,15 +216,29 @@ func (p *Parser) Parse(reader io.Reader) (*profile.Profile, error) {
 
 	// Update mapping ranges based on observed addresses
 	p.finalizeMapping()
+	p.finalizeSampleTypes()
 
 	return p.profile, nil
 }
 
-// parseStackFrame parses a single stack frame line and returns a location
-func (p *Parser) parseStackFrame(line string) *profile.Location {
+// Stats returns diagnostics of the last Parse call and the ParseInto calls
+// following it: the number of samples, skipped lines and unparseable frames,
+// and the total count of each event.
+func (p *Parser) Stats() Stats {
+	return p.stats
+}
+
+// parseStackFrame parses a single stack frame line and returns a location.
+// It returns nil if the line can't be parsed or, with dropped set, if the
+// frame was dropped on purpose (see WithDropUnknown).
+func (p *Parser) parseStackFrame(line string) (loc *profile.Location, dropped bool) {
 	parts := strings.Fields(line)
+	// A bare [unknown] frame comes without an address
+	if len(parts) == 1 && parts[0] == unknownName {
+		parts = []string{"0", unknownName}
+	}
 	if len(parts) < 2 {
-		return nil
+		return nil, false
 	}
 
 	// Parse address
@@ -136,6 +266,16 @@ func (p *Parser) parseStackFrame(line string) *profile.Location {
 		}
 	}
 
+	// Frames perf couldn't resolve at all carry no information
+	if p.dropUnknown && addr == 0 && funcName == unknownName {
+		return nil, true
+	}
+
+	// Unresolved binaries share a single mapping
+	if isUnknownBinary(binaryPath) || (binaryPath == "" && funcName == unknownName) {
+		binaryPath = unknownName
+	}
+
 	// Get or create mapping
 	var mapping *profile.Mapping
 	if binaryPath != "" {
@@ -143,11 +283,17 @@ func (p *Parser) parseStackFrame(line string) *profile.Location {
 		mapping = p.getOrCreateMapping(binaryPath)
 	}
 
+	return p.getOrCreateLocation(funcName, addr, mapping), false
+}
+
+// getOrCreateLocation gets or creates the location of a function at an
+// address in a binary
+func (p *Parser) getOrCreateLocation(funcName string, addr uint64, mapping *profile.Mapping) *profile.Location {
 	// Get or create function
-	fn := p.getOrCreateFunction(funcName)
+	fn := p.getOrCreateFunction(funcName, mapping)
 
-	// Create location key
-	locKey := fmt.Sprintf("%s:%d", funcName, addr)
+	// Create location key, binaries may be mapped at the same addresses
+	locKey := fmt.Sprintf("%s:%s:%d", mappingFile(mapping), funcName, addr)
 
 	// Get or create location
 	loc, exists := p.locations[locKey]
@@ -167,9 +313,11 @@ func (p *Parser) parseStackFrame(line string) *profile.Location {
 	return loc
 }
 
-// getOrCreateFunction gets or creates a function
-func (p *Parser) getOrCreateFunction(name string) *profile.Function {
-	if fn, exists := p.functions[name]; exists {
+// getOrCreateFunction gets or creates a function of a binary. Functions of
+// the same name in different binaries (e.g., main.main) are kept apart.
+func (p *Parser) getOrCreateFunction(name string, mapping *profile.Mapping) *profile.Function {
+	key := mappingFile(mapping) + ":" + name
+	if fn, exists := p.functions[key]; exists {
 		return fn
 	}
 
@@ -177,11 +325,19 @@ func (p *Parser) getOrCreateFunction(name string) *profile.Function {
 		ID:   uint64(len(p.profile.Function) + 1),
 		Name: name,
 	}
-	p.functions[name] = fn
+	p.functions[key] = fn
 	p.profile.Function = append(p.profile.Function, fn)
 	return fn
 }
 
+// mappingFile returns the binary of mapping, or "" for frames without one
+func mappingFile(mapping *profile.Mapping) string {
+	if mapping == nil {
+		return ""
+	}
+	return mapping.File
+}
+
 // getOrCreateMapping gets or creates a mapping
 func (p *Parser) getOrCreateMapping(filename string) *profile.Mapping {
 	if m, exists := p.mappings[filename]; exists {
@@ -198,7 +354,8 @@ func (p *Parser) getOrCreateMapping(filename string) *profile.Mapping {
 	return m
 }
 
-// finalizeMapping sets mapping Start and Limit to allow all addresses.
+// finalizeMapping sets mapping Start and Limit to allow all addresses and
+// the build-ids seen in mmap events.
 // We use Start=0 and Limit=max_uint64 to pass pprof validation without
 // interfering with address-to-symbol resolution. Setting Start to the
 // observed minimum address would break pprof's offset calculations and
@@ -207,9 +364,48 @@ func (p *Parser) finalizeMapping() {
 	for _, m := range p.mappings {
 		m.Start = 0
 		m.Limit = ^uint64(0) // max uint64
+		if buildID, ok := p.buildIDs[m.File]; ok {
+			m.BuildID = buildID
+		}
 	}
 }
 
+// sampleUnit returns the unit of the values of eventType. perf prints the
+// period of each sample, the number of events it stands for, which is in
+// nanoseconds for the clock events. Without periods the values count samples.
+func (p *Parser) sampleUnit(eventType string) string {
+	if eventType == SampleTypeBranches || eventType == SampleTypeBranchMisses {
+		return "count"
+	}
+	if p.noPeriod {
+		return "samples"
+	}
+	switch name, _, _ := strings.Cut(eventType, ":"); name {
+	case "cpu-clock", "task-clock":
+		return "nanoseconds"
+	default:
+		return "count"
+	}
+}
+
+// finalizeSampleTypes makes the first event recorded the default sample type
+// of the profile, and its type the period type. Branch sample types are only
+// the default if no event was recorded.
+func (p *Parser) finalizeSampleTypes() {
+	if len(p.profile.SampleType) == 0 {
+		return
+	}
+	st := p.profile.SampleType[0]
+	for _, t := range p.profile.SampleType {
+		if t.Type != SampleTypeBranches && t.Type != SampleTypeBranchMisses {
+			st = t
+			break
+		}
+	}
+	p.profile.DefaultSampleType = st.Type
+	p.profile.PeriodType = &profile.ValueType{Type: st.Type, Unit: st.Unit}
+}
+
 // addSample adds a sample with the given stack to the profile
 func (p *Parser) addSample(stack []*profile.Location, eventType string, count int64) {
 	if len(stack) == 0 || count == 0 {
@@ -226,7 +422,7 @@ func (p *Parser) addSample(stack []*profile.Location, eventType string, count in
 		}
 	}
 	if sampleIdx == -1 {
-		p.profile.SampleType = append(p.profile.SampleType, &profile.ValueType{Type: eventType, Unit: "count"})
+		p.profile.SampleType = append(p.profile.SampleType, &profile.ValueType{Type: eventType, Unit: p.sampleUnit(eventType)})
 		sampleIdx = len(p.profile.SampleType) - 1
 		// add a sample to each existing sample
 		for _, sample := range p.profile.Sample {
@@ -234,9 +430,11 @@ func (p *Parser) addSample(stack []*profile.Location, eventType string, count in
 		}
 	}
 
+	label, numLabel := p.sampleLabels()
+
 	// Check if a sample with this exact stack already exists
 	for _, existingSample := range p.profile.Sample {
-		if stacksEqual(existingSample.Location, stack) {
+		if stacksEqual(existingSample.Location, stack) && labelsEqual(existingSample, label, numLabel) {
 			// Merge with existing sample
 			existingSample.Value[sampleIdx] += count
 			return
@@ -247,12 +445,41 @@ func (p *Parser) addSample(stack []*profile.Location, eventType string, count in
 	sample := &profile.Sample{
 		Location: stack,
 		Value:    make([]int64, len(p.profile.SampleType)),
+		Label:    label,
+		NumLabel: numLabel,
 	}
 	sample.Value[sampleIdx] = count
 
 	p.profile.Sample = append(p.profile.Sample, sample)
 }
 
+// sampleLabels returns the labels of the current sample, which are only set
+// with WithThreadLabels and if the header named the command.
+func (p *Parser) sampleLabels() (map[string][]string, map[string][]int64) {
+	if !p.threadLabels || p.comm == "" {
+		return nil, nil
+	}
+	return map[string][]string{LabelComm: {p.comm}}, map[string][]int64{LabelTID: {int64(p.tid)}}
+}
+
+// labelsEqual returns true if sample has the given labels
+func labelsEqual(sample *profile.Sample, label map[string][]string, numLabel map[string][]int64) bool {
+	if len(sample.Label) != len(label) || len(sample.NumLabel) != len(numLabel) {
+		return false
+	}
+	for k, v := range label {
+		if !slices.Equal(sample.Label[k], v) {
+			return false
+		}
+	}
+	for k, v := range numLabel {
+		if !slices.Equal(sample.NumLabel[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
 // stacksEqual returns true if two stacks have the same location IDs
 func stacksEqual(a, b []*profile.Location) bool {
 	if len(a) != len(b) {
@@ -1,6 +1,7 @@
 package perfscript
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -265,3 +266,504 @@ func TestParser_MappingRanges(t *testing.T) {
 	// Profile should pass validation
 	require.NoError(t, prof.CheckValid())
 }
+
+func TestParser_MappingRangesBoundaryAddresses(t *testing.T) {
+	// Both binaries are mapped at the same addresses, and the kernel frames
+	// sit at the top of the address space. Every location must keep its own
+	// binary's mapping and fall within [Start, Limit) of it.
+	output := `program 12345 [000] 123.456789:          1 cycles:
+	ffffffffffff0fff kernel_entry+0x0 ([kernel.kallsyms])
+	               400000 main.run+0x0 (/path/to/app)
+	               400fff main.main+0xfff (/path/to/app)
+
+sidecar 12346 [001] 123.456799:          1 cycles:
+	               400000 main.run+0x0 (/path/to/sidecar)
+	               401000 main.main+0x0 (/path/to/sidecar)
+`
+
+	prof, err := New().Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Len(t, prof.Mapping, 3)
+	require.Len(t, prof.Location, 5)
+
+	files := map[uint64][]string{}
+	for _, loc := range prof.Location {
+		require.NotNil(t, loc.Mapping)
+		require.GreaterOrEqual(t, loc.Address, loc.Mapping.Start, "0x%x in %s", loc.Address, loc.Mapping.File)
+		require.Less(t, loc.Address, loc.Mapping.Limit, "0x%x in %s", loc.Address, loc.Mapping.File)
+		files[loc.Address] = append(files[loc.Address], loc.Mapping.File)
+	}
+	require.ElementsMatch(t, []string{"/path/to/app", "/path/to/sidecar"}, files[0x400000])
+	require.Equal(t, []string{"[kernel.kallsyms]"}, files[0xffffffffffff0fff])
+}
+
+func sampleTypeIndex(t *testing.T, prof *profile.Profile, typ string) int {
+	t.Helper()
+	for i, st := range prof.SampleType {
+		if st.Type == typ {
+			return i
+		}
+	}
+	t.Fatalf("sample type %q not found", typ)
+	return -1
+}
+
+func TestParser_BranchStack(t *testing.T) {
+	output := `program 12345 [000] 123.456789:          1 cycles:u:  main.loop+0x1c/main.work+0x0/M/-/-/0  main.work+0x30/main.loop+0x10/P/-/-/0
+	401234 main.work+0x10 (/path/to/binary)
+	401000 main.main+0x20 (/path/to/binary)
+`
+
+	parser := New()
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+
+	cycles := sampleTypeIndex(t, prof, "cycles:u")
+	branches := sampleTypeIndex(t, prof, SampleTypeBranches)
+	misses := sampleTypeIndex(t, prof, SampleTypeBranchMisses)
+
+	var total, branchTotal, missTotal int64
+	for _, s := range prof.Sample {
+		total += s.Value[cycles]
+		branchTotal += s.Value[branches]
+		missTotal += s.Value[misses]
+		if s.Value[cycles] > 0 {
+			// The call stack must not be affected by the branch entries
+			require.Len(t, s.Location, 2)
+			require.Equal(t, "main.work", s.Location[0].Line[0].Function.Name)
+		}
+		if s.Value[misses] > 0 {
+			require.Len(t, s.Location, 2)
+			require.Equal(t, "main.work", s.Location[0].Line[0].Function.Name)
+			require.Equal(t, "main.loop", s.Location[1].Line[0].Function.Name)
+		}
+	}
+	require.Equal(t, int64(1), total)
+	require.Equal(t, int64(2), branchTotal)
+	require.Equal(t, int64(1), missTotal)
+}
+
+func TestParser_BranchStackAddresses(t *testing.T) {
+	output := `program 12345 [000] 123.456789:          1 cycles:u:  0x401234/0x401000/P/-/-/0
+	401234 main.work+0x10 (/path/to/binary)
+	401234 main.work+0x1c (/path/to/binary) -> 401000 main.loop+0x0 (/path/to/binary)
+`
+
+	parser := New()
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+
+	branches := sampleTypeIndex(t, prof, SampleTypeBranches)
+	var branchTotal int64
+	for _, s := range prof.Sample {
+		branchTotal += s.Value[branches]
+	}
+	// One branch from the header and one from the branch record line
+	require.Equal(t, int64(2), branchTotal)
+}
+
+func TestParser_Stats(t *testing.T) {
+	output := `program 12345 [000] 123.456789:        100 cycles:u:
+	401234 main.work+0x10 (/path/to/binary)
+	garbage
+	401000 main.main+0x20 (/path/to/binary)
+
+this line is not part of any sample
+program 12345 [000] 123.456790:         50 cycles:u:
+	401234 main.work+0x10 (/path/to/binary)
+
+program 12345 [000] 123.456791:          7 instructions:u:
+	bad
+`
+
+	parser := New()
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+
+	stats := parser.Stats()
+	require.Equal(t, 3, stats.Samples)
+	require.Equal(t, 1, stats.SkippedLines)
+	require.Equal(t, 2, stats.UnparseableFrames)
+	require.Equal(t, map[string]int64{"cycles:u": 150, "instructions:u": 7}, stats.EventTotals)
+
+	// The profile itself is unchanged, the sample without frames is dropped
+	require.Len(t, prof.Sample, 2)
+
+	// Stats are reset for each parse
+	_, err = parser.Parse(strings.NewReader(""))
+	require.NoError(t, err)
+	require.Equal(t, Stats{EventTotals: map[string]int64{}}, parser.Stats())
+}
+
+func TestParser_UnknownFrames(t *testing.T) {
+	output := `program 12345 [000] 123.456789:          1 cycles:u:
+	401234 main.work+0x10 (/path/to/binary)
+	7f0012 [unknown] ([unknown])
+	0 [unknown] ([unknown])
+	[unknown]
+	401000 main.main+0x20 (/path/to/binary)
+`
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantStack []string
+	}{
+		{
+			name:      "keep unknown frames",
+			wantStack: []string{"main.work", "[unknown]", "[unknown]", "[unknown]", "main.main"},
+		},
+		{
+			name:      "drop unknown frames",
+			opts:      []Option{WithDropUnknown(true)},
+			wantStack: []string{"main.work", "[unknown]", "main.main"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := New(tt.opts...)
+			prof, err := parser.Parse(strings.NewReader(output))
+			require.NoError(t, err)
+			require.NoError(t, prof.CheckValid())
+			require.Equal(t, 0, parser.Stats().UnparseableFrames)
+
+			require.Len(t, prof.Sample, 1)
+			var stack []string
+			for _, loc := range prof.Sample[0].Location {
+				stack = append(stack, loc.Line[0].Function.Name)
+				if loc.Line[0].Function.Name == "[unknown]" {
+					require.NotNil(t, loc.Mapping)
+					require.Equal(t, "[unknown]", loc.Mapping.File)
+				}
+			}
+			require.Equal(t, tt.wantStack, stack)
+
+			// All unresolved frames share one mapping
+			var files []string
+			for _, m := range prof.Mapping {
+				files = append(files, m.File)
+			}
+			require.ElementsMatch(t, []string{"/path/to/binary", "[unknown]"}, files)
+		})
+	}
+}
+
+func TestParser_UnknownSymbolInKnownBinary(t *testing.T) {
+	output := `program 12345 [000] 123.456789:          1 cycles:u:
+	7f00a1b2 [unknown] (/usr/lib/libc.so.6)
+	401000 main.main+0x20 (/path/to/binary)
+`
+
+	parser := New(WithDropUnknown(true))
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+
+	// The address still allows symbolization, so the frame is kept in its binary
+	require.Len(t, prof.Sample, 1)
+	loc := prof.Sample[0].Location[0]
+	require.Equal(t, "[unknown]", loc.Line[0].Function.Name)
+	require.Equal(t, "/usr/lib/libc.so.6", loc.Mapping.File)
+	require.Equal(t, uint64(0x7f00a1b2), loc.Address)
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    sampleHeader
+		wantErr bool
+	}{
+		{
+			name: "simple comm",
+			line: "perfgo.test.lin  223225 7187035.622637:         14       L1-dcache-loads:",
+			want: sampleHeader{Comm: "perfgo.test.lin", PID: 223225, TID: 223225, Event: "L1-dcache-loads", Count: 14, Branches: []string{}},
+		},
+		{
+			name: "multi-word comm",
+			line: "Web Content 4711 12.5: 100 cycles:",
+			want: sampleHeader{Comm: "Web Content", PID: 4711, TID: 4711, Event: "cycles", Count: 100, Branches: []string{}},
+		},
+		{
+			name: "comm with colon",
+			line: "kworker/3:1 99 5.000001: 7 cycles:u:",
+			want: sampleHeader{Comm: "kworker/3:1", PID: 99, TID: 99, Event: "cycles:u", Count: 7, Branches: []string{}},
+		},
+		{
+			name: "pid and tid with cpu",
+			line: "my prog 100/101 [003] 123456.789012345: 250000 cpu-clock:",
+			want: sampleHeader{Comm: "my prog", PID: 100, TID: 101, Event: "cpu-clock", Count: 250000, Branches: []string{}},
+		},
+		{
+			name: "timestamp without fraction",
+			line: "app 42 17: 3 instructions:",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "instructions", Count: 3, Branches: []string{}},
+		},
+		{
+			name: "no count",
+			line: "app 42 [000] 1.5: cycles:",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "cycles", Count: 1, Branches: []string{}, NoPeriod: true},
+		},
+		{
+			name: "branch stack",
+			line: "app 42 1.5: 10 cycles: 0x401234/0x401000/P/-/-/0",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "cycles", Count: 10, Branches: []string{"0x401234/0x401000/P/-/-/0"}},
+		},
+		{
+			name: "invalid count",
+			line: "app 42 1.5: many cycles:",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "cycles", Count: 1, Branches: []string{}, InvalidCount: true},
+		},
+		{
+			name: "float count",
+			line: "app 42 1.5: 250000.75 cpu-clock:",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "cpu-clock", Count: 250000, Branches: []string{}},
+		},
+		{
+			name: "count beyond int64",
+			line: "app 42 1.5: 1e20 cycles:",
+			want: sampleHeader{Comm: "app", PID: 42, TID: 42, Event: "cycles", Count: math.MaxInt64, Branches: []string{}},
+		},
+		{
+			name: "positional float count",
+			line: "1.5: 12.9 cycles:",
+			want: sampleHeader{Event: "cycles", Count: 12, Branches: []string{}},
+		},
+		{
+			name: "positional missing count",
+			line: "1.5: cycles:",
+			want: sampleHeader{Event: "cycles", Count: 1, Branches: []string{}, InvalidCount: true},
+		},
+		{
+			name:    "too few fields",
+			line:    "cycles:",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHeader(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParser_MultiWordComm(t *testing.T) {
+	output := `Web Content 4711/4712 [002] 12.000000001: 5 cycles:
+	          401000 main.work+0x10 (/tmp/app)
+
+Web Content 4711/4713 [001] 13: 7 cycles:
+	          401000 main.work+0x10 (/tmp/app)
+`
+
+	parser := New()
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, prof.Sample, 1)
+	require.Equal(t, int64(12), prof.Sample[0].Value[0])
+	require.Equal(t, 2, parser.Stats().Samples)
+}
+
+func TestParser_ThreadLabels(t *testing.T) {
+	output := `worker 100/101 [000] 123.456789:          5 cycles:
+	401000 main.work+0x20 (/path/to/binary)
+	401100 main.main+0x10 (/path/to/binary)
+
+worker 100/101 [001] 123.456799:          7 cycles:
+	401000 main.work+0x20 (/path/to/binary)
+	401100 main.main+0x10 (/path/to/binary)
+
+my prog 100/102 [002] 123.456809:          3 cycles:
+	401000 main.work+0x20 (/path/to/binary)
+	401100 main.main+0x10 (/path/to/binary)
+`
+
+	// Without labels samples of all threads are merged by stack
+	prof, err := New().Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, prof.Sample, 1)
+	require.Nil(t, prof.Sample[0].Label)
+
+	prof, err = New(WithThreadLabels(true)).Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Len(t, prof.Sample, 2)
+	require.Equal(t, []int64{12}, prof.Sample[0].Value)
+	require.Equal(t, map[string][]string{LabelComm: {"worker"}}, prof.Sample[0].Label)
+	require.Equal(t, map[string][]int64{LabelTID: {101}}, prof.Sample[0].NumLabel)
+	require.Equal(t, []int64{3}, prof.Sample[1].Value)
+	require.Equal(t, map[string][]string{LabelComm: {"my prog"}}, prof.Sample[1].Label)
+	require.Equal(t, map[string][]int64{LabelTID: {102}}, prof.Sample[1].NumLabel)
+}
+
+func TestParser_ParseInto(t *testing.T) {
+	first := `app 100 [000] 123.456789:          5 cycles:
+	401000 main.work+0x20 (/path/to/app)
+	401100 main.main+0x10 (/path/to/app)
+
+app 100 [000] 123.456799:          2 cycles:
+	7f0000 memmove+0x8 (/usr/lib/libc.so.6)
+	401000 main.work+0x20 (/path/to/app)
+	401100 main.main+0x10 (/path/to/app)
+`
+	second := `sidecar 200 [001] 123.456809:          3 cycles:
+	501000 main.serve+0x20 (/path/to/sidecar)
+
+sidecar 200 [001] 123.456819:          4 instructions:
+	7f0000 memmove+0x8 (/usr/lib/libc.so.6)
+	501000 main.serve+0x20 (/path/to/sidecar)
+
+app 100 [000] 123.456829:          7 cycles:
+	401000 main.work+0x20 (/path/to/app)
+	401100 main.main+0x10 (/path/to/app)
+`
+
+	parser := New()
+	_, err := parser.ParseInto(strings.NewReader(first))
+	require.NoError(t, err)
+	prof, err := parser.ParseInto(strings.NewReader(second))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+
+	// Same stacks of both inputs are merged
+	require.Len(t, prof.Sample, 4)
+	require.Equal(t, []int64{12, 0}, prof.Sample[0].Value)
+	require.Len(t, prof.SampleType, 2)
+
+	// Functions, locations and mappings are shared by both inputs
+	require.Len(t, prof.Function, 4)
+	require.Len(t, prof.Location, 4)
+	require.Len(t, prof.Mapping, 3)
+	for i, loc := range prof.Location {
+		require.Equal(t, uint64(i+1), loc.ID)
+	}
+
+	stats := parser.Stats()
+	require.Equal(t, 5, stats.Samples)
+	require.Equal(t, map[string]int64{"cycles": 17, "instructions": 4}, stats.EventTotals)
+
+	// Parse starts over with a new profile
+	prof, err = parser.Parse(strings.NewReader(second))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Len(t, prof.Sample, 3)
+	require.Len(t, prof.Function, 4)
+	require.Equal(t, 3, parser.Stats().Samples)
+}
+
+func TestParser_SameFunctionInDifferentBinaries(t *testing.T) {
+	output := `app 100 [000] 123.456789:          5 cycles:
+	401000 main.run+0x20 (/path/to/app)
+	401100 main.main+0x10 (/path/to/app)
+
+sidecar 200 [001] 123.456799:          3 cycles:
+	401000 main.run+0x20 (/path/to/sidecar)
+	401100 main.main+0x10 (/path/to/sidecar)
+
+app 100 [000] 123.456809:          2 cycles:
+	401000 main.run+0x20 (/path/to/app)
+	401100 main.main+0x10 (/path/to/app)
+`
+
+	prof, err := New().Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+
+	// Each binary has its own main.run and main.main, even at the same addresses
+	var runs []*profile.Function
+	for _, fn := range prof.Function {
+		if fn.Name == "main.run" {
+			runs = append(runs, fn)
+		}
+	}
+	require.Len(t, runs, 2)
+	require.NotEqual(t, runs[0].ID, runs[1].ID)
+	require.Len(t, prof.Function, 4)
+	require.Len(t, prof.Location, 4)
+
+	require.Len(t, prof.Sample, 2)
+	require.Equal(t, []int64{7}, prof.Sample[0].Value)
+	require.Equal(t, "/path/to/app", prof.Sample[0].Location[0].Mapping.File)
+	require.Equal(t, []int64{3}, prof.Sample[1].Value)
+	require.Equal(t, "/path/to/sidecar", prof.Sample[1].Location[0].Mapping.File)
+	require.NotSame(t, prof.Sample[0].Location[0].Line[0].Function, prof.Sample[1].Location[0].Line[0].Function)
+}
+
+func TestParser_TolerateCounts(t *testing.T) {
+	output := `app 42 [000] 1.5: 250000.75 cpu-clock:
+	401000 main.work+0x20 (/path/to/binary)
+
+app 42 [000] 1.6: many cpu-clock:
+	401000 main.work+0x20 (/path/to/binary)
+
+app 42 [000] 1.7: cpu-clock:
+	401000 main.work+0x20 (/path/to/binary)
+`
+
+	// Neither header aborts parsing
+	parser := New()
+	prof, err := parser.Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, prof.Sample, 1)
+	require.Equal(t, []int64{250002}, prof.Sample[0].Value)
+
+	stats := parser.Stats()
+	require.Equal(t, 3, stats.Samples)
+	require.Equal(t, 1, stats.InvalidCounts)
+}
+
+func TestParser_SampleTypes(t *testing.T) {
+	output := `app 42 [000] 1.5: 10 cycles:u: 0x401234/0x401000/P/-/-/0
+	401000 main.work+0x20 (/path/to/binary)
+
+app 42 [000] 1.6: 250000 cpu-clock:
+	401000 main.work+0x20 (/path/to/binary)
+
+app 42 [000] 1.7: 4 instructions:u:
+	401100 main.main+0x10 (/path/to/binary)
+`
+
+	prof, err := New().Parse(strings.NewReader(output))
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+
+	// Each event keeps its own raw values, in the unit of its period
+	units := map[string]string{}
+	for _, st := range prof.SampleType {
+		units[st.Type] = st.Unit
+	}
+	require.Equal(t, map[string]string{
+		SampleTypeBranches: "count",
+		"cycles:u":         "count",
+		"cpu-clock":        "nanoseconds",
+		"instructions:u":   "count",
+	}, units)
+
+	// The first event is the default, not the branches sampled along with it
+	require.Equal(t, "cycles:u", prof.DefaultSampleType)
+	require.Equal(t, &profile.ValueType{Type: "cycles:u", Unit: "count"}, prof.PeriodType)
+
+	// -sample_index selects the values of one event
+	totals := map[string]int64{}
+	for i, st := range prof.SampleType {
+		for _, s := range prof.Sample {
+			totals[st.Type] += s.Value[i]
+		}
+	}
+	require.Equal(t, map[string]int64{SampleTypeBranches: 1, "cycles:u": 10, "cpu-clock": 250000, "instructions:u": 4}, totals)
+
+	// Without periods each sample counts once
+	prof, err = New().Parse(strings.NewReader("app 42 [000] 1.5: cycles:\n\t401000 main.work+0x20 (/path/to/binary)\n"))
+	require.NoError(t, err)
+	require.Equal(t, []*profile.ValueType{{Type: "cycles", Unit: "samples"}}, prof.SampleType)
+	require.Equal(t, "cycles", prof.DefaultSampleType)
+}
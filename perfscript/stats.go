@@ -0,0 +1,21 @@
+package perfscript
+
+// This file contains the diagnostics collected while parsing, which let
+// callers detect input the parser only partially understood.
+
+// Stats contains diagnostics of the last Parse call.
+type Stats struct {
+	// Samples is the number of sample header lines parsed
+	Samples int
+	// SkippedLines is the number of non-empty lines that were neither a
+	// sample header, a stack frame nor a branch record
+	SkippedLines int
+	// UnparseableFrames is the number of stack frame and branch record lines
+	// that were dropped because they couldn't be parsed
+	UnparseableFrames int
+	// InvalidCounts is the number of samples whose count couldn't be parsed
+	// and was counted as 1
+	InvalidCounts int
+	// EventTotals maps each event to the sum of its sample counts
+	EventTotals map[string]int64
+}
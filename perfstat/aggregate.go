@@ -0,0 +1,110 @@
+package perfstat
+
+// This file contains the aggregation of the counters of repeated perf stat
+// runs into their mean and standard deviation.
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+)
+
+// Summary is the aggregate of an event over repeated runs.
+type Summary struct {
+	Event string // Event name
+	// Core, socket or thread the event was counted for, empty for the whole run
+	Aggregation string
+	Unit        string  // Unit of the values, empty for counts
+	Runs        int     // Number of runs the event was counted in
+	Mean        float64 // Mean of the counted values
+	StdDev      float64 // Sample standard deviation, 0 for a single run
+}
+
+// key identifies the summarized event like Counter.key.
+func (s Summary) key() string {
+	return qualifiedEvent(s.Aggregation, s.Event)
+}
+
+// RelStdDev returns the standard deviation relative to the mean in percent.
+func (s Summary) RelStdDev() float64 {
+	if s.Mean == 0 {
+		return 0
+	}
+	return math.Abs(s.StdDev / s.Mean * 100)
+}
+
+// Aggregate returns the summary of each event over the counters of the runs,
+// in the order the events first appear. Runs in which an event was not
+// counted don't contribute to its summary. In the aggregation modes each
+// core, socket or thread of an event is summarized separately.
+func Aggregate(runs [][]Counter) []Summary {
+	var order []Counter
+	seen := make(map[string]bool)
+	values := make(map[string][]float64)
+	for _, run := range runs {
+		for _, counter := range run {
+			key := counter.key()
+			if !seen[key] {
+				seen[key] = true
+				order = append(order, counter)
+			}
+			if counter.Counted {
+				values[key] = append(values[key], counter.Value)
+			}
+		}
+	}
+
+	summaries := make([]Summary, 0, len(order))
+	for _, counter := range order {
+		mean, stddev := MeanStdDev(values[counter.key()])
+		summaries = append(summaries, Summary{
+			Event:       counter.Event,
+			Aggregation: counter.Aggregation,
+			Unit:        counter.Unit,
+			Runs:        len(values[counter.key()]),
+			Mean:        mean,
+			StdDev:      stddev,
+		})
+	}
+	return summaries
+}
+
+// MeanStdDev returns the mean and the sample standard deviation of values.
+// The standard deviation of fewer than two values is 0.
+func MeanStdDev(values []float64) (mean, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sum / float64(len(values)-1))
+}
+
+// WriteSummaries writes the summaries as a table like perf stat -r does.
+func WriteSummaries(w io.Writer, summaries []Summary, runs int) error {
+	if _, err := fmt.Fprintf(w, "Performance counter stats (%d runs):\n\n", runs); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, s := range summaries {
+		event := qualifiedEvent(s.Aggregation, s.Event)
+		if s.Runs == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t\n", notCounted, s.Unit, event)
+			continue
+		}
+		fmt.Fprintf(tw, "%.2f\t%s\t%s\t+- %.2f%%\t(%d/%d runs)\t\n", s.Mean, s.Unit, event, s.RelStdDev(), s.Runs, runs)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,107 @@
+package perfstat
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeanStdDev(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []float64
+		wantMean   float64
+		wantStdDev float64
+	}{
+		{name: "empty"},
+		{name: "single", values: []float64{5}, wantMean: 5},
+		{name: "constant", values: []float64{3, 3, 3}, wantMean: 3},
+		{name: "sample stddev", values: []float64{2, 4, 4, 4, 5, 5, 7, 9}, wantMean: 5, wantStdDev: math.Sqrt(32.0 / 7)},
+		{name: "two values", values: []float64{10, 20}, wantMean: 15, wantStdDev: math.Sqrt(50)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, stddev := MeanStdDev(tt.values)
+			assert.InDelta(t, tt.wantMean, mean, 1e-9)
+			assert.InDelta(t, tt.wantStdDev, stddev, 1e-9)
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	runs := [][]Counter{
+		{
+			{Event: "task-clock", Unit: "msec", Value: 10, Counted: true},
+			{Event: "cycles", Value: 100, Counted: true},
+			{Event: "instructions"},
+		},
+		{
+			{Event: "task-clock", Unit: "msec", Value: 14, Counted: true},
+			{Event: "cycles", Value: 300, Counted: true},
+			{Event: "instructions"},
+		},
+		{
+			{Event: "cycles", Value: 200, Counted: true},
+			{Event: "instructions", Value: 50, Counted: true},
+		},
+	}
+
+	summaries := Aggregate(runs)
+	require.Len(t, summaries, 3)
+
+	assert.Equal(t, "task-clock", summaries[0].Event)
+	assert.Equal(t, "msec", summaries[0].Unit)
+	assert.Equal(t, 2, summaries[0].Runs)
+	assert.InDelta(t, 12, summaries[0].Mean, 1e-9)
+	assert.InDelta(t, math.Sqrt(8), summaries[0].StdDev, 1e-9)
+
+	assert.Equal(t, "cycles", summaries[1].Event)
+	assert.Equal(t, 3, summaries[1].Runs)
+	assert.InDelta(t, 200, summaries[1].Mean, 1e-9)
+	assert.InDelta(t, 100, summaries[1].StdDev, 1e-9)
+	assert.InDelta(t, 50, summaries[1].RelStdDev(), 1e-9)
+
+	// Only counted runs contribute
+	assert.Equal(t, Summary{Event: "instructions", Runs: 1, Mean: 50}, summaries[2])
+}
+
+func TestAggregate_PerCore(t *testing.T) {
+	runs := [][]Counter{
+		{
+			{Event: "cycles", Value: 100, Counted: true, Aggregation: "S0-C0", CPUs: 2},
+			{Event: "cycles", Value: 10, Counted: true, Aggregation: "S0-C1", CPUs: 2},
+		},
+		{
+			{Event: "cycles", Value: 300, Counted: true, Aggregation: "S0-C0", CPUs: 2},
+			{Event: "cycles", Value: 30, Counted: true, Aggregation: "S0-C1", CPUs: 2},
+		},
+	}
+
+	// Each core is summarized separately
+	summaries := Aggregate(runs)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, Summary{Event: "cycles", Aggregation: "S0-C0", Runs: 2, Mean: 200, StdDev: math.Sqrt(20000)}, summaries[0])
+	assert.Equal(t, "S0-C1", summaries[1].Aggregation)
+	assert.InDelta(t, 20, summaries[1].Mean, 1e-9)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSummaries(&buf, summaries, 2))
+	assert.Regexp(t, `200\.00\s+S0-C0 cycles`, buf.String())
+}
+
+func TestWriteSummaries(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSummaries(&buf, []Summary{
+		{Event: "task-clock", Unit: "msec", Runs: 2, Mean: 12, StdDev: 1.2},
+		{Event: "instructions"},
+	}, 2))
+
+	out := buf.String()
+	assert.Contains(t, out, "Performance counter stats (2 runs):")
+	assert.Regexp(t, `12\.00\s+msec\s+task-clock\s+\+- 10\.00%\s+\(2/2 runs\)`, out)
+	assert.Regexp(t, `<not counted>\s+instructions`, out)
+}
@@ -0,0 +1,213 @@
+package perfstat
+
+// This file contains the comparison of two groups of repeated perf stat runs,
+// which uses Welch's t-test to tell whether a counter changed significantly.
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+)
+
+// DefaultAlpha is the significance level below which the p-value of a delta
+// is considered significant.
+const DefaultAlpha = 0.05
+
+// Comparison is the change of an event between two groups of runs.
+type Comparison struct {
+	Event string // Event name
+	// Core, socket or thread the event was counted for, empty for the whole run
+	Aggregation string
+	Unit        string  // Unit of the values, empty for counts
+	Old         Summary // Aggregate of the old runs
+	New         Summary // Aggregate of the new runs
+	// P-value of Welch's t-test, 1 if there are too few runs to test
+	P float64
+	// Whether P is below the significance level
+	Significant bool
+}
+
+// Delta returns the change of the mean from the old to the new runs in
+// percent, 0 if the old mean is 0.
+func (c Comparison) Delta() float64 {
+	if c.Old.Mean == 0 {
+		return 0
+	}
+	return (c.New.Mean - c.Old.Mean) / c.Old.Mean * 100
+}
+
+// Compare returns the comparison of each event counted in the old and the
+// new runs, in the order the events appear in the old runs. A delta is
+// significant if the p-value of Welch's t-test is below alpha.
+func Compare(oldRuns, newRuns [][]Counter, alpha float64) []Comparison {
+	oldValues, oldSummaries := eventValues(oldRuns)
+	newValues, newSummaries := eventValues(newRuns)
+
+	newByEvent := make(map[string]Summary, len(newSummaries))
+	for _, s := range newSummaries {
+		newByEvent[s.key()] = s
+	}
+
+	var comparisons []Comparison
+	for _, oldSummary := range oldSummaries {
+		key := oldSummary.key()
+		newSummary, ok := newByEvent[key]
+		if !ok {
+			continue
+		}
+		p := WelchTTest(oldValues[key], newValues[key])
+		comparisons = append(comparisons, Comparison{
+			Event:       oldSummary.Event,
+			Aggregation: oldSummary.Aggregation,
+			Unit:        oldSummary.Unit,
+			Old:         oldSummary,
+			New:         newSummary,
+			P:           p,
+			Significant: p < alpha,
+		})
+	}
+	return comparisons
+}
+
+// eventValues returns the counted values of each event of the runs and
+// their summaries.
+func eventValues(runs [][]Counter) (map[string][]float64, []Summary) {
+	values := make(map[string][]float64)
+	for _, run := range runs {
+		for _, counter := range run {
+			if counter.Counted {
+				values[counter.key()] = append(values[counter.key()], counter.Value)
+			}
+		}
+	}
+	return values, Aggregate(runs)
+}
+
+// WelchTTest returns the two-tailed p-value of Welch's t-test for the means
+// of a and b, which doesn't assume equal variances. The p-value is 1 if
+// either sample has fewer than two values. Samples without variance differ
+// with p-value 0 if their means differ.
+func WelchTTest(a, b []float64) float64 {
+	if len(a) < 2 || len(b) < 2 {
+		return 1
+	}
+
+	meanA, stddevA := MeanStdDev(a)
+	meanB, stddevB := MeanStdDev(b)
+	varA := stddevA * stddevA / float64(len(a))
+	varB := stddevB * stddevB / float64(len(b))
+	if varA+varB == 0 {
+		if meanA == meanB {
+			return 1
+		}
+		return 0
+	}
+
+	t := (meanA - meanB) / math.Sqrt(varA+varB)
+	// Welch–Satterthwaite degrees of freedom
+	df := (varA + varB) * (varA + varB) /
+		(varA*varA/float64(len(a)-1) + varB*varB/float64(len(b)-1))
+
+	// P(|T| > |t|) of Student's t distribution with df degrees of freedom
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b).
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly for x below the mean of the
+	// distribution, use the symmetry I_x(a, b) = 1 - I_1-x(b, a) otherwise
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete
+// beta function with the modified Lentz method.
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
+
+// WriteComparisons writes the comparisons as a table like benchstat does:
+// the mean and relative standard deviation of the old and new runs, and the
+// delta, which is shown as ~ if it is not significant.
+func WriteComparisons(w io.Writer, comparisons []Comparison) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\told\t\tnew\t\tdelta\t\t\n")
+	for _, c := range comparisons {
+		delta := "~"
+		if c.Significant {
+			delta = fmt.Sprintf("%+.2f%%", c.Delta())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t+- %.2f%%\t%s\t+- %.2f%%\t%s\t(p=%.3f n=%d+%d)\t\n",
+			eventLabel(qualifiedEvent(c.Aggregation, c.Event), c.Unit),
+			formatMean(c.Old), c.Old.RelStdDev(),
+			formatMean(c.New), c.New.RelStdDev(),
+			delta, c.P, c.Old.Runs, c.New.Runs)
+	}
+	return tw.Flush()
+}
+
+// eventLabel returns the event name with its unit, if any.
+func eventLabel(event, unit string) string {
+	if unit == "" {
+		return event
+	}
+	return fmt.Sprintf("%s (%s)", event, unit)
+}
+
+// formatMean returns the mean of s, or <not counted> if no run counted it.
+func formatMean(s Summary) string {
+	if s.Runs == 0 {
+		return notCounted
+	}
+	return fmt.Sprintf("%.2f", s.Mean)
+}
@@ -0,0 +1,155 @@
+package perfstat
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegIncBeta(t *testing.T) {
+	// I_x(a, 1) = x^a and I_x(1, b) = 1 - (1-x)^b
+	assert.InDelta(t, math.Pow(0.3, 2.5), regIncBeta(2.5, 1, 0.3), 1e-12)
+	assert.InDelta(t, 1-math.Pow(0.4, 3), regIncBeta(1, 3, 0.6), 1e-12)
+	assert.Equal(t, 0.0, regIncBeta(2, 2, 0))
+	assert.Equal(t, 1.0, regIncBeta(2, 2, 1))
+}
+
+func TestWelchTTest(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []float64
+		wantP float64
+	}{
+		{
+			// t = -2*sqrt(2) with 2 degrees of freedom, whose two-tailed
+			// p-value is 1 - |t|/sqrt(t^2+2)
+			name:  "two degrees of freedom",
+			a:     []float64{0, 2},
+			b:     []float64{4, 6},
+			wantP: 1 - math.Sqrt(8)/math.Sqrt(10),
+		},
+		{
+			// t = -5 with 8 degrees of freedom
+			name:  "clearly different",
+			a:     []float64{1, 2, 3, 4, 5},
+			b:     []float64{6, 7, 8, 9, 10},
+			wantP: 0.00105,
+		},
+		{name: "identical", a: []float64{1, 2, 3}, b: []float64{1, 2, 3}, wantP: 1},
+		{name: "too few runs", a: []float64{1}, b: []float64{100, 200}, wantP: 1},
+		{name: "constant and equal", a: []float64{5, 5}, b: []float64{5, 5, 5}, wantP: 1},
+		{name: "constant and different", a: []float64{5, 5}, b: []float64{6, 6}, wantP: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.wantP, WelchTTest(tt.a, tt.b), 1e-5)
+			// The test is symmetric
+			assert.InDelta(t, tt.wantP, WelchTTest(tt.b, tt.a), 1e-5)
+		})
+	}
+}
+
+// runsOf returns runs counting event with each of values.
+func runsOf(event string, values ...float64) [][]Counter {
+	runs := make([][]Counter, 0, len(values))
+	for _, v := range values {
+		runs = append(runs, []Counter{{Event: event, Value: v, Counted: true, Running: 100}})
+	}
+	return runs
+}
+
+func TestCompare(t *testing.T) {
+	join := func(a, b [][]Counter) [][]Counter {
+		runs := make([][]Counter, len(a))
+		for i := range a {
+			runs[i] = append(append([]Counter{}, a[i]...), b[i]...)
+		}
+		return runs
+	}
+
+	oldRuns := join(
+		runsOf("cycles", 1000, 1010, 990, 1005, 995),
+		runsOf("instructions", 500, 520, 480, 510, 490),
+	)
+	newRuns := join(
+		runsOf("cycles", 800, 810, 790, 805, 795),
+		runsOf("instructions", 505, 485, 515, 495, 500),
+	)
+	// Events missing from the new runs are not compared
+	oldRuns[0] = append(oldRuns[0], Counter{Event: "branch-misses", Value: 1, Counted: true})
+
+	comparisons := Compare(oldRuns, newRuns, DefaultAlpha)
+	require.Len(t, comparisons, 2)
+
+	cycles := comparisons[0]
+	assert.Equal(t, "cycles", cycles.Event)
+	assert.True(t, cycles.Significant)
+	assert.Less(t, cycles.P, 0.001)
+	assert.InDelta(t, -20, cycles.Delta(), 1e-9)
+	assert.Equal(t, 5, cycles.Old.Runs)
+	assert.Equal(t, 5, cycles.New.Runs)
+
+	instructions := comparisons[1]
+	assert.Equal(t, "instructions", instructions.Event)
+	assert.False(t, instructions.Significant)
+	assert.Greater(t, instructions.P, 0.5)
+}
+
+func TestCompare_PerCore(t *testing.T) {
+	onCore := func(core string, runs [][]Counter) [][]Counter {
+		for _, run := range runs {
+			for i := range run {
+				run[i].Aggregation = core
+			}
+		}
+		return runs
+	}
+	oldRuns := onCore("S0-C0", runsOf("cycles", 1000, 1010, 990))
+	newRuns := onCore("S0-C1", runsOf("cycles", 800, 810, 790))
+
+	// Counters of different cores aren't compared with each other
+	assert.Empty(t, Compare(oldRuns, newRuns, DefaultAlpha))
+
+	newRuns = onCore("S0-C0", newRuns)
+	comparisons := Compare(oldRuns, newRuns, DefaultAlpha)
+	require.Len(t, comparisons, 1)
+	assert.Equal(t, "S0-C0", comparisons[0].Aggregation)
+	assert.True(t, comparisons[0].Significant)
+}
+
+func TestCompare_Alpha(t *testing.T) {
+	oldRuns := runsOf("cycles", 0, 2)
+	newRuns := runsOf("cycles", 4, 6)
+
+	// p is about 0.106
+	assert.False(t, Compare(oldRuns, newRuns, DefaultAlpha)[0].Significant)
+	assert.True(t, Compare(oldRuns, newRuns, 0.2)[0].Significant)
+}
+
+func TestWriteComparisons(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteComparisons(&buf, []Comparison{
+		{
+			Event:       "cycles",
+			Old:         Summary{Event: "cycles", Runs: 5, Mean: 1000, StdDev: 10},
+			New:         Summary{Event: "cycles", Runs: 5, Mean: 800, StdDev: 8},
+			P:           0.0001,
+			Significant: true,
+		},
+		{
+			Event: "task-clock",
+			Unit:  "msec",
+			Old:   Summary{Event: "task-clock", Unit: "msec", Runs: 5, Mean: 10, StdDev: 1},
+			New:   Summary{Event: "task-clock", Unit: "msec", Runs: 4, Mean: 10.5, StdDev: 1},
+			P:     0.45,
+		},
+	}))
+
+	out := buf.String()
+	assert.Regexp(t, `cycles\s+1000\.00\s+\+- 1\.00%\s+800\.00\s+\+- 1\.00%\s+-20\.00%\s+\(p=0\.000 n=5\+5\)`, out)
+	assert.Regexp(t, `task-clock \(msec\)\s+10\.00\s+\+- 10\.00%\s+10\.50\s+\+- 9\.52%\s+~\s+\(p=0\.450 n=5\+4\)`, out)
+}
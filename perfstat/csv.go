@@ -0,0 +1,175 @@
+// Package perfstat parses the CSV output of perf stat -x, into counters and
+// aggregates the counters of repeated runs.
+package perfstat
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Separator is the field separator passed to perf stat -x.
+const Separator = ","
+
+// Values perf prints instead of a count for events it could not measure
+const (
+	notCounted   = "<not counted>"
+	notSupported = "<not supported>"
+)
+
+// Counter is the value of one event of a perf stat run.
+type Counter struct {
+	Event string  // Event name (e.g., cycles, task-clock)
+	Unit  string  // Unit of the value (e.g., msec), empty for counts
+	Value float64 // Counted value
+	// Whether the event was counted, perf prints <not counted> or
+	// <not supported> otherwise
+	Counted bool
+	// Percentage of the run time the event was scheduled on a counter, below
+	// 100 if events were multiplexed
+	Running float64
+	// Core, socket or thread the value was counted for in an aggregation mode
+	// (e.g., S0-C1, S1 or worker-1234), empty for the whole run
+	Aggregation string
+	// Number of CPUs aggregated in the per core and per socket modes
+	CPUs int
+	// Relative standard deviation in percent over the runs of perf stat -r,
+	// 0 for a single run
+	Variance float64
+}
+
+// key identifies the counter within a run, as an event is counted once per
+// core, socket or thread in the aggregation modes.
+func (c Counter) key() string {
+	return qualifiedEvent(c.Aggregation, c.Event)
+}
+
+// qualifiedEvent returns the event name prefixed with the aggregation it was
+// counted for, if any.
+func qualifiedEvent(aggregation, event string) string {
+	if aggregation == "" {
+		return event
+	}
+	return aggregation + " " + event
+}
+
+// ParseCSV returns the counters of perf stat -x, output. Lines that are not
+// counters, like the output of the measured test mixed into stderr, are
+// skipped.
+//
+// perf prints a line per event with the fields value, unit, event, counter
+// run time, running percentage, and optionally a metric and its unit. In the
+// aggregation modes the line starts with the id of the core, socket or
+// thread, followed by the number of aggregated CPUs for cores and sockets.
+// perf stat -r adds the variance (e.g., 0.52%) after the event.
+func ParseCSV(output string) []Counter {
+	var counters []Counter
+	for _, line := range strings.Split(output, "\n") {
+		if counter, ok := parseCSVLine(strings.TrimSpace(line)); ok {
+			counters = append(counters, counter)
+		}
+	}
+	return counters
+}
+
+// parseCSVLine parses a counter line of perf stat -x, output.
+func parseCSVLine(line string) (Counter, bool) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Counter{}, false
+	}
+	fields, aggregation, cpus := splitAggregation(strings.Split(line, Separator))
+	if len(fields) < 5 || fields[2] == "" {
+		return Counter{}, false
+	}
+
+	counter := Counter{Event: fields[2], Unit: fields[1], Aggregation: aggregation, CPUs: cpus}
+	if variance, ok := strings.CutSuffix(fields[3], "%"); ok {
+		v, err := strconv.ParseFloat(variance, 64)
+		if err != nil || len(fields) < 6 {
+			return Counter{}, false
+		}
+		counter.Variance = v
+		fields = append(fields[:3:3], fields[4:]...)
+	}
+	switch fields[0] {
+	case notCounted, notSupported:
+	default:
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return Counter{}, false
+		}
+		counter.Value = value
+		counter.Counted = true
+	}
+
+	running, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return Counter{}, false
+	}
+	counter.Running = running
+
+	return counter, true
+}
+
+// cpuAggregation matches the ids of the per socket, die, core and node
+// aggregation modes (e.g., S0, S0-D0-C1, N1).
+var cpuAggregation = regexp.MustCompile(`^(S\d+(-D\d+)?(-C\d+)?|N\d+)$`)
+
+// threadAggregation matches the comm-tid ids of the per thread mode.
+var threadAggregation = regexp.MustCompile(`^.+-\d+$`)
+
+// splitAggregation strips the aggregation id and number of CPUs from the
+// fields of a counter line, if present.
+func splitAggregation(fields []string) ([]string, string, int) {
+	if len(fields) < 2 || isValue(fields[0]) {
+		return fields, "", 0
+	}
+	if cpuAggregation.MatchString(fields[0]) {
+		cpus, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fields, "", 0
+		}
+		return fields[2:], fields[0], cpus
+	}
+	if threadAggregation.MatchString(fields[0]) && isValue(fields[1]) {
+		return fields[1:], fields[0], 0
+	}
+	return fields, "", 0
+}
+
+// isValue reports whether field is the value of a counter.
+func isValue(field string) bool {
+	if field == notCounted || field == notSupported {
+		return true
+	}
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil
+}
+
+// WriteCSV writes counters in the format of perf stat -x, without the
+// counter run time and metrics, so ParseCSV reads them back.
+func WriteCSV(w io.Writer, counters []Counter) error {
+	for _, c := range counters {
+		value := notCounted
+		if c.Counted {
+			value = strconv.FormatFloat(c.Value, 'f', -1, 64)
+		}
+		fields := []string{value, c.Unit, c.Event, "", strconv.FormatFloat(c.Running, 'f', 2, 64)}
+		if c.Variance != 0 {
+			fields = slices.Insert(fields, 3, strconv.FormatFloat(c.Variance, 'f', 2, 64)+"%")
+		}
+		switch {
+		case c.CPUs > 0:
+			fields = append([]string{c.Aggregation, strconv.Itoa(c.CPUs)}, fields...)
+		case c.Aggregation != "":
+			fields = append([]string{c.Aggregation}, fields...)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(fields, Separator)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package perfstat
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	output := `=== RUN   TestFoo
+12.34,msec,task-clock,12340000,100.00,0.998,CPUs utilized
+1234567,,cycles,1000000,50.00,,
+<not counted>,,instructions,0,0.00,,
+<not supported>,,branch-misses,0,100.00,,
+PASS
+
+# started on Mon Jan  1 00:00:00 2024
+garbage,line
+`
+
+	assert.Equal(t, []Counter{
+		{Event: "task-clock", Unit: "msec", Value: 12.34, Counted: true, Running: 100},
+		{Event: "cycles", Value: 1234567, Counted: true, Running: 50},
+		{Event: "instructions"},
+		{Event: "branch-misses", Running: 100},
+	}, ParseCSV(output))
+}
+
+func TestParseCSV_Aggregation(t *testing.T) {
+	perCore := `S0-D0-C0,2,1234567,,cycles,2000000,100.00,,
+S0-D0-C1,2,<not counted>,,cycles,0,0.00,,
+S1-C0,1,12.5,msec,task-clock,12500000,100.00,0.5,CPUs utilized
+`
+	assert.Equal(t, []Counter{
+		{Event: "cycles", Value: 1234567, Counted: true, Running: 100, Aggregation: "S0-D0-C0", CPUs: 2},
+		{Event: "cycles", Aggregation: "S0-D0-C1", CPUs: 2},
+		{Event: "task-clock", Unit: "msec", Value: 12.5, Counted: true, Running: 100, Aggregation: "S1-C0", CPUs: 1},
+	}, ParseCSV(perCore))
+
+	perSocket := "S0,8,4000,,instructions,1000,100.00,,\nN1,4,10,,cycles,1000,100.00,,\n"
+	assert.Equal(t, []Counter{
+		{Event: "instructions", Value: 4000, Counted: true, Running: 100, Aggregation: "S0", CPUs: 8},
+		{Event: "cycles", Value: 10, Counted: true, Running: 100, Aggregation: "N1", CPUs: 4},
+	}, ParseCSV(perSocket))
+
+	perThread := "perfgo.test-1234,5000,,cycles,1000,100.00,,\nGC worker-1240,<not counted>,,cycles,0,0.00,,\n"
+	assert.Equal(t, []Counter{
+		{Event: "cycles", Value: 5000, Counted: true, Running: 100, Aggregation: "perfgo.test-1234"},
+		{Event: "cycles", Aggregation: "GC worker-1240"},
+	}, ParseCSV(perThread))
+
+	// Values in exponent notation aren't mistaken for thread ids
+	assert.Equal(t, []Counter{{Event: "cycles", Value: 1.5e-05, Counted: true, Running: 100}}, ParseCSV("1.5e-05,,cycles,1000,100.00,,"))
+}
+
+func TestWriteCSV_AggregationRoundTrip(t *testing.T) {
+	counters := []Counter{
+		{Event: "cycles", Value: 10, Counted: true, Running: 100, Aggregation: "S0-C1", CPUs: 2},
+		{Event: "cycles", Value: 20, Counted: true, Running: 100, Aggregation: "worker-12"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, counters))
+	assert.Equal(t, "S0-C1,2,10,,cycles,,100.00\nworker-12,20,,cycles,,100.00\n", buf.String())
+	assert.Equal(t, counters, ParseCSV(buf.String()))
+}
+
+func TestParseCSV_Variance(t *testing.T) {
+	output := `12.34,msec,task-clock,0.52%,12340000,100.00,0.998,CPUs utilized
+1234567,,cycles,1.05%,1000000,50.00,,
+<not counted>,,instructions,0,0.00,,
+S0-C1,2,4000,,instructions,12.00%,1000,100.00,,
+`
+
+	assert.Equal(t, []Counter{
+		{Event: "task-clock", Unit: "msec", Value: 12.34, Counted: true, Running: 100, Variance: 0.52},
+		{Event: "cycles", Value: 1234567, Counted: true, Running: 50, Variance: 1.05},
+		{Event: "instructions"},
+		{Event: "instructions", Value: 4000, Counted: true, Running: 100, Aggregation: "S0-C1", CPUs: 2, Variance: 12},
+	}, ParseCSV(output))
+
+	// A malformed variance doesn't yield a counter
+	assert.Nil(t, ParseCSV("1234567,,cycles,n/a%,1000000,50.00,,"))
+}
+
+func TestWriteCSV_VarianceRoundTrip(t *testing.T) {
+	counters := []Counter{{Event: "cycles", Value: 10, Counted: true, Running: 100, Variance: 2.5}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, counters))
+	assert.Equal(t, "10,,cycles,2.50%,,100.00\n", buf.String())
+	assert.Equal(t, counters, ParseCSV(buf.String()))
+}
+
+func TestParseCSV_Empty(t *testing.T) {
+	assert.Nil(t, ParseCSV(""))
+	assert.Nil(t, ParseCSV("ok  \tpkg\t0.1s\n"))
+}
+
+func TestWriteCSV_RoundTrip(t *testing.T) {
+	counters := []Counter{
+		{Event: "task-clock", Unit: "msec", Value: 12.34, Counted: true, Running: 100},
+		{Event: "cycles", Value: 1234567, Counted: true, Running: 49.5},
+		{Event: "instructions"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, counters))
+	assert.Equal(t, "12.34,msec,task-clock,,100.00\n1234567,,cycles,,49.50\n<not counted>,,instructions,,0.00\n", buf.String())
+	assert.Equal(t, counters, ParseCSV(buf.String()))
+}